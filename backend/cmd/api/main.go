@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -26,14 +28,17 @@ import (
 	"github.com/aws-agent/backend/internal/llm"
 	"github.com/aws-agent/backend/internal/metrics"
 	"github.com/aws-agent/backend/internal/middleware/ratelimit"
+	"github.com/aws-agent/backend/internal/middleware/requestid"
 	"github.com/aws-agent/backend/internal/middleware/security"
 	"github.com/aws-agent/backend/internal/middleware/validation"
 	"github.com/aws-agent/backend/internal/query"
 	"github.com/aws-agent/backend/internal/search/web"
 	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/internal/usage"
 	"github.com/aws-agent/backend/internal/vector/zilliz"
 	"github.com/aws-agent/backend/pkg/config"
 	appLogger "github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/shutdown"
 )
 
 func main() {
@@ -54,11 +59,22 @@ func main() {
 
 	metrics.Init()
 
+	embeddingDim, err := llm.ResolveEmbeddingDim(cfg.LLM.EmbeddingModel, cfg.LLM.EmbeddingDim)
+	if err != nil {
+		appLogger.Fatal("Invalid embedding configuration", zap.Error(err))
+	}
+	if embeddingDim != cfg.Zilliz.VectorDim {
+		appLogger.Fatal("Embedding dimension does not match vector collection dimension",
+			zap.String("embedding_model", cfg.LLM.EmbeddingModel),
+			zap.Int("embedding_dim", embeddingDim),
+			zap.Int("vector_dim", cfg.Zilliz.VectorDim),
+		)
+	}
+
 	sqliteClient, err := sqlite.NewClient(cfg.SQLite.Path)
 	if err != nil {
 		appLogger.Fatal("Failed to create SQLite client", zap.Error(err))
 	}
-	defer sqliteClient.Close()
 
 	sqliteClient.DB.SetMaxOpenConns(25)
 	sqliteClient.DB.SetMaxIdleConns(5)
@@ -78,21 +94,30 @@ func main() {
 	if err != nil {
 		appLogger.Fatal("Failed to create Neo4j client", zap.Error(err))
 	}
-	defer neo4jClient.Close(context.Background())
 
 	zillizClient, err := zilliz.NewClient(
 		cfg.Zilliz.Endpoint,
 		cfg.Zilliz.APIKey,
 		cfg.Zilliz.CollectionName,
 		cfg.Zilliz.VectorDim,
+		cfg.Zilliz.IndexType,
+		cfg.Zilliz.MetricType,
+		zilliz.Collections{
+			Staging:         cfg.Zilliz.StagingCollection,
+			IngestToStaging: cfg.Zilliz.IngestToStaging,
+		},
 	)
 	if err != nil {
 		appLogger.Fatal("Failed to create Zilliz client", zap.Error(err))
 	}
-	defer zillizClient.Close()
+	if err := zillizClient.WithCollectionStore(sqliteClient).RestoreCollections(); err != nil {
+		appLogger.Fatal("Failed to restore vector collections", zap.Error(err))
+	}
 
 	err = zillizClient.CreateCollection(context.Background())
-	if err != nil {
+	if errors.Is(err, zilliz.ErrDimensionMismatch) {
+		appLogger.Warn("Vector collection does not match the embedding model, vector search fails until POST /api/v1/admin/reindex is run", zap.Error(err))
+	} else if err != nil {
 		appLogger.Fatal("Failed to create collection", zap.Error(err))
 	}
 
@@ -104,29 +129,150 @@ func main() {
 	)
 	if err != nil {
 		appLogger.Warn("Failed to create Redis client, continuing without cache", zap.Error(err))
-	} else {
-		defer redisClient.Close()
 	}
 
-	llmClient := llm.NewClient(
-		cfg.LLM.APIKey,
-		cfg.LLM.Model,
-		cfg.LLM.EmbeddingModel,
-		cfg.LLM.Temperature,
-		cfg.LLM.MaxTokens,
-	)
+	llmClient, err := llm.NewClient(llm.Config{
+		Provider:              cfg.LLM.Provider,
+		APIKey:                cfg.LLM.APIKey,
+		Model:                 cfg.LLM.Model,
+		EmbeddingProvider:     cfg.LLM.EmbeddingProvider,
+		EmbeddingAPIKey:       cfg.LLM.EmbeddingAPIKey,
+		EmbeddingModel:        cfg.LLM.EmbeddingModel,
+		EmbeddingDim:          embeddingDim,
+		Region:                cfg.LLM.Region,
+		Temperature:           cfg.LLM.Temperature,
+		MaxTokens:             cfg.LLM.MaxTokens,
+		Pricing:               llmPricing(cfg.LLM.Pricing),
+		MaxConcurrentRequests: cfg.LLM.MaxConcurrentRequests,
+		EmbeddingConcurrency:  cfg.LLM.EmbeddingConcurrency,
+	})
+	if err != nil {
+		appLogger.Fatal("Failed to create LLM client", zap.Error(err))
+	}
+	if redisClient != nil {
+		llmClient.WithEmbeddingCache(redisClient, time.Duration(cfg.Redis.EmbeddingCacheTTLSec)*time.Second)
+	}
 
-	kgBuilder := builder.NewBuilder(sqliteClient, neo4jClient, llmClient)
+	kgBuilder := builder.NewBuilder(sqliteClient, neo4jClient, llmClient, builder.Config{
+		SeedConceptsPath:     cfg.KG.SeedConceptsPath,
+		ReplaceSeedConcepts:  cfg.KG.ReplaceSeedConcepts,
+		MaxRelationsPerDoc:   cfg.KG.MaxRelationsPerDoc,
+		AutoCreateEntities:   cfg.KG.AutoCreateEntities,
+		AutoCreateConfidence: cfg.KG.AutoCreateConfidence,
+		MaxKnownEntities:     cfg.KG.MaxKnownEntities,
+		MaxExtractionTokens:  cfg.KG.MaxExtractionTokens,
+		WriteBatchSize:       cfg.KG.WriteBatchSize,
+		EntityMergeEnabled:   cfg.KG.EntityMergeEnabled,
+		EntityMergeThreshold: cfg.KG.EntityMergeThreshold,
+	})
 	err = kgBuilder.InitializeSeedConcepts()
 	if err != nil {
 		appLogger.Warn("Failed to initialize seed concepts", zap.Error(err))
 	}
 
-	webSearchClient := web.NewClient(cfg.Search.SerpAPIKey, llmClient)
-	processor := ingestion.NewProcessor(sqliteClient, zillizClient, llmClient)
-	queryEngine := query.NewEngine(sqliteClient, neo4jClient, zillizClient, llmClient)
-	evaluator := evaluation.NewEvaluator(sqliteClient, llmClient)
-	actionsExecutor := actions.NewExecutor(llmClient, true)
+	processor := ingestion.NewProcessor(sqliteClient, zillizClient, llmClient, ingestion.ProcessorConfig{
+		MinContentChars: cfg.Ingestion.MinContentChars,
+		ChunkSize:       cfg.Ingestion.ChunkSize,
+		ChunkOverlap:    cfg.Ingestion.ChunkOverlap,
+		MaxContentBytes: cfg.Ingestion.MaxContentBytes,
+	}).
+		WithBlankChunkFilter(cfg.Ingestion.DropBlankChunks).
+		WithQueryCache(redisClient)
+	if cfg.Ingestion.ClassifyDocTypes {
+		processor.WithDocTypeClassification(redisClient, time.Duration(cfg.Ingestion.DocTypeCacheTTLSec)*time.Second)
+	}
+	ingestionQueue := ingestion.NewJobQueue(processor, ingestion.QueueConfig{
+		Workers:         cfg.Ingestion.Workers,
+		QueueSize:       cfg.Ingestion.QueueSize,
+		MaxFetchBytes:   int64(cfg.Server.BodyLimit),
+		AllowedDomains:  cfg.Ingestion.AllowedDomains,
+		AllowedPaths:    cfg.Ingestion.AllowedPaths,
+		MaxSitemapPages: cfg.Ingestion.MaxSitemapPages,
+	})
+	webSearchClient := web.NewClient(web.Config{
+		SerpAPIKey:      cfg.Search.SerpAPIKey,
+		Timeout:         time.Duration(cfg.Search.TimeoutSec) * time.Second,
+		ScrapeTimeout:   time.Duration(cfg.Search.ScrapeTimeoutSec) * time.Second,
+		MaxScrapeBytes:  cfg.Search.MaxScrapeBytes,
+		MaxScrapeChars:  cfg.Search.MaxScrapeChars,
+		MaxContextChars: cfg.Search.MaxContextChars,
+		AutoIngest:      cfg.Search.AutoIngest,
+		AllowedDomains:  cfg.Search.AllowedDomains,
+	}, llmClient, sqliteClient).WithAutoIngest(ingestionQueue)
+	if redisClient != nil {
+		webSearchClient.WithCache(redisClient, time.Duration(cfg.Redis.WebSearchCacheTTLSec)*time.Second)
+	}
+	fusionWeights := make(map[string]query.FusionWeights, len(cfg.Query.FusionWeights))
+	for intent, weights := range cfg.Query.FusionWeights {
+		fusionWeights[intent] = query.FusionWeights{KG: weights.KG, Vector: weights.Vector}
+	}
+	queryEngine := query.NewEngine(sqliteClient, neo4jClient, zillizClient, llmClient, redisClient, query.Config{
+		UnknownServiceStrategy:  cfg.Query.UnknownServiceStrategy,
+		QueryCacheTTL:           time.Duration(cfg.Redis.QueryCacheTTLSec) * time.Second,
+		HistoryResponseMaxChars: cfg.Query.HistoryResponseMaxChars,
+		FusionK:                 cfg.Query.FusionK,
+		MaxContextResults:       cfg.Query.MaxContextResults,
+		VectorTopK:              cfg.Query.VectorTopK,
+		FollowUpsEnabled:        cfg.Query.FollowUpsEnabled,
+		FollowUpMinConfidence:   cfg.Query.FollowUpMinConfidence,
+		MaxFollowUps:            cfg.Query.MaxFollowUps,
+		ContextChunkMaxTokens:   cfg.Query.ContextChunkMaxTokens,
+		MaxPromptTokens:         cfg.Query.MaxPromptTokens,
+		ContextWindowTokens:     cfg.Query.ContextWindowTokens,
+		PromptHeadroomTokens:    cfg.Query.PromptHeadroomTokens,
+		WebSearchEnabled:        cfg.Search.Enabled,
+		WebSearchMaxResults:     cfg.Search.MaxResults,
+		LLMEntityExtraction:     cfg.Query.LLMEntityExtraction,
+		EntityExtractionTimeout: time.Duration(cfg.Query.EntityExtractionTimeoutMS) * time.Millisecond,
+		EntityCacheTTL:          time.Duration(cfg.Query.EntityCacheTTLSec) * time.Second,
+		MaxLLMCalls:             cfg.Query.MaxLLMCallsPerRequest,
+		CalibrationMinSamples:   cfg.Query.CalibrationMinSamples,
+		CalibrationMaxSamples:   cfg.Query.CalibrationMaxSamples,
+		RerankEnabled:           cfg.Query.RerankEnabled,
+		RerankTimeout:           time.Duration(cfg.Query.RerankTimeoutMS) * time.Millisecond,
+		RerankMaxCandidates:     cfg.Query.RerankMaxCandidates,
+		DisclaimerEnabled:       cfg.Query.DisclaimerEnabled,
+		DisclaimerPosition:      cfg.Query.DisclaimerPosition,
+		DestructiveDisclaimer:   cfg.Query.DestructiveDisclaimer,
+		HybridSearchEnabled:     cfg.Query.HybridSearchEnabled,
+		KeywordSearchLimit:      cfg.Query.KeywordSearchLimit,
+		FusionWeights:           fusionWeights,
+		ConversationTTL:         time.Duration(cfg.Query.ConversationTTLSec) * time.Second,
+		ConversationMaxTurns:    cfg.Query.ConversationMaxTurns,
+		ConversationMaxTokens:   cfg.Query.ConversationMaxTokens,
+		SemanticCacheEnabled:    cfg.Query.SemanticCacheEnabled,
+		SemanticCacheThreshold:  cfg.Query.SemanticCacheThreshold,
+		SemanticCacheMaxEntries: cfg.Query.SemanticCacheMaxEntries,
+	}).WithWebSearch(webSearchClient)
+	evaluator := evaluation.NewEvaluator(sqliteClient, llmClient, queryEngine, evaluation.Config{
+		CosineDowngradeThreshold: cfg.Evaluation.CosineDowngradeThreshold,
+	})
+	usageTracker := usage.NewTracker(sqliteClient, cfg.Query.DailyTokenBudget)
+	quotaOverrides := make(map[string]int, len(cfg.Quota.Overrides))
+	for _, override := range cfg.Quota.Overrides {
+		quotaOverrides[override.UserID] = override.DailyQueryLimit
+	}
+	quotaTracker := usage.NewQuotaTracker(redisClient, usage.QuotaConfig{
+		DailyLimit: cfg.Quota.DailyQueryLimit,
+		Overrides:  quotaOverrides,
+	})
+	if cfg.Quota.DailyQueryLimit > 0 && redisClient == nil {
+		appLogger.Warn("Query quotas require Redis and are disabled")
+	}
+	actionsExecutor := actions.NewExecutor(llmClient, cfg.Actions.DryRun, cfg.Actions.VerifyPrerequisites)
+	if !cfg.Actions.DryRun {
+		ec2Client, err := actions.NewEC2Client(cfg.Actions.Region)
+		if err != nil {
+			appLogger.Fatal("Failed to create EC2 client", zap.Error(err))
+		}
+		actionsExecutor.WithEC2(ec2Client)
+	}
+	approvalManager := actions.NewApprovalManager(
+		sqliteClient,
+		cfg.Actions.ApprovalWebhookURL,
+		cfg.Actions.ApprovalSecret,
+		time.Duration(cfg.Actions.ApprovalTimeoutSec)*time.Second,
+	)
 
 	app := fiber.New(fiber.Config{
 		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
@@ -137,22 +283,22 @@ func main() {
 	})
 
 	app.Use(recover.New())
-	app.Use(logger.New())
+	app.Use(requestid.New())
+	app.Use(logger.New(logger.Config{
+		Format: "${time} | ${status} | ${latency} | ${ip} | ${method} | ${path} | ${locals:requestid} | ${error}\n",
+	}))
 
-	allowedOrigins := "http://localhost:3000"
-	if cfg.Server.AllowedOrigins != "" {
-		allowedOrigins = cfg.Server.AllowedOrigins
-	}
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     allowedOrigins,
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-User-ID",
+		AllowOrigins:     strings.Join(cfg.Server.AllowedOrigins, ","),
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-User-ID, X-Request-ID",
+		ExposeHeaders:    "X-Quota-Limit, X-Quota-Remaining, X-Quota-Reset, X-Request-ID",
 		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
-		AllowCredentials: true,
+		AllowCredentials: cfg.Server.AllowCredentials,
 		MaxAge:           3600,
 	}))
 
 	app.Use(security.HeadersMiddleware(security.HeadersConfig{
-		AllowedOrigins: []string{allowedOrigins},
+		AllowedOrigins: cfg.Server.AllowedOrigins,
 		IsDevelopment:  cfg.Server.Environment == "development",
 	}))
 
@@ -167,29 +313,82 @@ func main() {
 	})
 	app.Use(rateLimiter.Middleware())
 
-	app.Use(validation.Middleware(validation.Config{
+	validationConfig := validation.Config{
 		MaxQueryLength:      5000,
 		MaxDocumentSize:     10 * 1024 * 1024,
+		EncodedThreshold:    cfg.Query.EncodedQueryThreshold,
 		AllowedContentTypes: []string{"application/json", "multipart/form-data"},
 		Logger:              appLogger.GetLogger(),
-	}))
+	}
+	app.Use(validation.Middleware(validationConfig))
+
+	userResolver := handlers.NewUserResolver(cfg.Users.AnonymousMode, cfg.Users.AnonymousID).
+		WithIdentityHeader(cfg.Users.IdentityHeader)
+	queryHandler := handlers.NewQueryHandler(queryEngine, usageTracker, sqliteClient, userResolver).WithQuota(quotaTracker)
+	documentHandler := handlers.NewDocumentHandler(processor, ingestionQueue, kgBuilder, sqliteClient, handlers.BatchConfig{
+		Concurrency:  cfg.Ingestion.BatchConcurrency,
+		MaxDocuments: cfg.Ingestion.MaxBatchSize,
+	})
+	appCtx, appCancel := context.WithCancel(context.Background())
+	defer appCancel()
 
-	queryHandler := handlers.NewQueryHandler(queryEngine)
-	documentHandler := handlers.NewDocumentHandler(processor)
-	wsHandler := handlers.NewWebSocketHandler(queryEngine)
-	actionsHandler := handlers.NewActionsHandler(actionsExecutor)
+	neo4jClient.StartStatsRefresher(appCtx, time.Duration(cfg.KG.StatsRefreshSec)*time.Second)
+
+	if err := queryEngine.LoadCalibration(); err != nil {
+		appLogger.Warn("Failed to load confidence calibration, using heuristic confidence", zap.Error(err))
+	}
+	if cfg.Query.CalibrationIntervalSec > 0 {
+		queryEngine.StartCalibrationRefresher(appCtx, time.Duration(cfg.Query.CalibrationIntervalSec)*time.Second)
+	}
+
+	wsHandler := handlers.NewWebSocketHandler(appCtx, queryEngine, usageTracker, userResolver, validation.NewValidator(validationConfig)).WithQuota(quotaTracker)
+	kgHandler := handlers.NewKGHandler(neo4jClient, kgBuilder)
+	vectorHandler := handlers.NewVectorHandler(zillizClient, redisClient)
+	actionsHandler := handlers.NewActionsHandler(appCtx, actionsExecutor, approvalManager, sqliteClient, userResolver)
+	healthHandler := handlers.NewHealthHandler(llmClient, zillizClient, neo4jClient, handlers.SelfTestConfig{
+		Enabled:     cfg.Health.SelfTestEnabled,
+		Token:       cfg.Health.SelfTestToken,
+		MinInterval: time.Duration(cfg.Health.SelfTestIntervalSec) * time.Second,
+	}).WithReadinessChecks(sqliteClient, redisClient, time.Duration(cfg.Health.ReadyTimeoutMS)*time.Millisecond)
+	evaluationJobs := evaluation.NewJobs(appCtx, sqliteClient, evaluator, evaluation.JobConfig{
+		Concurrency:     cfg.Evaluation.Concurrency,
+		MaxDatasetItems: cfg.Evaluation.MaxDatasetItems,
+	})
+	if err := evaluationJobs.RecoverInterrupted(); err != nil {
+		appLogger.Warn("Failed to recover interrupted evaluation runs", zap.Error(err))
+	}
+	evaluationHandler := handlers.NewEvaluationHandler(evaluationJobs)
+	maintenanceHandler := handlers.NewMaintenanceHandler(appCtx, sqliteClient, ingestionQueue, processor, queryEngine, handlers.MaintenanceConfig{
+		Enabled:             cfg.Maintenance.Enabled,
+		Token:               cfg.Maintenance.Token,
+		MinInterval:         time.Duration(cfg.Maintenance.VacuumIntervalSec) * time.Second,
+		MaxIngestionBacklog: cfg.Maintenance.MaxIngestionBacklog,
+	})
 
 	api := app.Group("/api/v1")
 
 	api.Post("/query", queryHandler.HandleQuery)
 	api.Get("/query/history", queryHandler.GetQueryHistory)
+	api.Get("/query/history/:id/response", queryHandler.GetQueryResponse)
 
 	api.Get("/ws", websocket.New(wsHandler.HandleConnection))
 
+	api.Get("/documents", documentHandler.ListDocuments)
 	api.Post("/documents", documentHandler.UploadDocument)
+	api.Post("/documents/batch", documentHandler.UploadDocumentBatch)
+	api.Post("/documents/sitemap", documentHandler.IngestSitemap)
+	api.Post("/documents/refresh", documentHandler.RefreshDocument)
+	api.Post("/documents/:id/build-kg", documentHandler.BuildKG)
+
+	api.Get("/kg/entities", kgHandler.GetEntities)
+	api.Get("/kg/stats", kgHandler.GetStats)
+
+	api.Get("/vector/collections", vectorHandler.GetCollections)
 
 	api.Post("/actions/plan", actionsHandler.PlanActions)
 	api.Post("/actions/execute", actionsHandler.ExecuteActions)
+	api.Get("/actions/approvals/:id", actionsHandler.GetApproval)
+	api.Post("/actions/approvals/:id/callback", actionsHandler.ApprovalCallback)
 
 	api.Get("/metrics", metrics.MetricsHandler())
 
@@ -198,20 +397,31 @@ func main() {
 			"status": "healthy",
 			"time":   time.Now().Unix(),
 			"features": map[string]bool{
-				"redis_cache":    redisClient != nil,
-				"web_search":     cfg.Search.Enabled,
-				"websocket":      true,
-				"aws_actions":    true,
-				"metrics":        true,
+				"redis_cache": redisClient != nil,
+				"web_search":  cfg.Search.Enabled,
+				"websocket":   true,
+				"aws_actions": true,
+				"metrics":     true,
 			},
 		})
 	})
 
-	api.Get("/ready", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"status": "ready",
-		})
-	})
+	api.Get("/health/selftest", healthHandler.SelfTest)
+	api.Get("/health/breakers", healthHandler.Breakers)
+
+	admin := api.Group("/admin", maintenanceHandler.Authorize)
+	admin.Post("/maintenance/vacuum", maintenanceHandler.Vacuum)
+	admin.Get("/query/:id/diagnostics", queryHandler.GetQueryDiagnostics)
+	admin.Post("/recalibrate", maintenanceHandler.Recalibrate)
+	admin.Post("/reindex", maintenanceHandler.Reindex)
+	admin.Get("/reindex", maintenanceHandler.ReindexStatus)
+	admin.Post("/evaluate", evaluationHandler.StartEvaluation)
+	admin.Get("/evaluate/:id", evaluationHandler.GetEvaluation)
+	admin.Post("/vector/collections/switch", vectorHandler.SwitchCollection)
+	admin.Post("/kg/import", kgHandler.ImportGraph)
+	admin.Post("/kg/entities/:id/aliases", kgHandler.AddAlias)
+
+	api.Get("/ready", healthHandler.Ready)
 
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
 	appLogger.Info("Server starting with enhanced features",
@@ -234,31 +444,51 @@ func main() {
 
 	appLogger.Info("Server shutting down gracefully...")
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer shutdownCancel()
+	coordinator := shutdown.NewCoordinator(30*time.Second, appLogger.GetLogger())
 
-	if redisClient != nil {
-		appLogger.Info("Closing Redis connection...")
-		redisClient.Close()
-	}
+	coordinator.Register(shutdown.PhaseServer, "http", app.ShutdownWithContext)
+	coordinator.Register(shutdown.PhaseServer, "lifecycle", func(ctx context.Context) error {
+		appCancel()
+		return nil
+	})
 
-	if err := neo4jClient.Close(shutdownCtx); err != nil {
-		appLogger.Error("Error closing Neo4j connection", zap.Error(err))
-	}
+	coordinator.Register(shutdown.PhaseWorkers, "evaluation", evaluationJobs.Wait)
+	coordinator.Register(shutdown.PhaseWorkers, "reindex", maintenanceHandler.Wait)
+	coordinator.Register(shutdown.PhaseWorkers, "approvals", actionsHandler.Wait)
+	coordinator.Register(shutdown.PhaseWorkers, "ratelimiter", func(ctx context.Context) error {
+		rateLimiter.Stop()
+		return nil
+	})
+	coordinator.Register(shutdown.PhaseWorkers, "ingestion", func(ctx context.Context) error {
+		ingestionQueue.Stop()
+		return nil
+	})
 
-	if err := zillizClient.Close(); err != nil {
-		appLogger.Error("Error closing Zilliz connection", zap.Error(err))
+	if redisClient != nil {
+		coordinator.Register(shutdown.PhaseClients, "redis", func(ctx context.Context) error {
+			return redisClient.Close()
+		})
 	}
+	coordinator.Register(shutdown.PhaseClients, "neo4j", neo4jClient.Close)
+	coordinator.Register(shutdown.PhaseClients, "zilliz", func(ctx context.Context) error {
+		return zillizClient.Close()
+	})
+	coordinator.Register(shutdown.PhaseClients, "sqlite", func(ctx context.Context) error {
+		return sqliteClient.Close()
+	})
 
-	if err := sqliteClient.Close(); err != nil {
-		appLogger.Error("Error closing SQLite connection", zap.Error(err))
-	}
+	coordinator.Shutdown()
 
-	rateLimiter.Stop()
+	appLogger.Info("Server stopped successfully")
+}
 
-	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
-		appLogger.Error("Error during server shutdown", zap.Error(err))
+func llmPricing(prices map[string]config.ModelPrice) map[string]llm.Price {
+	pricing := make(map[string]llm.Price, len(prices))
+	for model, price := range prices {
+		pricing[model] = llm.Price{
+			InputPer1K:  price.InputPer1K,
+			OutputPer1K: price.OutputPer1K,
+		}
 	}
-
-	appLogger.Info("Server stopped successfully")
+	return pricing
 }
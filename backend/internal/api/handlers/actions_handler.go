@@ -1,20 +1,48 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"github.com/aws-agent/backend/internal/aws/actions"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
 	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/shutdown"
 )
 
+type ActionResultResponse struct {
+	Service     string `json:"service"`
+	Action      string `json:"action"`
+	Description string `json:"description"`
+	Success     bool   `json:"success"`
+	Output      string `json:"output,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
 type ActionsHandler struct {
-	executor *actions.Executor
+	executor  *actions.Executor
+	approvals *actions.ApprovalManager
+	db        *sqlite.Client
+	users     *UserResolver
+	lifecycle context.Context
+
+	wg sync.WaitGroup
 }
 
-func NewActionsHandler(executor *actions.Executor) *ActionsHandler {
+func NewActionsHandler(lifecycle context.Context, executor *actions.Executor, approvals *actions.ApprovalManager, db *sqlite.Client, users *UserResolver) *ActionsHandler {
 	return &ActionsHandler{
-		executor: executor,
+		executor:  executor,
+		approvals: approvals,
+		db:        db,
+		users:     users,
+		lifecycle: lifecycle,
 	}
 }
 
@@ -22,6 +50,7 @@ func (h *ActionsHandler) PlanActions(c *fiber.Ctx) error {
 	var req struct {
 		Issue   string `json:"issue"`
 		Context string `json:"context"`
+		UserID  string `json:"user_id"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -31,7 +60,7 @@ func (h *ActionsHandler) PlanActions(c *fiber.Ctx) error {
 		})
 	}
 
-	plan, err := h.executor.PlanActions(c.Context(), req.Issue, req.Context)
+	plan, err := h.executor.PlanActions(c.UserContext(), req.Issue, req.Context)
 	if err != nil {
 		logger.Error("Failed to plan actions", zap.Error(err))
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -39,18 +68,66 @@ func (h *ActionsHandler) PlanActions(c *fiber.Ctx) error {
 		})
 	}
 
+	planJSON, err := actions.EncodePlan(plan)
+	if err != nil {
+		logger.Error("Failed to encode action plan", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to plan actions",
+		})
+	}
+
+	requestedBy := h.users.Authenticated(c)
+	if requestedBy == "" {
+		requestedBy = h.users.Resolve(req.UserID, c.IP())
+	}
+
+	record := &models.ActionPlanRecord{
+		ID:               uuid.New().String(),
+		Issue:            req.Issue,
+		PlanJSON:         planJSON,
+		RiskLevel:        plan.RiskLevel,
+		RequiresApproval: plan.RequiresApproval,
+		Status:           actions.PlanPlanned,
+		RequestedBy:      requestedBy,
+		CreatedAt:        time.Now(),
+	}
+
+	if err := h.db.InsertActionPlan(record); err != nil {
+		logger.Error("Failed to store action plan", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to plan actions",
+		})
+	}
+
+	summary := make([]fiber.Map, 0, len(plan.Actions))
+	for _, action := range plan.Actions {
+		summary = append(summary, fiber.Map{
+			"service":     action.Service,
+			"action":      action.Action,
+			"parameters":  action.Parameters,
+			"description": action.Description,
+			"risk_level":  action.RiskLevel,
+		})
+	}
+
 	return c.JSON(fiber.Map{
-		"plan":              plan.Actions,
+		"plan_id":           record.ID,
+		"summary":           summary,
 		"explanation":       plan.Explanation,
 		"risk_level":        plan.RiskLevel,
 		"requires_approval": plan.RequiresApproval,
 	})
 }
 
+// ExecuteActions runs a stored plan once the caller confirms it with
+// approved set to true. Plans that need approval are never run on the
+// caller's word alone: they go out through the approval webhook and only
+// execute once an authenticated callback approves them, and are refused
+// outright when no approval channel is configured.
 func (h *ActionsHandler) ExecuteActions(c *fiber.Ctx) error {
 	var req struct {
-		Plan     actions.ActionPlan `json:"plan"`
-		Approved bool               `json:"approved"`
+		PlanID   string `json:"plan_id"`
+		Approved *bool  `json:"approved"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -60,7 +137,62 @@ func (h *ActionsHandler) ExecuteActions(c *fiber.Ctx) error {
 		})
 	}
 
-	results, err := h.executor.ExecuteActions(c.Context(), &req.Plan, req.Approved)
+	if req.PlanID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "plan_id is required",
+		})
+	}
+	if req.Approved == nil || !*req.Approved {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "approved must be true to execute an action plan",
+		})
+	}
+
+	record, found, err := h.db.GetActionPlan(req.PlanID)
+	if err != nil {
+		logger.Error("Failed to load action plan", zap.String("plan_id", req.PlanID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load action plan",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Action plan not found",
+		})
+	}
+
+	plan, err := actions.DecodePlan(record.PlanJSON)
+	if err != nil {
+		logger.Error("Failed to decode action plan", zap.String("plan_id", record.ID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load action plan",
+		})
+	}
+
+	if plan.RequiresApproval {
+		if !h.approvals.Enabled() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Action plan requires approval, but no approval webhook is configured",
+			})
+		}
+		return h.requestApproval(c, record, plan)
+	}
+
+	claimed, err := h.db.TransitionActionPlan(record.ID, actions.PlanPlanned, actions.PlanExecuting)
+	if err != nil {
+		logger.Error("Failed to claim action plan", zap.String("plan_id", record.ID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to execute actions",
+		})
+	}
+	if !claimed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Action plan has already been executed",
+		})
+	}
+
+	results, err := h.executor.ExecuteActions(c.UserContext(), plan, false)
+	h.finishPlan(record.ID, results, err)
 	if err != nil {
 		logger.Error("Failed to execute actions", zap.Error(err))
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -69,6 +201,204 @@ func (h *ActionsHandler) ExecuteActions(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"results": results,
+		"plan_id": record.ID,
+		"results": toActionResultResponses(results),
 	})
 }
+
+// requestApproval sends the plan out for approval on behalf of the
+// authenticated caller, who then can not approve it themselves.
+func (h *ActionsHandler) requestApproval(c *fiber.Ctx, record *models.ActionPlanRecord, plan *actions.ActionPlan) error {
+	requester := h.users.Authenticated(c)
+	if requester == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Action plans that require approval must be executed by an authenticated user",
+		})
+	}
+
+	planID := record.ID
+	claimed, err := h.db.TransitionActionPlan(planID, actions.PlanPlanned, actions.PlanAwaitingApproval)
+	if err != nil {
+		logger.Error("Failed to claim action plan", zap.String("plan_id", planID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to request approval",
+		})
+	}
+	if !claimed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Action plan has already been submitted",
+		})
+	}
+
+	approval, err := h.approvals.Request(c.UserContext(), planID, plan, requester)
+	if err != nil {
+		logger.Error("Failed to request approval", zap.Error(err))
+		if _, err := h.db.TransitionActionPlan(planID, actions.PlanAwaitingApproval, actions.PlanPlanned); err != nil {
+			logger.Error("Failed to release action plan", zap.String("plan_id", planID), zap.Error(err))
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to request approval",
+		})
+	}
+
+	h.wg.Add(1)
+	go func(id string) {
+		defer h.wg.Done()
+
+		approved, err := h.approvals.Wait(h.lifecycle, id)
+		if err != nil || !approved {
+			if _, err := h.db.TransitionActionPlan(planID, actions.PlanAwaitingApproval, actions.PlanRejected); err != nil {
+				logger.Error("Failed to reject action plan", zap.String("plan_id", planID), zap.Error(err))
+			}
+			return
+		}
+
+		// Only an approval that is on record may run the plan.
+		resolved, err := h.approvals.Get(id)
+		if err == nil {
+			err = h.db.RecordActionPlanApproval(planID, resolved.Approver, resolved.ResolvedAt)
+		}
+		if err != nil {
+			logger.Error("Failed to record action plan approval", zap.String("plan_id", planID), zap.Error(err))
+			if _, err := h.db.TransitionActionPlan(planID, actions.PlanAwaitingApproval, actions.PlanFailed); err != nil {
+				logger.Error("Failed to fail action plan", zap.String("plan_id", planID), zap.Error(err))
+			}
+			return
+		}
+
+		claimed, err := h.db.TransitionActionPlan(planID, actions.PlanAwaitingApproval, actions.PlanExecuting)
+		if err != nil || !claimed {
+			logger.Error("Failed to claim approved action plan", zap.String("plan_id", planID), zap.Error(err))
+			return
+		}
+
+		// A plan that has started is not cut off half-applied by shutdown,
+		// which waits for it instead.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(h.lifecycle), 5*time.Minute)
+		defer cancel()
+
+		results, err := h.executor.ExecuteActions(ctx, plan, true)
+		if err != nil {
+			logger.Error("Failed to execute approved actions", zap.String("approval_id", id), zap.Error(err))
+		}
+		h.finishPlan(planID, results, err)
+		if err := h.approvals.Complete(id, results); err != nil {
+			logger.Error("Failed to record approval results", zap.String("approval_id", id), zap.Error(err))
+		}
+	}(approval.ID)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"plan_id":     planID,
+		"approval_id": approval.ID,
+		"status":      approval.Status,
+	})
+}
+
+// Wait blocks until approval workers have returned or ctx expires. Cancel
+// the lifecycle context first so workers still awaiting a decision give up.
+func (h *ActionsHandler) Wait(ctx context.Context) error {
+	return shutdown.Wait(ctx, &h.wg)
+}
+
+func (h *ActionsHandler) finishPlan(planID string, results []actions.ExecutionResult, execErr error) {
+	status := actions.ResultStatus(results)
+	if execErr != nil {
+		status = actions.PlanFailed
+	}
+
+	if _, err := h.db.TransitionActionPlan(planID, actions.PlanExecuting, status); err != nil {
+		logger.Error("Failed to update action plan status", zap.String("plan_id", planID), zap.Error(err))
+	}
+}
+
+// ApprovalCallback resolves an approval. The callback must carry the
+// signature from the approval webhook, and the approver is the user the
+// authenticating proxy signed in, never a name from the body.
+func (h *ActionsHandler) ApprovalCallback(c *fiber.Ctx) error {
+	var req struct {
+		Approved bool `json:"approved"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	err := h.approvals.Resolve(c.Params("id"), req.Approved, h.users.Authenticated(c), c.Get("X-Approval-Signature"))
+	switch {
+	case errors.Is(err, actions.ErrApprovalSignature):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid approval signature",
+		})
+	case errors.Is(err, actions.ErrApprovalNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Approval not found",
+		})
+	case errors.Is(err, actions.ErrApprovalApprover):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Approval requires an approver other than the requester",
+		})
+	case errors.Is(err, actions.ErrApprovalResolved):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Approval already resolved",
+		})
+	case errors.Is(err, actions.ErrApprovalExpired):
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "Approval expired",
+		})
+	case err != nil:
+		logger.Error("Failed to resolve approval", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to resolve approval",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"approval_id": c.Params("id"),
+		"approved":    req.Approved,
+	})
+}
+
+func (h *ActionsHandler) GetApproval(c *fiber.Ctx) error {
+	approval, err := h.approvals.Get(c.Params("id"))
+	if errors.Is(err, actions.ErrApprovalNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Approval not found",
+		})
+	}
+	if err != nil {
+		logger.Error("Failed to load approval", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load approval",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"approval_id": approval.ID,
+		"plan_id":     approval.PlanID,
+		"status":      approval.Status,
+		"approver":    approval.Approver,
+		"created_at":  approval.CreatedAt.Unix(),
+		"results":     toActionResultResponses(approval.Results),
+	})
+}
+
+func toActionResultResponses(results []actions.ExecutionResult) []ActionResultResponse {
+	responses := make([]ActionResultResponse, 0, len(results))
+	for _, result := range results {
+		resp := ActionResultResponse{
+			Service:     result.Action.Service,
+			Action:      result.Action.Action,
+			Description: result.Action.Description,
+			Success:     result.Success,
+			Output:      result.Output,
+		}
+		if result.Error != nil {
+			resp.Error = result.Error.Error()
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aws-agent/backend/internal/aws/actions"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+)
+
+// storePlan saves plan as a planned action plan requested by alice and
+// returns its ID.
+func storePlan(t *testing.T, db *sqlite.Client, plan *actions.ActionPlan) string {
+	t.Helper()
+
+	planJSON, err := actions.EncodePlan(plan)
+	if err != nil {
+		t.Fatalf("encode plan: %v", err)
+	}
+
+	record := &models.ActionPlanRecord{
+		ID:               "plan-1",
+		Issue:            "test issue",
+		PlanJSON:         planJSON,
+		RiskLevel:        plan.RiskLevel,
+		RequiresApproval: plan.RequiresApproval,
+		Status:           actions.PlanPlanned,
+		RequestedBy:      "alice",
+		CreatedAt:        time.Now(),
+	}
+	if err := db.InsertActionPlan(record); err != nil {
+		t.Fatalf("insert plan: %v", err)
+	}
+	return record.ID
+}
+
+func TestExecuteActionsReportsErrors(t *testing.T) {
+	db := newTestDB(t)
+	executor := actions.NewExecutor(llmtest.NewClient(&llmtest.Provider{}), false, false)
+	h := NewActionsHandler(context.Background(), executor, actions.NewApprovalManager(db, "", "", 0), db, NewUserResolver("", ""))
+
+	planID := storePlan(t, db, &actions.ActionPlan{
+		RiskLevel: "LOW",
+		Actions: []actions.Action{{
+			Service:     "ec2",
+			Action:      "describe_instances",
+			Description: "Look up the instance",
+			RiskLevel:   "LOW",
+		}},
+	})
+
+	app := fiber.New()
+	app.Post("/actions/execute", h.ExecuteActions)
+
+	resp, body := doJSON(t, app, fiber.MethodPost, "/actions/execute", map[string]interface{}{"plan_id": planID, "approved": true})
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+	}
+
+	results, _ := body["results"].([]interface{})
+	if len(results) != 1 {
+		t.Fatalf("results = %v, want one result", body["results"])
+	}
+	result := results[0].(map[string]interface{})
+	if result["success"] != false {
+		t.Errorf("success = %v, want false", result["success"])
+	}
+	if result["error"] != "EC2 client is not configured" {
+		t.Errorf("error = %v, want the failure message", result["error"])
+	}
+	if result["action"] != "describe_instances" || result["service"] != "ec2" {
+		t.Errorf("result = %v, want the failed action identified", result)
+	}
+}
+
+// signedInAs stands in for the authenticating proxy, setting the identity
+// header to user on every request it passes.
+func signedInAs(user string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Request().Header.Set("X-Auth-User", user)
+		return c.Next()
+	}
+}
+
+func TestApprovalCallbackExecutesPlan(t *testing.T) {
+	db := newTestDB(t)
+	signatures := make(chan string, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Signature string `json:"signature"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		signatures <- payload.Signature
+	}))
+	defer webhook.Close()
+
+	executor := actions.NewExecutor(llmtest.NewClient(&llmtest.Provider{}), true, false)
+	users := NewUserResolver("", "").WithIdentityHeader("X-Auth-User")
+	h := NewActionsHandler(context.Background(), executor, actions.NewApprovalManager(db, webhook.URL, "s3cret", time.Minute), db, users)
+
+	planID := storePlan(t, db, &actions.ActionPlan{
+		RiskLevel: "HIGH",
+		Actions: []actions.Action{{
+			Service:     "ec2",
+			Action:      "stop_instances",
+			Description: "Stop the instance",
+			RiskLevel:   "HIGH",
+		}},
+	})
+
+	app := fiber.New()
+	app.Post("/actions/execute", signedInAs("alice"), h.ExecuteActions)
+	app.Post("/actions/approvals/:id/callback", h.ApprovalCallback)
+
+	resp, body := doJSON(t, app, fiber.MethodPost, "/actions/execute", map[string]interface{}{
+		"plan_id":  planID,
+		"approved": true,
+		"approver": "mallory",
+	})
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Fatalf("execute status = %d, body %v", resp.StatusCode, body)
+	}
+	approvalID, _ := body["approval_id"].(string)
+	signature := <-signatures
+
+	callback := func(signature, approver, claimed string) int {
+		req := httptest.NewRequest(fiber.MethodPost, "/actions/approvals/"+approvalID+"/callback",
+			strings.NewReader(`{"approved":true,"approver":"`+claimed+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Approval-Signature", signature)
+		if approver != "" {
+			req.Header.Set("X-Auth-User", approver)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("callback: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := callback("s3cret", "bob", ""); status != fiber.StatusUnauthorized {
+		t.Fatalf("shared secret as signature status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+	if status := callback(signature, "alice", ""); status != fiber.StatusForbidden {
+		t.Fatalf("self-approval status = %d, want %d", status, fiber.StatusForbidden)
+	}
+	if status := callback(signature, "", "bob"); status != fiber.StatusForbidden {
+		t.Fatalf("unauthenticated approver named in the body status = %d, want %d", status, fiber.StatusForbidden)
+	}
+	if status := callback(signature, "bob", "carol"); status != fiber.StatusOK {
+		t.Fatalf("callback status = %d, want %d", status, fiber.StatusOK)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		record, _, err := db.GetActionPlan(planID)
+		if err != nil {
+			t.Fatalf("get plan: %v", err)
+		}
+		if record.Status == actions.PlanExecuted {
+			if record.ApprovedBy != "bob" {
+				t.Errorf("approved_by = %q, want the authenticated approver bob", record.ApprovedBy)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("plan status = %q, want %q after approval", record.Status, actions.PlanExecuted)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := h.Wait(context.Background()); err != nil {
+		t.Fatalf("wait for approval worker: %v", err)
+	}
+	approval, found, err := db.GetActionApproval(approvalID)
+	if err != nil || !found {
+		t.Fatalf("get approval: found %v, err %v", found, err)
+	}
+	if approval.Status != actions.ApprovalExecuted || approval.PlanID != planID ||
+		approval.Requester != "alice" || approval.Approver != "bob" || approval.ResultsJSON == "" {
+		t.Errorf("stored approval = %+v, want the executed approval with its results", approval)
+	}
+}
+
+func TestApprovalWorkerStopsOnShutdown(t *testing.T) {
+	db := newTestDB(t)
+	signatures := make(chan string, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Signature string `json:"signature"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		signatures <- payload.Signature
+	}))
+	defer webhook.Close()
+
+	lifecycle, stop := context.WithCancel(context.Background())
+	defer stop()
+	executor := actions.NewExecutor(llmtest.NewClient(&llmtest.Provider{}), true, false)
+	users := NewUserResolver("", "").WithIdentityHeader("X-Auth-User")
+	h := NewActionsHandler(lifecycle, executor, actions.NewApprovalManager(db, webhook.URL, "s3cret", time.Minute), db, users)
+
+	planID := storePlan(t, db, &actions.ActionPlan{
+		RiskLevel: "HIGH",
+		Actions: []actions.Action{{
+			Service:     "ec2",
+			Action:      "stop_instances",
+			Description: "Stop the instance",
+			RiskLevel:   "HIGH",
+		}},
+	})
+
+	app := fiber.New()
+	app.Post("/actions/execute", signedInAs("alice"), h.ExecuteActions)
+	app.Post("/actions/approvals/:id/callback", signedInAs("bob"), h.ApprovalCallback)
+
+	resp, body := doJSON(t, app, fiber.MethodPost, "/actions/execute", map[string]interface{}{
+		"plan_id":  planID,
+		"approved": true,
+	})
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Fatalf("execute status = %d, body %v", resp.StatusCode, body)
+	}
+	approvalID, _ := body["approval_id"].(string)
+	signature := <-signatures
+
+	stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Wait(ctx); err != nil {
+		t.Fatalf("approval worker did not stop on shutdown: %v", err)
+	}
+
+	record, _, err := db.GetActionPlan(planID)
+	if err != nil {
+		t.Fatalf("get plan: %v", err)
+	}
+	if record.Status != actions.PlanRejected {
+		t.Errorf("plan status = %q, want %q once nobody waits for approval", record.Status, actions.PlanRejected)
+	}
+
+	req := httptest.NewRequest(fiber.MethodPost, "/actions/approvals/"+approvalID+"/callback", strings.NewReader(`{"approved":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Approval-Signature", signature)
+	late, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	if late.StatusCode != fiber.StatusConflict {
+		t.Errorf("late callback status = %d, want %d for an abandoned approval", late.StatusCode, fiber.StatusConflict)
+	}
+}
+
+func TestExecuteActionsRequiresAuthenticatedRequester(t *testing.T) {
+	db := newTestDB(t)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("approval webhook called for an unauthenticated requester")
+	}))
+	defer webhook.Close()
+
+	executor := actions.NewExecutor(llmtest.NewClient(&llmtest.Provider{}), true, false)
+	users := NewUserResolver("", "").WithIdentityHeader("X-Auth-User")
+	h := NewActionsHandler(context.Background(), executor, actions.NewApprovalManager(db, webhook.URL, "s3cret", time.Minute), db, users)
+
+	planID := storePlan(t, db, &actions.ActionPlan{
+		RiskLevel: "HIGH",
+		Actions: []actions.Action{{
+			Service:     "ec2",
+			Action:      "stop_instances",
+			Description: "Stop the instance",
+			RiskLevel:   "HIGH",
+		}},
+	})
+
+	app := fiber.New()
+	app.Post("/actions/execute", h.ExecuteActions)
+
+	resp, body := doJSON(t, app, fiber.MethodPost, "/actions/execute", map[string]interface{}{
+		"plan_id":  planID,
+		"approved": true,
+		"user_id":  "alice",
+	})
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("status = %d, body %v, want %d", resp.StatusCode, body, fiber.StatusUnauthorized)
+	}
+
+	record, _, err := db.GetActionPlan(planID)
+	if err != nil {
+		t.Fatalf("get plan: %v", err)
+	}
+	if record.Status != actions.PlanPlanned {
+		t.Errorf("plan status = %q, want it untouched", record.Status)
+	}
+}
+
+func TestPlanActionsPersistsPlan(t *testing.T) {
+	db := newTestDB(t)
+	provider := &llmtest.Provider{Reply: func(req llm.CompletionRequest) (string, error) {
+		return `{"actions": [{"service": "ec2", "action": "stop_instances", "parameters": {"instance_ids": ["i-1"]},
+			"description": "Stop the instance", "risk_level": "HIGH"}],
+			"explanation": "Stop the runaway instance", "risk_level": "LOW", "requires_approval": false}`, nil
+	}}
+	executor := actions.NewExecutor(llmtest.NewClient(provider), true, false)
+	h := NewActionsHandler(context.Background(), executor, actions.NewApprovalManager(db, "", "", 0), db, NewUserResolver("", ""))
+
+	app := fiber.New()
+	app.Post("/actions/plan", h.PlanActions)
+
+	resp, body := doJSON(t, app, fiber.MethodPost, "/actions/plan", map[string]interface{}{
+		"issue":   "instance is burning money",
+		"user_id": "alice",
+	})
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+	}
+	if body["requires_approval"] != true {
+		t.Errorf("requires_approval = %v, want true for a HIGH action", body["requires_approval"])
+	}
+
+	planID, _ := body["plan_id"].(string)
+	record, found, err := db.GetActionPlan(planID)
+	if err != nil || !found {
+		t.Fatalf("get plan %q: found %v, err %v", planID, found, err)
+	}
+	if record.Status != actions.PlanPlanned || record.RequestedBy != "alice" || !record.RequiresApproval {
+		t.Errorf("stored plan = %+v, want a planned plan requested by alice that requires approval", record)
+	}
+}
+
+func TestExecuteActionsFailsClosedWithoutApprovals(t *testing.T) {
+	db := newTestDB(t)
+	executor := actions.NewExecutor(llmtest.NewClient(&llmtest.Provider{}), true, false)
+	h := NewActionsHandler(context.Background(), executor, actions.NewApprovalManager(db, "", "", 0), db, NewUserResolver("", ""))
+
+	// The stored flag claims no approval is needed; the HIGH action decides.
+	planID := storePlan(t, db, &actions.ActionPlan{
+		RiskLevel: "LOW",
+		Actions: []actions.Action{{
+			Service:     "ec2",
+			Action:      "terminate_instances",
+			Description: "Terminate the instance",
+			RiskLevel:   "HIGH",
+		}},
+	})
+
+	app := fiber.New()
+	app.Post("/actions/execute", h.ExecuteActions)
+
+	resp, body := doJSON(t, app, fiber.MethodPost, "/actions/execute", map[string]interface{}{
+		"plan_id":  planID,
+		"approved": true,
+		"approver": "bob",
+	})
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("status = %d, body %v, want %d", resp.StatusCode, body, fiber.StatusForbidden)
+	}
+
+	record, _, err := db.GetActionPlan(planID)
+	if err != nil {
+		t.Fatalf("get plan: %v", err)
+	}
+	if record.Status != actions.PlanPlanned || record.ApprovedBy != "" {
+		t.Errorf("plan status %q approved by %q, want it untouched", record.Status, record.ApprovedBy)
+	}
+}
+
+func TestExecuteActionsRequiresApprovedTrue(t *testing.T) {
+	db := newTestDB(t)
+	executor := actions.NewExecutor(llmtest.NewClient(&llmtest.Provider{}), true, false)
+	h := NewActionsHandler(context.Background(), executor, actions.NewApprovalManager(db, "", "", 0), db, NewUserResolver("", ""))
+
+	planID := storePlan(t, db, &actions.ActionPlan{
+		RiskLevel: "LOW",
+		Actions: []actions.Action{{
+			Service:     "ec2",
+			Action:      "describe_instances",
+			Description: "Look up the instance",
+			RiskLevel:   "LOW",
+		}},
+	})
+
+	app := fiber.New()
+	app.Post("/actions/execute", h.ExecuteActions)
+
+	for _, req := range []map[string]interface{}{
+		{"plan_id": planID},
+		{"plan_id": planID, "approved": false},
+	} {
+		resp, body := doJSON(t, app, fiber.MethodPost, "/actions/execute", req)
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("request %v: status = %d, body %v, want %d", req, resp.StatusCode, body, fiber.StatusBadRequest)
+		}
+	}
+
+	record, _, err := db.GetActionPlan(planID)
+	if err != nil {
+		t.Fatalf("get plan: %v", err)
+	}
+	if record.Status != actions.PlanPlanned {
+		t.Errorf("plan status = %q, want it untouched", record.Status)
+	}
+}
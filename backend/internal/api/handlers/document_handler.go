@@ -1,27 +1,84 @@
 package handlers
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 
 	"github.com/aws-agent/backend/internal/ingestion"
+	"github.com/aws-agent/backend/internal/kg/builder"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
 	"github.com/aws-agent/backend/pkg/logger"
 )
 
+const (
+	defaultDocumentLimit = 50
+	maxDocumentLimit     = 500
+)
+
+// KGBuilder is the part of the knowledge graph builder that rebuilds the
+// graph for an ingested document.
+type KGBuilder interface {
+	BuildFromDocument(ctx context.Context, doc *models.Document) (*builder.BuildResult, error)
+}
+
 type DocumentHandler struct {
 	processor *ingestion.Processor
+	queue     *ingestion.JobQueue
+	kgBuilder KGBuilder
+	db        *sqlite.Client
+	cfg       BatchConfig
+}
+
+type BatchConfig struct {
+	Concurrency  int
+	MaxDocuments int
+}
+
+type batchDocument struct {
+	URL         string `json:"url"`
+	HTMLContent string `json:"html_content"`
+}
+
+type batchResult struct {
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
 }
 
-func NewDocumentHandler(processor *ingestion.Processor) *DocumentHandler {
+func NewDocumentHandler(processor *ingestion.Processor, queue *ingestion.JobQueue, kgBuilder KGBuilder, db *sqlite.Client, cfg BatchConfig) *DocumentHandler {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 4
+	}
+	if cfg.MaxDocuments <= 0 {
+		cfg.MaxDocuments = 100
+	}
+
 	return &DocumentHandler{
 		processor: processor,
+		queue:     queue,
+		kgBuilder: kgBuilder,
+		db:        db,
+		cfg:       cfg,
 	}
 }
 
 func (h *DocumentHandler) UploadDocument(c *fiber.Ctx) error {
 	var req struct {
-		URL         string `json:"url"`
-		HTMLContent string `json:"html_content"`
+		URL           string `json:"url"`
+		HTMLContent   string `json:"html_content"`
+		Content       string `json:"content"`
+		ContentBase64 string `json:"content_base64"`
+		ContentType   string `json:"content_type"`
+		ChunkSize     int    `json:"chunk_size"`
+		ChunkOverlap  int    `json:"chunk_overlap"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -31,13 +88,54 @@ func (h *DocumentHandler) UploadDocument(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.URL == "" || req.HTMLContent == "" {
+	var body []byte
+	switch {
+	case req.HTMLContent != "":
+		body = []byte(req.HTMLContent)
+		if req.ContentType == "" {
+			req.ContentType = ingestion.ContentTypeHTML
+		}
+	case req.Content != "":
+		body = []byte(req.Content)
+	case req.ContentBase64 != "":
+		decoded, err := base64.StdEncoding.DecodeString(req.ContentBase64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "content_base64 is not valid base64",
+			})
+		}
+		body = decoded
+	}
+
+	if req.URL == "" || len(body) == 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "URL and HTML content are required",
+			"error": "URL and document content are required",
 		})
 	}
 
-	err := h.processor.ProcessDocument(c.Context(), req.URL, req.HTMLContent)
+	opts, err := h.processor.ChunkOptions(ingestion.ChunkOptions{Size: req.ChunkSize, Overlap: req.ChunkOverlap})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	err = h.processor.ProcessContentWithOptions(c.UserContext(), req.URL, req.ContentType, body, opts)
+	if errors.Is(err, ingestion.ErrContentTooLarge) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, ingestion.ErrPDFNoText) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": "PDF contains no extractable text",
+		})
+	}
+	if errors.Is(err, ingestion.ErrContentTooShort) || errors.Is(err, ingestion.ErrNoUsableChunks) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 	if err != nil {
 		logger.Error("Failed to process document", zap.Error(err))
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -50,3 +148,260 @@ func (h *DocumentHandler) UploadDocument(c *fiber.Ctx) error {
 		"url":     req.URL,
 	})
 }
+
+func (h *DocumentHandler) UploadDocumentBatch(c *fiber.Ctx) error {
+	var req struct {
+		Documents    []batchDocument `json:"documents"`
+		ChunkSize    int             `json:"chunk_size"`
+		ChunkOverlap int             `json:"chunk_overlap"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if len(req.Documents) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one document is required",
+		})
+	}
+
+	if len(req.Documents) > h.cfg.MaxDocuments {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": fmt.Sprintf("Batch exceeds maximum of %d documents", h.cfg.MaxDocuments),
+		})
+	}
+
+	opts, err := h.processor.ChunkOptions(ingestion.ChunkOptions{Size: req.ChunkSize, Overlap: req.ChunkOverlap})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	invalid, _ := c.Locals("invalid_documents").(map[int]string)
+	ctx := c.UserContext()
+
+	results := make([]batchResult, len(req.Documents))
+	sem := make(chan struct{}, h.cfg.Concurrency)
+	var wg sync.WaitGroup
+
+	for i, doc := range req.Documents {
+		results[i] = batchResult{URL: doc.URL}
+
+		if reason, ok := invalid[i]; ok {
+			results[i].Status = "failed"
+			results[i].Error = reason
+			continue
+		}
+
+		if doc.URL == "" || doc.HTMLContent == "" {
+			results[i].Status = "failed"
+			results[i].Error = "URL and HTML content are required"
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, doc batchDocument) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := h.processor.ProcessContentWithOptions(ctx, doc.URL, ingestion.ContentTypeHTML, []byte(doc.HTMLContent), opts)
+			if err != nil {
+				logger.Error("Failed to process batch document", zap.String("url", doc.URL), zap.Error(err))
+				results[i].Status = "failed"
+				results[i].Error = "Failed to process document"
+				if errors.Is(err, ingestion.ErrContentTooShort) || errors.Is(err, ingestion.ErrNoUsableChunks) || errors.Is(err, ingestion.ErrContentTooLarge) {
+					results[i].Error = err.Error()
+				}
+				return
+			}
+
+			results[i].Status = "processed"
+		}(i, doc)
+	}
+
+	wg.Wait()
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Status == "processed" {
+			succeeded++
+		}
+	}
+
+	status := fiber.StatusOK
+	if succeeded < len(results) {
+		status = fiber.StatusMultiStatus
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	})
+}
+
+func (h *DocumentHandler) IngestSitemap(c *fiber.Ctx) error {
+	var req struct {
+		URL      string `json:"url"`
+		MaxPages int    `json:"max_pages"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.URL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Sitemap URL is required",
+		})
+	}
+
+	enqueued, err := h.queue.EnqueueSitemap(c.UserContext(), req.URL, req.MaxPages)
+	if errors.Is(err, ingestion.ErrURLNotAllowed) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Sitemap URL is not in the allowed ingestion domains",
+		})
+	}
+	if err != nil {
+		logger.Error("Failed to ingest sitemap", zap.Error(err))
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to read sitemap",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":  "Sitemap pages enqueued for ingestion",
+		"sitemap":  req.URL,
+		"enqueued": len(enqueued),
+		"urls":     enqueued,
+	})
+}
+
+func (h *DocumentHandler) RefreshDocument(c *fiber.Ctx) error {
+	var req struct {
+		URL string `json:"url"`
+	}
+
+	if err := c.BodyParser(&req); err != nil {
+		logger.Error("Failed to parse request body", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if req.URL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "URL is required",
+		})
+	}
+
+	err := h.queue.Refresh(c.UserContext(), req.URL)
+	if err != nil {
+		logger.Error("Failed to refresh document", zap.String("url", req.URL), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refresh document",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Document refreshed successfully",
+		"url":     req.URL,
+		"doc_id":  ingestion.DocumentID(req.URL),
+	})
+}
+
+func (h *DocumentHandler) BuildKG(c *fiber.Ctx) error {
+	docID := c.Params("id")
+
+	doc, found, err := h.db.GetDocument(docID)
+	if err != nil {
+		logger.Error("Failed to get document", zap.String("doc_id", docID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get document",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Document not found",
+		})
+	}
+
+	result, err := h.kgBuilder.BuildFromDocument(c.UserContext(), doc)
+	if err != nil {
+		logger.Error("Failed to build KG from document", zap.String("doc_id", docID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build knowledge graph",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"doc_id":                docID,
+		"new_entities":          result.NewEntities,
+		"merged_entities":       result.MergedEntities,
+		"new_relations":         result.NewRelations,
+		"auto_created_entities": result.AutoCreatedEntities,
+	})
+}
+
+func (h *DocumentHandler) ListDocuments(c *fiber.Ctx) error {
+	limit, err := queryInt(c, "limit", defaultDocumentLimit)
+	if err != nil || limit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "limit must be a positive integer",
+		})
+	}
+	if limit > maxDocumentLimit {
+		limit = maxDocumentLimit
+	}
+
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "offset must be a non-negative integer",
+		})
+	}
+
+	page, err := h.db.ListDocuments(sqlite.DocumentFilter{
+		AWSService: c.Query("service"),
+		DocType:    c.Query("type"),
+		Title:      c.Query("title"),
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		logger.Error("Failed to list documents", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list documents",
+		})
+	}
+
+	documents := make([]fiber.Map, 0, len(page.Documents))
+	for _, doc := range page.Documents {
+		documents = append(documents, fiber.Map{
+			"id":         doc.ID,
+			"url":        doc.URL,
+			"title":      doc.Title,
+			"service":    doc.AWSService,
+			"type":       doc.DocType,
+			"summary":    doc.Summary,
+			"updated_at": doc.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"documents": documents,
+		"total":     page.Total,
+		"limit":     page.Limit,
+		"offset":    page.Offset,
+	})
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/ingestion"
+	"github.com/aws-agent/backend/internal/kg/builder"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/middleware/validation"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+)
+
+// fakeChunkStore is an ingestion.VectorStore that keeps inserted chunks in
+// memory.
+type fakeChunkStore struct {
+	mu     sync.Mutex
+	chunks []zilliz.DocumentChunk
+}
+
+func (f *fakeChunkStore) Insert(ctx context.Context, chunks []zilliz.DocumentChunk) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.chunks = append(f.chunks, chunks...)
+	return nil
+}
+
+func (f *fakeChunkStore) InsertActive(ctx context.Context, chunks []zilliz.DocumentChunk) error {
+	return f.Insert(ctx, chunks)
+}
+
+func (f *fakeChunkStore) DeleteChunks(ctx context.Context, chunkIDs []string) error {
+	return nil
+}
+
+func (f *fakeChunkStore) DeleteByDocument(ctx context.Context, docID string) error {
+	return nil
+}
+
+func (f *fakeChunkStore) RecreateCollections(ctx context.Context) error {
+	return nil
+}
+
+func TestUploadDocumentBatch(t *testing.T) {
+	db := newTestDB(t)
+	store := &fakeChunkStore{}
+	processor := ingestion.NewProcessor(db, store, llmtest.NewClient(&llmtest.Provider{}), ingestion.ProcessorConfig{})
+	h := NewDocumentHandler(processor, nil, nil, db, BatchConfig{Concurrency: 2})
+
+	app := fiber.New()
+	app.Use(validation.Middleware(validation.Config{MaxDocumentSize: 2000, Logger: zap.NewNop()}))
+	app.Post("/api/v1/documents/batch", h.UploadDocumentBatch)
+
+	page := func(text string) string {
+		return "<html><head><title>Lambda</title></head><body><p>" + text + "</p></body></html>"
+	}
+	documents := []map[string]interface{}{
+		{"url": "https://docs.aws.amazon.com/lambda/timeouts.html", "html_content": page("Raise the function timeout to avoid errors.")},
+		{"url": "not a url", "html_content": page("Ignored.")},
+		{"url": "https://docs.aws.amazon.com/lambda/empty.html"},
+		{"url": "https://docs.aws.amazon.com/lambda/huge.html", "html_content": page(strings.Repeat("Lambda ", 500))},
+		{"url": "https://docs.aws.amazon.com/lambda/limits.html", "html_content": page("The maximum timeout is 900 seconds.")},
+	}
+
+	resp, body := doJSON(t, app, fiber.MethodPost, "/api/v1/documents/batch", map[string]interface{}{"documents": documents})
+	if resp.StatusCode != fiber.StatusMultiStatus {
+		t.Fatalf("status = %d, body %v; want %d for a partial success", resp.StatusCode, body, fiber.StatusMultiStatus)
+	}
+	if body["total"] != float64(5) || body["succeeded"] != float64(2) || body["failed"] != float64(3) {
+		t.Errorf("counts = %v/%v/%v, want 5 total, 2 succeeded, 3 failed", body["total"], body["succeeded"], body["failed"])
+	}
+
+	want := []struct{ status, err string }{
+		{status: "processed"},
+		{status: "failed", err: "Invalid URL format"},
+		{status: "failed", err: "URL and HTML content are required"},
+		{status: "failed", err: "Document content exceeds maximum size"},
+		{status: "processed"},
+	}
+	results, _ := body["results"].([]interface{})
+	if len(results) != len(want) {
+		t.Fatalf("results = %v, want one per document", body["results"])
+	}
+	for i, w := range want {
+		result := results[i].(map[string]interface{})
+		if result["url"] != documents[i]["url"] || result["status"] != w.status {
+			t.Errorf("result %d = %v, want status %q", i, result, w.status)
+		}
+		if errMsg, _ := result["error"].(string); errMsg != w.err {
+			t.Errorf("result %d error = %q, want %q", i, errMsg, w.err)
+		}
+	}
+
+	urls := make(map[string]bool)
+	for _, chunk := range store.chunks {
+		urls[chunk.DocURL] = true
+	}
+	if len(urls) != 2 || !urls["https://docs.aws.amazon.com/lambda/timeouts.html"] || !urls["https://docs.aws.amazon.com/lambda/limits.html"] {
+		t.Errorf("indexed documents = %v, want only the two valid ones", urls)
+	}
+}
+
+// fakeKGBuilder records the documents it is asked to build from.
+type fakeKGBuilder struct {
+	mu   sync.Mutex
+	docs []*models.Document
+}
+
+func (f *fakeKGBuilder) BuildFromDocument(ctx context.Context, doc *models.Document) (*builder.BuildResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.docs = append(f.docs, doc)
+	return &builder.BuildResult{NewEntities: 3, NewRelations: 2}, nil
+}
+
+func TestBuildKGLoadsDocument(t *testing.T) {
+	db := newTestDB(t)
+	doc := &models.Document{
+		ID:         "doc-1",
+		URL:        "https://docs.aws.amazon.com/lambda/latest/dg/snapstart.html",
+		Summary:    "Lambda SnapStart",
+		RawContent: "Lambda SnapStart reduces cold start latency.",
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := db.InsertDocument(doc); err != nil {
+		t.Fatalf("insert document: %v", err)
+	}
+
+	kgBuilder := &fakeKGBuilder{}
+	h := NewDocumentHandler(nil, nil, kgBuilder, db, BatchConfig{})
+
+	app := fiber.New()
+	app.Post("/documents/:id/build-kg", h.BuildKG)
+
+	resp, body := doJSON(t, app, fiber.MethodPost, "/documents/doc-1/build-kg", nil)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+	}
+	if body["new_entities"] != float64(3) || body["new_relations"] != float64(2) {
+		t.Errorf("body = %v, want the builder's counts", body)
+	}
+	if len(kgBuilder.docs) != 1 || kgBuilder.docs[0].ID != doc.ID || kgBuilder.docs[0].RawContent != doc.RawContent {
+		t.Errorf("builder called with %+v, want the stored document", kgBuilder.docs)
+	}
+
+	resp, _ = doJSON(t, app, fiber.MethodPost, "/documents/missing/build-kg", nil)
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("unknown document status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+	if len(kgBuilder.docs) != 1 {
+		t.Errorf("builder called %d times, want no call for an unknown document", len(kgBuilder.docs))
+	}
+}
+
+func TestListDocuments(t *testing.T) {
+	db := newTestDB(t)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	seed := []models.Document{
+		{ID: "doc-1", Title: "Creating an S3 bucket", AWSService: "S3", DocType: "guide"},
+		{ID: "doc-2", Title: "S3 access denied errors", AWSService: "S3", DocType: "troubleshooting"},
+		{ID: "doc-3", Title: "Lambda cold starts", AWSService: "Lambda", DocType: "troubleshooting"},
+		{ID: "doc-4", Title: "Bucket policies in S3", AWSService: "S3", DocType: "guide"},
+	}
+	for i, doc := range seed {
+		doc.URL = "https://docs.aws.amazon.com/" + doc.ID
+		doc.Summary = "summary of " + doc.ID
+		doc.CreatedAt = base
+		doc.UpdatedAt = base.Add(time.Duration(i) * time.Hour)
+		if err := db.InsertDocument(&doc); err != nil {
+			t.Fatalf("insert %s: %v", doc.ID, err)
+		}
+	}
+
+	h := NewDocumentHandler(nil, nil, nil, db, BatchConfig{})
+	app := fiber.New()
+	app.Get("/documents", h.ListDocuments)
+
+	ids := func(body map[string]interface{}) string {
+		var got []string
+		documents, _ := body["documents"].([]interface{})
+		for _, doc := range documents {
+			got = append(got, doc.(map[string]interface{})["id"].(string))
+		}
+		return strings.Join(got, ",")
+	}
+
+	tests := []struct {
+		query string
+		want  string
+		total float64
+	}{
+		{query: "", want: "doc-4,doc-3,doc-2,doc-1", total: 4},
+		{query: "?service=S3", want: "doc-4,doc-2,doc-1", total: 3},
+		{query: "?service=S3&type=guide", want: "doc-4,doc-1", total: 2},
+		{query: "?title=bucket", want: "doc-4,doc-1", total: 2},
+		{query: "?type=troubleshooting&title=LAMBDA", want: "doc-3", total: 1},
+		{query: "?limit=2&offset=1", want: "doc-3,doc-2", total: 4},
+		{query: "?service=EC2", want: "", total: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			resp, body := doJSON(t, app, fiber.MethodGet, "/documents"+tt.query, nil)
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+			}
+			if got := ids(body); got != tt.want {
+				t.Errorf("documents = %q, want %q", got, tt.want)
+			}
+			if body["total"] != tt.total {
+				t.Errorf("total = %v, want %v", body["total"], tt.total)
+			}
+		})
+	}
+
+	_, body := doJSON(t, app, fiber.MethodGet, "/documents?title=policies", nil)
+	documents, _ := body["documents"].([]interface{})
+	if len(documents) != 1 {
+		t.Fatalf("documents = %v, want doc-4", body["documents"])
+	}
+	want := map[string]interface{}{
+		"id":         "doc-4",
+		"url":        "https://docs.aws.amazon.com/doc-4",
+		"title":      "Bucket policies in S3",
+		"service":    "S3",
+		"type":       "guide",
+		"summary":    "summary of doc-4",
+		"updated_at": "2024-05-01T15:00:00Z",
+	}
+	for key, value := range want {
+		if got := documents[0].(map[string]interface{})[key]; got != value {
+			t.Errorf("%s = %v, want %v", key, got, value)
+		}
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=abc", "?offset=-1"} {
+		if resp, _ := doJSON(t, app, fiber.MethodGet, "/documents"+query, nil); resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s status = %d, want %d", query, resp.StatusCode, fiber.StatusBadRequest)
+		}
+	}
+}
+
+func TestUploadRejectsInvalidChunkOptions(t *testing.T) {
+	db := newTestDB(t)
+	store := &fakeChunkStore{}
+	processor := ingestion.NewProcessor(db, store, llmtest.NewClient(&llmtest.Provider{}), ingestion.ProcessorConfig{ChunkSize: 500, ChunkOverlap: 50})
+	h := NewDocumentHandler(processor, nil, nil, db, BatchConfig{Concurrency: 1})
+
+	app := fiber.New()
+	app.Post("/documents", h.UploadDocument)
+	app.Post("/documents/batch", h.UploadDocumentBatch)
+
+	document := map[string]interface{}{
+		"url":          "https://docs.aws.amazon.com/lambda/timeouts.md",
+		"content":      "Raise the Lambda function timeout to avoid Task timed out errors.",
+		"content_type": "text/markdown",
+	}
+	batch := []map[string]interface{}{{
+		"url":          "https://docs.aws.amazon.com/lambda/timeouts.html",
+		"html_content": "<html><body><p>Raise the function timeout to avoid errors.</p></body></html>",
+	}}
+
+	for name, body := range map[string]map[string]interface{}{
+		"upload overlap not below size": {"url": document["url"], "content": document["content"], "content_type": document["content_type"], "chunk_size": 100, "chunk_overlap": 100},
+		"upload overlap above default":  {"url": document["url"], "content": document["content"], "content_type": document["content_type"], "chunk_overlap": 600},
+		"batch negative size":           {"documents": batch, "chunk_size": -1},
+	} {
+		target := "/documents"
+		if _, ok := body["documents"]; ok {
+			target = "/documents/batch"
+		}
+		resp, result := doJSON(t, app, fiber.MethodPost, target, body)
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s: status = %d, body %v; want %d", name, resp.StatusCode, result, fiber.StatusBadRequest)
+		}
+	}
+	if len(store.chunks) != 0 {
+		t.Errorf("indexed %d chunks for rejected requests", len(store.chunks))
+	}
+
+	document["chunk_size"] = 200
+	document["chunk_overlap"] = 20
+	if resp, result := doJSON(t, app, fiber.MethodPost, "/documents", document); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("valid override: status = %d, body %v", resp.StatusCode, result)
+	}
+}
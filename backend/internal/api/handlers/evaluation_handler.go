@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/evaluation"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+type EvaluationHandler struct {
+	jobs *evaluation.Jobs
+}
+
+func NewEvaluationHandler(jobs *evaluation.Jobs) *EvaluationHandler {
+	return &EvaluationHandler{
+		jobs: jobs,
+	}
+}
+
+// StartEvaluation runs a dataset in the background and returns the run id
+// to poll. The dataset is given inline or by the id of an earlier run.
+func (h *EvaluationHandler) StartEvaluation(c *fiber.Ctx) error {
+	var req struct {
+		Dataset      json.RawMessage `json:"dataset"`
+		DatasetRunID string          `json:"dataset_run_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	dataset, err := h.jobs.Dataset(req.Dataset, req.DatasetRunID)
+	if err != nil {
+		return evaluationStartError(c, err)
+	}
+
+	run, err := h.jobs.Start(dataset)
+	if err != nil {
+		return evaluationStartError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"job_id": run.ID,
+		"status": run.Status,
+		"total":  run.Total,
+	})
+}
+
+func evaluationStartError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, evaluation.ErrInvalidDataset):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, evaluation.ErrRunNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Dataset run not found",
+		})
+	case errors.Is(err, evaluation.ErrEvaluationRunning):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "An evaluation is already running",
+		})
+	}
+
+	logger.Error("Failed to start evaluation", zap.Error(err))
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to start evaluation",
+	})
+}
+
+// GetEvaluation reports a run's progress and, once finished, its report.
+// With format=csv, or an Accept header preferring text/csv, the report is
+// returned as CSV instead: one row per metric, or per query with
+// rows=queries.
+func (h *EvaluationHandler) GetEvaluation(c *fiber.Ctx) error {
+	run, found, err := h.jobs.Get(c.Params("id"))
+	if err != nil {
+		logger.Error("Failed to get evaluation run", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get evaluation run",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Evaluation run not found",
+		})
+	}
+
+	format := c.Query("format")
+	if format == "" && c.Accepts(fiber.MIMEApplicationJSON, "text/csv") == "text/csv" {
+		format = evaluation.FormatCSV
+	}
+	if format == evaluation.FormatCSV {
+		return h.writeReportCSV(c, run.ID, run.Report)
+	}
+	if format != "" && format != evaluation.FormatJSON {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be json or csv",
+		})
+	}
+
+	status := fiber.Map{
+		"job_id":     run.ID,
+		"status":     run.Status,
+		"total":      run.Total,
+		"completed":  run.Completed,
+		"failed":     run.Failed,
+		"created_at": run.CreatedAt.Unix(),
+		"updated_at": run.UpdatedAt.Unix(),
+	}
+	if run.CompletedAt != nil {
+		status["completed_at"] = run.CompletedAt.Unix()
+	}
+	if run.Error != "" {
+		status["error"] = run.Error
+	}
+	if run.Report != "" {
+		status["report"] = json.RawMessage(run.Report)
+	}
+
+	return c.JSON(status)
+}
+
+func (h *EvaluationHandler) writeReportCSV(c *fiber.Ctx, runID, rawReport string) error {
+	rows := c.Query("rows", evaluation.RowsMetrics)
+	if rows != evaluation.RowsMetrics && rows != evaluation.RowsQueries {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "rows must be metrics or queries",
+		})
+	}
+	if rawReport == "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Evaluation run has no report yet",
+		})
+	}
+
+	var report evaluation.EvaluationReport
+	if err := json.Unmarshal([]byte(rawReport), &report); err != nil {
+		logger.Error("Failed to decode evaluation report", zap.String("run_id", runID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export evaluation report",
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := evaluation.WriteReportCSV(&buf, &report, rows); err != nil {
+		logger.Error("Failed to export evaluation report", zap.String("run_id", runID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export evaluation report",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="evaluation-%s-%s.csv"`, runID, rows))
+	return c.Send(buf.Bytes())
+}
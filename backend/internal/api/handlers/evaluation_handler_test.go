@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aws-agent/backend/internal/evaluation"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/query"
+)
+
+func TestEvaluationJobLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	llmClient := llmtest.NewClient(&llmtest.Provider{Reply: func(req llm.CompletionRequest) (string, error) {
+		if strings.Contains(req.SystemPrompt, "evaluation expert") {
+			return `{"relevance": 3, "accuracy": 3, "completeness": 2, "citations": 1, "classification": "fully_relevant", "reasoning": "ok"}`, nil
+		}
+		return "Increase the function timeout.", nil
+	}})
+	engine := query.NewEngine(db, fakeKG{}, fakeVector{}, llmClient, nil, query.Config{})
+	jobs := evaluation.NewJobs(context.Background(), db, evaluation.NewEvaluator(db, llmClient, engine, evaluation.Config{}), evaluation.JobConfig{})
+	h := NewEvaluationHandler(jobs)
+
+	app := fiber.New()
+	app.Post("/evaluate", h.StartEvaluation)
+	app.Get("/evaluate/:id", h.GetEvaluation)
+
+	resp, body := doJSON(t, app, fiber.MethodPost, "/evaluate", map[string]interface{}{"dataset": map[string]interface{}{}})
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("empty dataset status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+	}
+	if resp, _ := doJSON(t, app, fiber.MethodPost, "/evaluate", map[string]interface{}{"dataset_run_id": "missing"}); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("unknown dataset run status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+
+	dataset := map[string]interface{}{"items": []map[string]interface{}{
+		{"query": "Why does my Lambda function time out?", "category": "lambda"},
+		{"query": "How do I raise the Lambda timeout?", "category": "lambda"},
+	}}
+	resp, body = doJSON(t, app, fiber.MethodPost, "/evaluate", map[string]interface{}{"dataset": dataset})
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Fatalf("start status = %d, body %v", resp.StatusCode, body)
+	}
+	jobID, _ := body["job_id"].(string)
+	if jobID == "" || body["total"] != float64(2) {
+		t.Fatalf("start body = %v, want a job id for 2 items", body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := jobs.Wait(ctx); err != nil {
+		t.Fatalf("wait for the run: %v", err)
+	}
+
+	resp, body = doJSON(t, app, fiber.MethodGet, "/evaluate/"+jobID, nil)
+	if resp.StatusCode != fiber.StatusOK || body["status"] != "completed" || body["completed"] != float64(2) {
+		t.Fatalf("finished job = %d %v, want completed with 2 items", resp.StatusCode, body)
+	}
+	report, _ := body["report"].(map[string]interface{})
+	if report["total_queries"] != float64(2) {
+		t.Errorf("report = %v, want 2 queries", body["report"])
+	}
+
+	for target, wantRows := range map[string]int{
+		"/evaluate/" + jobID + "?format=csv":              13,
+		"/evaluate/" + jobID + "?format=csv&rows=queries": 3,
+	} {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, target, nil), -1)
+		if err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+		if got := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(got, "text/csv") {
+			t.Errorf("%s content type = %q, want text/csv", target, got)
+		}
+		records, err := csv.NewReader(resp.Body).ReadAll()
+		if err != nil || len(records) != wantRows {
+			t.Errorf("%s = %d CSV rows (err %v), want %d", target, len(records), err, wantRows)
+		}
+	}
+
+	req := httptest.NewRequest(fiber.MethodGet, "/evaluate/"+jobID, nil)
+	req.Header.Set(fiber.HeaderAccept, "text/csv")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("GET with Accept text/csv: %v", err)
+	}
+	if data, _ := io.ReadAll(resp.Body); !strings.HasPrefix(string(data), "metric,value") {
+		t.Errorf("Accept text/csv body = %q, want the metrics CSV", data)
+	}
+
+	for _, target := range []string{"?format=xml", "?format=csv&rows=documents"} {
+		if resp, _ := doJSON(t, app, fiber.MethodGet, "/evaluate/"+jobID+target, nil); resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s status = %d, want %d", target, resp.StatusCode, fiber.StatusBadRequest)
+		}
+	}
+
+	if resp, _ := doJSON(t, app, fiber.MethodGet, "/evaluate/missing", nil); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("unknown job status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+}
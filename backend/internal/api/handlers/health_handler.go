@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/cache/redis"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/query"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/pkg/circuitbreaker"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+const selfTestQuery = "How do I increase the timeout of an AWS Lambda function?"
+
+type SelfTestConfig struct {
+	Enabled     bool
+	Token       string
+	MinInterval time.Duration
+}
+
+// VectorStore and GraphStore are the parts of the vector database and the
+// knowledge graph that the health checks exercise.
+type VectorStore interface {
+	query.VectorSearcher
+	Ping(ctx context.Context) error
+}
+
+type GraphStore interface {
+	query.KGSearcher
+	Ping(ctx context.Context) error
+}
+
+type HealthHandler struct {
+	llmClient    *llm.Client
+	vectorClient VectorStore
+	kgClient     GraphStore
+	cfg          SelfTestConfig
+
+	dependencies []dependencyCheck
+	readyTimeout time.Duration
+
+	mu      sync.Mutex
+	lastRun time.Time
+}
+
+type selfTestStage struct {
+	Name      string `json:"name"`
+	Passed    bool   `json:"passed"`
+	LatencyMS int    `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+func NewHealthHandler(llmClient *llm.Client, vectorClient VectorStore, kgClient GraphStore, cfg SelfTestConfig) *HealthHandler {
+	if cfg.MinInterval <= 0 {
+		cfg.MinInterval = time.Minute
+	}
+
+	return &HealthHandler{
+		llmClient:    llmClient,
+		vectorClient: vectorClient,
+		kgClient:     kgClient,
+		cfg:          cfg,
+	}
+}
+
+func (h *HealthHandler) SelfTest(c *fiber.Ctx) error {
+	if !h.cfg.Enabled {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Self-test is disabled",
+		})
+	}
+
+	if h.cfg.Token != "" && subtle.ConstantTimeCompare([]byte(c.Get("X-Selftest-Token")), []byte(h.cfg.Token)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid self-test token",
+		})
+	}
+
+	h.mu.Lock()
+	if since := time.Since(h.lastRun); since < h.cfg.MinInterval {
+		h.mu.Unlock()
+		c.Set("Retry-After", fmt.Sprintf("%d", int((h.cfg.MinInterval-since).Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Self-test was run recently, please retry later",
+		})
+	}
+	h.lastRun = time.Now()
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 60*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	stages := h.runSelfTest(ctx)
+
+	passed := true
+	for _, stage := range stages {
+		if !stage.Passed {
+			passed = false
+		}
+	}
+
+	status := fiber.StatusOK
+	if !passed {
+		status = fiber.StatusServiceUnavailable
+		logger.Warn("Self-test failed", zap.Any("stages", stages))
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"passed":     passed,
+		"stages":     stages,
+		"latency_ms": int(time.Since(start).Milliseconds()),
+	})
+}
+
+func (h *HealthHandler) runSelfTest(ctx context.Context) []selfTestStage {
+	stages := make([]selfTestStage, 0, 4)
+
+	var embedding []float32
+	stages = append(stages, runStage("embedding", func() error {
+		var err error
+		embedding, err = h.llmClient.GenerateEmbedding(ctx, selfTestQuery)
+		if err == nil && len(embedding) == 0 {
+			err = fmt.Errorf("embedding is empty")
+		}
+		return err
+	}))
+
+	var vectorContext string
+	stages = append(stages, runStage("vector_search", func() error {
+		if len(embedding) == 0 {
+			return fmt.Errorf("skipped: no embedding")
+		}
+		results, err := h.vectorClient.Search(ctx, embedding, 3, nil)
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("no vector results")
+		}
+		for _, result := range results {
+			vectorContext += result.Text + "\n"
+		}
+		return nil
+	}))
+
+	var kgContext string
+	stages = append(stages, runStage("knowledge_graph", func() error {
+		triples, err := h.kgClient.SearchByEntities(ctx, []string{"Lambda"}, 0.6)
+		if err != nil {
+			return err
+		}
+		for _, triple := range triples {
+			kgContext += fmt.Sprintf("%s %s %s\n", triple.Subject.Name, triple.Predicate, triple.Object.Name)
+		}
+		return nil
+	}))
+
+	stages = append(stages, runStage("generation", func() error {
+		resp, err := h.llmClient.GenerateResponse(ctx, selfTestQuery, "", kgContext, vectorContext)
+		if err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(resp.Content)) < 20 {
+			return fmt.Errorf("response is implausibly short")
+		}
+		return nil
+	}))
+
+	return stages
+}
+
+func runStage(name string, fn func() error) selfTestStage {
+	start := time.Now()
+	err := fn()
+
+	stage := selfTestStage{
+		Name:      name,
+		Passed:    err == nil,
+		LatencyMS: int(time.Since(start).Milliseconds()),
+	}
+	if err != nil {
+		stage.Error = err.Error()
+	}
+
+	return stage
+}
+
+func (h *HealthHandler) Breakers(c *fiber.Ctx) error {
+	stats := circuitbreaker.Snapshot()
+
+	status := "healthy"
+	breakers := make([]fiber.Map, 0, len(stats))
+	for _, s := range stats {
+		switch s.State {
+		case circuitbreaker.StateOpen:
+			status = "unhealthy"
+		case circuitbreaker.StateHalfOpen:
+			if status == "healthy" {
+				status = "degraded"
+			}
+		}
+
+		breakers = append(breakers, fiber.Map{
+			"name":                  s.Name,
+			"state":                 s.State.String(),
+			"generation":            s.Generation,
+			"requests":              s.Requests,
+			"total_successes":       s.TotalSuccesses,
+			"total_failures":        s.TotalFailures,
+			"consecutive_successes": s.ConsecutiveSuccesses,
+			"consecutive_failures":  s.ConsecutiveFailures,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":   status,
+		"breakers": breakers,
+	})
+}
+
+type dependencyCheck struct {
+	Name     string
+	Critical bool
+	Ping     func(ctx context.Context) error
+}
+
+type dependencyStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMS int    `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// WithReadinessChecks enables dependency checks on Ready. Neo4j, Zilliz and
+// SQLite are critical; Redis is optional since queries run without the cache.
+func (h *HealthHandler) WithReadinessChecks(db *sqlite.Client, cache *redis.Client, timeout time.Duration) *HealthHandler {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	h.readyTimeout = timeout
+
+	h.dependencies = []dependencyCheck{
+		{Name: "neo4j", Critical: true, Ping: h.kgClient.Ping},
+		{Name: "zilliz", Critical: true, Ping: h.vectorClient.Ping},
+		{Name: "sqlite", Critical: true, Ping: db.Ping},
+	}
+	if cache != nil {
+		h.dependencies = append(h.dependencies, dependencyCheck{Name: "redis", Ping: cache.Ping})
+	}
+
+	return h
+}
+
+func (h *HealthHandler) Ready(c *fiber.Ctx) error {
+	statuses := checkDependencies(c.UserContext(), h.dependencies, h.readyTimeout)
+
+	status := "ready"
+	code := fiber.StatusOK
+	for _, dep := range statuses {
+		if dep.Status == "up" {
+			continue
+		}
+		if dep.Critical {
+			status = "not_ready"
+			code = fiber.StatusServiceUnavailable
+		} else if status == "ready" {
+			status = "degraded"
+		}
+	}
+
+	if code != fiber.StatusOK {
+		logger.Warn("Readiness check failed", zap.Any("dependencies", statuses))
+	}
+
+	return c.Status(code).JSON(fiber.Map{
+		"status":       status,
+		"dependencies": statuses,
+	})
+}
+
+// checkDependencies pings every dependency concurrently, each bounded by
+// timeout, so one hung backend cannot stall the probe.
+func checkDependencies(ctx context.Context, deps []dependencyCheck, timeout time.Duration) []dependencyStatus {
+	statuses := make([]dependencyStatus, len(deps))
+
+	var wg sync.WaitGroup
+	for i, dep := range deps {
+		wg.Add(1)
+		go func(i int, dep dependencyCheck) {
+			defer wg.Done()
+
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := dep.Ping(pingCtx)
+
+			statuses[i] = dependencyStatus{
+				Name:      dep.Name,
+				Status:    "up",
+				Critical:  dep.Critical,
+				LatencyMS: int(time.Since(start).Milliseconds()),
+			}
+			if err != nil {
+				statuses[i].Status = "down"
+				statuses[i].Error = err.Error()
+			}
+		}(i, dep)
+	}
+	wg.Wait()
+
+	return statuses
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+)
+
+const selfTestAnswer = "Raise the function timeout in the Lambda console or with update-function-configuration."
+
+func selfTestApp(h *HealthHandler) *fiber.App {
+	app := fiber.New()
+	app.Get("/health/selftest", h.SelfTest)
+	return app
+}
+
+// stageResults maps each reported stage name to whether it passed.
+func stageResults(t *testing.T, body map[string]interface{}) map[string]bool {
+	t.Helper()
+
+	stages, ok := body["stages"].([]interface{})
+	if !ok {
+		t.Fatalf("stages = %v, want a list", body["stages"])
+	}
+	results := make(map[string]bool, len(stages))
+	for _, raw := range stages {
+		stage := raw.(map[string]interface{})
+		results[stage["name"].(string)] = stage["passed"].(bool)
+	}
+	return results
+}
+
+func TestSelfTestReportsStages(t *testing.T) {
+	answer := func(llm.CompletionRequest) (string, error) { return selfTestAnswer, nil }
+	chunks := []zilliz.SearchResult{{ChunkID: "c1", Text: "Lambda timeouts default to 3 seconds."}}
+
+	tests := []struct {
+		name       string
+		reply      func(llm.CompletionRequest) (string, error)
+		results    []zilliz.SearchResult
+		wantStatus int
+		want       map[string]bool
+	}{
+		{
+			name:       "all stages pass",
+			reply:      answer,
+			results:    chunks,
+			wantStatus: fiber.StatusOK,
+			want:       map[string]bool{"embedding": true, "vector_search": true, "knowledge_graph": true, "generation": true},
+		},
+		{
+			name:       "empty vector search",
+			reply:      answer,
+			wantStatus: fiber.StatusServiceUnavailable,
+			want:       map[string]bool{"embedding": true, "vector_search": false, "knowledge_graph": true, "generation": true},
+		},
+		{
+			name:       "generation fails",
+			reply:      func(llm.CompletionRequest) (string, error) { return "", errors.New("model unavailable") },
+			results:    chunks,
+			wantStatus: fiber.StatusServiceUnavailable,
+			want:       map[string]bool{"embedding": true, "vector_search": true, "knowledge_graph": true, "generation": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealthHandler(llmtest.NewClient(&llmtest.Provider{Reply: tt.reply}),
+				fakeVector{results: tt.results}, fakeKG{}, SelfTestConfig{Enabled: true})
+
+			resp, body := doJSON(t, selfTestApp(h), fiber.MethodGet, "/health/selftest", nil)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := stageResults(t, body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stages = %v, want %v", got, tt.want)
+			}
+			if body["passed"] != (tt.wantStatus == fiber.StatusOK) {
+				t.Errorf("passed = %v", body["passed"])
+			}
+			if _, ok := body["latency_ms"].(float64); !ok {
+				t.Errorf("latency_ms = %v, want a number", body["latency_ms"])
+			}
+		})
+	}
+}
+
+func TestSelfTestGating(t *testing.T) {
+	provider := &llmtest.Provider{Reply: func(llm.CompletionRequest) (string, error) { return selfTestAnswer, nil }}
+
+	disabled := NewHealthHandler(llmtest.NewClient(provider), fakeVector{}, fakeKG{}, SelfTestConfig{})
+	if resp, _ := doJSON(t, selfTestApp(disabled), fiber.MethodGet, "/health/selftest", nil); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("disabled: status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+	if len(provider.Requests()) != 0 {
+		t.Error("disabled self-test called the LLM")
+	}
+
+	h := NewHealthHandler(llmtest.NewClient(provider), fakeVector{}, fakeKG{}, SelfTestConfig{
+		Enabled:     true,
+		Token:       "probe",
+		MinInterval: time.Hour,
+	})
+	app := selfTestApp(h)
+
+	run := func(token string) int {
+		req := httptest.NewRequest(fiber.MethodGet, "/health/selftest", nil)
+		if token != "" {
+			req.Header.Set("X-Selftest-Token", token)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("selftest: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := run("wrong"); status != fiber.StatusUnauthorized {
+		t.Errorf("bad token: status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+	if status := run("probe"); status == fiber.StatusUnauthorized || status == fiber.StatusTooManyRequests {
+		t.Errorf("first run: status = %d, want the self-test to run", status)
+	}
+	if status := run("probe"); status != fiber.StatusTooManyRequests {
+		t.Errorf("second run: status = %d, want %d", status, fiber.StatusTooManyRequests)
+	}
+}
+
+// downKG is a knowledge graph whose server cannot be reached.
+type downKG struct {
+	fakeKG
+}
+
+func (downKG) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestReadyReportsDependencies(t *testing.T) {
+	tests := []struct {
+		name       string
+		kg         GraphStore
+		stopRedis  bool
+		wantCode   int
+		wantStatus string
+		wantDown   []string
+	}{
+		{name: "all up", kg: fakeKG{}, wantCode: fiber.StatusOK, wantStatus: "ready"},
+		{name: "critical dependency down", kg: downKG{}, wantCode: fiber.StatusServiceUnavailable, wantStatus: "not_ready", wantDown: []string{"neo4j"}},
+		{name: "optional dependency down", kg: fakeKG{}, stopRedis: true, wantCode: fiber.StatusOK, wantStatus: "degraded", wantDown: []string{"redis"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, srv := redistest.NewClient(t)
+			if tt.stopRedis {
+				srv.Close()
+			}
+
+			h := NewHealthHandler(llmtest.NewClient(&llmtest.Provider{}), fakeVector{}, tt.kg, SelfTestConfig{}).
+				WithReadinessChecks(newTestDB(t), cache, time.Second)
+			app := fiber.New()
+			app.Get("/ready", h.Ready)
+
+			resp, body := doJSON(t, app, fiber.MethodGet, "/ready", nil)
+			if resp.StatusCode != tt.wantCode || body["status"] != tt.wantStatus {
+				t.Fatalf("ready = %d %v, want %d %s", resp.StatusCode, body["status"], tt.wantCode, tt.wantStatus)
+			}
+
+			var down []string
+			checked := make(map[string]bool)
+			for _, raw := range body["dependencies"].([]interface{}) {
+				dep := raw.(map[string]interface{})
+				checked[dep["name"].(string)] = true
+				if dep["status"] != "up" {
+					down = append(down, dep["name"].(string))
+					if dep["error"] == nil {
+						t.Errorf("%s is down without an error", dep["name"])
+					}
+				}
+			}
+			if !reflect.DeepEqual(down, tt.wantDown) {
+				t.Errorf("down dependencies = %v, want %v", down, tt.wantDown)
+			}
+			for _, name := range []string{"neo4j", "zilliz", "sqlite", "redis"} {
+				if !checked[name] {
+					t.Errorf("%s was not checked", name)
+				}
+			}
+		})
+	}
+}
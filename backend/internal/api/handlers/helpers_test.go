@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/query"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/internal/usage"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+)
+
+type fakeKG struct {
+	triples []neo4j.Triple
+}
+
+func (f fakeKG) SearchByEntities(ctx context.Context, entities []string, minConfidence float64) ([]neo4j.Triple, error) {
+	return f.triples, nil
+}
+
+func (f fakeKG) Ping(ctx context.Context) error {
+	return nil
+}
+
+type fakeVector struct {
+	results []zilliz.SearchResult
+}
+
+func (f fakeVector) Search(ctx context.Context, queryEmbedding []float32, topK int, filters map[string]string) ([]zilliz.SearchResult, error) {
+	return f.results, nil
+}
+
+func (f fakeVector) Ping(ctx context.Context) error {
+	return nil
+}
+
+func newTestDB(t *testing.T) *sqlite.Client {
+	t.Helper()
+
+	db, err := sqlite.NewClient(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+	return db
+}
+
+func newTestEngine(db *sqlite.Client, provider *llmtest.Provider, cfg query.Config) *query.Engine {
+	return query.NewEngine(db, fakeKG{}, fakeVector{}, llmtest.NewClient(provider), nil, cfg)
+}
+
+func newTestQueryHandler(t *testing.T, db *sqlite.Client, engine *query.Engine) *QueryHandler {
+	t.Helper()
+	return NewQueryHandler(engine, usage.NewTracker(db, 0), db, NewUserResolver(AnonymousModeShared, "anonymous"))
+}
+
+// doJSON sends body as JSON to app and decodes the JSON response.
+func doJSON(t *testing.T, app *fiber.App, method, target string, body interface{}) (*http.Response, map[string]interface{}) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		reader = strings.NewReader(string(data))
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+
+	var decoded map[string]interface{}
+	data, _ := io.ReadAll(resp.Body)
+	if len(data) > 0 && strings.HasPrefix(resp.Header.Get("Content-Type"), fiber.MIMEApplicationJSON) {
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("decode response %q: %v", data, err)
+		}
+	}
+	return resp, decoded
+}
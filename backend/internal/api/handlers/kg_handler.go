@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/kg/builder"
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+const (
+	defaultEntityLimit = 50
+	maxEntityLimit     = 500
+)
+
+type KGHandler struct {
+	kgClient  *neo4j.Client
+	kgBuilder *builder.Builder
+}
+
+func NewKGHandler(kgClient *neo4j.Client, kgBuilder *builder.Builder) *KGHandler {
+	return &KGHandler{
+		kgClient:  kgClient,
+		kgBuilder: kgBuilder,
+	}
+}
+
+func (h *KGHandler) GetEntities(c *fiber.Ctx) error {
+	limit, err := queryInt(c, "limit", defaultEntityLimit)
+	if err != nil || limit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "limit must be a positive integer",
+		})
+	}
+	if limit > maxEntityLimit {
+		limit = maxEntityLimit
+	}
+
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "offset must be a non-negative integer",
+		})
+	}
+
+	page, err := h.kgClient.GetEntities(c.UserContext(), neo4j.EntityFilter{
+		Type:   c.Query("type"),
+		Name:   c.Query("name"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		logger.Error("Failed to get KG entities", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get entities",
+		})
+	}
+
+	entities := make([]fiber.Map, 0, len(page.Entities))
+	for _, entity := range page.Entities {
+		entities = append(entities, fiber.Map{
+			"id":             entity.ID,
+			"name":           entity.Name,
+			"type":           entity.Type,
+			"canonical_name": entity.CanonicalName,
+			"aliases":        entity.Aliases,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"entities": entities,
+		"total":    page.Total,
+		"limit":    page.Limit,
+		"offset":   page.Offset,
+	})
+}
+
+func (h *KGHandler) AddAlias(c *fiber.Ctx) error {
+	entityID := c.Params("id")
+
+	var req struct {
+		Alias string `json:"alias"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	req.Alias = strings.TrimSpace(req.Alias)
+	if req.Alias == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "alias is required",
+		})
+	}
+
+	err := h.kgBuilder.AddAlias(c.UserContext(), entityID, req.Alias)
+	if errors.Is(err, neo4j.ErrEntityNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Entity not found",
+		})
+	}
+	if err != nil {
+		logger.Error("Failed to add entity alias", zap.String("entity_id", entityID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to add alias",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"entity_id": entityID,
+		"alias":     req.Alias,
+	})
+}
+
+func (h *KGHandler) GetStats(c *fiber.Ctx) error {
+	entities, err := h.kgClient.CountEntities(c.UserContext())
+	if err != nil {
+		logger.Error("Failed to count KG entities", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get KG statistics",
+		})
+	}
+
+	relations, err := h.kgClient.CountRelations(c.UserContext())
+	if err != nil {
+		logger.Error("Failed to count KG relations", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get KG statistics",
+		})
+	}
+
+	var totalEntities, totalRelations int64
+	for _, count := range entities {
+		totalEntities += count
+	}
+	for _, count := range relations {
+		totalRelations += count
+	}
+
+	return c.JSON(fiber.Map{
+		"entities": fiber.Map{
+			"total":   totalEntities,
+			"by_type": entities,
+		},
+		"relations": fiber.Map{
+			"total":        totalRelations,
+			"by_predicate": relations,
+		},
+	})
+}
+
+// ImportGraph seeds the graph from a JSON node/edge document in the request
+// body. Rows that fail validation are listed in the response; the rest are
+// imported.
+func (h *KGHandler) ImportGraph(c *fiber.Ctx) error {
+	if len(c.Body()) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Request body is required",
+		})
+	}
+
+	result, err := h.kgBuilder.ImportGraph(c.UserContext(), bytes.NewReader(c.Body()))
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid graph document",
+			})
+		}
+		logger.Error("Failed to import KG", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to import graph",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+func queryInt(c *fiber.Ctx, key string, fallback int) (int, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(raw)
+}
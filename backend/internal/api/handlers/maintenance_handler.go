@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/ingestion"
+	"github.com/aws-agent/backend/internal/query"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/shutdown"
+)
+
+type MaintenanceConfig struct {
+	Enabled     bool
+	Token       string
+	MinInterval time.Duration
+	// MaxIngestionBacklog refuses maintenance while more ingestion jobs
+	// than this are queued or running.
+	MaxIngestionBacklog int
+}
+
+type MaintenanceHandler struct {
+	db        *sqlite.Client
+	queue     *ingestion.JobQueue
+	processor *ingestion.Processor
+	engine    *query.Engine
+	cfg       MaintenanceConfig
+	lifecycle context.Context
+
+	mu      sync.Mutex
+	lastRun time.Time
+
+	reindexing atomic.Bool
+	wg         sync.WaitGroup
+}
+
+func NewMaintenanceHandler(lifecycle context.Context, db *sqlite.Client, queue *ingestion.JobQueue, processor *ingestion.Processor, engine *query.Engine, cfg MaintenanceConfig) *MaintenanceHandler {
+	if cfg.MinInterval <= 0 {
+		cfg.MinInterval = time.Hour
+	}
+	if cfg.MaxIngestionBacklog < 0 {
+		cfg.MaxIngestionBacklog = 0
+	}
+
+	return &MaintenanceHandler{
+		db:        db,
+		queue:     queue,
+		processor: processor,
+		engine:    engine,
+		cfg:       cfg,
+		lifecycle: lifecycle,
+	}
+}
+
+// Authorize guards the admin routes: they are hidden unless enabled and
+// require the configured admin token.
+func (h *MaintenanceHandler) Authorize(c *fiber.Ctx) error {
+	if !h.cfg.Enabled {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Maintenance endpoints are disabled",
+		})
+	}
+
+	if h.cfg.Token == "" || subtle.ConstantTimeCompare([]byte(c.Get("X-Admin-Token")), []byte(h.cfg.Token)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid admin token",
+		})
+	}
+
+	return c.Next()
+}
+
+func (h *MaintenanceHandler) Vacuum(c *fiber.Ctx) error {
+	if h.queue != nil {
+		if backlog := h.queue.Backlog(); backlog > h.cfg.MaxIngestionBacklog {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":             "Ingestion is in progress, retry when the queue drains",
+				"ingestion_backlog": backlog,
+			})
+		}
+	}
+
+	h.mu.Lock()
+	if since := time.Since(h.lastRun); since < h.cfg.MinInterval {
+		h.mu.Unlock()
+		c.Set("Retry-After", fmt.Sprintf("%d", int((h.cfg.MinInterval-since).Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Vacuum was run recently, please retry later",
+		})
+	}
+	h.lastRun = time.Now()
+	h.mu.Unlock()
+
+	result, err := h.db.Vacuum()
+	if err != nil {
+		// A refused run should not count against the interval.
+		h.mu.Lock()
+		h.lastRun = time.Time{}
+		h.mu.Unlock()
+
+		if errors.Is(err, sqlite.ErrDatabaseBusy) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Database is under write load, retry later",
+			})
+		}
+		logger.Error("SQLite vacuum failed", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Vacuum failed",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+func (h *MaintenanceHandler) Recalibrate(c *fiber.Ctx) error {
+	calibration, err := h.engine.Recalibrate()
+	if err != nil {
+		if errors.Is(err, query.ErrInsufficientFeedback) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		logger.Error("Confidence calibration failed", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Calibration failed",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"calibration_id": calibration.ID,
+		"samples":        calibration.Samples,
+		"bias":           calibration.Bias,
+		"weights":        calibration.Weights,
+		"log_loss":       calibration.LogLoss,
+		"created_at":     calibration.CreatedAt.Unix(),
+	})
+}
+
+// Reindex starts re-embedding all stored chunks in the background and
+// returns immediately; progress is reported by ReindexStatus and the logs.
+// An interrupted run resumes unless restart=true is given.
+func (h *MaintenanceHandler) Reindex(c *fiber.Ctx) error {
+	if h.queue != nil {
+		if backlog := h.queue.Backlog(); backlog > h.cfg.MaxIngestionBacklog {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":             "Ingestion is in progress, retry when the queue drains",
+				"ingestion_backlog": backlog,
+			})
+		}
+	}
+
+	if !h.reindexing.CompareAndSwap(false, true) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A reindex is already running",
+		})
+	}
+
+	restart := c.QueryBool("restart", false)
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		defer h.reindexing.Store(false)
+
+		if _, err := h.processor.Reindex(h.lifecycle, restart); err != nil {
+			logger.Error("Reindex failed", zap.Error(err))
+		}
+	}()
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"status":  "started",
+		"restart": restart,
+	})
+}
+
+// Wait blocks until a running reindex has stopped or ctx is done. Cancel
+// the lifecycle context first so the reindex checkpoints and returns.
+func (h *MaintenanceHandler) Wait(ctx context.Context) error {
+	return shutdown.Wait(ctx, &h.wg)
+}
+
+func (h *MaintenanceHandler) ReindexStatus(c *fiber.Ctx) error {
+	state, found, err := h.db.GetReindexState()
+	if err != nil {
+		logger.Error("Failed to get reindex state", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get reindex state",
+		})
+	}
+	if !found {
+		return c.JSON(fiber.Map{
+			"running": h.reindexing.Load(),
+		})
+	}
+
+	status := fiber.Map{
+		"running":         h.reindexing.Load(),
+		"embedding_model": state.EmbeddingModel,
+		"vector_dim":      state.VectorDim,
+		"documents":       state.Documents,
+		"total_documents": state.TotalDocuments,
+		"chunks":          state.Chunks,
+		"last_doc_id":     state.LastDocID,
+		"started_at":      state.StartedAt.Unix(),
+		"updated_at":      state.UpdatedAt.Unix(),
+	}
+	if state.CompletedAt != nil {
+		status["completed_at"] = state.CompletedAt.Unix()
+	}
+
+	return c.JSON(status)
+}
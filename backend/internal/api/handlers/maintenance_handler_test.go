@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+)
+
+func TestVacuumPopulatedDatabase(t *testing.T) {
+	db := newTestDB(t)
+	text := strings.Repeat("Lambda functions scale with concurrency. ", 200)
+	for i := 0; i < 20; i++ {
+		doc := &models.Document{
+			ID:        fmt.Sprintf("doc-%d", i),
+			URL:       fmt.Sprintf("https://docs.aws.amazon.com/lambda/%d", i),
+			Title:     "Lambda scaling",
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		if err := db.InsertDocument(doc); err != nil {
+			t.Fatalf("insert document: %v", err)
+		}
+		for j := 0; j < 5; j++ {
+			chunk := &models.DocumentChunk{ID: fmt.Sprintf("%s-chunk-%d", doc.ID, j), DocID: doc.ID, ChunkIndex: j, Text: text, CreatedAt: time.Now()}
+			if err := db.InsertChunk(chunk); err != nil {
+				t.Fatalf("insert chunk: %v", err)
+			}
+		}
+	}
+	for i := 0; i < 15; i++ {
+		if err := db.DeleteDocument(fmt.Sprintf("doc-%d", i)); err != nil {
+			t.Fatalf("delete document: %v", err)
+		}
+	}
+
+	h := NewMaintenanceHandler(context.Background(), db, nil, nil, nil, MaintenanceConfig{Enabled: true, Token: "secret"})
+	app := fiber.New()
+	app.Post("/vacuum", h.Authorize, h.Vacuum)
+
+	vacuum := func(token string) (int, map[string]interface{}) {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodPost, "/vacuum", nil)
+		req.Header.Set("X-Admin-Token", token)
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("vacuum: %v", err)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp.StatusCode, body
+	}
+
+	if status, _ := vacuum("wrong"); status != fiber.StatusUnauthorized {
+		t.Errorf("wrong token status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+
+	status, body := vacuum("secret")
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, body %v", status, body)
+	}
+	if body["free_pages_before"].(float64) == 0 {
+		t.Errorf("free_pages_before = %v, want pages left by the deleted documents", body["free_pages_before"])
+	}
+	if body["freed_bytes"].(float64) <= 0 {
+		t.Errorf("freed_bytes = %v, want space reclaimed from the deleted documents", body["freed_bytes"])
+	}
+	if got := body["size_before_bytes"].(float64) - body["size_after_bytes"].(float64); got != body["freed_bytes"] {
+		t.Errorf("freed_bytes = %v, want size_before_bytes - size_after_bytes = %v", body["freed_bytes"], got)
+	}
+
+	if _, found, err := db.GetDocument("doc-19"); err != nil || !found {
+		t.Errorf("surviving document after vacuum: found %v, err %v", found, err)
+	}
+
+	if status, _ := vacuum("secret"); status != fiber.StatusTooManyRequests {
+		t.Errorf("repeat status = %d, want %d within the minimum interval", status, fiber.StatusTooManyRequests)
+	}
+}
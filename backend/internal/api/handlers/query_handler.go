@@ -1,31 +1,60 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 
 	"github.com/aws-agent/backend/internal/query"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/internal/usage"
 	"github.com/aws-agent/backend/pkg/logger"
 )
 
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
 type QueryHandler struct {
-	queryEngine *query.Engine
+	queryEngine  *query.Engine
+	usageTracker *usage.Tracker
+	quota        *usage.QuotaTracker
+	db           *sqlite.Client
+	users        *UserResolver
 }
 
-func NewQueryHandler(queryEngine *query.Engine) *QueryHandler {
+func NewQueryHandler(queryEngine *query.Engine, usageTracker *usage.Tracker, db *sqlite.Client, users *UserResolver) *QueryHandler {
 	return &QueryHandler{
-		queryEngine: queryEngine,
+		queryEngine:  queryEngine,
+		usageTracker: usageTracker,
+		db:           db,
+		users:        users,
 	}
 }
 
+func (h *QueryHandler) WithQuota(quota *usage.QuotaTracker) *QueryHandler {
+	h.quota = quota
+	return h
+}
+
 func (h *QueryHandler) HandleQuery(c *fiber.Ctx) error {
+	log := logger.FromContext(c.UserContext())
+
 	var req struct {
-		Query  string `json:"query"`
-		UserID string `json:"user_id"`
+		Query          string `json:"query"`
+		UserID         string `json:"user_id"`
+		Record         *bool  `json:"record"`
+		WebSearch      *bool  `json:"web_search"`
+		ConversationID string `json:"conversation_id"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		logger.Error("Failed to parse request body", zap.Error(err))
+		log.Error("Failed to parse request body", zap.Error(err))
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
@@ -37,38 +66,279 @@ func (h *QueryHandler) HandleQuery(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := query.ValidateConversationID(req.ConversationID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	req.UserID = h.users.Resolve(req.UserID, c.IP())
+
+	if err := h.usageTracker.Check(req.UserID); err != nil {
+		if errors.Is(err, usage.ErrBudgetExceeded) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Daily usage budget exceeded for this user. Please try again tomorrow.",
+			})
+		}
+		log.Error("Failed to check usage budget", zap.Error(err))
+	}
+
+	quota, err := h.quota.Consume(c.UserContext(), req.UserID)
+	setQuotaHeaders(c, quota)
+	if errors.Is(err, usage.ErrQuotaExceeded) {
+		c.Set("Retry-After", strconv.Itoa(int(time.Until(quota.ResetAt).Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": quotaExceededMessage(quota),
+		})
+	}
+
+	skipHistory := c.Query("record") == "false"
+	if req.Record != nil && !*req.Record {
+		skipHistory = true
+	}
+
+	if raw := c.Query("web_search"); raw != "" && req.WebSearch == nil {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "web_search must be a boolean",
+			})
+		}
+		req.WebSearch = &enabled
+	}
+
 	queryReq := query.QueryRequest{
-		Query:  req.Query,
-		UserID: req.UserID,
+		Query:          req.Query,
+		UserID:         req.UserID,
+		SkipHistory:    skipHistory,
+		WebSearch:      req.WebSearch,
+		ConversationID: req.ConversationID,
 	}
 
-	response, err := h.queryEngine.ProcessQuery(c.Context(), queryReq)
+	response, err := h.queryEngine.ProcessQuery(c.UserContext(), queryReq)
 	if err != nil {
-		logger.Error("Failed to process query", zap.Error(err))
+		log.Error("Failed to process query", zap.Error(err))
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to process query",
 		})
 	}
 
+	h.usageTracker.Record(req.UserID, response.TokensUsed)
+
 	return c.JSON(fiber.Map{
-		"id":          response.ID,
-		"query":       response.Query,
-		"response":    response.Response,
-		"sources":     response.Sources,
-		"confidence":  response.Confidence,
-		"latency_ms":  response.LatencyMS,
+		"id":                  response.ID,
+		"conversation_id":     req.ConversationID,
+		"query":               response.Query,
+		"response":            response.Response,
+		"sources":             response.Sources,
+		"confidence":          response.Confidence,
+		"latency_ms":          response.LatencyMS,
+		"needs_clarification": response.NeedsClarification,
+		"follow_ups":          response.FollowUps,
+		"web_search_used":     response.WebSearchUsed,
+		"risk":                response.Risk,
+		"risk_operations":     response.RiskOperations,
+		"citations":           citationsJSON(response.Citations),
 	})
 }
 
 func (h *QueryHandler) GetQueryHistory(c *fiber.Ctx) error {
-	userID := c.Query("user_id")
-	if userID == "" {
+	userID := h.users.Resolve(c.Query("user_id"), c.IP())
+	if h.users.IsSharedAnonymous(userID) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "user_id is required",
+			"error": "user_id is required to view query history",
+		})
+	}
+
+	limit := defaultHistoryLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "limit must be a positive integer",
+			})
+		}
+		limit = parsed
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	records, err := h.db.GetQueryHistory(userID, limit)
+	if err != nil {
+		logger.Error("Failed to get query history", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get query history",
+		})
+	}
+
+	history := make([]fiber.Map, 0, len(records))
+	for _, record := range records {
+		sources, err := h.db.GetQuerySources(record.ID)
+		if err != nil {
+			logger.Error("Failed to get query sources", zap.String("query_id", record.ID), zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to get query history",
+			})
+		}
+
+		sourceList := make([]fiber.Map, 0, len(sources))
+		for _, source := range sources {
+			sourceList = append(sourceList, fiber.Map{
+				"type":       source.SourceType,
+				"url":        source.SourceURL,
+				"chunk_id":   source.ChunkID,
+				"confidence": source.Confidence,
+			})
+		}
+
+		history = append(history, fiber.Map{
+			"id":                 record.ID,
+			"query_text":         record.QueryText,
+			"response":           record.Response,
+			"confidence":         record.Confidence,
+			"web_search_used":    record.WebSearchUsed,
+			"web_search_allowed": record.WebSearchAllowed,
+			"conversation_id":    record.ConversationID,
+			"created_at":         record.CreatedAt.UTC().Format(time.RFC3339),
+			"sources":            sourceList,
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"history": []interface{}{},
+		"history": history,
 	})
 }
+
+// GetQueryResponse serves the full answer to one of the caller's own
+// queries. Queries of other users, and every query of the shared anonymous
+// identity, are reported as not found.
+func (h *QueryHandler) GetQueryResponse(c *fiber.Ctx) error {
+	queryID := c.Params("id")
+	userID := h.users.Resolve(c.Query("user_id"), c.IP())
+	if h.users.IsSharedAnonymous(userID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Query not found",
+		})
+	}
+
+	response, found, err := h.db.GetQueryResponse(queryID, userID)
+	if err != nil {
+		logger.Error("Failed to get query response", zap.String("query_id", queryID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get query response",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Query not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":       queryID,
+		"response": response,
+	})
+}
+
+// GetQueryDiagnostics is a support tool served under the admin routes: it
+// returns the query, answer and feedback of whichever user asked it.
+func (h *QueryHandler) GetQueryDiagnostics(c *fiber.Ctx) error {
+	queryID := c.Params("id")
+
+	diagnostics, found, err := h.db.GetQueryDiagnostics(queryID)
+	if err != nil {
+		logger.Error("Failed to get query diagnostics", zap.String("query_id", queryID), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get query diagnostics",
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Query not found",
+		})
+	}
+
+	record := diagnostics.Record
+
+	sources := make([]fiber.Map, 0, len(diagnostics.Sources))
+	for _, source := range diagnostics.Sources {
+		sources = append(sources, fiber.Map{
+			"type":       source.SourceType,
+			"url":        source.SourceURL,
+			"chunk_id":   source.ChunkID,
+			"confidence": source.Confidence,
+		})
+	}
+
+	evaluations := make([]fiber.Map, 0, len(diagnostics.Evaluations))
+	for _, evaluation := range diagnostics.Evaluations {
+		evaluations = append(evaluations, fiber.Map{
+			"relevance_score":        evaluation.RelevanceScore,
+			"accuracy_score":         evaluation.AccuracyScore,
+			"completeness_score":     evaluation.CompletenessScore,
+			"citation_score":         evaluation.CitationScore,
+			"overall_classification": evaluation.OverallClassification,
+			"reasoning":              evaluation.Reasoning,
+			"cosine_similarity":      evaluation.CosineSimilarity,
+			"created_at":             evaluation.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	feedback := make([]fiber.Map, 0, len(diagnostics.Feedback))
+	for _, f := range diagnostics.Feedback {
+		feedback = append(feedback, fiber.Map{
+			"helpful":        f.Helpful,
+			"issue_category": f.IssueCategory,
+			"comment":        f.Comment,
+			"created_at":     f.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"query": fiber.Map{
+			"id":                   record.ID,
+			"user_id":              record.UserID,
+			"query_text":           record.QueryText,
+			"response":             record.Response,
+			"confidence":           record.Confidence,
+			"kg_results_count":     record.KGResultsCount,
+			"vector_results_count": record.VectorResultsCount,
+			"web_search_used":      record.WebSearchUsed,
+			"web_search_allowed":   record.WebSearchAllowed,
+			"latency_ms":           record.LatencyMS,
+			"created_at":           record.CreatedAt.UTC().Format(time.RFC3339),
+		},
+		"sources":     sources,
+		"evaluations": evaluations,
+		"feedback":    feedback,
+	})
+}
+
+func citationsJSON(citations []query.Citation) []fiber.Map {
+	result := make([]fiber.Map, 0, len(citations))
+	for _, citation := range citations {
+		result = append(result, fiber.Map{
+			"marker":       citation.Marker,
+			"source_index": citation.SourceIndex,
+			"url":          citation.URL,
+			"chunk_id":     citation.ChunkID,
+			"confidence":   citation.Confidence,
+			"dangling":     citation.Dangling,
+		})
+	}
+	return result
+}
+
+func setQuotaHeaders(c *fiber.Ctx, quota *usage.Quota) {
+	if quota == nil {
+		return
+	}
+	c.Set("X-Quota-Limit", strconv.Itoa(quota.Limit))
+	c.Set("X-Quota-Remaining", strconv.Itoa(quota.Remaining))
+	c.Set("X-Quota-Reset", strconv.FormatInt(quota.ResetAt.Unix(), 10))
+}
+
+func quotaExceededMessage(quota *usage.Quota) string {
+	return fmt.Sprintf("Daily query quota of %d reached for this user. It resets at 00:00 UTC.", quota.Limit)
+}
@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/middleware/requestid"
+	"github.com/aws-agent/backend/internal/query"
+	"github.com/aws-agent/backend/internal/search/web"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/usage"
+	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/utils"
+)
+
+func TestHandleQueryRecordOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		body    map[string]interface{}
+		records int
+	}{
+		{
+			name:    "recorded by default",
+			target:  "/query",
+			body:    map[string]interface{}{"query": "Lambda timeout", "user_id": "u1"},
+			records: 1,
+		},
+		{
+			name:    "query parameter",
+			target:  "/query?record=false",
+			body:    map[string]interface{}{"query": "Lambda timeout", "user_id": "u1"},
+			records: 0,
+		},
+		{
+			name:    "body field",
+			target:  "/query",
+			body:    map[string]interface{}{"query": "Lambda timeout", "user_id": "u1", "record": false},
+			records: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			h := newTestQueryHandler(t, db, newTestEngine(db, &llmtest.Provider{}, query.Config{}))
+
+			app := fiber.New()
+			app.Post("/query", h.HandleQuery)
+
+			resp, body := doJSON(t, app, fiber.MethodPost, tt.target, tt.body)
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+			}
+			if body["response"] != "ok" {
+				t.Errorf("response = %v, want the generated answer", body["response"])
+			}
+
+			records, err := db.GetQueryHistory("u1", 10)
+			if err != nil {
+				t.Fatalf("get history: %v", err)
+			}
+			if len(records) != tt.records {
+				t.Errorf("history rows = %d, want %d", len(records), tt.records)
+			}
+		})
+	}
+}
+
+func TestHandleQueryTokenBudget(t *testing.T) {
+	db := newTestDB(t)
+	engine := newTestEngine(db, &llmtest.Provider{}, query.Config{})
+	// One answer from the fake provider costs 15 tokens, so a single query
+	// exhausts the budget.
+	h := NewQueryHandler(engine, usage.NewTracker(db, 15), db, NewUserResolver(AnonymousModeShared, "anonymous"))
+
+	app := fiber.New()
+	app.Post("/query", h.HandleQuery)
+
+	ask := func(userID string) int {
+		body := map[string]interface{}{"query": "Lambda timeout"}
+		if userID != "" {
+			body["user_id"] = userID
+		}
+		resp, _ := doJSON(t, app, fiber.MethodPost, "/query", body)
+		return resp.StatusCode
+	}
+
+	steps := []struct {
+		user string
+		want int
+	}{
+		{user: "u1", want: fiber.StatusOK},
+		{user: "u1", want: fiber.StatusTooManyRequests},
+		{user: "u2", want: fiber.StatusOK},
+		{user: "", want: fiber.StatusOK},
+		{user: "", want: fiber.StatusTooManyRequests},
+		{user: "anonymous", want: fiber.StatusTooManyRequests},
+	}
+	for i, step := range steps {
+		if got := ask(step.user); got != step.want {
+			t.Errorf("step %d (user %q): status = %d, want %d", i, step.user, got, step.want)
+		}
+	}
+
+	used, err := db.GetUserTokenUsage("u2", time.Now().UTC().Format("2006-01-02"))
+	if err != nil {
+		t.Fatalf("get usage: %v", err)
+	}
+	if used <= 15 {
+		t.Errorf("recorded %d tokens for u2, want the answer plus embeddings", used)
+	}
+}
+
+func TestGetQueryHistory(t *testing.T) {
+	db := newTestDB(t)
+	h := newTestQueryHandler(t, db, newTestEngine(db, &llmtest.Provider{}, query.Config{}))
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, record := range []models.QueryRecord{
+		{ID: "q1", UserID: "u1", QueryText: "first", Response: "one", Confidence: 0.5, CreatedAt: base},
+		{ID: "q2", UserID: "u1", QueryText: "second", Response: "two", Confidence: 0.9, CreatedAt: base.Add(time.Hour)},
+		{ID: "q3", UserID: "u2", QueryText: "other user", Response: "three", CreatedAt: base.Add(2 * time.Hour)},
+	} {
+		record := record
+		if err := db.InsertQueryRecord(&record); err != nil {
+			t.Fatalf("insert record %d: %v", i, err)
+		}
+	}
+	if err := db.InsertQuerySource(&models.QuerySource{
+		QueryID: "q2", SourceType: "vector", SourceURL: "https://docs.aws.amazon.com/lambda", ChunkID: "c1", Confidence: 0.8,
+	}); err != nil {
+		t.Fatalf("insert source: %v", err)
+	}
+
+	app := fiber.New()
+	app.Get("/query/history", h.GetQueryHistory)
+
+	resp, body := doJSON(t, app, fiber.MethodGet, "/query/history?user_id=u1", nil)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+	}
+	history, _ := body["history"].([]interface{})
+	if len(history) != 2 {
+		t.Fatalf("history = %v, want the two queries of u1", body["history"])
+	}
+
+	latest := history[0].(map[string]interface{})
+	if latest["id"] != "q2" || latest["query_text"] != "second" || latest["response"] != "two" || latest["confidence"] != 0.9 {
+		t.Errorf("latest = %v, want q2 first", latest)
+	}
+	if latest["created_at"] != "2024-05-01T13:00:00Z" {
+		t.Errorf("created_at = %v, want ISO8601 UTC", latest["created_at"])
+	}
+	sources, _ := latest["sources"].([]interface{})
+	if len(sources) != 1 || sources[0].(map[string]interface{})["chunk_id"] != "c1" {
+		t.Errorf("sources = %v, want the stored source", latest["sources"])
+	}
+	if sources := history[1].(map[string]interface{})["sources"].([]interface{}); len(sources) != 0 {
+		t.Errorf("q1 sources = %v, want none", sources)
+	}
+
+	resp, body = doJSON(t, app, fiber.MethodGet, "/query/history?user_id=u1&limit=1", nil)
+	if history, _ := body["history"].([]interface{}); resp.StatusCode != fiber.StatusOK || len(history) != 1 {
+		t.Errorf("limit=1: status %d, history %v", resp.StatusCode, body["history"])
+	}
+
+	for _, limit := range []string{"0", "-1", "abc"} {
+		resp, _ := doJSON(t, app, fiber.MethodGet, "/query/history?user_id=u1&limit="+limit, nil)
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("limit=%s: status = %d, want %d", limit, resp.StatusCode, fiber.StatusBadRequest)
+		}
+	}
+}
+
+func TestGetQueryResponseScopedToUser(t *testing.T) {
+	db := newTestDB(t)
+	h := newTestQueryHandler(t, db, newTestEngine(db, &llmtest.Provider{}, query.Config{}))
+
+	for _, record := range []models.QueryRecord{
+		{ID: "q1", UserID: "u1", QueryText: "mine", Response: "the answer", CreatedAt: time.Now()},
+		{ID: "q2", UserID: "anonymous", QueryText: "shared", Response: "anonymous answer", CreatedAt: time.Now()},
+	} {
+		record := record
+		if err := db.InsertQueryRecord(&record); err != nil {
+			t.Fatalf("insert record %s: %v", record.ID, err)
+		}
+	}
+
+	app := fiber.New()
+	app.Get("/query/history/:id/response", h.GetQueryResponse)
+
+	resp, body := doJSON(t, app, fiber.MethodGet, "/query/history/q1/response?user_id=u1", nil)
+	if resp.StatusCode != fiber.StatusOK || body["response"] != "the answer" {
+		t.Errorf("owner: status = %d, body %v; want the answer", resp.StatusCode, body)
+	}
+
+	for _, target := range []string{
+		"/query/history/q1/response?user_id=u2",
+		"/query/history/q1/response",
+		"/query/history/q2/response",
+		"/query/history/q2/response?user_id=anonymous",
+	} {
+		if resp, body := doJSON(t, app, fiber.MethodGet, target, nil); resp.StatusCode != fiber.StatusNotFound {
+			t.Errorf("%s: status = %d, body %v; want %d", target, resp.StatusCode, body, fiber.StatusNotFound)
+		}
+	}
+}
+
+func TestAnonymousQueriesShareIdentity(t *testing.T) {
+	db := newTestDB(t)
+	h := newTestQueryHandler(t, db, newTestEngine(db, &llmtest.Provider{}, query.Config{}))
+
+	app := fiber.New()
+	app.Post("/query", h.HandleQuery)
+	app.Get("/query/history", h.GetQueryHistory)
+
+	for _, q := range []string{"Lambda timeout", "S3 access denied"} {
+		if resp, body := doJSON(t, app, fiber.MethodPost, "/query", map[string]interface{}{"query": q}); resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("query %q: status = %d, body %v", q, resp.StatusCode, body)
+		}
+	}
+
+	records, err := db.GetQueryHistory("anonymous", 10)
+	if err != nil {
+		t.Fatalf("get history: %v", err)
+	}
+	if len(records) != 2 {
+		t.Errorf("anonymous history rows = %d, want both queries grouped under the anonymous ID", len(records))
+	}
+
+	for _, target := range []string{"/query/history", "/query/history?user_id=anonymous"} {
+		if resp, body := doJSON(t, app, fiber.MethodGet, target, nil); resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s: status = %d, body %v; want the shared history refused", target, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestHandleQueryWebSearchOverride(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		target  string
+		body    map[string]interface{}
+		allowed bool
+	}{
+		{
+			name:    "off by default",
+			enabled: true,
+			target:  "/query",
+			body:    map[string]interface{}{"query": "Lambda timeout", "user_id": "u1"},
+		},
+		{
+			name:    "enabled by body field",
+			enabled: true,
+			target:  "/query",
+			body:    map[string]interface{}{"query": "Lambda timeout", "user_id": "u1", "web_search": true},
+			allowed: true,
+		},
+		{
+			name:    "enabled by query parameter",
+			enabled: true,
+			target:  "/query?web_search=true",
+			body:    map[string]interface{}{"query": "Lambda timeout", "user_id": "u1"},
+			allowed: true,
+		},
+		{
+			name:    "disabled by body field",
+			enabled: true,
+			target:  "/query?web_search=true",
+			body:    map[string]interface{}{"query": "Lambda timeout", "user_id": "u1", "web_search": false},
+		},
+		{
+			name:    "cannot enable when globally disabled",
+			enabled: false,
+			target:  "/query",
+			body:    map[string]interface{}{"query": "Lambda timeout", "user_id": "u1", "web_search": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			provider := &llmtest.Provider{}
+			llmClient := llmtest.NewClient(provider)
+
+			// The search is served from the cache so no request leaves the test;
+			// the optimised query is the provider's default reply.
+			cache, _ := redistest.NewClient(t)
+			results := []web.SearchResult{{Title: "Timeouts", URL: "https://docs.aws.amazon.com/lambda/timeouts", Content: "Raise the function timeout."}}
+			if err := cache.SetWebSearch(context.Background(), utils.HashString("ok:5"), results, time.Minute); err != nil {
+				t.Fatalf("seed web search cache: %v", err)
+			}
+			searcher := web.NewClient(web.Config{}, llmClient, db).WithCache(cache, time.Minute)
+
+			engine := query.NewEngine(db, fakeKG{}, fakeVector{}, llmClient, nil, query.Config{
+				WebSearchEnabled: tt.enabled,
+			}).WithWebSearch(searcher)
+			h := newTestQueryHandler(t, db, engine)
+
+			app := fiber.New()
+			app.Post("/query", h.HandleQuery)
+
+			resp, body := doJSON(t, app, fiber.MethodPost, tt.target, tt.body)
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+			}
+			if body["web_search_used"] != tt.allowed {
+				t.Errorf("web_search_used = %v, want %v", body["web_search_used"], tt.allowed)
+			}
+
+			records, err := db.GetQueryHistory("u1", 10)
+			if err != nil {
+				t.Fatalf("get history: %v", err)
+			}
+			if len(records) != 1 || records[0].WebSearchAllowed != tt.allowed {
+				t.Errorf("history = %+v, want web search allowed %v recorded", records, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestHandleQueryEnforcesDailyQuota(t *testing.T) {
+	db := newTestDB(t)
+	engine := query.NewEngine(db, fakeKG{}, fakeVector{}, llmtest.NewClient(&llmtest.Provider{}), nil, query.Config{})
+	cache, _ := redistest.NewClient(t)
+	h := newTestQueryHandler(t, db, engine).WithQuota(usage.NewQuotaTracker(cache, usage.QuotaConfig{DailyLimit: 2}))
+
+	app := fiber.New()
+	app.Post("/query", h.HandleQuery)
+	body := map[string]interface{}{"query": "Lambda timeout", "user_id": "u1"}
+
+	for _, remaining := range []string{"1", "0"} {
+		resp, result := doJSON(t, app, fiber.MethodPost, "/query", body)
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("status = %d, body %v", resp.StatusCode, result)
+		}
+		if got := resp.Header.Get("X-Quota-Remaining"); got != remaining {
+			t.Errorf("X-Quota-Remaining = %q, want %q", got, remaining)
+		}
+	}
+
+	resp, result := doJSON(t, app, fiber.MethodPost, "/query", body)
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("status over quota = %d, want %d", resp.StatusCode, fiber.StatusTooManyRequests)
+	}
+	if resp.Header.Get("X-Quota-Limit") != "2" || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("headers = %v, want the limit and Retry-After", resp.Header)
+	}
+	if result["error"] == nil {
+		t.Errorf("body = %v, want an error message", result)
+	}
+}
+
+// requestLogLines returns the messages logged under each request ID.
+func requestLogLines(t *testing.T, path string) map[string][]string {
+	t.Helper()
+
+	logger.Sync()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	lines := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry struct {
+			Message   string `json:"message"`
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("decode log line %q: %v", line, err)
+		}
+		lines[entry.RequestID] = append(lines[entry.RequestID], entry.Message)
+	}
+	return lines
+}
+
+func TestRequestIDCorrelatesHandlerAndEngineLogs(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "test.log")
+	if err := logger.Init("debug", "json", output); err != nil {
+		t.Fatalf("init logger: %v", err)
+	}
+
+	db := newTestDB(t)
+	provider := &llmtest.Provider{Reply: func(req llm.CompletionRequest) (string, error) {
+		if req.MaxTokens == llm.ResponseMaxTokens && strings.Contains(req.UserPrompt, "S3") {
+			return "", errors.New("model unavailable")
+		}
+		return "ok", nil
+	}}
+	h := newTestQueryHandler(t, db, newTestEngine(db, provider, query.Config{}))
+
+	app := fiber.New()
+	app.Use(requestid.New())
+	app.Post("/query", h.HandleQuery)
+
+	post := func(body, requestID string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(fiber.MethodPost, "/query", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		if requestID != "" {
+			req.Header.Set(fiber.HeaderXRequestID, requestID)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("POST /query: %v", err)
+		}
+		return resp
+	}
+
+	resp := post(`{"query": "Lambda timeout", "user_id": "u1"}`, "client-req-1")
+	if resp.StatusCode != fiber.StatusOK || resp.Header.Get(fiber.HeaderXRequestID) != "client-req-1" {
+		t.Fatalf("status %d, request ID %q; want the incoming ID echoed", resp.StatusCode, resp.Header.Get(fiber.HeaderXRequestID))
+	}
+
+	resp = post(`{"query": "S3 access denied", "user_id": "u1"}`, "")
+	generated := resp.Header.Get(fiber.HeaderXRequestID)
+	if resp.StatusCode != fiber.StatusInternalServerError || generated == "" {
+		t.Fatalf("status %d, request ID %q; want a failure with a generated ID", resp.StatusCode, generated)
+	}
+
+	lines := requestLogLines(t, output)
+	for id, want := range map[string][]string{
+		"client-req-1": {"Processing query", "Response generated", "Query processed successfully"},
+		generated:      {"Processing query", "Failed to process query"},
+	} {
+		got := strings.Join(lines[id], "\n")
+		for _, message := range want {
+			if !strings.Contains(got, message) {
+				t.Errorf("lines for request %s = %q, want %q among them", id, lines[id], message)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aws-agent/backend/pkg/utils"
+)
+
+const (
+	AnonymousModeShared = "shared"
+	AnonymousModeIP     = "ip"
+)
+
+// UserResolver assigns an identity to requests without a user_id. In
+// "shared" mode every anonymous caller is grouped under the configured
+// anonymous ID; in "ip" mode each client IP gets a stable "anon-" prefixed
+// hash so history, feedback and budgets stay per-client without storing
+// the raw address. Config validation rejects any other mode.
+type UserResolver struct {
+	mode           string
+	anonymousID    string
+	identityHeader string
+}
+
+func NewUserResolver(mode, anonymousID string) *UserResolver {
+	if mode == "" {
+		mode = AnonymousModeShared
+	}
+	if anonymousID == "" {
+		anonymousID = "anonymous"
+	}
+
+	return &UserResolver{
+		mode:        mode,
+		anonymousID: anonymousID,
+	}
+}
+
+// WithIdentityHeader names the header an authenticating proxy sets to the
+// signed-in user, which Authenticated reads.
+func (r *UserResolver) WithIdentityHeader(header string) *UserResolver {
+	r.identityHeader = header
+	return r
+}
+
+// Authenticated returns the user the authenticating proxy signed in, or ""
+// when no identity header is configured or the request carries none. Unlike
+// Resolve it never trusts a user_id from the request itself.
+func (r *UserResolver) Authenticated(c *fiber.Ctx) string {
+	if r.identityHeader == "" {
+		return ""
+	}
+	// Fiber reuses header buffers after the handler returns; the identity
+	// outlives the request in approvals, so it is copied.
+	return strings.TrimSpace(strings.Clone(c.Get(r.identityHeader)))
+}
+
+func (r *UserResolver) Resolve(userID, remoteAddr string) string {
+	if userID != "" {
+		return userID
+	}
+
+	if r.mode == AnonymousModeIP && remoteAddr != "" {
+		host, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			host = remoteAddr
+		}
+		return "anon-" + utils.HashString(host)[:16]
+	}
+
+	return r.anonymousID
+}
+
+// IsSharedAnonymous reports whether userID is the identity shared by every
+// anonymous caller, whose per-user data must not be served back since any
+// client can claim it.
+func (r *UserResolver) IsSharedAnonymous(userID string) bool {
+	return userID == r.anonymousID
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUserResolver(t *testing.T) {
+	shared := NewUserResolver(AnonymousModeShared, "guest")
+	if got := shared.Resolve("u1", "192.0.2.1:5000"); got != "u1" {
+		t.Errorf("explicit user resolved to %q, want u1", got)
+	}
+	if a, b := shared.Resolve("", "192.0.2.1:5000"), shared.Resolve("", "198.51.100.7:6000"); a != "guest" || b != "guest" {
+		t.Errorf("shared mode resolved %q and %q, want both grouped under guest", a, b)
+	}
+	if !shared.IsSharedAnonymous("guest") || shared.IsSharedAnonymous("u1") {
+		t.Error("IsSharedAnonymous should match only the configured anonymous ID")
+	}
+
+	byIP := NewUserResolver(AnonymousModeIP, "guest")
+	first := byIP.Resolve("", "192.0.2.1:5000")
+	if !strings.HasPrefix(first, "anon-") || strings.Contains(first, "192.0.2.1") {
+		t.Errorf("ip mode resolved %q, want an anon- prefixed hash", first)
+	}
+	if again := byIP.Resolve("", "192.0.2.1:6000"); again != first {
+		t.Errorf("same client IP resolved to %q and %q, want one identity", first, again)
+	}
+	if other := byIP.Resolve("", "198.51.100.7:5000"); other == first {
+		t.Errorf("different client IPs both resolved to %q", other)
+	}
+	if got := byIP.Resolve("", ""); got != "guest" {
+		t.Errorf("ip mode without an address resolved %q, want the shared ID", got)
+	}
+}
+
+func TestUserResolverAuthenticated(t *testing.T) {
+	var unset, set string
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		unset = NewUserResolver("", "").Authenticated(c)
+		set = NewUserResolver("", "").WithIdentityHeader("X-Auth-User").Authenticated(c)
+		return nil
+	})
+
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set("X-Auth-User", " alice ")
+	if _, err := app.Test(req, -1); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+
+	if unset != "" {
+		t.Errorf("without an identity header configured, got %q, want no identity", unset)
+	}
+	if set != "alice" {
+		t.Errorf("authenticated = %q, want alice", set)
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/cache/redis"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+type VectorHandler struct {
+	vectorDB *zilliz.Client
+	cache    *redis.Client
+}
+
+func NewVectorHandler(vectorDB *zilliz.Client, cache *redis.Client) *VectorHandler {
+	return &VectorHandler{
+		vectorDB: vectorDB,
+		cache:    cache,
+	}
+}
+
+func (h *VectorHandler) GetCollections(c *fiber.Ctx) error {
+	active, staging := h.vectorDB.Collections()
+
+	return c.JSON(fiber.Map{
+		"active":  active,
+		"staging": staging,
+	})
+}
+
+func (h *VectorHandler) SwitchCollection(c *fiber.Ctx) error {
+	previous, err := h.vectorDB.SwitchToStaging(c.UserContext())
+	if err != nil {
+		logger.Error("Failed to switch vector collection", zap.Error(err))
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if h.cache != nil {
+		if err := h.cache.InvalidateDocumentCache(c.UserContext()); err != nil {
+			logger.Warn("Failed to invalidate query cache after switch", zap.Error(err))
+		}
+	}
+
+	active, staging := h.vectorDB.Collections()
+
+	return c.JSON(fiber.Map{
+		"active":   active,
+		"staging":  staging,
+		"previous": previous,
+	})
+}
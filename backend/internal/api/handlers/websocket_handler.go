@@ -2,90 +2,287 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"sync"
+	"time"
 
-	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"github.com/aws-agent/backend/internal/middleware/requestid"
+	"github.com/aws-agent/backend/internal/middleware/validation"
 	"github.com/aws-agent/backend/internal/query"
+	"github.com/aws-agent/backend/internal/usage"
+	"github.com/aws-agent/backend/pkg/ctxutil"
 	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/wsproto"
+)
+
+const (
+	wsPingInterval = 30 * time.Second
+	// wsPongWait must exceed wsPingInterval; a client that answers neither
+	// pings nor sends messages within it is treated as gone.
+	wsPongWait  = 75 * time.Second
+	wsWriteWait = 10 * time.Second
 )
 
 type WebSocketHandler struct {
-	queryEngine *query.Engine
+	queryEngine  *query.Engine
+	usageTracker *usage.Tracker
+	quota        *usage.QuotaTracker
+	users        *UserResolver
+	validator    *validation.Validator
+	lifecycle    context.Context
 }
 
-func NewWebSocketHandler(queryEngine *query.Engine) *WebSocketHandler {
+func NewWebSocketHandler(lifecycle context.Context, queryEngine *query.Engine, usageTracker *usage.Tracker, users *UserResolver, validator *validation.Validator) *WebSocketHandler {
 	return &WebSocketHandler{
-		queryEngine: queryEngine,
+		queryEngine:  queryEngine,
+		usageTracker: usageTracker,
+		users:        users,
+		validator:    validator,
+		lifecycle:    lifecycle,
+	}
+}
+
+func (h *WebSocketHandler) WithQuota(quota *usage.QuotaTracker) *WebSocketHandler {
+	h.quota = quota
+	return h
+}
+
+// wsSession serialises writes to one connection, which the underlying
+// websocket does not allow concurrently, and tracks its in-flight query.
+type wsSession struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	queryMu     sync.Mutex
+	queryID     string
+	cancelQuery context.CancelFunc
+}
+
+func (s *wsSession) writeJSON(v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return s.conn.WriteJSON(v)
+}
+
+func (s *wsSession) ping() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+}
+
+// startQuery registers a new query derived from the connection context. It
+// returns false while another query is still running.
+func (s *wsSession) startQuery(ctx context.Context) (context.Context, string, bool) {
+	s.queryMu.Lock()
+	defer s.queryMu.Unlock()
+
+	if s.cancelQuery != nil {
+		return nil, "", false
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.queryID = uuid.New().String()
+	s.cancelQuery = cancel
+	return ctx, s.queryID, true
+}
+
+func (s *wsSession) finishQuery() {
+	s.queryMu.Lock()
+	defer s.queryMu.Unlock()
+
+	if s.cancelQuery != nil {
+		s.cancelQuery()
 	}
+	s.queryID = ""
+	s.cancelQuery = nil
+}
+
+// cancel aborts the in-flight query if messageID is empty or matches it.
+func (s *wsSession) cancel(messageID string) bool {
+	s.queryMu.Lock()
+	defer s.queryMu.Unlock()
+
+	if s.cancelQuery == nil || (messageID != "" && messageID != s.queryID) {
+		return false
+	}
+	s.cancelQuery()
+	return true
 }
 
 func (h *WebSocketHandler) HandleConnection(c *websocket.Conn) {
-	logger.Info("WebSocket connection established")
+	requestID, _ := c.Locals(requestid.LocalsKey).(string)
+
+	// The connection context ends when the client goes away, which cancels
+	// any query still running for it.
+	ctx, cancel := ctxutil.Detach(ctxutil.WithRequestID(context.Background(), requestID), h.lifecycle)
+	session := &wsSession{conn: c}
+
+	logger.Info("WebSocket connection established", zap.String("request_id", requestID))
 
+	var wg sync.WaitGroup
 	defer func() {
+		cancel()
+		wg.Wait()
 		c.Close()
-		logger.Info("WebSocket connection closed")
+		logger.Info("WebSocket connection closed", zap.String("request_id", requestID))
+	}()
+
+	c.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.SetPongHandler(func(string) error {
+		return c.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.keepAlive(ctx, session, requestID)
 	}()
 
 	for {
-		var msg struct {
-			Type    string `json:"type"`
-			Content string `json:"content"`
-			UserID  string `json:"user_id"`
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Warn("WebSocket connection lost", zap.String("request_id", requestID), zap.Error(err))
+			}
+			break
 		}
+		c.SetReadDeadline(time.Now().Add(wsPongWait))
 
-		err := c.ReadJSON(&msg)
+		msg, err := wsproto.DecodeClientMessage(data)
 		if err != nil {
-			logger.Error("Failed to read WebSocket message", zap.Error(err))
-			break
+			logger.Warn("Rejected WebSocket message", zap.String("request_id", requestID), zap.Error(err))
+			h.sendError(session, wsproto.ErrorCode(err), err.Error())
+			continue
 		}
 
-		if msg.Type != "query" {
+		if msg.Cancel != nil {
+			if session.cancel(msg.Cancel.MessageID) {
+				logger.Info("WebSocket query canceled by client",
+					zap.String("message_id", msg.Cancel.MessageID),
+					zap.String("request_id", requestID),
+				)
+			}
 			continue
 		}
 
-		logger.Info("Processing WebSocket query", zap.String("query", msg.Content))
+		queryMsg := msg.Query
+		logger.Info("Processing WebSocket query",
+			zap.String("query", queryMsg.Content),
+			zap.String("request_id", requestID),
+		)
 
-		err = h.streamResponse(c, msg.Content, msg.UserID)
-		if err != nil {
-			logger.Error("Failed to stream response", zap.Error(err))
-			h.sendError(c, "Failed to process query")
+		if err := h.validator.CheckQuery(queryMsg.Content, zap.String("request_id", requestID)); err != nil {
+			h.sendError(session, wsproto.CodeInvalidMessage, err.Error())
+			continue
+		}
+
+		if err := query.ValidateConversationID(queryMsg.ConversationID); err != nil {
+			h.sendError(session, wsproto.CodeInvalidMessage, err.Error())
+			continue
+		}
+
+		queryMsg.UserID = h.users.Resolve(queryMsg.UserID, c.RemoteAddr().String())
+
+		if err := h.usageTracker.Check(queryMsg.UserID); err != nil {
+			h.sendError(session, wsproto.CodeBudgetExceeded, "Daily usage budget exceeded for this user. Please try again tomorrow.")
+			continue
+		}
+
+		queryCtx, messageID, ok := session.startQuery(ctx)
+		if !ok {
+			h.sendError(session, wsproto.CodeQueryInProgress, "A query is already in progress on this connection")
+			continue
 		}
+
+		// Quota is only consumed once the query is accepted, so a message
+		// refused while another query runs costs nothing.
+		if quota, err := h.quota.Consume(ctx, queryMsg.UserID); errors.Is(err, usage.ErrQuotaExceeded) {
+			session.finishQuery()
+			h.sendError(session, wsproto.CodeQuotaExceeded, quotaExceededMessage(quota))
+			continue
+		}
+
+		// Queries run off the read loop so cancel messages and pongs are
+		// still read while the answer streams.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer session.finishQuery()
+
+			if err := h.streamResponse(queryCtx, session, messageID, queryMsg); err != nil {
+				logger.Error("Failed to stream response", zap.String("request_id", requestID), zap.Error(err))
+			}
+		}()
 	}
 }
 
-func (h *WebSocketHandler) streamResponse(c *websocket.Conn, queryText, userID string) error {
-	ctx := context.Background()
+// keepAlive pings the client until the connection context ends. A failed
+// ping closes the connection, which unblocks the read loop.
+func (h *WebSocketHandler) keepAlive(ctx context.Context, session *wsSession, requestID string) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
 
-	req := query.QueryRequest{
-		Query:  queryText,
-		UserID: userID,
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := session.ping(); err != nil {
+			logger.Warn("WebSocket ping failed, closing connection", zap.String("request_id", requestID), zap.Error(err))
+			session.conn.Close()
+			return
+		}
 	}
+}
 
-	h.sendChunk(c, "status", "Processing query...")
+func (h *WebSocketHandler) streamResponse(ctx context.Context, session *wsSession, messageID string, msg *wsproto.QueryMessage) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	response, err := h.queryEngine.ProcessQuery(ctx, req)
-	if err != nil {
-		return err
+	req := query.QueryRequest{
+		ID:             messageID,
+		Query:          msg.Content,
+		UserID:         msg.UserID,
+		ConversationID: msg.ConversationID,
+		WebSearch:      msg.WebSearch,
 	}
 
-	words := splitIntoWords(response.Response)
-	for i, word := range words {
-		chunk := word
-		if i < len(words)-1 {
-			chunk += " "
-		}
+	session.writeJSON(wsproto.NewStatus(req.ID, "Processing query..."))
 
-		err := h.sendChunk(c, "chunk", chunk)
-		if err != nil {
+	streamed := false
+	response, err := h.queryEngine.ProcessQueryStream(ctx, req, func(delta string) error {
+		if err := session.writeJSON(wsproto.NewChunk(delta)); err != nil {
+			cancel()
 			return err
 		}
+		streamed = true
+		return nil
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			logger.Info("Query canceled", zap.String("message_id", req.ID), zap.Bool("aborted", streamed))
+			session.writeJSON(wsproto.NewCanceled(req.ID, streamed))
+			return nil
+		}
+		if streamed {
+			logger.Warn("Query failed mid-stream, aborting message", zap.String("message_id", req.ID))
+		}
+		session.writeJSON(wsproto.NewQueryError(req.ID, streamed, "Failed to process query"))
+		return err
 	}
 
-	err = h.sendComplete(c, response)
+	h.usageTracker.Record(req.UserID, response.TokensUsed)
+
+	err = h.sendComplete(session, response)
 	if err != nil {
 		return err
 	}
@@ -93,57 +290,35 @@ func (h *WebSocketHandler) streamResponse(c *websocket.Conn, queryText, userID s
 	return nil
 }
 
-func (h *WebSocketHandler) sendChunk(c *websocket.Conn, msgType, content string) error {
-	msg := map[string]interface{}{
-		"type":    msgType,
-		"content": content,
+func (h *WebSocketHandler) sendComplete(session *wsSession, response *query.QueryResponse) error {
+	msg := wsproto.NewComplete()
+	msg.MessageID = response.ID
+	msg.Confidence = response.Confidence
+	msg.LatencyMS = response.LatencyMS
+	msg.FollowUps = response.FollowUps
+	msg.Risk = response.Risk
+	for _, source := range response.Sources {
+		msg.Sources = append(msg.Sources, wsproto.Source{
+			Type:       source.Type,
+			URL:        source.URL,
+			ChunkID:    source.ChunkID,
+			Confidence: source.Confidence,
+		})
 	}
-
-	return c.WriteJSON(msg)
-}
-
-func (h *WebSocketHandler) sendComplete(c *websocket.Conn, response *query.QueryResponse) error {
-	msg := map[string]interface{}{
-		"type":       "complete",
-		"message_id": response.ID,
-		"sources":    response.Sources,
-		"confidence": response.Confidence,
-		"latency_ms": response.LatencyMS,
+	for _, citation := range response.Citations {
+		msg.Citations = append(msg.Citations, wsproto.Citation{
+			Marker:      citation.Marker,
+			SourceIndex: citation.SourceIndex,
+			URL:         citation.URL,
+			ChunkID:     citation.ChunkID,
+			Confidence:  citation.Confidence,
+			Dangling:    citation.Dangling,
+		})
 	}
 
-	return c.WriteJSON(msg)
+	return session.writeJSON(msg)
 }
 
-func (h *WebSocketHandler) sendError(c *websocket.Conn, errorMsg string) {
-	msg := map[string]interface{}{
-		"type":  "error",
-		"error": errorMsg,
-	}
-
-	c.WriteJSON(msg)
-}
-
-func splitIntoWords(text string) []string {
-	words := []string{}
-	currentWord := ""
-
-	for _, char := range text {
-		if char == ' ' || char == '\n' {
-			if currentWord != "" {
-				words = append(words, currentWord)
-				currentWord = ""
-			}
-			if char == '\n' {
-				words = append(words, "\n")
-			}
-		} else {
-			currentWord += string(char)
-		}
-	}
-
-	if currentWord != "" {
-		words = append(words, currentWord)
-	}
-
-	return words
+func (h *WebSocketHandler) sendError(session *wsSession, code, errorMsg string) {
+	session.writeJSON(wsproto.NewError(code, errorMsg))
 }
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	fastws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/middleware/validation"
+	"github.com/aws-agent/backend/internal/query"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/internal/usage"
+	"github.com/aws-agent/backend/pkg/wsproto"
+)
+
+// midStreamProvider streams one delta and then fails for its first
+// failures streamed answers, and answers normally afterwards.
+type midStreamProvider struct {
+	*llmtest.Provider
+	failures int
+}
+
+func (p *midStreamProvider) CompleteStream(ctx context.Context, model string, req llm.CompletionRequest, onDelta llm.StreamFunc) (*llm.CompletionResponse, error) {
+	if p.failures == 0 {
+		return p.Provider.CompleteStream(ctx, model, req, onDelta)
+	}
+	p.failures--
+
+	if err := onDelta("partial answer"); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("provider stream reset")
+}
+
+// blockingProvider holds every streamed answer until its context ends and
+// reports the context error on done.
+type blockingProvider struct {
+	*llmtest.Provider
+	started chan struct{}
+	done    chan error
+}
+
+func newBlockingProvider() *blockingProvider {
+	return &blockingProvider{Provider: &llmtest.Provider{}, started: make(chan struct{}, 1), done: make(chan error, 1)}
+}
+
+func (p *blockingProvider) CompleteStream(ctx context.Context, model string, req llm.CompletionRequest, onDelta llm.StreamFunc) (*llm.CompletionResponse, error) {
+	p.started <- struct{}{}
+	<-ctx.Done()
+	p.done <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+// serveWebSocket serves h on a local listener and returns a connected
+// client.
+func serveWebSocket(t *testing.T, h *WebSocketHandler) *fastws.Conn {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/ws", websocket.New(h.HandleConnection))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+
+	conn, _, err := fastws.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func newTestWebSocketHandler(db *sqlite.Client, engine *query.Engine) *WebSocketHandler {
+	return NewWebSocketHandler(context.Background(), engine, usage.NewTracker(db, 0),
+		NewUserResolver(AnonymousModeShared, "anonymous"), validation.NewValidator(validation.Config{}))
+}
+
+// readUntilDone reads server messages up to and including the next complete
+// or error message.
+func readUntilDone(t *testing.T, conn *fastws.Conn) []map[string]interface{} {
+	t.Helper()
+
+	var messages []map[string]interface{}
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg map[string]interface{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("read message after %v: %v", messages, err)
+		}
+		messages = append(messages, msg)
+		if msg["type"] == string(wsproto.TypeComplete) || msg["type"] == string(wsproto.TypeError) {
+			return messages
+		}
+	}
+}
+
+func TestWebSocketAbortsMessageOnMidStreamError(t *testing.T) {
+	db := newTestDB(t)
+	provider := &midStreamProvider{Provider: &llmtest.Provider{}, failures: 1}
+	engine := query.NewEngine(db, fakeKG{}, fakeVector{}, llmtest.NewClient(provider), nil, query.Config{})
+	conn := serveWebSocket(t, newTestWebSocketHandler(db, engine))
+
+	send := func() {
+		if err := conn.WriteJSON(map[string]interface{}{"version": wsproto.Version, "type": "query", "content": "Lambda timeout"}); err != nil {
+			t.Fatalf("send query: %v", err)
+		}
+	}
+
+	send()
+	messages := readUntilDone(t, conn)
+	if len(messages) != 3 {
+		t.Fatalf("messages = %v, want status, chunk and error", messages)
+	}
+	status, chunk, failure := messages[0], messages[1], messages[2]
+	if status["type"] != string(wsproto.TypeStatus) || status["message_id"] == "" {
+		t.Errorf("status = %v, want a status carrying the message_id", status)
+	}
+	if chunk["content"] != "partial answer" {
+		t.Errorf("chunk = %v, want the partial answer", chunk)
+	}
+	if failure["code"] != wsproto.CodeQueryFailed {
+		t.Errorf("code = %v, want %s", failure["code"], wsproto.CodeQueryFailed)
+	}
+	if failure["message_id"] != status["message_id"] {
+		t.Errorf("error message_id = %v, want %v", failure["message_id"], status["message_id"])
+	}
+	if failure["aborted"] != true {
+		t.Errorf("aborted = %v, want true after a streamed chunk", failure["aborted"])
+	}
+
+	// The connection keeps serving queries after the aborted one.
+	send()
+	messages = readUntilDone(t, conn)
+	last := messages[len(messages)-1]
+	if last["type"] != string(wsproto.TypeComplete) {
+		t.Fatalf("messages = %v, want the next query to complete", messages)
+	}
+	if last["message_id"] == status["message_id"] {
+		t.Errorf("message_id %v reused for the next query", last["message_id"])
+	}
+}
+
+func sendQuery(t *testing.T, conn *fastws.Conn, content string) {
+	t.Helper()
+	if err := conn.WriteJSON(map[string]interface{}{"version": wsproto.Version, "type": "query", "content": content}); err != nil {
+		t.Fatalf("send query: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestWebSocketDisconnectCancelsQuery(t *testing.T) {
+	db := newTestDB(t)
+	provider := newBlockingProvider()
+	engine := query.NewEngine(db, fakeKG{}, fakeVector{}, llmtest.NewClient(provider), nil, query.Config{})
+	conn := serveWebSocket(t, newTestWebSocketHandler(db, engine))
+
+	sendQuery(t, conn, "Lambda timeout")
+	waitFor(t, provider.started, "the answer to start streaming")
+
+	conn.Close()
+
+	select {
+	case err := <-provider.done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("query context ended with %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("query context still live after the client disconnected")
+	}
+}
+
+func TestWebSocketCancelMessageAbortsQuery(t *testing.T) {
+	db := newTestDB(t)
+	provider := newBlockingProvider()
+	engine := query.NewEngine(db, fakeKG{}, fakeVector{}, llmtest.NewClient(provider), nil, query.Config{})
+	conn := serveWebSocket(t, newTestWebSocketHandler(db, engine))
+
+	sendQuery(t, conn, "Lambda timeout")
+	waitFor(t, provider.started, "the answer to start streaming")
+
+	sendQuery(t, conn, "S3 throttling")
+	if err := conn.WriteJSON(map[string]interface{}{"version": wsproto.Version, "type": "cancel"}); err != nil {
+		t.Fatalf("send cancel: %v", err)
+	}
+
+	messages := readUntilDone(t, conn)
+	status, busy := messages[0], messages[1]
+	if busy["code"] != wsproto.CodeQueryInProgress {
+		t.Fatalf("messages = %v, want the second query rejected while the first runs", messages)
+	}
+
+	messages = readUntilDone(t, conn)
+	canceled := messages[len(messages)-1]
+	if canceled["code"] != wsproto.CodeCanceled {
+		t.Fatalf("messages = %v, want a canceled error", messages)
+	}
+	if canceled["message_id"] != status["message_id"] {
+		t.Errorf("canceled message_id = %v, want %v", canceled["message_id"], status["message_id"])
+	}
+	if canceled["aborted"] == true {
+		t.Errorf("aborted = %v, want false before any chunk", canceled["aborted"])
+	}
+}
+
+func TestWebSocketRejectedQueryKeepsQuota(t *testing.T) {
+	db := newTestDB(t)
+	provider := newBlockingProvider()
+	engine := query.NewEngine(db, fakeKG{}, fakeVector{}, llmtest.NewClient(provider), nil, query.Config{})
+	cache, _ := redistest.NewClient(t)
+	h := newTestWebSocketHandler(db, engine).WithQuota(usage.NewQuotaTracker(cache, usage.QuotaConfig{DailyLimit: 2}))
+	conn := serveWebSocket(t, h)
+
+	sendQuery(t, conn, "Lambda timeout")
+	waitFor(t, provider.started, "the first answer to start streaming")
+
+	// Sent back to back while the first query runs: refused, and not counted.
+	sendQuery(t, conn, "S3 throttling")
+	if messages := readUntilDone(t, conn); messages[len(messages)-1]["code"] != wsproto.CodeQueryInProgress {
+		t.Fatalf("messages = %v, want the second query rejected while the first runs", messages)
+	}
+
+	if err := conn.WriteJSON(map[string]interface{}{"version": wsproto.Version, "type": "cancel"}); err != nil {
+		t.Fatalf("send cancel: %v", err)
+	}
+	if messages := readUntilDone(t, conn); messages[len(messages)-1]["code"] != wsproto.CodeCanceled {
+		t.Fatalf("messages = %v, want the first query canceled", messages)
+	}
+
+	// Only the first query was counted, so one more fits in the limit of 2.
+	sendQuery(t, conn, "S3 throttling")
+	select {
+	case <-provider.started:
+	case <-time.After(5 * time.Second):
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		var msg map[string]interface{}
+		conn.ReadJSON(&msg)
+		t.Fatalf("retried query did not start, got %v; want the rejected query to leave the quota untouched", msg)
+	}
+}
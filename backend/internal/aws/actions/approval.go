@@ -0,0 +1,356 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+	ApprovalExecuted = "executed"
+)
+
+var (
+	ErrApprovalNotFound  = errors.New("approval not found")
+	ErrApprovalResolved  = errors.New("approval already resolved")
+	ErrApprovalSignature = errors.New("invalid approval signature")
+	ErrApprovalExpired   = errors.New("approval expired")
+	ErrApprovalApprover  = errors.New("approval requires an approver other than the requester")
+)
+
+type Approval struct {
+	ID         string
+	PlanID     string
+	Status     string
+	Requester  string
+	Approver   string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	ResolvedAt time.Time
+	Results    []ExecutionResult
+}
+
+// ApprovalManager sends plans out for approval and records the decisions in
+// the action_approvals table, so a callback is checked against stored state.
+// Only the channels of approvals still being waited on live in memory.
+type ApprovalManager struct {
+	db         *sqlite.Client
+	webhookURL string
+	secret     string
+	timeout    time.Duration
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	waiting map[string]chan bool
+}
+
+func NewApprovalManager(db *sqlite.Client, webhookURL, secret string, timeout time.Duration) *ApprovalManager {
+	if timeout <= 0 {
+		timeout = 15 * time.Minute
+	}
+
+	return &ApprovalManager{
+		db:         db,
+		webhookURL: webhookURL,
+		secret:     secret,
+		timeout:    timeout,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		waiting: make(map[string]chan bool),
+	}
+}
+
+// Enabled reports whether approvals can be requested. Without a shared secret
+// no callback could be verified, so approvals stay disabled.
+func (m *ApprovalManager) Enabled() bool {
+	return m != nil && m.db != nil && m.webhookURL != "" && m.secret != ""
+}
+
+// Request records a pending approval for the stored plan planID and posts
+// plan to the approval webhook on behalf of requester, who can not approve
+// it themselves. The payload carries a signature over the approval ID and
+// expiry that the callback must send back.
+func (m *ApprovalManager) Request(ctx context.Context, planID string, plan *ActionPlan, requester string) (*Approval, error) {
+	now := time.Now()
+	approval := &Approval{
+		ID:        uuid.New().String(),
+		PlanID:    planID,
+		Status:    ApprovalPending,
+		Requester: requester,
+		CreatedAt: now,
+		// Stored with second precision, so the expiry is truncated to match
+		// what the callback is verified against.
+		ExpiresAt: now.Add(m.timeout).Truncate(time.Second),
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"approval_id":  approval.ID,
+		"risk_level":   plan.RiskLevel,
+		"explanation":  plan.Explanation,
+		"actions":      plan.Actions,
+		"requested_by": requester,
+		"callback":     fmt.Sprintf("/api/v1/actions/approvals/%s/callback", approval.ID),
+		"expires_at":   approval.ExpiresAt.Unix(),
+		"signature":    m.sign(approval.ID, approval.ExpiresAt),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal approval request: %w", err)
+	}
+
+	// The approval is stored and awaited before the webhook goes out, so a
+	// callback that arrives immediately still finds it.
+	err = m.db.InsertActionApproval(&models.ActionApprovalRecord{
+		ID:        approval.ID,
+		PlanID:    planID,
+		Status:    approval.Status,
+		Requester: requester,
+		CreatedAt: approval.CreatedAt,
+		ExpiresAt: approval.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.waiting[approval.ID] = make(chan bool, 1)
+	m.mu.Unlock()
+
+	if err := m.post(ctx, payload); err != nil {
+		m.mu.Lock()
+		delete(m.waiting, approval.ID)
+		m.mu.Unlock()
+		if delErr := m.db.DeleteActionApproval(approval.ID); delErr != nil {
+			logger.Error("Failed to delete unsent approval", zap.String("approval_id", approval.ID), zap.Error(delErr))
+		}
+		return nil, err
+	}
+
+	logger.Info("Approval requested for action plan",
+		zap.String("approval_id", approval.ID),
+		zap.String("plan_id", planID),
+		zap.String("risk", plan.RiskLevel),
+		zap.Int("actions", len(plan.Actions)),
+	)
+
+	return approval, nil
+}
+
+func (m *ApprovalManager) post(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", m.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create approval request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post approval webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("approval webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Wait blocks until the approval is resolved, expires or ctx ends. An
+// approval that expires or is abandoned because ctx ended is marked expired,
+// so a late callback can not resolve it with nobody left to run the plan.
+func (m *ApprovalManager) Wait(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	decision, ok := m.waiting[id]
+	m.mu.Unlock()
+	if !ok {
+		return false, ErrApprovalNotFound
+	}
+	defer func() {
+		m.mu.Lock()
+		delete(m.waiting, id)
+		m.mu.Unlock()
+	}()
+
+	record, found, err := m.db.GetActionApproval(id)
+	if err != nil {
+		m.expire(id)
+		return false, err
+	}
+	if !found {
+		m.expire(id)
+		return false, ErrApprovalNotFound
+	}
+
+	timer := time.NewTimer(time.Until(record.ExpiresAt))
+	defer timer.Stop()
+
+	select {
+	case approved := <-decision:
+		return approved, nil
+	case <-timer.C:
+		m.expire(id)
+		logger.Warn("Approval timed out", zap.String("approval_id", id))
+		return false, nil
+	case <-ctx.Done():
+		m.expire(id)
+		return false, ctx.Err()
+	}
+}
+
+// expire marks the approval expired if it is still pending.
+func (m *ApprovalManager) expire(id string) {
+	if _, err := m.db.ResolveActionApproval(id, ApprovalPending, ApprovalExpired, "", time.Now()); err != nil {
+		logger.Error("Failed to expire approval", zap.String("approval_id", id), zap.Error(err))
+	}
+}
+
+// Resolve records the decision from a callback carrying the signature sent
+// with the webhook for this approval, checked against the stored approval.
+// An approval must name an approver, and that approver must not be the
+// identity that requested the plan.
+func (m *ApprovalManager) Resolve(id string, approved bool, approver, signature string) error {
+	if m.secret == "" || m.db == nil {
+		return ErrApprovalSignature
+	}
+
+	record, found, err := m.db.GetActionApproval(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrApprovalNotFound
+	}
+	if !hmac.Equal([]byte(signature), []byte(m.sign(record.ID, record.ExpiresAt))) {
+		return ErrApprovalSignature
+	}
+	if record.Status != ApprovalPending {
+		return ErrApprovalResolved
+	}
+	if approved && (approver == "" || approver == record.Requester) {
+		return ErrApprovalApprover
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A pending approval nobody waits on was abandoned, e.g. by a restart,
+	// and its plan will not run.
+	decision, waiting := m.waiting[id]
+	if !waiting || !time.Now().Before(record.ExpiresAt) {
+		if _, err := m.db.ResolveActionApproval(id, ApprovalPending, ApprovalExpired, "", time.Now()); err != nil {
+			return err
+		}
+		return ErrApprovalExpired
+	}
+
+	status := ApprovalRejected
+	if approved {
+		status = ApprovalApproved
+	}
+	resolved, err := m.db.ResolveActionApproval(id, ApprovalPending, status, approver, time.Now())
+	if err != nil {
+		return err
+	}
+	if !resolved {
+		return ErrApprovalResolved
+	}
+
+	decision <- approved
+
+	logger.Info("Approval resolved",
+		zap.String("approval_id", id),
+		zap.Bool("approved", approved),
+		zap.String("approver", approver),
+	)
+
+	return nil
+}
+
+// sign returns the hex HMAC-SHA256 of the approval ID and expiry under the
+// shared secret, binding a callback to one approval until it expires.
+func (m *ApprovalManager) sign(id string, expiresAt time.Time) string {
+	mac := hmac.New(sha256.New, []byte(m.secret))
+	fmt.Fprintf(mac, "%s.%d", id, expiresAt.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// storedResult is an ExecutionResult as kept with its approval.
+type storedResult struct {
+	Action  Action `json:"action"`
+	Success bool   `json:"success"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (m *ApprovalManager) Complete(id string, results []ExecutionResult) error {
+	stored := make([]storedResult, 0, len(results))
+	for _, result := range results {
+		entry := storedResult{Action: result.Action, Success: result.Success, Output: result.Output}
+		if result.Error != nil {
+			entry.Error = result.Error.Error()
+		}
+		stored = append(stored, entry)
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal approval results: %w", err)
+	}
+
+	return m.db.CompleteActionApproval(id, ApprovalExecuted, string(data))
+}
+
+func (m *ApprovalManager) Get(id string) (Approval, error) {
+	record, found, err := m.db.GetActionApproval(id)
+	if err != nil {
+		return Approval{}, err
+	}
+	if !found {
+		return Approval{}, ErrApprovalNotFound
+	}
+
+	approval := Approval{
+		ID:         record.ID,
+		PlanID:     record.PlanID,
+		Status:     record.Status,
+		Requester:  record.Requester,
+		Approver:   record.Approver,
+		CreatedAt:  record.CreatedAt,
+		ExpiresAt:  record.ExpiresAt,
+		ResolvedAt: record.ResolvedAt,
+	}
+
+	if record.ResultsJSON != "" {
+		var stored []storedResult
+		if err := json.Unmarshal([]byte(record.ResultsJSON), &stored); err != nil {
+			return Approval{}, fmt.Errorf("failed to unmarshal approval results: %w", err)
+		}
+		for _, entry := range stored {
+			result := ExecutionResult{Action: entry.Action, Success: entry.Success, Output: entry.Output}
+			if entry.Error != "" {
+				result.Error = errors.New(entry.Error)
+			}
+			approval.Results = append(approval.Results, result)
+		}
+	}
+
+	return approval, nil
+}
@@ -0,0 +1,227 @@
+package actions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+)
+
+// webhookRequest is the part of an approval webhook payload a callback
+// needs to echo back.
+type webhookRequest struct {
+	ApprovalID string `json:"approval_id"`
+	ExpiresAt  int64  `json:"expires_at"`
+	Signature  string `json:"signature"`
+}
+
+func newTestDB(t *testing.T) *sqlite.Client {
+	t.Helper()
+
+	db, err := sqlite.NewClient(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+	return db
+}
+
+// newTestApprovals returns a manager backed by a fresh database whose
+// webhook accepts every request and forwards the payloads it receives on the
+// returned channel.
+func newTestApprovals(t *testing.T, secret string) (*ApprovalManager, <-chan webhookRequest) {
+	t.Helper()
+
+	requested := make(chan webhookRequest, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requested <- payload
+	}))
+	t.Cleanup(webhook.Close)
+
+	return NewApprovalManager(newTestDB(t), webhook.URL, secret, time.Minute), requested
+}
+
+func TestApprovalEnabledRequiresSecret(t *testing.T) {
+	db := newTestDB(t)
+	if NewApprovalManager(db, "https://hooks.example.com", "", 0).Enabled() {
+		t.Error("approvals enabled without a secret")
+	}
+	if NewApprovalManager(db, "", "s3cret", 0).Enabled() {
+		t.Error("approvals enabled without a webhook")
+	}
+	if !NewApprovalManager(db, "https://hooks.example.com", "s3cret", 0).Enabled() {
+		t.Error("approvals disabled with a webhook and secret")
+	}
+}
+
+func TestApprovalResolveRejectsBadSignatures(t *testing.T) {
+	m, requested := newTestApprovals(t, "s3cret")
+	approval, err := m.Request(context.Background(), "plan-1", &ActionPlan{RiskLevel: "HIGH"}, "carol")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	sent := <-requested
+	if sent.ApprovalID != approval.ID || sent.ExpiresAt != approval.ExpiresAt.Unix() || sent.Signature == "" {
+		t.Fatalf("webhook payload = %+v, want the signed approval", sent)
+	}
+
+	other, err := m.Request(context.Background(), "plan-1", &ActionPlan{RiskLevel: "HIGH"}, "carol")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	otherSent := <-requested
+
+	// A signature over a later expiry does not match the one on record.
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	fmt.Fprintf(mac, "%s.%d", approval.ID, sent.ExpiresAt+3600)
+	extended := hex.EncodeToString(mac.Sum(nil))
+
+	for _, signature := range []string{"", "s3cret", sent.Signature + " ", otherSent.Signature, extended} {
+		if err := m.Resolve(approval.ID, true, "alice", signature); !errors.Is(err, ErrApprovalSignature) {
+			t.Errorf("signature %q: error = %v, want ErrApprovalSignature", signature, err)
+		}
+	}
+
+	// A manager without a secret never accepts a callback, even an empty signature.
+	open := NewApprovalManager(nil, "", "", 0)
+	if err := open.Resolve(approval.ID, true, "alice", ""); !errors.Is(err, ErrApprovalSignature) {
+		t.Errorf("no secret: error = %v, want ErrApprovalSignature", err)
+	}
+
+	got, err := m.Get(approval.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Status != ApprovalPending {
+		t.Errorf("status = %q, want %q", got.Status, ApprovalPending)
+	}
+	if err := m.Resolve(other.ID, true, "alice", otherSent.Signature); err != nil {
+		t.Errorf("resolve with its own signature: %v", err)
+	}
+}
+
+func TestApprovalCallbackUnblocksWait(t *testing.T) {
+	m, requested := newTestApprovals(t, "s3cret")
+	approval, err := m.Request(context.Background(), "plan-1", &ActionPlan{RiskLevel: "HIGH"}, "carol")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	sent := <-requested
+	if sent.ApprovalID != approval.ID {
+		t.Fatalf("webhook received %q, want %q", sent.ApprovalID, approval.ID)
+	}
+
+	decision := make(chan bool, 1)
+	go func() {
+		approved, err := m.Wait(context.Background(), approval.ID)
+		if err != nil {
+			t.Errorf("wait: %v", err)
+		}
+		decision <- approved
+	}()
+
+	if err := m.Resolve(approval.ID, true, "alice", sent.Signature); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	select {
+	case approved := <-decision:
+		if !approved {
+			t.Error("wait returned a rejection, want approval")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait did not return after the callback")
+	}
+
+	got, _ := m.Get(approval.ID)
+	if got.Status != ApprovalApproved || got.Approver != "alice" || got.PlanID != "plan-1" {
+		t.Errorf("approval = %+v, want plan-1 approved by alice", got)
+	}
+	m.mu.Lock()
+	waiting := len(m.waiting)
+	m.mu.Unlock()
+	if waiting != 0 {
+		t.Errorf("%d approvals still waited on after resolution, want none", waiting)
+	}
+	if err := m.Resolve(approval.ID, false, "bob", sent.Signature); !errors.Is(err, ErrApprovalResolved) {
+		t.Errorf("second resolve: error = %v, want ErrApprovalResolved", err)
+	}
+}
+
+func TestApprovalResolveRequiresAnotherApprover(t *testing.T) {
+	m, requested := newTestApprovals(t, "s3cret")
+	approval, err := m.Request(context.Background(), "plan-1", &ActionPlan{RiskLevel: "HIGH"}, "carol")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	sent := <-requested
+
+	for _, approver := range []string{"", "carol"} {
+		if err := m.Resolve(approval.ID, true, approver, sent.Signature); !errors.Is(err, ErrApprovalApprover) {
+			t.Errorf("approval by %q: error = %v, want %v", approver, err, ErrApprovalApprover)
+		}
+	}
+	if got, _ := m.Get(approval.ID); got.Status != ApprovalPending {
+		t.Fatalf("status = %q after refused approvals, want pending", got.Status)
+	}
+
+	if err := m.Resolve(approval.ID, true, "dave", sent.Signature); err != nil {
+		t.Fatalf("approval by another approver: %v", err)
+	}
+}
+
+func TestApprovalResolveRejectsExpiredApprovals(t *testing.T) {
+	m, requested := newTestApprovals(t, "s3cret")
+	m.timeout = time.Millisecond
+	approval, err := m.Request(context.Background(), "plan-1", &ActionPlan{RiskLevel: "HIGH"}, "carol")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	sent := <-requested
+	time.Sleep(10 * time.Millisecond)
+
+	if err := m.Resolve(approval.ID, true, "alice", sent.Signature); !errors.Is(err, ErrApprovalExpired) {
+		t.Errorf("error = %v, want ErrApprovalExpired", err)
+	}
+}
+
+func TestApprovalResolveUsesStoredState(t *testing.T) {
+	m, requested := newTestApprovals(t, "s3cret")
+	approval, err := m.Request(context.Background(), "plan-1", &ActionPlan{RiskLevel: "HIGH"}, "carol")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	sent := <-requested
+
+	// A restarted process has nothing in memory: the callback is verified
+	// against the stored approval, which nobody waits on any more.
+	restarted := NewApprovalManager(m.db, m.webhookURL, "s3cret", time.Minute)
+	if err := restarted.Resolve(approval.ID, true, "carol", sent.Signature); !errors.Is(err, ErrApprovalApprover) {
+		t.Errorf("self-approval after restart: error = %v, want ErrApprovalApprover", err)
+	}
+	if err := restarted.Resolve(approval.ID, true, "alice", sent.Signature); !errors.Is(err, ErrApprovalExpired) {
+		t.Errorf("abandoned approval: error = %v, want ErrApprovalExpired", err)
+	}
+	if got, _ := restarted.Get(approval.ID); got.Status != ApprovalExpired {
+		t.Errorf("status = %q, want %q", got.Status, ApprovalExpired)
+	}
+}
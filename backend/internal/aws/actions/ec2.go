@@ -0,0 +1,207 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/aws-agent/backend/pkg/awsauth"
+)
+
+type EC2Client struct {
+	client *ec2.Client
+}
+
+type EC2Instance struct {
+	InstanceID       string
+	InstanceType     string
+	State            string
+	VPCID            string
+	SubnetID         string
+	PrivateIPAddress string
+}
+
+type SecurityGroupRule struct {
+	GroupID     string
+	Egress      bool
+	Protocol    string
+	FromPort    int
+	ToPort      int
+	CIDR        string
+	Description string
+}
+
+// NewEC2Client resolves credentials and, when region is empty, the region
+// through the AWS SDK default chain, so instance and task roles work without
+// keys in the environment.
+func NewEC2Client(region string) (*EC2Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	awsCfg, err := awsauth.LoadConfig(ctx, region)
+	if err != nil {
+		return nil, fmt.Errorf("EC2 client requires AWS configuration: %w", err)
+	}
+
+	if _, err := awsCfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("EC2 client requires AWS credentials: %w", err)
+	}
+
+	return newEC2ClientWithConfig(awsCfg), nil
+}
+
+func newEC2ClientWithConfig(awsCfg aws.Config, optFns ...func(*ec2.Options)) *EC2Client {
+	return &EC2Client{client: ec2.NewFromConfig(awsCfg, optFns...)}
+}
+
+// DescribeInstances returns the given instances, or every instance when
+// instanceIDs is empty, following NextToken through all pages.
+func (c *EC2Client) DescribeInstances(ctx context.Context, instanceIDs []string) ([]EC2Instance, error) {
+	paginator := ec2.NewDescribeInstancesPaginator(c.client, &ec2.DescribeInstancesInput{
+		InstanceIds: instanceIDs,
+	})
+
+	var instances []EC2Instance
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instances: %w", err)
+		}
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				instances = append(instances, toEC2Instance(instance))
+			}
+		}
+	}
+
+	return instances, nil
+}
+
+func toEC2Instance(instance types.Instance) EC2Instance {
+	result := EC2Instance{
+		InstanceID:       aws.ToString(instance.InstanceId),
+		InstanceType:     string(instance.InstanceType),
+		VPCID:            aws.ToString(instance.VpcId),
+		SubnetID:         aws.ToString(instance.SubnetId),
+		PrivateIPAddress: aws.ToString(instance.PrivateIpAddress),
+	}
+	if instance.State != nil {
+		result.State = string(instance.State.Name)
+	}
+	return result
+}
+
+func (c *EC2Client) AuthorizeSecurityGroupRule(ctx context.Context, rule SecurityGroupRule) error {
+	ipRange := types.IpRange{CidrIp: aws.String(rule.CIDR)}
+	if rule.Description != "" {
+		ipRange.Description = aws.String(rule.Description)
+	}
+	permissions := []types.IpPermission{{
+		IpProtocol: aws.String(rule.Protocol),
+		FromPort:   aws.Int32(int32(rule.FromPort)),
+		ToPort:     aws.Int32(int32(rule.ToPort)),
+		IpRanges:   []types.IpRange{ipRange},
+	}}
+
+	var applied *bool
+	if rule.Egress {
+		out, err := c.client.AuthorizeSecurityGroupEgress(ctx, &ec2.AuthorizeSecurityGroupEgressInput{
+			GroupId:       aws.String(rule.GroupID),
+			IpPermissions: permissions,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to authorize egress on %s: %w", rule.GroupID, err)
+		}
+		applied = out.Return
+	} else {
+		out, err := c.client.AuthorizeSecurityGroupIngress(ctx, &ec2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       aws.String(rule.GroupID),
+			IpPermissions: permissions,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to authorize ingress on %s: %w", rule.GroupID, err)
+		}
+		applied = out.Return
+	}
+
+	if !aws.ToBool(applied) {
+		return fmt.Errorf("security group rule was not applied to %s", rule.GroupID)
+	}
+	return nil
+}
+
+// ec2Resource is a resource kind a prerequisite can name, with the describe
+// call that looks it up and the error code EC2 returns when it is missing.
+type ec2Resource struct {
+	describe func(ctx context.Context, client *ec2.Client, id string) (int, error)
+	notFound string
+}
+
+var ec2Resources = map[string]ec2Resource{
+	"vpc": {
+		describe: func(ctx context.Context, client *ec2.Client, id string) (int, error) {
+			out, err := client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{VpcIds: []string{id}})
+			if err != nil {
+				return 0, err
+			}
+			return len(out.Vpcs), nil
+		},
+		notFound: "InvalidVpcID.NotFound",
+	},
+	"security_group": {
+		describe: func(ctx context.Context, client *ec2.Client, id string) (int, error) {
+			out, err := client.DescribeSecurityGroups(ctx, &ec2.DescribeSecurityGroupsInput{GroupIds: []string{id}})
+			if err != nil {
+				return 0, err
+			}
+			return len(out.SecurityGroups), nil
+		},
+		notFound: "InvalidGroup.NotFound",
+	},
+	"subnet": {
+		describe: func(ctx context.Context, client *ec2.Client, id string) (int, error) {
+			out, err := client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{SubnetIds: []string{id}})
+			if err != nil {
+				return 0, err
+			}
+			return len(out.Subnets), nil
+		},
+		notFound: "InvalidSubnetID.NotFound",
+	},
+	"instance": {
+		describe: func(ctx context.Context, client *ec2.Client, id string) (int, error) {
+			out, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{id}})
+			if err != nil {
+				return 0, err
+			}
+			return len(out.Reservations), nil
+		},
+		notFound: "InvalidInstanceID.NotFound",
+	},
+}
+
+// ResourceExists describes the resource of the given kind (vpc,
+// security_group, subnet or instance) and reports whether it exists.
+func (c *EC2Client) ResourceExists(ctx context.Context, kind, id string) (bool, error) {
+	resource, ok := ec2Resources[kind]
+	if !ok {
+		return false, fmt.Errorf("unsupported EC2 resource: %s", kind)
+	}
+
+	found, err := resource.describe(ctx, c.client, id)
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == resource.notFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s %s: %w", kind, id, err)
+	}
+
+	return found > 0, nil
+}
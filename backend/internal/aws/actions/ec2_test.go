@@ -0,0 +1,202 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ec2Call is one operation the stubbed EC2 client sent: its name, typed
+// input and the signed HTTP request that would have gone on the wire.
+type ec2Call struct {
+	Operation string
+	Input     interface{}
+	Request   *smithyhttp.Request
+}
+
+type ec2InputKey struct{}
+
+// newStubEC2 returns an EC2 client whose requests never leave the process:
+// an initialize middleware captures each typed input and a finalize
+// middleware, running after signing, answers with respond.
+func newStubEC2(t *testing.T, respond func(call ec2Call) (interface{}, error)) (*EC2Client, func() []ec2Call) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var calls []ec2Call
+	client := newEC2ClientWithConfig(aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDTEST", "secret", "session"),
+	}, func(o *ec2.Options) {
+		o.RetryMaxAttempts = 1
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("captureInput",
+				func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+					return next.HandleInitialize(middleware.WithStackValue(ctx, ec2InputKey{}, in.Parameters), in)
+				}), middleware.Before)
+			if err != nil {
+				return err
+			}
+			return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("stubResponse",
+				func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+					call := ec2Call{
+						Operation: awsmiddleware.GetOperationName(ctx),
+						Input:     middleware.GetStackValue(ctx, ec2InputKey{}),
+					}
+					call.Request, _ = in.Request.(*smithyhttp.Request)
+					mu.Lock()
+					calls = append(calls, call)
+					mu.Unlock()
+
+					result, err := respond(call)
+					return middleware.FinalizeOutput{Result: result}, middleware.Metadata{}, err
+				}), middleware.After)
+		})
+	})
+
+	return client, func() []ec2Call {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ec2Call(nil), calls...)
+	}
+}
+
+func TestEC2DescribeInstancesSignsRequests(t *testing.T) {
+	client, calls := newStubEC2(t, func(call ec2Call) (interface{}, error) {
+		return &ec2.DescribeInstancesOutput{Reservations: []types.Reservation{{
+			Instances: []types.Instance{{
+				InstanceId:   aws.String("i-123"),
+				InstanceType: types.InstanceTypeT3Micro,
+				State:        &types.InstanceState{Name: types.InstanceStateNameRunning},
+				VpcId:        aws.String("vpc-1"),
+			}},
+		}}}, nil
+	})
+
+	instances, err := client.DescribeInstances(context.Background(), []string{"i-123"})
+	if err != nil {
+		t.Fatalf("DescribeInstances: %v", err)
+	}
+
+	want := []EC2Instance{{InstanceID: "i-123", InstanceType: "t3.micro", State: "running", VPCID: "vpc-1"}}
+	if !reflect.DeepEqual(instances, want) {
+		t.Errorf("instances = %+v, want %+v", instances, want)
+	}
+
+	got := calls()
+	if len(got) != 1 || got[0].Operation != "DescribeInstances" {
+		t.Fatalf("calls = %+v, want one DescribeInstances", got)
+	}
+	if input := got[0].Input.(*ec2.DescribeInstancesInput); !reflect.DeepEqual(input.InstanceIds, []string{"i-123"}) {
+		t.Errorf("instance ids = %v, want [i-123]", input.InstanceIds)
+	}
+	auth := got[0].Request.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDTEST/") ||
+		!strings.Contains(auth, "/us-east-1/ec2/aws4_request") {
+		t.Errorf("authorization = %q, want a SigV4 signature for ec2 in us-east-1", auth)
+	}
+	if token := got[0].Request.Header.Get("X-Amz-Security-Token"); token != "session" {
+		t.Errorf("security token = %q, want the session token", token)
+	}
+}
+
+func TestEC2DescribeInstancesFollowsNextToken(t *testing.T) {
+	pages := map[string]*ec2.DescribeInstancesOutput{
+		"": {
+			Reservations: []types.Reservation{{Instances: []types.Instance{{InstanceId: aws.String("i-1")}}}},
+			NextToken:    aws.String("page-2"),
+		},
+		"page-2": {
+			Reservations: []types.Reservation{{Instances: []types.Instance{{InstanceId: aws.String("i-2")}, {InstanceId: aws.String("i-3")}}}},
+		},
+	}
+	client, calls := newStubEC2(t, func(call ec2Call) (interface{}, error) {
+		return pages[aws.ToString(call.Input.(*ec2.DescribeInstancesInput).NextToken)], nil
+	})
+
+	instances, err := client.DescribeInstances(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("DescribeInstances: %v", err)
+	}
+
+	var ids []string
+	for _, instance := range instances {
+		ids = append(ids, instance.InstanceID)
+	}
+	if !reflect.DeepEqual(ids, []string{"i-1", "i-2", "i-3"}) {
+		t.Errorf("instance ids = %v, want every page", ids)
+	}
+	if n := len(calls()); n != 2 {
+		t.Errorf("%d calls, want one per page", n)
+	}
+}
+
+func TestEC2ErrorsCarryCode(t *testing.T) {
+	client, _ := newStubEC2(t, func(call ec2Call) (interface{}, error) {
+		return nil, &smithy.GenericAPIError{Code: "UnauthorizedOperation", Message: "denied"}
+	})
+
+	_, err := client.DescribeInstances(context.Background(), nil)
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "UnauthorizedOperation" {
+		t.Errorf("error = %v, want the EC2 error code", err)
+	}
+}
+
+func TestEC2AuthorizeSecurityGroupRule(t *testing.T) {
+	client, calls := newStubEC2(t, func(call ec2Call) (interface{}, error) {
+		switch call.Operation {
+		case "AuthorizeSecurityGroupIngress":
+			return &ec2.AuthorizeSecurityGroupIngressOutput{Return: aws.Bool(true)}, nil
+		default:
+			return &ec2.AuthorizeSecurityGroupEgressOutput{Return: aws.Bool(false)}, nil
+		}
+	})
+
+	rule := SecurityGroupRule{GroupID: "sg-1", Protocol: "tcp", FromPort: 443, ToPort: 443, CIDR: "10.0.0.0/8", Description: "https"}
+	if err := client.AuthorizeSecurityGroupRule(context.Background(), rule); err != nil {
+		t.Fatalf("ingress: %v", err)
+	}
+	input := calls()[0].Input.(*ec2.AuthorizeSecurityGroupIngressInput)
+	permission := input.IpPermissions[0]
+	if aws.ToString(input.GroupId) != "sg-1" || aws.ToString(permission.IpProtocol) != "tcp" ||
+		aws.ToInt32(permission.FromPort) != 443 || aws.ToString(permission.IpRanges[0].CidrIp) != "10.0.0.0/8" {
+		t.Errorf("ingress input = %+v, want the rule", input)
+	}
+
+	rule.Egress = true
+	if err := client.AuthorizeSecurityGroupRule(context.Background(), rule); err == nil {
+		t.Error("egress that EC2 did not apply succeeded, want an error")
+	}
+}
+
+func TestEC2ResourceExists(t *testing.T) {
+	client, _ := newStubEC2(t, func(call ec2Call) (interface{}, error) {
+		if ids := call.Input.(*ec2.DescribeVpcsInput).VpcIds; ids[0] == "vpc-1" {
+			return &ec2.DescribeVpcsOutput{Vpcs: []types.Vpc{{VpcId: aws.String("vpc-1")}}}, nil
+		}
+		return nil, &smithy.GenericAPIError{Code: "InvalidVpcID.NotFound"}
+	})
+
+	if exists, err := client.ResourceExists(context.Background(), "vpc", "vpc-1"); err != nil || !exists {
+		t.Errorf("vpc-1 exists = %v, %v; want true", exists, err)
+	}
+	if exists, err := client.ResourceExists(context.Background(), "vpc", "vpc-2"); err != nil || exists {
+		t.Errorf("vpc-2 exists = %v, %v; want false without an error", exists, err)
+	}
+	if _, err := client.ResourceExists(context.Background(), "bucket", "b"); err == nil {
+		t.Error("unsupported resource kind succeeded, want an error")
+	}
+}
@@ -2,7 +2,11 @@ package actions
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"go.uber.org/zap"
 
@@ -10,24 +14,30 @@ import (
 	"github.com/aws-agent/backend/pkg/logger"
 )
 
+// ErrActionNotImplemented fails actions that only run in dry-run mode.
+var ErrActionNotImplemented = errors.New("action is not implemented")
+
 type Executor struct {
-	llmClient *llm.Client
-	dryRun    bool
+	llmClient           *llm.Client
+	ec2                 *EC2Client
+	dryRun              bool
+	verifyPrerequisites bool
 }
 
 type ActionPlan struct {
-	Actions      []Action
-	Explanation  string
-	RiskLevel    string
+	Actions          []Action
+	Explanation      string
+	RiskLevel        string
 	RequiresApproval bool
 }
 
 type Action struct {
-	Service     string
-	Action      string
-	Parameters  map[string]interface{}
-	Description string
-	RiskLevel   string
+	Service       string
+	Action        string
+	Parameters    map[string]interface{}
+	Description   string
+	RiskLevel     string
+	Prerequisites []string
 }
 
 type ExecutionResult struct {
@@ -37,17 +47,20 @@ type ExecutionResult struct {
 	Error   error
 }
 
-func NewExecutor(llmClient *llm.Client, dryRun bool) *Executor {
+func NewExecutor(llmClient *llm.Client, dryRun, verifyPrerequisites bool) *Executor {
 	return &Executor{
-		llmClient: llmClient,
-		dryRun:    dryRun,
+		llmClient:           llmClient,
+		dryRun:              dryRun,
+		verifyPrerequisites: verifyPrerequisites,
 	}
 }
 
-func (e *Executor) PlanActions(ctx context.Context, issue string, context string) (*ActionPlan, error) {
-	logger.Info("Planning AWS actions for issue", zap.String("issue", issue))
+func (e *Executor) WithEC2(client *EC2Client) *Executor {
+	e.ec2 = client
+	return e
+}
 
-	systemPrompt := `You are an AWS automation expert. Analyze the issue and recommend AWS actions to resolve it.
+const planningRules = `You are an AWS automation expert. Analyze the issue and recommend AWS actions to resolve it.
 
 IMPORTANT SAFETY RULES:
 1. NEVER recommend destructive actions (delete, terminate) without explicit confirmation
@@ -57,9 +70,101 @@ IMPORTANT SAFETY RULES:
 5. Include rollback steps
 
 Classify risk as: LOW, MEDIUM, HIGH
-- LOW: Read-only, monitoring setup, tagging
-- MEDIUM: Configuration changes, security group updates
-- HIGH: Resource creation/deletion, IAM changes
+- LOW: Read-only lookups
+- MEDIUM: Configuration changes, security group updates, monitoring setup
+- HIGH: Resource creation/deletion, IAM changes`
+
+const submitPlanTool = "submit_action_plan"
+
+// actionPlanSchema is the JSON schema of the submit_action_plan arguments;
+// it mirrors the JSON format requested from providers without tool calling.
+const actionPlanSchema = `{
+  "type": "object",
+  "properties": {
+    "actions": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "service": {"type": "string", "enum": ["ec2", "lambda", "iam", "cloudwatch"]},
+          "action": {"type": "string", "description": "Action name, e.g. create_vpc_endpoint"},
+          "parameters": {"type": "object", "description": "Action parameters, e.g. {\"service\": \"s3\", \"vpc_id\": \"vpc-xxx\"}"},
+          "description": {"type": "string"},
+          "risk_level": {"type": "string", "enum": ["LOW", "MEDIUM", "HIGH"]},
+          "prerequisites": {"type": "array", "items": {"type": "string"}}
+        },
+        "required": ["service", "action", "parameters", "description", "risk_level"]
+      }
+    },
+    "explanation": {"type": "string"},
+    "risk_level": {"type": "string", "enum": ["LOW", "MEDIUM", "HIGH"]},
+    "requires_approval": {"type": "boolean"}
+  },
+  "required": ["actions", "explanation", "risk_level", "requires_approval"]
+}`
+
+func (e *Executor) PlanActions(ctx context.Context, issue string, context string) (*ActionPlan, error) {
+	logger.Info("Planning AWS actions for issue", zap.String("issue", issue))
+
+	plan, err := e.planWithTools(ctx, issue, context)
+	if errors.Is(err, llm.ErrToolsUnsupported) {
+		plan, err = e.planWithText(ctx, issue, context)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan actions: %w", err)
+	}
+
+	logger.Info("Action plan created",
+		zap.Int("actions", len(plan.Actions)),
+		zap.String("risk", plan.RiskLevel),
+		zap.Bool("requires_approval", plan.RequiresApproval),
+	)
+
+	return plan, nil
+}
+
+func (e *Executor) planWithTools(ctx context.Context, issue string, context string) (*ActionPlan, error) {
+	userPrompt := fmt.Sprintf(`Issue: %s
+
+Context:
+%s
+
+Plan AWS actions to resolve this issue and submit the plan with the %s tool.`, issue, context, submitPlanTool)
+
+	resp, err := e.llmClient.CompleteWithTools(ctx, llm.CompletionRequest{
+		SystemPrompt: planningRules,
+		UserPrompt:   userPrompt,
+		Temperature:  0.1,
+		MaxTokens:    1500,
+	}, []llm.Tool{{
+		Name:        submitPlanTool,
+		Description: "Submit the plan of AWS actions that resolves the issue.",
+		Parameters:  json.RawMessage(actionPlanSchema),
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, call := range resp.ToolCalls {
+		if call.Name != submitPlanTool {
+			continue
+		}
+		plan, err := decodeActionPlan(call.Arguments)
+		if err != nil {
+			logger.Warn("Failed to decode action plan tool call", zap.Error(err))
+			return unparsedActionPlan(), nil
+		}
+		return plan, nil
+	}
+
+	// A model that answered in text instead of calling the tool may still
+	// have written the plan as JSON.
+	logger.Warn("Action planning returned no tool call, parsing text response")
+	return e.parseActionPlan(resp.Content), nil
+}
+
+func (e *Executor) planWithText(ctx context.Context, issue string, context string) (*ActionPlan, error) {
+	systemPrompt := planningRules + `
 
 Return JSON:
 {
@@ -69,12 +174,12 @@ Return JSON:
       "action": "create_vpc_endpoint",
       "parameters": {"service": "s3", "vpc_id": "vpc-xxx"},
       "description": "Create S3 VPC endpoint for private access",
-      "risk_level": "MEDIUM"
+      "risk_level": "MEDIUM",
+      "prerequisites": ["VPC vpc-xxx exists", "IAM permission ec2:CreateVpcEndpoint"]
     }
   ],
   "explanation": "Lambda in VPC needs S3 access without internet gateway",
-  "risk_level": "MEDIUM",
-  "requires_approval": true
+  "risk_level": "MEDIUM"
 }`
 
 	userPrompt := fmt.Sprintf(`Issue: %s
@@ -90,20 +195,11 @@ Plan AWS actions to resolve this issue. Return JSON only.`, issue, context)
 		Temperature:  0.1,
 		MaxTokens:    1500,
 	})
-
 	if err != nil {
-		return nil, fmt.Errorf("failed to plan actions: %w", err)
+		return nil, err
 	}
 
-	plan := e.parseActionPlan(resp.Content)
-
-	logger.Info("Action plan created",
-		zap.Int("actions", len(plan.Actions)),
-		zap.String("risk", plan.RiskLevel),
-		zap.Bool("requires_approval", plan.RequiresApproval),
-	)
-
-	return plan, nil
+	return e.parseActionPlan(resp.Content), nil
 }
 
 func (e *Executor) ExecuteActions(ctx context.Context, plan *ActionPlan, approved bool) ([]ExecutionResult, error) {
@@ -141,6 +237,20 @@ func (e *Executor) ExecuteActions(ctx context.Context, plan *ActionPlan, approve
 }
 
 func (e *Executor) executeAction(ctx context.Context, action Action) ExecutionResult {
+	if unmet := e.checkPrerequisites(ctx, action); len(unmet) > 0 {
+		if e.verifyPrerequisites {
+			return ExecutionResult{
+				Action:  action,
+				Success: false,
+				Error:   fmt.Errorf("unmet prerequisites: %s", strings.Join(unmet, "; ")),
+			}
+		}
+		logger.Warn("Executing action with unmet prerequisites",
+			zap.String("action", action.Action),
+			zap.Strings("unmet", unmet),
+		)
+	}
+
 	if e.dryRun {
 		logger.Info("DRY RUN: Would execute action",
 			zap.String("service", action.Service),
@@ -232,131 +342,318 @@ func (e *Executor) executeCloudWatchAction(ctx context.Context, action Action) E
 }
 
 func (e *Executor) createVPCEndpoint(ctx context.Context, action Action) ExecutionResult {
-	logger.Info("Creating VPC endpoint", zap.Any("parameters", action.Parameters))
-
-	output := fmt.Sprintf("Created VPC endpoint for %s in VPC %s",
-		action.Parameters["service"],
-		action.Parameters["vpc_id"],
-	)
-
-	return ExecutionResult{
-		Action:  action,
-		Success: true,
-		Output:  output,
-	}
+	return notImplementedResult(action, "creating VPC endpoints")
 }
 
 func (e *Executor) modifySecurityGroup(ctx context.Context, action Action) ExecutionResult {
 	logger.Info("Modifying security group", zap.Any("parameters", action.Parameters))
 
-	output := fmt.Sprintf("Modified security group %s",
-		action.Parameters["security_group_id"],
-	)
+	if e.ec2 == nil {
+		return failedResult(action, fmt.Errorf("EC2 client is not configured"))
+	}
+
+	rule, err := securityGroupRule(action.Parameters)
+	if err != nil {
+		return failedResult(action, err)
+	}
+
+	if err := e.ec2.AuthorizeSecurityGroupRule(ctx, rule); err != nil {
+		return failedResult(action, fmt.Errorf("failed to modify security group: %w", err))
+	}
+
+	direction := "ingress"
+	if rule.Egress {
+		direction = "egress"
+	}
 
 	return ExecutionResult{
 		Action:  action,
 		Success: true,
-		Output:  output,
+		Output: fmt.Sprintf("Authorized %s %s %d-%d from %s on security group %s",
+			direction, rule.Protocol, rule.FromPort, rule.ToPort, rule.CIDR, rule.GroupID,
+		),
 	}
 }
 
 func (e *Executor) describeInstances(ctx context.Context, action Action) ExecutionResult {
 	logger.Info("Describing EC2 instances", zap.Any("parameters", action.Parameters))
 
-	output := "Instance details retrieved"
+	if e.ec2 == nil {
+		return failedResult(action, fmt.Errorf("EC2 client is not configured"))
+	}
 
-	return ExecutionResult{
-		Action:  action,
-		Success: true,
-		Output:  output,
+	instanceIDs := stringListParam(action.Parameters, "instance_ids")
+	if id := stringParam(action.Parameters, "instance_id"); id != "" {
+		instanceIDs = append(instanceIDs, id)
 	}
-}
 
-func (e *Executor) updateLambdaTimeout(ctx context.Context, action Action) ExecutionResult {
-	logger.Info("Updating Lambda timeout", zap.Any("parameters", action.Parameters))
+	instances, err := e.ec2.DescribeInstances(ctx, instanceIDs)
+	if err != nil {
+		return failedResult(action, fmt.Errorf("failed to describe instances: %w", err))
+	}
 
-	output := fmt.Sprintf("Updated timeout for function %s to %v seconds",
-		action.Parameters["function_name"],
-		action.Parameters["timeout"],
-	)
+	lines := make([]string, 0, len(instances)+1)
+	lines = append(lines, fmt.Sprintf("Found %d instance(s)", len(instances)))
+	for _, instance := range instances {
+		lines = append(lines, fmt.Sprintf("%s %s %s vpc=%s subnet=%s ip=%s",
+			instance.InstanceID,
+			instance.InstanceType,
+			instance.State,
+			instance.VPCID,
+			instance.SubnetID,
+			instance.PrivateIPAddress,
+		))
+	}
 
 	return ExecutionResult{
 		Action:  action,
 		Success: true,
-		Output:  output,
+		Output:  strings.Join(lines, "\n"),
 	}
 }
 
-func (e *Executor) updateLambdaMemory(ctx context.Context, action Action) ExecutionResult {
-	logger.Info("Updating Lambda memory", zap.Any("parameters", action.Parameters))
-
-	output := fmt.Sprintf("Updated memory for function %s to %v MB",
-		action.Parameters["function_name"],
-		action.Parameters["memory"],
+// notImplementedResult fails an action the executor can only dry-run, so a
+// plan never reports a change that was not made.
+func notImplementedResult(action Action, what string) ExecutionResult {
+	logger.Warn("Action is not implemented outside dry-run",
+		zap.String("service", action.Service),
+		zap.String("action", action.Action),
 	)
+	return failedResult(action, fmt.Errorf("%w: %s", ErrActionNotImplemented, what))
+}
 
+func failedResult(action Action, err error) ExecutionResult {
 	return ExecutionResult{
 		Action:  action,
-		Success: true,
-		Output:  output,
+		Success: false,
+		Error:   err,
 	}
 }
 
-func (e *Executor) addLambdaEnvironmentVariable(ctx context.Context, action Action) ExecutionResult {
-	logger.Info("Adding Lambda environment variable", zap.Any("parameters", action.Parameters))
+func securityGroupRule(params map[string]interface{}) (SecurityGroupRule, error) {
+	rule := SecurityGroupRule{
+		GroupID:     stringParam(params, "security_group_id"),
+		Egress:      strings.EqualFold(stringParam(params, "direction"), "egress"),
+		Protocol:    strings.ToLower(stringParam(params, "protocol")),
+		CIDR:        stringParam(params, "cidr"),
+		Description: stringParam(params, "description"),
+	}
 
-	output := fmt.Sprintf("Added environment variable to function %s",
-		action.Parameters["function_name"],
-	)
+	if rule.GroupID == "" {
+		return rule, fmt.Errorf("security_group_id is required")
+	}
+	if rule.Protocol == "" {
+		rule.Protocol = "tcp"
+	}
+	if rule.CIDR == "" {
+		return rule, fmt.Errorf("cidr is required")
+	}
 
-	return ExecutionResult{
-		Action:  action,
-		Success: true,
-		Output:  output,
+	port, hasPort := intParam(params, "port")
+	fromPort, hasFrom := intParam(params, "from_port")
+	toPort, hasTo := intParam(params, "to_port")
+
+	switch {
+	case hasFrom && hasTo:
+		rule.FromPort, rule.ToPort = fromPort, toPort
+	case hasPort:
+		rule.FromPort, rule.ToPort = port, port
+	case rule.Protocol == "-1":
+		rule.FromPort, rule.ToPort = -1, -1
+	default:
+		return rule, fmt.Errorf("port or from_port/to_port is required")
 	}
+
+	return rule, nil
 }
 
-func (e *Executor) createCloudWatchAlarm(ctx context.Context, action Action) ExecutionResult {
-	logger.Info("Creating CloudWatch alarm", zap.Any("parameters", action.Parameters))
+func stringParam(params map[string]interface{}, key string) string {
+	value, ok := params[key]
+	if !ok || value == nil {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprint(value))
+}
 
-	output := fmt.Sprintf("Created alarm %s",
-		action.Parameters["alarm_name"],
-	)
+func stringListParam(params map[string]interface{}, key string) []string {
+	raw, ok := params[key].([]interface{})
+	if !ok {
+		return nil
+	}
 
-	return ExecutionResult{
-		Action:  action,
-		Success: true,
-		Output:  output,
+	values := make([]string, 0, len(raw))
+	for _, item := range raw {
+		if s := strings.TrimSpace(fmt.Sprint(item)); s != "" {
+			values = append(values, s)
+		}
 	}
+	return values
 }
 
-func (e *Executor) createLogGroup(ctx context.Context, action Action) ExecutionResult {
-	logger.Info("Creating log group", zap.Any("parameters", action.Parameters))
+func intParam(params map[string]interface{}, key string) (int, bool) {
+	switch v := params[key].(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
 
-	output := fmt.Sprintf("Created log group %s",
-		action.Parameters["log_group_name"],
-	)
+func (e *Executor) updateLambdaTimeout(ctx context.Context, action Action) ExecutionResult {
+	return notImplementedResult(action, "updating Lambda timeouts")
+}
 
-	return ExecutionResult{
-		Action:  action,
-		Success: true,
-		Output:  output,
-	}
+func (e *Executor) updateLambdaMemory(ctx context.Context, action Action) ExecutionResult {
+	return notImplementedResult(action, "updating Lambda memory")
+}
+
+func (e *Executor) addLambdaEnvironmentVariable(ctx context.Context, action Action) ExecutionResult {
+	return notImplementedResult(action, "adding Lambda environment variables")
+}
+
+func (e *Executor) createCloudWatchAlarm(ctx context.Context, action Action) ExecutionResult {
+	return notImplementedResult(action, "creating CloudWatch alarms")
+}
+
+func (e *Executor) createLogGroup(ctx context.Context, action Action) ExecutionResult {
+	return notImplementedResult(action, "creating log groups")
 }
 
 func (e *Executor) parseActionPlan(content string) *ActionPlan {
+	plan, err := decodeActionPlan([]byte(extractJSONObject(content)))
+	if err != nil {
+		logger.Warn("Failed to parse action plan", zap.Error(err))
+		return unparsedActionPlan()
+	}
+	return plan
+}
+
+// unparsedActionPlan stands in for a plan the model response did not yield;
+// it has no actions and still requires approval.
+func unparsedActionPlan() *ActionPlan {
 	return &ActionPlan{
-		Actions: []Action{
-			{
-				Service:     "ec2",
-				Action:      "create_vpc_endpoint",
-				Parameters:  map[string]interface{}{"service": "s3"},
-				Description: "Create S3 VPC endpoint",
-				RiskLevel:   "MEDIUM",
-			},
-		},
-		Explanation:      "Parsed from LLM response",
-		RiskLevel:        "MEDIUM",
+		Explanation:      "Failed to parse action plan from LLM response",
+		RiskLevel:        "HIGH",
 		RequiresApproval: true,
 	}
 }
+
+func decodeActionPlan(data []byte) (*ActionPlan, error) {
+	var raw struct {
+		Actions []struct {
+			Service       string                 `json:"service"`
+			Action        string                 `json:"action"`
+			Parameters    map[string]interface{} `json:"parameters"`
+			Description   string                 `json:"description"`
+			RiskLevel     string                 `json:"risk_level"`
+			Prerequisites []string               `json:"prerequisites"`
+		} `json:"actions"`
+		Explanation string `json:"explanation"`
+		RiskLevel   string `json:"risk_level"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	plan := &ActionPlan{
+		Actions:     make([]Action, 0, len(raw.Actions)),
+		Explanation: raw.Explanation,
+		RiskLevel:   strings.ToUpper(raw.RiskLevel),
+	}
+
+	for _, a := range raw.Actions {
+		prerequisites := make([]string, 0, len(a.Prerequisites))
+		for _, prerequisite := range a.Prerequisites {
+			if prerequisite = strings.TrimSpace(prerequisite); prerequisite != "" {
+				prerequisites = append(prerequisites, prerequisite)
+			}
+		}
+
+		plan.Actions = append(plan.Actions, Action{
+			Service:       strings.ToLower(a.Service),
+			Action:        a.Action,
+			Parameters:    a.Parameters,
+			Description:   a.Description,
+			RiskLevel:     strings.ToUpper(a.RiskLevel),
+			Prerequisites: prerequisites,
+		})
+	}
+	enforceMinimumRisk(plan)
+	plan.RequiresApproval = requiresApproval(plan)
+
+	return plan, nil
+}
+
+// readOnlyActions are the only actions the model may rate LOW, and so the
+// only ones that can run without approval. Anything else changes AWS
+// resources and is at least MEDIUM whatever the model says.
+var readOnlyActions = map[string]bool{
+	"ec2/describe_instances": true,
+}
+
+var riskRanks = map[string]int{"LOW": 0, "MEDIUM": 1, "HIGH": 2}
+
+// minimumRisk is the lowest risk the server accepts for an action.
+func minimumRisk(action Action) string {
+	switch {
+	case action.Service == "iam":
+		return "HIGH"
+	case readOnlyActions[action.Service+"/"+action.Action]:
+		return "LOW"
+	default:
+		return "MEDIUM"
+	}
+}
+
+// atLeastRisk raises level to minimum. Levels the model made up rank HIGH.
+func atLeastRisk(level, minimum string) string {
+	rank, ok := riskRanks[level]
+	if !ok {
+		return "HIGH"
+	}
+	if rank < riskRanks[minimum] {
+		return minimum
+	}
+	return level
+}
+
+// enforceMinimumRisk raises each action to its minimum risk and the plan to
+// its riskiest action.
+func enforceMinimumRisk(plan *ActionPlan) {
+	for i := range plan.Actions {
+		action := &plan.Actions[i]
+		action.RiskLevel = atLeastRisk(action.RiskLevel, minimumRisk(*action))
+		plan.RiskLevel = atLeastRisk(plan.RiskLevel, action.RiskLevel)
+	}
+}
+
+// requiresApproval decides approval on the server rather than trusting the
+// model: only a plan whose own risk and every action's risk are LOW, after
+// the per-action minimums, runs without it.
+func requiresApproval(plan *ActionPlan) bool {
+	if plan.RiskLevel != "LOW" {
+		return true
+	}
+	for _, action := range plan.Actions {
+		if atLeastRisk(action.RiskLevel, minimumRisk(action)) != "LOW" {
+			return true
+		}
+	}
+	return false
+}
+
+func extractJSONObject(content string) string {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start == -1 || end < start {
+		return content
+	}
+
+	return content[start : end+1]
+}
@@ -0,0 +1,327 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+)
+
+// newTestEC2 returns an EC2 client that knows the resources in existing and
+// records the describe calls it receives.
+func newTestEC2(t *testing.T, existing ...string) (*EC2Client, func() []string) {
+	t.Helper()
+
+	known := make(map[string]bool)
+	for _, id := range existing {
+		known[id] = true
+	}
+	client, calls := newStubEC2(t, func(call ec2Call) (interface{}, error) {
+		switch input := call.Input.(type) {
+		case *ec2.DescribeVpcsInput:
+			if known[input.VpcIds[0]] {
+				return &ec2.DescribeVpcsOutput{Vpcs: []types.Vpc{{VpcId: aws.String(input.VpcIds[0])}}}, nil
+			}
+			return nil, &smithy.GenericAPIError{Code: "InvalidVpcID.NotFound"}
+		case *ec2.DescribeSecurityGroupsInput:
+			if known[input.GroupIds[0]] {
+				return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: []types.SecurityGroup{{GroupId: aws.String(input.GroupIds[0])}}}, nil
+			}
+			return nil, &smithy.GenericAPIError{Code: "InvalidGroup.NotFound"}
+		}
+		return nil, &smithy.GenericAPIError{Code: "UnsupportedOperation"}
+	})
+	return client, func() []string {
+		var operations []string
+		for _, call := range calls() {
+			operations = append(operations, call.Operation)
+		}
+		return operations
+	}
+}
+
+func TestParseActionPlanPrerequisites(t *testing.T) {
+	e := NewExecutor(nil, true, true)
+
+	plan := e.parseActionPlan("Here is the plan:\n" + `{
+  "actions": [{
+    "service": "EC2",
+    "action": "create_vpc_endpoint",
+    "parameters": {"service": "s3", "vpc_id": "vpc-123"},
+    "description": "Create an S3 endpoint",
+    "risk_level": "low",
+    "prerequisites": ["VPC vpc-123 exists", "  ", "IAM permission ec2:CreateVpcEndpoint"]
+  }],
+  "explanation": "Private S3 access",
+  "risk_level": "LOW",
+  "requires_approval": true
+}`)
+
+	if len(plan.Actions) != 1 {
+		t.Fatalf("actions = %+v, want one", plan.Actions)
+	}
+	want := []string{"VPC vpc-123 exists", "IAM permission ec2:CreateVpcEndpoint"}
+	if got := plan.Actions[0].Prerequisites; !reflect.DeepEqual(got, want) {
+		t.Errorf("prerequisites = %q, want %q", got, want)
+	}
+	if plan.Actions[0].RiskLevel != "MEDIUM" || plan.RiskLevel != "MEDIUM" || !plan.RequiresApproval {
+		t.Errorf("plan risk %s, action risk %s, approval %v; want creating an endpoint raised to MEDIUM and approved",
+			plan.RiskLevel, plan.Actions[0].RiskLevel, plan.RequiresApproval)
+	}
+
+	plan = e.parseActionPlan(`{"actions": [{"service": "ec2", "action": "modify_security_group", "risk_level": "MEDIUM"}],
+  "risk_level": "LOW", "requires_approval": false}`)
+	if !plan.RequiresApproval {
+		t.Error("RequiresApproval = false with a MEDIUM action, want approval required")
+	}
+}
+
+func TestExecuteActionsChecksPrerequisites(t *testing.T) {
+	tests := []struct {
+		name          string
+		prerequisites []string
+		wantSuccess   bool
+		wantCalls     []string
+	}{
+		{
+			name:          "met",
+			prerequisites: []string{"VPC vpc-123 exists", "Security group sg-1 allows HTTPS"},
+			wantSuccess:   true,
+			wantCalls:     []string{"DescribeVpcs", "DescribeSecurityGroups"},
+		},
+		{
+			name:          "unmet",
+			prerequisites: []string{"VPC vpc-999 exists"},
+			wantCalls:     []string{"DescribeVpcs"},
+		},
+		{
+			name:          "unverifiable",
+			prerequisites: []string{"IAM permission ec2:CreateVpcEndpoint"},
+			wantSuccess:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec2, calls := newTestEC2(t, "vpc-123", "sg-1")
+			e := NewExecutor(nil, true, true).WithEC2(ec2)
+
+			results, err := e.ExecuteActions(context.Background(), &ActionPlan{
+				RiskLevel: "LOW",
+				Actions: []Action{{
+					Service:       "ec2",
+					Action:        "create_vpc_endpoint",
+					Parameters:    map[string]interface{}{"vpc_id": "vpc-123"},
+					Description:   "Create an S3 endpoint",
+					RiskLevel:     "LOW",
+					Prerequisites: tt.prerequisites,
+				}},
+			}, false)
+			if err != nil {
+				t.Fatalf("ExecuteActions: %v", err)
+			}
+
+			if len(results) != 1 || results[0].Success != tt.wantSuccess {
+				t.Fatalf("results = %+v, want success %v", results, tt.wantSuccess)
+			}
+			if !tt.wantSuccess && !strings.Contains(results[0].Error.Error(), "unmet prerequisites: VPC vpc-999 exists") {
+				t.Errorf("error = %v, want the unmet prerequisite named", results[0].Error)
+			}
+			if got := calls(); strings.Join(got, ",") != strings.Join(tt.wantCalls, ",") {
+				t.Errorf("describe calls = %v, want %v", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// toolProvider answers tool completions with calls, or with content when
+// calls is empty, and records the tools it was offered.
+type toolProvider struct {
+	*llmtest.Provider
+	calls   []llm.ToolCall
+	content string
+
+	mu    sync.Mutex
+	tools [][]llm.Tool
+}
+
+func (p *toolProvider) CompleteWithTools(ctx context.Context, model string, req llm.CompletionRequest, tools []llm.Tool) (*llm.ToolCompletionResponse, error) {
+	p.mu.Lock()
+	p.tools = append(p.tools, tools)
+	p.mu.Unlock()
+	return &llm.ToolCompletionResponse{Content: p.content, ToolCalls: p.calls}, nil
+}
+
+const lowRiskPlan = `{
+	"actions": [{"service": "EC2", "action": "describe_instances", "parameters": {"instance_id": "i-123"},
+		"description": "Look up the instance", "risk_level": "low"}],
+	"explanation": "The instance state explains the outage",
+	"risk_level": "LOW",
+	"requires_approval": true
+}`
+
+func TestPlanActionsWithToolCalls(t *testing.T) {
+	provider := &toolProvider{
+		Provider: &llmtest.Provider{},
+		calls:    []llm.ToolCall{{Name: submitPlanTool, Arguments: json.RawMessage(lowRiskPlan)}},
+	}
+	e := NewExecutor(llmtest.NewClient(provider), true, false)
+
+	plan, err := e.PlanActions(context.Background(), "Instance unreachable", "")
+	if err != nil {
+		t.Fatalf("PlanActions: %v", err)
+	}
+
+	if len(provider.tools) != 1 || len(provider.tools[0]) != 1 || provider.tools[0][0].Name != submitPlanTool {
+		t.Fatalf("tools offered = %+v, want only %s", provider.tools, submitPlanTool)
+	}
+	if !json.Valid(provider.tools[0][0].Parameters) {
+		t.Error("the action plan schema is not valid JSON")
+	}
+	if len(provider.Requests()) != 0 {
+		t.Errorf("text completions = %d, want none when the tool is called", len(provider.Requests()))
+	}
+
+	want := Action{
+		Service:       "ec2",
+		Action:        "describe_instances",
+		Parameters:    map[string]interface{}{"instance_id": "i-123"},
+		Description:   "Look up the instance",
+		RiskLevel:     "LOW",
+		Prerequisites: []string{},
+	}
+	if len(plan.Actions) != 1 || !reflect.DeepEqual(plan.Actions[0], want) {
+		t.Errorf("actions = %+v, want %+v", plan.Actions, want)
+	}
+	if plan.RequiresApproval {
+		t.Error("a plan of only LOW risk actions requires approval; the model's requires_approval must not be trusted")
+	}
+}
+
+func TestPlanActionsFallsBackToText(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider llm.Provider
+		actions  int
+	}{
+		{
+			name:     "provider without tool calling",
+			provider: &llmtest.Provider{Reply: func(llm.CompletionRequest) (string, error) { return "Plan:\n" + lowRiskPlan, nil }},
+			actions:  1,
+		},
+		{
+			name:     "tool not called",
+			provider: &toolProvider{Provider: &llmtest.Provider{}, content: "```json\n" + lowRiskPlan + "\n```"},
+			actions:  1,
+		},
+		{
+			name: "malformed tool arguments",
+			provider: &toolProvider{
+				Provider: &llmtest.Provider{},
+				calls:    []llm.ToolCall{{Name: submitPlanTool, Arguments: json.RawMessage(`{"actions": "none"}`)}},
+			},
+			actions: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExecutor(llmtest.NewClient(tt.provider), true, false)
+
+			plan, err := e.PlanActions(context.Background(), "Instance unreachable", "")
+			if err != nil {
+				t.Fatalf("PlanActions: %v", err)
+			}
+			if len(plan.Actions) != tt.actions {
+				t.Errorf("actions = %+v, want %d", plan.Actions, tt.actions)
+			}
+			if tt.actions == 0 && !plan.RequiresApproval {
+				t.Error("an unparsed plan must require approval")
+			}
+		})
+	}
+}
+
+func TestMutatingActionsRequireApprovalWhateverTheModelSays(t *testing.T) {
+	e := NewExecutor(nil, true, false)
+
+	plan := e.parseActionPlan(`{"actions": [{"service": "ec2", "action": "modify_security_group",
+		"parameters": {"security_group_id": "sg-1", "cidr": "0.0.0.0/0", "port": 22},
+		"description": "Open SSH", "risk_level": "LOW"}],
+		"explanation": "Allow SSH", "risk_level": "LOW", "requires_approval": false}`)
+	if !plan.RequiresApproval || plan.RiskLevel != "MEDIUM" || plan.Actions[0].RiskLevel != "MEDIUM" {
+		t.Errorf("LOW security group plan = risk %s, approval %v; want MEDIUM with approval", plan.RiskLevel, plan.RequiresApproval)
+	}
+
+	for _, action := range []Action{
+		{Service: "ec2", Action: "create_vpc_endpoint"},
+		{Service: "lambda", Action: "update_timeout"},
+		{Service: "cloudwatch", Action: "create_alarm"},
+		{Service: "cloudwatch", Action: "create_log_group"},
+		{Service: "ec2", Action: "made_up_action"},
+	} {
+		action.RiskLevel = "LOW"
+		if !requiresApproval(&ActionPlan{RiskLevel: "LOW", Actions: []Action{action}}) {
+			t.Errorf("%s/%s rated LOW runs without approval", action.Service, action.Action)
+		}
+	}
+	if got := minimumRisk(Action{Service: "iam", Action: "attach_policy"}); got != "HIGH" {
+		t.Errorf("IAM minimum risk = %s, want HIGH", got)
+	}
+
+	read := &ActionPlan{RiskLevel: "LOW", Actions: []Action{{Service: "ec2", Action: "describe_instances", RiskLevel: "LOW"}}}
+	if requiresApproval(read) {
+		t.Error("a read-only LOW plan requires approval")
+	}
+
+	// A stored plan written before the minimums were enforced gets them on load.
+	stored, err := DecodePlan(`{"RiskLevel": "LOW", "Actions": [{"Service": "ec2", "Action": "modify_security_group", "RiskLevel": "LOW"}]}`)
+	if err != nil {
+		t.Fatalf("DecodePlan: %v", err)
+	}
+	if !stored.RequiresApproval || stored.RiskLevel != "MEDIUM" {
+		t.Errorf("stored plan = risk %s, approval %v; want MEDIUM with approval", stored.RiskLevel, stored.RequiresApproval)
+	}
+}
+
+func TestUnimplementedActionsFailOutsideDryRun(t *testing.T) {
+	plan := &ActionPlan{RiskLevel: "MEDIUM", Actions: []Action{
+		{Service: "ec2", Action: "create_vpc_endpoint", Description: "Create an S3 endpoint"},
+		{Service: "lambda", Action: "update_timeout", Description: "Raise the timeout"},
+		{Service: "lambda", Action: "update_memory"},
+		{Service: "lambda", Action: "add_environment_variable"},
+		{Service: "cloudwatch", Action: "create_alarm"},
+		{Service: "cloudwatch", Action: "create_log_group"},
+	}}
+
+	for _, action := range plan.Actions {
+		result := NewExecutor(nil, false, false).executeAction(context.Background(), action)
+		if result.Success || !errors.Is(result.Error, ErrActionNotImplemented) || result.Output != "" {
+			t.Errorf("%s/%s = %+v, want a not implemented failure", action.Service, action.Action, result)
+		}
+	}
+
+	results, err := NewExecutor(nil, false, false).ExecuteActions(context.Background(), plan, true)
+	if err != nil {
+		t.Fatalf("ExecuteActions: %v", err)
+	}
+	if len(results) != 1 || ResultStatus(results) != PlanFailed {
+		t.Errorf("results = %+v, want the plan to stop at the first unimplemented action", results)
+	}
+
+	results, err = NewExecutor(nil, true, false).ExecuteActions(context.Background(), plan, true)
+	if err != nil || len(results) != len(plan.Actions) || ResultStatus(results) != PlanExecuted {
+		t.Errorf("dry run = %+v, %v; want every action simulated", results, err)
+	}
+}
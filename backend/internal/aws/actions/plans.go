@@ -0,0 +1,44 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	PlanPlanned          = "planned"
+	PlanAwaitingApproval = "awaiting_approval"
+	PlanExecuting        = "executing"
+	PlanExecuted         = "executed"
+	PlanFailed           = "failed"
+	PlanRejected         = "rejected"
+)
+
+func EncodePlan(plan *ActionPlan) (string, error) {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal action plan: %w", err)
+	}
+	return string(data), nil
+}
+
+// DecodePlan restores a stored plan, re-applying the minimum risk levels and
+// re-deriving RequiresApproval so a stored flag can never waive approval.
+func DecodePlan(data string) (*ActionPlan, error) {
+	var plan ActionPlan
+	if err := json.Unmarshal([]byte(data), &plan); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal action plan: %w", err)
+	}
+	enforceMinimumRisk(&plan)
+	plan.RequiresApproval = requiresApproval(&plan)
+	return &plan, nil
+}
+
+func ResultStatus(results []ExecutionResult) string {
+	for _, result := range results {
+		if !result.Success {
+			return PlanFailed
+		}
+	}
+	return PlanExecuted
+}
@@ -0,0 +1,112 @@
+package actions
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+// prerequisiteRule matches prerequisites naming a kind of resource. The
+// resource is identified by an ID with idPrefix in the prerequisite text, or
+// else by the action parameter. resource is the EC2 resource kind to
+// describe; rules without one cannot be verified.
+type prerequisiteRule struct {
+	keyword   string
+	parameter string
+	idPrefix  string
+	resource  string
+}
+
+var prerequisiteRules = []prerequisiteRule{
+	{keyword: "security group", parameter: "security_group_id", idPrefix: "sg-", resource: "security_group"},
+	{keyword: "log group", parameter: "log_group_name"},
+	{keyword: "subnet", parameter: "subnet_id", idPrefix: "subnet-", resource: "subnet"},
+	{keyword: "vpc", parameter: "vpc_id", idPrefix: "vpc-", resource: "vpc"},
+	{keyword: "function", parameter: "function_name"},
+	{keyword: "lambda", parameter: "function_name"},
+	{keyword: "instance", parameter: "instance_id", idPrefix: "i-", resource: "instance"},
+}
+
+func (e *Executor) checkPrerequisites(ctx context.Context, action Action) []string {
+	var unmet []string
+
+	for _, prerequisite := range action.Prerequisites {
+		met, verifiable := e.describePrerequisite(ctx, action, prerequisite)
+		if !verifiable {
+			logger.Debug("Prerequisite cannot be verified automatically",
+				zap.String("action", action.Action),
+				zap.String("prerequisite", prerequisite),
+			)
+			continue
+		}
+		if !met {
+			unmet = append(unmet, prerequisite)
+		}
+	}
+
+	return unmet
+}
+
+// describePrerequisite looks up the resource a prerequisite names with a
+// describe call. A prerequisite naming a resource the action does not
+// identify is unmet, and one that cannot be described is unverifiable. A
+// failed describe call counts as unmet.
+func (e *Executor) describePrerequisite(ctx context.Context, action Action, prerequisite string) (met bool, verifiable bool) {
+	words := " " + strings.Join(strings.FieldsFunc(strings.ToLower(prerequisite), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ") + " "
+
+	for _, rule := range prerequisiteRules {
+		// Keywords match whole words, singular or plural, so "ec2:CreateVpcEndpoint"
+		// does not name a VPC.
+		if !strings.Contains(words, " "+rule.keyword+" ") && !strings.Contains(words, " "+rule.keyword+"s ") {
+			continue
+		}
+
+		id := resourceID(prerequisite, rule.idPrefix)
+		if id == "" {
+			id = stringParam(action.Parameters, rule.parameter)
+		}
+		if id == "" {
+			return false, true
+		}
+		if rule.resource == "" || e.ec2 == nil {
+			return false, false
+		}
+
+		logger.Info("Verifying prerequisite",
+			zap.String("prerequisite", prerequisite),
+			zap.String(rule.parameter, id),
+		)
+
+		exists, err := e.ec2.ResourceExists(ctx, rule.resource, id)
+		if err != nil {
+			logger.Warn("Failed to verify prerequisite",
+				zap.String("prerequisite", prerequisite),
+				zap.Error(err),
+			)
+			return false, true
+		}
+		return exists, true
+	}
+
+	return false, false
+}
+
+// resourceID returns the first token of text that is an ID with prefix.
+func resourceID(text, prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	for _, token := range strings.Fields(text) {
+		token = strings.Trim(token, ".,;:()'\"")
+		if strings.HasPrefix(token, prefix) && len(token) > len(prefix) {
+			return token
+		}
+	}
+	return ""
+}
@@ -2,13 +2,16 @@ package redis
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 
+	"github.com/aws-agent/backend/internal/metrics"
 	"github.com/aws-agent/backend/pkg/circuitbreaker"
 	"github.com/aws-agent/backend/pkg/logger"
 	"github.com/aws-agent/backend/pkg/retry"
@@ -45,6 +48,7 @@ func NewClient(host string, port int, password string, db int) (*Client, error)
 		Timeout:          10 * time.Second,
 		FailureThreshold: 5,
 		SuccessThreshold: 2,
+		OnStateChange:    metrics.RecordCircuitBreakerState,
 		Logger:           logger.GetLogger(),
 	})
 
@@ -54,6 +58,7 @@ func NewClient(host string, port int, password string, db int) (*Client, error)
 		MaxDelay:       500 * time.Millisecond,
 		Multiplier:     2.0,
 		JitterFraction: 0.1,
+		Classifier:     retry.IsTransient,
 		Logger:         logger.GetLogger(),
 	}
 
@@ -73,6 +78,10 @@ func (c *Client) Close() error {
 	return c.client.Close()
 }
 
+func (c *Client) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
 func (c *Client) SetQuery(ctx context.Context, queryHash string, response interface{}, ttl time.Duration) error {
 	data, err := json.Marshal(response)
 	if err != nil {
@@ -153,17 +162,105 @@ func (c *Client) GetEmbedding(ctx context.Context, textHash string) ([]float32,
 	return embedding, true, nil
 }
 
+func (c *Client) SetWebSearch(ctx context.Context, queryHash string, results interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("failed to marshal web search results: %w", err)
+	}
+
+	err = c.client.Set(ctx, fmt.Sprintf("websearch:%s", queryHash), data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set web search cache: %w", err)
+	}
+
+	logger.Debug("Web search results cached", zap.String("query_hash", queryHash), zap.Duration("ttl", ttl))
+	return nil
+}
+
+func (c *Client) GetWebSearch(ctx context.Context, queryHash string, results interface{}) (bool, error) {
+	data, err := c.client.Get(ctx, fmt.Sprintf("websearch:%s", queryHash)).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get web search cache: %w", err)
+	}
+
+	err = json.Unmarshal(data, results)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal web search results: %w", err)
+	}
+
+	logger.Debug("Web search cache hit", zap.String("query_hash", queryHash))
+	return true, nil
+}
+
+func (c *Client) SetEntities(ctx context.Context, queryHash string, entities []string, ttl time.Duration) error {
+	data, err := json.Marshal(entities)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entities: %w", err)
+	}
+
+	err = c.client.Set(ctx, fmt.Sprintf("entities:%s", queryHash), data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set entity cache: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) GetEntities(ctx context.Context, queryHash string) ([]string, bool, error) {
+	data, err := c.client.Get(ctx, fmt.Sprintf("entities:%s", queryHash)).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get entity cache: %w", err)
+	}
+
+	var entities []string
+	err = json.Unmarshal(data, &entities)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal entities: %w", err)
+	}
+
+	return entities, true, nil
+}
+
+func (c *Client) SetDocType(ctx context.Context, contentHash, docType string, ttl time.Duration) error {
+	err := c.client.Set(ctx, fmt.Sprintf("doctype:%s", contentHash), docType, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set doc type cache: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) GetDocType(ctx context.Context, contentHash string) (string, bool, error) {
+	docType, err := c.client.Get(ctx, fmt.Sprintf("doctype:%s", contentHash)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get doc type cache: %w", err)
+	}
+
+	return docType, true, nil
+}
+
 func (c *Client) InvalidateDocumentCache(ctx context.Context) error {
-	iter := c.client.Scan(ctx, 0, "query:*", 0).Iterator()
-	for iter.Next(ctx) {
-		err := c.client.Del(ctx, iter.Val()).Err()
-		if err != nil {
-			logger.Warn("Failed to delete cache key", zap.Error(err))
+	for _, pattern := range []string{"query:*", "semantic:*"} {
+		iter := c.client.Scan(ctx, 0, pattern, 0).Iterator()
+		for iter.Next(ctx) {
+			err := c.client.Del(ctx, iter.Val()).Err()
+			if err != nil {
+				logger.Warn("Failed to delete cache key", zap.Error(err))
+			}
 		}
-	}
 
-	if err := iter.Err(); err != nil {
-		return fmt.Errorf("failed to iterate cache keys: %w", err)
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("failed to iterate cache keys: %w", err)
+		}
 	}
 
 	logger.Info("Document cache invalidated")
@@ -181,3 +278,170 @@ func (c *Client) GetMetric(ctx context.Context, metricName string) (int64, error
 	}
 	return val, err
 }
+
+// IncrementUserQuota counts one query against a user's quota for day and
+// returns the new count. The key expires after ttl so old days age out.
+func (c *Client) IncrementUserQuota(ctx context.Context, userID, day string, ttl time.Duration) (int64, error) {
+	key := fmt.Sprintf("quota:%s:%s", day, userID)
+
+	pipe := c.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to increment user quota: %w", err)
+	}
+
+	return incr.Val(), nil
+}
+
+func (c *Client) DecrementUserQuota(ctx context.Context, userID, day string) error {
+	if err := c.client.Decr(ctx, fmt.Sprintf("quota:%s:%s", day, userID)).Err(); err != nil {
+		return fmt.Errorf("failed to decrement user quota: %w", err)
+	}
+	return nil
+}
+
+type ConversationTurn struct {
+	Query    string `json:"query"`
+	Response string `json:"response"`
+}
+
+// AppendConversationTurn adds a turn to a user's conversation, keeps only
+// the latest maxTurns and restarts the inactivity expiry.
+func (c *Client) AppendConversationTurn(ctx context.Context, userID, conversationID string, turn ConversationTurn, maxTurns int, ttl time.Duration) error {
+	data, err := json.Marshal(turn)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation turn: %w", err)
+	}
+
+	key := fmt.Sprintf("conversation:%s:%s", userID, conversationID)
+
+	pipe := c.client.TxPipeline()
+	pipe.RPush(ctx, key, data)
+	pipe.LTrim(ctx, key, int64(-maxTurns), -1)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to append conversation turn: %w", err)
+	}
+
+	return nil
+}
+
+// GetConversationTurns returns a conversation's turns, oldest first.
+func (c *Client) GetConversationTurns(ctx context.Context, userID, conversationID string) ([]ConversationTurn, error) {
+	var values []string
+
+	err := retry.Do(ctx, c.retryConfig, func() error {
+		var err error
+		values, err = c.client.LRange(ctx, fmt.Sprintf("conversation:%s:%s", userID, conversationID), 0, -1).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get conversation turns: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	turns := make([]ConversationTurn, 0, len(values))
+	for _, value := range values {
+		var turn ConversationTurn
+		if err := json.Unmarshal([]byte(value), &turn); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal conversation turn: %w", err)
+		}
+		turns = append(turns, turn)
+	}
+
+	return turns, nil
+}
+
+// SemanticQuery is an answered query's embedding, indexed so paraphrases
+// can find the cached response stored under QueryHash.
+type SemanticQuery struct {
+	QueryHash string
+	Embedding []float32
+}
+
+// AddSemanticQuery indexes the embedding of a cached query in scope. The
+// index keeps the newest maxEntries queries and drops ones older than ttl,
+// matching the lifetime of the cached response itself.
+func (c *Client) AddSemanticQuery(ctx context.Context, scope, queryHash string, embedding []float32, ttl time.Duration, maxEntries int) error {
+	data := encodeEmbedding(embedding)
+	index := fmt.Sprintf("semantic:%s", scope)
+	now := time.Now()
+
+	pipe := c.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("semantic:%s:%s", scope, queryHash), data, ttl)
+	pipe.ZAdd(ctx, index, redis.Z{Score: float64(now.Unix()), Member: queryHash})
+	pipe.ZRemRangeByScore(ctx, index, "-inf", fmt.Sprintf("(%d", now.Add(-ttl).Unix()))
+	pipe.ZRemRangeByRank(ctx, index, 0, int64(-maxEntries-1))
+	pipe.Expire(ctx, index, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add semantic query: %w", err)
+	}
+
+	return nil
+}
+
+// GetSemanticQueries returns up to limit indexed queries in scope, newest
+// first. Entries whose embedding has expired are skipped.
+func (c *Client) GetSemanticQueries(ctx context.Context, scope string, limit int) ([]SemanticQuery, error) {
+	var hashes []string
+	err := retry.Do(ctx, c.retryConfig, func() error {
+		var err error
+		hashes, err = c.client.ZRevRange(ctx, fmt.Sprintf("semantic:%s", scope), 0, int64(limit-1)).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get semantic index: %w", err)
+		}
+		return nil
+	})
+	if err != nil || len(hashes) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = fmt.Sprintf("semantic:%s:%s", scope, hash)
+	}
+	values, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get semantic queries: %w", err)
+	}
+
+	queries := make([]SemanticQuery, 0, len(values))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		embedding, err := decodeEmbedding(data)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, SemanticQuery{QueryHash: hashes[i], Embedding: embedding})
+	}
+
+	return queries, nil
+}
+
+// encodeEmbedding packs an embedding as little-endian float32s, a quarter
+// of its JSON size and decoded without parsing on every lookup.
+func encodeEmbedding(embedding []float32) []byte {
+	data := make([]byte, 4*len(embedding))
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(value))
+	}
+	return data
+}
+
+func decodeEmbedding(data string) ([]float32, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("invalid query embedding of %d bytes", len(data))
+	}
+	raw := []byte(data)
+	embedding := make([]float32, len(raw)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+	}
+	return embedding, nil
+}
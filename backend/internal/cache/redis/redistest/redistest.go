@@ -0,0 +1,32 @@
+// Package redistest provides cache clients backed by an in-memory Redis for
+// tests.
+package redistest
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/aws-agent/backend/internal/cache/redis"
+)
+
+// NewClient starts an in-memory Redis that lives for the duration of t and
+// returns a client connected to it.
+func NewClient(t testing.TB) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	srv := miniredis.RunT(t)
+	port, err := strconv.Atoi(srv.Port())
+	if err != nil {
+		t.Fatalf("parse redis port: %v", err)
+	}
+
+	client, err := redis.NewClient(srv.Host(), port, "", 0)
+	if err != nil {
+		t.Fatalf("connect to redis: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client, srv
+}
@@ -4,19 +4,27 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"math"
+	"sync"
 
 	"go.uber.org/zap"
 
 	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/query"
 	"github.com/aws-agent/backend/internal/storage/models"
 	"github.com/aws-agent/backend/internal/storage/sqlite"
 	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/utils"
 )
 
 type Evaluator struct {
-	db        *sqlite.Client
-	llmClient *llm.Client
+	db          *sqlite.Client
+	llmClient   *llm.Client
+	queryEngine *query.Engine
+	cfg         Config
+}
+
+type Config struct {
+	CosineDowngradeThreshold float64
 }
 
 type EvaluationDataset struct {
@@ -30,24 +38,69 @@ type DatasetItem struct {
 }
 
 type EvaluationReport struct {
-	TotalQueries          int
-	IrrelevantCount       int
-	ModerateCount         int
-	FullyRelevantCount    int
-	AvgRelevanceScore     float64
-	AvgAccuracyScore      float64
-	AvgCompletenessScore  float64
-	AvgCitationScore      float64
-	AvgCosineSimilarity   float64
-	IrrelevantPercentage  float64
-	ModeratePercentage    float64
-	FullyRelevantPercentage float64
+	TotalQueries            int     `json:"total_queries"`
+	IrrelevantCount         int     `json:"irrelevant_count"`
+	ModerateCount           int     `json:"moderate_count"`
+	FullyRelevantCount      int     `json:"fully_relevant_count"`
+	AvgRelevanceScore       float64 `json:"avg_relevance_score"`
+	AvgAccuracyScore        float64 `json:"avg_accuracy_score"`
+	AvgCompletenessScore    float64 `json:"avg_completeness_score"`
+	AvgCitationScore        float64 `json:"avg_citation_score"`
+	AvgCosineSimilarity     float64 `json:"avg_cosine_similarity"`
+	IrrelevantPercentage    float64 `json:"irrelevant_percentage"`
+	ModeratePercentage      float64 `json:"moderate_percentage"`
+	FullyRelevantPercentage float64 `json:"fully_relevant_percentage"`
+	// Items holds per-query results when the run was detailed, in dataset
+	// order.
+	Items []ItemResult `json:"items,omitempty"`
+}
+
+type ItemResult struct {
+	Index             int     `json:"index"`
+	Query             string  `json:"query"`
+	Category          string  `json:"category"`
+	Status            string  `json:"status"`
+	Response          string  `json:"response,omitempty"`
+	Classification    string  `json:"classification,omitempty"`
+	RelevanceScore    float64 `json:"relevance_score"`
+	AccuracyScore     float64 `json:"accuracy_score"`
+	CompletenessScore float64 `json:"completeness_score"`
+	CitationScore     float64 `json:"citation_score"`
+	CosineSimilarity  float64 `json:"cosine_similarity"`
+	Error             string  `json:"error,omitempty"`
+}
+
+const (
+	ItemEvaluated = "evaluated"
+	ItemFailed    = "failed"
+)
+
+type EvaluationProgress struct {
+	Completed            int
+	Failed               int
+	Total                int
+	AvgRelevanceScore    float64
+	AvgAccuracyScore     float64
+	AvgCompletenessScore float64
+	AvgCitationScore     float64
+	AvgCosineSimilarity  float64
+}
+
+type ProgressFunc func(progress EvaluationProgress)
+
+type EvaluationOptions struct {
+	Concurrency int
+	OnProgress  ProgressFunc
+	// Detailed keeps each query's result in the report for export.
+	Detailed bool
 }
 
-func NewEvaluator(db *sqlite.Client, llmClient *llm.Client) *Evaluator {
+func NewEvaluator(db *sqlite.Client, llmClient *llm.Client, queryEngine *query.Engine, cfg Config) *Evaluator {
 	return &Evaluator{
-		db:        db,
-		llmClient: llmClient,
+		db:          db,
+		llmClient:   llmClient,
+		queryEngine: queryEngine,
+		cfg:         cfg,
 	}
 }
 
@@ -60,69 +113,188 @@ func (e *Evaluator) EvaluateQuery(ctx context.Context, queryID, query, response,
 	}
 
 	cosineSim := 0.0
+	classification := score.Classification
 	if groundTruth != "" {
 		cosineSim, err = e.calculateCosineSimilarity(ctx, response, groundTruth)
 		if err != nil {
 			logger.Warn("Failed to calculate cosine similarity", zap.Error(err))
+		} else {
+			classification = blendClassification(classification, cosineSim, e.cfg.CosineDowngradeThreshold)
 		}
 	}
 
+	if classification != score.Classification {
+		logger.Info("Classification downgraded by cosine similarity",
+			zap.String("query_id", queryID),
+			zap.String("llm_classification", score.Classification),
+			zap.String("classification", classification),
+			zap.Float64("cosine_similarity", cosineSim),
+		)
+	}
+
 	result := &models.EvaluationResult{
 		QueryID:               queryID,
 		RelevanceScore:        score.Relevance,
 		AccuracyScore:         score.Accuracy,
 		CompletenessScore:     score.Completeness,
 		CitationScore:         score.Citations,
-		OverallClassification: score.Classification,
+		OverallClassification: classification,
 		Reasoning:             score.Reasoning,
 		CosineSimilarity:      cosineSim,
 	}
 
 	logger.Info("Query evaluated",
 		zap.String("query_id", queryID),
-		zap.String("classification", score.Classification),
+		zap.String("classification", classification),
 		zap.Float64("relevance", score.Relevance),
 	)
 
 	return result, nil
 }
 
-func (e *Evaluator) RunDatasetEvaluation(ctx context.Context, dataset *EvaluationDataset) (*EvaluationReport, error) {
+func blendClassification(classification string, cosineSim, threshold float64) string {
+	if threshold <= 0 || cosineSim >= threshold {
+		return classification
+	}
+
+	switch classification {
+	case "fully_relevant":
+		if cosineSim < threshold/2 {
+			return "irrelevant"
+		}
+		return "moderate"
+	case "moderate":
+		return "irrelevant"
+	}
+
+	return classification
+}
+
+func (e *Evaluator) RunDatasetEvaluation(ctx context.Context, dataset *EvaluationDataset, opts EvaluationOptions) (*EvaluationReport, error) {
 	logger.Info("Running dataset evaluation", zap.Int("items", len(dataset.Items)))
 
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
 	report := &EvaluationReport{
 		TotalQueries: len(dataset.Items),
 	}
 
-	var totalRelevance, totalAccuracy, totalCompleteness, totalCitation, totalCosineSim float64
+	if opts.Detailed {
+		report.Items = make([]ItemResult, len(dataset.Items))
+	}
 
-	for i, item := range dataset.Items {
-		logger.Info("Evaluating item", zap.Int("index", i+1), zap.Int("total", len(dataset.Items)))
+	var totalRelevance, totalAccuracy, totalCompleteness, totalCitation, totalCosineSim float64
+	var completed, failed int
+	var mu sync.Mutex
+
+	record := func(item ItemResult, result *models.EvaluationResult) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if opts.Detailed {
+			if result != nil {
+				item.Status = ItemEvaluated
+				item.Classification = result.OverallClassification
+				item.RelevanceScore = result.RelevanceScore
+				item.AccuracyScore = result.AccuracyScore
+				item.CompletenessScore = result.CompletenessScore
+				item.CitationScore = result.CitationScore
+				item.CosineSimilarity = result.CosineSimilarity
+			} else {
+				item.Status = ItemFailed
+			}
+			report.Items[item.Index] = item
+		}
 
-		queryID := fmt.Sprintf("eval_%d", i)
+		if result == nil {
+			failed++
+		} else {
+			completed++
+
+			switch result.OverallClassification {
+			case "irrelevant":
+				report.IrrelevantCount++
+			case "moderate":
+				report.ModerateCount++
+			case "fully_relevant":
+				report.FullyRelevantCount++
+			}
+
+			totalRelevance += result.RelevanceScore
+			totalAccuracy += result.AccuracyScore
+			totalCompleteness += result.CompletenessScore
+			totalCitation += result.CitationScore
+			totalCosineSim += result.CosineSimilarity
+		}
 
-		result, err := e.EvaluateQuery(ctx, queryID, item.Query, item.GroundTruth, item.GroundTruth)
-		if err != nil {
-			logger.Error("Failed to evaluate query", zap.Error(err))
-			continue
+		if opts.OnProgress == nil {
+			return
 		}
 
-		switch result.OverallClassification {
-		case "irrelevant":
-			report.IrrelevantCount++
-		case "moderate":
-			report.ModerateCount++
-		case "fully_relevant":
-			report.FullyRelevantCount++
+		progress := EvaluationProgress{
+			Completed: completed,
+			Failed:    failed,
+			Total:     report.TotalQueries,
+		}
+		if completed > 0 {
+			progress.AvgRelevanceScore = totalRelevance / float64(completed)
+			progress.AvgAccuracyScore = totalAccuracy / float64(completed)
+			progress.AvgCompletenessScore = totalCompleteness / float64(completed)
+			progress.AvgCitationScore = totalCitation / float64(completed)
+			progress.AvgCosineSimilarity = totalCosineSim / float64(completed)
 		}
+		opts.OnProgress(progress)
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
 
-		totalRelevance += result.RelevanceScore
-		totalAccuracy += result.AccuracyScore
-		totalCompleteness += result.CompletenessScore
-		totalCitation += result.CitationScore
-		totalCosineSim += result.CosineSimilarity
+	for i, item := range dataset.Items {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(i int, item DatasetItem) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			logger.Info("Evaluating item", zap.Int("index", i+1), zap.Int("total", len(dataset.Items)))
+
+			queryID := fmt.Sprintf("eval_%d", i)
+			itemResult := ItemResult{Index: i, Query: item.Query, Category: item.Category}
+
+			response, err := e.queryEngine.ProcessQuery(ctx, query.QueryRequest{
+				Query:       item.Query,
+				UserID:      "evaluation",
+				SkipHistory: true,
+				BypassCache: true,
+			})
+			if err != nil {
+				logger.Error("Failed to generate response for evaluation", zap.Error(err))
+				itemResult.Error = err.Error()
+				record(itemResult, nil)
+				return
+			}
+			itemResult.Response = response.Response
+
+			result, err := e.EvaluateQuery(ctx, queryID, item.Query, response.Response, item.GroundTruth)
+			if err != nil {
+				logger.Error("Failed to evaluate query", zap.Error(err))
+				itemResult.Error = err.Error()
+				record(itemResult, nil)
+				return
+			}
+
+			record(itemResult, result)
+		}(i, item)
 	}
 
+	wg.Wait()
+
 	if report.TotalQueries > 0 {
 		report.AvgRelevanceScore = totalRelevance / float64(report.TotalQueries)
 		report.AvgAccuracyScore = totalAccuracy / float64(report.TotalQueries)
@@ -156,26 +328,7 @@ func (e *Evaluator) calculateCosineSimilarity(ctx context.Context, text1, text2
 		return 0, err
 	}
 
-	return cosineSimilarity(emb1, emb2), nil
-}
-
-func cosineSimilarity(a, b []float32) float64 {
-	if len(a) != len(b) {
-		return 0
-	}
-
-	var dotProduct, normA, normB float64
-	for i := range a {
-		dotProduct += float64(a[i]) * float64(b[i])
-		normA += float64(a[i]) * float64(a[i])
-		normB += float64(b[i]) * float64(b[i])
-	}
-
-	if normA == 0 || normB == 0 {
-		return 0
-	}
-
-	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+	return utils.CosineSimilarity(emb1, emb2), nil
 }
 
 func (e *Evaluator) LoadDatasetFromJSON(jsonData string) (*EvaluationDataset, error) {
@@ -0,0 +1,235 @@
+package evaluation
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/query"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+)
+
+const evaluationReply = `{"relevance": 3, "accuracy": 2, "completeness": 2, "citations": 1, "classification": "fully_relevant", "reasoning": "ok"}`
+
+type fakeKG struct{}
+
+func (fakeKG) SearchByEntities(ctx context.Context, entities []string, minConfidence float64) ([]neo4j.Triple, error) {
+	return nil, nil
+}
+
+type fakeVector struct{}
+
+func (fakeVector) Search(ctx context.Context, queryEmbedding []float32, topK int, filters map[string]string) ([]zilliz.SearchResult, error) {
+	return nil, nil
+}
+
+// newTestEvaluator returns an evaluator whose query engine and judge run
+// on a fake LLM that answers every evaluation prompt with evaluationReply.
+func newTestEvaluator(t *testing.T) (*Evaluator, *sqlite.Client) {
+	t.Helper()
+	return newTestEvaluatorWithAnswer(t, func() string { return "Increase the function timeout." })
+}
+
+// newTestEvaluatorWithAnswer is newTestEvaluator with the query engine's
+// answers produced by answer.
+func newTestEvaluatorWithAnswer(t *testing.T, answer func() string) (*Evaluator, *sqlite.Client) {
+	t.Helper()
+
+	db, err := sqlite.NewClient(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+
+	llmClient := llmtest.NewClient(&llmtest.Provider{
+		Reply: func(req llm.CompletionRequest) (string, error) {
+			if strings.Contains(req.SystemPrompt, "evaluation expert") {
+				return evaluationReply, nil
+			}
+			return answer(), nil
+		},
+	})
+	engine := query.NewEngine(db, fakeKG{}, fakeVector{}, llmClient, nil, query.Config{})
+
+	return NewEvaluator(db, llmClient, engine, Config{}), db
+}
+
+func testDataset(n int) *EvaluationDataset {
+	dataset := &EvaluationDataset{}
+	for i := 0; i < n; i++ {
+		dataset.Items = append(dataset.Items, DatasetItem{
+			Query:    "Why does my Lambda function time out?",
+			Category: "lambda",
+		})
+	}
+	return dataset
+}
+
+func TestRunDatasetEvaluationProgress(t *testing.T) {
+	evaluator, _ := newTestEvaluator(t)
+
+	const items = 6
+	var (
+		mu       sync.Mutex
+		progress []EvaluationProgress
+	)
+	report, err := evaluator.RunDatasetEvaluation(context.Background(), testDataset(items), EvaluationOptions{
+		Concurrency: 3,
+		OnProgress: func(p EvaluationProgress) {
+			mu.Lock()
+			progress = append(progress, p)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunDatasetEvaluation: %v", err)
+	}
+
+	if len(progress) != items {
+		t.Fatalf("progress callbacks = %d, want one per item (%d)", len(progress), items)
+	}
+	for i, p := range progress {
+		if p.Total != items {
+			t.Errorf("progress[%d].Total = %d, want %d", i, p.Total, items)
+		}
+		if got := p.Completed + p.Failed; got != i+1 {
+			t.Errorf("progress[%d] reports %d items done, want %d", i, got, i+1)
+		}
+	}
+
+	last := progress[items-1]
+	if last.Completed != items || last.AvgRelevanceScore != 3 || last.AvgCitationScore != 1 {
+		t.Errorf("final progress = %+v, want all items evaluated with relevance 3 and citations 1", last)
+	}
+	if report.FullyRelevantCount != items {
+		t.Errorf("FullyRelevantCount = %d, want %d", report.FullyRelevantCount, items)
+	}
+}
+
+func TestBlendClassification(t *testing.T) {
+	tests := []struct {
+		name           string
+		classification string
+		cosine         float64
+		threshold      float64
+		want           string
+	}{
+		{name: "blending off", classification: "fully_relevant", cosine: 0.1, threshold: 0, want: "fully_relevant"},
+		{name: "similar enough", classification: "fully_relevant", cosine: 0.8, threshold: 0.5, want: "fully_relevant"},
+		{name: "low cosine", classification: "fully_relevant", cosine: 0.4, threshold: 0.5, want: "moderate"},
+		{name: "very low cosine", classification: "fully_relevant", cosine: 0.1, threshold: 0.5, want: "irrelevant"},
+		{name: "moderate", classification: "moderate", cosine: 0.4, threshold: 0.5, want: "irrelevant"},
+		{name: "already irrelevant", classification: "irrelevant", cosine: 0.1, threshold: 0.5, want: "irrelevant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blendClassification(tt.classification, tt.cosine, tt.threshold); got != tt.want {
+				t.Errorf("blendClassification(%q, %v, %v) = %q, want %q",
+					tt.classification, tt.cosine, tt.threshold, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateQueryDowngradesLowCosine(t *testing.T) {
+	// The judge rates every answer fully relevant, but the response and the
+	// ground truth embed to orthogonal vectors.
+	llmClient := llmtest.NewClient(&llmtest.Provider{
+		Reply: func(req llm.CompletionRequest) (string, error) {
+			return evaluationReply, nil
+		},
+		Embed: func(text string) ([]float32, error) {
+			if strings.Contains(text, "ground truth") {
+				return []float32{0, 1, 0, 0, 0, 0, 0, 0}, nil
+			}
+			return []float32{1, 0, 0, 0, 0, 0, 0, 0}, nil
+		},
+	})
+	evaluator := NewEvaluator(nil, llmClient, nil, Config{CosineDowngradeThreshold: 0.5})
+
+	result, err := evaluator.EvaluateQuery(context.Background(), "q1", "Why does Lambda time out?",
+		"Use a bigger S3 bucket.", "The ground truth: raise the function timeout.")
+	if err != nil {
+		t.Fatalf("EvaluateQuery: %v", err)
+	}
+	if result.CosineSimilarity != 0 {
+		t.Errorf("cosine similarity = %v, want 0", result.CosineSimilarity)
+	}
+	if result.OverallClassification != "irrelevant" {
+		t.Errorf("classification = %q, want the LLM's fully_relevant downgraded to irrelevant", result.OverallClassification)
+	}
+}
+
+func TestRunDatasetEvaluationScoresFreshResponse(t *testing.T) {
+	db, err := sqlite.NewClient(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+
+	var mu sync.Mutex
+	answer := "Stale cached answer."
+	provider := &llmtest.Provider{
+		Reply: func(req llm.CompletionRequest) (string, error) {
+			if strings.Contains(req.SystemPrompt, "evaluation expert") {
+				return evaluationReply, nil
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			return answer, nil
+		},
+	}
+	llmClient := llmtest.NewClient(provider)
+	cache, _ := redistest.NewClient(t)
+	engine := query.NewEngine(db, fakeKG{}, fakeVector{}, llmClient, cache, query.Config{})
+	evaluator := NewEvaluator(db, llmClient, engine, Config{})
+
+	const question = "Why does my Lambda function time out?"
+	// An earlier user query leaves an answer in the query cache.
+	if _, err := engine.ProcessQuery(context.Background(), query.QueryRequest{Query: question, UserID: "u1"}); err != nil {
+		t.Fatalf("warm cache: %v", err)
+	}
+	mu.Lock()
+	answer = "Increase the function timeout."
+	mu.Unlock()
+
+	report, err := evaluator.RunDatasetEvaluation(context.Background(), &EvaluationDataset{Items: []DatasetItem{{
+		Query:       question,
+		GroundTruth: "Raise the timeout setting up to 900 seconds.",
+	}}}, EvaluationOptions{Detailed: true})
+	if err != nil {
+		t.Fatalf("RunDatasetEvaluation: %v", err)
+	}
+
+	if got := report.Items[0].Response; got != "Increase the function timeout." {
+		t.Errorf("evaluated response = %q, want a freshly generated answer", got)
+	}
+
+	judged := false
+	for _, req := range provider.Requests() {
+		if !strings.Contains(req.SystemPrompt, "evaluation expert") {
+			continue
+		}
+		judged = true
+		if !strings.Contains(req.UserPrompt, "Increase the function timeout.") || strings.Contains(req.UserPrompt, "Stale cached answer.") {
+			t.Errorf("judge prompt does not score the generated response:\n%s", req.UserPrompt)
+		}
+	}
+	if !judged {
+		t.Fatal("the response was never judged")
+	}
+}
@@ -0,0 +1,103 @@
+package evaluation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Export formats and CSV row layouts accepted by the report writers.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+
+	RowsMetrics = "metrics"
+	RowsQueries = "queries"
+)
+
+var (
+	metricsCSVHeader = []string{"metric", "value"}
+	queriesCSVHeader = []string{
+		"index", "query", "category", "status", "classification",
+		"relevance_score", "accuracy_score", "completeness_score", "citation_score",
+		"cosine_similarity", "error",
+	}
+)
+
+// WriteReportJSON writes the report, including per-query results when the
+// run was detailed.
+func WriteReportJSON(w io.Writer, report *EvaluationReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("failed to write report JSON: %w", err)
+	}
+	return nil
+}
+
+// WriteReportCSV writes one row per aggregate metric, or with RowsQueries
+// one row per dataset item. Query rows need a detailed run.
+func WriteReportCSV(w io.Writer, report *EvaluationReport, rows string) error {
+	writer := csv.NewWriter(w)
+
+	var records [][]string
+	switch rows {
+	case RowsMetrics, "":
+		records = append(records, metricsCSVHeader)
+		for _, metric := range reportMetrics(report) {
+			records = append(records, []string{metric.name, formatFloat(metric.value)})
+		}
+	case RowsQueries:
+		records = append(records, queriesCSVHeader)
+		for _, item := range report.Items {
+			records = append(records, []string{
+				strconv.Itoa(item.Index),
+				item.Query,
+				item.Category,
+				item.Status,
+				item.Classification,
+				formatFloat(item.RelevanceScore),
+				formatFloat(item.AccuracyScore),
+				formatFloat(item.CompletenessScore),
+				formatFloat(item.CitationScore),
+				formatFloat(item.CosineSimilarity),
+				item.Error,
+			})
+		}
+	default:
+		return fmt.Errorf("unknown report rows %q", rows)
+	}
+
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write report CSV: %w", err)
+	}
+	return nil
+}
+
+type reportMetric struct {
+	name  string
+	value float64
+}
+
+func reportMetrics(report *EvaluationReport) []reportMetric {
+	return []reportMetric{
+		{"total_queries", float64(report.TotalQueries)},
+		{"irrelevant_count", float64(report.IrrelevantCount)},
+		{"moderate_count", float64(report.ModerateCount)},
+		{"fully_relevant_count", float64(report.FullyRelevantCount)},
+		{"irrelevant_percentage", report.IrrelevantPercentage},
+		{"moderate_percentage", report.ModeratePercentage},
+		{"fully_relevant_percentage", report.FullyRelevantPercentage},
+		{"avg_relevance_score", report.AvgRelevanceScore},
+		{"avg_accuracy_score", report.AvgAccuracyScore},
+		{"avg_completeness_score", report.AvgCompletenessScore},
+		{"avg_citation_score", report.AvgCitationScore},
+		{"avg_cosine_similarity", report.AvgCosineSimilarity},
+	}
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
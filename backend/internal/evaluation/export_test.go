@@ -0,0 +1,138 @@
+package evaluation
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func runDetailedEvaluation(t *testing.T) *EvaluationReport {
+	t.Helper()
+
+	evaluator, _ := newTestEvaluator(t)
+	report, err := evaluator.RunDatasetEvaluation(context.Background(), testDataset(2), EvaluationOptions{Detailed: true})
+	if err != nil {
+		t.Fatalf("RunDatasetEvaluation: %v", err)
+	}
+	return report
+}
+
+func readCSV(t *testing.T, report *EvaluationReport, rows string) [][]string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteReportCSV(&buf, report, rows); err != nil {
+		t.Fatalf("WriteReportCSV(%s): %v", rows, err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("parse CSV: %v", err)
+	}
+	return records
+}
+
+func TestRunDatasetEvaluationKeepsItemsWhenDetailed(t *testing.T) {
+	report := runDetailedEvaluation(t)
+	if len(report.Items) != 2 {
+		t.Fatalf("items = %+v, want one per dataset item", report.Items)
+	}
+	for i, item := range report.Items {
+		if item.Index != i || item.Status != ItemEvaluated || item.Classification != "fully_relevant" || item.RelevanceScore != 3 {
+			t.Errorf("item %d = %+v, want its evaluated result in dataset order", i, item)
+		}
+	}
+
+	evaluator, _ := newTestEvaluator(t)
+	summary, err := evaluator.RunDatasetEvaluation(context.Background(), testDataset(2), EvaluationOptions{})
+	if err != nil {
+		t.Fatalf("RunDatasetEvaluation: %v", err)
+	}
+	if summary.Items != nil {
+		t.Errorf("items = %+v without Detailed, want none", summary.Items)
+	}
+}
+
+func TestWriteReportCSVColumns(t *testing.T) {
+	report := runDetailedEvaluation(t)
+
+	metrics := readCSV(t, report, RowsMetrics)
+	if !reflect.DeepEqual(metrics[0], []string{"metric", "value"}) {
+		t.Errorf("metrics header = %v", metrics[0])
+	}
+	values := make(map[string]string)
+	for _, record := range metrics[1:] {
+		values[record[0]] = record[1]
+	}
+	if len(values) != 12 || values["total_queries"] != "2" || values["avg_relevance_score"] != "3" || values["fully_relevant_count"] != "2" {
+		t.Errorf("metric rows = %v, want every aggregate", values)
+	}
+
+	queries := readCSV(t, report, RowsQueries)
+	wantHeader := []string{
+		"index", "query", "category", "status", "classification",
+		"relevance_score", "accuracy_score", "completeness_score", "citation_score",
+		"cosine_similarity", "error",
+	}
+	if !reflect.DeepEqual(queries[0], wantHeader) {
+		t.Errorf("queries header = %v, want %v", queries[0], wantHeader)
+	}
+	if len(queries) != 3 {
+		t.Fatalf("query rows = %d, want one per item", len(queries)-1)
+	}
+	if row := queries[1]; row[0] != "0" || row[1] != "Why does my Lambda function time out?" || row[3] != ItemEvaluated || row[5] != "3" || row[6] != "2" {
+		t.Errorf("first query row = %v", row)
+	}
+
+	if err := WriteReportCSV(&bytes.Buffer{}, report, "documents"); err == nil {
+		t.Error("unknown row layout accepted")
+	}
+}
+
+func TestWriteReportJSONSchema(t *testing.T) {
+	report := runDetailedEvaluation(t)
+	report.Items[1].Status = ItemFailed
+	report.Items[1].Error = "query failed"
+
+	var buf bytes.Buffer
+	if err := WriteReportJSON(&buf, report); err != nil {
+		t.Fatalf("WriteReportJSON: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+
+	for _, key := range []string{
+		"total_queries", "avg_relevance_score", "avg_accuracy_score", "avg_completeness_score",
+		"avg_citation_score", "avg_cosine_similarity", "fully_relevant_percentage", "items",
+	} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("report JSON has no %q", key)
+		}
+	}
+
+	items, _ := decoded["items"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("items = %v, want 2", decoded["items"])
+	}
+	first, _ := items[0].(map[string]interface{})
+	var keys []string
+	for key := range first {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	want := []string{
+		"accuracy_score", "category", "citation_score", "classification", "completeness_score",
+		"cosine_similarity", "index", "query", "relevance_score", "response", "status",
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("item keys = %v, want %v", keys, want)
+	}
+	if failed, _ := items[1].(map[string]interface{}); failed["status"] != ItemFailed || failed["error"] != "query failed" {
+		t.Errorf("failed item = %v, want its status and error", failed)
+	}
+}
@@ -0,0 +1,207 @@
+package evaluation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/shutdown"
+)
+
+var (
+	ErrEvaluationRunning = errors.New("an evaluation is already running")
+	ErrInvalidDataset    = errors.New("invalid evaluation dataset")
+	ErrRunNotFound       = errors.New("evaluation run not found")
+)
+
+type JobConfig struct {
+	Concurrency     int
+	MaxDatasetItems int
+}
+
+// Jobs runs dataset evaluations in the background, one at a time, and
+// persists their progress and final report.
+type Jobs struct {
+	db        *sqlite.Client
+	evaluator *Evaluator
+	lifecycle context.Context
+	cfg       JobConfig
+	running   atomic.Bool
+	wg        sync.WaitGroup
+}
+
+func NewJobs(lifecycle context.Context, db *sqlite.Client, evaluator *Evaluator, cfg JobConfig) *Jobs {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 2
+	}
+	if cfg.MaxDatasetItems <= 0 {
+		cfg.MaxDatasetItems = 500
+	}
+
+	return &Jobs{
+		db:        db,
+		evaluator: evaluator,
+		lifecycle: lifecycle,
+		cfg:       cfg,
+	}
+}
+
+// RecoverInterrupted fails runs a previous process left running.
+func (j *Jobs) RecoverInterrupted() error {
+	count, err := j.db.FailInterruptedEvaluationRuns("interrupted by restart")
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.Warn("Marked interrupted evaluation runs as failed", zap.Int("runs", count))
+	}
+	return nil
+}
+
+// Dataset resolves the dataset for a new run: the inline JSON if given,
+// otherwise the dataset stored with an earlier run.
+func (j *Jobs) Dataset(inline json.RawMessage, runID string) (*EvaluationDataset, error) {
+	if len(inline) > 0 {
+		dataset, err := j.evaluator.LoadDatasetFromJSON(string(inline))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDataset, err)
+		}
+		return dataset, nil
+	}
+
+	if runID == "" {
+		return nil, fmt.Errorf("%w: a dataset or dataset_run_id is required", ErrInvalidDataset)
+	}
+
+	run, found, err := j.db.GetEvaluationRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, runID)
+	}
+	return j.evaluator.LoadDatasetFromJSON(run.Dataset)
+}
+
+// Start records a new run and evaluates dataset in the background. Only one
+// run executes at a time; a second returns ErrEvaluationRunning.
+func (j *Jobs) Start(dataset *EvaluationDataset) (*models.EvaluationRun, error) {
+	if err := j.validate(dataset); err != nil {
+		return nil, err
+	}
+
+	if !j.running.CompareAndSwap(false, true) {
+		return nil, ErrEvaluationRunning
+	}
+
+	data, err := json.Marshal(dataset)
+	if err != nil {
+		j.running.Store(false)
+		return nil, fmt.Errorf("failed to marshal dataset: %w", err)
+	}
+
+	now := time.Now()
+	run := &models.EvaluationRun{
+		ID:        uuid.New().String(),
+		Status:    models.EvaluationRunning,
+		Dataset:   string(data),
+		Total:     len(dataset.Items),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := j.db.InsertEvaluationRun(run); err != nil {
+		j.running.Store(false)
+		return nil, err
+	}
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.run(*run, dataset)
+	}()
+
+	logger.Info("Evaluation run started", zap.String("run_id", run.ID), zap.Int("items", run.Total))
+	return run, nil
+}
+
+// Wait blocks until the running evaluation, if any, has saved its result or
+// ctx is done. Cancel the lifecycle context first so the run stops early.
+func (j *Jobs) Wait(ctx context.Context) error {
+	return shutdown.Wait(ctx, &j.wg)
+}
+
+func (j *Jobs) Get(id string) (*models.EvaluationRun, bool, error) {
+	return j.db.GetEvaluationRun(id)
+}
+
+func (j *Jobs) validate(dataset *EvaluationDataset) error {
+	if dataset == nil || len(dataset.Items) == 0 {
+		return fmt.Errorf("%w: dataset has no items", ErrInvalidDataset)
+	}
+	if len(dataset.Items) > j.cfg.MaxDatasetItems {
+		return fmt.Errorf("%w: %d items, maximum is %d", ErrInvalidDataset, len(dataset.Items), j.cfg.MaxDatasetItems)
+	}
+	for i, item := range dataset.Items {
+		if strings.TrimSpace(item.Query) == "" {
+			return fmt.Errorf("%w: item %d has no query", ErrInvalidDataset, i)
+		}
+	}
+	return nil
+}
+
+func (j *Jobs) run(run models.EvaluationRun, dataset *EvaluationDataset) {
+	defer j.running.Store(false)
+
+	report, err := j.evaluator.RunDatasetEvaluation(j.lifecycle, dataset, EvaluationOptions{
+		Concurrency: j.cfg.Concurrency,
+		Detailed:    true,
+		OnProgress: func(progress EvaluationProgress) {
+			run.Completed = progress.Completed
+			run.Failed = progress.Failed
+			run.UpdatedAt = time.Now()
+			if err := j.db.UpdateEvaluationRun(&run); err != nil {
+				logger.Warn("Failed to save evaluation progress", zap.String("run_id", run.ID), zap.Error(err))
+			}
+		},
+	})
+
+	now := time.Now()
+	run.UpdatedAt = now
+	run.CompletedAt = &now
+	if err == nil {
+		var data []byte
+		data, err = json.Marshal(report)
+		run.Report = string(data)
+	}
+	if err == nil && j.lifecycle.Err() != nil {
+		err = j.lifecycle.Err()
+	}
+
+	if err != nil {
+		run.Status = models.EvaluationFailed
+		run.Error = err.Error()
+		logger.Error("Evaluation run failed", zap.String("run_id", run.ID), zap.Error(err))
+	} else {
+		run.Status = models.EvaluationCompleted
+		logger.Info("Evaluation run completed",
+			zap.String("run_id", run.ID),
+			zap.Int("completed", run.Completed),
+			zap.Int("failed", run.Failed),
+		)
+	}
+
+	if err := j.db.UpdateEvaluationRun(&run); err != nil {
+		logger.Error("Failed to save evaluation run", zap.String("run_id", run.ID), zap.Error(err))
+	}
+}
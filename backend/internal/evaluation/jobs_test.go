@@ -0,0 +1,119 @@
+package evaluation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+)
+
+func TestJobsLifecycle(t *testing.T) {
+	gate := make(chan struct{})
+	evaluator, db := newTestEvaluatorWithAnswer(t, func() string {
+		<-gate
+		return "Increase the function timeout."
+	})
+	jobs := NewJobs(context.Background(), db, evaluator, JobConfig{Concurrency: 2})
+
+	run, err := jobs.Start(testDataset(3))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if run.Status != models.EvaluationRunning || run.Total != 3 {
+		t.Errorf("started run = %+v, want running with 3 items", run)
+	}
+
+	stored, found, err := jobs.Get(run.ID)
+	if err != nil || !found || stored.Status != models.EvaluationRunning || stored.CompletedAt != nil {
+		t.Errorf("run while blocked = %+v, found %v, err %v; want it running", stored, found, err)
+	}
+	if _, err := jobs.Start(testDataset(1)); !errors.Is(err, ErrEvaluationRunning) {
+		t.Errorf("second Start err = %v, want ErrEvaluationRunning", err)
+	}
+
+	close(gate)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := jobs.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	done, _, err := jobs.Get(run.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if done.Status != models.EvaluationCompleted || done.Completed != 3 || done.CompletedAt == nil || done.Error != "" {
+		t.Fatalf("finished run = %+v, want completed with 3 items", done)
+	}
+	var report EvaluationReport
+	if err := json.Unmarshal([]byte(done.Report), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if report.TotalQueries != 3 || report.FullyRelevantCount != 3 {
+		t.Errorf("report = %+v, want 3 fully relevant queries", report)
+	}
+
+	// The stored dataset can be run again once the first run has finished.
+	dataset, err := jobs.Dataset(nil, run.ID)
+	if err != nil || len(dataset.Items) != 3 {
+		t.Fatalf("stored dataset = %v, %v; want its 3 items", dataset, err)
+	}
+	rerun, err := jobs.Start(dataset)
+	if err != nil {
+		t.Fatalf("rerun: %v", err)
+	}
+	if err := jobs.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if rerun.ID == run.ID {
+		t.Error("rerun reused the first run's id")
+	}
+}
+
+func TestJobsRejectInvalidDatasets(t *testing.T) {
+	evaluator, db := newTestEvaluator(t)
+	jobs := NewJobs(context.Background(), db, evaluator, JobConfig{MaxDatasetItems: 2})
+
+	blank := testDataset(1)
+	blank.Items[0].Query = "  "
+	for name, dataset := range map[string]*EvaluationDataset{
+		"empty":         {},
+		"too many":      testDataset(3),
+		"missing query": blank,
+	} {
+		if _, err := jobs.Start(dataset); !errors.Is(err, ErrInvalidDataset) {
+			t.Errorf("%s: err = %v, want ErrInvalidDataset", name, err)
+		}
+	}
+
+	if _, err := jobs.Dataset(json.RawMessage(`{"items": [`), ""); !errors.Is(err, ErrInvalidDataset) {
+		t.Errorf("malformed inline dataset err = %v, want ErrInvalidDataset", err)
+	}
+	if _, err := jobs.Dataset(nil, ""); !errors.Is(err, ErrInvalidDataset) {
+		t.Errorf("no dataset err = %v, want ErrInvalidDataset", err)
+	}
+	if _, err := jobs.Dataset(nil, "missing"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("unknown dataset run err = %v, want ErrRunNotFound", err)
+	}
+}
+
+func TestJobsRecoverInterrupted(t *testing.T) {
+	evaluator, db := newTestEvaluator(t)
+	jobs := NewJobs(context.Background(), db, evaluator, JobConfig{})
+
+	now := time.Now()
+	if err := db.InsertEvaluationRun(&models.EvaluationRun{ID: "stale", Status: models.EvaluationRunning, Dataset: "{}", Total: 4, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("insert run: %v", err)
+	}
+
+	if err := jobs.RecoverInterrupted(); err != nil {
+		t.Fatalf("RecoverInterrupted: %v", err)
+	}
+	run, _, err := jobs.Get("stale")
+	if err != nil || run.Status != models.EvaluationFailed || run.Error == "" {
+		t.Errorf("interrupted run = %+v, err %v; want it failed with a reason", run, err)
+	}
+}
@@ -0,0 +1,109 @@
+package ingestion
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	ContentTypeHTML     = "html"
+	ContentTypePDF      = "pdf"
+	ContentTypeMarkdown = "markdown"
+)
+
+var (
+	whitespacePattern    = regexp.MustCompile(`\s+`)
+	markdownImage        = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink         = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	markdownRefLink      = regexp.MustCompile(`(?m)^\s*\[[^\]]+\]:\s+\S+.*$`)
+	markdownHeading      = regexp.MustCompile(`(?m)^\s{0,3}#{1,6}\s+`)
+	markdownBlockquote   = regexp.MustCompile(`(?m)^\s*>\s?`)
+	markdownListMarker   = regexp.MustCompile(`(?m)^\s*(?:[-*+]|\d+[.)])\s+`)
+	markdownFence        = regexp.MustCompile("(?m)^\\s*(?:```|~~~).*$")
+	markdownRule         = regexp.MustCompile(`(?m)^\s*(?:[-*_]\s*){3,}$`)
+	markdownTableDivider = regexp.MustCompile(`(?m)^\s*\|?\s*:?-{3,}:?\s*(?:\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+	markdownEmphasis     = regexp.MustCompile(`(\*{1,3}|_{1,3})([^*_\n]+)(\*{1,3}|_{1,3})`)
+	markdownInlineCode   = regexp.MustCompile("`([^`]*)`")
+	markdownHTMLTag      = regexp.MustCompile(`</?[A-Za-z][^>]*>`)
+	markdownTitle        = regexp.MustCompile(`(?m)^\s{0,3}#\s+(.+?)\s*#*\s*$`)
+)
+
+// DetectContentType resolves the extractor for a document. A declared MIME
+// type or short name wins; otherwise the body is sniffed for the PDF magic
+// and the URL extension is checked. Anything else is treated as HTML.
+func DetectContentType(docURL, declared string, body []byte) string {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(declared, ";")[0]))
+	switch mediaType {
+	case "pdf", "application/pdf", "application/x-pdf":
+		return ContentTypePDF
+	case "markdown", "md", "text/markdown", "text/x-markdown":
+		return ContentTypeMarkdown
+	case "html", "text/html", "application/xhtml+xml":
+		return ContentTypeHTML
+	}
+
+	if bytes.HasPrefix(bytes.TrimLeft(body[:min(len(body), 1024)], " \t\r\n"), []byte("%PDF-")) {
+		return ContentTypePDF
+	}
+
+	if u, err := url.Parse(docURL); err == nil {
+		switch strings.ToLower(path.Ext(u.Path)) {
+		case ".pdf":
+			return ContentTypePDF
+		case ".md", ".markdown":
+			return ContentTypeMarkdown
+		}
+	}
+
+	return ContentTypeHTML
+}
+
+func (p *Processor) extractContent(contentType string, body []byte) (text, title string, err error) {
+	switch contentType {
+	case ContentTypePDF:
+		text, err = extractPDFText(body)
+		if err != nil {
+			return "", "", err
+		}
+		return text, "Untitled", nil
+	case ContentTypeMarkdown:
+		return cleanMarkdown(string(body)), markdownDocTitle(string(body)), nil
+	case ContentTypeHTML:
+		html := string(body)
+		return p.cleanHTML(html), p.extractTitle(html), nil
+	default:
+		return "", "", fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+// cleanMarkdown strips markup while keeping the text of links, emphasis and
+// code, since code blocks in AWS guides often carry the CLI commands users
+// search for.
+func cleanMarkdown(markdown string) string {
+	text := markdownFence.ReplaceAllString(markdown, "")
+	text = markdownRefLink.ReplaceAllString(text, "")
+	text = markdownImage.ReplaceAllString(text, "$1")
+	text = markdownLink.ReplaceAllString(text, "$1")
+	text = markdownTableDivider.ReplaceAllString(text, "")
+	text = markdownRule.ReplaceAllString(text, "")
+	text = markdownHeading.ReplaceAllString(text, "")
+	text = markdownBlockquote.ReplaceAllString(text, "")
+	text = markdownListMarker.ReplaceAllString(text, "")
+	text = markdownInlineCode.ReplaceAllString(text, "$1")
+	text = markdownEmphasis.ReplaceAllString(text, "$2")
+	text = markdownHTMLTag.ReplaceAllString(text, " ")
+	text = strings.ReplaceAll(text, "|", " ")
+
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+}
+
+func markdownDocTitle(markdown string) string {
+	if match := markdownTitle.FindStringSubmatch(markdown); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return "Untitled"
+}
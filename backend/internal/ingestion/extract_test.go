@@ -0,0 +1,115 @@
+package ingestion
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read fixture %s: %v", name, err)
+	}
+	return data
+}
+
+func TestExtractContentFixtures(t *testing.T) {
+	p := &Processor{}
+
+	tests := []struct {
+		fixture     string
+		contentType string
+		title       string
+		want        []string
+		unwanted    []string
+	}{
+		{
+			fixture:     "guide.html",
+			contentType: ContentTypeHTML,
+			title:       "Creating an Amazon S3 bucket",
+			want:        []string{"Creating a bucket", "choose Create bucket.", "Bucket names must be globally unique."},
+			unwanted:    []string{"AWS Documentation", "Home", "Related topics", "Terms of use", "analytics", "font-family"},
+		},
+		{
+			fixture:     "guide.md",
+			contentType: ContentTypeMarkdown,
+			title:       "Invoking a Lambda function",
+			want: []string{
+				"Use the AWS CLI to invoke a function:",
+				"aws lambda invoke --function-name my-function out.json",
+				"Note: the function must already exist.",
+				"Timeout 3 seconds",
+				"Check the StatusCode in the response.",
+				"Console screenshot",
+			},
+			unwanted: []string{"```", "https://", "#", "**", "---", "console.png"},
+		},
+		{
+			// The second page's content stream is compressed and its text
+			// contains the stream keywords.
+			fixture:     "simple.pdf",
+			contentType: ContentTypePDF,
+			title:       "Untitled",
+			want:        []string{"Amazon S3 stores objects in buckets.", "Lifecycle rules endstream stream expire old versions."},
+		},
+		{
+			// Glyph IDs in an Identity-H font only map to text through the
+			// ToUnicode CMap.
+			fixture:     "cid_tounicode.pdf",
+			contentType: ContentTypePDF,
+			title:       "Untitled",
+			want:        []string{"Lambda scales automatically"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			body := readFixture(t, tt.fixture)
+			if got := DetectContentType("https://docs.aws.amazon.com/"+tt.fixture, "", body); got != tt.contentType {
+				t.Fatalf("DetectContentType = %q, want %q", got, tt.contentType)
+			}
+
+			text, title, err := p.extractContent(tt.contentType, body)
+			if err != nil {
+				t.Fatalf("extractContent: %v", err)
+			}
+			if title != tt.title {
+				t.Errorf("title = %q, want %q", title, tt.title)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("text %q is missing %q", text, want)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(text, unwanted) {
+					t.Errorf("text %q contains %q", text, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractPDFTextWithoutText(t *testing.T) {
+	if _, err := extractPDFText(readFixture(t, "scanned.pdf")); !errors.Is(err, ErrPDFNoText) {
+		t.Errorf("scanned PDF err = %v, want ErrPDFNoText", err)
+	}
+}
+
+func TestExtractPDFTextRejectsInvalidDocuments(t *testing.T) {
+	tests := map[string][]byte{
+		"not a PDF": []byte("<html><body>hello</body></html>"),
+		"truncated": readFixture(t, "simple.pdf")[:200],
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := extractPDFText(data); err == nil || errors.Is(err, ErrPDFNoText) {
+				t.Errorf("err = %v, want a parse error", err)
+			}
+		})
+	}
+}
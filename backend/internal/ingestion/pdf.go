@@ -0,0 +1,54 @@
+package ingestion
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+var ErrPDFNoText = errors.New("no extractable text in PDF")
+
+const maxPDFTextBytes = 16 << 20
+
+// extractPDFText pulls the text out of every page of a PDF, decoding fonts
+// through their encodings and ToUnicode CMaps. Scanned PDFs yield
+// ErrPDFNoText.
+func extractPDFText(data []byte) (text string, err error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return "", fmt.Errorf("not a PDF document")
+	}
+
+	// The parser panics on some malformed documents rather than returning
+	// an error.
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("failed to parse PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse PDF: %w", err)
+	}
+
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return "", fmt.Errorf("failed to extract PDF text: %w", err)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(plain, maxPDFTextBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read PDF text: %w", err)
+	}
+
+	text = strings.TrimSpace(whitespacePattern.ReplaceAllString(string(raw), " "))
+	if text == "" {
+		return "", ErrPDFNoText
+	}
+
+	return text, nil
+}
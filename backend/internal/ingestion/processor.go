@@ -3,52 +3,231 @@ package ingestion
 import (
 	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"github.com/aws-agent/backend/internal/cache/redis"
 	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/metrics"
 	"github.com/aws-agent/backend/internal/storage/models"
 	"github.com/aws-agent/backend/internal/storage/sqlite"
 	"github.com/aws-agent/backend/internal/vector/zilliz"
 	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/utils"
 )
 
+// VectorStore is the part of the vector database the processor writes to.
+type VectorStore interface {
+	Insert(ctx context.Context, chunks []zilliz.DocumentChunk) error
+	InsertActive(ctx context.Context, chunks []zilliz.DocumentChunk) error
+	DeleteChunks(ctx context.Context, chunkIDs []string) error
+	DeleteByDocument(ctx context.Context, docID string) error
+	RecreateCollections(ctx context.Context) error
+}
+
 type Processor struct {
-	db          *sqlite.Client
-	vectorDB    *zilliz.Client
-	llmClient   *llm.Client
-	chunkSize   int
-	chunkOverlap int
+	db              *sqlite.Client
+	vectorDB        VectorStore
+	llmClient       *llm.Client
+	chunkSize       int
+	chunkOverlap    int
+	minContentChars int
+	maxContentBytes int
+	classifyDocType bool
+	docTypeCache    *redis.Client
+	queryCache      *redis.Client
+	docTypeCacheTTL time.Duration
+	dropBlankChunks bool
+	reindexMu       sync.Mutex
+}
+
+const (
+	defaultDocType = "documentation"
+
+	defaultChunkSize       = 1000
+	defaultChunkOverlap    = 100
+	defaultMaxContentBytes = 10 * 1024 * 1024
+	// maxChunkSize keeps chunks well inside the embedding model's input
+	// limit whatever a request asks for.
+	maxChunkSize = 8000
+	// maxLLMInputChars caps the cleaned text sent for summaries and doc type
+	// classification.
+	maxLLMInputChars = 4000
+)
+
+var (
+	ErrContentTooShort     = errors.New("document content too short")
+	ErrContentTooLarge     = errors.New("document content too large")
+	ErrNoUsableChunks      = errors.New("document produced no usable chunks")
+	ErrInvalidChunkOptions = errors.New("invalid chunk options")
+)
+
+type ProcessorConfig struct {
+	MinContentChars int
+	// ChunkSize and ChunkOverlap are in characters; the overlap must be
+	// smaller than the chunk size.
+	ChunkSize       int
+	ChunkOverlap    int
+	MaxContentBytes int
+}
+
+// ChunkOptions overrides the configured chunking for one document. Zero
+// fields keep the processor's defaults.
+type ChunkOptions struct {
+	Size    int
+	Overlap int
 }
 
-func NewProcessor(db *sqlite.Client, vectorDB *zilliz.Client, llmClient *llm.Client) *Processor {
+func NewProcessor(db *sqlite.Client, vectorDB VectorStore, llmClient *llm.Client, cfg ProcessorConfig) *Processor {
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = defaultChunkSize
+	}
+	if cfg.ChunkSize > maxChunkSize {
+		cfg.ChunkSize = maxChunkSize
+	}
+	if cfg.ChunkOverlap < 0 {
+		cfg.ChunkOverlap = defaultChunkOverlap
+	}
+	if cfg.ChunkOverlap >= cfg.ChunkSize {
+		logger.Warn("Chunk overlap must be smaller than the chunk size, using defaults",
+			zap.Int("chunk_size", cfg.ChunkSize),
+			zap.Int("chunk_overlap", cfg.ChunkOverlap),
+		)
+		cfg.ChunkSize = defaultChunkSize
+		cfg.ChunkOverlap = defaultChunkOverlap
+	}
+	if cfg.MaxContentBytes <= 0 {
+		cfg.MaxContentBytes = defaultMaxContentBytes
+	}
+
 	return &Processor{
-		db:           db,
-		vectorDB:     vectorDB,
-		llmClient:    llmClient,
-		chunkSize:    1000,
-		chunkOverlap: 100,
+		db:              db,
+		vectorDB:        vectorDB,
+		llmClient:       llmClient,
+		chunkSize:       cfg.ChunkSize,
+		chunkOverlap:    cfg.ChunkOverlap,
+		minContentChars: cfg.MinContentChars,
+		maxContentBytes: cfg.MaxContentBytes,
+		dropBlankChunks: true,
+	}
+}
+
+// ChunkOptions resolves per-request overrides against the configured
+// chunking, returning ErrInvalidChunkOptions for values it cannot use.
+func (p *Processor) ChunkOptions(overrides ChunkOptions) (ChunkOptions, error) {
+	opts := ChunkOptions{Size: p.chunkSize, Overlap: p.chunkOverlap}
+	if overrides.Size != 0 {
+		opts.Size = overrides.Size
+	}
+	if overrides.Overlap != 0 {
+		opts.Overlap = overrides.Overlap
+	}
+
+	if opts.Size <= 0 || opts.Size > maxChunkSize {
+		return opts, fmt.Errorf("%w: chunk size must be between 1 and %d", ErrInvalidChunkOptions, maxChunkSize)
+	}
+	if opts.Overlap < 0 || opts.Overlap >= opts.Size {
+		return opts, fmt.Errorf("%w: chunk overlap must be at least 0 and smaller than the chunk size (%d)", ErrInvalidChunkOptions, opts.Size)
+	}
+	return opts, nil
+}
+
+func (p *Processor) WithBlankChunkFilter(enabled bool) *Processor {
+	p.dropBlankChunks = enabled
+	return p
+}
+
+func (p *Processor) WithDocTypeClassification(cache *redis.Client, ttl time.Duration) *Processor {
+	p.classifyDocType = true
+	p.docTypeCache = cache
+	p.docTypeCacheTTL = ttl
+	return p
+}
+
+// WithQueryCache names the cache holding query answers, which are dropped
+// whenever a delete, refresh or reindex changes the corpus they came from.
+func (p *Processor) WithQueryCache(cache *redis.Client) *Processor {
+	p.queryCache = cache
+	return p
+}
+
+// invalidateQueryCache drops the cached and semantically indexed answers.
+// Failing to do so only leaves stale answers until their TTL, so it is
+// logged rather than returned.
+func (p *Processor) invalidateQueryCache(ctx context.Context) {
+	if p.queryCache == nil {
+		return
+	}
+	if err := p.queryCache.InvalidateDocumentCache(ctx); err != nil {
+		logger.Warn("Failed to invalidate query cache", zap.Error(err))
 	}
 }
 
 func (p *Processor) ProcessDocument(ctx context.Context, url, htmlContent string) error {
-	logger.Info("Processing document", zap.String("url", url))
+	return p.ProcessContent(ctx, url, ContentTypeHTML, []byte(htmlContent))
+}
+
+// ProcessContent ingests a document of the given content type, which may be a
+// MIME type, a short name (html, pdf, markdown) or empty to sniff the body.
+func (p *Processor) ProcessContent(ctx context.Context, url, contentType string, body []byte) error {
+	return p.ProcessContentWithOptions(ctx, url, contentType, body, ChunkOptions{})
+}
 
-	cleanedText := p.cleanHTML(htmlContent)
+// ProcessContentWithOptions is ProcessContent with per-document chunking
+// overrides.
+func (p *Processor) ProcessContentWithOptions(ctx context.Context, url, contentType string, body []byte, overrides ChunkOptions) error {
+	opts, err := p.ChunkOptions(overrides)
+	if err != nil {
+		return err
+	}
+	if len(body) > p.maxContentBytes {
+		return fmt.Errorf("%w: %d bytes, maximum is %d", ErrContentTooLarge, len(body), p.maxContentBytes)
+	}
+
+	contentType = DetectContentType(url, contentType, body)
+	logger.Info("Processing document", zap.String("url", url), zap.String("content_type", contentType))
+
+	cleanedText, title, err := p.extractContent(contentType, body)
+	if err != nil {
+		return fmt.Errorf("failed to extract %s content: %w", contentType, err)
+	}
 	if cleanedText == "" {
-		return fmt.Errorf("no content extracted from HTML")
+		return fmt.Errorf("no content extracted from %s", contentType)
+	}
+
+	if length := utf8.RuneCountInString(cleanedText); length < p.minContentChars {
+		return fmt.Errorf("%w: %d characters, minimum is %d", ErrContentTooShort, length, p.minContentChars)
 	}
 
+	chunks := chunkText(cleanedText, opts)
+	if p.dropBlankChunks {
+		chunks = dropBlankChunks(chunks)
+	}
+	if len(chunks) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoUsableChunks, url)
+	}
+	logger.Info("Document chunked",
+		zap.Int("chunks", len(chunks)),
+		zap.Int("chunk_size", opts.Size),
+		zap.Int("chunk_overlap", opts.Overlap),
+	)
+
 	awsService := p.extractAWSService(url)
 	docType := p.extractDocType(url)
+	if docType == defaultDocType && p.classifyDocType {
+		docType = p.classifyContent(ctx, cleanedText)
+	}
 
-	summary, err := p.llmClient.SummarizeDocument(ctx, cleanedText[:min(len(cleanedText), 4000)])
+	summary, err := p.llmClient.SummarizeDocument(ctx, utils.TruncateRunes(cleanedText, maxLLMInputChars))
 	if err != nil {
 		logger.Warn("Failed to summarize document", zap.Error(err))
 		summary = "Summary unavailable"
@@ -58,7 +237,7 @@ func (p *Processor) ProcessDocument(ctx context.Context, url, htmlContent string
 	doc := &models.Document{
 		ID:         docID,
 		URL:        url,
-		Title:      p.extractTitle(htmlContent),
+		Title:      title,
 		AWSService: awsService,
 		DocType:    docType,
 		Summary:    summary,
@@ -72,8 +251,11 @@ func (p *Processor) ProcessDocument(ctx context.Context, url, htmlContent string
 		return fmt.Errorf("failed to insert document: %w", err)
 	}
 
-	chunks := p.chunkText(cleanedText)
-	logger.Info("Document chunked", zap.Int("chunks", len(chunks)))
+	existingChunks, err := p.db.GetChunkTexts(docID)
+	if err != nil {
+		logger.Warn("Failed to load existing chunks", zap.String("doc_id", docID), zap.Error(err))
+		existingChunks = map[string]string{}
+	}
 
 	embeddings, err := p.llmClient.GenerateBatchEmbeddings(ctx, chunks)
 	if err != nil {
@@ -84,9 +266,24 @@ func (p *Processor) ProcessDocument(ctx context.Context, url, htmlContent string
 		return fmt.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(chunks))
 	}
 
+	if dim := p.llmClient.EmbeddingDim(); dim > 0 {
+		for i, embedding := range embeddings {
+			if len(embedding) != dim {
+				return fmt.Errorf("embedding dimension mismatch for chunk %d: got %d, expected %d", i, len(embedding), dim)
+			}
+		}
+	}
+
 	vectorChunks := make([]zilliz.DocumentChunk, 0, len(chunks))
+	changedChunks := 0
 	for i, chunkText := range chunks {
 		chunkID := fmt.Sprintf("%s_chunk_%d", docID, i)
+		if previous, ok := existingChunks[chunkID]; ok {
+			if previous != chunkText {
+				changedChunks++
+			}
+			delete(existingChunks, chunkID)
+		}
 		vectorChunk := zilliz.DocumentChunk{
 			ID:         chunkID,
 			Embedding:  embeddings[i],
@@ -117,6 +314,28 @@ func (p *Processor) ProcessDocument(ctx context.Context, url, htmlContent string
 		}
 	}
 
+	if len(existingChunks) > 0 {
+		staleIDs := make([]string, 0, len(existingChunks))
+		for chunkID := range existingChunks {
+			staleIDs = append(staleIDs, chunkID)
+		}
+
+		if err := p.vectorDB.DeleteChunks(ctx, staleIDs); err != nil {
+			return fmt.Errorf("failed to delete stale chunks from vector DB: %w", err)
+		}
+		for _, chunkID := range staleIDs {
+			p.db.DeleteChunk(chunkID)
+		}
+	}
+
+	if changedChunks > 0 || len(existingChunks) > 0 {
+		logger.Info("Replaced stale chunk embeddings",
+			zap.String("doc_id", docID),
+			zap.Int("changed", changedChunks),
+			zap.Int("removed", len(existingChunks)),
+		)
+	}
+
 	logger.Info("Document processed successfully",
 		zap.String("doc_id", docID),
 		zap.Int("chunks", len(vectorChunks)),
@@ -125,6 +344,27 @@ func (p *Processor) ProcessDocument(ctx context.Context, url, htmlContent string
 	return nil
 }
 
+func (p *Processor) DeleteDocument(ctx context.Context, docID string) error {
+	err := p.vectorDB.DeleteByDocument(ctx, docID)
+	if err != nil {
+		return fmt.Errorf("failed to delete document vectors: %w", err)
+	}
+
+	err = p.db.DeleteDocument(docID)
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	p.invalidateQueryCache(ctx)
+
+	logger.Info("Document deleted", zap.String("doc_id", docID))
+
+	return nil
+}
+
+func DocumentID(url string) string {
+	return generateID(url)
+}
+
 func (p *Processor) cleanHTML(html string) string {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
 	if err != nil {
@@ -163,16 +403,16 @@ func (p *Processor) extractTitle(html string) string {
 
 func (p *Processor) extractAWSService(url string) string {
 	serviceMap := map[string]string{
-		"ec2":      "EC2",
-		"s3":       "S3",
-		"lambda":   "Lambda",
-		"rds":      "RDS",
-		"dynamodb": "DynamoDB",
-		"vpc":      "VPC",
-		"iam":      "IAM",
+		"ec2":        "EC2",
+		"s3":         "S3",
+		"lambda":     "Lambda",
+		"rds":        "RDS",
+		"dynamodb":   "DynamoDB",
+		"vpc":        "VPC",
+		"iam":        "IAM",
 		"cloudwatch": "CloudWatch",
-		"eks":      "EKS",
-		"ecs":      "ECS",
+		"eks":        "EKS",
+		"ecs":        "ECS",
 	}
 
 	lowerURL := strings.ToLower(url)
@@ -201,10 +441,53 @@ func (p *Processor) extractDocType(url string) string {
 		return "tutorial"
 	}
 
-	return "documentation"
+	return defaultDocType
+}
+
+func (p *Processor) classifyContent(ctx context.Context, text string) string {
+	key := generateID(text)
+	if p.docTypeCache != nil {
+		cached, found, err := p.docTypeCache.GetDocType(ctx, key)
+		if err != nil {
+			logger.Warn("Doc type cache lookup failed", zap.Error(err))
+		}
+		if found {
+			metrics.CacheHits.WithLabelValues("doc_type").Inc()
+			return cached
+		}
+		metrics.CacheMisses.WithLabelValues("doc_type").Inc()
+	}
+
+	docType, err := p.llmClient.ClassifyDocType(ctx, utils.TruncateRunes(text, maxLLMInputChars))
+	if err != nil {
+		logger.Warn("Failed to classify document type", zap.Error(err))
+		return defaultDocType
+	}
+
+	if p.docTypeCache != nil {
+		if err := p.docTypeCache.SetDocType(ctx, key, docType, p.docTypeCacheTTL); err != nil {
+			logger.Warn("Failed to cache doc type", zap.Error(err))
+		}
+	}
+
+	return docType
+}
+
+func dropBlankChunks(chunks []string) []string {
+	usable := chunks[:0]
+	for _, chunk := range chunks {
+		if strings.TrimSpace(chunk) != "" {
+			usable = append(usable, chunk)
+		}
+	}
+
+	if dropped := len(chunks) - len(usable); dropped > 0 {
+		logger.Debug("Dropped blank chunks", zap.Int("dropped", dropped))
+	}
+	return usable
 }
 
-func (p *Processor) chunkText(text string) []string {
+func chunkText(text string, opts ChunkOptions) []string {
 	words := strings.Fields(text)
 	if len(words) == 0 {
 		return nil
@@ -217,11 +500,11 @@ func (p *Processor) chunkText(text string) []string {
 	for _, word := range words {
 		wordLen := len(word) + 1
 
-		if currentSize+wordLen > p.chunkSize && currentChunk.Len() > 0 {
+		if currentSize+wordLen > opts.Size && currentChunk.Len() > 0 {
 			chunks = append(chunks, currentChunk.String())
 
 			overlapWords := strings.Fields(currentChunk.String())
-			overlapStart := max(0, len(overlapWords)-p.chunkOverlap/10)
+			overlapStart := max(0, len(overlapWords)-opts.Overlap/10)
 			currentChunk.Reset()
 			currentChunk.WriteString(strings.Join(overlapWords[overlapStart:], " ") + " ")
 			currentSize = currentChunk.Len()
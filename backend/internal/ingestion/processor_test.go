@@ -0,0 +1,388 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+)
+
+// fakeVectorStore keeps chunks by ID with upsert semantics.
+type fakeVectorStore struct {
+	mu      sync.Mutex
+	chunks  map[string]zilliz.DocumentChunk
+	deleted []string
+	docs    []string
+}
+
+func newFakeVectorStore() *fakeVectorStore {
+	return &fakeVectorStore{chunks: make(map[string]zilliz.DocumentChunk)}
+}
+
+func (f *fakeVectorStore) Insert(ctx context.Context, chunks []zilliz.DocumentChunk) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, chunk := range chunks {
+		f.chunks[chunk.ID] = chunk
+	}
+	return nil
+}
+
+func (f *fakeVectorStore) InsertActive(ctx context.Context, chunks []zilliz.DocumentChunk) error {
+	return f.Insert(ctx, chunks)
+}
+
+func (f *fakeVectorStore) DeleteChunks(ctx context.Context, chunkIDs []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range chunkIDs {
+		delete(f.chunks, id)
+		f.deleted = append(f.deleted, id)
+	}
+	return nil
+}
+
+func (f *fakeVectorStore) DeleteByDocument(ctx context.Context, docID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.docs = append(f.docs, docID)
+
+	for id := range f.chunks {
+		if strings.HasPrefix(id, docID+"_chunk_") {
+			delete(f.chunks, id)
+		}
+	}
+	return nil
+}
+
+func (f *fakeVectorStore) RecreateCollections(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.chunks = make(map[string]zilliz.DocumentChunk)
+	return nil
+}
+
+func (f *fakeVectorStore) chunkIDs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]string, 0, len(f.chunks))
+	for id := range f.chunks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (f *fakeVectorStore) chunk(id string) zilliz.DocumentChunk {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.chunks[id]
+}
+
+func newTestDB(t *testing.T) *sqlite.Client {
+	t.Helper()
+
+	db, err := sqlite.NewClient(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+	return db
+}
+
+// words returns n distinct words starting with prefix.
+func words(prefix string, n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = prefix + string(rune('a'+i%26))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestReprocessReplacesChangedChunkEmbeddings(t *testing.T) {
+	const docURL = "https://docs.aws.amazon.com/lambda/latest/dg/guide.md"
+
+	provider := &llmtest.Provider{}
+	store := newFakeVectorStore()
+	p := NewProcessor(newTestDB(t), store, llmtest.NewClient(provider), ProcessorConfig{ChunkSize: 60, ChunkOverlap: 0})
+	ctx := context.Background()
+
+	// Three chunks of about 60 characters each.
+	original := words("alpha", 12) + " " + words("beta", 12) + " " + words("gamma", 12)
+	if err := p.ProcessContent(ctx, docURL, "text/markdown", []byte(original)); err != nil {
+		t.Fatalf("first process: %v", err)
+	}
+	ids := store.chunkIDs()
+	if len(ids) < 2 {
+		t.Fatalf("chunks = %v, want several", ids)
+	}
+	first := store.chunk(ids[0])
+
+	// The first chunk changes and the document shrinks.
+	changed := words("delta", 5)
+	if err := p.ProcessContent(ctx, docURL, "text/markdown", []byte(changed)); err != nil {
+		t.Fatalf("reprocess: %v", err)
+	}
+
+	replaced := store.chunk(ids[0])
+	if replaced.Text == first.Text {
+		t.Fatalf("chunk %s text was not replaced", ids[0])
+	}
+	if want := llmtest.HashEmbedding(replaced.Text); !reflect.DeepEqual(replaced.Embedding, want) {
+		t.Errorf("chunk %s embedding = %v, want the embedding of the new text", ids[0], replaced.Embedding)
+	}
+
+	embedded := false
+	for _, text := range provider.Embedded() {
+		if text == replaced.Text {
+			embedded = true
+		}
+	}
+	if !embedded {
+		t.Error("the changed chunk text was never embedded")
+	}
+
+	if got := store.chunkIDs(); !reflect.DeepEqual(got, ids[:1]) {
+		t.Errorf("chunks after reprocess = %v, want only %v", got, ids[:1])
+	}
+	sort.Strings(store.deleted)
+	if !reflect.DeepEqual(store.deleted, ids[1:]) {
+		t.Errorf("deleted = %v, want the stale chunks %v", store.deleted, ids[1:])
+	}
+}
+
+func TestDeleteDocumentRemovesChunksAndVectors(t *testing.T) {
+	const docURL = "https://docs.aws.amazon.com/lambda/latest/dg/guide.md"
+
+	db := newTestDB(t)
+	store := newFakeVectorStore()
+	p := NewProcessor(db, store, llmtest.NewClient(&llmtest.Provider{}), ProcessorConfig{ChunkSize: 60, ChunkOverlap: 0})
+	ctx := context.Background()
+
+	if err := p.ProcessContent(ctx, docURL, "text/markdown", []byte(words("alpha", 30))); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	// A second document must survive the delete.
+	other := "https://docs.aws.amazon.com/s3/latest/userguide/guide.md"
+	if err := p.ProcessContent(ctx, other, "text/markdown", []byte(words("omega", 5))); err != nil {
+		t.Fatalf("process other: %v", err)
+	}
+
+	docID := DocumentID(docURL)
+	if err := p.DeleteDocument(ctx, docID); err != nil {
+		t.Fatalf("DeleteDocument: %v", err)
+	}
+
+	if _, found, err := db.GetDocument(docID); err != nil || found {
+		t.Errorf("document found = %v, err %v; want it deleted", found, err)
+	}
+	chunks, err := db.GetChunkTexts(docID)
+	if err != nil || len(chunks) != 0 {
+		t.Errorf("chunk rows = %v, err %v; want the cascade to remove them", chunks, err)
+	}
+
+	if !reflect.DeepEqual(store.docs, []string{docID}) {
+		t.Errorf("vector deletes = %v, want %s", store.docs, docID)
+	}
+	for _, id := range store.chunkIDs() {
+		if strings.HasPrefix(id, docID) {
+			t.Errorf("vector %s survived the delete", id)
+		}
+	}
+	if otherChunks, _ := db.GetChunkTexts(DocumentID(other)); len(otherChunks) != 1 {
+		t.Errorf("other document chunks = %v, want it untouched", otherChunks)
+	}
+}
+
+func TestProcessContentRejectsShortDocuments(t *testing.T) {
+	provider := &llmtest.Provider{}
+	store := newFakeVectorStore()
+	p := NewProcessor(newTestDB(t), store, llmtest.NewClient(provider), ProcessorConfig{MinContentChars: 200})
+
+	err := p.ProcessContent(context.Background(), "https://docs.aws.amazon.com/lambda/latest/dg/moved.md",
+		"text/markdown", []byte("This page has moved."))
+	if !errors.Is(err, ErrContentTooShort) {
+		t.Fatalf("error = %v, want ErrContentTooShort", err)
+	}
+	if reqs := provider.Requests(); len(reqs) != 0 {
+		t.Errorf("LLM called %d times for a rejected document, want none", len(reqs))
+	}
+	if embedded := provider.Embedded(); len(embedded) != 0 {
+		t.Errorf("embedded %d texts for a rejected document, want none", len(embedded))
+	}
+	if ids := store.chunkIDs(); len(ids) != 0 {
+		t.Errorf("stored chunks %v for a rejected document", ids)
+	}
+}
+
+func TestProcessContentClassifiesGenericURLs(t *testing.T) {
+	const intro = "# Resolving invocation failures\n\nIf your function fails with Task timed out, " +
+		"check the CloudWatch logs for the error, increase the timeout, and retry the failed invocations. " +
+		"Common causes are slow downstream calls and missing VPC endpoints, which leave connections hanging " +
+		"until the function times out. Diagnose each failure before changing the configuration.\n\n"
+	content := intro + strings.Repeat("Überprüfen Sie die Protokolle. ", 200)
+
+	db := newTestDB(t)
+	cache, _ := redistest.NewClient(t)
+	provider := &llmtest.Provider{Reply: func(req llm.CompletionRequest) (string, error) {
+		if strings.Contains(req.SystemPrompt, "Classify the given AWS documentation") {
+			if utf8.RuneCountInString(req.UserPrompt) > maxLLMInputChars+100 {
+				t.Errorf("classification prompt has %d runes, want the content truncated", utf8.RuneCountInString(req.UserPrompt))
+			}
+			return "troubleshooting", nil
+		}
+		return "A summary.", nil
+	}}
+	p := NewProcessor(db, newFakeVectorStore(), llmtest.NewClient(provider), ProcessorConfig{}).
+		WithDocTypeClassification(cache, time.Hour)
+
+	urls := []string{
+		"https://docs.aws.amazon.com/lambda/latest/dg/invocation-failures.md",
+		"https://docs.aws.amazon.com/lambda/latest/dg/invocation-failures-copy.md",
+	}
+	for _, url := range urls {
+		if err := p.ProcessContent(context.Background(), url, "text/markdown", []byte(content)); err != nil {
+			t.Fatalf("ProcessContent(%s): %v", url, err)
+		}
+
+		doc, found, err := db.GetDocument(DocumentID(url))
+		if err != nil || !found {
+			t.Fatalf("get document: found %v, err %v", found, err)
+		}
+		if doc.DocType != "troubleshooting" {
+			t.Errorf("doc type of %s = %q, want troubleshooting", url, doc.DocType)
+		}
+	}
+
+	classifications := 0
+	for _, req := range provider.Requests() {
+		if strings.Contains(req.SystemPrompt, "Classify the given AWS documentation") {
+			classifications++
+		}
+	}
+	if classifications != 1 {
+		t.Errorf("classified %d times, want the second document served from the cache", classifications)
+	}
+}
+
+func TestDropBlankChunks(t *testing.T) {
+	chunks := []string{"Lambda timeouts ", " ", "\n\t ", "", "Raise the timeout "}
+
+	got := dropBlankChunks(append([]string(nil), chunks...))
+	want := []string{"Lambda timeouts ", "Raise the timeout "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dropBlankChunks() = %q, want %q", got, want)
+	}
+
+	if got := dropBlankChunks([]string{" ", "\n"}); len(got) != 0 {
+		t.Errorf("dropBlankChunks() = %q, want no usable chunks", got)
+	}
+}
+
+func TestChunkOptions(t *testing.T) {
+	p := NewProcessor(newTestDB(t), newFakeVectorStore(), llmtest.NewClient(&llmtest.Provider{}), ProcessorConfig{ChunkSize: 400, ChunkOverlap: 40})
+
+	tests := []struct {
+		name      string
+		overrides ChunkOptions
+		want      ChunkOptions
+		wantErr   bool
+	}{
+		{name: "configured values", want: ChunkOptions{Size: 400, Overlap: 40}},
+		{name: "size override", overrides: ChunkOptions{Size: 200}, want: ChunkOptions{Size: 200, Overlap: 40}},
+		{name: "both overridden", overrides: ChunkOptions{Size: 2000, Overlap: 300}, want: ChunkOptions{Size: 2000, Overlap: 300}},
+		{name: "overlap not below size", overrides: ChunkOptions{Size: 100, Overlap: 100}, wantErr: true},
+		{name: "overlap above configured size", overrides: ChunkOptions{Overlap: 500}, wantErr: true},
+		{name: "negative size", overrides: ChunkOptions{Size: -5}, wantErr: true},
+		{name: "size above maximum", overrides: ChunkOptions{Size: maxChunkSize + 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.ChunkOptions(tt.overrides)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidChunkOptions) {
+					t.Errorf("error = %v, want ErrInvalidChunkOptions", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ChunkOptions(%+v) = %+v, %v; want %+v", tt.overrides, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewProcessorChunkConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ProcessorConfig
+		want ChunkOptions
+	}{
+		{name: "default size without overlap", cfg: ProcessorConfig{}, want: ChunkOptions{Size: defaultChunkSize, Overlap: 0}},
+		{name: "configured", cfg: ProcessorConfig{ChunkSize: 300, ChunkOverlap: 30}, want: ChunkOptions{Size: 300, Overlap: 30}},
+		{name: "overlap not below size", cfg: ProcessorConfig{ChunkSize: 300, ChunkOverlap: 300}, want: ChunkOptions{Size: defaultChunkSize, Overlap: defaultChunkOverlap}},
+		{name: "size capped", cfg: ProcessorConfig{ChunkSize: maxChunkSize * 2, ChunkOverlap: 100}, want: ChunkOptions{Size: maxChunkSize, Overlap: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProcessor(newTestDB(t), newFakeVectorStore(), llmtest.NewClient(&llmtest.Provider{}), tt.cfg)
+			if got, err := p.ChunkOptions(ChunkOptions{}); err != nil || got != tt.want {
+				t.Errorf("chunking = %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessContentWithOptionsChunksBySize(t *testing.T) {
+	const docURL = "https://docs.aws.amazon.com/lambda/latest/dg/guide.md"
+	text := words("alpha", 26) + " " + words("beta", 26) + " " + words("gamma", 26) + " " + words("delta", 26)
+
+	chunkCount := func(cfg ProcessorConfig, overrides ChunkOptions) (int, int) {
+		t.Helper()
+		db := newTestDB(t)
+		store := newFakeVectorStore()
+		p := NewProcessor(db, store, llmtest.NewClient(&llmtest.Provider{}), cfg)
+		if err := p.ProcessContentWithOptions(context.Background(), docURL, "text/markdown", []byte(text), overrides); err != nil {
+			t.Fatalf("process: %v", err)
+		}
+		longest := 0
+		for _, id := range store.chunkIDs() {
+			longest = max(longest, len(store.chunk(id).Text))
+		}
+		return len(store.chunkIDs()), longest
+	}
+
+	large, _ := chunkCount(ProcessorConfig{ChunkSize: 2000}, ChunkOptions{})
+	small, longest := chunkCount(ProcessorConfig{ChunkSize: 2000}, ChunkOptions{Size: 200, Overlap: 20})
+	if large != 1 || small <= large {
+		t.Errorf("chunks = %d with the configured size and %d with a 200 character override, want 1 and more", large, small)
+	}
+	if longest > 200 {
+		t.Errorf("longest chunk = %d characters, want at most the 200 character override", longest)
+	}
+
+	p := NewProcessor(newTestDB(t), newFakeVectorStore(), llmtest.NewClient(&llmtest.Provider{}), ProcessorConfig{MaxContentBytes: 100})
+	if err := p.ProcessContent(context.Background(), docURL, "text/markdown", []byte(text)); !errors.Is(err, ErrContentTooLarge) {
+		t.Errorf("error = %v, want ErrContentTooLarge", err)
+	}
+	if err := p.ProcessContentWithOptions(context.Background(), docURL, "text/markdown", []byte(text), ChunkOptions{Size: 50, Overlap: 50}); !errors.Is(err, ErrInvalidChunkOptions) {
+		t.Errorf("error = %v, want ErrInvalidChunkOptions", err)
+	}
+}
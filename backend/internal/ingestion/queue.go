@@ -0,0 +1,184 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/netguard"
+)
+
+var ErrURLNotAllowed = errors.New("url is not in the allowed ingestion domains")
+
+type JobQueue struct {
+	processor      *Processor
+	httpClient     *http.Client
+	jobs           chan string
+	wg             sync.WaitGroup
+	ctx            context.Context
+	cancel         context.CancelFunc
+	maxFetchBytes  int64
+	allowedDomains []string
+	allowedPaths   []string
+	maxPages       int
+	active         atomic.Int32
+}
+
+type QueueConfig struct {
+	Workers         int
+	QueueSize       int
+	MaxFetchBytes   int64
+	AllowedDomains  []string
+	AllowedPaths    []string
+	MaxSitemapPages int
+}
+
+func NewJobQueue(processor *Processor, cfg QueueConfig) *JobQueue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 2
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.MaxFetchBytes <= 0 {
+		cfg.MaxFetchBytes = 10 * 1024 * 1024
+	}
+	if cfg.MaxSitemapPages <= 0 {
+		cfg.MaxSitemapPages = 500
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q := &JobQueue{
+		processor:      processor,
+		jobs:           make(chan string, cfg.QueueSize),
+		ctx:            ctx,
+		cancel:         cancel,
+		maxFetchBytes:  cfg.MaxFetchBytes,
+		allowedDomains: cfg.AllowedDomains,
+		allowedPaths:   cfg.AllowedPaths,
+		maxPages:       cfg.MaxSitemapPages,
+	}
+	q.httpClient = netguard.NewClient(netguard.Config{
+		Timeout:     30 * time.Second,
+		DialTimeout: 10 * time.Second,
+		Allowed:     q.isAllowedHost,
+	})
+
+	for i := 0; i < cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+
+	logger.Info("Ingestion job queue started",
+		zap.Int("workers", cfg.Workers),
+		zap.Int("queue_size", cfg.QueueSize),
+	)
+
+	return q
+}
+
+func (q *JobQueue) Enqueue(url string) error {
+	select {
+	case q.jobs <- url:
+		logger.Debug("Ingestion job enqueued", zap.String("url", url))
+		return nil
+	default:
+		return fmt.Errorf("ingestion queue is full")
+	}
+}
+
+func (q *JobQueue) EnqueueAllowed(url string) error {
+	if !q.isAllowedURL(url) {
+		return ErrURLNotAllowed
+	}
+
+	return q.Enqueue(url)
+}
+
+// Backlog is the number of queued plus in-flight ingestion jobs.
+func (q *JobQueue) Backlog() int {
+	return len(q.jobs) + int(q.active.Load())
+}
+
+func (q *JobQueue) Stop() {
+	q.cancel()
+	q.wg.Wait()
+}
+
+func (q *JobQueue) worker() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case url := <-q.jobs:
+			q.active.Add(1)
+			if err := q.fetchAndProcess(q.ctx, url); err != nil {
+				logger.Error("Ingestion job failed", zap.String("url", url), zap.Error(err))
+			}
+			q.active.Add(-1)
+		}
+	}
+}
+
+// Refresh re-ingests url in place. Nothing is removed up front: processing
+// upserts the new chunks and only then deletes the ones the new version no
+// longer has, so a failed fetch leaves the previous version searchable.
+// Answers cached from the previous version are dropped once it is replaced.
+func (q *JobQueue) Refresh(ctx context.Context, url string) error {
+	if err := q.fetchAndProcess(ctx, url); err != nil {
+		return err
+	}
+	q.processor.invalidateQueryCache(ctx)
+	return nil
+}
+
+func (q *JobQueue) fetchAndProcess(ctx context.Context, url string) error {
+	body, contentType, err := q.fetch(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	return q.processor.ProcessContent(ctx, url, contentType, body)
+}
+
+// fetch downloads rawURL through the guarded client. URLs off the domain
+// allowlist are refused before any request is made.
+func (q *JobQueue) fetch(ctx context.Context, rawURL string) ([]byte, string, error) {
+	if u, err := url.Parse(rawURL); err != nil || !q.isAllowedHost(u) {
+		return nil, "", fmt.Errorf("%w: %s", ErrURLNotAllowed, rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := q.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetch %s returned status %d", rawURL, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, q.maxFetchBytes))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", rawURL, err)
+	}
+
+	return body, resp.Header.Get("Content-Type"), nil
+}
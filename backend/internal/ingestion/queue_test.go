@@ -0,0 +1,109 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+)
+
+func TestRefreshFetchesBeforeReplacing(t *testing.T) {
+	body := words("alpha", 30)
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/markdown")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	db := newTestDB(t)
+	store := newFakeVectorStore()
+	q := newTestQueue([]string{"127.0.0.1"}, nil)
+	q.processor = NewProcessor(db, store, llmtest.NewClient(&llmtest.Provider{}), ProcessorConfig{ChunkSize: 60, ChunkOverlap: 0})
+	ctx := context.Background()
+	docURL := server.URL + "/guide.md"
+
+	if err := q.Refresh(ctx, docURL); err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	original := store.chunkIDs()
+
+	// A failed fetch leaves the indexed version in place.
+	status = http.StatusInternalServerError
+	if err := q.Refresh(ctx, docURL); err == nil {
+		t.Fatal("refresh succeeded although the fetch failed")
+	}
+	if got := store.chunkIDs(); !reflect.DeepEqual(got, original) {
+		t.Errorf("vectors after failed refresh = %v, want %v", got, original)
+	}
+	if chunks, _ := db.GetChunkTexts(DocumentID(docURL)); len(chunks) != len(original) {
+		t.Errorf("chunk rows after failed refresh = %d, want %d", len(chunks), len(original))
+	}
+	if len(store.docs) != 0 || len(store.deleted) != 0 {
+		t.Errorf("failed refresh deleted vectors: %v %v", store.docs, store.deleted)
+	}
+
+	// A successful fetch swaps in the new content.
+	status = http.StatusOK
+	body = words("delta", 5)
+	if err := q.Refresh(ctx, docURL); err != nil {
+		t.Fatalf("second refresh: %v", err)
+	}
+	if got := store.chunkIDs(); !reflect.DeepEqual(got, original[:1]) {
+		t.Errorf("vectors after refresh = %v, want %v", got, original[:1])
+	}
+	if text := store.chunk(original[0]).Text; !strings.Contains(text, "delta") {
+		t.Errorf("chunk text = %q, want the refreshed content", text)
+	}
+}
+
+func TestCorpusChangesInvalidateQueryCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/markdown")
+		fmt.Fprint(w, words("alpha", 30))
+	}))
+	defer server.Close()
+
+	cache, srv := redistest.NewClient(t)
+	q := newTestQueue([]string{"127.0.0.1"}, nil)
+	q.processor = NewProcessor(newTestDB(t), newFakeVectorStore(), llmtest.NewClient(&llmtest.Provider{}), ProcessorConfig{ChunkSize: 60, ChunkOverlap: 0}).
+		WithQueryCache(cache)
+	ctx := context.Background()
+	docURL := server.URL + "/guide.md"
+
+	cacheAnswer := func() {
+		t.Helper()
+		if err := cache.SetQuery(ctx, "q1", map[string]string{"response": "old"}, time.Hour); err != nil {
+			t.Fatalf("set query: %v", err)
+		}
+		if err := cache.AddSemanticQuery(ctx, "kb", "q1", []float32{1, 0}, time.Hour, 10); err != nil {
+			t.Fatalf("add semantic query: %v", err)
+		}
+	}
+	assertInvalidated := func(after string) {
+		t.Helper()
+		if keys := srv.Keys(); len(keys) != 0 {
+			t.Errorf("cache keys after %s = %v, want the query and semantic caches dropped", after, keys)
+		}
+	}
+
+	cacheAnswer()
+	if err := q.Refresh(ctx, docURL); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	assertInvalidated("refresh")
+
+	cacheAnswer()
+	if err := q.processor.DeleteDocument(ctx, DocumentID(docURL)); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	assertInvalidated("delete")
+}
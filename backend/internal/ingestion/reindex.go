@@ -0,0 +1,192 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+var ErrReindexInProgress = errors.New("reindex already in progress")
+
+const reindexPageSize = 50
+
+type ReindexResult struct {
+	EmbeddingModel string `json:"embedding_model"`
+	VectorDim      int    `json:"vector_dim"`
+	Documents      int    `json:"documents"`
+	Chunks         int    `json:"chunks"`
+	Resumed        bool   `json:"resumed"`
+	DurationMS     int64  `json:"duration_ms"`
+}
+
+// Reindex re-embeds every stored chunk with the current embedding model into
+// freshly created vector collections. Progress is saved after each document,
+// so a run interrupted with the same model resumes where it stopped unless
+// restart is set.
+func (p *Processor) Reindex(ctx context.Context, restart bool) (*ReindexResult, error) {
+	if !p.reindexMu.TryLock() {
+		return nil, ErrReindexInProgress
+	}
+	defer p.reindexMu.Unlock()
+
+	startTime := time.Now()
+	model, dim := p.llmClient.EmbeddingModel(), p.llmClient.EmbeddingDim()
+
+	state, found, err := p.db.GetReindexState()
+	if err != nil {
+		return nil, err
+	}
+
+	resumed := found && !restart && state.CompletedAt == nil &&
+		state.EmbeddingModel == model && state.VectorDim == dim
+	if resumed {
+		logger.Info("Resuming reindex",
+			zap.String("embedding_model", model),
+			zap.String("last_doc_id", state.LastDocID),
+			zap.Int("documents", state.Documents),
+			zap.Int("total_documents", state.TotalDocuments),
+		)
+	} else {
+		total, err := p.db.CountDocuments()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.vectorDB.RecreateCollections(ctx); err != nil {
+			return nil, fmt.Errorf("failed to recreate vector collections: %w", err)
+		}
+
+		now := time.Now()
+		state = &models.ReindexState{
+			EmbeddingModel: model,
+			VectorDim:      dim,
+			TotalDocuments: total,
+			StartedAt:      now,
+			UpdatedAt:      now,
+		}
+		if err := p.db.SaveReindexState(state); err != nil {
+			return nil, err
+		}
+
+		logger.Info("Reindex started",
+			zap.String("embedding_model", model),
+			zap.Int("vector_dim", dim),
+			zap.Int("total_documents", total),
+		)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("reindex interrupted after %d documents: %w", state.Documents, err)
+		}
+
+		docs, err := p.db.ListDocumentsAfter(state.LastDocID, reindexPageSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		for i := range docs {
+			chunks, err := p.reindexDocument(ctx, &docs[i])
+			if err != nil {
+				return nil, fmt.Errorf("failed to reindex document %s: %w", docs[i].ID, err)
+			}
+
+			state.LastDocID = docs[i].ID
+			state.Documents++
+			state.Chunks += chunks
+			state.UpdatedAt = time.Now()
+			if err := p.db.SaveReindexState(state); err != nil {
+				return nil, err
+			}
+		}
+
+		logger.Info("Reindex progress",
+			zap.Int("documents", state.Documents),
+			zap.Int("total_documents", state.TotalDocuments),
+			zap.Int("chunks", state.Chunks),
+		)
+	}
+
+	completedAt := time.Now()
+	state.CompletedAt = &completedAt
+	state.UpdatedAt = completedAt
+	if err := p.db.SaveReindexState(state); err != nil {
+		return nil, err
+	}
+	p.invalidateQueryCache(ctx)
+
+	result := &ReindexResult{
+		EmbeddingModel: model,
+		VectorDim:      dim,
+		Documents:      state.Documents,
+		Chunks:         state.Chunks,
+		Resumed:        resumed,
+		DurationMS:     time.Since(startTime).Milliseconds(),
+	}
+
+	logger.Info("Reindex completed",
+		zap.String("embedding_model", model),
+		zap.Int("documents", result.Documents),
+		zap.Int("chunks", result.Chunks),
+		zap.Int64("duration_ms", result.DurationMS),
+	)
+
+	return result, nil
+}
+
+func (p *Processor) reindexDocument(ctx context.Context, doc *models.Document) (int, error) {
+	chunks, err := p.db.GetDocumentChunks(doc.ID)
+	if err != nil {
+		return 0, err
+	}
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+
+	embeddings, err := p.llmClient.GenerateBatchEmbeddings(ctx, texts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+	if len(embeddings) != len(chunks) {
+		return 0, fmt.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(chunks))
+	}
+
+	dim := p.llmClient.EmbeddingDim()
+	vectorChunks := make([]zilliz.DocumentChunk, len(chunks))
+	for i, chunk := range chunks {
+		if dim > 0 && len(embeddings[i]) != dim {
+			return 0, fmt.Errorf("embedding dimension mismatch for chunk %d: got %d, expected %d", i, len(embeddings[i]), dim)
+		}
+		vectorChunks[i] = zilliz.DocumentChunk{
+			ID:         chunk.ID,
+			Embedding:  embeddings[i],
+			Text:       chunk.Text,
+			DocURL:     doc.URL,
+			AWSService: doc.AWSService,
+			DocType:    doc.DocType,
+			Summary:    doc.Summary,
+			Timestamp:  doc.UpdatedAt,
+		}
+	}
+
+	if err := p.vectorDB.InsertActive(ctx, vectorChunks); err != nil {
+		return 0, fmt.Errorf("failed to insert into vector DB: %w", err)
+	}
+
+	return len(chunks), nil
+}
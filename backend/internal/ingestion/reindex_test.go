@@ -0,0 +1,158 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+)
+
+// v2Embedding is a 4-dimensional embedding that differs from anything the
+// default fake embedder produces.
+func v2Embedding(text string) []float32 {
+	return []float32{float32(len(text)), 1, 2, 3}
+}
+
+func newV2Processor(db *sqlite.Client, store *fakeVectorStore, provider *llmtest.Provider) *Processor {
+	client := llm.NewClientWithProviders(llm.Config{
+		Model:          "fake-model",
+		EmbeddingModel: "fake-embedding-v2",
+		EmbeddingDim:   4,
+	}, provider, nil)
+	return NewProcessor(db, store, client, ProcessorConfig{ChunkSize: 60, ChunkOverlap: 0})
+}
+
+// ingestReindexFixtures processes three documents with the default fake
+// embedder and returns the stored chunk texts by document ID.
+func ingestReindexFixtures(t *testing.T, db *sqlite.Client, store *fakeVectorStore) map[string][]string {
+	t.Helper()
+
+	p := NewProcessor(db, store, llmtest.NewClient(&llmtest.Provider{}), ProcessorConfig{ChunkSize: 60, ChunkOverlap: 0})
+	texts := make(map[string][]string)
+	for _, doc := range []struct{ url, prefix string }{
+		{"https://docs.aws.amazon.com/lambda/latest/dg/guide.md", "alpha"},
+		{"https://docs.aws.amazon.com/s3/latest/userguide/guide.md", "beta"},
+		{"https://docs.aws.amazon.com/ec2/latest/userguide/guide.md", "gamma"},
+	} {
+		if err := p.ProcessContent(context.Background(), doc.url, "text/markdown", []byte(words(doc.prefix, 24))); err != nil {
+			t.Fatalf("process %s: %v", doc.url, err)
+		}
+		chunks, err := db.GetDocumentChunks(DocumentID(doc.url))
+		if err != nil {
+			t.Fatalf("get chunks: %v", err)
+		}
+		for _, chunk := range chunks {
+			texts[chunk.DocID] = append(texts[chunk.DocID], chunk.Text)
+		}
+	}
+	return texts
+}
+
+func TestReindexReembedsEveryChunk(t *testing.T) {
+	db := newTestDB(t)
+	store := newFakeVectorStore()
+	texts := ingestReindexFixtures(t, db, store)
+	before := store.chunkIDs()
+
+	provider := &llmtest.Provider{Embed: func(text string) ([]float32, error) { return v2Embedding(text), nil }}
+	result, err := newV2Processor(db, store, provider).Reindex(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Reindex: %v", err)
+	}
+
+	if result.EmbeddingModel != "fake-embedding-v2" || result.VectorDim != 4 || result.Resumed {
+		t.Errorf("result = %+v, want a fresh run with the new model", result)
+	}
+	if result.Documents != 3 || result.Chunks != len(before) {
+		t.Errorf("reindexed %d documents and %d chunks, want 3 and %d", result.Documents, result.Chunks, len(before))
+	}
+
+	if got := store.chunkIDs(); !reflect.DeepEqual(got, before) {
+		t.Fatalf("chunks after reindex = %v, want %v", got, before)
+	}
+	for _, id := range before {
+		chunk := store.chunk(id)
+		if want := v2Embedding(chunk.Text); !reflect.DeepEqual(chunk.Embedding, want) {
+			t.Errorf("chunk %s embedding = %v, want the new model's %v", id, chunk.Embedding, want)
+		}
+	}
+
+	var stored []string
+	for _, docTexts := range texts {
+		stored = append(stored, docTexts...)
+	}
+	embedded := provider.Embedded()
+	sort.Strings(stored)
+	sort.Strings(embedded)
+	if !reflect.DeepEqual(embedded, stored) {
+		t.Errorf("embedded %d texts, want each of the %d stored chunk texts once", len(embedded), len(stored))
+	}
+
+	state, found, err := db.GetReindexState()
+	if err != nil || !found || state.CompletedAt == nil {
+		t.Errorf("reindex state = %+v, found %v, err %v; want it completed", state, found, err)
+	}
+}
+
+func TestReindexResumesAfterFailure(t *testing.T) {
+	db := newTestDB(t)
+	store := newFakeVectorStore()
+	texts := ingestReindexFixtures(t, db, store)
+
+	docs, err := db.ListDocumentsAfter("", 10)
+	if err != nil || len(docs) != 3 {
+		t.Fatalf("documents = %v, err %v", docs, err)
+	}
+	last := docs[2].ID
+	failing := make(map[string]bool)
+	for _, text := range texts[last] {
+		failing[text] = true
+	}
+
+	errEmbed := errors.New("embedding unavailable")
+	provider := &llmtest.Provider{Embed: func(text string) ([]float32, error) {
+		if failing[text] {
+			return nil, errEmbed
+		}
+		return v2Embedding(text), nil
+	}}
+	if _, err := newV2Processor(db, store, provider).Reindex(context.Background(), false); !errors.Is(err, errEmbed) {
+		t.Fatalf("first run err = %v, want the embedding failure", err)
+	}
+
+	state, _, err := db.GetReindexState()
+	if err != nil {
+		t.Fatalf("get reindex state: %v", err)
+	}
+	if state.Documents != 2 || state.LastDocID != docs[1].ID || state.CompletedAt != nil {
+		t.Errorf("state after failure = %+v, want two documents saved", state)
+	}
+
+	failing = nil
+	provider = &llmtest.Provider{Embed: func(text string) ([]float32, error) { return v2Embedding(text), nil }}
+	result, err := newV2Processor(db, store, provider).Reindex(context.Background(), false)
+	if err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+	if !result.Resumed || result.Documents != 3 {
+		t.Errorf("result = %+v, want a resumed run covering all 3 documents", result)
+	}
+
+	embedded := provider.Embedded()
+	sort.Strings(embedded)
+	want := append([]string(nil), texts[last]...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(embedded, want) {
+		t.Errorf("resumed run embedded %v, want only the unfinished document's chunks %v", embedded, want)
+	}
+	for _, id := range store.chunkIDs() {
+		if chunk := store.chunk(id); len(chunk.Embedding) != 4 {
+			t.Errorf("chunk %s embedding has %d dimensions after resuming, want 4", id, len(chunk.Embedding))
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+func (q *JobQueue) EnqueueSitemap(ctx context.Context, sitemapURL string, maxPages int) ([]string, error) {
+	if maxPages <= 0 || maxPages > q.maxPages {
+		maxPages = q.maxPages
+	}
+
+	pages, err := q.collectSitemapURLs(ctx, sitemapURL, maxPages, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	enqueued := make([]string, 0, len(pages))
+	for _, page := range pages {
+		if err := q.Enqueue(page); err != nil {
+			logger.Warn("Stopping sitemap enqueue", zap.String("url", page), zap.Error(err))
+			break
+		}
+		enqueued = append(enqueued, page)
+	}
+
+	logger.Info("Sitemap enqueued for ingestion",
+		zap.String("sitemap", sitemapURL),
+		zap.Int("found", len(pages)),
+		zap.Int("enqueued", len(enqueued)),
+	)
+
+	return enqueued, nil
+}
+
+func (q *JobQueue) collectSitemapURLs(ctx context.Context, sitemapURL string, maxPages, depth int) ([]string, error) {
+	body, _, err := q.fetch(ctx, sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc sitemapDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap: %w", err)
+	}
+
+	var pages []string
+	for _, u := range doc.URLs {
+		if len(pages) >= maxPages {
+			return pages, nil
+		}
+		loc := strings.TrimSpace(u.Loc)
+		if q.isAllowedURL(loc) {
+			pages = append(pages, loc)
+		}
+	}
+
+	if depth > 0 {
+		return pages, nil
+	}
+
+	for _, sm := range doc.Sitemaps {
+		if len(pages) >= maxPages {
+			break
+		}
+
+		nested, err := q.collectSitemapURLs(ctx, strings.TrimSpace(sm.Loc), maxPages-len(pages), depth+1)
+		if err != nil {
+			logger.Warn("Failed to read nested sitemap", zap.String("sitemap", sm.Loc), zap.Error(err))
+			continue
+		}
+		pages = append(pages, nested...)
+	}
+
+	return pages, nil
+}
+
+// isAllowedURL reports whether a page may be ingested: its host must pass
+// isAllowedHost and its path start with one of the allowed paths, if any
+// are configured.
+func (q *JobQueue) isAllowedURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || !q.isAllowedHost(u) {
+		return false
+	}
+
+	if len(q.allowedPaths) > 0 {
+		for _, prefix := range q.allowedPaths {
+			if strings.HasPrefix(u.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// isAllowedHost reports whether u is http(s) on an allowed domain or one of
+// its subdomains. Every fetch, sitemaps and redirects included, must pass
+// it; an empty allowlist admits nothing.
+func (q *JobQueue) isAllowedHost(u *url.URL) bool {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range q.allowedDomains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws-agent/backend/pkg/netguard"
+)
+
+// newTestQueue returns a queue without workers, so enqueued URLs stay in
+// q.jobs for the test to read.
+func newTestQueue(domains, paths []string) *JobQueue {
+	return &JobQueue{
+		httpClient:     &http.Client{Timeout: 5 * time.Second},
+		jobs:           make(chan string, 100),
+		maxFetchBytes:  1 << 20,
+		allowedDomains: domains,
+		allowedPaths:   paths,
+		maxPages:       500,
+	}
+}
+
+func drain(q *JobQueue) []string {
+	var urls []string
+	for {
+		select {
+		case u := <-q.jobs:
+			urls = append(urls, u)
+		default:
+			return urls
+		}
+	}
+}
+
+// sitemapServer serves a sitemap index pointing at one nested sitemap on
+// the same host and one on a host outside the allowlist.
+func sitemapServer(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	var base string
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%s/lambda/sitemap.xml</loc></sitemap>
+  <sitemap><loc>http://metadata.internal/sitemap.xml</loc></sitemap>
+</sitemapindex>`, base)
+	})
+	mux.HandleFunc("/lambda/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/lambda/latest/dg/welcome.html</loc></url>
+  <url><loc> %[1]s/lambda/latest/dg/limits.html </loc></url>
+  <url><loc>%[1]s/s3/latest/userguide/Welcome.html</loc></url>
+  <url><loc>https://example.com/lambda/other.html</loc></url>
+  <url><loc>ftp://%[2]s/lambda/file.html</loc></url>
+</urlset>`, base, r.Host)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	base = srv.URL
+	return srv
+}
+
+func TestEnqueueSitemap(t *testing.T) {
+	var requests atomic.Int32
+	srv := sitemapServer(t, &requests)
+
+	q := newTestQueue([]string{"127.0.0.1"}, []string{"/lambda/"})
+
+	enqueued, err := q.EnqueueSitemap(context.Background(), srv.URL+"/sitemap.xml", 0)
+	if err != nil {
+		t.Fatalf("EnqueueSitemap: %v", err)
+	}
+
+	want := []string{
+		srv.URL + "/lambda/latest/dg/welcome.html",
+		srv.URL + "/lambda/latest/dg/limits.html",
+	}
+	if !reflect.DeepEqual(enqueued, want) {
+		t.Errorf("enqueued = %v, want %v", enqueued, want)
+	}
+	if got := drain(q); !reflect.DeepEqual(got, want) {
+		t.Errorf("queued jobs = %v, want %v", got, want)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("sitemap requests = %d, want 2", requests.Load())
+	}
+}
+
+func TestEnqueueSitemapMaxPages(t *testing.T) {
+	var requests atomic.Int32
+	srv := sitemapServer(t, &requests)
+
+	q := newTestQueue([]string{"127.0.0.1"}, nil)
+
+	enqueued, err := q.EnqueueSitemap(context.Background(), srv.URL+"/sitemap.xml", 2)
+	if err != nil {
+		t.Fatalf("EnqueueSitemap: %v", err)
+	}
+	if len(enqueued) != 2 {
+		t.Errorf("enqueued %d pages, want the cap of 2: %v", len(enqueued), enqueued)
+	}
+}
+
+func TestEnqueueSitemapRefusesDisallowedHost(t *testing.T) {
+	var requests atomic.Int32
+	srv := sitemapServer(t, &requests)
+
+	for name, domains := range map[string][]string{
+		"off allowlist":   {"docs.aws.amazon.com"},
+		"empty allowlist": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			q := newTestQueue(domains, nil)
+
+			_, err := q.EnqueueSitemap(context.Background(), srv.URL+"/sitemap.xml", 0)
+			if !errors.Is(err, ErrURLNotAllowed) {
+				t.Errorf("error = %v, want ErrURLNotAllowed", err)
+			}
+		})
+	}
+	if requests.Load() != 0 {
+		t.Errorf("server received %d requests, want none", requests.Load())
+	}
+}
+
+func TestEnqueueSitemapRefusesPrivateAddress(t *testing.T) {
+	var requests atomic.Int32
+	srv := sitemapServer(t, &requests)
+
+	q := newTestQueue([]string{"127.0.0.1"}, nil)
+	q.httpClient = netguard.NewClient(netguard.Config{
+		Timeout: 5 * time.Second,
+		Allowed: q.isAllowedHost,
+	})
+
+	_, err := q.EnqueueSitemap(context.Background(), srv.URL+"/sitemap.xml", 0)
+	if !errors.Is(err, netguard.ErrBlockedAddress) {
+		t.Errorf("error = %v, want ErrBlockedAddress", err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("server received %d requests, want none", requests.Load())
+	}
+}
+
+func TestFetchRefusesRedirectOffAllowlist(t *testing.T) {
+	var redirected atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			redirected.Add(1)
+			return
+		}
+		// Same server, addressed by an IP the allowlist does not name.
+		u, _ := url.Parse("http://" + r.Host)
+		http.Redirect(w, r, "http://127.0.0.1:"+u.Port()+"/internal", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	q := newTestQueue([]string{"localhost"}, nil)
+	q.httpClient.CheckRedirect = netguard.NewClient(netguard.Config{Allowed: q.isAllowedHost}).CheckRedirect
+
+	_, _, err := q.fetch(context.Background(), "http://localhost:"+u.Port()+"/page")
+	if !errors.Is(err, netguard.ErrRedirectNotAllowed) {
+		t.Errorf("error = %v, want ErrRedirectNotAllowed", err)
+	}
+	if redirected.Load() != 0 {
+		t.Error("redirect target was fetched")
+	}
+}
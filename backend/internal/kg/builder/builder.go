@@ -3,33 +3,112 @@ package builder
 import (
 	"context"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 
 	"github.com/aws-agent/backend/internal/kg/neo4j"
 	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/metrics"
 	"github.com/aws-agent/backend/internal/storage/models"
 	"github.com/aws-agent/backend/internal/storage/sqlite"
 	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/tokenizer"
+	"github.com/aws-agent/backend/pkg/utils"
 )
 
+// GraphStore is the part of the Neo4j client the builder writes through,
+// so builds can run against an in-memory graph in tests.
+type GraphStore interface {
+	CreateEntity(ctx context.Context, entity *neo4j.Entity) error
+	CreateEntitiesBatch(ctx context.Context, entities []neo4j.Entity) error
+	CreateRelationsBatch(ctx context.Context, relations []neo4j.Relation) (int, error)
+	GetEntityByName(ctx context.Context, name string) (*neo4j.Entity, error)
+	AddAlias(ctx context.Context, entityID, alias string) error
+	ExistingEntityIDs(ctx context.Context, ids []string) (map[string]bool, error)
+	ExistingRelations(ctx context.Context, relations []neo4j.Relation) ([]bool, error)
+}
+
 type Builder struct {
 	db        *sqlite.Client
-	kgClient  *neo4j.Client
+	kgClient  GraphStore
 	llmClient *llm.Client
+	cfg       Config
+}
+
+const (
+	placeholderSummary     = "Summary unavailable"
+	maxEntityFallbackChars = 4000
+	autoCreatedEntityType  = "unverified"
+)
+
+type Config struct {
+	SeedConceptsPath     string
+	ReplaceSeedConcepts  bool
+	MaxRelationsPerDoc   int
+	AutoCreateEntities   bool
+	AutoCreateConfidence float64
+	MaxKnownEntities     int
+	MaxExtractionTokens  int
+	WriteBatchSize       int
+	EntityMergeEnabled   bool
+	// EntityMergeThreshold is the cosine similarity between entity name
+	// embeddings at which a new entity becomes an alias of an existing one.
+	EntityMergeThreshold float64
+}
+
+type seedConceptEntry struct {
+	Name        string `yaml:"name"`
+	Type        string `yaml:"type"`
+	Description string `yaml:"description"`
 }
 
-func NewBuilder(db *sqlite.Client, kgClient *neo4j.Client, llmClient *llm.Client) *Builder {
+var validEntityTypes = map[string]bool{
+	"service":   true,
+	"error":     true,
+	"resource":  true,
+	"operation": true,
+	"concept":   true,
+}
+
+func NewBuilder(db *sqlite.Client, kgClient GraphStore, llmClient *llm.Client, cfg Config) *Builder {
+	if cfg.AutoCreateConfidence <= 0 {
+		cfg.AutoCreateConfidence = 0.3
+	}
+	if cfg.MaxKnownEntities <= 0 {
+		cfg.MaxKnownEntities = 500
+	}
+	if cfg.MaxExtractionTokens <= 0 {
+		cfg.MaxExtractionTokens = 1500
+	}
+	if cfg.WriteBatchSize <= 0 {
+		cfg.WriteBatchSize = 100
+	}
+	if cfg.EntityMergeThreshold <= 0 || cfg.EntityMergeThreshold > 1 {
+		cfg.EntityMergeThreshold = 0.95
+	}
+
 	return &Builder{
 		db:        db,
 		kgClient:  kgClient,
 		llmClient: llmClient,
+		cfg:       cfg,
 	}
 }
 
-func (b *Builder) BuildFromDocument(ctx context.Context, doc *models.Document) error {
+type BuildResult struct {
+	NewEntities         int
+	MergedEntities      int
+	NewRelations        int
+	AutoCreatedEntities int
+}
+
+func (b *Builder) BuildFromDocument(ctx context.Context, doc *models.Document) (*BuildResult, error) {
 	logger.Info("Building KG from document", zap.String("doc_id", doc.ID))
 
 	seedConcepts, err := b.db.GetSeedConcepts()
@@ -48,17 +127,27 @@ func (b *Builder) BuildFromDocument(ctx context.Context, doc *models.Document) e
 		knownEntities = append(knownEntities, concept.Name)
 	}
 
-	newEntities, err := b.llmClient.ExtractEntities(ctx, doc.Summary, knownEntities)
+	promptEntities := limitKnownEntities(knownEntities, b.cfg.MaxKnownEntities)
+	if len(promptEntities) < len(knownEntities) {
+		logger.Debug("Capped known entities for extraction",
+			zap.Int("known", len(knownEntities)),
+			zap.Int("sent", len(promptEntities)),
+		)
+	}
+
+	newEntities, err := b.llmClient.ExtractEntities(ctx, entityExtractionText(doc), promptEntities)
 	if err != nil {
-		return fmt.Errorf("failed to extract entities: %w", err)
+		return nil, fmt.Errorf("failed to extract entities: %w", err)
 	}
 
 	logger.Info("Entities extracted", zap.Int("count", len(newEntities)))
 
 	uniqueEntities := b.deduplicateEntities(newEntities, knownEntities)
+	uniqueEntities, merges := b.mergeNearDuplicates(ctx, uniqueEntities, promptEntities)
 
+	kgEntities := make([]neo4j.Entity, 0, min(len(uniqueEntities), b.cfg.WriteBatchSize))
 	for _, entityExt := range uniqueEntities {
-		entityID := uuid.New().String()
+		entityID := stableEntityID(entityExt.Type, entityExt.Name)
 		entity := &models.KGEntity{
 			ID:              entityID,
 			Name:            entityExt.Name,
@@ -76,75 +165,228 @@ func (b *Builder) BuildFromDocument(ctx context.Context, doc *models.Document) e
 			continue
 		}
 
-		kgEntity := &neo4j.Entity{
+		kgEntities = append(kgEntities, neo4j.Entity{
 			ID:            entityID,
 			Name:          entity.Name,
 			Type:          entity.Type,
 			CanonicalName: entity.CanonicalName,
-		}
-		err = b.kgClient.CreateEntity(ctx, kgEntity)
-		if err != nil {
-			logger.Error("Failed to create entity in Neo4j", zap.Error(err))
+			Aliases:       entity.Aliases,
+		})
+		if len(kgEntities) >= b.cfg.WriteBatchSize {
+			b.flushEntities(ctx, kgEntities)
+			kgEntities = kgEntities[:0]
 		}
 	}
+	b.flushEntities(ctx, kgEntities)
+
+	mergedEntities := b.applyEntityMerges(ctx, doc.ID, merges)
 
 	allEntityNames := append(knownEntities, extractNames(uniqueEntities)...)
-	relations, err := b.llmClient.ExtractRelations(ctx, doc.RawContent[:min(len(doc.RawContent), 5000)], allEntityNames)
+	for _, merge := range merges {
+		allEntityNames = append(allEntityNames, merge.Name)
+	}
+	relations, err := b.llmClient.ExtractRelations(ctx, tokenizer.Truncate(doc.RawContent, b.cfg.MaxExtractionTokens), allEntityNames)
 	if err != nil {
-		return fmt.Errorf("failed to extract relations: %w", err)
+		return nil, fmt.Errorf("failed to extract relations: %w", err)
 	}
 
 	logger.Info("Relations extracted", zap.Int("count", len(relations)))
 
-	for _, rel := range relations {
-		if rel.Confidence < 0.6 {
-			continue
-		}
+	relations = filterRelations(relations, 0.6)
+	if b.cfg.MaxRelationsPerDoc > 0 && len(relations) > b.cfg.MaxRelationsPerDoc {
+		logger.Info("Capping relations for document",
+			zap.String("doc_id", doc.ID),
+			zap.Int("extracted", len(relations)),
+			zap.Int("max", b.cfg.MaxRelationsPerDoc),
+		)
+		relations = topRelations(relations, b.cfg.MaxRelationsPerDoc)
+	}
 
-		subjectEntity, err := b.kgClient.GetEntityByName(ctx, rel.Subject)
+	autoCreated := 0
+	createdRelations := 0
+	pending := make([]pendingRelation, 0, min(len(relations), b.cfg.WriteBatchSize))
+	for _, rel := range relations {
+		subjectEntity, created, err := b.resolveEntity(ctx, rel.Subject)
 		if err != nil {
-			logger.Debug("Subject entity not found", zap.String("subject", rel.Subject))
+			logger.Debug("Subject entity not found", zap.String("subject", rel.Subject), zap.Error(err))
 			continue
 		}
+		if created {
+			autoCreated++
+		}
 
-		objectEntity, err := b.kgClient.GetEntityByName(ctx, rel.Object)
+		objectEntity, created, err := b.resolveEntity(ctx, rel.Object)
 		if err != nil {
-			logger.Debug("Object entity not found", zap.String("object", rel.Object))
+			logger.Debug("Object entity not found", zap.String("object", rel.Object), zap.Error(err))
 			continue
 		}
-
-		relation := &neo4j.Relation{
-			Subject:    subjectEntity.ID,
-			Predicate:  rel.Predicate,
-			Object:     objectEntity.ID,
-			Confidence: rel.Confidence,
-			SourceDocs: []string{doc.URL},
+		if created {
+			autoCreated++
 		}
 
-		err = b.kgClient.CreateRelation(ctx, relation)
-		if err != nil {
-			logger.Error("Failed to create relation in Neo4j", zap.Error(err))
-			continue
+		pending = append(pending, pendingRelation{
+			kg: neo4j.Relation{
+				Subject:    subjectEntity.ID,
+				Predicate:  rel.Predicate,
+				Object:     objectEntity.ID,
+				Confidence: rel.Confidence,
+				SourceDocs: []string{doc.URL},
+			},
+			db: models.KGRelation{
+				SubjectID:   subjectEntity.ID,
+				Predicate:   rel.Predicate,
+				ObjectID:    objectEntity.ID,
+				Confidence:  rel.Confidence,
+				SourceDocID: doc.ID,
+				CreatedAt:   time.Now(),
+			},
+		})
+		if len(pending) >= b.cfg.WriteBatchSize {
+			createdRelations += b.flushRelations(ctx, pending)
+			pending = pending[:0]
 		}
+	}
+	createdRelations += b.flushRelations(ctx, pending)
 
-		dbRelation := &models.KGRelation{
-			SubjectID:   subjectEntity.ID,
-			Predicate:   rel.Predicate,
-			ObjectID:    objectEntity.ID,
-			Confidence:  rel.Confidence,
-			SourceDocID: doc.ID,
-			CreatedAt:   time.Now(),
-		}
-		b.db.InsertKGRelation(dbRelation)
+	result := &BuildResult{
+		NewEntities:         len(uniqueEntities),
+		MergedEntities:      mergedEntities,
+		NewRelations:        createdRelations,
+		AutoCreatedEntities: autoCreated,
 	}
 
 	logger.Info("KG built from document",
 		zap.String("doc_id", doc.ID),
-		zap.Int("new_entities", len(uniqueEntities)),
-		zap.Int("new_relations", len(relations)),
+		zap.Int("new_entities", result.NewEntities),
+		zap.Int("merged_entities", result.MergedEntities),
+		zap.Int("new_relations", result.NewRelations),
+		zap.Int("auto_created_entities", result.AutoCreatedEntities),
 	)
 
-	return nil
+	return result, nil
+}
+
+// limitKnownEntities dedupes names case-insensitively and keeps the first limit.
+// Entity names arrive ordered by occurrence_count, so the cap keeps the most
+// frequently seen entities; the full list is still used for deduplication.
+func limitKnownEntities(names []string, limit int) []string {
+	seen := make(map[string]bool, len(names))
+	limited := make([]string, 0, min(len(names), limit))
+	for _, name := range names {
+		if len(limited) >= limit {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		limited = append(limited, name)
+	}
+	return limited
+}
+
+// AddAlias records a synonym for an entity in both stores so that lookups by
+// the alias resolve to it.
+func (b *Builder) AddAlias(ctx context.Context, entityID, alias string) error {
+	alias = strings.TrimSpace(alias)
+	if alias == "" {
+		return fmt.Errorf("alias must not be empty")
+	}
+
+	found, err := b.db.AddKGEntityAlias(entityID, alias)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", neo4j.ErrEntityNotFound, entityID)
+	}
+
+	return b.kgClient.AddAlias(ctx, entityID, alias)
+}
+
+// pendingRelation pairs a graph relation with its SQLite record, which is
+// only written once the graph batch containing it has been committed.
+type pendingRelation struct {
+	kg neo4j.Relation
+	db models.KGRelation
+}
+
+func (b *Builder) flushEntities(ctx context.Context, entities []neo4j.Entity) {
+	if len(entities) == 0 {
+		return
+	}
+	if err := b.kgClient.CreateEntitiesBatch(ctx, entities); err != nil {
+		logger.Error("Failed to create entities in Neo4j", zap.Int("count", len(entities)), zap.Error(err))
+	}
+}
+
+func (b *Builder) flushRelations(ctx context.Context, pending []pendingRelation) int {
+	if len(pending) == 0 {
+		return 0
+	}
+
+	relations := make([]neo4j.Relation, len(pending))
+	for i, relation := range pending {
+		relations[i] = relation.kg
+	}
+
+	created, err := b.kgClient.CreateRelationsBatch(ctx, relations)
+	if err != nil {
+		logger.Error("Failed to create relations in Neo4j", zap.Int("count", len(relations)), zap.Error(err))
+		return 0
+	}
+
+	for i := range pending {
+		if err := b.db.InsertKGRelation(&pending[i].db); err != nil {
+			logger.Warn("Failed to insert relation to SQLite", zap.Error(err))
+		}
+	}
+	return created
+}
+
+func (b *Builder) resolveEntity(ctx context.Context, name string) (*neo4j.Entity, bool, error) {
+	entity, err := b.kgClient.GetEntityByName(ctx, name)
+	if err == nil {
+		return entity, false, nil
+	}
+	if !b.cfg.AutoCreateEntities || strings.TrimSpace(name) == "" {
+		return nil, false, err
+	}
+
+	entityID := stableEntityID(autoCreatedEntityType, name)
+	err = b.db.InsertKGEntity(&models.KGEntity{
+		ID:              entityID,
+		Name:            name,
+		Type:            autoCreatedEntityType,
+		CanonicalName:   name,
+		Aliases:         []string{},
+		FirstSeen:       time.Now(),
+		LastUpdated:     time.Now(),
+		OccurrenceCount: 1,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to insert auto-created entity: %w", err)
+	}
+
+	entity = &neo4j.Entity{
+		ID:            entityID,
+		Name:          name,
+		Type:          autoCreatedEntityType,
+		CanonicalName: name,
+		Properties: map[string]interface{}{
+			"auto_created": true,
+			"confidence":   b.cfg.AutoCreateConfidence,
+		},
+	}
+	if err := b.kgClient.CreateEntity(ctx, entity); err != nil {
+		return nil, false, fmt.Errorf("failed to create auto-created entity: %w", err)
+	}
+
+	metrics.KGEntitiesAutoCreated.Inc()
+	logger.Info("Auto-created missing relation endpoint", zap.String("name", name), zap.String("entity_id", entityID))
+
+	return entity, true, nil
 }
 
 func (b *Builder) InitializeSeedConcepts() error {
@@ -162,6 +404,25 @@ func (b *Builder) InitializeSeedConcepts() error {
 		{ID: uuid.New().String(), Name: "InvalidParameter", Type: "error", Description: "Invalid parameter error", CreatedAt: time.Now()},
 	}
 
+	if b.cfg.SeedConceptsPath != "" {
+		fileSeeds, err := loadSeedConcepts(b.cfg.SeedConceptsPath)
+		if err != nil {
+			return err
+		}
+
+		if b.cfg.ReplaceSeedConcepts {
+			seeds = fileSeeds
+		} else {
+			seeds = mergeSeedConcepts(seeds, fileSeeds)
+		}
+
+		logger.Info("Seed concepts loaded from file",
+			zap.String("path", b.cfg.SeedConceptsPath),
+			zap.Int("count", len(fileSeeds)),
+			zap.Bool("replace_defaults", b.cfg.ReplaceSeedConcepts),
+		)
+	}
+
 	for _, seed := range seeds {
 		err := b.db.InsertSeedConcept(&seed)
 		if err != nil {
@@ -173,6 +434,57 @@ func (b *Builder) InitializeSeedConcepts() error {
 	return nil
 }
 
+func loadSeedConcepts(path string) ([]models.SeedConcept, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed concepts file: %w", err)
+	}
+
+	var entries []seedConceptEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse seed concepts file: %w", err)
+	}
+
+	seeds := make([]models.SeedConcept, 0, len(entries))
+	for i, entry := range entries {
+		name := strings.TrimSpace(entry.Name)
+		entryType := strings.ToLower(strings.TrimSpace(entry.Type))
+
+		if name == "" {
+			return nil, fmt.Errorf("seed concept %d: name is required", i)
+		}
+		if !validEntityTypes[entryType] {
+			return nil, fmt.Errorf("seed concept %q: invalid type %q", name, entry.Type)
+		}
+
+		seeds = append(seeds, models.SeedConcept{
+			ID:          uuid.New().String(),
+			Name:        name,
+			Type:        entryType,
+			Description: entry.Description,
+			CreatedAt:   time.Now(),
+		})
+	}
+
+	return seeds, nil
+}
+
+func mergeSeedConcepts(defaults, extra []models.SeedConcept) []models.SeedConcept {
+	merged := make([]models.SeedConcept, 0, len(defaults)+len(extra))
+	index := make(map[string]int)
+
+	for _, seed := range append(defaults, extra...) {
+		if i, ok := index[seed.Name]; ok {
+			merged[i] = seed
+			continue
+		}
+		index[seed.Name] = len(merged)
+		merged = append(merged, seed)
+	}
+
+	return merged
+}
+
 func (b *Builder) deduplicateEntities(newEntities []llm.EntityExtraction, knownNames []string) []llm.EntityExtraction {
 	unique := []llm.EntityExtraction{}
 	knownSet := make(map[string]bool)
@@ -191,6 +503,47 @@ func (b *Builder) deduplicateEntities(newEntities []llm.EntityExtraction, knownN
 	return unique
 }
 
+// stableEntityID derives a stable ID from the normalized entity type and name
+// so concurrent ingestions of the same entity upsert one row instead of
+// creating duplicates, while same-named entities of different types (the
+// Lambda service and a Lambda concept) stay apart.
+func stableEntityID(entityType, name string) string {
+	normalizedType := strings.ToLower(strings.TrimSpace(entityType))
+	normalized := strings.ToLower(strings.Join(strings.Fields(name), " "))
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("aws-agent:entity:"+normalizedType+":"+normalized)).String()
+}
+
+func entityExtractionText(doc *models.Document) string {
+	summary := strings.TrimSpace(doc.Summary)
+	if summary != "" && summary != placeholderSummary {
+		return summary
+	}
+
+	logger.Info("Document summary missing, extracting entities from raw content", zap.String("doc_id", doc.ID))
+	return utils.TruncateRunes(doc.RawContent, maxEntityFallbackChars)
+}
+
+func filterRelations(relations []llm.RelationExtraction, minConfidence float64) []llm.RelationExtraction {
+	filtered := make([]llm.RelationExtraction, 0, len(relations))
+	for _, rel := range relations {
+		if rel.Confidence >= minConfidence {
+			filtered = append(filtered, rel)
+		}
+	}
+	return filtered
+}
+
+func topRelations(relations []llm.RelationExtraction, limit int) []llm.RelationExtraction {
+	sorted := make([]llm.RelationExtraction, len(relations))
+	copy(sorted, relations)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Confidence > sorted[j].Confidence
+	})
+
+	return sorted[:limit]
+}
+
 func extractNames(entities []llm.EntityExtraction) []string {
 	names := make([]string, len(entities))
 	for i, e := range entities {
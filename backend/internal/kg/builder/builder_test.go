@@ -0,0 +1,445 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+)
+
+func newTestDB(t *testing.T) *sqlite.Client {
+	t.Helper()
+
+	db, err := sqlite.NewClient(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+	return db
+}
+
+func writeSeedFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "seeds.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write seed file: %v", err)
+	}
+	return path
+}
+
+func seedTypes(t *testing.T, db *sqlite.Client) map[string]string {
+	t.Helper()
+
+	seeds, err := db.GetSeedConcepts()
+	if err != nil {
+		t.Fatalf("get seed concepts: %v", err)
+	}
+	types := make(map[string]string, len(seeds))
+	for _, seed := range seeds {
+		types[seed.Name] = seed.Type
+	}
+	return types
+}
+
+const seedFile = `
+- name: Aurora
+  type: Service
+  description: Amazon Aurora
+- name: ThrottlingException
+  type: error
+- name: Lambda
+  type: resource
+`
+
+func TestInitializeSeedConceptsFromFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace bool
+		want    map[string]string
+		absent  []string
+	}{
+		{
+			name: "merged with defaults",
+			want: map[string]string{
+				"Aurora":              "service",
+				"ThrottlingException": "error",
+				"Lambda":              "resource",
+				"S3":                  "service",
+			},
+		},
+		{
+			name:    "replacing defaults",
+			replace: true,
+			want: map[string]string{
+				"Aurora":              "service",
+				"ThrottlingException": "error",
+				"Lambda":              "resource",
+			},
+			absent: []string{"S3", "timeout"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			b := NewBuilder(db, nil, nil, Config{
+				SeedConceptsPath:    writeSeedFile(t, seedFile),
+				ReplaceSeedConcepts: tt.replace,
+			})
+
+			if err := b.InitializeSeedConcepts(); err != nil {
+				t.Fatalf("InitializeSeedConcepts: %v", err)
+			}
+
+			types := seedTypes(t, db)
+			for name, typ := range tt.want {
+				if types[name] != typ {
+					t.Errorf("seed %q has type %q, want %q", name, types[name], typ)
+				}
+			}
+			for _, name := range tt.absent {
+				if _, ok := types[name]; ok {
+					t.Errorf("seed %q was inserted, want defaults replaced", name)
+				}
+			}
+		})
+	}
+}
+
+func TestInitializeSeedConceptsRejectsInvalidEntries(t *testing.T) {
+	tests := map[string]string{
+		"unknown type": "- name: Aurora\n  type: database\n",
+		"missing name": "- type: service\n",
+		"not a list":   "name: Aurora\n",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := newTestDB(t)
+			b := NewBuilder(db, nil, nil, Config{SeedConceptsPath: writeSeedFile(t, content)})
+
+			err := b.InitializeSeedConcepts()
+			if err == nil || !strings.Contains(err.Error(), "seed concept") {
+				t.Errorf("error = %v, want a seed concept error", err)
+			}
+			if types := seedTypes(t, db); len(types) != 0 {
+				t.Errorf("inserted %d seeds from an invalid file, want none", len(types))
+			}
+		})
+	}
+}
+
+// extractionReplies answers the entity prompt with entities, but only when
+// the prompt text contains marker, and every relation prompt with relations.
+func extractionReplies(marker, entities, relations string) func(llm.CompletionRequest) (string, error) {
+	return func(req llm.CompletionRequest) (string, error) {
+		switch {
+		case strings.Contains(req.SystemPrompt, "Extract entities"):
+			if strings.Contains(req.UserPrompt, marker) {
+				return entities, nil
+			}
+			return "[]", nil
+		case strings.Contains(req.SystemPrompt, "Extract relationships"):
+			return relations, nil
+		}
+		return "ok", nil
+	}
+}
+
+func TestBuildFromDocumentWithoutSummary(t *testing.T) {
+	for _, summary := range []string{"", placeholderSummary} {
+		t.Run("summary "+summary, func(t *testing.T) {
+			db := newTestDB(t)
+			graph := newFakeGraph()
+			provider := &llmtest.Provider{Reply: extractionReplies("SnapStart",
+				`[{"name": "SnapStart", "type": "concept", "confidence": 0.9}]`, "[]")}
+			b := NewBuilder(db, graph, llmtest.NewClient(provider), Config{})
+
+			result, err := b.BuildFromDocument(context.Background(), &models.Document{
+				ID:         "doc-1",
+				URL:        "https://docs.aws.amazon.com/lambda/latest/dg/snapstart.html",
+				Summary:    summary,
+				RawContent: "Lambda SnapStart reduces cold start latency for Java functions.",
+			})
+			if err != nil {
+				t.Fatalf("BuildFromDocument: %v", err)
+			}
+
+			if result.NewEntities != 1 {
+				t.Errorf("NewEntities = %d, want 1", result.NewEntities)
+			}
+			if !graph.entityNames()["snapstart"] {
+				t.Errorf("graph entities = %v, want SnapStart extracted from the raw content", graph.entityNames())
+			}
+		})
+	}
+}
+
+func TestBuildFromDocumentCapsRelations(t *testing.T) {
+	db := newTestDB(t)
+	graph := newFakeGraph()
+	provider := &llmtest.Provider{Reply: extractionReplies("Lambda",
+		`[{"name": "Lambda", "type": "service", "confidence": 0.9},
+		  {"name": "VPC", "type": "service", "confidence": 0.9},
+		  {"name": "CloudWatch", "type": "service", "confidence": 0.9},
+		  {"name": "IAM", "type": "service", "confidence": 0.9}]`,
+		`[{"subject": "Lambda", "predicate": "USES", "object": "VPC", "confidence": 0.7},
+		  {"subject": "CloudWatch", "predicate": "MONITORS", "object": "Lambda", "confidence": 0.95},
+		  {"subject": "Lambda", "predicate": "REQUIRES", "object": "IAM", "confidence": 0.9},
+		  {"subject": "VPC", "predicate": "USES", "object": "IAM", "confidence": 0.65},
+		  {"subject": "IAM", "predicate": "CONFIGURES", "object": "CloudWatch", "confidence": 0.5}]`)}
+	b := NewBuilder(db, graph, llmtest.NewClient(provider), Config{MaxRelationsPerDoc: 2})
+
+	result, err := b.BuildFromDocument(context.Background(), &models.Document{
+		ID:         "doc-1",
+		URL:        "https://docs.aws.amazon.com/lambda/latest/dg/vpc.html",
+		Summary:    "Lambda networking",
+		RawContent: "Lambda functions in a VPC need IAM permissions and log to CloudWatch.",
+	})
+	if err != nil {
+		t.Fatalf("BuildFromDocument: %v", err)
+	}
+
+	if result.NewRelations != 2 {
+		t.Errorf("NewRelations = %d, want the cap of 2", result.NewRelations)
+	}
+
+	predicates := make(map[string]float64)
+	for _, relation := range graph.relations {
+		predicates[relation.Predicate] = relation.Confidence
+	}
+	want := map[string]float64{"MONITORS": 0.95, "REQUIRES": 0.9}
+	if !reflect.DeepEqual(predicates, want) {
+		t.Errorf("stored relations = %v, want the two most confident %v", predicates, want)
+	}
+}
+
+func TestEntityExtractionTextTruncatesByRunes(t *testing.T) {
+	doc := &models.Document{ID: "doc-1", RawContent: strings.Repeat("é", maxEntityFallbackChars+10)}
+
+	text := entityExtractionText(doc)
+	if !utf8.ValidString(text) {
+		t.Fatal("fallback text is not valid UTF-8")
+	}
+	if n := utf8.RuneCountInString(text); n != maxEntityFallbackChars {
+		t.Errorf("fallback text has %d runes, want %d", n, maxEntityFallbackChars)
+	}
+}
+
+func TestBuildFromDocumentAutoCreatesRelationEndpoints(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(map[bool]string{true: "enabled", false: "disabled"}[enabled], func(t *testing.T) {
+			db := newTestDB(t)
+			graph := newFakeGraph()
+			provider := &llmtest.Provider{Reply: extractionReplies("Lambda",
+				`[{"name": "Lambda", "type": "service", "confidence": 0.9}]`,
+				`[{"subject": "Lambda", "predicate": "USES", "object": "Provisioned Concurrency", "confidence": 0.9}]`)}
+			b := NewBuilder(db, graph, llmtest.NewClient(provider), Config{AutoCreateEntities: enabled})
+
+			result, err := b.BuildFromDocument(context.Background(), &models.Document{
+				ID:         "doc-1",
+				URL:        "https://docs.aws.amazon.com/lambda/latest/dg/provisioned-concurrency.html",
+				Summary:    "Lambda scaling",
+				RawContent: "Lambda functions use provisioned concurrency to avoid cold starts.",
+			})
+			if err != nil {
+				t.Fatalf("BuildFromDocument: %v", err)
+			}
+
+			wantCreated, wantRelations := 0, 0
+			if enabled {
+				wantCreated, wantRelations = 1, 1
+			}
+			if result.AutoCreatedEntities != wantCreated || result.NewRelations != wantRelations {
+				t.Errorf("auto-created %d entities and %d relations, want %d and %d",
+					result.AutoCreatedEntities, result.NewRelations, wantCreated, wantRelations)
+			}
+			if graph.entityNames()["provisioned concurrency"] != enabled {
+				t.Errorf("graph entities = %v, want the missing endpoint created: %v", graph.entityNames(), enabled)
+			}
+			if !enabled {
+				return
+			}
+
+			created, err := graph.GetEntityByName(context.Background(), "Provisioned Concurrency")
+			if err != nil {
+				t.Fatalf("get auto-created entity: %v", err)
+			}
+			if created.Type != autoCreatedEntityType {
+				t.Errorf("auto-created entity type = %q, want %q", created.Type, autoCreatedEntityType)
+			}
+			if _, ok := graph.relations[relationKey(neo4j.Relation{Subject: stableEntityID("service", "Lambda"), Predicate: "USES", Object: created.ID})]; !ok {
+				t.Errorf("relations = %v, want Lambda USES the auto-created entity", graph.relations)
+			}
+		})
+	}
+}
+
+func TestStableEntityIDSeparatesTypes(t *testing.T) {
+	if stableEntityID("service", "AWS  Lambda") != stableEntityID("Service", "aws lambda") {
+		t.Error("IDs differ for the same entity written with different case and spacing")
+	}
+	if stableEntityID("service", "Lambda") == stableEntityID("concept", "Lambda") {
+		t.Error("a service and a concept with the same name share an ID")
+	}
+}
+
+func TestConcurrentEntityInsertsCountEveryOccurrence(t *testing.T) {
+	db := newTestDB(t)
+	id := stableEntityID("service", "Lambda")
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- db.InsertKGEntity(&models.KGEntity{
+				ID:              id,
+				Name:            "Lambda",
+				Type:            "service",
+				CanonicalName:   "Lambda",
+				FirstSeen:       time.Now(),
+				LastUpdated:     time.Now(),
+				OccurrenceCount: 1,
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	entities, err := db.GetKGEntities("service")
+	if err != nil {
+		t.Fatalf("get entities: %v", err)
+	}
+	if len(entities) != 1 || entities[0].OccurrenceCount != writers {
+		t.Errorf("entities = %+v, want one row counting %d occurrences", entities, writers)
+	}
+}
+
+func TestBuildFromDocumentCapsKnownEntities(t *testing.T) {
+	db := newTestDB(t)
+	for i := 1; i <= 30; i++ {
+		name := fmt.Sprintf("Entity%02d", i)
+		err := db.InsertKGEntity(&models.KGEntity{
+			ID:              stableEntityID("concept", name),
+			Name:            name,
+			Type:            "concept",
+			CanonicalName:   name,
+			FirstSeen:       time.Now(),
+			LastUpdated:     time.Now(),
+			OccurrenceCount: i,
+		})
+		if err != nil {
+			t.Fatalf("insert entity: %v", err)
+		}
+	}
+
+	provider := &llmtest.Provider{Reply: extractionReplies("", "[]", "[]")}
+	b := NewBuilder(db, newFakeGraph(), llmtest.NewClient(provider), Config{MaxKnownEntities: 5})
+
+	if _, err := b.BuildFromDocument(context.Background(), &models.Document{
+		ID:         "doc-1",
+		URL:        "https://docs.aws.amazon.com/lambda/latest/dg/welcome.html",
+		Summary:    "What is Lambda",
+		RawContent: "Lambda runs code without provisioning servers.",
+	}); err != nil {
+		t.Fatalf("BuildFromDocument: %v", err)
+	}
+
+	var prompt string
+	for _, req := range provider.Requests() {
+		if strings.Contains(req.SystemPrompt, "Extract entities") {
+			prompt = req.UserPrompt
+		}
+	}
+	known := strings.SplitN(strings.TrimPrefix(prompt, "Known entities: "), "\n", 2)[0]
+	if got := strings.Split(known, ", "); !reflect.DeepEqual(got, []string{"Entity30", "Entity29", "Entity28", "Entity27", "Entity26"}) {
+		t.Errorf("known entities sent = %q, want the 5 most frequent", got)
+	}
+}
+
+func TestBuildFromDocumentResolvesRelationEndpointsByAlias(t *testing.T) {
+	db := newTestDB(t)
+	graph := newFakeGraph()
+	ctx := context.Background()
+
+	s3 := &models.KGEntity{
+		ID:            stableEntityID("service", "Simple Storage Service"),
+		Name:          "Simple Storage Service",
+		Type:          "service",
+		CanonicalName: "Simple Storage Service",
+		Aliases:       []string{},
+		FirstSeen:     time.Now(),
+		LastUpdated:   time.Now(),
+	}
+	if err := db.InsertKGEntity(s3); err != nil {
+		t.Fatalf("insert entity: %v", err)
+	}
+	graph.CreateEntity(ctx, &neo4j.Entity{ID: s3.ID, Name: s3.Name, Type: s3.Type, CanonicalName: s3.CanonicalName})
+
+	provider := &llmtest.Provider{Reply: extractionReplies("Lambda",
+		`[{"name": "Lambda", "type": "service", "confidence": 0.9}]`,
+		`[{"subject": "Lambda", "predicate": "USES", "object": "S3", "confidence": 0.9}]`)}
+	b := NewBuilder(db, graph, llmtest.NewClient(provider), Config{})
+
+	if err := b.AddAlias(ctx, s3.ID, " S3 "); err != nil {
+		t.Fatalf("AddAlias: %v", err)
+	}
+	if err := b.AddAlias(ctx, "missing", "S3"); !errors.Is(err, neo4j.ErrEntityNotFound) {
+		t.Errorf("AddAlias on a missing entity = %v, want ErrEntityNotFound", err)
+	}
+
+	stored, err := db.GetKGEntities("service")
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("stored entities = %v, %v; want the aliased entity", stored, err)
+	}
+	if !reflect.DeepEqual(stored[0].Aliases, []string{"S3"}) {
+		t.Errorf("stored aliases = %v, want [S3]", stored[0].Aliases)
+	}
+
+	resolved, err := graph.GetEntityByName(ctx, "S3")
+	if err != nil || resolved.ID != s3.ID {
+		t.Fatalf("lookup by alias = %v, %v; want %s", resolved, err, s3.Name)
+	}
+
+	result, err := b.BuildFromDocument(ctx, &models.Document{
+		ID:         "doc-1",
+		URL:        "https://docs.aws.amazon.com/lambda/latest/dg/with-s3.html",
+		Summary:    "Lambda with S3",
+		RawContent: "Lambda functions read objects from S3 buckets.",
+	})
+	if err != nil {
+		t.Fatalf("BuildFromDocument: %v", err)
+	}
+	if result.NewRelations != 1 || result.AutoCreatedEntities != 0 {
+		t.Errorf("created %d relations and auto-created %d entities, want 1 and 0", result.NewRelations, result.AutoCreatedEntities)
+	}
+	key := relationKey(neo4j.Relation{Subject: stableEntityID("service", "Lambda"), Predicate: "USES", Object: s3.ID})
+	if _, ok := graph.relations[key]; !ok {
+		t.Errorf("relations = %v, want Lambda USES the aliased entity", graph.relations)
+	}
+}
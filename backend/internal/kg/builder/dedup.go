@@ -0,0 +1,118 @@
+package builder
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/utils"
+)
+
+// entityMerge records a new entity folded into an existing one as an alias.
+type entityMerge struct {
+	Name       string
+	Into       string
+	Similarity float64
+}
+
+// mergeNearDuplicates embeds the names of the new entities and the known
+// entities and drops every new entity whose closest match scores at or above
+// the merge threshold, returning it as a merge to apply once the kept
+// entities exist. Any embedding failure keeps all entities.
+func (b *Builder) mergeNearDuplicates(ctx context.Context, entities []llm.EntityExtraction, knownNames []string) ([]llm.EntityExtraction, []entityMerge) {
+	if !b.cfg.EntityMergeEnabled || len(entities) == 0 {
+		return entities, nil
+	}
+
+	names := append(extractNames(entities), knownNames...)
+	embeddings, err := b.llmClient.GenerateBatchEmbeddings(ctx, names)
+	if err != nil || len(embeddings) != len(names) {
+		logger.Warn("Failed to embed entity names, skipping near-duplicate merge", zap.Error(err))
+		return entities, nil
+	}
+
+	matches := matchNearDuplicates(names[:len(entities)], embeddings[:len(entities)],
+		knownNames, embeddings[len(entities):], b.cfg.EntityMergeThreshold)
+
+	kept := make([]llm.EntityExtraction, 0, len(entities))
+	var merges []entityMerge
+	for i, entity := range entities {
+		if matches[i] == nil {
+			kept = append(kept, entity)
+			continue
+		}
+		merges = append(merges, *matches[i])
+	}
+
+	return kept, merges
+}
+
+// matchNearDuplicates returns, for each new name, the most similar known name
+// or earlier kept new name when the cosine similarity reaches threshold, and
+// nil otherwise. Merged names are not themselves merge targets, so chains
+// cannot drift away from the entity they started at.
+func matchNearDuplicates(newNames []string, newEmbeddings [][]float32, knownNames []string, knownEmbeddings [][]float32, threshold float64) []*entityMerge {
+	matches := make([]*entityMerge, len(newNames))
+
+	for i, embedding := range newEmbeddings {
+		best := entityMerge{Name: newNames[i]}
+		for j, candidate := range knownEmbeddings {
+			if similarity := utils.CosineSimilarity(embedding, candidate); similarity > best.Similarity {
+				best.Into, best.Similarity = knownNames[j], similarity
+			}
+		}
+		for j := 0; j < i; j++ {
+			if matches[j] != nil {
+				continue
+			}
+			if similarity := utils.CosineSimilarity(embedding, newEmbeddings[j]); similarity > best.Similarity {
+				best.Into, best.Similarity = newNames[j], similarity
+			}
+		}
+
+		if best.Into != "" && best.Similarity >= threshold {
+			matches[i] = &best
+		}
+	}
+
+	return matches
+}
+
+// applyEntityMerges records each merged name as an alias of its target so
+// relations extracted under either name resolve to the same node.
+func (b *Builder) applyEntityMerges(ctx context.Context, docID string, merges []entityMerge) int {
+	applied := 0
+	for _, merge := range merges {
+		target, err := b.kgClient.GetEntityByName(ctx, merge.Into)
+		if err != nil {
+			logger.Warn("Near-duplicate merge target not found",
+				zap.String("entity", merge.Name),
+				zap.String("into", merge.Into),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		if err := b.AddAlias(ctx, target.ID, merge.Name); err != nil {
+			logger.Warn("Failed to merge near-duplicate entity",
+				zap.String("entity", merge.Name),
+				zap.String("into", merge.Into),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		logger.Info("Merged near-duplicate entity",
+			zap.String("doc_id", docID),
+			zap.String("entity", merge.Name),
+			zap.String("into", target.Name),
+			zap.String("into_id", target.ID),
+			zap.Float64("similarity", merge.Similarity),
+			zap.Float64("threshold", b.cfg.EntityMergeThreshold),
+		)
+		applied++
+	}
+	return applied
+}
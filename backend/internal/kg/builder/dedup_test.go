@@ -0,0 +1,109 @@
+package builder
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/storage/models"
+)
+
+// unitAt returns an 8-dimensional unit vector whose cosine similarity to
+// unitAt(1) is similarity.
+func unitAt(similarity float64) []float32 {
+	return []float32{float32(similarity), float32(math.Sqrt(1 - similarity*similarity)), 0, 0, 0, 0, 0, 0}
+}
+
+func TestMatchNearDuplicatesThreshold(t *testing.T) {
+	const threshold = 0.95
+
+	matches := matchNearDuplicates(
+		[]string{"Amazon S3", "S3 Glacier"},
+		[][]float32{unitAt(0.96), unitAt(0.94)},
+		[]string{"Simple Storage Service"},
+		[][]float32{unitAt(1)},
+		threshold,
+	)
+
+	if matches[0] == nil || matches[0].Into != "Simple Storage Service" {
+		t.Errorf("match just above the threshold = %+v, want a merge into Simple Storage Service", matches[0])
+	} else if math.Abs(matches[0].Similarity-0.96) > 1e-6 {
+		t.Errorf("merge similarity = %f, want 0.96", matches[0].Similarity)
+	}
+	if matches[1] != nil {
+		t.Errorf("match just below the threshold = %+v, want the entity kept", matches[1])
+	}
+}
+
+func TestBuildFromDocumentMergesNearDuplicates(t *testing.T) {
+	db := newTestDB(t)
+	graph := newFakeGraph()
+	ctx := context.Background()
+
+	s3 := &models.KGEntity{
+		ID:            stableEntityID("service", "Simple Storage Service"),
+		Name:          "Simple Storage Service",
+		Type:          "service",
+		CanonicalName: "Simple Storage Service",
+		Aliases:       []string{},
+		FirstSeen:     time.Now(),
+		LastUpdated:   time.Now(),
+	}
+	if err := db.InsertKGEntity(s3); err != nil {
+		t.Fatalf("insert entity: %v", err)
+	}
+	graph.CreateEntity(ctx, &neo4j.Entity{ID: s3.ID, Name: s3.Name, Type: s3.Type, CanonicalName: s3.CanonicalName})
+
+	embeddings := map[string][]float32{
+		"Simple Storage Service": unitAt(1),
+		"Amazon S3":              unitAt(0.97),
+		"S3 Glacier":             unitAt(0.93),
+	}
+	provider := &llmtest.Provider{
+		Reply: extractionReplies("S3",
+			`[{"name": "Amazon S3", "type": "service", "confidence": 0.9},
+			  {"name": "S3 Glacier", "type": "service", "confidence": 0.9}]`, "[]"),
+		Embed: func(text string) ([]float32, error) {
+			if embedding, ok := embeddings[text]; ok {
+				return embedding, nil
+			}
+			return llmtest.HashEmbedding(text), nil
+		},
+	}
+	b := NewBuilder(db, graph, llmtest.NewClient(provider), Config{EntityMergeEnabled: true, EntityMergeThreshold: 0.95})
+
+	result, err := b.BuildFromDocument(ctx, &models.Document{
+		ID:         "doc-1",
+		URL:        "https://docs.aws.amazon.com/s3/latest/userguide/glacier.html",
+		Summary:    "S3 storage classes",
+		RawContent: "Amazon S3 archives objects to S3 Glacier.",
+	})
+	if err != nil {
+		t.Fatalf("BuildFromDocument: %v", err)
+	}
+
+	if result.MergedEntities != 1 || result.NewEntities != 1 {
+		t.Errorf("merged %d and created %d entities, want 1 and 1", result.MergedEntities, result.NewEntities)
+	}
+	names := graph.entityNames()
+	if names["amazon s3"] || !names["s3 glacier"] {
+		t.Errorf("graph entities = %v, want Amazon S3 merged and S3 Glacier kept", names)
+	}
+	if merged, err := graph.GetEntityByName(ctx, "Amazon S3"); err != nil || merged.ID != s3.ID {
+		t.Errorf("lookup of the merged name = %v, %v; want %s", merged, err, s3.Name)
+	}
+
+	stored, err := db.GetKGEntities("service")
+	if err != nil {
+		t.Fatalf("get entities: %v", err)
+	}
+	for _, entity := range stored {
+		if entity.ID == s3.ID && !reflect.DeepEqual(entity.Aliases, []string{"Amazon S3"}) {
+			t.Errorf("stored aliases = %v, want [Amazon S3]", entity.Aliases)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+)
+
+// fakeGraph is an in-memory GraphStore. Relations merge on subject, predicate and
+// object like the Cypher MERGE in neo4j.CreateRelationsBatch.
+type fakeGraph struct {
+	mu        sync.Mutex
+	entities  map[string]neo4j.Entity
+	relations map[string]neo4j.Relation
+}
+
+func newFakeGraph() *fakeGraph {
+	return &fakeGraph{
+		entities:  make(map[string]neo4j.Entity),
+		relations: make(map[string]neo4j.Relation),
+	}
+}
+
+func relationKey(r neo4j.Relation) string {
+	return r.Subject + "|" + r.Predicate + "|" + r.Object
+}
+
+func (g *fakeGraph) CreateEntity(ctx context.Context, entity *neo4j.Entity) error {
+	return g.CreateEntitiesBatch(ctx, []neo4j.Entity{*entity})
+}
+
+func (g *fakeGraph) CreateEntitiesBatch(ctx context.Context, entities []neo4j.Entity) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, entity := range entities {
+		g.entities[entity.ID] = entity
+	}
+	return nil
+}
+
+func (g *fakeGraph) CreateRelationsBatch(ctx context.Context, relations []neo4j.Relation) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	created := 0
+	for _, relation := range relations {
+		_, hasSubject := g.entities[relation.Subject]
+		_, hasObject := g.entities[relation.Object]
+		if !hasSubject || !hasObject {
+			continue
+		}
+		key := relationKey(relation)
+		if _, ok := g.relations[key]; !ok {
+			created++
+		}
+		g.relations[key] = relation
+	}
+	return created, nil
+}
+
+func (g *fakeGraph) GetEntityByName(ctx context.Context, name string) (*neo4j.Entity, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, entity := range g.entities {
+		if entity.Name == name || entity.CanonicalName == name {
+			return &entity, nil
+		}
+	}
+	for _, entity := range g.entities {
+		for _, alias := range entity.Aliases {
+			if alias == name {
+				return &entity, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("entity not found: %s", name)
+}
+
+func (g *fakeGraph) AddAlias(ctx context.Context, entityID, alias string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	entity, ok := g.entities[entityID]
+	if !ok {
+		return fmt.Errorf("%w: %s", neo4j.ErrEntityNotFound, entityID)
+	}
+	for _, existing := range entity.Aliases {
+		if existing == alias {
+			return nil
+		}
+	}
+	entity.Aliases = append(entity.Aliases, alias)
+	g.entities[entityID] = entity
+	return nil
+}
+
+func (g *fakeGraph) ExistingEntityIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	existing := make(map[string]bool)
+	for _, id := range ids {
+		if _, ok := g.entities[id]; ok {
+			existing[id] = true
+		}
+	}
+	return existing, nil
+}
+
+func (g *fakeGraph) ExistingRelations(ctx context.Context, relations []neo4j.Relation) ([]bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	existing := make([]bool, len(relations))
+	for i, relation := range relations {
+		_, existing[i] = g.relations[relationKey(relation)]
+	}
+	return existing, nil
+}
+
+// entityNames returns the names of the entities in the graph, lower-cased.
+func (g *fakeGraph) entityNames() map[string]bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	names := make(map[string]bool, len(g.entities))
+	for _, entity := range g.entities {
+		names[strings.ToLower(entity.Name)] = true
+	}
+	return names
+}
@@ -0,0 +1,278 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+// Graph is the JSON node/edge format read by ImportGraph. Edges refer to
+// nodes by id, either ones in the same file or ones already in the graph.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	Type          string                 `json:"type"`
+	CanonicalName string                 `json:"canonical_name"`
+	Aliases       []string               `json:"aliases"`
+	Properties    map[string]interface{} `json:"properties"`
+}
+
+type GraphEdge struct {
+	Subject    string   `json:"subject"`
+	Predicate  string   `json:"predicate"`
+	Object     string   `json:"object"`
+	Confidence float64  `json:"confidence"`
+	SourceDocs []string `json:"source_docs"`
+}
+
+// RejectedRow identifies an input row that failed validation by its kind
+// ("node" or "edge") and position in the file.
+type RejectedRow struct {
+	Kind   string `json:"kind"`
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+type ImportResult struct {
+	CreatedEntities  int           `json:"created_entities"`
+	SkippedEntities  int           `json:"skipped_entities"`
+	CreatedRelations int           `json:"created_relations"`
+	SkippedRelations int           `json:"skipped_relations"`
+	Rejected         []RejectedRow `json:"rejected"`
+}
+
+// ImportGraph seeds the graph from r. Entities and relations that already
+// exist are left untouched, so importing the same file twice is a no-op.
+// Rows with an unknown entity type or predicate, or edges whose endpoints
+// are missing, are reported in the result rather than failing the import.
+//
+// Imported entities are mirrored to SQLite like extracted ones; imported
+// relations are not, since they have no source document to belong to.
+func (b *Builder) ImportGraph(ctx context.Context, r io.Reader) (*ImportResult, error) {
+	var graph Graph
+	if err := json.NewDecoder(r).Decode(&graph); err != nil {
+		return nil, fmt.Errorf("failed to decode graph: %w", err)
+	}
+
+	result := &ImportResult{Rejected: []RejectedRow{}}
+	entities, relations := validateGraph(&graph, result)
+
+	nodeIDs := make(map[string]bool, len(entities))
+	ids := make([]string, 0, len(entities))
+	for _, entity := range entities {
+		nodeIDs[entity.ID] = true
+		ids = append(ids, entity.ID)
+	}
+	for _, relation := range relations {
+		for _, id := range []string{relation.kg.Subject, relation.kg.Object} {
+			if !nodeIDs[id] {
+				nodeIDs[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	existing, err := b.kgClient.ExistingEntityIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	newEntities := make([]neo4j.Entity, 0, len(entities))
+	for _, entity := range entities {
+		if existing[entity.ID] {
+			result.SkippedEntities++
+			continue
+		}
+		newEntities = append(newEntities, entity)
+	}
+
+	for start := 0; start < len(newEntities); start += b.cfg.WriteBatchSize {
+		batch := newEntities[start:min(start+b.cfg.WriteBatchSize, len(newEntities))]
+		if err := b.kgClient.CreateEntitiesBatch(ctx, batch); err != nil {
+			return result, err
+		}
+		result.CreatedEntities += len(batch)
+
+		for _, entity := range batch {
+			existing[entity.ID] = true
+			if err := b.db.InsertKGEntity(&models.KGEntity{
+				ID:              entity.ID,
+				Name:            entity.Name,
+				Type:            entity.Type,
+				CanonicalName:   entity.CanonicalName,
+				Aliases:         entity.Aliases,
+				FirstSeen:       time.Now(),
+				LastUpdated:     time.Now(),
+				OccurrenceCount: 1,
+			}); err != nil {
+				logger.Warn("Failed to insert imported entity to SQLite", zap.String("entity_id", entity.ID), zap.Error(err))
+			}
+		}
+	}
+
+	candidates := make([]neo4j.Relation, 0, len(relations))
+	for _, relation := range relations {
+		missing := relation.kg.Subject
+		if existing[missing] {
+			missing = relation.kg.Object
+		}
+		if !existing[missing] {
+			result.Rejected = append(result.Rejected, RejectedRow{
+				Kind:   "edge",
+				Index:  relation.index,
+				Reason: fmt.Sprintf("unknown entity %q", missing),
+			})
+			continue
+		}
+		candidates = append(candidates, relation.kg)
+	}
+
+	found, err := b.kgClient.ExistingRelations(ctx, candidates)
+	if err != nil {
+		return result, err
+	}
+
+	newRelations := make([]neo4j.Relation, 0, len(candidates))
+	for i, relation := range candidates {
+		if found[i] {
+			result.SkippedRelations++
+			continue
+		}
+		newRelations = append(newRelations, relation)
+	}
+
+	for start := 0; start < len(newRelations); start += b.cfg.WriteBatchSize {
+		batch := newRelations[start:min(start+b.cfg.WriteBatchSize, len(newRelations))]
+		created, err := b.kgClient.CreateRelationsBatch(ctx, batch)
+		result.CreatedRelations += created
+		if err != nil {
+			return result, err
+		}
+	}
+
+	logger.Info("KG import completed",
+		zap.Int("created_entities", result.CreatedEntities),
+		zap.Int("skipped_entities", result.SkippedEntities),
+		zap.Int("created_relations", result.CreatedRelations),
+		zap.Int("skipped_relations", result.SkippedRelations),
+		zap.Int("rejected", len(result.Rejected)),
+	)
+
+	return result, nil
+}
+
+type importedRelation struct {
+	index int
+	kg    neo4j.Relation
+}
+
+// validateGraph normalises the rows of graph, recording invalid ones in
+// result. Nodes without an id get the id extraction would assign them, and
+// a repeated node or edge is rejected so each row maps to one write.
+func validateGraph(graph *Graph, result *ImportResult) ([]neo4j.Entity, []importedRelation) {
+	reject := func(kind string, index int, format string, args ...interface{}) {
+		result.Rejected = append(result.Rejected, RejectedRow{
+			Kind:   kind,
+			Index:  index,
+			Reason: fmt.Sprintf(format, args...),
+		})
+	}
+
+	entities := make([]neo4j.Entity, 0, len(graph.Nodes))
+	seenNodes := make(map[string]bool, len(graph.Nodes))
+	for i, node := range graph.Nodes {
+		name := strings.TrimSpace(node.Name)
+		entityType := strings.ToLower(strings.TrimSpace(node.Type))
+		if name == "" {
+			reject("node", i, "name is required")
+			continue
+		}
+		if !validEntityTypes[entityType] && entityType != autoCreatedEntityType {
+			reject("node", i, "invalid entity type %q", node.Type)
+			continue
+		}
+
+		id := strings.TrimSpace(node.ID)
+		if id == "" {
+			id = stableEntityID(entityType, name)
+		}
+		if seenNodes[id] {
+			reject("node", i, "duplicate node %q", id)
+			continue
+		}
+		seenNodes[id] = true
+
+		canonical := strings.TrimSpace(node.CanonicalName)
+		if canonical == "" {
+			canonical = name
+		}
+		aliases := node.Aliases
+		if aliases == nil {
+			aliases = []string{}
+		}
+
+		entities = append(entities, neo4j.Entity{
+			ID:            id,
+			Name:          name,
+			Type:          entityType,
+			CanonicalName: canonical,
+			Aliases:       aliases,
+			Properties:    node.Properties,
+		})
+	}
+
+	relations := make([]importedRelation, 0, len(graph.Edges))
+	seenEdges := make(map[string]bool, len(graph.Edges))
+	for i, edge := range graph.Edges {
+		subject := strings.TrimSpace(edge.Subject)
+		object := strings.TrimSpace(edge.Object)
+		predicate := strings.ToUpper(strings.TrimSpace(edge.Predicate))
+		if subject == "" || object == "" {
+			reject("edge", i, "subject and object are required")
+			continue
+		}
+		if !llm.IsAllowedPredicate(predicate) {
+			reject("edge", i, "invalid predicate %q", edge.Predicate)
+			continue
+		}
+		if edge.Confidence <= 0 || edge.Confidence > 1 {
+			reject("edge", i, "confidence must be in (0, 1]")
+			continue
+		}
+
+		key := subject + "\x00" + predicate + "\x00" + object
+		if seenEdges[key] {
+			reject("edge", i, "duplicate edge")
+			continue
+		}
+		seenEdges[key] = true
+
+		relations = append(relations, importedRelation{
+			index: i,
+			kg: neo4j.Relation{
+				Subject:    subject,
+				Predicate:  predicate,
+				Object:     object,
+				Confidence: edge.Confidence,
+				SourceDocs: edge.SourceDocs,
+			},
+		})
+	}
+
+	return entities, relations
+}
@@ -0,0 +1,142 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+)
+
+const importFixture = `{
+	"nodes": [
+		{"id": "lambda", "name": "AWS Lambda", "type": "service"},
+		{"id": "s3", "name": "Amazon S3", "type": "Service", "aliases": ["S3"]},
+		{"name": "AccessDenied", "type": "error"},
+		{"id": "bogus", "name": "Bogus", "type": "planet"},
+		{"id": "lambda", "name": "Lambda again", "type": "service"}
+	],
+	"edges": [
+		{"subject": "lambda", "predicate": "uses", "object": "s3", "confidence": 0.9, "source_docs": ["https://docs.aws.amazon.com/lambda"]},
+		{"subject": "lambda", "predicate": "MONITORS", "object": "iam", "confidence": 0.8},
+		{"subject": "lambda", "predicate": "LIKES", "object": "s3", "confidence": 0.8},
+		{"subject": "lambda", "predicate": "USES", "object": "s3", "confidence": 0.7},
+		{"subject": "s3", "predicate": "PART_OF", "object": "storage", "confidence": 1.5},
+		{"subject": "lambda", "predicate": "REQUIRES", "object": "iam", "confidence": 0.6}
+	]
+}`
+
+func rejectedReasons(result *ImportResult) map[string]string {
+	reasons := make(map[string]string, len(result.Rejected))
+	for _, row := range result.Rejected {
+		reasons[fmt.Sprintf("%s/%d", row.Kind, row.Index)] = row.Reason
+	}
+	return reasons
+}
+
+func TestImportGraph(t *testing.T) {
+	graph := newFakeGraph()
+	ctx := context.Background()
+
+	// IAM is already in the graph; the file only refers to it.
+	graph.CreateEntitiesBatch(ctx, []neo4j.Entity{{ID: "iam", Name: "IAM", Type: "service"}})
+
+	b := NewBuilder(newTestDB(t), graph, llmtest.NewClient(&llmtest.Provider{}), Config{})
+
+	result, err := b.ImportGraph(ctx, strings.NewReader(importFixture))
+	if err != nil {
+		t.Fatalf("ImportGraph: %v", err)
+	}
+
+	if result.CreatedEntities != 3 || result.SkippedEntities != 0 {
+		t.Errorf("entities created %d, skipped %d; want 3 and 0", result.CreatedEntities, result.SkippedEntities)
+	}
+	if result.CreatedRelations != 3 || result.SkippedRelations != 0 {
+		t.Errorf("relations created %d, skipped %d; want 3 and 0", result.CreatedRelations, result.SkippedRelations)
+	}
+
+	reasons := rejectedReasons(result)
+	for row, want := range map[string]string{
+		"node/3": "invalid entity type",
+		"node/4": "duplicate node",
+		"edge/2": "invalid predicate",
+		"edge/3": "duplicate edge",
+		"edge/4": "confidence",
+	} {
+		if !strings.Contains(reasons[row], want) {
+			t.Errorf("rejection of %s = %q, want it to mention %q", row, reasons[row], want)
+		}
+	}
+	if len(result.Rejected) != 5 {
+		t.Errorf("rejected = %+v, want 5 rows", result.Rejected)
+	}
+
+	if entity, ok := graph.entities[stableEntityID("error", "AccessDenied")]; !ok || entity.CanonicalName != "AccessDenied" {
+		t.Errorf("node without an id = %+v, want it stored under its extraction id", entity)
+	}
+	if entity := graph.entities["s3"]; entity.Type != "service" || !reflect.DeepEqual(entity.Aliases, []string{"S3"}) {
+		t.Errorf("s3 = %+v, want the type normalised and aliases kept", entity)
+	}
+	if relation, ok := graph.relations["lambda|USES|s3"]; !ok || relation.Confidence != 0.9 {
+		t.Errorf("lambda USES s3 = %+v, want the first edge with its predicate upper-cased", relation)
+	}
+	if _, ok := graph.relations["lambda|REQUIRES|iam"]; !ok {
+		t.Error("edge to an entity already in the graph was not imported")
+	}
+
+	mirrored := 0
+	for _, entityType := range []string{"service", "error"} {
+		stored, err := b.db.GetKGEntities(entityType)
+		if err != nil {
+			t.Fatalf("get entities: %v", err)
+		}
+		mirrored += len(stored)
+	}
+	if mirrored != 3 {
+		t.Errorf("sqlite entities = %d, want the 3 imported ones mirrored", mirrored)
+	}
+
+	// Importing the same file again writes nothing and rejects the same rows.
+	graph.relations["lambda|USES|s3"] = neo4j.Relation{Subject: "lambda", Predicate: "USES", Object: "s3", Confidence: 0.5}
+
+	again, err := b.ImportGraph(ctx, strings.NewReader(importFixture))
+	if err != nil {
+		t.Fatalf("re-import: %v", err)
+	}
+	if again.CreatedEntities != 0 || again.SkippedEntities != 3 || again.CreatedRelations != 0 || again.SkippedRelations != 3 {
+		t.Errorf("re-import = %+v, want every entity and relation skipped", again)
+	}
+	if !reflect.DeepEqual(again.Rejected, result.Rejected) {
+		t.Errorf("re-import rejected %+v, want %+v", again.Rejected, result.Rejected)
+	}
+	if got := graph.relations["lambda|USES|s3"].Confidence; got != 0.5 {
+		t.Errorf("existing relation confidence = %v after re-import, want it left untouched", got)
+	}
+}
+
+func TestImportGraphRejectsEdgesToUnknownEntities(t *testing.T) {
+	graph := newFakeGraph()
+	b := NewBuilder(newTestDB(t), graph, llmtest.NewClient(&llmtest.Provider{}), Config{})
+
+	result, err := b.ImportGraph(context.Background(), strings.NewReader(`{
+		"nodes": [{"id": "lambda", "name": "AWS Lambda", "type": "service"}],
+		"edges": [{"subject": "lambda", "predicate": "USES", "object": "dynamodb", "confidence": 0.9}]
+	}`))
+	if err != nil {
+		t.Fatalf("ImportGraph: %v", err)
+	}
+
+	if result.CreatedRelations != 0 || len(graph.relations) != 0 {
+		t.Errorf("created %d relations, want none", result.CreatedRelations)
+	}
+	if len(result.Rejected) != 1 || !strings.Contains(result.Rejected[0].Reason, `"dynamodb"`) {
+		t.Errorf("rejected = %+v, want the edge rejected for the unknown entity", result.Rejected)
+	}
+
+	if _, err := b.ImportGraph(context.Background(), strings.NewReader(`{"nodes": [`)); err == nil {
+		t.Error("malformed JSON imported without error")
+	}
+}
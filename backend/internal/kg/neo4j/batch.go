@@ -0,0 +1,258 @@
+package neo4j
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+// maxBatchRows bounds the rows sent in one UNWIND so a single transaction
+// stays well inside the per-call timeout.
+const maxBatchRows = 500
+
+// CreateEntitiesBatch upserts entities with one UNWIND query per
+// maxBatchRows, each batch in its own write transaction. Merge semantics
+// match CreateEntity.
+func (c *Client) CreateEntitiesBatch(ctx context.Context, entities []Entity) error {
+	query := `
+		UNWIND $rows AS row
+		MERGE (e:Entity {id: row.id})
+		ON CREATE SET e.created_at = timestamp()
+		SET e.name = row.name,
+		    e.type = row.type,
+		    e.canonical_name = row.canonical_name,
+		    e.aliases = coalesce(e.aliases, []) + [a IN row.aliases WHERE NOT a IN coalesce(e.aliases, [])]
+		SET e += row.properties
+	`
+
+	for start := 0; start < len(entities); start += maxBatchRows {
+		batch := entities[start:min(start+maxBatchRows, len(entities))]
+
+		rows := make([]interface{}, 0, len(batch))
+		for _, entity := range batch {
+			properties := entity.Properties
+			if properties == nil {
+				properties = map[string]interface{}{}
+			}
+
+			aliases := make([]interface{}, 0, len(entity.Aliases))
+			for _, alias := range entity.Aliases {
+				aliases = append(aliases, alias)
+			}
+
+			rows = append(rows, map[string]interface{}{
+				"id":             entity.ID,
+				"name":           entity.Name,
+				"type":           entity.Type,
+				"canonical_name": entity.CanonicalName,
+				"aliases":        aliases,
+				"properties":     properties,
+			})
+		}
+
+		err := c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
+			_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+				result, err := tx.Run(ctx, query, map[string]interface{}{"rows": rows})
+				if err != nil {
+					return nil, err
+				}
+				return result.Consume(ctx)
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create entities batch: %w", err)
+		}
+
+		logger.Debug("Entities batch written to KG", zap.Int("count", len(batch)))
+	}
+
+	return nil
+}
+
+// CreateRelationsBatch writes relations with one UNWIND query per
+// maxBatchRows and returns how many were merged. Relations whose endpoints
+// do not exist are skipped by the MATCH.
+//
+// Evidence accumulates across documents: each relation keeps one confidence
+// per source document in source_confidences, parallel to source_docs, and a
+// document that is extracted again replaces its own entry. The relation's
+// confidence is the noisy-OR of those, 1 - prod(1 - c), so corroboration by
+// independent documents raises it while re-ingesting one document does not.
+// Relations written before per-document confidences existed count each of
+// their documents at the stored confidence.
+func (c *Client) CreateRelationsBatch(ctx context.Context, relations []Relation) (int, error) {
+	query := `
+		UNWIND $rows AS row
+		MATCH (s:Entity {id: row.subject_id})
+		MATCH (o:Entity {id: row.object_id})
+		MERGE (s)-[r:RELATES {type: row.predicate}]->(o)
+		ON CREATE SET r.created_at = timestamp()
+		WITH r, row, coalesce(r.source_docs, []) AS docs
+		WITH r, row, docs,
+		     CASE WHEN size(coalesce(r.source_confidences, [])) = size(docs)
+		          THEN r.source_confidences
+		          ELSE [d IN docs | coalesce(r.confidence, row.confidence)] END AS confs
+		WITH r, row,
+		     [i IN range(0, size(docs) - 1) WHERE NOT docs[i] IN row.source_docs | docs[i]] AS kept_docs,
+		     [i IN range(0, size(docs) - 1) WHERE NOT docs[i] IN row.source_docs | confs[i]] AS kept_confs
+		WITH r, row,
+		     kept_docs + row.source_docs AS all_docs,
+		     kept_confs + [d IN row.source_docs | row.confidence] AS all_confs
+		SET r.source_docs = all_docs,
+		    r.source_confidences = all_confs,
+		    r.source_count = size(all_docs),
+		    r.confidence = CASE WHEN size(all_confs) = 0 THEN row.confidence
+		                        ELSE 1.0 - reduce(p = 1.0, c IN all_confs | p * (1.0 - c)) END,
+		    r.updated_at = timestamp()
+		RETURN count(r) AS created
+	`
+
+	created := 0
+	for start := 0; start < len(relations); start += maxBatchRows {
+		batch := relations[start:min(start+maxBatchRows, len(relations))]
+
+		rows := make([]interface{}, 0, len(batch))
+		for _, relation := range batch {
+			sourceDocs := make([]interface{}, 0, len(relation.SourceDocs))
+			seen := make(map[string]bool, len(relation.SourceDocs))
+			for _, doc := range relation.SourceDocs {
+				if doc == "" || seen[doc] {
+					continue
+				}
+				seen[doc] = true
+				sourceDocs = append(sourceDocs, doc)
+			}
+
+			rows = append(rows, map[string]interface{}{
+				"subject_id":  relation.Subject,
+				"object_id":   relation.Object,
+				"predicate":   relation.Predicate,
+				"confidence":  clampConfidence(relation.Confidence),
+				"source_docs": sourceDocs,
+			})
+		}
+
+		var count int64
+		err := c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
+			value, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (interface{}, error) {
+				result, err := tx.Run(ctx, query, map[string]interface{}{"rows": rows})
+				if err != nil {
+					return nil, err
+				}
+				record, err := result.Single(ctx)
+				if err != nil {
+					return nil, err
+				}
+				created, _ := record.Get("created")
+				return created, nil
+			})
+			if err != nil {
+				return err
+			}
+			count, _ = value.(int64)
+			return nil
+		})
+		if err != nil {
+			return created, fmt.Errorf("failed to create relations batch: %w", err)
+		}
+
+		created += int(count)
+		logger.Debug("Relations batch written to KG",
+			zap.Int("count", len(batch)),
+			zap.Int64("created", count),
+		)
+	}
+
+	return created, nil
+}
+
+// clampConfidence keeps a per-document confidence a probability below 1;
+// a single certain source would otherwise pin the merged confidence at 1.
+func clampConfidence(confidence float64) float64 {
+	return math.Min(math.Max(confidence, 0), 0.99)
+}
+
+// ExistingEntityIDs returns which of ids already exist in the graph.
+func (c *Client) ExistingEntityIDs(ctx context.Context, ids []string) (map[string]bool, error) {
+	query := `
+		UNWIND $ids AS id
+		MATCH (e:Entity {id: id})
+		RETURN e.id AS id
+	`
+
+	existing := make(map[string]bool)
+	for start := 0; start < len(ids); start += maxBatchRows {
+		batch := ids[start:min(start+maxBatchRows, len(ids))]
+
+		err := c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
+			result, err := session.Run(ctx, query, map[string]interface{}{"ids": batch})
+			if err != nil {
+				return err
+			}
+			for result.Next(ctx) {
+				id, _ := result.Record().Get("id")
+				if s, ok := id.(string); ok {
+					existing[s] = true
+				}
+			}
+			return result.Err()
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up entities: %w", err)
+		}
+	}
+
+	return existing, nil
+}
+
+// ExistingRelations reports, for each relation, whether an edge with the
+// same subject, predicate and object is already in the graph.
+func (c *Client) ExistingRelations(ctx context.Context, relations []Relation) ([]bool, error) {
+	query := `
+		UNWIND range(0, size($rows) - 1) AS i
+		WITH i, $rows[i] AS row
+		OPTIONAL MATCH (:Entity {id: row.subject_id})-[r:RELATES {type: row.predicate}]->(:Entity {id: row.object_id})
+		RETURN i, count(r) > 0 AS found
+	`
+
+	existing := make([]bool, len(relations))
+	for start := 0; start < len(relations); start += maxBatchRows {
+		batch := relations[start:min(start+maxBatchRows, len(relations))]
+
+		rows := make([]interface{}, 0, len(batch))
+		for _, relation := range batch {
+			rows = append(rows, map[string]interface{}{
+				"subject_id": relation.Subject,
+				"object_id":  relation.Object,
+				"predicate":  relation.Predicate,
+			})
+		}
+
+		err := c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
+			result, err := session.Run(ctx, query, map[string]interface{}{"rows": rows})
+			if err != nil {
+				return err
+			}
+			for result.Next(ctx) {
+				record := result.Record()
+				i, _ := record.Get("i")
+				found, _ := record.Get("found")
+				if idx, ok := i.(int64); ok && int(idx) < len(batch) {
+					existing[start+int(idx)], _ = found.(bool)
+				}
+			}
+			return result.Err()
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up relations: %w", err)
+		}
+	}
+
+	return existing, nil
+}
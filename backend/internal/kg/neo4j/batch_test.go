@@ -0,0 +1,175 @@
+package neo4j
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// batchRows returns the rows parameter of every query the driver ran.
+func batchRows(t *testing.T, driver *mockDriver) [][]interface{} {
+	t.Helper()
+
+	batches := make([][]interface{}, 0, len(driver.params))
+	for i, params := range driver.params {
+		rows, ok := params["rows"].([]interface{})
+		if !ok {
+			t.Fatalf("query %d has no rows parameter: %v", i, params)
+		}
+		batches = append(batches, rows)
+	}
+	return batches
+}
+
+func TestCreateEntitiesBatch(t *testing.T) {
+	for _, n := range []int{1, 25, maxBatchRows, maxBatchRows + 1} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			driver := &mockDriver{reply: func(string) []*neo4j.Record { return nil }}
+			client := newTestClient(driver, "neo4j")
+
+			entities := make([]Entity, n)
+			for i := range entities {
+				entities[i] = Entity{ID: fmt.Sprintf("e%d", i), Name: fmt.Sprintf("Entity %d", i), Type: "service", Aliases: []string{"alias"}}
+			}
+			if err := client.CreateEntitiesBatch(context.Background(), entities); err != nil {
+				t.Fatalf("CreateEntitiesBatch: %v", err)
+			}
+
+			wantRuns := (n + maxBatchRows - 1) / maxBatchRows
+			if len(driver.sessions) != wantRuns || len(driver.queries) != wantRuns {
+				t.Fatalf("opened %d sessions and ran %d queries, want %d of each", len(driver.sessions), len(driver.queries), wantRuns)
+			}
+
+			var ids []string
+			for _, rows := range batchRows(t, driver) {
+				if len(rows) > maxBatchRows {
+					t.Errorf("batch holds %d rows, want at most %d", len(rows), maxBatchRows)
+				}
+				for _, row := range rows {
+					ids = append(ids, row.(map[string]interface{})["id"].(string))
+				}
+			}
+			if len(ids) != n || ids[0] != "e0" || ids[n-1] != fmt.Sprintf("e%d", n-1) {
+				t.Errorf("wrote %d entities from %v to %v, want all %d in order", len(ids), ids[0], ids[len(ids)-1], n)
+			}
+		})
+	}
+}
+
+func TestCreateRelationsBatch(t *testing.T) {
+	driver := &mockDriver{reply: func(string) []*neo4j.Record {
+		return []*neo4j.Record{{Keys: []string{"created"}, Values: []any{int64(3)}}}
+	}}
+	client := newTestClient(driver, "neo4j")
+
+	relations := []Relation{
+		{Subject: "e1", Predicate: "USES", Object: "e2", Confidence: 0.8, SourceDocs: []string{"doc-a", "doc-a", ""}},
+		{Subject: "e2", Predicate: "MONITORS", Object: "e3", Confidence: 1.5, SourceDocs: []string{"doc-b"}},
+		{Subject: "e3", Predicate: "REQUIRES", Object: "e1", Confidence: 0.7},
+	}
+	created, err := client.CreateRelationsBatch(context.Background(), relations)
+	if err != nil {
+		t.Fatalf("CreateRelationsBatch: %v", err)
+	}
+	if created != 3 {
+		t.Errorf("created = %d, want the count reported by the query", created)
+	}
+
+	batches := batchRows(t, driver)
+	if len(driver.sessions) != 1 || len(batches) != 1 || len(batches[0]) != len(relations) {
+		t.Fatalf("ran %d queries in %d sessions, want all %d relations in one", len(batches), len(driver.sessions), len(relations))
+	}
+
+	first := batches[0][0].(map[string]interface{})
+	if !reflect.DeepEqual(first["source_docs"], []interface{}{"doc-a"}) {
+		t.Errorf("source_docs = %v, want duplicates and blanks dropped", first["source_docs"])
+	}
+	if got := batches[0][1].(map[string]interface{})["confidence"]; got != 0.99 {
+		t.Errorf("confidence = %v, want it clamped to 0.99", got)
+	}
+}
+
+func TestCreateRelationUsesBatchMerge(t *testing.T) {
+	driver := &mockDriver{reply: func(string) []*neo4j.Record {
+		return []*neo4j.Record{{Keys: []string{"created"}, Values: []any{int64(1)}}}
+	}}
+	client := newTestClient(driver, "neo4j")
+
+	if err := client.CreateRelation(context.Background(), &Relation{Subject: "e1", Predicate: "USES", Object: "e2", Confidence: 0.8, SourceDocs: []string{"doc-a"}}); err != nil {
+		t.Fatalf("CreateRelation: %v", err)
+	}
+	if len(driver.queries) != 1 || !strings.Contains(driver.queries[0], "source_confidences") {
+		t.Errorf("queries = %v, want the evidence-merging batch query", driver.queries)
+	}
+}
+
+// TestCreateRelationsBatchMergesEvidence runs against the Neo4j named by
+// NEO4J_TEST_URI, since the merge happens in Cypher.
+func TestCreateRelationsBatchMergesEvidence(t *testing.T) {
+	uri := os.Getenv("NEO4J_TEST_URI")
+	if uri == "" {
+		t.Skip("NEO4J_TEST_URI not set")
+	}
+
+	client, err := NewClient(uri, os.Getenv("NEO4J_TEST_USERNAME"), os.Getenv("NEO4J_TEST_PASSWORD"), os.Getenv("NEO4J_TEST_DATABASE"))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	ctx := context.Background()
+	t.Cleanup(func() { client.Close(ctx) })
+
+	suffix := fmt.Sprint(time.Now().UnixNano())
+	subject := Entity{ID: "test-lambda-" + suffix, Name: "Lambda " + suffix, Type: "service"}
+	object := Entity{ID: "test-s3-" + suffix, Name: "S3 " + suffix, Type: "service"}
+	if err := client.CreateEntitiesBatch(ctx, []Entity{subject, object}); err != nil {
+		t.Fatalf("create entities: %v", err)
+	}
+	t.Cleanup(func() {
+		session := client.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: client.database})
+		defer session.Close(ctx)
+		session.Run(ctx, `MATCH (e:Entity) WHERE e.id IN $ids DETACH DELETE e`, map[string]any{"ids": []string{subject.ID, object.ID}})
+	})
+
+	ingest := func(doc string, confidence float64) Triple {
+		t.Helper()
+		relation := Relation{Subject: subject.ID, Predicate: "USES", Object: object.ID, Confidence: confidence, SourceDocs: []string{doc}}
+		if _, err := client.CreateRelationsBatch(ctx, []Relation{relation}); err != nil {
+			t.Fatalf("ingest from %s: %v", doc, err)
+		}
+		triples, err := client.SearchByEntities(ctx, []string{subject.Name}, 0)
+		if err != nil || len(triples) != 1 {
+			t.Fatalf("search = %v, %v; want one relation", triples, err)
+		}
+		return triples[0]
+	}
+
+	first := ingest("doc-a", 0.6)
+	if first.SourceCount != 1 || math.Abs(first.Confidence-0.6) > 1e-9 {
+		t.Errorf("after one document: count %d, confidence %f; want 1 and 0.6", first.SourceCount, first.Confidence)
+	}
+
+	// A second document corroborates the relation: 1 - 0.4*0.5.
+	second := ingest("doc-b", 0.5)
+	if second.SourceCount != 2 || math.Abs(second.Confidence-0.8) > 1e-9 {
+		t.Errorf("after two documents: count %d, confidence %f; want 2 and 0.8", second.SourceCount, second.Confidence)
+	}
+	sort.Strings(second.SourceURLs)
+	if !reflect.DeepEqual(second.SourceURLs, []string{"doc-a", "doc-b"}) {
+		t.Errorf("source docs = %v, want both documents", second.SourceURLs)
+	}
+
+	// Re-extracting doc-a replaces its own evidence rather than adding to it:
+	// 1 - 0.3*0.5.
+	again := ingest("doc-a", 0.7)
+	if again.SourceCount != 2 || math.Abs(again.Confidence-0.85) > 1e-9 {
+		t.Errorf("after re-ingesting doc-a: count %d, confidence %f; want 2 and 0.85", again.SourceCount, again.Confidence)
+	}
+}
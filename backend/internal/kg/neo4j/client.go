@@ -8,6 +8,7 @@ import (
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"go.uber.org/zap"
 
+	"github.com/aws-agent/backend/internal/metrics"
 	"github.com/aws-agent/backend/pkg/circuitbreaker"
 	"github.com/aws-agent/backend/pkg/logger"
 	"github.com/aws-agent/backend/pkg/retry"
@@ -15,6 +16,7 @@ import (
 
 type Client struct {
 	driver      neo4j.DriverWithContext
+	database    string
 	cb          *circuitbreaker.CircuitBreaker
 	retryConfig retry.Config
 }
@@ -24,6 +26,7 @@ type Entity struct {
 	Name          string
 	Type          string
 	CanonicalName string
+	Aliases       []string
 	Properties    map[string]interface{}
 }
 
@@ -41,6 +44,8 @@ type Triple struct {
 	Object     Entity
 	Confidence float64
 	SourceURLs []string
+	// SourceCount is how many documents corroborate the relation.
+	SourceCount int
 }
 
 func NewClient(uri, username, password, database string) (*Client, error) {
@@ -64,6 +69,7 @@ func NewClient(uri, username, password, database string) (*Client, error) {
 		Timeout:          20 * time.Second,
 		FailureThreshold: 5,
 		SuccessThreshold: 2,
+		OnStateChange:    metrics.RecordCircuitBreakerState,
 		Logger:           logger.GetLogger(),
 	})
 
@@ -73,13 +79,19 @@ func NewClient(uri, username, password, database string) (*Client, error) {
 		MaxDelay:       3 * time.Second,
 		Multiplier:     2.0,
 		JitterFraction: 0.1,
+		Classifier:     retry.AnyOf(neo4j.IsRetryable, retry.IsTransient),
 		Logger:         logger.GetLogger(),
 	}
 
-	logger.Info("Neo4j client initialized", zap.String("uri", uri))
+	if database == "" {
+		database = "neo4j"
+	}
+
+	logger.Info("Neo4j client initialized", zap.String("uri", uri), zap.String("database", database))
 
 	return &Client{
 		driver:      driver,
+		database:    database,
 		cb:          cb,
 		retryConfig: retryConfig,
 	}, nil
@@ -89,13 +101,19 @@ func (c *Client) Close(ctx context.Context) error {
 	return c.driver.Close(ctx)
 }
 
+// Ping checks the server is reachable without going through the circuit
+// breaker, so probes see the real state even while the breaker is open.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.driver.VerifyConnectivity(ctx)
+}
+
 func (c *Client) executeWithRetry(ctx context.Context, operation func(neo4j.SessionWithContext) error) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	return c.cb.Execute(ctx, func() error {
 		return retry.Do(ctx, c.retryConfig, func() error {
-			session := c.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "neo4j"})
+			session := c.driver.NewSession(ctx, neo4j.SessionConfig{DatabaseName: c.database})
 			defer session.Close(ctx)
 			return operation(session)
 		})
@@ -106,17 +124,31 @@ func (c *Client) CreateEntity(ctx context.Context, entity *Entity) error {
 	return c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
 		query := `
 			MERGE (e:Entity {id: $id})
+			ON CREATE SET e.created_at = timestamp()
 			SET e.name = $name,
 			    e.type = $type,
 			    e.canonical_name = $canonical_name,
-			    e.created_at = timestamp()
+			    e.aliases = coalesce(e.aliases, []) + [a IN $aliases WHERE NOT a IN coalesce(e.aliases, [])]
+			SET e += $properties
 		`
 
+		properties := entity.Properties
+		if properties == nil {
+			properties = map[string]interface{}{}
+		}
+
+		aliases := make([]interface{}, 0, len(entity.Aliases))
+		for _, alias := range entity.Aliases {
+			aliases = append(aliases, alias)
+		}
+
 		_, err := session.Run(ctx, query, map[string]interface{}{
 			"id":             entity.ID,
 			"name":           entity.Name,
 			"type":           entity.Type,
 			"canonical_name": entity.CanonicalName,
+			"aliases":        aliases,
+			"properties":     properties,
 		})
 
 		if err != nil {
@@ -129,37 +161,20 @@ func (c *Client) CreateEntity(ctx context.Context, entity *Entity) error {
 	})
 }
 
+// CreateRelation merges a single relation with the same evidence
+// accumulation as CreateRelationsBatch.
 func (c *Client) CreateRelation(ctx context.Context, relation *Relation) error {
-	return c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
-		query := `
-			MATCH (s:Entity {id: $subject_id})
-			MATCH (o:Entity {id: $object_id})
-			MERGE (s)-[r:RELATES {type: $predicate}]->(o)
-			SET r.confidence = $confidence,
-			    r.source_docs = $source_docs,
-			    r.created_at = timestamp()
-		`
-
-		_, err := session.Run(ctx, query, map[string]interface{}{
-			"subject_id":  relation.Subject,
-			"object_id":   relation.Object,
-			"predicate":   relation.Predicate,
-			"confidence":  relation.Confidence,
-			"source_docs": relation.SourceDocs,
-		})
-
-		if err != nil {
-			return fmt.Errorf("failed to create relation: %w", err)
-		}
+	if _, err := c.CreateRelationsBatch(ctx, []Relation{*relation}); err != nil {
+		return fmt.Errorf("failed to create relation: %w", err)
+	}
 
-		logger.Debug("Relation created in KG",
-			zap.String("subject", relation.Subject),
-			zap.String("predicate", relation.Predicate),
-			zap.String("object", relation.Object),
-		)
+	logger.Debug("Relation created in KG",
+		zap.String("subject", relation.Subject),
+		zap.String("predicate", relation.Predicate),
+		zap.String("object", relation.Object),
+	)
 
-		return nil
-	})
+	return nil
 }
 
 func (c *Client) SearchByEntities(ctx context.Context, entities []string, minConfidence float64) ([]Triple, error) {
@@ -172,8 +187,9 @@ func (c *Client) SearchByEntities(ctx context.Context, entities []string, minCon
 			  AND r.confidence >= $min_confidence
 			RETURN s.id, s.name, s.type, s.canonical_name,
 			       r.type, r.confidence, r.source_docs,
+			       coalesce(r.source_count, size(coalesce(r.source_docs, []))) AS source_count,
 			       o.id, o.name, o.type, o.canonical_name
-			ORDER BY r.confidence DESC
+			ORDER BY r.confidence DESC, source_count DESC
 			LIMIT 20
 		`
 
@@ -201,6 +217,7 @@ func (c *Client) SearchByEntities(ctx context.Context, entities []string, minCon
 			predicate, _ := record.Get("r.type")
 			confidence, _ := record.Get("r.confidence")
 			sourceDocs, _ := record.Get("r.source_docs")
+			sourceCount, _ := record.Get("source_count")
 
 			var sourceURLs []string
 			if docs, ok := sourceDocs.([]interface{}); ok {
@@ -225,8 +242,9 @@ func (c *Client) SearchByEntities(ctx context.Context, entities []string, minCon
 					Type:          objectType.(string),
 					CanonicalName: objectCanonical.(string),
 				},
-				Confidence: confidence.(float64),
-				SourceURLs: sourceURLs,
+				Confidence:  confidence.(float64),
+				SourceURLs:  sourceURLs,
+				SourceCount: int(sourceCount.(int64)),
 			}
 
 			triples = append(triples, triple)
@@ -263,8 +281,9 @@ func (c *Client) FindSolutions(ctx context.Context, errorType string, minConfide
 			  AND r2.confidence >= $min_confidence
 			RETURN error.id, error.name, error.type, error.canonical_name,
 			       'RESOLVED_BY', r2.confidence, r2.source_docs,
+			       coalesce(r2.source_count, size(coalesce(r2.source_docs, []))) AS source_count,
 			       solution.id, solution.name, solution.type, solution.canonical_name
-			ORDER BY r2.confidence DESC
+			ORDER BY r2.confidence DESC, source_count DESC
 			LIMIT 10
 		`
 
@@ -291,6 +310,7 @@ func (c *Client) FindSolutions(ctx context.Context, errorType string, minConfide
 
 			confidence, _ := record.Get("r2.confidence")
 			sourceDocs, _ := record.Get("r2.source_docs")
+			sourceCount, _ := record.Get("source_count")
 
 			var sourceURLs []string
 			if docs, ok := sourceDocs.([]interface{}); ok {
@@ -315,8 +335,9 @@ func (c *Client) FindSolutions(ctx context.Context, errorType string, minConfide
 					Type:          solutionType.(string),
 					CanonicalName: solutionCanonical.(string),
 				},
-				Confidence: confidence.(float64),
-				SourceURLs: sourceURLs,
+				Confidence:  confidence.(float64),
+				SourceURLs:  sourceURLs,
+				SourceCount: int(sourceCount.(int64)),
 			}
 
 			triples = append(triples, triple)
@@ -342,8 +363,9 @@ func (c *Client) GetEntityByName(ctx context.Context, name string) (*Entity, err
 	err := c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
 		query := `
 			MATCH (e:Entity)
-			WHERE e.name = $name OR e.canonical_name = $name
-			RETURN e.id, e.name, e.type, e.canonical_name
+			WHERE e.name = $name OR e.canonical_name = $name OR $name IN coalesce(e.aliases, [])
+			RETURN e.id, e.name, e.type, e.canonical_name, coalesce(e.aliases, []) AS aliases
+			ORDER BY CASE WHEN e.name = $name THEN 0 WHEN e.canonical_name = $name THEN 1 ELSE 2 END
 			LIMIT 1
 		`
 
@@ -360,12 +382,14 @@ func (c *Client) GetEntityByName(ctx context.Context, name string) (*Entity, err
 			name, _ := record.Get("e.name")
 			entityType, _ := record.Get("e.type")
 			canonical, _ := record.Get("e.canonical_name")
+			aliases, _ := record.Get("aliases")
 
 			entity = &Entity{
 				ID:            id.(string),
 				Name:          name.(string),
 				Type:          entityType.(string),
 				CanonicalName: canonical.(string),
+				Aliases:       stringList(aliases),
 			}
 			return nil
 		}
@@ -381,45 +405,10 @@ func (c *Client) GetEntityByName(ctx context.Context, name string) (*Entity, err
 }
 
 func (c *Client) GetAllEntities(ctx context.Context) ([]Entity, error) {
-	var entities []Entity
-
-	err := c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
-		query := `
-			MATCH (e:Entity)
-			RETURN e.id, e.name, e.type, e.canonical_name
-			ORDER BY e.name
-		`
-
-		result, err := session.Run(ctx, query, nil)
-		if err != nil {
-			return fmt.Errorf("failed to get all entities: %w", err)
-		}
-
-		for result.Next(ctx) {
-			record := result.Record()
-			id, _ := record.Get("e.id")
-			name, _ := record.Get("e.name")
-			entityType, _ := record.Get("e.type")
-			canonical, _ := record.Get("e.canonical_name")
-
-			entities = append(entities, Entity{
-				ID:            id.(string),
-				Name:          name.(string),
-				Type:          entityType.(string),
-				CanonicalName: canonical.(string),
-			})
-		}
-
-		if err = result.Err(); err != nil {
-			return fmt.Errorf("error iterating results: %w", err)
-		}
-
-		return nil
-	})
-
+	page, err := c.GetEntities(ctx, EntityFilter{})
 	if err != nil {
 		return nil, err
 	}
 
-	return entities, nil
+	return page.Entities, nil
 }
@@ -0,0 +1,158 @@
+package neo4j
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+
+	"github.com/aws-agent/backend/pkg/circuitbreaker"
+	"github.com/aws-agent/backend/pkg/retry"
+)
+
+var errNoServer = errors.New("no server in tests")
+
+// mockDriver records the config of every session it opens. Its sessions
+// record each query and its parameters and answer it with reply, or fail it
+// when reply is nil, so tests can inspect what a client method would have
+// sent without a server. Write transactions run their work against the same
+// sessions.
+type mockDriver struct {
+	neo4j.DriverWithContext
+
+	reply func(cypher string) []*neo4j.Record
+
+	mu       sync.Mutex
+	sessions []neo4j.SessionConfig
+	queries  []string
+	params   []map[string]any
+}
+
+func (d *mockDriver) NewSession(ctx context.Context, config neo4j.SessionConfig) neo4j.SessionWithContext {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sessions = append(d.sessions, config)
+	return &mockSession{driver: d}
+}
+
+func (d *mockDriver) record(query string, params map[string]any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, query)
+	d.params = append(d.params, params)
+}
+
+type mockSession struct {
+	neo4j.SessionWithContext
+	driver *mockDriver
+}
+
+func (s *mockSession) Run(ctx context.Context, cypher string, params map[string]any, configurers ...func(*neo4j.TransactionConfig)) (neo4j.ResultWithContext, error) {
+	s.driver.record(cypher, params)
+	if s.driver.reply == nil {
+		return nil, errNoServer
+	}
+	return &mockResult{records: s.driver.reply(cypher)}, nil
+}
+
+func (s *mockSession) ExecuteRead(ctx context.Context, work neo4j.ManagedTransactionWork, configurers ...func(*neo4j.TransactionConfig)) (any, error) {
+	return nil, errNoServer
+}
+
+func (s *mockSession) ExecuteWrite(ctx context.Context, work neo4j.ManagedTransactionWork, configurers ...func(*neo4j.TransactionConfig)) (any, error) {
+	if s.driver.reply == nil {
+		return nil, errNoServer
+	}
+	return work(&mockTransaction{session: s})
+}
+
+func (s *mockSession) Close(ctx context.Context) error {
+	return nil
+}
+
+type mockTransaction struct {
+	neo4j.ManagedTransaction
+	session *mockSession
+}
+
+func (tx *mockTransaction) Run(ctx context.Context, cypher string, params map[string]any) (neo4j.ResultWithContext, error) {
+	return tx.session.Run(ctx, cypher, params)
+}
+
+// mockResult yields records in order.
+type mockResult struct {
+	neo4j.ResultWithContext
+	records []*neo4j.Record
+	current *neo4j.Record
+}
+
+func (r *mockResult) Next(ctx context.Context) bool {
+	if len(r.records) == 0 {
+		return false
+	}
+	r.current, r.records = r.records[0], r.records[1:]
+	return true
+}
+
+func (r *mockResult) Record() *neo4j.Record {
+	return r.current
+}
+
+func (r *mockResult) Err() error {
+	return nil
+}
+
+func (r *mockResult) Single(ctx context.Context) (*neo4j.Record, error) {
+	if len(r.records) != 1 {
+		return nil, errors.New("result does not contain exactly one record")
+	}
+	return r.records[0], nil
+}
+
+func (r *mockResult) Consume(ctx context.Context) (neo4j.ResultSummary, error) {
+	r.records = nil
+	return nil, nil
+}
+
+func newTestClient(driver *mockDriver, database string) *Client {
+	return &Client{
+		driver:      driver,
+		database:    database,
+		cb:          circuitbreaker.NewCircuitBreaker("neo4j-test", circuitbreaker.Config{FailureThreshold: 1000}),
+		retryConfig: retry.Config{MaxAttempts: 1},
+	}
+}
+
+func TestSessionsUseConfiguredDatabase(t *testing.T) {
+	driver := &mockDriver{}
+	client := newTestClient(driver, "analytics")
+	ctx := context.Background()
+
+	calls := map[string]func() error{
+		"CreateEntity": func() error { return client.CreateEntity(ctx, &Entity{ID: "e1", Name: "Lambda", Type: "service"}) },
+		"CreateRelation": func() error {
+			return client.CreateRelation(ctx, &Relation{Subject: "e1", Predicate: "USES", Object: "e2", Confidence: 0.9})
+		},
+		"SearchByEntities": func() error { _, err := client.SearchByEntities(ctx, []string{"Lambda"}, 0.5); return err },
+		"FindSolutions":    func() error { _, err := client.FindSolutions(ctx, "ThrottlingException", 0.5); return err },
+		"GetEntityByName":  func() error { _, err := client.GetEntityByName(ctx, "Lambda"); return err },
+		"GetAllEntities":   func() error { _, err := client.GetAllEntities(ctx); return err },
+	}
+
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, errNoServer) {
+			t.Errorf("%s: error = %v, want the session error", name, err)
+		}
+	}
+
+	if len(driver.sessions) < len(calls) {
+		t.Fatalf("opened %d sessions for %d calls", len(driver.sessions), len(calls))
+	}
+	for i, session := range driver.sessions {
+		if session.DatabaseName != "analytics" {
+			t.Errorf("session %d database = %q, want analytics", i, session.DatabaseName)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package neo4j
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+type EntityFilter struct {
+	Type   string
+	Name   string
+	Limit  int
+	Offset int
+}
+
+type EntityPage struct {
+	Entities []Entity
+	Total    int64
+	Limit    int
+	Offset   int
+}
+
+const entityFilterClause = `
+	MATCH (e:Entity)
+	WHERE ($type = '' OR e.type = $type)
+	  AND ($name = '' OR toLower(e.name) CONTAINS toLower($name))
+`
+
+func (c *Client) GetEntities(ctx context.Context, filter EntityFilter) (*EntityPage, error) {
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	if filter.Limit < 0 {
+		filter.Limit = 0
+	}
+
+	page := &EntityPage{
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}
+
+	params := map[string]interface{}{
+		"type":   filter.Type,
+		"name":   filter.Name,
+		"offset": filter.Offset,
+		"limit":  filter.Limit,
+	}
+
+	err := c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
+		countResult, err := session.Run(ctx, entityFilterClause+`RETURN count(e) AS total`, params)
+		if err != nil {
+			return fmt.Errorf("failed to count entities: %w", err)
+		}
+
+		countRecord, err := countResult.Single(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to count entities: %w", err)
+		}
+		total, _ := countRecord.Get("total")
+		page.Total, _ = total.(int64)
+
+		query := entityFilterClause + `
+			RETURN {id: e.id, name: e.name, type: e.type, canonical_name: e.canonical_name, aliases: coalesce(e.aliases, [])} AS entity
+			ORDER BY e.name
+			SKIP $offset
+		`
+		if filter.Limit > 0 {
+			query += ` LIMIT $limit`
+		}
+
+		result, err := session.Run(ctx, query, params)
+		if err != nil {
+			return fmt.Errorf("failed to get entities: %w", err)
+		}
+
+		page.Entities = nil
+		for result.Next(ctx) {
+			raw, _ := result.Record().Get("entity")
+			m, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			page.Entities = append(page.Entities, Entity{
+				ID:            mapString(m, "id"),
+				Name:          mapString(m, "name"),
+				Type:          mapString(m, "type"),
+				CanonicalName: mapString(m, "canonical_name"),
+				Aliases:       stringList(m["aliases"]),
+			})
+		}
+
+		if err = result.Err(); err != nil {
+			return fmt.Errorf("error iterating results: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+var ErrEntityNotFound = errors.New("entity not found")
+
+func (c *Client) AddAlias(ctx context.Context, entityID, alias string) error {
+	return c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
+		query := `
+			MATCH (e:Entity {id: $id})
+			SET e.aliases = CASE
+				WHEN $alias IN coalesce(e.aliases, []) THEN e.aliases
+				ELSE coalesce(e.aliases, []) + $alias
+			END
+			RETURN e.id
+		`
+
+		result, err := session.Run(ctx, query, map[string]interface{}{
+			"id":    entityID,
+			"alias": alias,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add alias: %w", err)
+		}
+
+		if !result.Next(ctx) {
+			if err := result.Err(); err != nil {
+				return fmt.Errorf("failed to add alias: %w", err)
+			}
+			return fmt.Errorf("%w: %s", ErrEntityNotFound, entityID)
+		}
+
+		logger.Debug("Entity alias added", zap.String("entity_id", entityID), zap.String("alias", alias))
+		return nil
+	})
+}
+
+func stringList(raw interface{}) []string {
+	items, _ := raw.([]interface{})
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
@@ -0,0 +1,106 @@
+package neo4j
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/metrics"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+func (c *Client) CountEntities(ctx context.Context) (map[string]int64, error) {
+	return c.countBy(ctx, `
+		MATCH (e:Entity)
+		RETURN coalesce(e.type, 'unknown') AS key, count(e) AS total
+	`)
+}
+
+func (c *Client) CountRelations(ctx context.Context) (map[string]int64, error) {
+	return c.countBy(ctx, `
+		MATCH ()-[r:RELATES]->()
+		RETURN coalesce(r.type, 'unknown') AS key, count(r) AS total
+	`)
+}
+
+func (c *Client) countBy(ctx context.Context, query string) (map[string]int64, error) {
+	counts := make(map[string]int64)
+
+	err := c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
+		result, err := session.Run(ctx, query, nil)
+		if err != nil {
+			return fmt.Errorf("failed to count graph elements: %w", err)
+		}
+
+		counts = make(map[string]int64)
+		for result.Next(ctx) {
+			record := result.Record()
+			key, _ := record.Get("key")
+			total, _ := record.Get("total")
+
+			name, _ := key.(string)
+			count, _ := total.(int64)
+			counts[name] += count
+		}
+
+		if err = result.Err(); err != nil {
+			return fmt.Errorf("error iterating results: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (c *Client) StartStatsRefresher(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			c.refreshStatsMetrics(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *Client) refreshStatsMetrics(ctx context.Context) {
+	entities, err := c.CountEntities(ctx)
+	if err != nil {
+		logger.Warn("Failed to refresh KG entity count", zap.Error(err))
+	} else {
+		metrics.KGEntitiesTotal.Set(float64(sumCounts(entities)))
+	}
+
+	relations, err := c.CountRelations(ctx)
+	if err != nil {
+		logger.Warn("Failed to refresh KG relation count", zap.Error(err))
+	} else {
+		metrics.KGRelationsTotal.Set(float64(sumCounts(relations)))
+	}
+}
+
+func sumCounts(counts map[string]int64) int64 {
+	var total int64
+	for _, count := range counts {
+		total += count
+	}
+	return total
+}
@@ -0,0 +1,75 @@
+package neo4j
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// seededGraph answers the counting queries the way Neo4j would for a graph
+// with the given entity types and relation predicates, an empty string
+// standing for a missing property.
+func seededGraph(entityTypes, predicates []string) func(cypher string) []*neo4j.Record {
+	group := func(values []string) []*neo4j.Record {
+		totals := make(map[string]int64)
+		var keys []string
+		for _, value := range values {
+			if value == "" {
+				value = "unknown"
+			}
+			if _, ok := totals[value]; !ok {
+				keys = append(keys, value)
+			}
+			totals[value]++
+		}
+
+		records := make([]*neo4j.Record, 0, len(keys))
+		for _, key := range keys {
+			records = append(records, &neo4j.Record{Keys: []string{"key", "total"}, Values: []any{key, totals[key]}})
+		}
+		return records
+	}
+
+	return func(cypher string) []*neo4j.Record {
+		switch {
+		case strings.Contains(cypher, "MATCH (e:Entity)"):
+			return group(entityTypes)
+		case strings.Contains(cypher, "[r:RELATES]"):
+			return group(predicates)
+		}
+		return nil
+	}
+}
+
+func TestCountGraphElements(t *testing.T) {
+	driver := &mockDriver{reply: seededGraph(
+		[]string{"service", "service", "error", ""},
+		[]string{"USES", "CAUSES", "USES"},
+	)}
+	client := newTestClient(driver, "neo4j")
+	ctx := context.Background()
+
+	entities, err := client.CountEntities(ctx)
+	if err != nil {
+		t.Fatalf("CountEntities: %v", err)
+	}
+	if want := map[string]int64{"service": 2, "error": 1, "unknown": 1}; !reflect.DeepEqual(entities, want) {
+		t.Errorf("entities = %v, want %v", entities, want)
+	}
+
+	relations, err := client.CountRelations(ctx)
+	if err != nil {
+		t.Fatalf("CountRelations: %v", err)
+	}
+	if want := map[string]int64{"USES": 2, "CAUSES": 1}; !reflect.DeepEqual(relations, want) {
+		t.Errorf("relations = %v, want %v", relations, want)
+	}
+
+	empty := newTestClient(&mockDriver{reply: seededGraph(nil, nil)}, "neo4j")
+	if counts, err := empty.CountEntities(ctx); err != nil || len(counts) != 0 {
+		t.Errorf("empty graph: counts = %v, err = %v; want no counts", counts, err)
+	}
+}
@@ -0,0 +1,196 @@
+package neo4j
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+const (
+	maxTraversalDepth      = 4
+	maxNeighborhoodTriples = 100
+	// maxCandidatePaths bounds the shortest paths scored by FindPaths, and
+	// maxNeighborhoodNodes the nodes ExpandNeighborhood visits, so dense
+	// hubs cannot blow up a traversal.
+	maxCandidatePaths    = 25
+	maxNeighborhoodNodes = 200
+)
+
+const relationProjection = `{
+	s_id: startNode(r).id, s_name: startNode(r).name, s_type: startNode(r).type, s_canonical: startNode(r).canonical_name,
+	predicate: r.type, confidence: r.confidence, source_docs: r.source_docs,
+	source_count: coalesce(r.source_count, size(coalesce(r.source_docs, []))),
+	o_id: endNode(r).id, o_name: endNode(r).name, o_type: endNode(r).type, o_canonical: endNode(r).canonical_name
+}`
+
+// FindPaths returns the triples along the most confident of the shortest
+// paths between two entities, or nil when they are not connected within
+// maxHops.
+func (c *Client) FindPaths(ctx context.Context, startEntity, endEntity string, maxHops int, minConfidence float64) ([]Triple, error) {
+	maxHops = clampDepth(maxHops)
+
+	var triples []Triple
+
+	err := c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
+		query := fmt.Sprintf(`
+			MATCH (s:Entity {name: $start}), (e:Entity {name: $end})
+			MATCH p = allShortestPaths((s)-[:RELATES*1..%d]-(e))
+			WHERE all(rel IN relationships(p) WHERE rel.confidence >= $min_confidence)
+			WITH p LIMIT $max_paths
+			WITH p, reduce(score = 1.0, rel IN relationships(p) | score * rel.confidence) AS score
+			ORDER BY score DESC
+			LIMIT 1
+			RETURN [r IN relationships(p) | %s] AS triples
+		`, maxHops, relationProjection)
+
+		result, err := session.Run(ctx, query, map[string]interface{}{
+			"start":          startEntity,
+			"end":            endEntity,
+			"min_confidence": minConfidence,
+			"max_paths":      maxCandidatePaths,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to find paths: %w", err)
+		}
+
+		triples = nil
+		if result.Next(ctx) {
+			raw, _ := result.Record().Get("triples")
+			if items, ok := raw.([]interface{}); ok {
+				for _, item := range items {
+					if m, ok := item.(map[string]interface{}); ok {
+						triples = append(triples, tripleFromMap(m))
+					}
+				}
+			}
+		}
+
+		if err = result.Err(); err != nil {
+			return fmt.Errorf("error iterating results: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("KG path search completed",
+		zap.String("start", startEntity),
+		zap.String("end", endEntity),
+		zap.Int("max_hops", maxHops),
+		zap.Int("path_length", len(triples)),
+	)
+
+	return triples, nil
+}
+
+// ExpandNeighborhood returns the most confident triples within depth hops of
+// entity. APOC's subgraph expansion visits each node once, unlike a
+// variable-length match that enumerates every path.
+func (c *Client) ExpandNeighborhood(ctx context.Context, entity string, depth int) ([]Triple, error) {
+	depth = clampDepth(depth)
+
+	var triples []Triple
+
+	err := c.executeWithRetry(ctx, func(session neo4j.SessionWithContext) error {
+		query := fmt.Sprintf(`
+			MATCH (s:Entity {name: $entity})
+			CALL apoc.path.subgraphAll(s, {relationshipFilter: 'RELATES', maxLevel: %d, limit: $max_nodes})
+			YIELD relationships
+			UNWIND relationships AS r
+			WITH DISTINCT r
+			ORDER BY r.confidence DESC
+			LIMIT $limit
+			RETURN %s AS triple
+		`, depth, relationProjection)
+
+		result, err := session.Run(ctx, query, map[string]interface{}{
+			"entity":    entity,
+			"limit":     maxNeighborhoodTriples,
+			"max_nodes": maxNeighborhoodNodes,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to expand neighborhood: %w", err)
+		}
+
+		triples = nil
+		for result.Next(ctx) {
+			raw, _ := result.Record().Get("triple")
+			if m, ok := raw.(map[string]interface{}); ok {
+				triples = append(triples, tripleFromMap(m))
+			}
+		}
+
+		if err = result.Err(); err != nil {
+			return fmt.Errorf("error iterating results: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("KG neighborhood expanded",
+		zap.String("entity", entity),
+		zap.Int("depth", depth),
+		zap.Int("results_found", len(triples)),
+	)
+
+	return triples, nil
+}
+
+func clampDepth(depth int) int {
+	if depth < 1 {
+		return 1
+	}
+	if depth > maxTraversalDepth {
+		return maxTraversalDepth
+	}
+	return depth
+}
+
+func tripleFromMap(m map[string]interface{}) Triple {
+	var sourceURLs []string
+	if docs, ok := m["source_docs"].([]interface{}); ok {
+		for _, doc := range docs {
+			if url, ok := doc.(string); ok {
+				sourceURLs = append(sourceURLs, url)
+			}
+		}
+	}
+
+	confidence, _ := m["confidence"].(float64)
+	sourceCount, _ := m["source_count"].(int64)
+
+	return Triple{
+		Subject: Entity{
+			ID:            mapString(m, "s_id"),
+			Name:          mapString(m, "s_name"),
+			Type:          mapString(m, "s_type"),
+			CanonicalName: mapString(m, "s_canonical"),
+		},
+		Predicate: mapString(m, "predicate"),
+		Object: Entity{
+			ID:            mapString(m, "o_id"),
+			Name:          mapString(m, "o_name"),
+			Type:          mapString(m, "o_type"),
+			CanonicalName: mapString(m, "o_canonical"),
+		},
+		Confidence:  confidence,
+		SourceURLs:  sourceURLs,
+		SourceCount: int(sourceCount),
+	}
+}
+
+func mapString(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
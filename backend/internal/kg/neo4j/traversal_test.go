@@ -0,0 +1,74 @@
+package neo4j
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws-agent/backend/pkg/circuitbreaker"
+)
+
+func TestTraversalQueriesAreBounded(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func(*Client) error
+		want []string
+	}{
+		{
+			name: "paths",
+			call: func(c *Client) error { _, err := c.FindPaths(ctx, "Lambda", "S3", 10, 0.5); return err },
+			want: []string{"allShortestPaths(", "[:RELATES*1..4]", "LIMIT $max_paths", "LIMIT 1"},
+		},
+		{
+			name: "neighborhood",
+			call: func(c *Client) error { _, err := c.ExpandNeighborhood(ctx, "Lambda", 0); return err },
+			want: []string{"apoc.path.subgraphAll(", "maxLevel: 1", "limit: $max_nodes", "LIMIT $limit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &mockDriver{}
+			if err := tt.call(newTestClient(driver, "neo4j")); !errors.Is(err, errNoServer) {
+				t.Fatalf("error = %v, want the session error", err)
+			}
+			if len(driver.queries) != 1 {
+				t.Fatalf("ran %d queries, want 1", len(driver.queries))
+			}
+			for _, fragment := range tt.want {
+				if !strings.Contains(driver.queries[0], fragment) {
+					t.Errorf("query does not contain %q:\n%s", fragment, driver.queries[0])
+				}
+			}
+		})
+	}
+}
+
+func TestTraversalRespectsCircuitBreaker(t *testing.T) {
+	driver := &mockDriver{}
+	client := newTestClient(driver, "neo4j")
+	client.cb = circuitbreaker.NewCircuitBreaker("neo4j-test", circuitbreaker.Config{FailureThreshold: 1})
+	ctx := context.Background()
+
+	// The first failure opens the breaker.
+	if _, err := client.FindPaths(ctx, "Lambda", "S3", 2, 0.5); !errors.Is(err, errNoServer) {
+		t.Fatalf("first call error = %v, want the session error", err)
+	}
+	if _, err := client.ExpandNeighborhood(ctx, "Lambda", 2); err == nil || errors.Is(err, errNoServer) {
+		t.Fatalf("second call error = %v, want the open breaker to reject it", err)
+	}
+	if len(driver.sessions) != 1 {
+		t.Errorf("opened %d sessions, want none after the breaker opened", len(driver.sessions)-1)
+	}
+}
+
+func TestClampDepth(t *testing.T) {
+	for depth, want := range map[int]int{-1: 1, 0: 1, 1: 1, 3: 3, maxTraversalDepth: maxTraversalDepth, 50: maxTraversalDepth} {
+		if got := clampDepth(depth); got != want {
+			t.Errorf("clampDepth(%d) = %d, want %d", depth, got, want)
+		}
+	}
+}
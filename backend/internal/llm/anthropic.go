@@ -0,0 +1,242 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws-agent/backend/pkg/retry"
+)
+
+const (
+	anthropicEndpoint = "https://api.anthropic.com/v1/messages"
+	anthropicVersion  = "2023-06-01"
+)
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	AnthropicVersion string             `json:"anthropic_version,omitempty"`
+	Model            string             `json:"model,omitempty"`
+	System           string             `json:"system,omitempty"`
+	Messages         []anthropicMessage `json:"messages"`
+	MaxTokens        int                `json:"max_tokens"`
+	Temperature      float32            `json:"temperature"`
+	Stream           bool               `json:"stream,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage anthropicUsage `json:"usage"`
+}
+
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type anthropicProvider struct {
+	apiKey     string
+	endpoint   string
+	httpClient *http.Client
+}
+
+func newAnthropicProvider(apiKey string) *anthropicProvider {
+	return newAnthropicProviderWithEndpoint(apiKey, anthropicEndpoint)
+}
+
+func newAnthropicProviderWithEndpoint(apiKey, endpoint string) *anthropicProvider {
+	return &anthropicProvider{
+		apiKey:   apiKey,
+		endpoint: endpoint,
+		httpClient: &http.Client{
+			Timeout: 2 * time.Minute,
+		},
+	}
+}
+
+func (p *anthropicProvider) Name() string {
+	return "anthropic"
+}
+
+func (p *anthropicProvider) Complete(ctx context.Context, model string, req CompletionRequest) (*CompletionResponse, error) {
+	resp, err := p.post(ctx, newAnthropicRequest(model, req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode completion: %w", err)
+	}
+
+	return result.toCompletion(), nil
+}
+
+func (p *anthropicProvider) CompleteStream(ctx context.Context, model string, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error) {
+	resp, err := p.post(ctx, newAnthropicRequest(model, req, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	stream := anthropicStream{onDelta: onDelta}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		if err := stream.handle([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:")))); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read completion stream: %w", err)
+	}
+
+	return stream.response(), nil
+}
+
+// anthropicStream assembles a completion from Messages API stream events,
+// forwarding each text delta as it arrives. Bedrock wraps the same events in
+// its own event stream.
+type anthropicStream struct {
+	onDelta StreamFunc
+	content strings.Builder
+	usage   anthropicUsage
+}
+
+func (s *anthropicStream) handle(data []byte) error {
+	var event anthropicStreamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("failed to decode stream event: %w", err)
+	}
+
+	switch event.Type {
+	case "message_start":
+		s.usage.InputTokens = event.Message.Usage.InputTokens
+	case "content_block_delta":
+		if event.Delta.Text == "" {
+			return nil
+		}
+		s.content.WriteString(event.Delta.Text)
+		if err := s.onDelta(event.Delta.Text); err != nil {
+			return fmt.Errorf("failed to forward completion delta: %w", err)
+		}
+	case "message_delta":
+		s.usage.OutputTokens = event.Usage.OutputTokens
+	case "error":
+		return fmt.Errorf("completion stream error: %s", event.Error.Message)
+	}
+
+	return nil
+}
+
+func (s *anthropicStream) response() *CompletionResponse {
+	return &CompletionResponse{
+		Content: s.content.String(),
+		Usage:   s.usage.toUsage(),
+	}
+}
+
+func (p *anthropicProvider) GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	return nil, ErrEmbeddingsUnsupported
+}
+
+func (p *anthropicProvider) post(ctx context.Context, body anthropicRequest) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal completion request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create completion request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create completion: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("completion request returned %w", &retry.StatusError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		})
+	}
+
+	return resp, nil
+}
+
+func newAnthropicRequest(model string, req CompletionRequest, stream bool) anthropicRequest {
+	return anthropicRequest{
+		Model:       model,
+		System:      req.SystemPrompt,
+		Messages:    []anthropicMessage{{Role: "user", Content: req.UserPrompt}},
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Stream:      stream,
+	}
+}
+
+func (r anthropicResponse) toCompletion() *CompletionResponse {
+	var content strings.Builder
+	for _, block := range r.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	return &CompletionResponse{
+		Content: content.String(),
+		Usage:   r.Usage.toUsage(),
+	}
+}
+
+func (u anthropicUsage) toUsage() Usage {
+	return Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+}
@@ -0,0 +1,217 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws-agent/backend/pkg/retry"
+)
+
+// newAnthropicServer serves handler as the Messages API and returns a
+// provider pointed at it.
+func newAnthropicServer(t *testing.T, handler http.HandlerFunc) *anthropicProvider {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return newAnthropicProviderWithEndpoint("sk-test", server.URL+"/v1/messages")
+}
+
+// writeSSE writes events as a server-sent event stream, each with its event
+// line as the API sends them.
+func writeSSE(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, event := range events {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal([]byte(event), &typed)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+	}
+}
+
+func TestAnthropicCompleteMapsRequest(t *testing.T) {
+	var gotPath, gotKey, gotVersion, gotType string
+	var gotBody map[string]interface{}
+	p := newAnthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-api-key")
+		gotVersion = r.Header.Get("anthropic-version")
+		gotType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{
+				{"type": "text", "text": "Raise the "},
+				{"type": "tool_use"},
+				{"type": "text", "text": "timeout."},
+			},
+			"usage": map[string]int{"input_tokens": 12, "output_tokens": 4},
+		})
+	})
+
+	resp, err := p.Complete(context.Background(), "claude-3-haiku", CompletionRequest{
+		SystemPrompt: "You are an AWS expert.",
+		UserPrompt:   "Why does Lambda time out?",
+		Temperature:  0.5,
+		MaxTokens:    256,
+	})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	if resp.Content != "Raise the timeout." {
+		t.Errorf("content = %q, want the text blocks joined", resp.Content)
+	}
+	if want := (Usage{PromptTokens: 12, CompletionTokens: 4, TotalTokens: 16}); resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+
+	if gotPath != "/v1/messages" || gotKey != "sk-test" || gotVersion != anthropicVersion || gotType != "application/json" {
+		t.Errorf("path %q, key %q, version %q, content type %q", gotPath, gotKey, gotVersion, gotType)
+	}
+	wantBody := map[string]interface{}{
+		"model":       "claude-3-haiku",
+		"system":      "You are an AWS expert.",
+		"messages":    []interface{}{map[string]interface{}{"role": "user", "content": "Why does Lambda time out?"}},
+		"max_tokens":  float64(256),
+		"temperature": 0.5,
+	}
+	if !reflect.DeepEqual(gotBody, wantBody) {
+		t.Errorf("request body = %v, want %v", gotBody, wantBody)
+	}
+}
+
+func TestAnthropicErrorsCarryStatus(t *testing.T) {
+	p := newAnthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`+"\n")
+	})
+
+	for name, call := range map[string]func() error{
+		"complete": func() error {
+			_, err := p.Complete(context.Background(), "claude-3-haiku", CompletionRequest{UserPrompt: "hi"})
+			return err
+		},
+		"stream": func() error {
+			_, err := p.CompleteStream(context.Background(), "claude-3-haiku", CompletionRequest{UserPrompt: "hi"},
+				func(string) error { return nil })
+			return err
+		},
+	} {
+		err := call()
+		var statusErr *retry.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests ||
+			!strings.Contains(statusErr.Message, "slow down") {
+			t.Errorf("%s: error = %v, want a 429 status error with the response body", name, err)
+		}
+	}
+}
+
+func TestAnthropicCompleteStream(t *testing.T) {
+	var stream interface{}
+	p := newAnthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		stream = body["stream"]
+		writeSSE(w,
+			`{"type":"message_start","message":{"usage":{"input_tokens":25,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"ping"}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Increase "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"the timeout."}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`,
+			`{"type":"message_stop"}`,
+		)
+	})
+
+	var deltas []string
+	resp, err := p.CompleteStream(context.Background(), "claude-3-haiku", CompletionRequest{UserPrompt: "hi"},
+		func(delta string) error {
+			deltas = append(deltas, delta)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("CompleteStream: %v", err)
+	}
+
+	if stream != true {
+		t.Errorf("stream = %v, want true in the request", stream)
+	}
+	if !reflect.DeepEqual(deltas, []string{"Increase ", "the timeout."}) {
+		t.Errorf("deltas = %q, want the non-empty text deltas in order", deltas)
+	}
+	if resp.Content != "Increase the timeout." {
+		t.Errorf("content = %q, want the deltas joined", resp.Content)
+	}
+	// Output tokens come from message_delta, not the placeholder in message_start.
+	if want := (Usage{PromptTokens: 25, CompletionTokens: 7, TotalTokens: 32}); resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+}
+
+func TestAnthropicCompleteStreamErrors(t *testing.T) {
+	t.Run("error event", func(t *testing.T) {
+		p := newAnthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+			writeSSE(w,
+				`{"type":"message_start","message":{"usage":{"input_tokens":25}}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Partial"}}`,
+				`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			)
+		})
+
+		var deltas []string
+		_, err := p.CompleteStream(context.Background(), "claude-3-haiku", CompletionRequest{UserPrompt: "hi"},
+			func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+		if err == nil || !strings.Contains(err.Error(), "Overloaded") {
+			t.Errorf("error = %v, want the stream error message", err)
+		}
+		if !reflect.DeepEqual(deltas, []string{"Partial"}) {
+			t.Errorf("deltas = %q, want the text sent before the error", deltas)
+		}
+	})
+
+	t.Run("malformed event", func(t *testing.T) {
+		p := newAnthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "event: content_block_delta\ndata: {not json\n\n")
+		})
+
+		_, err := p.CompleteStream(context.Background(), "claude-3-haiku", CompletionRequest{UserPrompt: "hi"},
+			func(string) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "decode stream event") {
+			t.Errorf("error = %v, want a decode error", err)
+		}
+	})
+
+	t.Run("delta callback fails", func(t *testing.T) {
+		p := newAnthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+			writeSSE(w,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"one"}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"two"}}`,
+			)
+		})
+
+		clientGone := errors.New("client disconnected")
+		calls := 0
+		_, err := p.CompleteStream(context.Background(), "claude-3-haiku", CompletionRequest{UserPrompt: "hi"},
+			func(string) error {
+				calls++
+				return clientGone
+			})
+		if !errors.Is(err, clientGone) || calls != 1 {
+			t.Errorf("error = %v after %d calls, want the callback error after the first delta", err, calls)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+
+	"github.com/aws-agent/backend/pkg/awsauth"
+	"github.com/aws-agent/backend/pkg/retry"
+)
+
+const (
+	bedrockService = "bedrock"
+	bedrockVersion = "bedrock-2023-05-31"
+)
+
+type bedrockProvider struct {
+	aws        aws.Config
+	endpoint   string
+	httpClient *http.Client
+}
+
+// newBedrockProvider resolves credentials and, when region is empty, the
+// region through the AWS SDK default chain, so instance and task roles work
+// without keys in the environment.
+func newBedrockProvider(region string) (*bedrockProvider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	awsCfg, err := awsauth.LoadConfig(ctx, region)
+	if err != nil {
+		return nil, fmt.Errorf("bedrock provider requires AWS configuration: %w", err)
+	}
+
+	if _, err := awsCfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("bedrock provider requires AWS credentials: %w", err)
+	}
+
+	return newBedrockProviderWithConfig(awsCfg, ""), nil
+}
+
+func newBedrockProviderWithConfig(awsCfg aws.Config, endpoint string) *bedrockProvider {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", awsCfg.Region)
+	}
+
+	return &bedrockProvider{
+		aws:      awsCfg,
+		endpoint: endpoint,
+		httpClient: &http.Client{
+			Timeout: 2 * time.Minute,
+		},
+	}
+}
+
+func (p *bedrockProvider) Name() string {
+	return "bedrock"
+}
+
+func (p *bedrockProvider) Complete(ctx context.Context, model string, req CompletionRequest) (*CompletionResponse, error) {
+	body := newAnthropicRequest("", req, false)
+	body.AnthropicVersion = bedrockVersion
+
+	var result anthropicResponse
+	if err := p.invoke(ctx, model, body, &result); err != nil {
+		return nil, fmt.Errorf("failed to create completion: %w", err)
+	}
+
+	return result.toCompletion(), nil
+}
+
+// CompleteStream calls invoke-with-response-stream and forwards each text
+// delta as Bedrock sends it. The response is an AWS event stream whose chunk
+// events carry Messages API stream events, base64 encoded.
+func (p *bedrockProvider) CompleteStream(ctx context.Context, model string, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error) {
+	body := newAnthropicRequest("", req, false)
+	body.AnthropicVersion = bedrockVersion
+
+	resp, err := p.post(ctx, model, "invoke-with-response-stream", "application/vnd.amazon.eventstream", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create completion: %w", err)
+	}
+	defer resp.Body.Close()
+
+	stream := anthropicStream{onDelta: onDelta}
+	decoder := eventstream.NewDecoder()
+	var payload []byte
+
+	for {
+		msg, err := decoder.Decode(resp.Body, payload)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read completion stream: %w", err)
+		}
+		payload = msg.Payload[:0]
+
+		switch eventHeader(msg, ":message-type") {
+		case "event":
+			if eventHeader(msg, ":event-type") != "chunk" {
+				continue
+			}
+			var chunk struct {
+				Bytes []byte `json:"bytes"`
+			}
+			if err := json.Unmarshal(msg.Payload, &chunk); err != nil {
+				return nil, fmt.Errorf("failed to decode stream chunk: %w", err)
+			}
+			if err := stream.handle(chunk.Bytes); err != nil {
+				return nil, err
+			}
+		case "exception":
+			var exception struct {
+				Message string `json:"message"`
+			}
+			json.Unmarshal(msg.Payload, &exception)
+			return nil, fmt.Errorf("completion stream %s: %s", eventHeader(msg, ":exception-type"), exception.Message)
+		case "error":
+			return nil, fmt.Errorf("completion stream %s: %s", eventHeader(msg, ":error-code"), eventHeader(msg, ":error-message"))
+		}
+	}
+
+	return stream.response(), nil
+}
+
+func eventHeader(msg eventstream.Message, name string) string {
+	if value := msg.Headers.Get(name); value != nil {
+		return value.String()
+	}
+	return ""
+}
+
+func (p *bedrockProvider) GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+
+	for _, text := range texts {
+		var result struct {
+			Embedding []float32 `json:"embedding"`
+		}
+
+		if err := p.invoke(ctx, model, map[string]string{"inputText": text}, &result); err != nil {
+			return nil, fmt.Errorf("failed to generate embeddings: %w", err)
+		}
+
+		embeddings = append(embeddings, result.Embedding)
+	}
+
+	return embeddings, nil
+}
+
+func (p *bedrockProvider) invoke(ctx context.Context, model string, body, out interface{}) error {
+	resp, err := p.post(ctx, model, "invoke", "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// post sends a signed request to the model's action, invoke or
+// invoke-with-response-stream, and returns the response if it succeeded.
+func (p *bedrockProvider) post(ctx context.Context, model, action, accept string, body interface{}) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint, err := url.Parse(p.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endpoint: %w", err)
+	}
+	escapedModel := strings.ReplaceAll(url.PathEscape(model), ":", "%3A")
+	endpoint.Path = "/model/" + model + "/" + action
+	endpoint.RawPath = "/model/" + escapedModel + "/" + action
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+
+	if err := awsauth.Sign(ctx, p.aws, req, payload, bedrockService); err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to invoke model: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("model invocation returned %w", &retry.StatusError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		})
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,272 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+
+	"github.com/aws-agent/backend/pkg/retry"
+)
+
+// isolateAWSEnv points the SDK default chain at files under a temp dir and
+// clears ambient credentials, so tests only see what they configure.
+func isolateAWSEnv(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_PROFILE", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestNewBedrockProviderDefaultChain(t *testing.T) {
+	dir := isolateAWSEnv(t)
+	writeFile(t, filepath.Join(dir, "config"), "[default]\nregion = ap-south-1\n")
+	writeFile(t, filepath.Join(dir, "credentials"),
+		"[default]\naws_access_key_id = AKIDFILE\naws_secret_access_key = secret\n")
+
+	p, err := newBedrockProvider("")
+	if err != nil {
+		t.Fatalf("newBedrockProvider: %v", err)
+	}
+	if p.aws.Region != "ap-south-1" {
+		t.Errorf("region = %q, want the shared config region", p.aws.Region)
+	}
+	if p.endpoint != "https://bedrock-runtime.ap-south-1.amazonaws.com" {
+		t.Errorf("endpoint = %q", p.endpoint)
+	}
+
+	p, err = newBedrockProvider("us-west-2")
+	if err != nil {
+		t.Fatalf("newBedrockProvider with region: %v", err)
+	}
+	if p.aws.Region != "us-west-2" {
+		t.Errorf("region = %q, want the configured override", p.aws.Region)
+	}
+}
+
+func TestNewBedrockProviderRequiresRegionAndCredentials(t *testing.T) {
+	isolateAWSEnv(t)
+
+	if _, err := newBedrockProvider(""); err == nil {
+		t.Error("created a provider without a region")
+	}
+	if _, err := newBedrockProvider("us-east-1"); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Errorf("error = %v, want a missing credentials error", err)
+	}
+}
+
+func TestBedrockCompleteSignsRequests(t *testing.T) {
+	var gotPath, gotAuth, gotToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAuth = r.Header.Get("Authorization")
+		gotToken = r.Header.Get("X-Amz-Security-Token")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": "Raise the timeout."}},
+			"usage":   map[string]int{"input_tokens": 12, "output_tokens": 4},
+		})
+	}))
+	defer server.Close()
+
+	provider := newBedrockProviderWithConfig(aws.Config{
+		Region:      "eu-west-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDTEST", "secret", "session"),
+	}, server.URL)
+	client := NewClientWithProviders(Config{Model: "anthropic.claude-v2:1"}, provider, nil)
+
+	resp, err := client.Complete(context.Background(), CompletionRequest{
+		UserPrompt: "Why does Lambda time out?",
+	})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	if resp.Content != "Raise the timeout." || resp.Usage.TotalTokens != 16 {
+		t.Errorf("response = %+v, want the decoded completion", resp)
+	}
+	if gotPath != "/model/anthropic.claude-v2%3A1/invoke" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKIDTEST/") ||
+		!strings.Contains(gotAuth, "/eu-west-1/bedrock/aws4_request") {
+		t.Errorf("authorization = %q, want a SigV4 signature for bedrock in eu-west-1", gotAuth)
+	}
+	if gotToken != "session" {
+		t.Errorf("security token = %q, want the session token", gotToken)
+	}
+}
+
+// writeBedrockEvent writes one AWS event stream message as Bedrock sends it
+// from invoke-with-response-stream, flushing so it reaches the client alone.
+func writeBedrockEvent(t *testing.T, w http.ResponseWriter, messageType string, headers map[string]string, payload interface{}) {
+	t.Helper()
+
+	msg := eventstream.Message{}
+	msg.Headers.Set(":message-type", eventstream.StringValue(messageType))
+	for name, value := range headers {
+		msg.Headers.Set(name, eventstream.StringValue(value))
+	}
+	msg.Payload, _ = json.Marshal(payload)
+	if err := eventstream.NewEncoder().Encode(w, msg); err != nil {
+		t.Errorf("encode event: %v", err)
+	}
+	w.(http.Flusher).Flush()
+}
+
+// bedrockChunk wraps a Messages API stream event in a Bedrock chunk payload.
+func bedrockChunk(event string) interface{} {
+	return map[string][]byte{"bytes": []byte(event)}
+}
+
+func newStreamingBedrock(t *testing.T, handler http.HandlerFunc) *bedrockProvider {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return newBedrockProviderWithConfig(aws.Config{
+		Region:      "eu-west-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDTEST", "secret", ""),
+	}, server.URL)
+}
+
+func TestBedrockCompleteStream(t *testing.T) {
+	chunk := map[string]string{":event-type": "chunk"}
+	firstDelta := make(chan struct{})
+	var gotPath, gotAccept string
+	var gotBody map[string]interface{}
+	p := newStreamingBedrock(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAccept = r.Header.Get("Accept")
+		json.NewDecoder(r.Body).Decode(&gotBody)
+
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		writeBedrockEvent(t, w, "event", chunk, bedrockChunk(`{"type":"message_start","message":{"usage":{"input_tokens":25,"output_tokens":1}}}`))
+		writeBedrockEvent(t, w, "event", chunk, bedrockChunk(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Increase "}}`))
+		// The rest is only sent once the first delta has been forwarded, so
+		// a provider that waits for the whole completion would hang here.
+		select {
+		case <-firstDelta:
+		case <-time.After(5 * time.Second):
+			t.Error("first delta was not forwarded before the stream ended")
+		}
+		writeBedrockEvent(t, w, "event", chunk, bedrockChunk(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"the timeout."}}`))
+		writeBedrockEvent(t, w, "event", chunk, bedrockChunk(`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":7}}`))
+		writeBedrockEvent(t, w, "event", chunk, bedrockChunk(`{"type":"message_stop","amazon-bedrock-invocationMetrics":{"inputTokenCount":25,"outputTokenCount":7}}`))
+	})
+
+	var deltas []string
+	resp, err := p.CompleteStream(context.Background(), "anthropic.claude-v2:1", CompletionRequest{UserPrompt: "hi", MaxTokens: 64},
+		func(delta string) error {
+			if len(deltas) == 0 {
+				close(firstDelta)
+			}
+			deltas = append(deltas, delta)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("CompleteStream: %v", err)
+	}
+
+	if gotPath != "/model/anthropic.claude-v2%3A1/invoke-with-response-stream" {
+		t.Errorf("path = %q, want the streaming action", gotPath)
+	}
+	if gotAccept != "application/vnd.amazon.eventstream" {
+		t.Errorf("accept = %q, want an event stream", gotAccept)
+	}
+	if _, ok := gotBody["stream"]; ok || gotBody["anthropic_version"] != bedrockVersion {
+		t.Errorf("request body = %v, want the Bedrock version and no stream flag", gotBody)
+	}
+	if !reflect.DeepEqual(deltas, []string{"Increase ", "the timeout."}) {
+		t.Errorf("deltas = %q, want each text delta as it arrived", deltas)
+	}
+	if resp.Content != "Increase the timeout." {
+		t.Errorf("content = %q, want the deltas joined", resp.Content)
+	}
+	if want := (Usage{PromptTokens: 25, CompletionTokens: 7, TotalTokens: 32}); resp.Usage != want {
+		t.Errorf("usage = %+v, want %+v", resp.Usage, want)
+	}
+}
+
+func TestBedrockCompleteStreamErrors(t *testing.T) {
+	t.Run("exception event", func(t *testing.T) {
+		p := newStreamingBedrock(t, func(w http.ResponseWriter, r *http.Request) {
+			writeBedrockEvent(t, w, "event", map[string]string{":event-type": "chunk"},
+				bedrockChunk(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Partial"}}`))
+			writeBedrockEvent(t, w, "exception", map[string]string{":exception-type": "throttlingException"},
+				map[string]string{"message": "Too many requests"})
+		})
+
+		_, err := p.CompleteStream(context.Background(), "anthropic.claude-v2", CompletionRequest{UserPrompt: "hi"},
+			func(string) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "throttlingException") || !strings.Contains(err.Error(), "Too many requests") {
+			t.Errorf("error = %v, want the stream exception", err)
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		p := newStreamingBedrock(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"message":"slow down"}`)
+		})
+
+		_, err := p.CompleteStream(context.Background(), "anthropic.claude-v2", CompletionRequest{UserPrompt: "hi"},
+			func(string) error { return nil })
+		var statusErr *retry.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("error = %v, want a 429 status error", err)
+		}
+	})
+
+	t.Run("cancelled mid-stream", func(t *testing.T) {
+		release := make(chan struct{})
+		t.Cleanup(func() { close(release) })
+		p := newStreamingBedrock(t, func(w http.ResponseWriter, r *http.Request) {
+			writeBedrockEvent(t, w, "event", map[string]string{":event-type": "chunk"},
+				bedrockChunk(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Partial"}}`))
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := p.CompleteStream(ctx, "anthropic.claude-v2", CompletionRequest{UserPrompt: "hi"},
+			func(string) error {
+				cancel()
+				return nil
+			})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error = %v, want the stream abandoned when the context is cancelled", err)
+		}
+	})
+}
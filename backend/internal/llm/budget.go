@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/metrics"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+type callBudgetKey struct{}
+
+type callBudget struct {
+	limit int32
+	used  atomic.Int32
+}
+
+// WithCallBudget limits the optional LLM calls made while serving one
+// request to limit. Stages that cannot be skipped, such as generating the
+// answer, do not draw from the budget, so callers size it net of those.
+func WithCallBudget(ctx context.Context, limit int) context.Context {
+	if limit < 0 {
+		limit = 0
+	}
+	return context.WithValue(ctx, callBudgetKey{}, &callBudget{limit: int32(limit)})
+}
+
+// AcquireCall takes one call from the request's budget for an optional
+// stage. It returns false, and the stage should be skipped, once the budget
+// is spent. Contexts without a budget are unlimited.
+func AcquireCall(ctx context.Context, stage string) bool {
+	budget, ok := ctx.Value(callBudgetKey{}).(*callBudget)
+	if !ok {
+		return true
+	}
+
+	for {
+		used := budget.used.Load()
+		if used >= budget.limit {
+			metrics.LLMStagesSkipped.WithLabelValues(stage).Inc()
+			logger.Info("LLM call budget exhausted, skipping stage",
+				zap.String("stage", stage),
+				zap.Int32("used", used),
+				zap.Int32("limit", budget.limit),
+			)
+			return false
+		}
+		if budget.used.CompareAndSwap(used, used+1) {
+			return true
+		}
+	}
+}
+
+// CallsUsed reports the optional calls taken from the request's budget.
+func CallsUsed(ctx context.Context) int {
+	if budget, ok := ctx.Value(callBudgetKey{}).(*callBudget); ok {
+		return int(budget.used.Load())
+	}
+	return 0
+}
+
+type tokenMeterKey struct{}
+
+// WithTokenMeter counts the tokens of every LLM call made with the returned
+// context, prompts and embeddings included, so a request can be charged for
+// all the calls it caused rather than only its answer.
+func WithTokenMeter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tokenMeterKey{}, new(atomic.Int64))
+}
+
+// TokensUsed reports the tokens counted by the meter in ctx.
+func TokensUsed(ctx context.Context) int {
+	if meter, ok := ctx.Value(tokenMeterKey{}).(*atomic.Int64); ok {
+		return int(meter.Load())
+	}
+	return 0
+}
+
+func meterTokens(ctx context.Context, usage Usage) {
+	meter, ok := ctx.Value(tokenMeterKey{}).(*atomic.Int64)
+	if !ok {
+		return
+	}
+
+	tokens := usage.TotalTokens
+	if tokens <= 0 {
+		tokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	meter.Add(int64(tokens))
+}
@@ -2,26 +2,40 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	openai "github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 
+	"github.com/aws-agent/backend/internal/cache/redis"
+	"github.com/aws-agent/backend/internal/metrics"
 	"github.com/aws-agent/backend/pkg/circuitbreaker"
 	"github.com/aws-agent/backend/pkg/logger"
 	"github.com/aws-agent/backend/pkg/retry"
+	"github.com/aws-agent/backend/pkg/tokenizer"
+	"github.com/aws-agent/backend/pkg/utils"
 )
 
 type Client struct {
-	client         *openai.Client
-	model          string
-	embeddingModel string
-	temperature    float32
-	maxTokens      int
-	cb             *circuitbreaker.CircuitBreaker
-	retryConfig    retry.Config
+	provider             Provider
+	embedder             Provider
+	model                string
+	embeddingModel       string
+	embeddingDim         int
+	temperature          float32
+	maxTokens            int
+	cb                   *circuitbreaker.CircuitBreaker
+	retryConfig          retry.Config
+	embeddingCache       *redis.Client
+	embeddingTTL         time.Duration
+	costs                *CostEstimator
+	requestSlots         chan struct{}
+	embeddingConcurrency int
 }
 
 type CompletionRequest struct {
@@ -36,14 +50,40 @@ type CompletionResponse struct {
 	Usage   Usage
 }
 
+type StreamFunc func(delta string) error
+
 type Usage struct {
 	PromptTokens     int
 	CompletionTokens int
 	TotalTokens      int
 }
 
-func NewClient(apiKey, model, embeddingModel string, temperature float32, maxTokens int) *Client {
-	client := openai.NewClient(apiKey)
+func NewClient(cfg Config) (*Client, error) {
+	provider, err := NewProvider(cfg.Provider, cfg.APIKey, cfg.Region)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LLM provider: %w", err)
+	}
+
+	embedder := provider
+	if name := embeddingProviderName(cfg); name != provider.Name() {
+		embedder, err = NewProvider(name, cfg.EmbeddingAPIKey, cfg.Region)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create embedding provider: %w", err)
+		}
+	}
+	if p, ok := embedder.(*openAIProvider); ok {
+		p.dimensions = requestedEmbeddingDim(cfg.EmbeddingModel, cfg.EmbeddingDim)
+	}
+
+	return NewClientWithProviders(cfg, provider, embedder), nil
+}
+
+// NewClientWithProviders builds a client around providers that are already
+// constructed, such as fakes in tests. A nil embedder embeds with provider.
+func NewClientWithProviders(cfg Config, provider, embedder Provider) *Client {
+	if embedder == nil {
+		embedder = provider
+	}
 
 	cb := circuitbreaker.NewCircuitBreaker("llm", circuitbreaker.Config{
 		MaxRequests:      5,
@@ -51,6 +91,7 @@ func NewClient(apiKey, model, embeddingModel string, temperature float32, maxTok
 		Timeout:          30 * time.Second,
 		FailureThreshold: 5,
 		SuccessThreshold: 2,
+		OnStateChange:    metrics.RecordCircuitBreakerState,
 		Logger:           logger.GetLogger(),
 	})
 
@@ -60,25 +101,52 @@ func NewClient(apiKey, model, embeddingModel string, temperature float32, maxTok
 		MaxDelay:       5 * time.Second,
 		Multiplier:     2.0,
 		JitterFraction: 0.1,
+		Classifier:     IsRetryableError,
 		Logger:         logger.GetLogger(),
 	}
 
+	embeddingConcurrency := cfg.EmbeddingConcurrency
+	if embeddingConcurrency <= 0 {
+		embeddingConcurrency = 1
+	}
+
 	logger.Info("LLM client initialized",
-		zap.String("model", model),
-		zap.String("embedding_model", embeddingModel),
+		zap.String("provider", provider.Name()),
+		zap.String("embedding_provider", embedder.Name()),
+		zap.String("model", cfg.Model),
+		zap.String("embedding_model", cfg.EmbeddingModel),
 	)
 
 	return &Client{
-		client:         client,
-		model:          model,
-		embeddingModel: embeddingModel,
-		temperature:    temperature,
-		maxTokens:      maxTokens,
-		cb:             cb,
-		retryConfig:    retryConfig,
+		provider:             provider,
+		embedder:             embedder,
+		model:                cfg.Model,
+		embeddingModel:       cfg.EmbeddingModel,
+		embeddingDim:         cfg.EmbeddingDim,
+		temperature:          cfg.Temperature,
+		maxTokens:            cfg.MaxTokens,
+		cb:                   cb,
+		retryConfig:          retryConfig,
+		costs:                NewCostEstimator(cfg.Pricing),
+		requestSlots:         newRequestSlots(cfg.MaxConcurrentRequests),
+		embeddingConcurrency: embeddingConcurrency,
 	}
 }
 
+func (c *Client) EmbeddingDim() int {
+	return c.embeddingDim
+}
+
+func (c *Client) EmbeddingModel() string {
+	return c.embeddingModel
+}
+
+func (c *Client) WithEmbeddingCache(cache *redis.Client, ttl time.Duration) *Client {
+	c.embeddingCache = cache
+	c.embeddingTTL = ttl
+	return c
+}
+
 func (c *Client) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
@@ -93,48 +161,33 @@ func (c *Client) Complete(ctx context.Context, req CompletionRequest) (*Completi
 		maxTokens = c.maxTokens
 	}
 
-	messages := []openai.ChatCompletionMessage{
-		{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: req.SystemPrompt,
-		},
-		{
-			Role:    openai.ChatMessageRoleUser,
-			Content: req.UserPrompt,
-		},
-	}
-
 	var result *CompletionResponse
 
 	err := c.cb.Execute(ctx, func() error {
 		return retry.Do(ctx, c.retryConfig, func() error {
-			resp, err := c.client.CreateChatCompletion(
-				ctx,
-				openai.ChatCompletionRequest{
-					Model:       c.model,
-					Messages:    messages,
-					Temperature: temperature,
-					MaxTokens:   maxTokens,
-				},
-			)
+			release, err := c.acquire(ctx)
+			if err != nil {
+				return err
+			}
+			defer release()
 
+			resp, err := c.provider.Complete(ctx, c.model, CompletionRequest{
+				SystemPrompt: req.SystemPrompt,
+				UserPrompt:   req.UserPrompt,
+				Temperature:  temperature,
+				MaxTokens:    maxTokens,
+			})
 			if err != nil {
-				return fmt.Errorf("failed to create completion: %w", err)
+				return err
 			}
 
-			logger.Debug("LLM completion generated",
+			logger.FromContext(ctx).Debug("LLM completion generated",
 				zap.Int("prompt_tokens", resp.Usage.PromptTokens),
 				zap.Int("completion_tokens", resp.Usage.CompletionTokens),
 			)
 
-			result = &CompletionResponse{
-				Content: resp.Choices[0].Message.Content,
-				Usage: Usage{
-					PromptTokens:     resp.Usage.PromptTokens,
-					CompletionTokens: resp.Usage.CompletionTokens,
-					TotalTokens:      resp.Usage.TotalTokens,
-				},
-			}
+			c.recordTokenUsage(ctx, resp.Usage)
+			result = resp
 
 			return nil
 		})
@@ -148,6 +201,22 @@ func (c *Client) Complete(ctx context.Context, req CompletionRequest) (*Completi
 }
 
 func (c *Client) GenerateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	key := c.embeddingCacheKey(text)
+	if embedding, ok := c.getCachedEmbedding(ctx, key); ok {
+		return embedding, nil
+	}
+
+	embedding, err := c.generateEmbedding(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setCachedEmbedding(ctx, key, embedding)
+
+	return embedding, nil
+}
+
+func (c *Client) generateEmbedding(ctx context.Context, text string) ([]float32, error) {
 	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
 	defer cancel()
 
@@ -155,22 +224,22 @@ func (c *Client) GenerateEmbedding(ctx context.Context, text string) ([]float32,
 
 	err := c.cb.Execute(ctx, func() error {
 		return retry.Do(ctx, c.retryConfig, func() error {
-			resp, err := c.client.CreateEmbeddings(
-				ctx,
-				openai.EmbeddingRequest{
-					Input: []string{text},
-					Model: openai.EmbeddingModel(c.embeddingModel),
-				},
-			)
+			release, err := c.acquire(ctx)
+			if err != nil {
+				return err
+			}
+			defer release()
 
+			embeddings, err := c.embedder.GenerateEmbeddings(ctx, c.embeddingModel, []string{text})
 			if err != nil {
 				return fmt.Errorf("failed to generate embedding: %w", err)
 			}
 
-			embedding = make([]float32, len(resp.Data[0].Embedding))
-			for i, v := range resp.Data[0].Embedding {
-				embedding[i] = v
+			if len(embeddings) == 0 {
+				return fmt.Errorf("embedding response was empty")
 			}
+			embedding = embeddings[0]
+			c.recordEmbeddingUsage(ctx, []string{text})
 
 			return nil
 		})
@@ -188,56 +257,170 @@ func (c *Client) GenerateBatchEmbeddings(ctx context.Context, texts []string) ([
 		return nil, nil
 	}
 
+	if c.embeddingCache == nil {
+		return c.generateBatchEmbeddings(ctx, texts)
+	}
+
+	embeddings := make([][]float32, len(texts))
+	keys := make([]string, len(texts))
+	var missing []string
+	var missingIdx []int
+
+	for i, text := range texts {
+		keys[i] = c.embeddingCacheKey(text)
+		if embedding, ok := c.getCachedEmbedding(ctx, keys[i]); ok {
+			embeddings[i] = embedding
+			continue
+		}
+		missing = append(missing, text)
+		missingIdx = append(missingIdx, i)
+	}
+
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	generated, err := c.generateBatchEmbeddings(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(generated) != len(missing) {
+		return nil, fmt.Errorf("embedding count mismatch: got %d, expected %d", len(generated), len(missing))
+	}
+
+	for j, i := range missingIdx {
+		embeddings[i] = generated[j]
+		c.setCachedEmbedding(ctx, keys[i], generated[j])
+	}
+
+	return embeddings, nil
+}
+
+func (c *Client) generateBatchEmbeddings(ctx context.Context, texts []string) ([][]float32, error) {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	var embeddings [][]float32
-
-	batchSize := 100
-	for i := 0; i < len(texts); i += batchSize {
-		end := i + batchSize
+	var batches [][]string
+	for i := 0; i < len(texts); i += embeddingBatchSize {
+		end := i + embeddingBatchSize
 		if end > len(texts) {
 			end = len(texts)
 		}
+		batches = append(batches, texts[i:end])
+	}
 
-		batch := texts[i:end]
-
-		err := c.cb.Execute(ctx, func() error {
-			return retry.Do(ctx, c.retryConfig, func() error {
-				resp, err := c.client.CreateEmbeddings(
-					ctx,
-					openai.EmbeddingRequest{
-						Input: batch,
-						Model: openai.EmbeddingModel(c.embeddingModel),
-					},
-				)
-
-				if err != nil {
-					return fmt.Errorf("failed to generate batch embeddings: %w", err)
-				}
-
-				for _, data := range resp.Data {
-					embedding := make([]float32, len(data.Embedding))
-					for j, v := range data.Embedding {
-						embedding[j] = v
-					}
-					embeddings = append(embeddings, embedding)
-				}
-
-				return nil
-			})
-		})
+	results := make([][][]float32, len(batches))
+	errs := make([]error, len(batches))
 
-		if err != nil {
-			return nil, err
+	sem := make(chan struct{}, c.embeddingConcurrency)
+	var wg sync.WaitGroup
+
+	for i, batch := range batches {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
 		}
+		wg.Add(1)
+
+		go func(i int, batch []string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			results[i], errs[i] = c.embedBatch(ctx, batch)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i, batch)
 	}
 
-	logger.Debug("Batch embeddings generated", zap.Int("count", len(embeddings)))
+	wg.Wait()
+
+	embeddings := make([][]float32, 0, len(texts))
+	for i := range batches {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		embeddings = append(embeddings, results[i]...)
+	}
+
+	logger.FromContext(ctx).Debug("Batch embeddings generated",
+		zap.Int("count", len(embeddings)),
+		zap.Int("sub_batches", len(batches)),
+	)
+
+	return embeddings, nil
+}
+
+func (c *Client) embedBatch(ctx context.Context, batch []string) ([][]float32, error) {
+	var embeddings [][]float32
+
+	err := c.cb.Execute(ctx, func() error {
+		return retry.Do(ctx, c.retryConfig, func() error {
+			release, err := c.acquire(ctx)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			generated, err := c.embedder.GenerateEmbeddings(ctx, c.embeddingModel, batch)
+			if err != nil {
+				return fmt.Errorf("failed to generate batch embeddings: %w", err)
+			}
+			if len(generated) != len(batch) {
+				return fmt.Errorf("embedding count mismatch: got %d, expected %d", len(generated), len(batch))
+			}
+
+			embeddings = generated
+			c.recordEmbeddingUsage(ctx, batch)
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
 
 	return embeddings, nil
 }
 
+func (c *Client) embeddingCacheKey(text string) string {
+	return utils.HashString(c.embeddingModel + ":" + text)
+}
+
+func (c *Client) getCachedEmbedding(ctx context.Context, key string) ([]float32, bool) {
+	if c.embeddingCache == nil {
+		return nil, false
+	}
+
+	embedding, found, err := c.embeddingCache.GetEmbedding(ctx, key)
+	if err != nil {
+		logger.FromContext(ctx).Warn("Embedding cache lookup failed", zap.Error(err))
+	}
+	if err != nil || !found {
+		metrics.CacheMisses.WithLabelValues("embedding").Inc()
+		return nil, false
+	}
+
+	metrics.CacheHits.WithLabelValues("embedding").Inc()
+	return embedding, true
+}
+
+func (c *Client) setCachedEmbedding(ctx context.Context, key string, embedding []float32) {
+	if c.embeddingCache == nil {
+		return
+	}
+
+	if err := c.embeddingCache.SetEmbedding(ctx, key, embedding, c.embeddingTTL); err != nil {
+		logger.FromContext(ctx).Warn("Failed to cache embedding", zap.Error(err))
+	}
+}
+
 func (c *Client) SummarizeDocument(ctx context.Context, content string) (string, error) {
 	systemPrompt := `You are an AWS documentation expert. Generate a concise 2-3 sentence summary of the given AWS documentation.
 Focus on:
@@ -261,11 +444,43 @@ Be specific and technical.`
 		return "", fmt.Errorf("failed to summarize: %w", err)
 	}
 
-	logger.Info("Document summarized", zap.Int("summary_length", len(resp.Content)))
+	logger.FromContext(ctx).Info("Document summarized", zap.Int("summary_length", len(resp.Content)))
 
 	return resp.Content, nil
 }
 
+var DocTypes = []string{"troubleshooting", "guide", "reference", "tutorial", "api"}
+
+func (c *Client) ClassifyDocType(ctx context.Context, content string) (string, error) {
+	systemPrompt := fmt.Sprintf(`You are an AWS documentation expert. Classify the given AWS documentation into exactly one type:
+- troubleshooting: diagnosing and fixing errors, failures, or unexpected behavior
+- guide: conceptual or how-to material for using a feature
+- reference: configuration options, limits, quotas, or parameter listings
+- tutorial: step-by-step walkthrough building a working example
+- api: API operation, request/response, or SDK/CLI command documentation
+
+Respond with only one of: %s`, strings.Join(DocTypes, ", "))
+
+	resp, err := c.Complete(ctx, CompletionRequest{
+		SystemPrompt: systemPrompt,
+		UserPrompt:   fmt.Sprintf("Classify this AWS documentation:\n\n%s", content),
+		Temperature:  0,
+		MaxTokens:    10,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to classify document: %w", err)
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(resp.Content))
+	for _, docType := range DocTypes {
+		if strings.HasPrefix(strings.Trim(answer, "\"'`.*"), docType) {
+			return docType, nil
+		}
+	}
+
+	return "", fmt.Errorf("unrecognized document type %q", resp.Content)
+}
+
 func (c *Client) ExtractEntities(ctx context.Context, documentSummary string, seedConcepts []string) ([]EntityExtraction, error) {
 	systemPrompt := `You are an AWS knowledge graph expert. Extract entities from AWS documentation.
 
@@ -300,7 +515,7 @@ Return JSON only.`, knownEntities, documentSummary)
 
 	entities := parseEntityExtractions(resp.Content)
 
-	logger.Info("Entities extracted", zap.Int("count", len(entities)))
+	logger.FromContext(ctx).Info("Entities extracted", zap.Int("count", len(entities)))
 
 	return entities, nil
 }
@@ -343,24 +558,114 @@ Return JSON only.`, entityList, documentText)
 
 	relations := parseRelationExtractions(resp.Content)
 
-	logger.Info("Relations extracted", zap.Int("count", len(relations)))
+	logger.FromContext(ctx).Info("Relations extracted", zap.Int("count", len(relations)))
 
 	return relations, nil
 }
 
-func (c *Client) GenerateResponse(ctx context.Context, query string, kgContext, vectorContext string) (string, error) {
-	systemPrompt := `You are an AWS Solutions Architect AI assistant specialized in troubleshooting and resolving AWS service issues.
+func (c *Client) CompleteStream(ctx context.Context, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	temperature := req.Temperature
+	if temperature == 0 {
+		temperature = c.temperature
+	}
+
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = c.maxTokens
+	}
+
+	var result *CompletionResponse
+
+	err := c.cb.Execute(ctx, func() error {
+		release, err := c.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		resp, err := c.provider.CompleteStream(ctx, c.model, CompletionRequest{
+			SystemPrompt: req.SystemPrompt,
+			UserPrompt:   req.UserPrompt,
+			Temperature:  temperature,
+			MaxTokens:    maxTokens,
+		}, onDelta)
+		if err != nil {
+			return err
+		}
+
+		result = resp
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.recordTokenUsage(ctx, result.Usage)
+
+	return result, nil
+}
+
+func (c *Client) recordTokenUsage(ctx context.Context, usage Usage) {
+	meterTokens(ctx, usage)
+	metrics.LLMTokensUsed.WithLabelValues(c.model, "prompt").Add(float64(usage.PromptTokens))
+	metrics.LLMTokensUsed.WithLabelValues(c.model, "completion").Add(float64(usage.CompletionTokens))
+	c.recordCost(c.model, usage)
+}
+
+func (c *Client) recordEmbeddingUsage(ctx context.Context, texts []string) {
+	tokens := 0
+	for _, text := range texts {
+		tokens += tokenizer.Count(text)
+	}
+
+	// Embedding providers don't report usage, so estimate it locally.
+	usage := Usage{PromptTokens: tokens}
+	usage.TotalTokens = usage.PromptTokens
+	meterTokens(ctx, usage)
+
+	metrics.LLMTokensUsed.WithLabelValues(c.embeddingModel, "embedding").Add(float64(usage.PromptTokens))
+	c.recordCost(c.embeddingModel, usage)
+}
+
+func (c *Client) recordCost(model string, usage Usage) {
+	cost := c.costs.Estimate(model, usage)
+	if cost <= 0 {
+		return
+	}
+
+	metrics.LLMCost.WithLabelValues(model).Add(cost)
+	logger.Debug("Estimated LLM cost",
+		zap.String("model", model),
+		zap.Int("prompt_tokens", usage.PromptTokens),
+		zap.Int("completion_tokens", usage.CompletionTokens),
+		zap.Float64("cost_usd", cost),
+	)
+}
+
+func (c *Client) GenerateResponse(ctx context.Context, query, history, kgContext, vectorContext string) (*CompletionResponse, error) {
+	return c.GenerateResponseStream(ctx, query, history, kgContext, vectorContext, nil)
+}
+
+// ResponseMaxTokens caps the completion of GenerateResponse, so callers
+// sizing the prompt can leave room for it in the model's context window.
+const ResponseMaxTokens = 2048
+
+const responseSystemPrompt = `You are an AWS Solutions Architect AI assistant specialized in troubleshooting and resolving AWS service issues.
 
 Your responses must:
 1. Be technically accurate and based ONLY on provided context
-2. Cite sources using [source_id] notation
+2. Cite documentation using the [source_N] label of the block you relied on
 3. Provide step-by-step solutions when applicable
 4. Acknowledge limitations when context is insufficient
 5. Suggest web search when documentation doesn't cover the issue
 
 Be concise, technical, and actionable.`
 
-	userPrompt := fmt.Sprintf(`Issue: %s
+const responseUserPrompt = `Issue: %s
 
 Knowledge Graph Facts:
 %s
@@ -374,25 +679,225 @@ Provide a solution that:
 3. Includes relevant AWS CLI/Console commands if applicable
 4. Cites sources for verification
 
-If information is insufficient, explain what additional details are needed.`, query, kgContext, vectorContext)
+If information is insufficient, explain what additional details are needed.`
 
-	resp, err := c.Complete(ctx, CompletionRequest{
-		SystemPrompt: systemPrompt,
+const responseHistoryPrompt = `Conversation so far, for resolving references in the issue:
+%s
+
+`
+
+// buildResponsePrompt fills the response template, prefixed with the earlier
+// turns of the conversation when there are any.
+func buildResponsePrompt(query, history, kgContext, vectorContext string) string {
+	prompt := fmt.Sprintf(responseUserPrompt, query, kgContext, vectorContext)
+	if history != "" {
+		prompt = fmt.Sprintf(responseHistoryPrompt, history) + prompt
+	}
+	return prompt
+}
+
+// ResponsePromptTokens estimates the tokens GenerateResponse spends on its
+// system prompt, template, query and history, before any context is added.
+func ResponsePromptTokens(query, history string) int {
+	return tokenizer.Count(responseSystemPrompt) + tokenizer.Count(buildResponsePrompt(query, history, "", ""))
+}
+
+func (c *Client) GenerateResponseStream(ctx context.Context, query, history, kgContext, vectorContext string, onDelta StreamFunc) (*CompletionResponse, error) {
+	userPrompt := buildResponsePrompt(query, history, kgContext, vectorContext)
+
+	completionReq := CompletionRequest{
+		SystemPrompt: responseSystemPrompt,
 		UserPrompt:   userPrompt,
 		Temperature:  0.2,
-		MaxTokens:    2048,
-	})
+		MaxTokens:    ResponseMaxTokens,
+	}
+
+	var resp *CompletionResponse
+	var err error
+	if onDelta != nil {
+		resp, err = c.CompleteStream(ctx, completionReq, onDelta)
+	} else {
+		resp, err = c.Complete(ctx, completionReq)
+	}
 
 	if err != nil {
-		return "", fmt.Errorf("failed to generate response: %w", err)
+		return nil, fmt.Errorf("failed to generate response: %w", err)
 	}
 
-	logger.Info("Response generated",
+	logger.FromContext(ctx).Info("Response generated",
 		zap.String("query", query),
 		zap.Int("response_length", len(resp.Content)),
+		zap.Int("total_tokens", resp.Usage.TotalTokens),
 	)
 
-	return resp.Content, nil
+	return resp, nil
+}
+
+func (c *Client) GenerateFollowUps(ctx context.Context, query, answer, contextText string, maxQuestions int) ([]string, int, error) {
+	systemPrompt := `You are an AWS Solutions Architect assistant. Suggest short follow-up questions a user might ask next.
+
+Only suggest questions that the provided context can answer.
+Return one question per line, with no numbering or extra text.`
+
+	userPrompt := fmt.Sprintf(`Original question: %s
+
+Answer given:
+%s
+
+Context:
+%s
+
+Suggest up to %d follow-up questions.`, query, utils.TruncateRunes(answer, 1500), utils.TruncateRunes(contextText, 2000), maxQuestions)
+
+	resp, err := c.Complete(ctx, CompletionRequest{
+		SystemPrompt: systemPrompt,
+		UserPrompt:   userPrompt,
+		Temperature:  0.3,
+		MaxTokens:    150,
+	})
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to generate follow-up questions: %w", err)
+	}
+
+	questions := make([]string, 0, maxQuestions)
+	for _, line := range strings.Split(resp.Content, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "-*•0123456789.) "))
+		if line == "" || !strings.HasSuffix(line, "?") {
+			continue
+		}
+		questions = append(questions, line)
+		if len(questions) == maxQuestions {
+			break
+		}
+	}
+
+	return questions, resp.Usage.TotalTokens, nil
+}
+
+func (c *Client) ExtractQueryEntities(ctx context.Context, query string, knownEntities []string) ([]string, error) {
+	systemPrompt := `You are an AWS support triage assistant. Identify the AWS entities a user question refers to.
+
+Include AWS services (EKS, SQS, Kinesis, etc.), error codes (AccessDenied, ThrottlingException, etc.), resources and operations.
+Prefer the exact spelling from the known entity list when an entity matches one of them.
+Use the short service name without an "Amazon" or "AWS" prefix.
+
+Return ONLY a JSON array of entity names, for example: ["EKS", "AccessDenied"]`
+
+	userPrompt := fmt.Sprintf(`Known entities: %s
+
+Question: %s`, strings.Join(knownEntities, ", "), query)
+
+	resp, err := c.Complete(ctx, CompletionRequest{
+		SystemPrompt: systemPrompt,
+		UserPrompt:   userPrompt,
+		Temperature:  0.1,
+		MaxTokens:    150,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract query entities: %w", err)
+	}
+
+	var raw []string
+	if err := json.Unmarshal([]byte(extractJSONArray(resp.Content)), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse query entities: %w", err)
+	}
+
+	known := make(map[string]string, len(knownEntities))
+	for _, name := range knownEntities {
+		known[strings.ToLower(name)] = name
+	}
+
+	entities := make([]string, 0, len(raw))
+	for _, name := range raw {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if canonical, ok := known[strings.ToLower(name)]; ok {
+			name = canonical
+		}
+		entities = append(entities, name)
+	}
+
+	logger.FromContext(ctx).Debug("Query entities extracted", zap.String("query", query), zap.Strings("entities", entities))
+
+	return entities, nil
+}
+
+func (c *Client) ScoreRelevance(ctx context.Context, query string, passages []string) ([]float64, error) {
+	if len(passages) == 0 {
+		return nil, nil
+	}
+
+	systemPrompt := `You are a relevance judge for an AWS documentation search engine.
+Rate how useful each passage is for answering the question, from 0 (irrelevant) to 10 (directly answers it).
+
+Return ONLY a JSON array of numbers, one score per passage, in the same order as the passages.`
+
+	var userPrompt strings.Builder
+	userPrompt.WriteString(fmt.Sprintf("Question: %s\n", query))
+	for i, passage := range passages {
+		userPrompt.WriteString(fmt.Sprintf("\n[Passage %d]\n%s\n", i+1, passage))
+	}
+
+	resp, err := c.Complete(ctx, CompletionRequest{
+		SystemPrompt: systemPrompt,
+		UserPrompt:   userPrompt.String(),
+		Temperature:  0,
+		MaxTokens:    10 + 6*len(passages),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to score relevance: %w", err)
+	}
+
+	var scores []float64
+	if err := json.Unmarshal([]byte(extractJSONArray(resp.Content)), &scores); err != nil {
+		return nil, fmt.Errorf("failed to parse relevance scores: %w", err)
+	}
+	if len(scores) != len(passages) {
+		return nil, fmt.Errorf("relevance scores returned %d scores for %d passages", len(scores), len(passages))
+	}
+
+	for i, score := range scores {
+		scores[i] = math.Max(0, math.Min(score, 10)) / 10
+	}
+
+	return scores, nil
+}
+
+func (c *Client) ClassifyService(ctx context.Context, query string, services []string) (string, error) {
+	systemPrompt := `You are an AWS support triage assistant. Identify which AWS service a user question is about.
+
+Answer with exactly one service name from the provided list, or "None" if the question does not clearly concern any of them.
+Return ONLY the service name, nothing else.`
+
+	userPrompt := fmt.Sprintf(`Services: %s
+
+Question: %s`, strings.Join(services, ", "), query)
+
+	resp, err := c.Complete(ctx, CompletionRequest{
+		SystemPrompt: systemPrompt,
+		UserPrompt:   userPrompt,
+		Temperature:  0.1,
+		MaxTokens:    10,
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("failed to classify service: %w", err)
+	}
+
+	answer := strings.Trim(strings.TrimSpace(resp.Content), `."'`)
+	for _, service := range services {
+		if strings.EqualFold(answer, service) {
+			logger.FromContext(ctx).Debug("Service classified", zap.String("query", query), zap.String("service", service))
+			return service, nil
+		}
+	}
+
+	return "", nil
 }
 
 func (c *Client) EvaluateResponse(ctx context.Context, query, response, groundTruth string) (*EvaluationScore, error) {
@@ -426,7 +931,10 @@ Evaluate the response.`, query, response, groundTruth)
 		return nil, fmt.Errorf("failed to evaluate response: %w", err)
 	}
 
-	score := parseEvaluationScore(resp.Content)
+	score, err := parseEvaluationScore(resp.Content)
+	if err != nil {
+		return nil, err
+	}
 
 	return score, nil
 }
@@ -453,23 +961,201 @@ type EvaluationScore struct {
 	Reasoning      string
 }
 
+var allowedPredicates = map[string]bool{
+	"USES":            true,
+	"REQUIRES":        true,
+	"INTEGRATES_WITH": true,
+	"MONITORS":        true,
+	"LOGS_TO":         true,
+	"CAUSED_BY":       true,
+	"RESOLVED_BY":     true,
+	"HAS_ERROR":       true,
+	"PART_OF":         true,
+}
+
+// IsAllowedPredicate reports whether predicate is one of the relation types
+// the knowledge graph accepts.
+func IsAllowedPredicate(predicate string) bool {
+	return allowedPredicates[predicate]
+}
+
 func parseEntityExtractions(content string) []EntityExtraction {
-	var entities []EntityExtraction
+	var raw []struct {
+		Name       string  `json:"name"`
+		Type       string  `json:"type"`
+		Confidence float64 `json:"confidence"`
+	}
+
+	if err := json.Unmarshal([]byte(extractJSONArray(content)), &raw); err != nil {
+		logger.Warn("Failed to parse entity extractions", zap.Error(err))
+		return nil
+	}
+
+	entities := make([]EntityExtraction, 0, len(raw))
+	for _, r := range raw {
+		name := strings.TrimSpace(r.Name)
+		if name == "" {
+			continue
+		}
+		entities = append(entities, EntityExtraction{
+			Name:       name,
+			Type:       strings.ToLower(strings.TrimSpace(r.Type)),
+			Confidence: clampConfidence(r.Confidence),
+		})
+	}
+
 	return entities
 }
 
+// parseRelationExtractions decodes each row of the array on its own, so a
+// malformed row is skipped without losing the rest.
 func parseRelationExtractions(content string) []RelationExtraction {
-	var relations []RelationExtraction
+	var rows []json.RawMessage
+	if err := json.Unmarshal([]byte(extractJSONArray(content)), &rows); err != nil {
+		logger.Warn("Failed to parse relation extractions", zap.Error(err))
+		return nil
+	}
+
+	relations := make([]RelationExtraction, 0, len(rows))
+	for _, row := range rows {
+		var r struct {
+			Subject    string  `json:"subject"`
+			Predicate  string  `json:"predicate"`
+			Object     string  `json:"object"`
+			Confidence float64 `json:"confidence"`
+		}
+		if err := json.Unmarshal(row, &r); err != nil {
+			logger.Debug("Skipping malformed relation extraction", zap.ByteString("row", row), zap.Error(err))
+			continue
+		}
+
+		subject := strings.TrimSpace(r.Subject)
+		object := strings.TrimSpace(r.Object)
+		predicate := strings.ToUpper(strings.TrimSpace(r.Predicate))
+
+		if subject == "" || object == "" || !allowedPredicates[predicate] {
+			continue
+		}
+
+		relations = append(relations, RelationExtraction{
+			Subject:    subject,
+			Predicate:  predicate,
+			Object:     object,
+			Confidence: clampConfidence(r.Confidence),
+		})
+	}
+
 	return relations
 }
 
-func parseEvaluationScore(content string) *EvaluationScore {
+func extractJSONArray(content string) string {
+	content = stripCodeFences(content)
+
+	start := strings.Index(content, "[")
+	end := strings.LastIndex(content, "]")
+	if start == -1 || end < start {
+		return content
+	}
+
+	return content[start : end+1]
+}
+
+func stripCodeFences(content string) string {
+	content = strings.TrimSpace(content)
+
+	if idx := strings.Index(content, "```"); idx != -1 {
+		rest := content[idx+3:]
+		if nl := strings.Index(rest, "\n"); nl != -1 {
+			rest = rest[nl+1:]
+		}
+		if end := strings.Index(rest, "```"); end != -1 {
+			rest = rest[:end]
+		}
+		content = strings.TrimSpace(rest)
+	}
+
+	return content
+}
+
+func clampConfidence(confidence float64) float64 {
+	if confidence < 0 {
+		return 0
+	}
+	if confidence > 1 {
+		return 1
+	}
+	return confidence
+}
+
+type flexibleScore float64
+
+func (f *flexibleScore) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(strings.TrimSpace(string(data)), `"`)
+	if text == "" || text == "null" {
+		*f = 0
+		return nil
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil {
+		return fmt.Errorf("invalid score %q", text)
+	}
+
+	*f = flexibleScore(value)
+	return nil
+}
+
+func parseEvaluationScore(content string) (*EvaluationScore, error) {
+	content = stripCodeFences(content)
+
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no JSON object in evaluation response")
+	}
+
+	var raw struct {
+		Relevance      flexibleScore `json:"relevance"`
+		Accuracy       flexibleScore `json:"accuracy"`
+		Completeness   flexibleScore `json:"completeness"`
+		Citations      flexibleScore `json:"citations"`
+		Classification string        `json:"classification"`
+		Reasoning      string        `json:"reasoning"`
+	}
+
+	if err := json.Unmarshal([]byte(content[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse evaluation score: %w", err)
+	}
+
 	return &EvaluationScore{
-		Relevance:      2.5,
-		Accuracy:       2.5,
-		Completeness:   2.5,
-		Citations:      2.5,
-		Classification: "moderate",
-		Reasoning:      "Default scoring",
+		Relevance:      float64(raw.Relevance),
+		Accuracy:       float64(raw.Accuracy),
+		Completeness:   float64(raw.Completeness),
+		Citations:      float64(raw.Citations),
+		Classification: normalizeClassification(raw.Classification, float64(raw.Relevance)),
+		Reasoning:      strings.TrimSpace(raw.Reasoning),
+	}, nil
+}
+
+func normalizeClassification(classification string, relevance float64) string {
+	normalized := strings.ToLower(strings.TrimSpace(classification))
+	normalized = strings.NewReplacer(" ", "_", "-", "_").Replace(normalized)
+
+	switch normalized {
+	case "irrelevant", "not_relevant":
+		return "irrelevant"
+	case "moderate", "moderately_relevant", "partially_relevant":
+		return "moderate"
+	case "fully_relevant", "relevant", "highly_relevant":
+		return "fully_relevant"
+	}
+
+	switch {
+	case relevance >= 2.5:
+		return "fully_relevant"
+	case relevance >= 1.5:
+		return "moderate"
+	default:
+		return "irrelevant"
 	}
 }
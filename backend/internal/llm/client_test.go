@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRelationExtractions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []RelationExtraction
+	}{
+		{
+			name:    "well formed",
+			content: `[{"subject": "Lambda", "predicate": "USES", "object": "VPC", "confidence": 0.9}]`,
+			want: []RelationExtraction{
+				{Subject: "Lambda", Predicate: "USES", Object: "VPC", Confidence: 0.9},
+			},
+		},
+		{
+			name: "fenced with surrounding text",
+			content: "Here are the relations:\n```json\n" +
+				`[{"subject": " CloudWatch ", "predicate": "monitors", "object": "EC2", "confidence": 0.7}]` +
+				"\n```\nLet me know if you need more.",
+			want: []RelationExtraction{
+				{Subject: "CloudWatch", Predicate: "MONITORS", Object: "EC2", Confidence: 0.7},
+			},
+		},
+		{
+			name: "partially invalid",
+			content: `[
+				{"subject": "Lambda", "predicate": "LOGS_TO", "object": "CloudWatch Logs", "confidence": 1.4},
+				{"subject": "S3", "predicate": "LIKES", "object": "Lambda", "confidence": 0.5},
+				{"subject": "", "predicate": "USES", "object": "IAM", "confidence": 0.5},
+				{"subject": "EKS", "predicate": "USES", "object": "", "confidence": 0.5},
+				{"subject": "ECS", "predicate": "REQUIRES", "object": "IAM", "confidence": "high"},
+				"not an object",
+				{"subject": "RDS", "predicate": "PART_OF", "object": "VPC", "confidence": -0.2}
+			]`,
+			want: []RelationExtraction{
+				{Subject: "Lambda", Predicate: "LOGS_TO", Object: "CloudWatch Logs", Confidence: 1},
+				{Subject: "RDS", Predicate: "PART_OF", Object: "VPC", Confidence: 0},
+			},
+		},
+		{
+			name:    "not json",
+			content: "I could not find any relations.",
+			want:    nil,
+		},
+		{
+			name:    "empty array",
+			content: "[]",
+			want:    []RelationExtraction{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRelationExtractions(tt.content)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRelationExtractions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEvaluationScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *EvaluationScore
+	}{
+		{
+			name:    "numbers",
+			content: `{"relevance": 3, "accuracy": 2, "completeness": 2, "citations": 1, "classification": "fully_relevant", "reasoning": " clear "}`,
+			want:    &EvaluationScore{Relevance: 3, Accuracy: 2, Completeness: 2, Citations: 1, Classification: "fully_relevant", Reasoning: "clear"},
+		},
+		{
+			name:    "string scores in a fence",
+			content: "```json\n" + `{"relevance": "2", "accuracy": "2.5", "completeness": " 1 ", "citations": null, "classification": "Partially Relevant"}` + "\n```",
+			want:    &EvaluationScore{Relevance: 2, Accuracy: 2.5, Completeness: 1, Classification: "moderate"},
+		},
+		{
+			name:    "unknown classification falls back to relevance",
+			content: `Evaluation: {"relevance": 1, "accuracy": 1, "completeness": 1, "citations": 1, "classification": "meh"}`,
+			want:    &EvaluationScore{Relevance: 1, Accuracy: 1, Completeness: 1, Citations: 1, Classification: "irrelevant"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEvaluationScore(tt.content)
+			if err != nil {
+				t.Fatalf("parseEvaluationScore: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEvaluationScore() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEvaluationScoreMalformed(t *testing.T) {
+	for name, content := range map[string]string{
+		"no json":         "The response is fully relevant.",
+		"truncated":       `{"relevance": 3, "accuracy": `,
+		"non-numeric":     `{"relevance": "high", "accuracy": 2}`,
+		"wrong structure": `{"relevance": [3]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if score, err := parseEvaluationScore(content); err == nil {
+				t.Errorf("parseEvaluationScore() = %+v, want an error", score)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+type embeddingModelDim struct {
+	native    int
+	shortable bool
+}
+
+var knownEmbeddingDims = map[string]embeddingModelDim{
+	"text-embedding-ada-002":       {native: 1536},
+	"text-embedding-3-small":       {native: 1536, shortable: true},
+	"text-embedding-3-large":       {native: 3072, shortable: true},
+	"amazon.titan-embed-text-v1":   {native: 1536},
+	"amazon.titan-embed-text-v2:0": {native: 1024},
+	"amazon.titan-embed-image-v1":  {native: 1024},
+	"cohere.embed-english-v3":      {native: 1024},
+	"cohere.embed-multilingual-v3": {native: 1024},
+}
+
+// ResolveEmbeddingDim returns the dimension the embedding model will produce.
+// A zero configured dimension is derived from the model when it is known, and
+// a configured dimension is rejected if the model cannot produce it.
+func ResolveEmbeddingDim(model string, configured int) (int, error) {
+	known, ok := knownEmbeddingDims[strings.ToLower(model)]
+	if !ok {
+		if configured <= 0 {
+			return 0, fmt.Errorf("embedding dimension must be set for unknown model %q", model)
+		}
+		return configured, nil
+	}
+
+	switch {
+	case configured <= 0:
+		return known.native, nil
+	case configured == known.native:
+		return configured, nil
+	case known.shortable && configured < known.native:
+		return configured, nil
+	default:
+		return 0, fmt.Errorf("embedding model %q produces %d dimensions, configured %d", model, known.native, configured)
+	}
+}
+
+func requestedEmbeddingDim(model string, dim int) int {
+	known, ok := knownEmbeddingDims[strings.ToLower(model)]
+	if !ok || !known.shortable || dim <= 0 || dim >= known.native {
+		return 0
+	}
+	return dim
+}
@@ -0,0 +1,32 @@
+package llm
+
+import "testing"
+
+func TestResolveEmbeddingDim(t *testing.T) {
+	tests := []struct {
+		model      string
+		configured int
+		want       int
+		wantErr    bool
+	}{
+		{model: "text-embedding-3-large", configured: 0, want: 3072},
+		{model: "text-embedding-3-large", configured: 1536, want: 1536},
+		{model: "text-embedding-ada-002", configured: 1536, want: 1536},
+		{model: "text-embedding-ada-002", configured: 1024, wantErr: true},
+		{model: "amazon.titan-embed-text-v2:0", configured: 1536, wantErr: true},
+		{model: "text-embedding-3-small", configured: 3072, wantErr: true},
+		{model: "custom-embedder", configured: 768, want: 768},
+		{model: "custom-embedder", configured: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveEmbeddingDim(tt.model, tt.configured)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolveEmbeddingDim(%q, %d) = %d, %v; want %d, error %v",
+				tt.model, tt.configured, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if requestedEmbeddingDim("text-embedding-3-large", 1536) != 1536 || requestedEmbeddingDim("text-embedding-ada-002", 1536) != 0 {
+		t.Error("requestedEmbeddingDim should only shorten models that support it")
+	}
+}
@@ -0,0 +1,59 @@
+package llm_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+)
+
+func TestEmbeddingCache(t *testing.T) {
+	cache, _ := redistest.NewClient(t)
+	ctx := context.Background()
+
+	newClient := func(model string, provider *llmtest.Provider) *llm.Client {
+		return llm.NewClientWithProviders(llm.Config{Model: "fake-model", EmbeddingModel: model, EmbeddingDim: 8}, provider, nil).
+			WithEmbeddingCache(cache, time.Hour)
+	}
+
+	provider := &llmtest.Provider{}
+	client := newClient("embedding-v1", provider)
+
+	first, err := client.GenerateEmbedding(ctx, "Lambda timeout")
+	if err != nil {
+		t.Fatalf("GenerateEmbedding: %v", err)
+	}
+	second, err := client.GenerateEmbedding(ctx, "Lambda timeout")
+	if err != nil {
+		t.Fatalf("GenerateEmbedding: %v", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("cached embedding = %v, want %v", second, first)
+	}
+	if got := len(provider.Embedded()); got != 1 {
+		t.Errorf("provider embedded %d texts, want 1 with the second served from cache", got)
+	}
+
+	batch, err := client.GenerateBatchEmbeddings(ctx, []string{"Lambda timeout", "S3 access denied"})
+	if err != nil {
+		t.Fatalf("GenerateBatchEmbeddings: %v", err)
+	}
+	if len(batch) != 2 || !reflect.DeepEqual(batch[0], first) {
+		t.Errorf("batch = %v, want the cached embedding first", batch)
+	}
+	if got := provider.Embedded(); len(got) != 2 || got[1] != "S3 access denied" {
+		t.Errorf("provider embedded %v, want only the uncached text added", got)
+	}
+
+	otherProvider := &llmtest.Provider{}
+	if _, err := newClient("embedding-v2", otherProvider).GenerateEmbedding(ctx, "Lambda timeout"); err != nil {
+		t.Fatalf("GenerateEmbedding: %v", err)
+	}
+	if got := len(otherProvider.Embedded()); got != 1 {
+		t.Errorf("another embedding model embedded %d texts, want a cache miss", got)
+	}
+}
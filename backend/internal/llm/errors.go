@@ -0,0 +1,23 @@
+package llm
+
+import (
+	"errors"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/aws-agent/backend/pkg/retry"
+)
+
+func IsRetryableError(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return retry.IsRetryableStatus(apiErr.HTTPStatusCode)
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return retry.IsRetryableStatus(reqErr.HTTPStatusCode)
+	}
+
+	return retry.IsTransient(err)
+}
@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/aws-agent/backend/pkg/retry"
+)
+
+func TestIsRetryableErrorRetryCounts(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "bad request", err: &openai.APIError{HTTPStatusCode: 400, Message: "invalid model"}, want: 1},
+		{name: "content policy", err: &openai.APIError{HTTPStatusCode: 400, Code: "content_policy_violation"}, want: 1},
+		{name: "rate limited", err: &openai.APIError{HTTPStatusCode: 429}, want: 3},
+		{name: "server error", err: &openai.APIError{HTTPStatusCode: 500}, want: 3},
+		{name: "gateway error", err: &openai.RequestError{HTTPStatusCode: 502, Err: errors.New("bad gateway")}, want: 3},
+		{name: "wrapped", err: fmt.Errorf("failed to create completion: %w", &openai.APIError{HTTPStatusCode: 401}), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			retry.Do(context.Background(), retry.Config{
+				MaxAttempts:  3,
+				InitialDelay: time.Millisecond,
+				Classifier:   IsRetryableError,
+			}, func() error {
+				calls++
+				return tt.err
+			})
+
+			if calls != tt.want {
+				t.Errorf("attempts = %d, want %d", calls, tt.want)
+			}
+		})
+	}
+}
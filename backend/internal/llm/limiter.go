@@ -0,0 +1,30 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+)
+
+const embeddingBatchSize = 100
+
+func newRequestSlots(limit int) chan struct{} {
+	if limit <= 0 {
+		return nil
+	}
+	return make(chan struct{}, limit)
+}
+
+// acquire blocks until the client-wide request limit has room. A nil slot
+// channel means the client is unbounded.
+func (c *Client) acquire(ctx context.Context) (func(), error) {
+	if c.requestSlots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case c.requestSlots <- struct{}{}:
+		return func() { <-c.requestSlots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to acquire LLM request slot: %w", ctx.Err())
+	}
+}
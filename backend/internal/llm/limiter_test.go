@@ -0,0 +1,88 @@
+package llm_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+)
+
+// concurrencyProbe embeds "text-<n>" as [n] and records the most embedding
+// calls it saw in flight at once.
+type concurrencyProbe struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (p *concurrencyProbe) embed(text string) ([]float32, error) {
+	p.mu.Lock()
+	p.inFlight++
+	p.peak = max(p.peak, p.inFlight)
+	p.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+
+	n, err := strconv.Atoi(strings.TrimPrefix(text, "text-"))
+	if err != nil {
+		return nil, err
+	}
+	return []float32{float32(n)}, nil
+}
+
+func TestGenerateBatchEmbeddingsConcurrency(t *testing.T) {
+	tests := []struct {
+		name                  string
+		embeddingConcurrency  int
+		maxConcurrentRequests int
+		wantPeak              int
+	}{
+		{name: "sequential by default", wantPeak: 1},
+		{name: "bounded sub-batches", embeddingConcurrency: 2, wantPeak: 2},
+		{name: "client-wide limit", embeddingConcurrency: 4, maxConcurrentRequests: 1, wantPeak: 1},
+	}
+
+	texts := make([]string, 450)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("text-%d", i)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe := &concurrencyProbe{}
+			client := llm.NewClientWithProviders(llm.Config{
+				Model:                 "fake-model",
+				EmbeddingModel:        "fake-embedding",
+				EmbeddingConcurrency:  tt.embeddingConcurrency,
+				MaxConcurrentRequests: tt.maxConcurrentRequests,
+			}, &llmtest.Provider{Embed: probe.embed}, nil)
+
+			embeddings, err := client.GenerateBatchEmbeddings(context.Background(), texts)
+			if err != nil {
+				t.Fatalf("GenerateBatchEmbeddings: %v", err)
+			}
+
+			if len(embeddings) != len(texts) {
+				t.Fatalf("got %d embeddings for %d texts", len(embeddings), len(texts))
+			}
+			for i, embedding := range embeddings {
+				if len(embedding) != 1 || embedding[0] != float32(i) {
+					t.Fatalf("embedding %d = %v, want the embedding of text-%d", i, embedding, i)
+				}
+			}
+			if probe.peak != tt.wantPeak {
+				t.Errorf("peak concurrent sub-batches = %d, want %d", probe.peak, tt.wantPeak)
+			}
+		})
+	}
+}
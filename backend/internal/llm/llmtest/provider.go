@@ -0,0 +1,118 @@
+// Package llmtest provides an in-memory LLM provider for tests.
+package llmtest
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/aws-agent/backend/internal/llm"
+)
+
+const embeddingDim = 8
+
+// Provider answers completions with Reply and embeds text with Embed, and
+// records every completion request it receives.
+type Provider struct {
+	// Reply returns the completion for req. A nil Reply answers "ok".
+	Reply func(req llm.CompletionRequest) (string, error)
+	// Embed returns the embedding for text. A nil Embed derives a
+	// deterministic vector from a hash of the text.
+	Embed func(text string) ([]float32, error)
+
+	mu       sync.Mutex
+	requests []llm.CompletionRequest
+	embedded []string
+}
+
+// NewClient returns an llm.Client backed by p.
+func NewClient(p llm.Provider) *llm.Client {
+	return llm.NewClientWithProviders(llm.Config{
+		Model:          "fake-model",
+		EmbeddingModel: "fake-embedding",
+		EmbeddingDim:   embeddingDim,
+	}, p, nil)
+}
+
+func (p *Provider) Name() string {
+	return "fake"
+}
+
+func (p *Provider) Complete(ctx context.Context, model string, req llm.CompletionRequest) (*llm.CompletionResponse, error) {
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	p.mu.Unlock()
+
+	content := "ok"
+	if p.Reply != nil {
+		var err error
+		if content, err = p.Reply(req); err != nil {
+			return nil, err
+		}
+	}
+
+	return &llm.CompletionResponse{
+		Content: content,
+		Usage:   llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}, nil
+}
+
+func (p *Provider) CompleteStream(ctx context.Context, model string, req llm.CompletionRequest, onDelta llm.StreamFunc) (*llm.CompletionResponse, error) {
+	resp, err := p.Complete(ctx, model, req)
+	if err != nil {
+		return nil, err
+	}
+	if onDelta != nil {
+		if err := onDelta(resp.Content); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (p *Provider) GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	p.mu.Lock()
+	p.embedded = append(p.embedded, texts...)
+	p.mu.Unlock()
+
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		if p.Embed != nil {
+			embedding, err := p.Embed(text)
+			if err != nil {
+				return nil, err
+			}
+			embeddings[i] = embedding
+			continue
+		}
+		embeddings[i] = HashEmbedding(text)
+	}
+	return embeddings, nil
+}
+
+// Requests returns the completion requests received so far.
+func (p *Provider) Requests() []llm.CompletionRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]llm.CompletionRequest(nil), p.requests...)
+}
+
+// Embedded returns the texts embedded so far.
+func (p *Provider) Embedded() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.embedded...)
+}
+
+// HashEmbedding derives a stable unit-free vector from text, so equal texts
+// embed identically and different texts almost never do.
+func HashEmbedding(text string) []float32 {
+	embedding := make([]float32, embeddingDim)
+	for i := range embedding {
+		h := fnv.New32a()
+		h.Write([]byte{byte(i)})
+		h.Write([]byte(text))
+		embedding[i] = float32(h.Sum32()%1000)/1000 + 0.001
+	}
+	return embedding
+}
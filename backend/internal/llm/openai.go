@@ -0,0 +1,186 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type openAIProvider struct {
+	client     *openai.Client
+	dimensions int
+}
+
+func newOpenAIProvider(apiKey string) *openAIProvider {
+	return &openAIProvider{
+		client: openai.NewClient(apiKey),
+	}
+}
+
+func (p *openAIProvider) Name() string {
+	return "openai"
+}
+
+func (p *openAIProvider) Complete(ctx context.Context, model string, req CompletionRequest) (*CompletionResponse, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, p.chatRequest(model, req, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create completion: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("completion returned no choices")
+	}
+
+	return &CompletionResponse{
+		Content: resp.Choices[0].Message.Content,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+func (p *openAIProvider) CompleteStream(ctx context.Context, model string, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error) {
+	stream, err := p.client.CreateChatCompletionStream(ctx, p.chatRequest(model, req, true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create completion stream: %w", err)
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	deltas := 0
+
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to receive completion stream: %w", err)
+		}
+		if len(resp.Choices) == 0 || resp.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := resp.Choices[0].Delta.Content
+		content.WriteString(delta)
+		deltas++
+
+		if err := onDelta(delta); err != nil {
+			return nil, fmt.Errorf("failed to forward completion delta: %w", err)
+		}
+	}
+
+	// The streaming API does not report usage in this SDK version, so
+	// prompt tokens are estimated and each delta is counted as one token.
+	promptTokens := (len(req.SystemPrompt) + len(req.UserPrompt)) / 4
+
+	return &CompletionResponse{
+		Content: content.String(),
+		Usage: Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: deltas,
+			TotalTokens:      promptTokens + deltas,
+		},
+	}, nil
+}
+
+func (p *openAIProvider) CompleteWithTools(ctx context.Context, model string, req CompletionRequest, tools []Tool) (*ToolCompletionResponse, error) {
+	chatReq := p.chatRequest(model, req, false)
+	for _, tool := range tools {
+		chatReq.Tools = append(chatReq.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if len(tools) == 1 {
+		chatReq.ToolChoice = openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: tools[0].Name},
+		}
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tool completion: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("completion returned no choices")
+	}
+
+	message := resp.Choices[0].Message
+	result := &ToolCompletionResponse{
+		Content: message.Content,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}
+	for _, call := range message.ToolCalls {
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			Name:      call.Function.Name,
+			Arguments: json.RawMessage(call.Function.Arguments),
+		})
+	}
+
+	return result, nil
+}
+
+func (p *openAIProvider) GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	resp, err := p.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input:      texts,
+		Model:      openai.EmbeddingModel(model),
+		Dimensions: p.dimensions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding count mismatch: got %d, expected %d", len(resp.Data), len(texts))
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) || embeddings[data.Index] != nil {
+			return nil, fmt.Errorf("invalid embedding index %d", data.Index)
+		}
+
+		embedding := make([]float32, len(data.Embedding))
+		copy(embedding, data.Embedding)
+		embeddings[data.Index] = embedding
+	}
+
+	return embeddings, nil
+}
+
+func (p *openAIProvider) chatRequest(model string, req CompletionRequest, stream bool) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: req.SystemPrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: req.UserPrompt,
+			},
+		},
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		Stream:      stream,
+	}
+}
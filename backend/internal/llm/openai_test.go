@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// newTestOpenAIProvider returns a provider whose API answers every
+// embeddings request with body.
+func newTestOpenAIProvider(t *testing.T, body string) *openAIProvider {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	return &openAIProvider{client: openai.NewClientWithConfig(config)}
+}
+
+func TestOpenAIEmbeddingsFollowResponseIndex(t *testing.T) {
+	p := newTestOpenAIProvider(t, `{"object": "list", "data": [
+		{"object": "embedding", "index": 2, "embedding": [0.3, 0.3]},
+		{"object": "embedding", "index": 0, "embedding": [0.1, 0.1]},
+		{"object": "embedding", "index": 1, "embedding": [0.2, 0.2]}
+	]}`)
+
+	embeddings, err := p.GenerateEmbeddings(context.Background(), "text-embedding-3-small", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("GenerateEmbeddings: %v", err)
+	}
+
+	want := [][]float32{{0.1, 0.1}, {0.2, 0.2}, {0.3, 0.3}}
+	if !reflect.DeepEqual(embeddings, want) {
+		t.Errorf("embeddings = %v, want them aligned with their inputs %v", embeddings, want)
+	}
+}
+
+func TestOpenAIEmbeddingsRejectMisalignedResponses(t *testing.T) {
+	tests := map[string]string{
+		"missing embedding":  `{"data": [{"index": 0, "embedding": [0.1]}]}`,
+		"duplicate index":    `{"data": [{"index": 0, "embedding": [0.1]}, {"index": 0, "embedding": [0.2]}]}`,
+		"index out of range": `{"data": [{"index": 0, "embedding": [0.1]}, {"index": 5, "embedding": [0.2]}]}`,
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := newTestOpenAIProvider(t, body)
+
+			_, err := p.GenerateEmbeddings(context.Background(), "text-embedding-3-small", []string{"a", "b"})
+			if err == nil || !(strings.Contains(err.Error(), "mismatch") || strings.Contains(err.Error(), "invalid embedding index")) {
+				t.Errorf("error = %v, want the misaligned response rejected", err)
+			}
+		})
+	}
+}
+
+func TestOpenAICompleteWithToolsParsesToolCalls(t *testing.T) {
+	var sent openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "tool_calls": [
+			{"id": "call-1", "type": "function", "function": {"name": "submit_plan", "arguments": "{\"steps\": 2}"}}
+		]}}], "usage": {"prompt_tokens": 40, "completion_tokens": 8, "total_tokens": 48}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	p := &openAIProvider{client: openai.NewClientWithConfig(config)}
+
+	resp, err := p.CompleteWithTools(context.Background(), "gpt-4o", CompletionRequest{UserPrompt: "plan"}, []Tool{{
+		Name:       "submit_plan",
+		Parameters: json.RawMessage(`{"type": "object", "properties": {"steps": {"type": "integer"}}}`),
+	}})
+	if err != nil {
+		t.Fatalf("CompleteWithTools: %v", err)
+	}
+
+	if len(sent.Tools) != 1 || sent.Tools[0].Function.Name != "submit_plan" {
+		t.Errorf("request tools = %+v, want submit_plan", sent.Tools)
+	}
+	if choice, _ := json.Marshal(sent.ToolChoice); !strings.Contains(string(choice), `"submit_plan"`) {
+		t.Errorf("tool_choice = %s, want the only tool forced", choice)
+	}
+
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "submit_plan" || string(resp.ToolCalls[0].Arguments) != `{"steps": 2}` {
+		t.Errorf("tool calls = %+v, want the submit_plan arguments", resp.ToolCalls)
+	}
+	if resp.Usage.TotalTokens != 48 {
+		t.Errorf("usage = %+v, want 48 total tokens", resp.Usage)
+	}
+}
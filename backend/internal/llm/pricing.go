@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+type Price struct {
+	InputPer1K  float64
+	OutputPer1K float64
+}
+
+var defaultPrices = map[string]Price{
+	"gpt-4":                       {InputPer1K: 0.03, OutputPer1K: 0.06},
+	"gpt-4-turbo":                 {InputPer1K: 0.01, OutputPer1K: 0.03},
+	"gpt-4o":                      {InputPer1K: 0.0025, OutputPer1K: 0.01},
+	"gpt-4o-mini":                 {InputPer1K: 0.00015, OutputPer1K: 0.0006},
+	"gpt-3.5-turbo":               {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+	"text-embedding-3-small":      {InputPer1K: 0.00002},
+	"text-embedding-3-large":      {InputPer1K: 0.00013},
+	"text-embedding-ada-002":      {InputPer1K: 0.0001},
+	"claude-3-opus":               {InputPer1K: 0.015, OutputPer1K: 0.075},
+	"claude-3-5-sonnet":           {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"claude-3-sonnet":             {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"claude-3-haiku":              {InputPer1K: 0.00025, OutputPer1K: 0.00125},
+	"anthropic.claude-3-5-sonnet": {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"anthropic.claude-3-sonnet":   {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"anthropic.claude-3-haiku":    {InputPer1K: 0.00025, OutputPer1K: 0.00125},
+	"amazon.titan-embed-text-v1":  {InputPer1K: 0.0001},
+	"amazon.titan-embed-text-v2":  {InputPer1K: 0.00002},
+}
+
+type CostEstimator struct {
+	prices map[string]Price
+	warned sync.Map
+}
+
+func NewCostEstimator(overrides map[string]Price) *CostEstimator {
+	prices := make(map[string]Price, len(defaultPrices)+len(overrides))
+	for model, price := range defaultPrices {
+		prices[model] = price
+	}
+	for model, price := range overrides {
+		prices[strings.ToLower(model)] = price
+	}
+
+	return &CostEstimator{prices: prices}
+}
+
+func (e *CostEstimator) Estimate(model string, usage Usage) float64 {
+	price, ok := e.lookup(model)
+	if !ok {
+		if _, seen := e.warned.LoadOrStore(model, struct{}{}); !seen {
+			logger.Warn("No price configured for model, recording zero cost", zap.String("model", model))
+		}
+		return 0
+	}
+
+	return float64(usage.PromptTokens)/1000*price.InputPer1K +
+		float64(usage.CompletionTokens)/1000*price.OutputPer1K
+}
+
+func (e *CostEstimator) lookup(model string) (Price, bool) {
+	model = strings.ToLower(model)
+	if price, ok := e.prices[model]; ok {
+		return price, true
+	}
+
+	// Dated and versioned model IDs (gpt-4o-2024-08-06, anthropic.claude-3-haiku-20240307-v1:0)
+	// fall back to the longest configured prefix.
+	var best string
+	for name := range e.prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+
+	return e.prices[best], true
+}
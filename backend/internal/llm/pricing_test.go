@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+func TestCostEstimatorEstimate(t *testing.T) {
+	e := NewCostEstimator(map[string]Price{"GPT-4": {InputPer1K: 0.01, OutputPer1K: 0.02}})
+
+	tests := []struct {
+		name  string
+		model string
+		usage Usage
+		want  float64
+	}{
+		{
+			name:  "input and output tokens",
+			model: "gpt-4o",
+			usage: Usage{PromptTokens: 2000, CompletionTokens: 500},
+			want:  2*0.0025 + 0.5*0.01,
+		},
+		{
+			name:  "embedding model",
+			model: "text-embedding-3-small",
+			usage: Usage{PromptTokens: 10000},
+			want:  10 * 0.00002,
+		},
+		{
+			name:  "dated model falls back to the longest prefix",
+			model: "gpt-4o-mini-2024-07-18",
+			usage: Usage{PromptTokens: 1000, CompletionTokens: 1000},
+			want:  0.00015 + 0.0006,
+		},
+		{
+			name:  "override replaces the default price",
+			model: "gpt-4",
+			usage: Usage{PromptTokens: 1000, CompletionTokens: 1000},
+			want:  0.01 + 0.02,
+		},
+		{
+			name:  "unknown model",
+			model: "llama-3-70b",
+			usage: Usage{PromptTokens: 1000, CompletionTokens: 1000},
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.Estimate(tt.model, tt.usage); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("Estimate(%q) = %v, want %v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCostEstimatorWarnsOncePerUnknownModel(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "test.log")
+	if err := logger.Init("warn", "json", output); err != nil {
+		t.Fatalf("init logger: %v", err)
+	}
+
+	e := NewCostEstimator(nil)
+	for i := 0; i < 3; i++ {
+		e.Estimate("llama-3-70b", Usage{PromptTokens: 100})
+		e.Estimate("mistral-large", Usage{PromptTokens: 100})
+	}
+	logger.Sync()
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	if n := strings.Count(string(data), "No price configured"); n != 2 {
+		t.Errorf("logged %d missing-price warnings, want one per model:\n%s", n, data)
+	}
+}
@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrEmbeddingsUnsupported = errors.New("provider does not support embeddings")
+
+type Provider interface {
+	Name() string
+	Complete(ctx context.Context, model string, req CompletionRequest) (*CompletionResponse, error)
+	CompleteStream(ctx context.Context, model string, req CompletionRequest, onDelta StreamFunc) (*CompletionResponse, error)
+	GenerateEmbeddings(ctx context.Context, model string, texts []string) ([][]float32, error)
+}
+
+type Config struct {
+	Provider              string
+	APIKey                string
+	Model                 string
+	EmbeddingProvider     string
+	EmbeddingAPIKey       string
+	EmbeddingModel        string
+	Region                string
+	Temperature           float32
+	MaxTokens             int
+	Pricing               map[string]Price
+	EmbeddingDim          int
+	MaxConcurrentRequests int
+	EmbeddingConcurrency  int
+}
+
+func NewProvider(name, apiKey, region string) (Provider, error) {
+	switch name {
+	case "", "openai":
+		if apiKey == "" {
+			return nil, fmt.Errorf("openai provider requires an API key")
+		}
+		return newOpenAIProvider(apiKey), nil
+	case "anthropic":
+		if apiKey == "" {
+			return nil, fmt.Errorf("anthropic provider requires an API key")
+		}
+		return newAnthropicProvider(apiKey), nil
+	case "bedrock":
+		return newBedrockProvider(region)
+	default:
+		return nil, fmt.Errorf("unsupported LLM provider: %s", name)
+	}
+}
+
+func embeddingProviderName(cfg Config) string {
+	if cfg.EmbeddingProvider != "" {
+		return cfg.EmbeddingProvider
+	}
+	if cfg.Provider == "anthropic" {
+		return "openai"
+	}
+	return cfg.Provider
+}
@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/retry"
+)
+
+var ErrToolsUnsupported = errors.New("provider does not support tool calling")
+
+// Tool describes a function the model may call. Parameters is the JSON
+// schema of its arguments.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+type ToolCall struct {
+	Name      string
+	Arguments json.RawMessage
+}
+
+type ToolCompletionResponse struct {
+	Content   string
+	ToolCalls []ToolCall
+	Usage     Usage
+}
+
+// ToolProvider is implemented by providers with native tool calling.
+type ToolProvider interface {
+	CompleteWithTools(ctx context.Context, model string, req CompletionRequest, tools []Tool) (*ToolCompletionResponse, error)
+}
+
+// CompleteWithTools asks the model to answer by calling one of tools, which
+// is forced when only one is given. It returns ErrToolsUnsupported for
+// providers without tool calling so callers can fall back to Complete.
+func (c *Client) CompleteWithTools(ctx context.Context, req CompletionRequest, tools []Tool) (*ToolCompletionResponse, error) {
+	toolProvider, ok := c.provider.(ToolProvider)
+	if !ok {
+		return nil, ErrToolsUnsupported
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if req.Temperature == 0 {
+		req.Temperature = c.temperature
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = c.maxTokens
+	}
+
+	var result *ToolCompletionResponse
+
+	err := c.cb.Execute(ctx, func() error {
+		return retry.Do(ctx, c.retryConfig, func() error {
+			release, err := c.acquire(ctx)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			resp, err := toolProvider.CompleteWithTools(ctx, c.model, req, tools)
+			if err != nil {
+				return err
+			}
+
+			logger.Debug("LLM tool completion generated",
+				zap.Int("tool_calls", len(resp.ToolCalls)),
+				zap.Int("prompt_tokens", resp.Usage.PromptTokens),
+				zap.Int("completion_tokens", resp.Usage.CompletionTokens),
+			)
+
+			c.recordTokenUsage(ctx, resp.Usage)
+			result = resp
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/aws-agent/backend/pkg/circuitbreaker"
 )
 
 var (
@@ -89,6 +91,23 @@ var (
 		},
 	)
 
+	WebSearchDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "aws_rag_web_search_duration_seconds",
+			Help:    "Web search duration in seconds",
+			Buckets: []float64{0.25, 0.5, 1, 2, 5, 10, 20},
+		},
+		[]string{"backend"},
+	)
+
+	WebSearchRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aws_rag_web_search_requests_total",
+			Help: "Total web search requests by backend and status",
+		},
+		[]string{"backend", "status"},
+	)
+
 	CacheHits = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "aws_rag_cache_hits_total",
@@ -126,6 +145,29 @@ var (
 		},
 	)
 
+	KGEntitiesAutoCreated = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "aws_rag_kg_entities_auto_created_total",
+			Help: "Total entities auto-created for relation endpoints missing from the knowledge graph",
+		},
+	)
+
+	LLMStagesSkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aws_rag_llm_stages_skipped_total",
+			Help: "Optional LLM stages skipped because the request's LLM call budget was spent",
+		},
+		[]string{"stage"},
+	)
+
+	CircuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aws_rag_circuit_breaker_state",
+			Help: "Circuit breaker state (0=closed, 1=half-open, 2=open)",
+		},
+		[]string{"name"},
+	)
+
 	AWSActionsExecuted = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "aws_rag_aws_actions_executed_total",
@@ -141,17 +183,26 @@ func Init() {
 	prometheus.MustRegister(RetrievalHitRate)
 	prometheus.MustRegister(LLMTokensUsed)
 	prometheus.MustRegister(LLMCost)
+	prometheus.MustRegister(LLMStagesSkipped)
 	prometheus.MustRegister(UserSatisfaction)
 	prometheus.MustRegister(ConfidenceScore)
 	prometheus.MustRegister(KGResultsCount)
 	prometheus.MustRegister(VectorResultsCount)
 	prometheus.MustRegister(WebSearchTriggered)
+	prometheus.MustRegister(WebSearchDuration)
+	prometheus.MustRegister(WebSearchRequests)
 	prometheus.MustRegister(CacheHits)
 	prometheus.MustRegister(CacheMisses)
 	prometheus.MustRegister(DocumentsProcessed)
 	prometheus.MustRegister(KGEntitiesTotal)
 	prometheus.MustRegister(KGRelationsTotal)
+	prometheus.MustRegister(KGEntitiesAutoCreated)
 	prometheus.MustRegister(AWSActionsExecuted)
+	prometheus.MustRegister(CircuitBreakerState)
+}
+
+func RecordCircuitBreakerState(name string, from, to circuitbreaker.State) {
+	CircuitBreakerState.WithLabelValues(name).Set(float64(to))
 }
 
 func MetricsHandler() fiber.Handler {
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/aws-agent/backend/pkg/circuitbreaker"
+)
+
+func TestCircuitBreakerStateGauge(t *testing.T) {
+	const name = "metrics-test"
+	cb := circuitbreaker.NewCircuitBreaker(name, circuitbreaker.Config{
+		FailureThreshold: 1,
+		SuccessThreshold: 1,
+		Timeout:          20 * time.Millisecond,
+		OnStateChange:    RecordCircuitBreakerState,
+	})
+	gauge := CircuitBreakerState.WithLabelValues(name)
+
+	assertState := func(want circuitbreaker.State) {
+		t.Helper()
+		// The breaker moves to half-open lazily, so read Stats first.
+		if got := cb.Stats().State; got != want {
+			t.Errorf("Stats().State = %s, want %s", got, want)
+		}
+		if got := testutil.ToFloat64(gauge); got != float64(want) {
+			t.Errorf("gauge = %v, want %v (%s)", got, float64(want), want)
+		}
+	}
+
+	assertState(circuitbreaker.StateClosed)
+
+	cb.Execute(context.Background(), func() error { return errors.New("boom") })
+	assertState(circuitbreaker.StateOpen)
+	if stats := cb.Stats(); stats.Generation == 0 || stats.ConsecutiveFailures != 0 {
+		t.Errorf("stats after opening = %+v, want a new generation with reset counts", stats)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	assertState(circuitbreaker.StateHalfOpen)
+
+	if err := cb.Execute(context.Background(), func() error { return nil }); err != nil {
+		t.Fatalf("half-open probe: %v", err)
+	}
+	assertState(circuitbreaker.StateClosed)
+}
@@ -0,0 +1,55 @@
+package requestid
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/aws-agent/backend/pkg/ctxutil"
+)
+
+// LocalsKey is where the request ID is stored in the Fiber locals, the same
+// key Fiber's own requestid middleware uses.
+const LocalsKey = "requestid"
+
+const maxRequestIDLength = 128
+
+// New assigns each request an ID, reusing a well-formed incoming
+// X-Request-ID, and echoes it in the response. The ID is stored in the
+// locals and in the user context, where logger.FromContext picks it up.
+func New() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+
+		c.Set(fiber.HeaderXRequestID, id)
+		c.Locals(LocalsKey, id)
+		c.SetUserContext(ctxutil.WithRequestID(c.UserContext(), id))
+
+		return c.Next()
+	}
+}
+
+// FromCtx returns the request ID assigned by New.
+func FromCtx(c *fiber.Ctx) string {
+	id, _ := c.Locals(LocalsKey).(string)
+	return id
+}
+
+// validRequestID limits client IDs to a short token so they cannot inject
+// content into log lines or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
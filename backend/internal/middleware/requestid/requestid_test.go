@@ -0,0 +1,54 @@
+package requestid
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aws-agent/backend/pkg/ctxutil"
+)
+
+func TestNewAssignsRequestID(t *testing.T) {
+	app := fiber.New()
+	app.Use(New())
+	app.Get("/", func(c *fiber.Ctx) error {
+		if FromCtx(c) != ctxutil.RequestID(c.UserContext()) {
+			t.Errorf("locals %q and user context %q disagree", FromCtx(c), ctxutil.RequestID(c.UserContext()))
+		}
+		return c.SendString(FromCtx(c))
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "none", incoming: ""},
+		{name: "well formed", incoming: "trace-01:abc.DEF_2", keep: true},
+		{name: "log injection", incoming: "abc\" level=error"},
+		{name: "too long", incoming: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(fiber.HeaderXRequestID, tt.incoming)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("GET /: %v", err)
+			}
+
+			id := resp.Header.Get(fiber.HeaderXRequestID)
+			if tt.keep && id != tt.incoming {
+				t.Errorf("request ID = %q, want the incoming %q", id, tt.incoming)
+			}
+			if !tt.keep && (id == tt.incoming || !validRequestID(id)) {
+				t.Errorf("request ID = %q, want a generated one replacing %q", id, tt.incoming)
+			}
+		})
+	}
+}
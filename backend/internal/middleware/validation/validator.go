@@ -1,9 +1,12 @@
 package validation
 
 import (
+	"errors"
 	"net/url"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
@@ -12,25 +15,77 @@ import (
 var (
 	sqlInjectionPattern = regexp.MustCompile(`(?i)(union|select|insert|update|delete|drop|create|alter|exec|script|javascript|onerror|onload)`)
 	xssPattern          = regexp.MustCompile(`(?i)(<script|<iframe|javascript:|onerror=|onload=|onclick=)`)
+	encodedTokenPattern = regexp.MustCompile(`^[A-Za-z0-9+/=_-]+$`)
+	// hexIdentifierPattern matches dash-separated hex identifiers such as
+	// UUIDs and KMS key IDs, which look encoded but are common in queries.
+	hexIdentifierPattern = regexp.MustCompile(`^[0-9A-Fa-f]+(-[0-9A-Fa-f]+)+$`)
+)
+
+var (
+	ErrQueryTooLong = errors.New("Query exceeds maximum length")
+	ErrEncodedQuery = errors.New("Query appears to be encoded or binary data rather than natural language")
+)
+
+const (
+	minEncodedInputChars = 64
+	minEncodedTokenChars = 32
 )
 
 type Config struct {
 	MaxQueryLength      int
 	MaxDocumentSize     int
+	EncodedThreshold    float64
 	AllowedContentTypes []string
 	Logger              *zap.Logger
 }
 
-func Middleware(cfg Config) fiber.Handler {
+// Validator holds the query checks shared by the HTTP middleware and the
+// WebSocket handler, so both transports accept the same queries.
+type Validator struct {
+	cfg Config
+}
+
+func NewValidator(cfg Config) *Validator {
 	if cfg.MaxQueryLength == 0 {
 		cfg.MaxQueryLength = 5000
 	}
 	if cfg.MaxDocumentSize == 0 {
 		cfg.MaxDocumentSize = 10 * 1024 * 1024
 	}
+	if cfg.EncodedThreshold <= 0 {
+		cfg.EncodedThreshold = 0.5
+	}
 	if len(cfg.AllowedContentTypes) == 0 {
 		cfg.AllowedContentTypes = []string{"application/json", "multipart/form-data"}
 	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+
+	return &Validator{cfg: cfg}
+}
+
+// CheckQuery returns ErrQueryTooLong or ErrEncodedQuery when query should
+// be rejected. fields identify the caller in the log line.
+func (v *Validator) CheckQuery(query string, fields ...zap.Field) error {
+	if len(query) > v.cfg.MaxQueryLength {
+		return ErrQueryTooLong
+	}
+
+	if ratio := encodedRatio(query); ratio > v.cfg.EncodedThreshold {
+		v.cfg.Logger.Warn("Rejected encoded query payload", append(fields,
+			zap.Int("length", len(query)),
+			zap.Float64("encoded_ratio", ratio),
+		)...)
+		return ErrEncodedQuery
+	}
+
+	return nil
+}
+
+func Middleware(cfg Config) fiber.Handler {
+	v := NewValidator(cfg)
+	cfg = v.cfg
 
 	return func(c *fiber.Ctx) error {
 		if c.Method() == "POST" || c.Method() == "PUT" {
@@ -68,9 +123,9 @@ func Middleware(cfg Config) fiber.Handler {
 				})
 			}
 
-			if len(query) > cfg.MaxQueryLength {
+			if err := v.CheckQuery(query, zap.String("ip", c.IP())); err != nil {
 				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"error": "Query exceeds maximum length",
+					"error": err.Error(),
 				})
 			}
 
@@ -99,7 +154,37 @@ func Middleware(cfg Config) fiber.Handler {
 			c.Locals("sanitized_body", req)
 		}
 
-		if strings.Contains(path, "/api/v1/documents") {
+		if strings.HasSuffix(path, "/api/v1/documents/batch") {
+			var req struct {
+				Documents []map[string]interface{} `json:"documents"`
+			}
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid JSON format",
+				})
+			}
+
+			if len(req.Documents) == 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Documents are required and must be an array",
+				})
+			}
+
+			invalid := make(map[int]string)
+			for i, doc := range req.Documents {
+				urlStr, ok := doc["url"].(string)
+				if !ok || !isValidURL(urlStr) {
+					invalid[i] = "Invalid URL format"
+					continue
+				}
+
+				content, _ := doc["html_content"].(string)
+				if len(content) > cfg.MaxDocumentSize {
+					invalid[i] = "Document content exceeds maximum size"
+				}
+			}
+			c.Locals("invalid_documents", invalid)
+		} else if strings.Contains(path, "/api/v1/documents") {
 			var req map[string]interface{}
 			if err := c.BodyParser(&req); err != nil {
 				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -140,6 +225,32 @@ func containsXSS(input string) bool {
 	return xssPattern.MatchString(input)
 }
 
+func encodedRatio(input string) float64 {
+	total := utf8.RuneCountInString(input)
+	if total < minEncodedInputChars {
+		return 0
+	}
+
+	suspicious := 0
+	for _, r := range input {
+		if r == utf8.RuneError || (!unicode.IsPrint(r) && !unicode.IsSpace(r)) {
+			suspicious++
+		}
+	}
+
+	for _, token := range strings.Fields(input) {
+		token = strings.Trim(token, ".,;:!?()[]{}\"'")
+		if hexIdentifierPattern.MatchString(token) {
+			continue
+		}
+		if len(token) >= minEncodedTokenChars && encodedTokenPattern.MatchString(token) {
+			suspicious += len(token)
+		}
+	}
+
+	return float64(suspicious) / float64(total)
+}
+
 func sanitizeString(input string) string {
 	input = strings.TrimSpace(input)
 	input = strings.ReplaceAll(input, "\x00", "")
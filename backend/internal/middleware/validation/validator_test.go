@@ -0,0 +1,81 @@
+package validation
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCheckQuery(t *testing.T) {
+	blob := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("binary payload \x00\x01\x02 ", 20)))
+
+	tests := []struct {
+		name  string
+		query string
+		want  error
+	}{
+		{name: "natural language", query: "Why does my Lambda function time out after 3 seconds when it calls DynamoDB inside a VPC?"},
+		{name: "base64 blob", query: "decode this " + blob, want: ErrEncodedQuery},
+		{name: "bare base64", query: blob, want: ErrEncodedQuery},
+		{
+			name:  "uuids",
+			query: "Request 3f2c1a9e-8b7d-4e6f-9a0b-1c2d3e4f5a6b and 7e6d5c4b-3a29-4817-a6b5-c4d3e2f1a0b9, 0a1b2c3d-4e5f-4a6b-8c9d-0e1f2a3b4c5d failed",
+		},
+		{
+			name:  "arns",
+			query: "Access denied for arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab from arn:aws:iam::123456789012:role/service-role/MyFunctionRole-abcdefghijkl",
+		},
+		{name: "too long", query: strings.Repeat("Lambda timeout ", 400), want: ErrQueryTooLong},
+	}
+
+	v := NewValidator(Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.CheckQuery(tt.query); !errors.Is(err, tt.want) {
+				t.Errorf("CheckQuery error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckQueryThreshold(t *testing.T) {
+	// About a third of the query is one long encoded token.
+	query := "Is this key valid for my bucket policy please " + strings.Repeat("QUJD", 10)
+
+	if err := NewValidator(Config{EncodedThreshold: 0.5}).CheckQuery(query); err != nil {
+		t.Errorf("threshold 0.5: error = %v, want acceptance", err)
+	}
+	if err := NewValidator(Config{EncodedThreshold: 0.2}).CheckQuery(query); !errors.Is(err, ErrEncodedQuery) {
+		t.Errorf("threshold 0.2: error = %v, want ErrEncodedQuery", err)
+	}
+}
+
+func TestMiddlewareRejectsEncodedQuery(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware(Config{}))
+	app.Post("/api/v1/query", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	post := func(query string) int {
+		req := httptest.NewRequest(fiber.MethodPost, "/api/v1/query", strings.NewReader(`{"query": "`+query+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	blob := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("\xff\xfe payload ", 30)))
+	if status := post(blob); status != fiber.StatusBadRequest {
+		t.Errorf("base64 query status = %d, want %d", status, fiber.StatusBadRequest)
+	}
+	if status := post("How do I enable S3 versioning?"); status != fiber.StatusOK {
+		t.Errorf("normal query status = %d, want %d", status, fiber.StatusOK)
+	}
+}
@@ -0,0 +1,135 @@
+package query
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/search/web"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/tokenizer"
+)
+
+const (
+	kgContextHeader     = "Structured Knowledge:\n"
+	vectorContextHeader = "\nRelevant Documentation:\n"
+)
+
+type assembledContext struct {
+	KGContext     string
+	VectorContext string
+	Fused         []fusedResult
+	Web           []web.SearchResult
+	Tokens        int
+}
+
+// promptBudget is the number of tokens the whole response prompt may use:
+// MaxPromptTokens, further capped so the completion still fits when the
+// model's context window is configured.
+func (e *Engine) promptBudget() int {
+	budget := e.cfg.MaxPromptTokens
+	if e.cfg.ContextWindowTokens > 0 {
+		budget = min(budget, e.cfg.ContextWindowTokens-llm.ResponseMaxTokens)
+	}
+	return budget
+}
+
+// assembleContext packs evidence into the prompt in rank order. The system
+// prompt, template, query, conversation history and headroom are charged
+// first; each fused result is then added if its formatted block still fits,
+// so a long chunk that does not fit is skipped in favour of shorter
+// lower-ranked ones. Web results fill whatever is left.
+func (e *Engine) assembleContext(query, history string, fused []fusedResult, webResults []web.SearchResult) assembledContext {
+	budget := e.promptBudget()
+	used := llm.ResponsePromptTokens(query, history) + e.cfg.PromptHeadroomTokens +
+		tokenizer.Count(kgContextHeader) + tokenizer.Count(vectorContextHeader)
+
+	var kept []fusedResult
+	var dropped []string
+	chunks := 0
+	for _, result := range fused {
+		var block string
+		if result.Triple != nil {
+			block = formatTriple(*result.Triple)
+		} else {
+			block = e.formatChunk(chunks+1, *result.Vector)
+		}
+
+		cost := tokenizer.Count(block)
+		if used+cost > budget {
+			dropped = append(dropped, describeEvidence(result))
+			continue
+		}
+
+		used += cost
+		kept = append(kept, result)
+		if result.Vector != nil {
+			chunks++
+		}
+	}
+
+	var keptWeb []web.SearchResult
+	if e.webSearch != nil {
+		webTokens := 0
+		for _, result := range webResults {
+			candidate := append(keptWeb[:len(keptWeb):len(keptWeb)], result)
+			tokens := tokenizer.Count(e.webSearch.FormatContext(candidate))
+			if used+tokens-webTokens > budget {
+				dropped = append(dropped, "web:"+result.URL)
+				continue
+			}
+
+			used += tokens - webTokens
+			webTokens = tokens
+			keptWeb = candidate
+		}
+	}
+
+	assembled := e.formatContext(kept, keptWeb)
+	assembled.Tokens = llm.ResponsePromptTokens(query, history) +
+		tokenizer.Count(assembled.KGContext) + tokenizer.Count(assembled.VectorContext)
+
+	if len(dropped) > 0 {
+		logger.Info("Evicted evidence to fit prompt budget",
+			zap.Int("budget_tokens", budget),
+			zap.Int("prompt_tokens", assembled.Tokens),
+			zap.Strings("dropped", dropped),
+		)
+	}
+
+	return assembled
+}
+
+func (e *Engine) formatContext(fused []fusedResult, webResults []web.SearchResult) assembledContext {
+	var triples []neo4j.Triple
+	var chunks []zilliz.SearchResult
+	for _, result := range fused {
+		if result.Triple != nil {
+			triples = append(triples, *result.Triple)
+		} else {
+			chunks = append(chunks, *result.Vector)
+		}
+	}
+
+	vectorContext := e.formatVectorContext(chunks)
+	if e.webSearch != nil {
+		vectorContext += e.webSearch.FormatContext(webResults)
+	}
+
+	return assembledContext{
+		KGContext:     e.formatKGContext(triples),
+		VectorContext: vectorContext,
+		Fused:         fused,
+		Web:           webResults,
+	}
+}
+
+func describeEvidence(result fusedResult) string {
+	if result.Triple != nil {
+		return fmt.Sprintf("kg:%s %s %s", result.Triple.Subject.Name, result.Triple.Predicate, result.Triple.Object.Name)
+	}
+	return "vector:" + result.Vector.ChunkID
+}
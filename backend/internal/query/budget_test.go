@@ -0,0 +1,155 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/search/web"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+	"github.com/aws-agent/backend/pkg/tokenizer"
+)
+
+func TestAssembleContextTrimsWebResults(t *testing.T) {
+	const query = "Lambda timeout"
+	base := llm.ResponsePromptTokens(query, "") + tokenizer.Count(kgContextHeader) + tokenizer.Count(vectorContextHeader)
+
+	llmClient := llmtest.NewClient(&llmtest.Provider{})
+	engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{}, llmClient, nil, Config{
+		MaxPromptTokens:      base + 10 + 150,
+		PromptHeadroomTokens: 10,
+	}).WithWebSearch(web.NewClient(web.Config{MaxContextChars: 50000}, llmClient, nil))
+
+	results := []web.SearchResult{
+		{Title: "Timeouts", URL: "https://docs.aws.amazon.com/lambda/timeouts", Content: "Raise the function timeout."},
+		{Title: "Everything", URL: "https://docs.aws.amazon.com/lambda/all", Content: strings.Repeat("Lambda configuration detail ", 500)},
+		{Title: "Limits", URL: "https://docs.aws.amazon.com/lambda/limits", Content: "The maximum timeout is 900 seconds."},
+	}
+
+	assembled := engine.assembleContext(query, "", nil, results)
+
+	var kept []string
+	for _, result := range assembled.Web {
+		kept = append(kept, result.URL)
+	}
+	want := []string{results[0].URL, results[2].URL}
+	if strings.Join(kept, ",") != strings.Join(want, ",") {
+		t.Errorf("kept web results %v, want the oversized one trimmed: %v", kept, want)
+	}
+	if strings.Contains(assembled.VectorContext, "configuration detail") {
+		t.Error("the oversized web result reached the prompt context")
+	}
+	if !strings.Contains(assembled.VectorContext, "900 seconds") {
+		t.Error("a web result that fits was left out of the context")
+	}
+}
+
+func TestAssembleContextEvictsLowestRankedEvidence(t *testing.T) {
+	const query = "Lambda timeout"
+	history := strings.Repeat("User: earlier question about Lambda limits\n", 20)
+	base := llm.ResponsePromptTokens(query, history) + tokenizer.Count(kgContextHeader) + tokenizer.Count(vectorContextHeader)
+
+	engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{}, llmtest.NewClient(&llmtest.Provider{}), nil, Config{
+		MaxPromptTokens:       base + 10 + 120,
+		PromptHeadroomTokens:  10,
+		ContextChunkMaxTokens: 300,
+	})
+
+	long := strings.Repeat("Lambda configuration detail ", 200)
+	fused := []fusedResult{
+		{Vector: &zilliz.SearchResult{ChunkID: "top", Text: "Raise the function timeout to 900 seconds."}, Score: 0.9},
+		{Triple: &neo4j.Triple{
+			Subject:   neo4j.Entity{Name: "Lambda"},
+			Predicate: "HAS_LIMIT",
+			Object:    neo4j.Entity{Name: "timeout"},
+		}, Score: 0.8},
+		{Vector: &zilliz.SearchResult{ChunkID: "long-1", Text: long}, Score: 0.7},
+		{Vector: &zilliz.SearchResult{ChunkID: "long-2", Text: long}, Score: 0.6},
+		{Vector: &zilliz.SearchResult{ChunkID: "last", Text: "Timeouts are logged to CloudWatch."}, Score: 0.5},
+	}
+
+	assembled := engine.assembleContext(query, history, fused, nil)
+
+	if budget := engine.promptBudget(); assembled.Tokens+10 > budget {
+		t.Errorf("prompt uses %d tokens plus headroom, want it within the budget of %d", assembled.Tokens, budget)
+	}
+
+	var kept []string
+	for _, result := range assembled.Fused {
+		if result.Vector != nil {
+			kept = append(kept, result.Vector.ChunkID)
+		} else {
+			kept = append(kept, result.Triple.Predicate)
+		}
+	}
+	if want := "top,HAS_LIMIT,last"; strings.Join(kept, ",") != want {
+		t.Errorf("kept evidence %v, want the top-ranked results and the short tail in rank order: %s", kept, want)
+	}
+	if strings.Contains(assembled.VectorContext, "configuration detail") {
+		t.Error("an evicted chunk reached the prompt context")
+	}
+	if !strings.Contains(assembled.VectorContext, "900 seconds") || !strings.Contains(assembled.KGContext, "HAS_LIMIT") {
+		t.Errorf("top-ranked evidence missing from the context:\nKG: %s\nvector: %s", assembled.KGContext, assembled.VectorContext)
+	}
+}
+
+func TestResponsePromptStaysWithinBudget(t *testing.T) {
+	const headroom = 50
+
+	tests := []struct {
+		name  string
+		cfg   Config
+		words int
+	}{
+		{name: "short chunks", cfg: Config{MaxPromptTokens: 1200}, words: 20},
+		{name: "chunks at the per-chunk cap", cfg: Config{MaxPromptTokens: 1200, ContextChunkMaxTokens: 200}, words: 400},
+		{name: "chunks larger than the budget", cfg: Config{MaxPromptTokens: 1200, ContextChunkMaxTokens: 5000}, words: 3000},
+		{name: "context window caps the budget", cfg: Config{MaxPromptTokens: 6000, ContextWindowTokens: llm.ResponseMaxTokens + 900}, words: 150},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []zilliz.SearchResult
+			for i := 0; i < 10; i++ {
+				results = append(results, zilliz.SearchResult{
+					ChunkID: fmt.Sprintf("chunk-%d", i),
+					Text:    strings.Repeat("Lambda concurrency detail ", tt.words/3),
+					DocURL:  fmt.Sprintf("https://docs.aws.amazon.com/lambda/%d", i),
+					Score:   0.9,
+				})
+			}
+
+			provider := &llmtest.Provider{}
+			cfg := tt.cfg
+			cfg.PromptHeadroomTokens = headroom
+			engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{results: results}, llmtest.NewClient(provider), nil, cfg)
+
+			if _, err := engine.ProcessQuery(context.Background(), QueryRequest{Query: "Lambda concurrency limits", UserID: "u1"}); err != nil {
+				t.Fatalf("ProcessQuery: %v", err)
+			}
+
+			var prompt *llm.CompletionRequest
+			for _, req := range provider.Requests() {
+				if req.MaxTokens == llm.ResponseMaxTokens {
+					req := req
+					prompt = &req
+				}
+			}
+			if prompt == nil {
+				t.Fatal("no response prompt was sent")
+			}
+
+			budget := engine.promptBudget()
+			if used := tokenizer.Count(prompt.SystemPrompt) + tokenizer.Count(prompt.UserPrompt); used+headroom > budget {
+				t.Errorf("response prompt uses %d tokens plus %d headroom, want at most %d", used, headroom, budget)
+			}
+			if tt.words < 1000 && !strings.Contains(prompt.UserPrompt, "[source_1]") {
+				t.Error("no chunk was packed although chunks fit in the budget")
+			}
+		})
+	}
+}
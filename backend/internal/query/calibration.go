@@ -0,0 +1,296 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+var ErrInsufficientFeedback = errors.New("not enough feedback to calibrate confidence")
+
+const (
+	// maxCountFeature saturates the result-count features; beyond it more
+	// results say little about answer quality.
+	maxCountFeature = 10
+
+	calibrationIterations   = 5000
+	calibrationLearningRate = 1.0
+	calibrationL2           = 0.001
+)
+
+// confidenceSignals are the retrieval signals answer confidence is derived
+// from, both by the fixed heuristic and by the calibrated model.
+type confidenceSignals struct {
+	KGCount     int
+	VectorCount int
+	AvgKG       float64
+	AvgVector   float64
+	HasLink     bool
+}
+
+func newConfidenceSignals(kgResults []neo4j.Triple, vectorResults []zilliz.SearchResult, response string) confidenceSignals {
+	signals := confidenceSignals{
+		KGCount:     len(kgResults),
+		VectorCount: len(vectorResults),
+		HasLink:     strings.Contains(response, "http"),
+	}
+
+	for _, triple := range kgResults {
+		signals.AvgKG += triple.Confidence
+	}
+	if len(kgResults) > 0 {
+		signals.AvgKG /= float64(len(kgResults))
+	}
+
+	scored := 0
+	for _, result := range vectorResults {
+		if result.KeywordOnly {
+			continue
+		}
+		signals.AvgVector += float64(result.Score)
+		scored++
+	}
+	if scored > 0 {
+		signals.AvgVector /= float64(scored)
+	}
+
+	return signals
+}
+
+// sourceSignals approximates the retrieval signals of an answer served from
+// cache, where only the sources it cited are known.
+func sourceSignals(sources []Source, response string) confidenceSignals {
+	signals := confidenceSignals{HasLink: strings.Contains(response, "http")}
+	for _, source := range sources {
+		switch source.Type {
+		case "kg":
+			signals.KGCount++
+			signals.AvgKG += source.Confidence
+		case "vector":
+			signals.VectorCount++
+			signals.AvgVector += source.Confidence
+		}
+	}
+	if signals.KGCount > 0 {
+		signals.AvgKG /= float64(signals.KGCount)
+	}
+	if signals.VectorCount > 0 {
+		signals.AvgVector /= float64(signals.VectorCount)
+	}
+	return signals
+}
+
+func sampleSignals(sample models.CalibrationSample) confidenceSignals {
+	return confidenceSignals{
+		KGCount:     sample.KGResultsCount,
+		VectorCount: sample.VectorResultsCount,
+		AvgKG:       sample.AvgKGConfidence,
+		AvgVector:   sample.AvgVectorScore,
+		HasLink:     sample.HasLink,
+	}
+}
+
+// features scales the signals into [0, 1] so one learning rate suits all
+// coefficients. The order is part of the persisted model.
+func (s confidenceSignals) features() []float64 {
+	hasLink := 0.0
+	if s.HasLink {
+		hasLink = 1
+	}
+	return []float64{
+		float64(min(s.KGCount, maxCountFeature)) / maxCountFeature,
+		float64(min(s.VectorCount, maxCountFeature)) / maxCountFeature,
+		s.AvgKG,
+		s.AvgVector,
+		hasLink,
+	}
+}
+
+// heuristicConfidence is the fixed scoring used until feedback has been
+// used to calibrate the model.
+func heuristicConfidence(s confidenceSignals) float64 {
+	if s.KGCount == 0 && s.VectorCount == 0 {
+		return 0.3
+	}
+
+	confidence := 0.5
+	if s.KGCount > 0 {
+		confidence += s.AvgKG * 0.3
+	}
+	if s.VectorCount > 0 {
+		confidence += s.AvgVector * 0.2
+	}
+	if s.HasLink {
+		confidence += 0.1
+	}
+
+	return math.Min(confidence, 1.0)
+}
+
+func predictConfidence(calibration *models.ConfidenceCalibration, features []float64) float64 {
+	z := calibration.Bias
+	for i, x := range features {
+		z += calibration.Weights[i] * x
+	}
+	return sigmoid(z)
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
+
+// fitLogistic fits a logistic regression by batch gradient descent with L2
+// regularisation on the weights, returning the bias, weights and the mean
+// log loss on the training data.
+func fitLogistic(x [][]float64, y []float64, iterations int, learningRate, l2 float64) (float64, []float64, float64) {
+	if len(x) == 0 {
+		return 0, nil, 0
+	}
+
+	n := float64(len(x))
+	weights := make([]float64, len(x[0]))
+	var bias float64
+
+	gradient := make([]float64, len(weights))
+	for iter := 0; iter < iterations; iter++ {
+		for j := range gradient {
+			gradient[j] = 0
+		}
+		var biasGradient float64
+
+		for i, features := range x {
+			z := bias
+			for j, value := range features {
+				z += weights[j] * value
+			}
+			diff := sigmoid(z) - y[i]
+
+			biasGradient += diff
+			for j, value := range features {
+				gradient[j] += diff * value
+			}
+		}
+
+		bias -= learningRate * biasGradient / n
+		for j := range weights {
+			weights[j] -= learningRate * (gradient[j]/n + l2*weights[j])
+		}
+	}
+
+	var logLoss float64
+	for i, features := range x {
+		z := bias
+		for j, value := range features {
+			z += weights[j] * value
+		}
+		p := math.Min(math.Max(sigmoid(z), 1e-12), 1-1e-12)
+		logLoss -= y[i]*math.Log(p) + (1-y[i])*math.Log(1-p)
+	}
+
+	return bias, weights, logLoss / n
+}
+
+// Recalibrate fits the confidence model to the stored feedback, persists
+// the coefficients and starts using them for new answers.
+func (e *Engine) Recalibrate() (*models.ConfidenceCalibration, error) {
+	samples, err := e.db.GetCalibrationSamples(e.cfg.CalibrationMaxSamples)
+	if err != nil {
+		return nil, err
+	}
+
+	x := make([][]float64, 0, len(samples))
+	y := make([]float64, 0, len(samples))
+	helpful := 0
+	for _, sample := range samples {
+		x = append(x, sampleSignals(sample).features())
+		if sample.Helpful {
+			y = append(y, 1)
+			helpful++
+		} else {
+			y = append(y, 0)
+		}
+	}
+
+	if len(samples) < e.cfg.CalibrationMinSamples || helpful == 0 || helpful == len(samples) {
+		return nil, fmt.Errorf("%w: %d samples, %d helpful, need %d with both verdicts",
+			ErrInsufficientFeedback, len(samples), helpful, e.cfg.CalibrationMinSamples)
+	}
+
+	bias, weights, logLoss := fitLogistic(x, y, calibrationIterations, calibrationLearningRate, calibrationL2)
+
+	calibration := &models.ConfidenceCalibration{
+		Bias:      bias,
+		Weights:   weights,
+		Samples:   len(samples),
+		LogLoss:   logLoss,
+		CreatedAt: time.Now(),
+	}
+	if err := e.db.InsertConfidenceCalibration(calibration); err != nil {
+		return nil, err
+	}
+	e.calibration.Store(calibration)
+
+	logger.Info("Confidence model calibrated",
+		zap.Int("samples", calibration.Samples),
+		zap.Int("helpful", helpful),
+		zap.Float64("bias", calibration.Bias),
+		zap.Float64s("weights", calibration.Weights),
+		zap.Float64("log_loss", calibration.LogLoss),
+	)
+
+	return calibration, nil
+}
+
+// LoadCalibration restores the most recently persisted coefficients.
+func (e *Engine) LoadCalibration() error {
+	calibration, found, err := e.db.GetLatestConfidenceCalibration()
+	if err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+	if len(calibration.Weights) != len(confidenceSignals{}.features()) {
+		logger.Warn("Ignoring confidence calibration with a different feature set",
+			zap.Int("calibration_id", calibration.ID),
+			zap.Int("weights", len(calibration.Weights)),
+		)
+		return nil
+	}
+
+	e.calibration.Store(calibration)
+	logger.Info("Loaded confidence calibration",
+		zap.Int("calibration_id", calibration.ID),
+		zap.Int("samples", calibration.Samples),
+	)
+	return nil
+}
+
+func (e *Engine) StartCalibrationRefresher(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if _, err := e.Recalibrate(); err != nil {
+				logger.Warn("Periodic confidence calibration skipped", zap.Error(err))
+			}
+		}
+	}()
+}
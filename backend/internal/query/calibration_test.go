@@ -0,0 +1,90 @@
+package query
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+)
+
+func TestFitLogisticRecoversSyntheticModel(t *testing.T) {
+	trueBias, trueWeights := -2.0, []float64{3.0, -1.5}
+
+	rng := rand.New(rand.NewSource(1))
+	var x [][]float64
+	var y []float64
+	for i := 0; i < 4000; i++ {
+		features := []float64{rng.Float64(), rng.Float64()}
+		p := sigmoid(trueBias + trueWeights[0]*features[0] + trueWeights[1]*features[1])
+		label := 0.0
+		if rng.Float64() < p {
+			label = 1
+		}
+		x = append(x, features)
+		y = append(y, label)
+	}
+
+	bias, weights, logLoss := fitLogistic(x, y, calibrationIterations, calibrationLearningRate, 0)
+
+	if math.Abs(bias-trueBias) > 0.4 {
+		t.Errorf("bias = %.3f, want about %.1f", bias, trueBias)
+	}
+	for i := range trueWeights {
+		if math.Abs(weights[i]-trueWeights[i]) > 0.4 {
+			t.Errorf("weights[%d] = %.3f, want about %.1f", i, weights[i], trueWeights[i])
+		}
+	}
+
+	// A constant prediction at the base rate is the loss to beat.
+	var positives float64
+	for _, label := range y {
+		positives += label
+	}
+	rate := positives / float64(len(y))
+	baseline := -(rate*math.Log(rate) + (1-rate)*math.Log(1-rate))
+	if logLoss >= baseline {
+		t.Errorf("log loss = %.3f, want below the base-rate loss %.3f", logLoss, baseline)
+	}
+}
+
+func TestFitLogisticSeparableData(t *testing.T) {
+	x := [][]float64{{0.1}, {0.2}, {0.3}, {0.7}, {0.8}, {0.9}}
+	y := []float64{0, 0, 0, 1, 1, 1}
+
+	bias, weights, _ := fitLogistic(x, y, calibrationIterations, calibrationLearningRate, calibrationL2)
+	calibration := &models.ConfidenceCalibration{Bias: bias, Weights: weights}
+
+	for i, features := range x {
+		p := predictConfidence(calibration, features)
+		if math.IsNaN(p) || p <= 0 || p >= 1 {
+			t.Fatalf("prediction for %v = %f, want within (0, 1)", features, p)
+		}
+		if (p > 0.5) != (y[i] == 1) {
+			t.Errorf("prediction for %v = %.3f, want on the side of label %.0f", features, p, y[i])
+		}
+	}
+
+	// The L2 penalty keeps the weights finite even though the classes separate.
+	if math.Abs(weights[0]) > 50 {
+		t.Errorf("weight = %.1f, want regularised", weights[0])
+	}
+}
+
+func TestFitLogisticNoSamples(t *testing.T) {
+	bias, weights, logLoss := fitLogistic(nil, nil, calibrationIterations, calibrationLearningRate, calibrationL2)
+	if bias != 0 || weights != nil || logLoss != 0 {
+		t.Errorf("fitLogistic(nil) = %v, %v, %v; want zero values", bias, weights, logLoss)
+	}
+}
+
+func TestFeaturesSaturateCounts(t *testing.T) {
+	got := confidenceSignals{KGCount: 25, VectorCount: 5, AvgKG: 0.8, AvgVector: 0.6, HasLink: true}.features()
+	want := []float64{1, 0.5, 0.8, 0.6, 1}
+
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("features()[%d] = %f, want %f", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var citationPattern = regexp.MustCompile(`(?i)\[source[_ ]?(\d+)\]`)
+
+type Citation struct {
+	Marker      string
+	SourceIndex int
+	URL         string
+	ChunkID     string
+	Confidence  float64
+	Dangling    bool
+}
+
+// extractCitations maps the [source_N] markers in the response to the Nth
+// documentation block of the prompt, which is the Nth vector entry in
+// sources. Each marker is reported once, in order of first appearance;
+// markers pointing past the documentation given to the model are flagged as
+// dangling with a SourceIndex of -1.
+func extractCitations(response string, sources []Source) []Citation {
+	var vectorSources []int
+	for i, source := range sources {
+		if source.Type == "vector" {
+			vectorSources = append(vectorSources, i)
+		}
+	}
+
+	citations := make([]Citation, 0)
+	seen := make(map[int]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(response, -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil || seen[n] {
+			continue
+		}
+		seen[n] = true
+
+		citation := Citation{Marker: fmt.Sprintf("[source_%d]", n), SourceIndex: -1}
+		if n >= 1 && n <= len(vectorSources) {
+			idx := vectorSources[n-1]
+			citation.SourceIndex = idx
+			citation.URL = sources[idx].URL
+			citation.ChunkID = sources[idx].ChunkID
+			citation.Confidence = sources[idx].Confidence
+		} else {
+			citation.Dangling = true
+		}
+
+		citations = append(citations, citation)
+	}
+
+	return citations
+}
+
+func countDangling(citations []Citation) int {
+	count := 0
+	for _, citation := range citations {
+		if citation.Dangling {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,36 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractCitations(t *testing.T) {
+	sources := []Source{
+		{Type: "kg", URL: "https://docs.aws.amazon.com/kg"},
+		{Type: "vector", URL: "https://docs.aws.amazon.com/lambda/timeouts", ChunkID: "c1", Confidence: 0.9},
+		{Type: "vector", URL: "https://docs.aws.amazon.com/lambda/limits", ChunkID: "c2", Confidence: 0.7},
+		{Type: "web", URL: "https://repost.aws/q"},
+	}
+
+	response := "Raise the timeout [source_1]. The maximum is 900 seconds [Source 2], " +
+		"see also [source_1] and [source_7]; [source_0] is not a block."
+
+	got := extractCitations(response, sources)
+	want := []Citation{
+		{Marker: "[source_1]", SourceIndex: 1, URL: "https://docs.aws.amazon.com/lambda/timeouts", ChunkID: "c1", Confidence: 0.9},
+		{Marker: "[source_2]", SourceIndex: 2, URL: "https://docs.aws.amazon.com/lambda/limits", ChunkID: "c2", Confidence: 0.7},
+		{Marker: "[source_7]", SourceIndex: -1, Dangling: true},
+		{Marker: "[source_0]", SourceIndex: -1, Dangling: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extractCitations() =\n%+v\nwant\n%+v", got, want)
+	}
+	if n := countDangling(got); n != 2 {
+		t.Errorf("countDangling() = %d, want 2", n)
+	}
+
+	if got := extractCitations("No markers here.", sources); got == nil || len(got) != 0 {
+		t.Errorf("extractCitations() = %#v, want an empty, non-nil list", got)
+	}
+}
@@ -0,0 +1,100 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/cache/redis"
+	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/tokenizer"
+)
+
+// conversationResponseMaxTokens caps how much of each earlier answer is kept;
+// the gist is enough to resolve references in a follow-up.
+const (
+	conversationResponseMaxTokens = 150
+	maxConversationIDLength       = 128
+)
+
+var ErrInvalidConversationID = errors.New("invalid conversation_id")
+
+func ValidateConversationID(id string) error {
+	if len(id) > maxConversationIDLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidConversationID, maxConversationIDLength)
+	}
+	if strings.ContainsAny(id, " \t\r\n") {
+		return fmt.Errorf("%w: must not contain whitespace", ErrInvalidConversationID)
+	}
+	return nil
+}
+
+func (e *Engine) conversationTurns(ctx context.Context, req QueryRequest) []redis.ConversationTurn {
+	if e.cache == nil || req.ConversationID == "" {
+		return nil
+	}
+
+	turns, err := e.cache.GetConversationTurns(ctx, req.UserID, req.ConversationID)
+	if err != nil {
+		logger.Warn("Failed to load conversation history",
+			zap.String("conversation_id", req.ConversationID),
+			zap.Error(err),
+		)
+		return nil
+	}
+	return turns
+}
+
+func (e *Engine) appendConversationTurn(ctx context.Context, req QueryRequest, response string) {
+	if e.cache == nil || req.ConversationID == "" {
+		return
+	}
+
+	turn := redis.ConversationTurn{
+		Query:    req.Query,
+		Response: tokenizer.Truncate(response, conversationResponseMaxTokens),
+	}
+	if err := e.cache.AppendConversationTurn(ctx, req.UserID, req.ConversationID, turn, e.cfg.ConversationMaxTurns, e.cfg.ConversationTTL); err != nil {
+		logger.Warn("Failed to store conversation turn",
+			zap.String("conversation_id", req.ConversationID),
+			zap.Error(err),
+		)
+	}
+}
+
+// condenseHistory renders the most recent turns that fit in maxTokens,
+// oldest first. A turn that does not fit ends the history rather than being
+// skipped, so the model never sees a conversation with gaps.
+func condenseHistory(turns []redis.ConversationTurn, maxTokens int) string {
+	var blocks []string
+	used := 0
+	for i := len(turns) - 1; i >= 0; i-- {
+		block := fmt.Sprintf("User: %s\nAssistant: %s", turns[i].Query, turns[i].Response)
+		cost := tokenizer.Count(block)
+		if used+cost > maxTokens {
+			break
+		}
+		used += cost
+		blocks = append(blocks, block)
+	}
+
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// inheritedEntities returns the entities of the latest earlier query that
+// named an AWS service, so a follow-up such as "how do I fix that?" is
+// retrieved in the context of the service under discussion.
+func inheritedEntities(turns []redis.ConversationTurn, extract func(string) []string) []string {
+	for i := len(turns) - 1; i >= 0; i-- {
+		if entities := extract(turns[i].Query); hasAWSService(entities) {
+			return entities
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package query
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws-agent/backend/internal/cache/redis"
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+)
+
+// lastResponsePrompt returns the user prompt of the latest answer generation.
+func lastResponsePrompt(t *testing.T, provider *llmtest.Provider) string {
+	t.Helper()
+
+	requests := provider.Requests()
+	for i := len(requests) - 1; i >= 0; i-- {
+		if requests[i].MaxTokens == llm.ResponseMaxTokens {
+			return requests[i].UserPrompt
+		}
+	}
+	t.Fatal("no response was generated")
+	return ""
+}
+
+func TestFollowUpPromptIncludesConversation(t *testing.T) {
+	const firstAnswer = "Raise the Lambda function timeout to 30 seconds."
+
+	db := newTestDB(t)
+	provider := &llmtest.Provider{Reply: func(req llm.CompletionRequest) (string, error) {
+		if req.MaxTokens == llm.ResponseMaxTokens {
+			return firstAnswer, nil
+		}
+		return "ok", nil
+	}}
+	cache, _ := redistest.NewClient(t)
+	kg := &fakeKG{}
+	engine := NewEngine(db, kg, &fakeVector{}, llmtest.NewClient(provider), cache, Config{})
+	ctx := context.Background()
+
+	if _, err := engine.ProcessQuery(ctx, QueryRequest{Query: "Why does my Lambda function time out?", UserID: "u1", ConversationID: "c1"}); err != nil {
+		t.Fatalf("first query: %v", err)
+	}
+	if strings.Contains(lastResponsePrompt(t, provider), "User:") {
+		t.Error("the first turn's prompt carries conversation history")
+	}
+
+	if _, err := engine.ProcessQuery(ctx, QueryRequest{Query: "How do I fix that?", UserID: "u1", ConversationID: "c1"}); err != nil {
+		t.Fatalf("follow-up: %v", err)
+	}
+	prompt := lastResponsePrompt(t, provider)
+	if !strings.Contains(prompt, "User: Why does my Lambda function time out?") || !strings.Contains(prompt, "Assistant: "+firstAnswer) {
+		t.Errorf("follow-up prompt = %q, want the earlier turn", prompt)
+	}
+	if !strings.Contains(strings.Join(kg.Entities(), " "), "Lambda") {
+		t.Errorf("follow-up entities = %v, want Lambda inherited from the earlier turn", kg.Entities())
+	}
+
+	// Another conversation, or another user's conversation with the same ID,
+	// starts afresh.
+	for _, req := range []QueryRequest{
+		{Query: "How do I fix that?", UserID: "u1", ConversationID: "c2"},
+		{Query: "How do I fix that?", UserID: "u2", ConversationID: "c1"},
+	} {
+		if _, err := engine.ProcessQuery(ctx, req); err != nil {
+			t.Fatalf("query %+v: %v", req, err)
+		}
+		if prompt := lastResponsePrompt(t, provider); strings.Contains(prompt, "Lambda") {
+			t.Errorf("prompt for %s/%s = %q, want no history from c1", req.UserID, req.ConversationID, prompt)
+		}
+	}
+
+	records, err := db.GetQueryHistory("u1", 10)
+	if err != nil {
+		t.Fatalf("get history: %v", err)
+	}
+	for _, record := range records {
+		if record.ConversationID == "" {
+			t.Errorf("record %s has no conversation_id", record.ID)
+		}
+	}
+}
+
+func TestCondenseHistoryKeepsLatestTurnsWithinBudget(t *testing.T) {
+	turns := []redis.ConversationTurn{
+		{Query: "first question about Lambda", Response: strings.Repeat("long answer ", 50)},
+		{Query: "second question", Response: "short answer"},
+		{Query: "third question", Response: "short answer"},
+	}
+
+	got := condenseHistory(turns, 30)
+	if strings.Contains(got, "first question") {
+		t.Errorf("history = %q, want the oldest turn dropped to fit the budget", got)
+	}
+	if !strings.Contains(got, "second question") || strings.Index(got, "second") > strings.Index(got, "third") {
+		t.Errorf("history = %q, want the two latest turns, oldest first", got)
+	}
+
+	// A turn that does not fit ends the history even if older ones would.
+	turns[1].Response = strings.Repeat("long answer ", 50)
+	if got := condenseHistory(turns, 30); strings.Contains(got, "first") || strings.Contains(got, "second") {
+		t.Errorf("history = %q, want only the latest turn without gaps", got)
+	}
+
+	if got := condenseHistory(nil, 30); got != "" {
+		t.Errorf("empty conversation history = %q", got)
+	}
+}
+
+func TestValidateConversationID(t *testing.T) {
+	if err := ValidateConversationID("3f2a-11ee"); err != nil {
+		t.Errorf("valid ID rejected: %v", err)
+	}
+	for _, id := range []string{"has space", strings.Repeat("x", maxConversationIDLength+1)} {
+		if err := ValidateConversationID(id); err == nil {
+			t.Errorf("ValidateConversationID(%q) accepted", id)
+		}
+	}
+}
+
+func TestCachedFirstTurnStartsConversation(t *testing.T) {
+	const answer = "Raise the Lambda function timeout to 30 seconds."
+
+	provider := &llmtest.Provider{Reply: func(req llm.CompletionRequest) (string, error) {
+		if req.MaxTokens == llm.ResponseMaxTokens {
+			return answer, nil
+		}
+		return "ok", nil
+	}}
+	cache, _ := redistest.NewClient(t)
+	engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{}, llmtest.NewClient(provider), cache, Config{})
+	ctx := context.Background()
+
+	// Another user's identical question puts the answer in the cache.
+	if _, err := engine.ProcessQuery(ctx, QueryRequest{Query: "Why does my Lambda function time out?", UserID: "u2"}); err != nil {
+		t.Fatalf("warm cache: %v", err)
+	}
+	if _, err := engine.ProcessQuery(ctx, QueryRequest{Query: "Why does my Lambda function time out?", UserID: "u1", ConversationID: "c1"}); err != nil {
+		t.Fatalf("first turn: %v", err)
+	}
+	if got := responseCount(provider); got != 1 {
+		t.Fatalf("responses generated = %d, want the first turn served from cache", got)
+	}
+
+	if _, err := engine.ProcessQuery(ctx, QueryRequest{Query: "How do I fix that?", UserID: "u1", ConversationID: "c1"}); err != nil {
+		t.Fatalf("follow-up: %v", err)
+	}
+	prompt := lastResponsePrompt(t, provider)
+	if !strings.Contains(prompt, "User: Why does my Lambda function time out?") || !strings.Contains(prompt, "Assistant: "+answer) {
+		t.Errorf("follow-up prompt = %q, want the cached first turn", prompt)
+	}
+}
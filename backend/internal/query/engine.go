@@ -3,39 +3,129 @@ package query
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"github.com/aws-agent/backend/internal/cache/redis"
 	"github.com/aws-agent/backend/internal/kg/neo4j"
 	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/metrics"
+	"github.com/aws-agent/backend/internal/search/web"
 	"github.com/aws-agent/backend/internal/storage/models"
 	"github.com/aws-agent/backend/internal/storage/sqlite"
 	"github.com/aws-agent/backend/internal/vector/zilliz"
 	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/tokenizer"
+	"github.com/aws-agent/backend/pkg/utils"
 )
 
+const (
+	UnknownServiceUnfiltered = "unfiltered"
+	UnknownServiceClassify   = "classify"
+	UnknownServiceClarify    = "clarify"
+)
+
+// KGSearcher and VectorSearcher are the retrieval calls the engine makes on
+// Neo4j and Zilliz, so queries can run against in-memory fakes in tests.
+type KGSearcher interface {
+	SearchByEntities(ctx context.Context, entities []string, minConfidence float64) ([]neo4j.Triple, error)
+}
+
+type VectorSearcher interface {
+	Search(ctx context.Context, queryEmbedding []float32, topK int, filters map[string]string) ([]zilliz.SearchResult, error)
+}
+
 type Engine struct {
 	db        *sqlite.Client
-	kgClient  *neo4j.Client
-	vectorDB  *zilliz.Client
+	kgClient  KGSearcher
+	vectorDB  VectorSearcher
 	llmClient *llm.Client
+	cache     *redis.Client
+	webSearch *web.Client
+	cfg       Config
+
+	calibration atomic.Pointer[models.ConfidenceCalibration]
+}
+
+type Config struct {
+	UnknownServiceStrategy  string
+	QueryCacheTTL           time.Duration
+	HistoryResponseMaxChars int
+	FusionK                 float64
+	MaxContextResults       int
+	VectorTopK              int
+	FollowUpsEnabled        bool
+	FollowUpMinConfidence   float64
+	MaxFollowUps            int
+	ContextChunkMaxTokens   int
+	MaxPromptTokens         int
+	ContextWindowTokens     int
+	PromptHeadroomTokens    int
+	WebSearchEnabled        bool
+	WebSearchMaxResults     int
+	LLMEntityExtraction     bool
+	EntityExtractionTimeout time.Duration
+	EntityCacheTTL          time.Duration
+	MaxKnownEntities        int
+	MaxLLMCalls             int
+	CalibrationMinSamples   int
+	CalibrationMaxSamples   int
+	RerankEnabled           bool
+	RerankTimeout           time.Duration
+	RerankMaxCandidates     int
+	DisclaimerEnabled       bool
+	DisclaimerPosition      string
+	DestructiveDisclaimer   string
+	HybridSearchEnabled     bool
+	KeywordSearchLimit      int
+	FusionWeights           map[string]FusionWeights
+	ConversationTTL         time.Duration
+	ConversationMaxTurns    int
+	ConversationMaxTokens   int
+	SemanticCacheEnabled    bool
+	// SemanticCacheThreshold is the cosine similarity between query
+	// embeddings at which a cached answer is reused for a new query.
+	SemanticCacheThreshold float64
+	// SemanticCacheMaxEntries bounds the index of answered queries, and so
+	// the embeddings scanned on every semantic cache miss.
+	SemanticCacheMaxEntries int
 }
 
 type QueryRequest struct {
-	Query  string
-	UserID string
+	ID          string
+	Query       string
+	UserID      string
+	SkipHistory bool
+	WebSearch   *bool
+	// ConversationID links follow-up queries so earlier turns inform the
+	// answer. Empty queries are answered in isolation.
+	ConversationID string
+	// BypassCache generates a fresh answer, neither served from nor written
+	// to the query caches, for callers such as evaluation that must score
+	// the current pipeline.
+	BypassCache bool
 }
 
 type QueryResponse struct {
-	ID         string
-	Query      string
-	Response   string
-	Sources    []Source
-	Confidence float64
-	LatencyMS  int
+	ID                 string
+	Query              string
+	Response           string
+	Sources            []Source
+	Confidence         float64
+	LatencyMS          int
+	TokensUsed         int
+	NeedsClarification bool
+	FollowUps          []string
+	WebSearchUsed      bool
+	Risk               string
+	RiskOperations     []string
+	Citations          []Citation
 }
 
 type Source struct {
@@ -43,92 +133,461 @@ type Source struct {
 	URL        string
 	ChunkID    string
 	Confidence float64
+	FusedScore float64
+}
+
+type fusedResult struct {
+	Triple *neo4j.Triple
+	Vector *zilliz.SearchResult
+	Score  float64
 }
 
-func NewEngine(db *sqlite.Client, kgClient *neo4j.Client, vectorDB *zilliz.Client, llmClient *llm.Client) *Engine {
+func NewEngine(db *sqlite.Client, kgClient KGSearcher, vectorDB VectorSearcher, llmClient *llm.Client, cache *redis.Client, cfg Config) *Engine {
+	if cfg.UnknownServiceStrategy == "" {
+		cfg.UnknownServiceStrategy = UnknownServiceUnfiltered
+	}
+	if cfg.QueryCacheTTL == 0 {
+		cfg.QueryCacheTTL = time.Hour
+	}
+	if cfg.FusionK <= 0 {
+		cfg.FusionK = 60
+	}
+	if cfg.MaxContextResults <= 0 {
+		cfg.MaxContextResults = 10
+	}
+	if cfg.VectorTopK <= 0 {
+		cfg.VectorTopK = 10
+	}
+	if cfg.MaxFollowUps <= 0 {
+		cfg.MaxFollowUps = 3
+	}
+	if cfg.ContextChunkMaxTokens <= 0 {
+		cfg.ContextChunkMaxTokens = 300
+	}
+	if cfg.MaxPromptTokens <= 0 {
+		cfg.MaxPromptTokens = 6000
+	}
+	if cfg.PromptHeadroomTokens < 0 {
+		cfg.PromptHeadroomTokens = 0
+	}
+	if cfg.WebSearchMaxResults <= 0 {
+		cfg.WebSearchMaxResults = 5
+	}
+	if cfg.EntityExtractionTimeout <= 0 {
+		cfg.EntityExtractionTimeout = 3 * time.Second
+	}
+	if cfg.EntityCacheTTL <= 0 {
+		cfg.EntityCacheTTL = 24 * time.Hour
+	}
+	if cfg.MaxLLMCalls <= 0 {
+		cfg.MaxLLMCalls = 6
+	}
+	if cfg.CalibrationMinSamples <= 0 {
+		cfg.CalibrationMinSamples = 50
+	}
+	if cfg.CalibrationMaxSamples <= 0 {
+		cfg.CalibrationMaxSamples = 5000
+	}
+	if cfg.MaxKnownEntities <= 0 {
+		cfg.MaxKnownEntities = 200
+	}
+	if cfg.KeywordSearchLimit <= 0 {
+		cfg.KeywordSearchLimit = 10
+	}
+	if cfg.RerankTimeout <= 0 {
+		cfg.RerankTimeout = 5 * time.Second
+	}
+	if cfg.RerankMaxCandidates <= 0 {
+		cfg.RerankMaxCandidates = 10
+	}
+	if cfg.DisclaimerPosition == "" {
+		cfg.DisclaimerPosition = DisclaimerAppend
+	}
+	if cfg.DestructiveDisclaimer == "" {
+		cfg.DestructiveDisclaimer = defaultDestructiveDisclaimer
+	}
+	if cfg.ConversationTTL <= 0 {
+		cfg.ConversationTTL = 30 * time.Minute
+	}
+	if cfg.ConversationMaxTurns <= 0 {
+		cfg.ConversationMaxTurns = 6
+	}
+	if cfg.ConversationMaxTokens <= 0 {
+		cfg.ConversationMaxTokens = 800
+	}
+	if cfg.SemanticCacheThreshold <= 0 || cfg.SemanticCacheThreshold > 1 {
+		cfg.SemanticCacheThreshold = 0.95
+	}
+	if cfg.SemanticCacheMaxEntries <= 0 {
+		cfg.SemanticCacheMaxEntries = 200
+	}
+
 	return &Engine{
 		db:        db,
 		kgClient:  kgClient,
 		vectorDB:  vectorDB,
 		llmClient: llmClient,
+		cache:     cache,
+		cfg:       cfg,
 	}
 }
 
+func (e *Engine) WithWebSearch(client *web.Client) *Engine {
+	e.webSearch = client
+	return e
+}
+
 func (e *Engine) ProcessQuery(ctx context.Context, req QueryRequest) (*QueryResponse, error) {
+	return e.processQuery(ctx, req, nil)
+}
+
+func (e *Engine) ProcessQueryStream(ctx context.Context, req QueryRequest, onDelta llm.StreamFunc) (*QueryResponse, error) {
+	return e.processQuery(ctx, req, onDelta)
+}
+
+func (e *Engine) processQuery(ctx context.Context, req QueryRequest, onDelta llm.StreamFunc) (*QueryResponse, error) {
 	startTime := time.Now()
-	queryID := uuid.New().String()
+	queryID := req.ID
+	if queryID == "" {
+		queryID = uuid.New().String()
+	}
 
-	logger.Info("Processing query",
+	logger.FromContext(ctx).Info("Processing query",
 		zap.String("query_id", queryID),
 		zap.String("query", req.Query),
 	)
 
-	entities := e.extractEntitiesFromQuery(req.Query)
-	logger.Debug("Extracted entities from query", zap.Strings("entities", entities))
+	// The answer itself is always generated, so it is reserved out of the budget.
+	ctx = llm.WithCallBudget(ctx, e.cfg.MaxLLMCalls-1)
+	// Every LLM call made for the query counts towards the caller's usage.
+	ctx = llm.WithTokenMeter(ctx)
+
+	webAllowed := e.webSearchAllowed(req)
+	cacheKey := queryCacheKey(req.Query, webAllowed)
+
+	// Answers that depend on earlier turns, or that asked to bypass the
+	// cache, are neither served from nor written to the query cache.
+	turns := e.conversationTurns(ctx, req)
+	history := condenseHistory(turns, e.cfg.ConversationMaxTokens)
+	cacheable := history == "" && !req.BypassCache
+
+	var cached *QueryResponse
+	var hit bool
+	var embedding []float32
+	if cacheable {
+		cached, hit = e.getCachedResponse(ctx, cacheKey)
+		if !hit {
+			embedding = e.queryEmbedding(ctx, req.Query)
+			cached, hit = e.getSemanticCachedResponse(ctx, embedding, webAllowed)
+		}
+	}
+	if hit {
+		// The cached answer may have been generated for another user; it is
+		// served under this query's own ID and recorded in its history.
+		cached.ID = queryID
+		cached.Query = req.Query
+		cached.LatencyMS = int(time.Since(startTime).Milliseconds())
+		cached.TokensUsed = 0
+		logger.FromContext(ctx).Info("Query served from cache", zap.String("query_id", queryID))
+		if req.SkipHistory {
+			logger.FromContext(ctx).Debug("Skipping query history", zap.String("query_id", queryID))
+		} else {
+			e.recordQuery(queryID, req, cached.Response, cached.Confidence, cached.Sources, sourceSignals(cached.Sources, cached.Response), cached.WebSearchUsed, webAllowed, cached.LatencyMS)
+		}
+		e.appendConversationTurn(ctx, req, cached.Response)
+		observeQuery("cached", "success", startTime)
+		if onDelta != nil {
+			if err := onDelta(cached.Response); err != nil {
+				return nil, fmt.Errorf("failed to stream cached response: %w", err)
+			}
+		}
+		return cached, nil
+	}
+
+	entities := e.extractEntities(ctx, req.Query)
+	if !hasAWSService(entities) {
+		entities = append(entities, inheritedEntities(turns, e.extractEntitiesFromQuery)...)
+	}
+	logger.FromContext(ctx).Debug("Extracted entities from query", zap.Strings("entities", entities))
+
+	if !hasAWSService(entities) {
+		switch e.cfg.UnknownServiceStrategy {
+		case UnknownServiceClassify:
+			if !llm.AcquireCall(ctx, "classify_service") {
+				break
+			}
+			service, err := e.llmClient.ClassifyService(ctx, req.Query, awsServices)
+			if err != nil {
+				logger.FromContext(ctx).Warn("Service classification failed", zap.Error(err))
+			} else if service != "" {
+				entities = append(entities, service)
+			}
+		case UnknownServiceClarify:
+			observeQuery("clarification", "success", startTime)
+			clarification := e.clarificationResponse(queryID, req, startTime)
+			if onDelta != nil {
+				if err := onDelta(clarification.Response); err != nil {
+					return nil, fmt.Errorf("failed to stream clarification: %w", err)
+				}
+			}
+			return clarification, nil
+		}
+	}
 
 	kgResults, err := e.retrieveFromKG(ctx, entities)
 	if err != nil {
-		logger.Warn("KG retrieval failed", zap.Error(err))
+		logger.FromContext(ctx).Warn("KG retrieval failed", zap.Error(err))
 	}
 
 	vectorResults, err := e.retrieveFromVector(ctx, req.Query, entities)
 	if err != nil {
-		logger.Warn("Vector retrieval failed", zap.Error(err))
+		logger.FromContext(ctx).Warn("Vector retrieval failed", zap.Error(err))
 	}
 
-	fusedResults := e.fuseResults(kgResults, vectorResults)
-	logger.Info("Results fused",
+	vectorResults = e.rerankVectorResults(ctx, req.Query, vectorResults)
+
+	metrics.KGResultsCount.Observe(float64(len(kgResults)))
+	metrics.VectorResultsCount.Observe(float64(len(vectorResults)))
+
+	intent := classifyIntent(req.Query)
+	weights := e.fusionWeights(intent)
+	fusedResults := fuseResults(kgResults, vectorResults, e.cfg.FusionK, weights)
+	if len(fusedResults) > e.cfg.MaxContextResults {
+		fusedResults = fusedResults[:e.cfg.MaxContextResults]
+	}
+	logger.FromContext(ctx).Info("Results fused",
+		zap.String("intent", intent),
+		zap.Float64("kg_weight", weights.KG),
+		zap.Float64("vector_weight", weights.Vector),
 		zap.Int("kg_results", len(kgResults)),
 		zap.Int("vector_results", len(vectorResults)),
 		zap.Int("fused_results", len(fusedResults)),
 	)
 
-	kgContext := e.formatKGContext(kgResults)
-	vectorContext := e.formatVectorContext(vectorResults)
+	var webResults []web.SearchResult
+	if webAllowed && e.webSearch.ShouldTriggerWebSearch(len(kgResults), len(vectorResults), e.calculateConfidence(kgResults, vectorResults, "")) {
+		metrics.WebSearchTriggered.Inc()
+		webResults, err = e.webSearch.Search(ctx, req.Query, e.cfg.WebSearchMaxResults)
+		if err != nil {
+			logger.FromContext(ctx).Warn("Web search failed", zap.Error(err))
+		}
+	}
 
-	response, err := e.llmClient.GenerateResponse(ctx, req.Query, kgContext, vectorContext)
+	assembled := e.assembleContext(req.Query, history, fusedResults, webResults)
+	kgContext, vectorContext := assembled.KGContext, assembled.VectorContext
+	fusedResults, webResults = assembled.Fused, assembled.Web
+	webUsed := len(webResults) > 0
+
+	generation, err := e.llmClient.GenerateResponseStream(ctx, req.Query, history, kgContext, vectorContext, onDelta)
 	if err != nil {
+		observeQuery("rag", "error", startTime)
 		return nil, fmt.Errorf("failed to generate response: %w", err)
 	}
+	response := generation.Content
 
 	confidence := e.calculateConfidence(kgResults, vectorResults, response)
+	metrics.ConfidenceScore.WithLabelValues().Observe(confidence)
+
+	var followUps []string
+	if e.cfg.FollowUpsEnabled && confidence >= e.cfg.FollowUpMinConfidence && llm.AcquireCall(ctx, "follow_ups") {
+		questions, _, err := e.llmClient.GenerateFollowUps(ctx, req.Query, response, kgContext+vectorContext, e.cfg.MaxFollowUps)
+		if err != nil {
+			logger.FromContext(ctx).Warn("Failed to generate follow-up questions", zap.Error(err))
+		} else {
+			followUps = questions
+		}
+	}
 
-	sources := make([]Source, 0)
-	for _, result := range kgResults {
-		for _, url := range result.SourceURLs {
-			sources = append(sources, Source{
-				Type:       "kg",
-				URL:        url,
-				Confidence: result.Confidence,
-			})
+	guarded, risk, riskOperations := e.applyDisclaimer(response, onDelta != nil)
+	if risk != "" {
+		logger.FromContext(ctx).Info("Destructive guidance detected in answer",
+			zap.String("query_id", queryID),
+			zap.Strings("operations", riskOperations),
+		)
+	}
+	if onDelta != nil && len(guarded) > len(response) {
+		if err := onDelta(guarded[len(response):]); err != nil {
+			return nil, fmt.Errorf("failed to stream disclaimer: %w", err)
 		}
 	}
-	for _, result := range vectorResults {
+	response = guarded
+
+	sources := make([]Source, 0)
+	for _, result := range fusedResults {
+		if result.Triple != nil {
+			for _, url := range result.Triple.SourceURLs {
+				sources = append(sources, Source{
+					Type:       "kg",
+					URL:        url,
+					Confidence: result.Triple.Confidence,
+					FusedScore: result.Score,
+				})
+			}
+			continue
+		}
+
 		sources = append(sources, Source{
 			Type:       "vector",
-			URL:        result.DocURL,
-			ChunkID:    result.ChunkID,
-			Confidence: float64(result.Score),
+			URL:        result.Vector.DocURL,
+			ChunkID:    result.Vector.ChunkID,
+			Confidence: float64(result.Vector.Score),
+			FusedScore: result.Score,
+		})
+	}
+
+	for _, result := range webResults {
+		sources = append(sources, Source{
+			Type: "web",
+			URL:  result.URL,
 		})
 	}
 
+	citations := extractCitations(response, sources)
+	if dangling := countDangling(citations); dangling > 0 {
+		logger.FromContext(ctx).Warn("Response cites sources that were not provided",
+			zap.String("query_id", queryID),
+			zap.Int("dangling", dangling),
+		)
+	}
+
 	latency := int(time.Since(startTime).Milliseconds())
 
+	if req.SkipHistory {
+		logger.FromContext(ctx).Debug("Skipping query history", zap.String("query_id", queryID))
+	} else {
+		e.recordQuery(queryID, req, response, confidence, sources, newConfidenceSignals(kgResults, vectorResults, response), webUsed, webAllowed, latency)
+	}
+
+	logger.FromContext(ctx).Info("Query processed successfully",
+		zap.String("query_id", queryID),
+		zap.Float64("confidence", confidence),
+		zap.Int("optional_llm_calls", llm.CallsUsed(ctx)),
+		zap.Int("latency_ms", latency),
+	)
+
+	result := &QueryResponse{
+		ID:             queryID,
+		Query:          req.Query,
+		Response:       response,
+		Sources:        sources,
+		Confidence:     confidence,
+		LatencyMS:      latency,
+		TokensUsed:     llm.TokensUsed(ctx),
+		FollowUps:      followUps,
+		WebSearchUsed:  webUsed,
+		Risk:           risk,
+		RiskOperations: riskOperations,
+		Citations:      citations,
+	}
+
+	if cacheable {
+		e.setCachedResponse(ctx, cacheKey, result)
+		e.setSemanticCachedQuery(ctx, cacheKey, embedding, webAllowed)
+	}
+	e.appendConversationTurn(ctx, req, response)
+
+	observeQuery("rag", "success", startTime)
+
+	return result, nil
+}
+
+func truncateResponse(response string, maxChars int) string {
+	if maxChars <= 0 {
+		return response
+	}
+
+	truncated := utils.TruncateRunes(response, maxChars)
+	if truncated == response {
+		return response
+	}
+
+	return truncated + "..."
+}
+
+func observeQuery(queryType, status string, startTime time.Time) {
+	metrics.QueryDuration.WithLabelValues(queryType).Observe(time.Since(startTime).Seconds())
+	metrics.QueryTotal.WithLabelValues(status).Inc()
+}
+
+func (e *Engine) getCachedResponse(ctx context.Context, key string) (*QueryResponse, bool) {
+	if e.cache == nil {
+		return nil, false
+	}
+
+	var cached QueryResponse
+	found, err := e.cache.GetQuery(ctx, key, &cached)
+	if err != nil {
+		logger.FromContext(ctx).Warn("Query cache lookup failed", zap.Error(err))
+	}
+	if err != nil || !found {
+		metrics.CacheMisses.WithLabelValues("query").Inc()
+		return nil, false
+	}
+
+	metrics.CacheHits.WithLabelValues("query").Inc()
+	return &cached, true
+}
+
+func (e *Engine) setCachedResponse(ctx context.Context, key string, response *QueryResponse) {
+	if e.cache == nil {
+		return
+	}
+
+	if err := e.cache.SetQuery(ctx, key, response, e.cfg.QueryCacheTTL); err != nil {
+		logger.FromContext(ctx).Warn("Failed to cache query response", zap.Error(err))
+	}
+}
+
+// queryCacheKey keys the query cache, which is global: answers are built
+// from the shared corpus and never from per-user data, so users asking the
+// same question share one entry. The key covers everything the answer
+// depends on, which is the normalized query text and whether web results
+// were allowed. Conversation follow-ups, whose answers also depend on
+// earlier turns, bypass the cache instead.
+func queryCacheKey(query string, webAllowed bool) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	if webAllowed {
+		normalized += "|web"
+	}
+	return utils.HashString(normalized)
+}
+
+// webSearchAllowed reports whether the query may use web search. Web search
+// is opt-in: WebSearchEnabled only permits it, and a query uses it when it
+// asks to with WebSearch.
+func (e *Engine) webSearchAllowed(req QueryRequest) bool {
+	if !e.cfg.WebSearchEnabled || e.webSearch == nil {
+		return false
+	}
+	return req.WebSearch != nil && *req.WebSearch
+}
+
+func (e *Engine) recordQuery(queryID string, req QueryRequest, response string, confidence float64, sources []Source, signals confidenceSignals, webUsed, webAllowed bool, latency int) {
 	record := &models.QueryRecord{
 		ID:                 queryID,
 		UserID:             req.UserID,
 		QueryText:          req.Query,
-		Response:           response,
+		Response:           truncateResponse(response, e.cfg.HistoryResponseMaxChars),
 		Confidence:         confidence,
-		KGResultsCount:     len(kgResults),
-		VectorResultsCount: len(vectorResults),
-		WebSearchUsed:      false,
+		KGResultsCount:     signals.KGCount,
+		VectorResultsCount: signals.VectorCount,
+		AvgKGConfidence:    signals.AvgKG,
+		AvgVectorScore:     signals.AvgVector,
+		WebSearchUsed:      webUsed,
+		WebSearchAllowed:   webAllowed,
 		LatencyMS:          latency,
+		ConversationID:     req.ConversationID,
 		CreatedAt:          time.Now(),
 	}
 
 	e.db.InsertQueryRecord(record)
 
+	if record.Response != response {
+		if err := e.db.InsertQueryResponse(queryID, response); err != nil {
+			logger.Warn("Failed to store full query response", zap.String("query_id", queryID), zap.Error(err))
+		}
+	}
+
 	for _, source := range sources {
 		e.db.InsertQuerySource(&models.QuerySource{
 			QueryID:    queryID,
@@ -138,34 +597,162 @@ func (e *Engine) ProcessQuery(ctx context.Context, req QueryRequest) (*QueryResp
 			Confidence: source.Confidence,
 		})
 	}
+}
 
-	logger.Info("Query processed successfully",
-		zap.String("query_id", queryID),
-		zap.Float64("confidence", confidence),
-		zap.Int("latency_ms", latency),
-	)
+func (e *Engine) extractEntities(ctx context.Context, query string) []string {
+	keywordEntities := e.extractEntitiesFromQuery(query)
+	if !e.cfg.LLMEntityExtraction {
+		return keywordEntities
+	}
 
-	return &QueryResponse{
-		ID:         queryID,
-		Query:      req.Query,
-		Response:   response,
-		Sources:    sources,
-		Confidence: confidence,
-		LatencyMS:  latency,
-	}, nil
+	key := queryCacheKey(query, false)
+	if e.cache != nil {
+		cached, found, err := e.cache.GetEntities(ctx, key)
+		if err != nil {
+			logger.FromContext(ctx).Warn("Entity cache lookup failed", zap.Error(err))
+		}
+		if found {
+			metrics.CacheHits.WithLabelValues("entities").Inc()
+			return cached
+		}
+		metrics.CacheMisses.WithLabelValues("entities").Inc()
+	}
+
+	if !llm.AcquireCall(ctx, "entity_extraction") {
+		return keywordEntities
+	}
+
+	known, err := e.db.GetAllKGEntityNames()
+	if err != nil {
+		logger.FromContext(ctx).Warn("Failed to load known entity names", zap.Error(err))
+	}
+
+	extractCtx, cancel := context.WithTimeout(ctx, e.cfg.EntityExtractionTimeout)
+	defer cancel()
+
+	extracted, err := e.llmClient.ExtractQueryEntities(extractCtx, query, relevantKnownEntities(query, known, e.cfg.MaxKnownEntities))
+	if err != nil {
+		logger.FromContext(ctx).Warn("LLM entity extraction failed, using keyword entities", zap.Error(err))
+		return keywordEntities
+	}
+
+	entities := mergeEntities(keywordEntities, knownOnly(extracted, known))
+
+	if e.cache != nil {
+		if err := e.cache.SetEntities(ctx, key, entities, e.cfg.EntityCacheTTL); err != nil {
+			logger.FromContext(ctx).Warn("Failed to cache query entities", zap.Error(err))
+		}
+	}
+
+	return entities
+}
+
+// relevantKnownEntities picks up to limit known entity names to ground
+// extraction, preferring names that appear in the query, then names sharing
+// a word with it, and otherwise keeping the KG's order.
+func relevantKnownEntities(query string, known []string, limit int) []string {
+	lowerQuery := strings.ToLower(query)
+	queryWords := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(lowerQuery, isWordSeparator) {
+		queryWords[word] = true
+	}
+
+	score := func(name string) int {
+		lowerName := strings.ToLower(strings.TrimSpace(name))
+		if lowerName == "" {
+			return 0
+		}
+		if strings.Contains(lowerQuery, lowerName) {
+			return 2
+		}
+		for _, word := range strings.FieldsFunc(lowerName, isWordSeparator) {
+			if queryWords[word] {
+				return 1
+			}
+		}
+		return 0
+	}
+
+	scores := make(map[string]int, len(known))
+	ranked := make([]string, 0, len(known))
+	for _, name := range known {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, seen := scores[key]; seen || key == "" {
+			continue
+		}
+		scores[key] = score(name)
+		ranked = append(ranked, name)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[strings.ToLower(strings.TrimSpace(ranked[i]))] > scores[strings.ToLower(strings.TrimSpace(ranked[j]))]
+	})
+
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// knownOnly keeps the extracted names that name a KG entity, spelled as in
+// the KG, so an entity the model invented never reaches the graph search.
+func knownOnly(extracted, known []string) []string {
+	names := make(map[string]string, len(known))
+	for _, name := range known {
+		names[strings.ToLower(strings.TrimSpace(name))] = name
+	}
+
+	kept := make([]string, 0, len(extracted))
+	for _, name := range extracted {
+		if canonical, ok := names[strings.ToLower(canonicalService(name))]; ok {
+			kept = append(kept, canonical)
+		} else if canonical, ok := names[strings.ToLower(strings.TrimSpace(name))]; ok {
+			kept = append(kept, canonical)
+		}
+	}
+	return kept
+}
+
+func mergeEntities(keywordEntities, extracted []string) []string {
+	seen := make(map[string]bool, len(keywordEntities)+len(extracted))
+	entities := make([]string, 0, len(keywordEntities)+len(extracted))
+
+	for _, entity := range append(keywordEntities, extracted...) {
+		entity = canonicalService(entity)
+		if seen[strings.ToLower(entity)] {
+			continue
+		}
+		seen[strings.ToLower(entity)] = true
+		entities = append(entities, entity)
+	}
+
+	return entities
+}
+
+func canonicalService(entity string) string {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(entity, "Amazon "), "AWS ")
+	for _, service := range awsServices {
+		if strings.EqualFold(trimmed, service) {
+			return service
+		}
+	}
+	return entity
 }
 
 func (e *Engine) extractEntitiesFromQuery(query string) []string {
 	entities := []string{}
 
 	serviceKeywords := map[string]string{
-		"lambda":    "Lambda",
-		"s3":        "S3",
-		"ec2":       "EC2",
-		"rds":       "RDS",
-		"dynamodb":  "DynamoDB",
-		"vpc":       "VPC",
-		"iam":       "IAM",
+		"lambda":     "Lambda",
+		"s3":         "S3",
+		"ec2":        "EC2",
+		"rds":        "RDS",
+		"dynamodb":   "DynamoDB",
+		"vpc":        "VPC",
+		"iam":        "IAM",
 		"cloudwatch": "CloudWatch",
 	}
 
@@ -215,25 +802,66 @@ func (e *Engine) retrieveFromVector(ctx context.Context, query string, entities
 		}
 	}
 
-	results, err := e.vectorDB.Search(ctx, embedding, 10, filters)
+	results, err := e.vectorDB.Search(ctx, embedding, e.cfg.VectorTopK, filters)
 	if err != nil {
 		return nil, err
 	}
 
+	if e.cfg.HybridSearchEnabled {
+		results = e.hybridSearch(query, results, filters["aws_service"], e.cfg.VectorTopK)
+	}
+
 	return results, nil
 }
 
-func (e *Engine) fuseResults(kgResults []neo4j.Triple, vectorResults []zilliz.SearchResult) []interface{} {
-	var fused []interface{}
+func fuseResults(kgResults []neo4j.Triple, vectorResults []zilliz.SearchResult, k float64, weights FusionWeights) []fusedResult {
+	kgRankByURL := make(map[string]int)
+	for rank, triple := range kgResults {
+		for _, url := range triple.SourceURLs {
+			if _, ok := kgRankByURL[url]; !ok {
+				kgRankByURL[url] = rank
+			}
+		}
+	}
+
+	vectorRankByURL := make(map[string]int)
+	for rank, result := range vectorResults {
+		if _, ok := vectorRankByURL[result.DocURL]; !ok {
+			vectorRankByURL[result.DocURL] = rank
+		}
+	}
+
+	fused := make([]fusedResult, 0, len(kgResults)+len(vectorResults))
+
+	for rank := range kgResults {
+		score := weights.KG / (k + float64(rank+1))
 
-	for _, kg := range kgResults {
-		fused = append(fused, kg)
+		bestOther := -1
+		for _, url := range kgResults[rank].SourceURLs {
+			if other, ok := vectorRankByURL[url]; ok && (bestOther < 0 || other < bestOther) {
+				bestOther = other
+			}
+		}
+		if bestOther >= 0 {
+			score += weights.Vector / (k + float64(bestOther+1))
+		}
+
+		fused = append(fused, fusedResult{Triple: &kgResults[rank], Score: score})
 	}
 
-	for _, vec := range vectorResults {
-		fused = append(fused, vec)
+	for rank := range vectorResults {
+		score := weights.Vector / (k + float64(rank+1))
+		if other, ok := kgRankByURL[vectorResults[rank].DocURL]; ok {
+			score += weights.KG / (k + float64(other+1))
+		}
+
+		fused = append(fused, fusedResult{Vector: &vectorResults[rank], Score: score})
 	}
 
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].Score > fused[j].Score
+	})
+
 	return fused
 }
 
@@ -243,21 +871,31 @@ func (e *Engine) formatKGContext(triples []neo4j.Triple) string {
 	}
 
 	var builder strings.Builder
-	builder.WriteString("Structured Knowledge:\n")
+	builder.WriteString(kgContextHeader)
 
-	for i, triple := range triples {
-		if i >= 5 {
-			break
-		}
-		builder.WriteString(fmt.Sprintf("- %s %s %s (confidence: %.2f)\n",
+	for _, triple := range triples {
+		builder.WriteString(formatTriple(triple))
+	}
+
+	return builder.String()
+}
+
+func formatTriple(triple neo4j.Triple) string {
+	if triple.SourceCount > 1 {
+		return fmt.Sprintf("- %s %s %s (confidence: %.2f, %d sources)\n",
 			triple.Subject.Name,
 			triple.Predicate,
 			triple.Object.Name,
 			triple.Confidence,
-		))
+			triple.SourceCount,
+		)
 	}
-
-	return builder.String()
+	return fmt.Sprintf("- %s %s %s (confidence: %.2f)\n",
+		triple.Subject.Name,
+		triple.Predicate,
+		triple.Object.Name,
+		triple.Confidence,
+	)
 }
 
 func (e *Engine) formatVectorContext(results []zilliz.SearchResult) string {
@@ -266,57 +904,49 @@ func (e *Engine) formatVectorContext(results []zilliz.SearchResult) string {
 	}
 
 	var builder strings.Builder
-	builder.WriteString("\nRelevant Documentation:\n")
+	builder.WriteString(vectorContextHeader)
 
 	for i, result := range results {
-		if i >= 5 {
-			break
-		}
-		builder.WriteString(fmt.Sprintf("\n[Source %d]: %s\n%s\nURL: %s\n",
-			i+1,
-			result.Summary,
-			result.Text[:min(len(result.Text), 500)],
-			result.DocURL,
-		))
+		builder.WriteString(e.formatChunk(i+1, result))
 	}
 
 	return builder.String()
 }
 
-func (e *Engine) calculateConfidence(kgResults []neo4j.Triple, vectorResults []zilliz.SearchResult, response string) float64 {
-	if len(kgResults) == 0 && len(vectorResults) == 0 {
-		return 0.3
-	}
-
-	confidence := 0.5
-
-	if len(kgResults) > 0 {
-		var avgKGConfidence float64
-		for _, triple := range kgResults {
-			avgKGConfidence += triple.Confidence
-		}
-		avgKGConfidence /= float64(len(kgResults))
-		confidence += avgKGConfidence * 0.3
-	}
+func (e *Engine) formatChunk(label int, result zilliz.SearchResult) string {
+	return fmt.Sprintf("\n[source_%d]: %s\n%s\nURL: %s\n",
+		label,
+		result.Summary,
+		tokenizer.Truncate(result.Text, e.cfg.ContextChunkMaxTokens),
+		result.DocURL,
+	)
+}
 
-	if len(vectorResults) > 0 {
-		confidence += 0.2
+func (e *Engine) calculateConfidence(kgResults []neo4j.Triple, vectorResults []zilliz.SearchResult, response string) float64 {
+	signals := newConfidenceSignals(kgResults, vectorResults, response)
+	if calibration := e.calibration.Load(); calibration != nil {
+		return predictConfidence(calibration, signals.features())
 	}
+	return heuristicConfidence(signals)
+}
 
-	if strings.Contains(response, "http") {
-		confidence += 0.1
-	}
+func (e *Engine) clarificationResponse(queryID string, req QueryRequest, startTime time.Time) *QueryResponse {
+	logger.Info("Query matched no AWS service, asking for clarification", zap.String("query_id", queryID))
 
-	if confidence > 1.0 {
-		confidence = 1.0
+	return &QueryResponse{
+		ID:                 queryID,
+		Query:              req.Query,
+		Response:           fmt.Sprintf("Which AWS service is this about? For example: %s.", strings.Join(awsServices, ", ")),
+		Sources:            []Source{},
+		LatencyMS:          int(time.Since(startTime).Milliseconds()),
+		NeedsClarification: true,
 	}
-
-	return confidence
 }
 
+var awsServices = []string{"Lambda", "S3", "EC2", "RDS", "DynamoDB", "VPC", "IAM", "CloudWatch", "EKS", "ECS", "SQS", "SNS", "Kinesis"}
+
 func isAWSService(entity string) bool {
-	services := []string{"Lambda", "S3", "EC2", "RDS", "DynamoDB", "VPC", "IAM", "CloudWatch"}
-	for _, service := range services {
+	for _, service := range awsServices {
 		if entity == service {
 			return true
 		}
@@ -324,9 +954,11 @@ func isAWSService(entity string) bool {
 	return false
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+func hasAWSService(entities []string) bool {
+	for _, entity := range entities {
+		if isAWSService(entity) {
+			return true
+		}
 	}
-	return b
+	return false
 }
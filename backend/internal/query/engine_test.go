@@ -0,0 +1,515 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+)
+
+// fakeKG returns triples for every search and records the entities of the
+// last one.
+type fakeKG struct {
+	triples []neo4j.Triple
+
+	mu       sync.Mutex
+	entities []string
+}
+
+func (f *fakeKG) SearchByEntities(ctx context.Context, entities []string, minConfidence float64) ([]neo4j.Triple, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entities = append([]string(nil), entities...)
+	return f.triples, nil
+}
+
+func (f *fakeKG) Entities() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.entities...)
+}
+
+type vectorSearch struct {
+	topK    int
+	filters map[string]string
+}
+
+// fakeVector returns results for every search and records each call.
+type fakeVector struct {
+	results []zilliz.SearchResult
+
+	mu       sync.Mutex
+	searches []vectorSearch
+}
+
+func (f *fakeVector) Search(ctx context.Context, queryEmbedding []float32, topK int, filters map[string]string) ([]zilliz.SearchResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.searches = append(f.searches, vectorSearch{topK: topK, filters: filters})
+	return f.results, nil
+}
+
+func (f *fakeVector) Searches() []vectorSearch {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]vectorSearch(nil), f.searches...)
+}
+
+func newTestDB(t *testing.T) *sqlite.Client {
+	t.Helper()
+
+	db, err := sqlite.NewClient(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+	return db
+}
+
+// replyTo answers prompts whose system prompt contains a key with its
+// value, and everything else with "ok".
+func replyTo(replies map[string]string) func(llm.CompletionRequest) (string, error) {
+	return func(req llm.CompletionRequest) (string, error) {
+		for key, reply := range replies {
+			if strings.Contains(req.SystemPrompt, key) {
+				return reply, nil
+			}
+		}
+		return "ok", nil
+	}
+}
+
+func TestUnknownServiceStrategies(t *testing.T) {
+	const ambiguous = "Why do my requests keep timing out?"
+
+	tests := []struct {
+		strategy      string
+		wantFilter    string
+		wantClarify   bool
+		wantSearches  int
+		wantTriageLLM bool
+	}{
+		{strategy: UnknownServiceUnfiltered, wantSearches: 1},
+		{strategy: UnknownServiceClassify, wantFilter: "Lambda", wantSearches: 1, wantTriageLLM: true},
+		{strategy: UnknownServiceClarify, wantClarify: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			provider := &llmtest.Provider{Reply: replyTo(map[string]string{"triage": "Lambda"})}
+			vector := &fakeVector{}
+			engine := NewEngine(newTestDB(t), &fakeKG{}, vector, llmtest.NewClient(provider), nil, Config{
+				UnknownServiceStrategy: tt.strategy,
+			})
+
+			resp, err := engine.ProcessQuery(context.Background(), QueryRequest{Query: ambiguous, UserID: "u1"})
+			if err != nil {
+				t.Fatalf("ProcessQuery: %v", err)
+			}
+
+			if resp.NeedsClarification != tt.wantClarify {
+				t.Errorf("NeedsClarification = %v, want %v", resp.NeedsClarification, tt.wantClarify)
+			}
+			if tt.wantClarify && !strings.Contains(resp.Response, "Which AWS service") {
+				t.Errorf("Response = %q, want a clarifying question", resp.Response)
+			}
+
+			searches := vector.Searches()
+			if len(searches) != tt.wantSearches {
+				t.Fatalf("vector searches = %d, want %d", len(searches), tt.wantSearches)
+			}
+			if len(searches) > 0 && searches[0].filters["aws_service"] != tt.wantFilter {
+				t.Errorf("aws_service filter = %q, want %q", searches[0].filters["aws_service"], tt.wantFilter)
+			}
+
+			triaged := false
+			for _, req := range provider.Requests() {
+				if strings.Contains(req.SystemPrompt, "triage") {
+					triaged = true
+				}
+			}
+			if triaged != tt.wantTriageLLM {
+				t.Errorf("classifier called = %v, want %v", triaged, tt.wantTriageLLM)
+			}
+		})
+	}
+}
+
+func TestQueryCacheSharedAcrossUsers(t *testing.T) {
+	provider := &llmtest.Provider{}
+	cache, _ := redistest.NewClient(t)
+	db := newTestDB(t)
+	engine := NewEngine(db, &fakeKG{}, &fakeVector{}, llmtest.NewClient(provider), cache, Config{})
+	ctx := context.Background()
+
+	first, err := engine.ProcessQuery(ctx, QueryRequest{Query: "Lambda timeout errors", UserID: "u1"})
+	if err != nil {
+		t.Fatalf("first query: %v", err)
+	}
+	generated := len(provider.Requests())
+
+	second, err := engine.ProcessQuery(ctx, QueryRequest{Query: "  lambda   TIMEOUT errors ", UserID: "u2"})
+	if err != nil {
+		t.Fatalf("second query: %v", err)
+	}
+
+	if len(provider.Requests()) != generated {
+		t.Errorf("second user's query called the LLM, want a cache hit")
+	}
+	if second.Response != first.Response || second.TokensUsed != 0 {
+		t.Errorf("second response = %q (%d tokens), want the cached answer at no cost", second.Response, second.TokensUsed)
+	}
+	if second.ID == first.ID || second.Query != "  lambda   TIMEOUT errors " {
+		t.Errorf("cache hit served as %s %q, want its own ID and query instead of %s", second.ID, second.Query, first.ID)
+	}
+
+	records, err := db.GetQueryHistory("u2", 10)
+	if err != nil {
+		t.Fatalf("get history: %v", err)
+	}
+	if len(records) != 1 || records[0].ID != second.ID || records[0].Response != first.Response {
+		t.Errorf("second user's history = %+v, want the cached answer recorded under its ID", records)
+	}
+
+	if _, err := engine.ProcessQuery(ctx, QueryRequest{Query: "Lambda timeout errors", UserID: "u3", SkipHistory: true}); err != nil {
+		t.Fatalf("unrecorded query: %v", err)
+	}
+	if records, _ := db.GetQueryHistory("u3", 10); len(records) != 0 {
+		t.Errorf("history = %+v for a query that skipped history", records)
+	}
+}
+
+func TestQueryCacheKey(t *testing.T) {
+	if queryCacheKey("Lambda  Timeout", false) != queryCacheKey("lambda timeout", false) {
+		t.Error("keys differ for queries that normalize to the same text")
+	}
+	if queryCacheKey("lambda timeout", true) == queryCacheKey("lambda timeout", false) {
+		t.Error("keys match with and without web results")
+	}
+}
+
+func TestHistoryResponseMaxChars(t *testing.T) {
+	answer := strings.Repeat("Lambda ⚡ timeout ", 20)
+
+	tests := []struct {
+		name     string
+		maxChars int
+		want     string
+	}{
+		{name: "full by default", maxChars: 0, want: answer},
+		{name: "truncated", maxChars: 12, want: "Lambda ⚡ tim..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			provider := &llmtest.Provider{Reply: func(llm.CompletionRequest) (string, error) { return answer, nil }}
+			engine := NewEngine(db, &fakeKG{}, &fakeVector{}, llmtest.NewClient(provider), nil, Config{
+				HistoryResponseMaxChars: tt.maxChars,
+			})
+
+			resp, err := engine.ProcessQuery(context.Background(), QueryRequest{Query: "Lambda timeout", UserID: "u1"})
+			if err != nil {
+				t.Fatalf("ProcessQuery: %v", err)
+			}
+			if resp.Response != answer {
+				t.Errorf("returned response was truncated to %q", resp.Response)
+			}
+
+			records, err := db.GetQueryHistory("u1", 10)
+			if err != nil || len(records) != 1 {
+				t.Fatalf("history = %v, %v; want one record", records, err)
+			}
+			if records[0].Response != tt.want {
+				t.Errorf("stored response = %q, want %q", records[0].Response, tt.want)
+			}
+
+			full, found, err := db.GetQueryResponse(resp.ID, "u1")
+			if err != nil {
+				t.Fatalf("GetQueryResponse: %v", err)
+			}
+			if !found || full != answer {
+				t.Errorf("full response = %q (found %v), want the untruncated answer", full, found)
+			}
+		})
+	}
+}
+
+func TestFuseResults(t *testing.T) {
+	triple := func(name, url string) neo4j.Triple {
+		return neo4j.Triple{Subject: neo4j.Entity{Name: name}, Predicate: "USES", SourceURLs: []string{url}}
+	}
+	chunk := func(id, url string) zilliz.SearchResult {
+		return zilliz.SearchResult{ChunkID: id, DocURL: url}
+	}
+
+	tests := []struct {
+		name    string
+		kg      []neo4j.Triple
+		vector  []zilliz.SearchResult
+		weights FusionWeights
+		want    []string
+	}{
+		{
+			name:    "disjoint sets interleave by rank",
+			kg:      []neo4j.Triple{triple("kg-1", "a"), triple("kg-2", "b")},
+			vector:  []zilliz.SearchResult{chunk("vec-1", "c"), chunk("vec-2", "d")},
+			weights: FusionWeights{KG: 1, Vector: 1},
+			want:    []string{"kg-1", "vec-1", "kg-2", "vec-2"},
+		},
+		{
+			name:    "overlapping sources rank first",
+			kg:      []neo4j.Triple{triple("kg-1", "a"), triple("kg-2", "shared")},
+			vector:  []zilliz.SearchResult{chunk("vec-1", "shared"), chunk("vec-2", "c")},
+			weights: FusionWeights{KG: 1, Vector: 1},
+			want:    []string{"kg-2", "vec-1", "kg-1", "vec-2"},
+		},
+		{
+			name:    "weights favour one list",
+			kg:      []neo4j.Triple{triple("kg-1", "a"), triple("kg-2", "b")},
+			vector:  []zilliz.SearchResult{chunk("vec-1", "c"), chunk("vec-2", "d")},
+			weights: FusionWeights{KG: 1, Vector: 2},
+			want:    []string{"vec-1", "vec-2", "kg-1", "kg-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fused := fuseResults(tt.kg, tt.vector, 60, tt.weights)
+
+			var got []string
+			for i, result := range fused {
+				if i > 0 && result.Score > fused[i-1].Score {
+					t.Errorf("result %d scores %f above its predecessor %f", i, result.Score, fused[i-1].Score)
+				}
+				if result.Triple != nil {
+					got = append(got, result.Triple.Subject.Name)
+				} else {
+					got = append(got, result.Vector.ChunkID)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("fused order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFollowUps(t *testing.T) {
+	const suggestions = "How do I raise the Lambda timeout?\n- What causes cold starts?\nNot a question\n3. How do I use provisioned concurrency?"
+
+	tests := []struct {
+		name          string
+		enabled       bool
+		minConfidence float64
+		want          []string
+	}{
+		{
+			name:    "enabled",
+			enabled: true,
+			want: []string{
+				"How do I raise the Lambda timeout?",
+				"What causes cold starts?",
+				"How do I use provisioned concurrency?",
+			},
+		},
+		{name: "disabled"},
+		{name: "low confidence", enabled: true, minConfidence: 1.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &llmtest.Provider{Reply: replyTo(map[string]string{"follow-up": suggestions})}
+			engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{}, llmtest.NewClient(provider), nil, Config{
+				FollowUpsEnabled:      tt.enabled,
+				FollowUpMinConfidence: tt.minConfidence,
+			})
+
+			resp, err := engine.ProcessQuery(context.Background(), QueryRequest{Query: "Lambda timeout", UserID: "u1"})
+			if err != nil {
+				t.Fatalf("ProcessQuery: %v", err)
+			}
+			if strings.Join(resp.FollowUps, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("FollowUps = %q, want %q", resp.FollowUps, tt.want)
+			}
+
+			called := false
+			for _, req := range provider.Requests() {
+				if strings.Contains(req.SystemPrompt, "follow-up") {
+					called = true
+					if req.MaxTokens > 150 {
+						t.Errorf("follow-up MaxTokens = %d, want a low-token call", req.MaxTokens)
+					}
+				}
+			}
+			if called != (tt.want != nil) {
+				t.Errorf("follow-up LLM called = %v, want %v", called, tt.want != nil)
+			}
+		})
+	}
+}
+
+func TestFormatChunkTruncatesOnCharacterBoundaries(t *testing.T) {
+	text := strings.Repeat("Lambda 関数のタイムアウト ⚡ ", 200)
+	engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{}, llmtest.NewClient(&llmtest.Provider{}), nil, Config{
+		ContextChunkMaxTokens: 25,
+	})
+
+	chunk := engine.formatChunk(1, zilliz.SearchResult{Summary: "Timeouts", Text: text, DocURL: "https://docs.aws.amazon.com/lambda"})
+	if !utf8.ValidString(chunk) {
+		t.Fatalf("formatted chunk is not valid UTF-8: %q", chunk)
+	}
+
+	body := strings.TrimPrefix(chunk, "\n[source_1]: Timeouts\n")
+	body = body[:strings.LastIndex(body, "\nURL: ")]
+	if body == "" || len(body) >= len(text) || !strings.HasPrefix(text, body) {
+		t.Errorf("chunk text = %q, want a non-empty prefix of the original", body)
+	}
+}
+
+func TestExtractEntitiesBeyondKeywords(t *testing.T) {
+	const question = "Why are my EKS pods stuck pending while SQS messages pile up after a permission change?"
+	known := map[string]int{"Lambda": 10, "EKS": 2, "SQS": 1, "Kinesis": 1}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		reply   func(llm.CompletionRequest) (string, error)
+		want    []string
+	}{
+		{
+			name:    "grounded in the KG",
+			enabled: true,
+			reply:   replyTo(map[string]string{"triage assistant": `["Amazon EKS", "SQS", "Kubernetes scheduler"]`}),
+			want:    []string{"AccessDenied", "EKS", "SQS"},
+		},
+		{
+			name:  "disabled by default",
+			reply: replyTo(map[string]string{"triage assistant": `["EKS", "SQS"]`}),
+			want:  []string{"AccessDenied"},
+		},
+		{
+			name:    "falls back to keywords",
+			enabled: true,
+			reply: func(req llm.CompletionRequest) (string, error) {
+				if strings.Contains(req.SystemPrompt, "triage assistant") {
+					return "", errors.New("provider unavailable")
+				}
+				return "ok", nil
+			},
+			want: []string{"AccessDenied"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			for name, count := range known {
+				if err := db.InsertKGEntity(&models.KGEntity{
+					ID: strings.ToLower(name), Name: name, Type: "service", CanonicalName: name, OccurrenceCount: count,
+				}); err != nil {
+					t.Fatalf("insert entity: %v", err)
+				}
+			}
+
+			provider := &llmtest.Provider{Reply: tt.reply}
+			kg := &fakeKG{}
+			engine := NewEngine(db, kg, &fakeVector{}, llmtest.NewClient(provider), nil, Config{
+				LLMEntityExtraction: tt.enabled,
+				MaxKnownEntities:    2,
+			})
+
+			if _, err := engine.ProcessQuery(context.Background(), QueryRequest{Query: question, UserID: "u1"}); err != nil {
+				t.Fatalf("ProcessQuery: %v", err)
+			}
+
+			if got := kg.Entities(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("KG searched for %v, want %v", got, tt.want)
+			}
+
+			for _, req := range provider.Requests() {
+				if !strings.Contains(req.SystemPrompt, "triage assistant") {
+					continue
+				}
+				if !tt.enabled {
+					t.Error("extraction ran while disabled")
+				}
+				if !strings.Contains(req.UserPrompt, "Known entities: EKS, SQS\n") {
+					t.Errorf("extraction prompt = %q, want the entities named in the query", req.UserPrompt)
+				}
+			}
+		})
+	}
+}
+
+func TestRelevantKnownEntities(t *testing.T) {
+	known := []string{"Lambda", "S3", "Kinesis Data Streams", "EKS", "eks", "SQS"}
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		{query: "EKS nodes can't read the Kinesis stream", limit: 2, want: []string{"EKS", "Kinesis Data Streams"}},
+		{query: "EKS nodes can't read the Kinesis stream", limit: 10, want: []string{"EKS", "Kinesis Data Streams", "Lambda", "S3", "SQS"}},
+		{query: "Something unrelated", limit: 2, want: []string{"Lambda", "S3"}},
+	}
+
+	for _, tt := range tests {
+		got := relevantKnownEntities(tt.query, known, tt.limit)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("relevantKnownEntities(%q, %d) = %v, want %v", tt.query, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestLLMCallBudgetCapsOptionalStages(t *testing.T) {
+	tests := []struct {
+		maxCalls int
+		want     int
+	}{
+		{maxCalls: 1, want: 1},
+		{maxCalls: 3, want: 3},
+		{maxCalls: 20, want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.maxCalls), func(t *testing.T) {
+			provider := &llmtest.Provider{}
+			vector := &fakeVector{results: []zilliz.SearchResult{
+				{ChunkID: "c1", Text: "Raise the function timeout.", DocURL: "https://docs.aws.amazon.com/a", Score: 0.9},
+				{ChunkID: "c2", Text: "Timeouts are logged.", DocURL: "https://docs.aws.amazon.com/b", Score: 0.8},
+			}}
+			engine := NewEngine(newTestDB(t), &fakeKG{}, vector, llmtest.NewClient(provider), nil, Config{
+				MaxLLMCalls:            tt.maxCalls,
+				LLMEntityExtraction:    true,
+				UnknownServiceStrategy: UnknownServiceClassify,
+				RerankEnabled:          true,
+				FollowUpsEnabled:       true,
+			})
+
+			if _, err := engine.ProcessQuery(context.Background(), QueryRequest{Query: "my function keeps timing out", UserID: "u1"}); err != nil {
+				t.Fatalf("ProcessQuery: %v", err)
+			}
+
+			if got := len(provider.Requests()); got != tt.want {
+				t.Errorf("made %d LLM calls with a budget of %d, want %d", got, tt.maxCalls, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package query
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+const maxKeywordTerms = 12
+
+var (
+	keywordTokenPattern = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9._:-]*[A-Za-z0-9]`)
+	// Error codes users paste verbatim: InvalidParameterValue,
+	// AccessDeniedException, THROTTLING_EXCEPTION, ERR_CONNECTION_RESET.
+	errorCodePattern = regexp.MustCompile(`^(?:[A-Z][a-z0-9]+){2,}$|^[A-Z][A-Z0-9]*(?:_[A-Z0-9]+)+$`)
+
+	keywordStopWords = map[string]bool{
+		"the": true, "and": true, "for": true, "with": true, "how": true, "what": true,
+		"why": true, "when": true, "this": true, "that": true, "from": true, "are": true,
+		"can": true, "does": true, "get": true, "getting": true, "error": true, "aws": true,
+		"you": true, "have": true, "not": true, "but": true, "into": true, "your": true,
+	}
+)
+
+// keywordTerms extracts the terms sent to the sparse index. Error codes come
+// first so they survive the term cap.
+func keywordTerms(query string) (terms []string, codes []string) {
+	seen := make(map[string]bool)
+	var words []string
+	for _, token := range keywordTokenPattern.FindAllString(query, -1) {
+		key := strings.ToLower(token)
+		if seen[key] || len(token) < 3 || keywordStopWords[key] {
+			continue
+		}
+		seen[key] = true
+
+		if errorCodePattern.MatchString(token) {
+			codes = append(codes, token)
+		} else {
+			words = append(words, token)
+		}
+	}
+
+	terms = append(append(terms, codes...), words...)
+	if len(terms) > maxKeywordTerms {
+		terms = terms[:maxKeywordTerms]
+	}
+	return terms, codes
+}
+
+// hybridSearch fuses dense results with keyword matches from the chunk
+// index using reciprocal rank fusion, restricted to awsService when the dense
+// search was. Chunks containing an error code from the query verbatim get an
+// extra top-rank contribution, so an exact code match outranks semantically
+// similar chunks that never mention it. The fusion score only orders the
+// results; each result keeps its own vector similarity.
+func (e *Engine) hybridSearch(query string, dense []zilliz.SearchResult, awsService string, limit int) []zilliz.SearchResult {
+	terms, codes := keywordTerms(query)
+	if len(terms) == 0 {
+		return dense
+	}
+
+	matches, err := e.db.KeywordSearchChunks(terms, awsService, e.cfg.KeywordSearchLimit)
+	if err != nil {
+		logger.Warn("Keyword search failed, using dense results only", zap.Error(err))
+		return dense
+	}
+	if len(matches) == 0 {
+		return dense
+	}
+
+	k := e.cfg.FusionK
+	type candidate struct {
+		result zilliz.SearchResult
+		rrf    float64
+	}
+	candidates := make(map[string]*candidate)
+	order := make([]string, 0, len(dense)+len(matches))
+
+	for rank, result := range dense {
+		if _, ok := candidates[result.ChunkID]; ok {
+			continue
+		}
+		candidates[result.ChunkID] = &candidate{result: result, rrf: 1 / (k + float64(rank+1))}
+		order = append(order, result.ChunkID)
+	}
+
+	exactMatches := 0
+	for rank, match := range matches {
+		rrf := 1 / (k + float64(rank+1))
+		if containsAny(match.Text, codes) {
+			rrf += 1 / (k + float64(exactMatches+1))
+			exactMatches++
+		}
+
+		if existing, ok := candidates[match.ChunkID]; ok {
+			existing.rrf += rrf
+			continue
+		}
+
+		candidates[match.ChunkID] = &candidate{
+			result: zilliz.SearchResult{
+				ChunkID:     match.ChunkID,
+				Text:        match.Text,
+				DocURL:      match.DocURL,
+				AWSService:  match.AWSService,
+				DocType:     match.DocType,
+				Summary:     match.Summary,
+				KeywordOnly: true,
+			},
+			rrf: rrf,
+		}
+		order = append(order, match.ChunkID)
+	}
+
+	fused := make([]*candidate, 0, len(order))
+	for _, id := range order {
+		fused = append(fused, candidates[id])
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].rrf > fused[j].rrf
+	})
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
+
+	results := make([]zilliz.SearchResult, len(fused))
+	for i, c := range fused {
+		results[i] = c.result
+	}
+
+	logger.Debug("Hybrid search fused results",
+		zap.Int("dense", len(dense)),
+		zap.Int("keyword", len(matches)),
+		zap.Int("exact_code_matches", exactMatches),
+	)
+
+	return results
+}
+
+func containsAny(text string, needles []string) bool {
+	for _, needle := range needles {
+		if strings.Contains(text, needle) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+)
+
+// storeChunk saves a one-chunk document about service for keyword search.
+func storeChunk(t *testing.T, db *sqlite.Client, id, service, text string) {
+	t.Helper()
+
+	doc := &models.Document{
+		ID:         "doc-" + id,
+		URL:        "https://docs.aws.amazon.com/" + id,
+		AWSService: service,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := db.InsertDocument(doc); err != nil {
+		t.Fatalf("insert document: %v", err)
+	}
+	if err := db.InsertChunk(&models.DocumentChunk{ID: id, DocID: doc.ID, Text: text, CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("insert chunk: %v", err)
+	}
+}
+
+func TestHybridSearchFindsVerbatimErrorCodes(t *testing.T) {
+	const question = "Lambda CreateFunction fails with InvalidParameterValueException"
+
+	db := newTestDB(t)
+	storeChunk(t, db, "exact", "Lambda", "InvalidParameterValueException is returned when the execution role cannot be assumed.")
+	storeChunk(t, db, "other-service", "S3", "S3 returns InvalidParameterValueException for malformed bucket policies.")
+
+	dense := []zilliz.SearchResult{
+		{ChunkID: "similar-1", Text: "Lambda function configuration overview", AWSService: "Lambda", Score: 0.82},
+		{ChunkID: "similar-2", Text: "Creating functions with the Lambda console", AWSService: "Lambda", Score: 0.79},
+	}
+
+	tests := []struct {
+		name      string
+		hybrid    bool
+		wantFirst string
+	}{
+		{name: "dense only", wantFirst: "similar-1"},
+		{name: "hybrid", hybrid: true, wantFirst: "exact"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vector := &fakeVector{results: dense}
+			engine := NewEngine(db, &fakeKG{}, vector, llmtest.NewClient(&llmtest.Provider{}), nil, Config{
+				HybridSearchEnabled: tt.hybrid,
+				VectorTopK:          3,
+			})
+
+			results, err := engine.retrieveFromVector(context.Background(), question, []string{"Lambda"})
+			if err != nil {
+				t.Fatalf("retrieveFromVector: %v", err)
+			}
+
+			searches := vector.Searches()
+			if len(searches) != 1 || searches[0].topK != 3 || searches[0].filters["aws_service"] != "Lambda" {
+				t.Fatalf("vector searches = %+v, want one Lambda search for the configured topK", searches)
+			}
+			if len(results) == 0 || results[0].ChunkID != tt.wantFirst {
+				t.Fatalf("results = %+v, want %s first", results, tt.wantFirst)
+			}
+
+			for _, result := range results {
+				if result.ChunkID == "other-service" {
+					t.Error("keyword search returned a chunk outside the filtered service")
+				}
+				if result.ChunkID == "exact" && (!result.KeywordOnly || result.Score != 0) {
+					t.Errorf("keyword-only result = %+v, want no vector similarity", result)
+				}
+				if result.ChunkID == "similar-1" && result.Score != 0.82 {
+					t.Errorf("dense result score = %v, want its similarity 0.82 kept", result.Score)
+				}
+			}
+		})
+	}
+}
+
+func TestConfidenceSignalsIgnoreKeywordOnlyResults(t *testing.T) {
+	signals := newConfidenceSignals(nil, []zilliz.SearchResult{
+		{ChunkID: "dense", Score: 0.8},
+		{ChunkID: "keyword", KeywordOnly: true},
+	}, "")
+
+	if signals.VectorCount != 2 || signals.AvgVector != float64(float32(0.8)) {
+		t.Errorf("signals = %+v, want both results counted and only the dense score averaged", signals)
+	}
+}
@@ -0,0 +1,60 @@
+package query
+
+import (
+	"regexp"
+)
+
+const (
+	IntentTroubleshooting = "troubleshooting"
+	IntentConceptual      = "conceptual"
+	IntentHowTo           = "howto"
+	IntentGeneral         = "general"
+)
+
+type FusionWeights struct {
+	KG     float64
+	Vector float64
+}
+
+var (
+	troubleshootingPattern = regexp.MustCompile(`(?i)\b(error|errors|fail(s|ed|ing|ure)?|exception|denied|timed? ?out|not working|doesn't work|cannot|can't|unable|broken|crash(es|ing)?|throttl\w*|stuck|unreachable|refused|[45]\d\d)\b`)
+	conceptualPattern      = regexp.MustCompile(`(?i)\b(relate[sd]?|relationship|difference between|differ|vs\.?|versus|compare[sd]?|comparison|what is|what are|why (does|do|is)|how does .+ work|concept|architecture|explain)\b`)
+	howToPattern           = regexp.MustCompile(`(?i)\b(how (do|can|should) (i|we|you)|how to|steps to|configure|set ?up|enable|create|install|migrate)\b`)
+)
+
+var defaultFusionWeights = FusionWeights{KG: 1, Vector: 1}
+
+// classifyIntent buckets a query by the kind of evidence that answers it best.
+// Troubleshooting wins ties: a query naming an error code is answered by the
+// documentation for that error even when it is phrased conceptually.
+func classifyIntent(query string) string {
+	if troubleshootingPattern.MatchString(query) {
+		return IntentTroubleshooting
+	}
+	for _, token := range keywordTokenPattern.FindAllString(query, -1) {
+		if errorCodePattern.MatchString(token) {
+			return IntentTroubleshooting
+		}
+	}
+	if conceptualPattern.MatchString(query) {
+		return IntentConceptual
+	}
+	if howToPattern.MatchString(query) {
+		return IntentHowTo
+	}
+	return IntentGeneral
+}
+
+func (e *Engine) fusionWeights(intent string) FusionWeights {
+	weights, ok := e.cfg.FusionWeights[intent]
+	if !ok {
+		return defaultFusionWeights
+	}
+	if weights.KG < 0 {
+		weights.KG = 0
+	}
+	if weights.Vector < 0 {
+		weights.Vector = 0
+	}
+	return weights
+}
@@ -0,0 +1,57 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/aws-agent/backend/internal/kg/neo4j"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+)
+
+func TestClassifyIntent(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"How does IAM relate to S3 bucket policies?", IntentConceptual},
+		{"What is the difference between SQS and SNS?", IntentConceptual},
+		{"Lambda function timed out after 3 seconds", IntentTroubleshooting},
+		{"Getting AccessDenied when reading from S3", IntentTroubleshooting},
+		{"Why does my API return 503?", IntentTroubleshooting},
+		{"How do I create a DynamoDB table?", IntentHowTo},
+		{"EC2 instance types", IntentGeneral},
+	}
+
+	for _, tt := range tests {
+		if got := classifyIntent(tt.query); got != tt.want {
+			t.Errorf("classifyIntent(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFusionWeightsByIntent(t *testing.T) {
+	engine := &Engine{cfg: Config{FusionWeights: map[string]FusionWeights{
+		IntentConceptual:      {KG: 1.5, Vector: 0.75},
+		IntentTroubleshooting: {KG: 0.75, Vector: 1.5},
+	}}}
+
+	kg := []neo4j.Triple{{Subject: neo4j.Entity{Name: "kg"}, SourceURLs: []string{"a"}}}
+	vector := []zilliz.SearchResult{{ChunkID: "vector", DocURL: "b"}}
+	first := func(query string) string {
+		fused := fuseResults(kg, vector, 60, engine.fusionWeights(classifyIntent(query)))
+		if fused[0].Triple != nil {
+			return "kg"
+		}
+		return "vector"
+	}
+
+	if got := first("How does IAM relate to S3 bucket policies?"); got != "kg" {
+		t.Errorf("conceptual query ranked %s first, want kg", got)
+	}
+	if got := first("Lambda function timed out after 3 seconds"); got != "vector" {
+		t.Errorf("troubleshooting query ranked %s first, want vector", got)
+	}
+
+	if got := engine.fusionWeights(IntentHowTo); got != defaultFusionWeights {
+		t.Errorf("unconfigured intent weights = %+v, want %+v", got, defaultFusionWeights)
+	}
+}
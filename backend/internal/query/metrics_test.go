@@ -0,0 +1,70 @@
+package query
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/metrics"
+)
+
+// sampleCount returns how many observations histogram has recorded.
+func sampleCount(t *testing.T, histogram prometheus.Observer) uint64 {
+	t.Helper()
+
+	metric, ok := histogram.(prometheus.Metric)
+	if !ok {
+		t.Fatalf("%T is not a metric", histogram)
+	}
+	var out dto.Metric
+	if err := metric.Write(&out); err != nil {
+		t.Fatalf("write metric: %v", err)
+	}
+	return out.GetHistogram().GetSampleCount()
+}
+
+func TestProcessQueryRecordsMetrics(t *testing.T) {
+	engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{}, llmtest.NewClient(&llmtest.Provider{}), nil, Config{})
+
+	successes := testutil.ToFloat64(metrics.QueryTotal.WithLabelValues("success"))
+	promptTokens := testutil.ToFloat64(metrics.LLMTokensUsed.WithLabelValues("fake-model", "prompt"))
+	completionTokens := testutil.ToFloat64(metrics.LLMTokensUsed.WithLabelValues("fake-model", "completion"))
+	durations := sampleCount(t, metrics.QueryDuration.WithLabelValues("rag"))
+	confidences := sampleCount(t, metrics.ConfidenceScore.WithLabelValues())
+	kgCounts := sampleCount(t, metrics.KGResultsCount)
+	vectorCounts := sampleCount(t, metrics.VectorResultsCount)
+
+	if _, err := engine.ProcessQuery(context.Background(), QueryRequest{Query: "How do I raise the Lambda timeout?", UserID: "u1"}); err != nil {
+		t.Fatalf("ProcessQuery: %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.QueryTotal.WithLabelValues("success")) - successes; got != 1 {
+		t.Errorf("successful queries moved by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.LLMTokensUsed.WithLabelValues("fake-model", "prompt")) - promptTokens; got < 10 {
+		t.Errorf("prompt tokens moved by %v, want at least one completion's 10", got)
+	}
+	if got := testutil.ToFloat64(metrics.LLMTokensUsed.WithLabelValues("fake-model", "completion")) - completionTokens; got < 5 {
+		t.Errorf("completion tokens moved by %v, want at least one completion's 5", got)
+	}
+
+	histograms := []struct {
+		name   string
+		before uint64
+		after  uint64
+	}{
+		{"query duration", durations, sampleCount(t, metrics.QueryDuration.WithLabelValues("rag"))},
+		{"confidence", confidences, sampleCount(t, metrics.ConfidenceScore.WithLabelValues())},
+		{"kg results", kgCounts, sampleCount(t, metrics.KGResultsCount)},
+		{"vector results", vectorCounts, sampleCount(t, metrics.VectorResultsCount)},
+	}
+	for _, h := range histograms {
+		if h.after-h.before != 1 {
+			t.Errorf("%s observations moved by %d, want 1", h.name, h.after-h.before)
+		}
+	}
+}
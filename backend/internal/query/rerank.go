@@ -0,0 +1,73 @@
+package query
+
+import (
+	"context"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/tokenizer"
+)
+
+// rerankVectorResults asks the LLM to score every candidate chunk in a single
+// call and reorders the candidates by that score. Fusion ranks vector results
+// by position, so the new order carries through to context assembly. On any
+// failure the retrieval order is kept.
+func (e *Engine) rerankVectorResults(ctx context.Context, query string, results []zilliz.SearchResult) []zilliz.SearchResult {
+	if !e.cfg.RerankEnabled || len(results) < 2 {
+		return results
+	}
+
+	if !llm.AcquireCall(ctx, "rerank") {
+		return results
+	}
+
+	candidates := results
+	if len(candidates) > e.cfg.RerankMaxCandidates {
+		candidates = candidates[:e.cfg.RerankMaxCandidates]
+	}
+
+	passages := make([]string, len(candidates))
+	for i, result := range candidates {
+		passages[i] = tokenizer.Truncate(result.Summary+"\n"+result.Text, e.cfg.ContextChunkMaxTokens)
+	}
+
+	rerankCtx, cancel := context.WithTimeout(ctx, e.cfg.RerankTimeout)
+	defer cancel()
+
+	scores, err := e.llmClient.ScoreRelevance(rerankCtx, query, passages)
+	if err != nil {
+		logger.Warn("Reranking failed, keeping retrieval order", zap.Error(err))
+		return results
+	}
+
+	type scored struct {
+		result   zilliz.SearchResult
+		score    float64
+		original int
+	}
+
+	ranked := make([]scored, len(candidates))
+	for i, result := range candidates {
+		ranked[i] = scored{result: result, score: scores[i], original: i}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+
+	reranked := make([]zilliz.SearchResult, 0, len(results))
+	for rank, r := range ranked {
+		logger.Debug("Rerank score",
+			zap.String("chunk_id", r.result.ChunkID),
+			zap.Float64("rerank_score", r.score),
+			zap.Float32("vector_score", r.result.Score),
+			zap.Int("rank_delta", r.original-rank),
+		)
+		reranked = append(reranked, r.result)
+	}
+
+	return append(reranked, results[len(candidates):]...)
+}
@@ -0,0 +1,63 @@
+package query
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/vector/zilliz"
+)
+
+func chunkIDs(results []zilliz.SearchResult) string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ChunkID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestRerankVectorResults(t *testing.T) {
+	candidates := []zilliz.SearchResult{
+		{ChunkID: "tangential", Text: "Lambda pricing tiers", Score: 0.9},
+		{ChunkID: "answer", Text: "Raise the Lambda timeout in the function configuration", Score: 0.8},
+		{ChunkID: "related", Text: "Lambda timeouts and retries", Score: 0.7},
+		{ChunkID: "beyond-cap", Text: "Lambda layers", Score: 0.6},
+	}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		reply   string
+		want    string
+		calls   int
+	}{
+		{name: "reordered", enabled: true, reply: "[1, 10, 6]", want: "answer,related,tangential,beyond-cap", calls: 1},
+		{name: "disabled", reply: "[1, 10, 6]", want: "tangential,answer,related,beyond-cap"},
+		{name: "unparseable scores", enabled: true, reply: "the second one", want: "tangential,answer,related,beyond-cap", calls: 1},
+		{name: "wrong score count", enabled: true, reply: "[1, 10]", want: "tangential,answer,related,beyond-cap", calls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &llmtest.Provider{Reply: replyTo(map[string]string{"relevance judge": tt.reply})}
+			engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{}, llmtest.NewClient(provider), nil, Config{
+				RerankEnabled:       tt.enabled,
+				RerankMaxCandidates: 3,
+			})
+
+			got := engine.rerankVectorResults(context.Background(), "How do I fix Lambda timeouts?", candidates)
+			if chunkIDs(got) != tt.want {
+				t.Errorf("order = %s, want %s", chunkIDs(got), tt.want)
+			}
+
+			requests := provider.Requests()
+			if len(requests) != tt.calls {
+				t.Fatalf("LLM calls = %d, want %d", len(requests), tt.calls)
+			}
+			if tt.calls > 0 && strings.Contains(requests[0].UserPrompt, "Lambda layers") {
+				t.Error("candidate beyond RerankMaxCandidates was sent for scoring")
+			}
+		})
+	}
+}
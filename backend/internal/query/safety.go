@@ -0,0 +1,82 @@
+package query
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	DisclaimerPrepend = "prepend"
+	DisclaimerAppend  = "append"
+	DisclaimerFlag    = "flag"
+
+	RiskDestructive = "destructive"
+)
+
+const defaultDestructiveDisclaimer = "⚠️ Warning: this answer includes destructive operations that can permanently remove resources or data. Verify the target, take a backup or snapshot, and test in a non-production account before running them."
+
+var (
+	destructiveCommandPattern = regexp.MustCompile(`(?i)\baws\s+[a-z0-9-]+\s+((delete|terminate|remove|purge|deregister)-[a-z0-9-]+)|\brm\s+-rf\b|\b(drop\s+(table|database|schema))\b|\btruncate\s+table\b`)
+	destructiveVerbPattern    = regexp.MustCompile(`(?i)\b(delete|terminate|drop|destroy|purge|truncate|wipe)\b`)
+	negationPattern           = regexp.MustCompile(`(?i)\b(not|never|don't|avoid|without|instead of|rather than)\b`)
+	benignFollowerPattern     = regexp.MustCompile(`(?i)^\s*(protection|policy|marker|permission|permissions|event|events)\b`)
+	sentenceSplitPattern      = regexp.MustCompile(`[.!?\n]+`)
+)
+
+// detectDestructiveOperations returns the destructive operations an answer
+// recommends. CLI and SQL commands always count; bare verbs are ignored when
+// the sentence negates them ("do not delete") or they name a setting
+// ("deletion protection", "delete marker").
+func detectDestructiveOperations(answer string) []string {
+	seen := make(map[string]bool)
+	var operations []string
+
+	add := func(op string) {
+		op = strings.ToLower(strings.Join(strings.Fields(op), " "))
+		if !seen[op] {
+			seen[op] = true
+			operations = append(operations, op)
+		}
+	}
+
+	for _, match := range destructiveCommandPattern.FindAllString(answer, -1) {
+		add(match)
+	}
+
+	for _, sentence := range sentenceSplitPattern.Split(answer, -1) {
+		if negationPattern.MatchString(sentence) {
+			continue
+		}
+
+		for _, loc := range destructiveVerbPattern.FindAllStringIndex(sentence, -1) {
+			if benignFollowerPattern.MatchString(sentence[loc[1]:]) {
+				continue
+			}
+			add(sentence[loc[0]:loc[1]])
+		}
+	}
+
+	return operations
+}
+
+func (e *Engine) applyDisclaimer(response string, streaming bool) (string, string, []string) {
+	if !e.cfg.DisclaimerEnabled {
+		return response, "", nil
+	}
+
+	operations := detectDestructiveOperations(response)
+	if len(operations) == 0 {
+		return response, "", nil
+	}
+
+	switch e.cfg.DisclaimerPosition {
+	case DisclaimerFlag:
+		return response, RiskDestructive, operations
+	case DisclaimerPrepend:
+		if !streaming {
+			return e.cfg.DestructiveDisclaimer + "\n\n" + response, RiskDestructive, operations
+		}
+	}
+
+	return response + "\n\n" + e.cfg.DestructiveDisclaimer, RiskDestructive, operations
+}
@@ -0,0 +1,75 @@
+package query
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+)
+
+func TestDetectDestructiveOperations(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   []string
+	}{
+		{
+			answer: "Run `aws s3api delete-bucket --bucket old-logs` once the bucket is empty.",
+			want:   []string{"aws s3api delete-bucket", "delete"},
+		},
+		{answer: "Terminate the unhealthy instance and let the Auto Scaling group replace it.", want: []string{"terminate"}},
+		{answer: "Then DROP TABLE sessions; to reclaim space.", want: []string{"drop table", "drop"}},
+		{answer: "Do not delete the stack while the update is in progress."},
+		{answer: "Enable deletion protection and delete marker replication on the bucket."},
+		{answer: "Turn on delete protection for the table."},
+		{answer: "Increase the function timeout to 30 seconds."},
+	}
+
+	for _, tt := range tests {
+		if got := detectDestructiveOperations(tt.answer); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("detectDestructiveOperations(%q) = %q, want %q", tt.answer, got, tt.want)
+		}
+	}
+}
+
+func TestProcessQueryFlagsDestructiveAnswers(t *testing.T) {
+	const answer = "Delete the old snapshots with aws ec2 delete-snapshot --snapshot-id snap-123."
+
+	tests := []struct {
+		position   string
+		wantPrefix bool
+		wantSuffix bool
+	}{
+		{position: DisclaimerAppend, wantSuffix: true},
+		{position: DisclaimerPrepend, wantPrefix: true},
+		{position: DisclaimerFlag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.position, func(t *testing.T) {
+			provider := &llmtest.Provider{Reply: func(req llm.CompletionRequest) (string, error) { return answer, nil }}
+			engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{}, llmtest.NewClient(provider), nil, Config{
+				DisclaimerEnabled:     true,
+				DisclaimerPosition:    tt.position,
+				DestructiveDisclaimer: "CAUTION",
+			})
+
+			resp, err := engine.ProcessQuery(context.Background(), QueryRequest{Query: "How do I clean up EBS snapshots?", UserID: "u1"})
+			if err != nil {
+				t.Fatalf("ProcessQuery: %v", err)
+			}
+
+			if resp.Risk != RiskDestructive || len(resp.RiskOperations) == 0 {
+				t.Errorf("risk = %q with operations %q, want %q", resp.Risk, resp.RiskOperations, RiskDestructive)
+			}
+			if got := strings.HasPrefix(resp.Response, "CAUTION"); got != tt.wantPrefix {
+				t.Errorf("response %q starts with the disclaimer: %v, want %v", resp.Response, got, tt.wantPrefix)
+			}
+			if got := strings.HasSuffix(resp.Response, "CAUTION"); got != tt.wantSuffix {
+				t.Errorf("response %q ends with the disclaimer: %v, want %v", resp.Response, got, tt.wantSuffix)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package query
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/cache/redis"
+	"github.com/aws-agent/backend/internal/metrics"
+	"github.com/aws-agent/backend/pkg/logger"
+	"github.com/aws-agent/backend/pkg/utils"
+)
+
+// semanticCacheScope keeps answers that may include web results apart from
+// ones that may not, as the exact-match cache key does.
+func semanticCacheScope(webAllowed bool) string {
+	if webAllowed {
+		return "web"
+	}
+	return "local"
+}
+
+// nearestSemanticQuery returns the hash of the indexed query most similar
+// to embedding, if it reaches threshold.
+func nearestSemanticQuery(candidates []redis.SemanticQuery, embedding []float32, threshold float64) (string, float64, bool) {
+	var best string
+	bestScore := -1.0
+	for _, candidate := range candidates {
+		if score := utils.CosineSimilarity(embedding, candidate.Embedding); score > bestScore {
+			best, bestScore = candidate.QueryHash, score
+		}
+	}
+	if best == "" || bestScore < threshold {
+		return "", bestScore, false
+	}
+	return best, bestScore, true
+}
+
+// queryEmbedding embeds the query for the semantic cache. The embedding is
+// cached by the LLM client, so vector retrieval reuses it on a miss.
+func (e *Engine) queryEmbedding(ctx context.Context, query string) []float32 {
+	if !e.cfg.SemanticCacheEnabled || e.cache == nil {
+		return nil
+	}
+
+	embedding, err := e.llmClient.GenerateEmbedding(ctx, query)
+	if err != nil {
+		logger.FromContext(ctx).Warn("Failed to embed query for semantic cache", zap.Error(err))
+		return nil
+	}
+	return embedding
+}
+
+// getSemanticCachedResponse serves a cached answer to a paraphrase of the
+// query. The threshold is kept high because a near miss returns an answer
+// to a different question.
+func (e *Engine) getSemanticCachedResponse(ctx context.Context, embedding []float32, webAllowed bool) (*QueryResponse, bool) {
+	if embedding == nil {
+		return nil, false
+	}
+
+	candidates, err := e.cache.GetSemanticQueries(ctx, semanticCacheScope(webAllowed), e.cfg.SemanticCacheMaxEntries)
+	if err != nil {
+		logger.FromContext(ctx).Warn("Semantic cache lookup failed", zap.Error(err))
+		metrics.CacheMisses.WithLabelValues("semantic_query").Inc()
+		return nil, false
+	}
+
+	hash, similarity, ok := nearestSemanticQuery(candidates, embedding, e.cfg.SemanticCacheThreshold)
+	if !ok {
+		metrics.CacheMisses.WithLabelValues("semantic_query").Inc()
+		return nil, false
+	}
+
+	// The response may have expired or been invalidated before its index
+	// entry.
+	var cached QueryResponse
+	found, err := e.cache.GetQuery(ctx, hash, &cached)
+	if err != nil {
+		logger.FromContext(ctx).Warn("Semantic cache lookup failed", zap.Error(err))
+	}
+	if err != nil || !found {
+		metrics.CacheMisses.WithLabelValues("semantic_query").Inc()
+		return nil, false
+	}
+
+	metrics.CacheHits.WithLabelValues("semantic_query").Inc()
+	logger.FromContext(ctx).Info("Semantic cache hit",
+		zap.String("cached_query", cached.Query),
+		zap.Float64("similarity", similarity),
+	)
+	return &cached, true
+}
+
+func (e *Engine) setSemanticCachedQuery(ctx context.Context, key string, embedding []float32, webAllowed bool) {
+	if embedding == nil {
+		return
+	}
+
+	if err := e.cache.AddSemanticQuery(ctx, semanticCacheScope(webAllowed), key, embedding, e.cfg.QueryCacheTTL, e.cfg.SemanticCacheMaxEntries); err != nil {
+		logger.FromContext(ctx).Warn("Failed to index query for semantic cache", zap.Error(err))
+	}
+}
@@ -0,0 +1,155 @@
+package query
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws-agent/backend/internal/cache/redis"
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+)
+
+// similarTo returns a unit vector whose cosine similarity to similarTo(1)
+// is similarity.
+func similarTo(similarity float64) []float32 {
+	return []float32{float32(similarity), float32(math.Sqrt(1 - similarity*similarity)), 0, 0, 0, 0, 0, 0}
+}
+
+func responseCount(provider *llmtest.Provider) int {
+	n := 0
+	for _, req := range provider.Requests() {
+		if req.MaxTokens == llm.ResponseMaxTokens {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSemanticCacheServesParaphrases(t *testing.T) {
+	embeddings := map[string][]float32{
+		"lambda timing out":                  similarTo(1),
+		"why is my lambda timing out":        similarTo(0.97),
+		"lambda timing out after 15 minutes": similarTo(0.90),
+	}
+	provider := &llmtest.Provider{
+		Reply: func(req llm.CompletionRequest) (string, error) {
+			if req.MaxTokens == llm.ResponseMaxTokens {
+				return "Raise the Lambda function timeout.", nil
+			}
+			return "ok", nil
+		},
+		Embed: func(text string) ([]float32, error) {
+			if embedding, ok := embeddings[strings.ToLower(text)]; ok {
+				return embedding, nil
+			}
+			return llmtest.HashEmbedding(text), nil
+		},
+	}
+	cache, _ := redistest.NewClient(t)
+	engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{}, llmtest.NewClient(provider), cache, Config{
+		SemanticCacheEnabled:   true,
+		SemanticCacheThreshold: 0.95,
+	})
+	ctx := context.Background()
+
+	first, err := engine.ProcessQuery(ctx, QueryRequest{Query: "Lambda timing out", UserID: "u1"})
+	if err != nil {
+		t.Fatalf("first query: %v", err)
+	}
+	if responseCount(provider) != 1 {
+		t.Fatalf("responses generated = %d, want 1", responseCount(provider))
+	}
+
+	paraphrase, err := engine.ProcessQuery(ctx, QueryRequest{Query: "Why is my Lambda timing out", UserID: "u2"})
+	if err != nil {
+		t.Fatalf("paraphrase: %v", err)
+	}
+	if responseCount(provider) != 1 {
+		t.Error("the paraphrase generated a new answer, want a semantic cache hit")
+	}
+	if paraphrase.Response != first.Response || paraphrase.TokensUsed != 0 {
+		t.Errorf("paraphrase response = %q (%d tokens), want the cached answer at no cost", paraphrase.Response, paraphrase.TokensUsed)
+	}
+
+	// Similar wording below the threshold asks a different question.
+	if _, err := engine.ProcessQuery(ctx, QueryRequest{Query: "Lambda timing out after 15 minutes", UserID: "u1"}); err != nil {
+		t.Fatalf("near query: %v", err)
+	}
+	if _, err := engine.ProcessQuery(ctx, QueryRequest{Query: "How do I create an S3 bucket?", UserID: "u1"}); err != nil {
+		t.Fatalf("unrelated query: %v", err)
+	}
+	if got := responseCount(provider); got != 3 {
+		t.Errorf("responses generated = %d, want the near and unrelated queries answered afresh", got)
+	}
+}
+
+func TestSemanticCacheDisabledByDefault(t *testing.T) {
+	provider := &llmtest.Provider{Embed: func(text string) ([]float32, error) { return similarTo(1), nil }}
+	cache, _ := redistest.NewClient(t)
+	engine := NewEngine(newTestDB(t), &fakeKG{}, &fakeVector{}, llmtest.NewClient(provider), cache, Config{})
+	ctx := context.Background()
+
+	for _, query := range []string{"Lambda timing out", "Why is my Lambda timing out"} {
+		if _, err := engine.ProcessQuery(ctx, QueryRequest{Query: query, UserID: "u1"}); err != nil {
+			t.Fatalf("query %q: %v", query, err)
+		}
+	}
+	if got := responseCount(provider); got != 2 {
+		t.Errorf("responses generated = %d, want every query answered with the semantic cache off", got)
+	}
+}
+
+func TestNearestSemanticQuery(t *testing.T) {
+	candidates := []redis.SemanticQuery{
+		{QueryHash: "far", Embedding: similarTo(0.5)},
+		{QueryHash: "near", Embedding: similarTo(0.96)},
+		{QueryHash: "closer", Embedding: similarTo(0.98)},
+	}
+
+	hash, similarity, ok := nearestSemanticQuery(candidates, similarTo(1), 0.95)
+	if !ok || hash != "closer" || math.Abs(similarity-0.98) > 1e-6 {
+		t.Errorf("nearest = %q (%f, %v), want the closest candidate", hash, similarity, ok)
+	}
+
+	if hash, _, ok := nearestSemanticQuery(candidates, similarTo(1), 0.99); ok {
+		t.Errorf("nearest = %q, want no match above the threshold", hash)
+	}
+	if _, _, ok := nearestSemanticQuery(nil, similarTo(1), 0.95); ok {
+		t.Error("matched an empty index")
+	}
+}
+
+func TestSemanticQueriesStoredAsBinary(t *testing.T) {
+	cache, srv := redistest.NewClient(t)
+	ctx := context.Background()
+
+	for _, hash := range []string{"q1", "q2", "q3"} {
+		if err := cache.AddSemanticQuery(ctx, "local", hash, similarTo(0.6), time.Hour, 10); err != nil {
+			t.Fatalf("add %s: %v", hash, err)
+		}
+	}
+
+	stored, err := srv.Get("semantic:local:q1")
+	if err != nil {
+		t.Fatalf("get stored embedding: %v", err)
+	}
+	if want := 4 * len(similarTo(0.6)); len(stored) != want {
+		t.Errorf("stored embedding is %d bytes, want %d packed float32s", len(stored), want)
+	}
+
+	queries, err := cache.GetSemanticQueries(ctx, "local", 2)
+	if err != nil {
+		t.Fatalf("GetSemanticQueries: %v", err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("got %d queries, want the limit of 2", len(queries))
+	}
+	if !reflect.DeepEqual(queries[0].Embedding, similarTo(0.6)) {
+		t.Errorf("embedding = %v, want %v", queries[0].Embedding, similarTo(0.6))
+	}
+}
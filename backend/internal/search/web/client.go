@@ -3,44 +3,101 @@ package web
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
 	"go.uber.org/zap"
 
+	"github.com/aws-agent/backend/internal/cache/redis"
+	"github.com/aws-agent/backend/internal/ingestion"
 	"github.com/aws-agent/backend/internal/llm"
+	"github.com/aws-agent/backend/internal/metrics"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
 	"github.com/aws-agent/backend/pkg/circuitbreaker"
 	"github.com/aws-agent/backend/pkg/logger"
 	"github.com/aws-agent/backend/pkg/retry"
+	"github.com/aws-agent/backend/pkg/utils"
 )
 
 type Client struct {
-	serpAPIKey  string
-	llmClient   *llm.Client
-	httpClient  *http.Client
-	cb          *circuitbreaker.CircuitBreaker
-	retryConfig retry.Config
+	serpAPIKey   string
+	cfg          Config
+	llmClient    *llm.Client
+	db           *sqlite.Client
+	ingestQueue  IngestQueue
+	cache        *redis.Client
+	cacheTTL     time.Duration
+	httpClient   *http.Client
+	scrapeClient *http.Client
+	robots       *robotsCache
+	cb           *circuitbreaker.CircuitBreaker
+	retryConfig  retry.Config
 }
 
+// IngestQueue is the part of the ingestion job queue that auto-ingest
+// enqueues web results through.
+type IngestQueue interface {
+	EnqueueAllowed(url string) error
+}
+
+type Config struct {
+	SerpAPIKey      string
+	Timeout         time.Duration
+	ScrapeTimeout   time.Duration
+	MaxScrapeBytes  int64
+	MaxScrapeChars  int
+	MaxContextChars int
+	AutoIngest      bool
+	AllowedDomains  []string
+}
+
+var errUnsupportedContentType = errors.New("unsupported content type")
+
 type SearchResult struct {
 	Title   string
 	URL     string
 	Snippet string
 	Content string
+	Stored  bool
 }
 
-func NewClient(serpAPIKey string, llmClient *llm.Client) *Client {
+func NewClient(cfg Config, llmClient *llm.Client, db *sqlite.Client) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	// A slow page should cost its own result, not the whole search.
+	if cfg.ScrapeTimeout <= 0 || cfg.ScrapeTimeout >= cfg.Timeout {
+		cfg.ScrapeTimeout = cfg.Timeout / 2
+	}
+	if cfg.MaxScrapeBytes <= 0 {
+		cfg.MaxScrapeBytes = 1 << 20
+	}
+	if cfg.MaxScrapeChars <= 0 {
+		cfg.MaxScrapeChars = 5000
+	}
+	if cfg.MaxContextChars <= 0 {
+		cfg.MaxContextChars = 8000
+	}
+	if len(cfg.AllowedDomains) == 0 {
+		cfg.AllowedDomains = defaultAllowedDomains
+	}
+
 	cb := circuitbreaker.NewCircuitBreaker("web_search", circuitbreaker.Config{
 		MaxRequests:      3,
 		Interval:         time.Minute,
 		Timeout:          15 * time.Second,
 		FailureThreshold: 5,
 		SuccessThreshold: 2,
+		OnStateChange:    metrics.RecordCircuitBreakerState,
 		Logger:           logger.GetLogger(),
 	})
 
@@ -53,31 +110,134 @@ func NewClient(serpAPIKey string, llmClient *llm.Client) *Client {
 		Logger:         logger.GetLogger(),
 	}
 
-	return &Client{
-		serpAPIKey: serpAPIKey,
+	c := &Client{
+		serpAPIKey: cfg.SerpAPIKey,
+		cfg:        cfg,
 		llmClient:  llmClient,
+		db:         db,
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout: cfg.Timeout,
 		},
+		robots:      newRobotsCache(),
 		cb:          cb,
 		retryConfig: retryConfig,
 	}
+	c.scrapeClient = c.newScrapeClient()
+
+	return c
+}
+
+func (c *Client) WithAutoIngest(queue IngestQueue) *Client {
+	c.ingestQueue = queue
+	return c
+}
+
+func (c *Client) WithCache(cache *redis.Client, ttl time.Duration) *Client {
+	c.cache = cache
+	c.cacheTTL = ttl
+	return c
 }
 
 func (c *Client) Search(ctx context.Context, query string, maxResults int) ([]SearchResult, error) {
 	logger.Info("Performing web search", zap.String("query", query))
 
-	optimizedQuery, err := c.optimizeQuery(ctx, query)
-	if err != nil {
-		logger.Warn("Failed to optimize query, using original", zap.Error(err))
-		optimizedQuery = query
+	optimizedQuery := query
+	if llm.AcquireCall(ctx, "web_query_optimization") {
+		optimized, err := c.optimizeQuery(ctx, query)
+		if err != nil {
+			logger.Warn("Failed to optimize query, using original", zap.Error(err))
+		} else {
+			optimizedQuery = optimized
+		}
 	}
 
+	cacheKey := utils.HashString(fmt.Sprintf("%s:%d", strings.ToLower(optimizedQuery), maxResults))
+	if results, ok := c.getCachedResults(ctx, cacheKey); ok {
+		return results, nil
+	}
+
+	startTime := time.Now()
+	backend := "google"
+
+	var results []SearchResult
+	var err error
 	if c.serpAPIKey != "" {
-		return c.searchWithSerpAPI(ctx, optimizedQuery, maxResults)
+		backend = "serpapi"
+		results, err = c.searchWithSerpAPI(ctx, optimizedQuery, maxResults)
+	} else {
+		results, err = c.searchWithGoogle(ctx, optimizedQuery, maxResults)
+	}
+
+	metrics.WebSearchDuration.WithLabelValues(backend).Observe(time.Since(startTime).Seconds())
+
+	status := "success"
+	switch {
+	case err != nil:
+		status = "error"
+	case len(results) == 0:
+		status = "empty"
+	}
+	metrics.WebSearchRequests.WithLabelValues(backend, status).Inc()
+
+	if err == nil {
+		c.setCachedResults(ctx, cacheKey, results)
+		c.autoIngest(results)
+	}
+
+	return results, err
+}
+
+func (c *Client) getCachedResults(ctx context.Context, key string) ([]SearchResult, bool) {
+	if c.cache == nil {
+		return nil, false
+	}
+
+	var results []SearchResult
+	found, err := c.cache.GetWebSearch(ctx, key, &results)
+	if err != nil {
+		logger.Warn("Web search cache lookup failed", zap.Error(err))
+	}
+	if err != nil || !found {
+		metrics.CacheMisses.WithLabelValues("web_search").Inc()
+		return nil, false
 	}
 
-	return c.searchWithGoogle(ctx, optimizedQuery, maxResults)
+	metrics.CacheHits.WithLabelValues("web_search").Inc()
+	return results, true
+}
+
+func (c *Client) setCachedResults(ctx context.Context, key string, results []SearchResult) {
+	if c.cache == nil || c.cacheTTL <= 0 || len(results) == 0 {
+		return
+	}
+
+	if err := c.cache.SetWebSearch(ctx, key, results, c.cacheTTL); err != nil {
+		logger.Warn("Failed to cache web search results", zap.Error(err))
+	}
+}
+
+func (c *Client) autoIngest(results []SearchResult) {
+	if !c.cfg.AutoIngest || c.ingestQueue == nil {
+		return
+	}
+
+	for _, result := range results {
+		if result.Stored || result.Content == "" || result.Content == result.Snippet {
+			continue
+		}
+
+		err := c.ingestQueue.EnqueueAllowed(result.URL)
+		if errors.Is(err, ingestion.ErrURLNotAllowed) {
+			logger.Debug("Skipping auto-ingest for disallowed URL", zap.String("url", result.URL))
+			continue
+		}
+		if err != nil {
+			logger.Warn("Failed to enqueue web result for ingestion", zap.String("url", result.URL), zap.Error(err))
+			return
+		}
+
+		logger.Info("Web result enqueued for ingestion", zap.String("url", result.URL))
+	}
 }
 
 func (c *Client) optimizeQuery(ctx context.Context, query string) (string, error) {
@@ -118,7 +278,12 @@ func (c *Client) searchWithSerpAPI(ctx context.Context, query string, maxResults
 	params.Add("api_key", c.serpAPIKey)
 	params.Add("num", fmt.Sprintf("%d", maxResults))
 
-	resp, err := c.httpClient.Get(fmt.Sprintf("%s?%s", baseURL, params.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s?%s", baseURL, params.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search: %w", err)
 	}
@@ -148,18 +313,11 @@ func (c *Client) searchWithSerpAPI(ctx context.Context, query string, maxResults
 
 	results := make([]SearchResult, 0, len(searchResp.OrganicResults))
 	for _, r := range searchResp.OrganicResults {
-		content, err := c.scrapeContent(r.Link)
-		if err != nil {
-			logger.Warn("Failed to scrape content", zap.String("url", r.Link), zap.Error(err))
-			content = r.Snippet
+		if !c.isAllowedURL(r.Link) {
+			logger.Debug("Skipping web result outside allowed domains", zap.String("url", r.Link))
+			continue
 		}
-
-		results = append(results, SearchResult{
-			Title:   r.Title,
-			URL:     r.Link,
-			Snippet: r.Snippet,
-			Content: content,
-		})
+		results = append(results, c.buildResult(ctx, r.Title, r.Link, r.Snippet))
 	}
 
 	logger.Info("Web search completed", zap.Int("results", len(results)))
@@ -200,17 +358,11 @@ func (c *Client) searchWithGoogle(ctx context.Context, query string, maxResults
 		snippet := s.Find("div.VwiC3b").Text()
 
 		if title != "" && link != "" {
-			content, err := c.scrapeContent(link)
-			if err != nil {
-				content = snippet
+			if !c.isAllowedURL(link) {
+				logger.Debug("Skipping web result outside allowed domains", zap.String("url", link))
+				return
 			}
-
-			results = append(results, SearchResult{
-				Title:   title,
-				URL:     link,
-				Snippet: snippet,
-				Content: content,
-			})
+			results = append(results, c.buildResult(ctx, title, link, snippet))
 		}
 	})
 
@@ -219,27 +371,147 @@ func (c *Client) searchWithGoogle(ctx context.Context, query string, maxResults
 	return results, nil
 }
 
-func (c *Client) scrapeContent(urlStr string) (string, error) {
-	resp, err := c.httpClient.Get(urlStr)
+func (c *Client) buildResult(ctx context.Context, title, link, snippet string) SearchResult {
+	result := SearchResult{
+		Title:   title,
+		URL:     link,
+		Snippet: snippet,
+	}
+
+	if doc := c.storedDocument(link); doc != nil {
+		result.Stored = true
+		result.Content = doc.RawContent
+		if result.Content == "" {
+			result.Content = doc.Summary
+		}
+		result.Content = utils.TruncateRunes(result.Content, c.cfg.MaxScrapeChars)
+		if doc.Title != "" {
+			result.Title = doc.Title
+		}
+		logger.Debug("Using stored document for web result", zap.String("url", link), zap.String("doc_id", doc.ID))
+		return result
+	}
+
+	content, err := c.scrapeContent(ctx, link)
+	switch {
+	case errors.Is(err, errDisallowedByRobots):
+		logger.Debug("Not scraping page disallowed by robots.txt", zap.String("url", link))
+		content = snippet
+	case err != nil:
+		logger.Warn("Failed to scrape content", zap.String("url", link), zap.Error(err))
+		content = snippet
+	}
+	result.Content = content
+
+	return result
+}
+
+func (c *Client) storedDocument(link string) *models.Document {
+	if c.db == nil {
+		return nil
+	}
+
+	doc, found, err := c.db.GetDocumentByURL(link)
 	if err != nil {
+		logger.Warn("Failed to look up stored document", zap.String("url", link), zap.Error(err))
+		return nil
+	}
+	if !found {
+		return nil
+	}
+
+	return doc
+}
+
+// scrapeContent fetches the page text, reading at most MaxScrapeBytes of
+// the body within ScrapeTimeout. Pages off the allowlist or disallowed by
+// robots.txt are not fetched, and non-text responses are skipped.
+func (c *Client) scrapeContent(ctx context.Context, urlStr string) (string, error) {
+	if !c.isAllowedURL(urlStr) {
+		return "", errURLNotAllowed
+	}
+	target, err := url.Parse(urlStr)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse url: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.ScrapeTimeout)
+	defer cancel()
+
+	if err := c.robotsAllowed(ctx, target); err != nil {
 		return "", err
 	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", scraperUserAgent)
+
+	resp, err := c.scrapeClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch page: %w", err)
+	}
 	defer resp.Body.Close()
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("page returned status %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !isTextContent(contentType) {
+		return "", fmt.Errorf("%w: %s", errUnsupportedContentType, contentType)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, c.cfg.MaxScrapeBytes))
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
 	doc.Find("script, style, nav, footer, header").Remove()
 	text := doc.Find("body").Text()
 	text = strings.TrimSpace(text)
 
-	if len(text) > 5000 {
-		text = text[:5000]
+	return utils.TruncateRunes(text, c.cfg.MaxScrapeChars), nil
+}
+
+// isTextContent reports whether a page can be scraped for text. A missing
+// header is allowed, since many servers omit it for HTML.
+func isTextContent(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/xhtml+xml"
+}
+
+func (c *Client) FormatContext(results []SearchResult) string {
+	if len(results) == 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+	builder.WriteString("\nWeb Search Results:\n")
+
+	remaining := c.cfg.MaxContextChars
+	for i, result := range results {
+		header := fmt.Sprintf("\n[Web %d]: %s\nURL: %s\n", i+1, result.Title, result.URL)
+		available := remaining - utf8.RuneCountInString(header)
+		if available <= 0 {
+			logger.Debug("Web context budget exhausted", zap.Int("included", i), zap.Int("total", len(results)))
+			break
+		}
+
+		content := utils.TruncateRunes(result.Content, available)
+		builder.WriteString(header)
+		builder.WriteString(content)
+		builder.WriteString("\n")
+
+		remaining = available - utf8.RuneCountInString(content)
 	}
 
-	return text, nil
+	return builder.String()
 }
 
 func (c *Client) ShouldTriggerWebSearch(kgResultsCount, vectorResultsCount int, confidence float64) bool {
@@ -0,0 +1,411 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+	"github.com/aws-agent/backend/internal/ingestion"
+	"github.com/aws-agent/backend/internal/llm/llmtest"
+	"github.com/aws-agent/backend/internal/metrics"
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func stubResponse(status int, contentType, body string) *http.Response {
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// newStubClient returns a client whose search and scrape requests are all
+// answered by transport instead of the network.
+func newStubClient(cfg Config, transport roundTripFunc) *Client {
+	c := NewClient(cfg, llmtest.NewClient(&llmtest.Provider{}), nil)
+	c.httpClient.Transport = transport
+	c.scrapeClient.Transport = transport
+	return c
+}
+
+func sampleCount(t *testing.T, histogram prometheus.Observer) uint64 {
+	t.Helper()
+
+	metric, ok := histogram.(prometheus.Metric)
+	if !ok {
+		t.Fatalf("%T is not a metric", histogram)
+	}
+	var out dto.Metric
+	if err := metric.Write(&out); err != nil {
+		t.Fatalf("write metric: %v", err)
+	}
+	return out.GetHistogram().GetSampleCount()
+}
+
+func TestSearchRecordsMetrics(t *testing.T) {
+	const serpResults = `{"organic_results": [{"title": "Lambda timeouts", "link": "https://docs.aws.amazon.com/lambda/timeouts.html", "snippet": "Raise the timeout"}]}`
+
+	tests := []struct {
+		name       string
+		serpAPIKey string
+		backend    string
+		status     string
+		transport  roundTripFunc
+	}{
+		{
+			name:       "serpapi success",
+			serpAPIKey: "key",
+			backend:    "serpapi",
+			status:     "success",
+			transport: func(req *http.Request) (*http.Response, error) {
+				switch {
+				case req.URL.Host == "serpapi.com":
+					return stubResponse(http.StatusOK, "application/json", serpResults), nil
+				case req.URL.Path == "/robots.txt":
+					return stubResponse(http.StatusNotFound, "", ""), nil
+				}
+				return stubResponse(http.StatusOK, "text/html", "<html><body>Raise the function timeout.</body></html>"), nil
+			},
+		},
+		{
+			name:       "serpapi error",
+			serpAPIKey: "key",
+			backend:    "serpapi",
+			status:     "error",
+			transport: func(req *http.Request) (*http.Response, error) {
+				return stubResponse(http.StatusInternalServerError, "", ""), nil
+			},
+		},
+		{
+			name:    "google empty",
+			backend: "google",
+			status:  "empty",
+			transport: func(req *http.Request) (*http.Response, error) {
+				return stubResponse(http.StatusOK, "text/html", "<html><body>No results</body></html>"), nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStubClient(Config{SerpAPIKey: tt.serpAPIKey}, tt.transport)
+			requests := metrics.WebSearchRequests.WithLabelValues(tt.backend, tt.status)
+			duration := metrics.WebSearchDuration.WithLabelValues(tt.backend)
+			beforeRequests := testutil.ToFloat64(requests)
+			beforeDuration := sampleCount(t, duration)
+
+			results, err := c.Search(context.Background(), "lambda timeout", 5)
+			if (err != nil) != (tt.status == "error") {
+				t.Fatalf("Search error = %v, want error only for status %q", err, tt.status)
+			}
+			if tt.status == "success" && (len(results) != 1 || !strings.Contains(results[0].Content, "function timeout")) {
+				t.Errorf("results = %+v, want the scraped page", results)
+			}
+
+			if got := testutil.ToFloat64(requests) - beforeRequests; got != 1 {
+				t.Errorf("%s/%s requests grew by %v, want 1", tt.backend, tt.status, got)
+			}
+			if got := sampleCount(t, duration) - beforeDuration; got != 1 {
+				t.Errorf("%s duration observations grew by %d, want 1", tt.backend, got)
+			}
+		})
+	}
+}
+
+func TestScrapeContentHonoursMaxScrapeChars(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("Lambda ⚡ timeout ", 100) + "</body></html>"
+	c := newStubClient(Config{MaxScrapeChars: 20}, func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/robots.txt" {
+			return stubResponse(http.StatusNotFound, "", ""), nil
+		}
+		return stubResponse(http.StatusOK, "text/html", page), nil
+	})
+
+	content, err := c.scrapeContent(context.Background(), "https://docs.aws.amazon.com/lambda/timeouts.html")
+	if err != nil {
+		t.Fatalf("scrapeContent: %v", err)
+	}
+	if content != "Lambda ⚡ timeout Lam" {
+		t.Errorf("content = %q, want the first 20 characters", content)
+	}
+}
+
+func TestSearchPrefersStoredDocuments(t *testing.T) {
+	const storedURL = "https://docs.aws.amazon.com/lambda/timeouts.html"
+
+	db, err := sqlite.NewClient(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+	if err := db.InsertDocument(&models.Document{
+		ID:         "doc-1",
+		URL:        storedURL,
+		Title:      "Configuring Lambda function timeout",
+		Summary:    "How to set the timeout.",
+		RawContent: "The ingested guide to Lambda timeouts.",
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}); err != nil {
+		t.Fatalf("insert document: %v", err)
+	}
+
+	c := NewClient(Config{SerpAPIKey: "key"}, llmtest.NewClient(&llmtest.Provider{}), db)
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "serpapi.com" {
+			return stubResponse(http.StatusOK, "application/json",
+				`{"organic_results": [{"title": "Lambda timeouts", "link": "`+storedURL+`", "snippet": "Raise the timeout"}]}`), nil
+		}
+		t.Errorf("fetched %s, want the stored document used instead of scraping", req.URL)
+		return stubResponse(http.StatusOK, "text/html", "<html><body>Scraped page</body></html>"), nil
+	})
+	c.httpClient.Transport = transport
+	c.scrapeClient.Transport = transport
+
+	results, err := c.Search(context.Background(), "lambda timeout", 5)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("results = %+v, want one", results)
+	}
+	result := results[0]
+	if !result.Stored || result.Content != "The ingested guide to Lambda timeouts." || result.Title != "Configuring Lambda function timeout" {
+		t.Errorf("result = %+v, want the stored document's title and content", result)
+	}
+}
+
+// fakeIngestQueue records enqueued URLs, refusing those outside allowed.
+type fakeIngestQueue struct {
+	allowed  string
+	mu       sync.Mutex
+	enqueued []string
+}
+
+func (q *fakeIngestQueue) EnqueueAllowed(url string) error {
+	if !strings.HasPrefix(url, q.allowed) {
+		return ingestion.ErrURLNotAllowed
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.enqueued = append(q.enqueued, url)
+	return nil
+}
+
+func TestSearchAutoIngestsScrapedResults(t *testing.T) {
+	const serpResults = `{"organic_results": [
+		{"title": "Timeouts", "link": "https://docs.aws.amazon.com/lambda/timeouts.html", "snippet": "Raise the timeout"},
+		{"title": "Broken", "link": "https://docs.aws.amazon.com/lambda/broken.html", "snippet": "Unavailable page"},
+		{"title": "Answer", "link": "https://repost.aws/questions/lambda-timeout", "snippet": "Community answer"}
+	]}`
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.URL.Host == "serpapi.com":
+			return stubResponse(http.StatusOK, "application/json", serpResults), nil
+		case req.URL.Path == "/robots.txt":
+			return stubResponse(http.StatusNotFound, "", ""), nil
+		case strings.HasSuffix(req.URL.Path, "broken.html"):
+			return stubResponse(http.StatusInternalServerError, "", ""), nil
+		}
+		return stubResponse(http.StatusOK, "text/html", "<html><body>Full page text.</body></html>"), nil
+	})
+
+	tests := []struct {
+		name       string
+		autoIngest bool
+		want       []string
+	}{
+		// The broken page falls back to its snippet and repost.aws is
+		// outside the ingestion allowlist, so only one page qualifies.
+		{name: "enabled", autoIngest: true, want: []string{"https://docs.aws.amazon.com/lambda/timeouts.html"}},
+		{name: "disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := &fakeIngestQueue{allowed: "https://docs.aws.amazon.com/"}
+			c := newStubClient(Config{SerpAPIKey: "key", AutoIngest: tt.autoIngest}, transport).WithAutoIngest(queue)
+
+			if _, err := c.Search(context.Background(), "lambda timeout", 5); err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if strings.Join(queue.enqueued, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("enqueued %v, want %v", queue.enqueued, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchServesRepeatsFromCache(t *testing.T) {
+	cache, _ := redistest.NewClient(t)
+	searches := 0
+	c := newStubClient(Config{SerpAPIKey: "key"}, func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.URL.Host == "serpapi.com":
+			searches++
+			return stubResponse(http.StatusOK, "application/json",
+				`{"organic_results": [{"title": "Timeouts", "link": "https://docs.aws.amazon.com/lambda/timeouts.html", "snippet": "Raise the timeout"}]}`), nil
+		case req.URL.Path == "/robots.txt":
+			return stubResponse(http.StatusNotFound, "", ""), nil
+		}
+		return stubResponse(http.StatusOK, "text/html", "<html><body>Raise the function timeout.</body></html>"), nil
+	}).WithCache(cache, time.Minute)
+	ctx := context.Background()
+
+	first, err := c.Search(ctx, "lambda timeout", 5)
+	if err != nil {
+		t.Fatalf("first search: %v", err)
+	}
+	second, err := c.Search(ctx, "lambda timeout", 5)
+	if err != nil {
+		t.Fatalf("second search: %v", err)
+	}
+
+	if searches != 1 {
+		t.Errorf("backend searched %d times, want the repeat served from cache", searches)
+	}
+	if len(second) != 1 || second[0].URL != first[0].URL || second[0].Content != first[0].Content {
+		t.Errorf("cached results = %+v, want %+v", second, first)
+	}
+
+	if _, err := c.Search(ctx, "lambda timeout", 3); err != nil {
+		t.Fatalf("third search: %v", err)
+	}
+	if searches != 2 {
+		t.Errorf("backend searched %d times, want a different result count to miss the cache", searches)
+	}
+}
+
+// countingReader is an endless page body that records how much was read.
+type countingReader struct {
+	mu   sync.Mutex
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	r.mu.Lock()
+	r.read += int64(len(p))
+	r.mu.Unlock()
+	return len(p), nil
+}
+
+func (r *countingReader) bytesRead() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.read
+}
+
+func TestScrapeContentCapsBytesRead(t *testing.T) {
+	body := &countingReader{}
+	c := newStubClient(Config{MaxScrapeBytes: 64 << 10, MaxScrapeChars: 100}, func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/robots.txt" {
+			return stubResponse(http.StatusNotFound, "", ""), nil
+		}
+		resp := stubResponse(http.StatusOK, "text/html", "")
+		resp.Body = io.NopCloser(io.MultiReader(strings.NewReader("<html><body>"), body))
+		return resp, nil
+	})
+
+	content, err := c.scrapeContent(context.Background(), "https://docs.aws.amazon.com/lambda/huge.html")
+	if err != nil {
+		t.Fatalf("scrapeContent: %v", err)
+	}
+	if content != strings.Repeat("a", 100) {
+		t.Errorf("content = %d characters, want the first 100", len(content))
+	}
+	// The parser reads in blocks, so allow one extra buffer past the cap.
+	if got := body.bytesRead(); got > 64<<10+32<<10 {
+		t.Errorf("read %d bytes of the page, want at most about %d", got, 64<<10)
+	}
+}
+
+func TestScrapeContentTimesOutSlowPages(t *testing.T) {
+	c := newStubClient(Config{Timeout: 2 * time.Second, ScrapeTimeout: 50 * time.Millisecond}, func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/robots.txt" {
+			return stubResponse(http.StatusNotFound, "", ""), nil
+		}
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+
+	start := time.Now()
+	_, err := c.scrapeContent(context.Background(), "https://docs.aws.amazon.com/lambda/slow.html")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the scrape deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slow page took %v, want it cut off by the scrape timeout", elapsed)
+	}
+
+	// A canceled search stops its scrapes too.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.scrapeContent(ctx, "https://docs.aws.amazon.com/lambda/other.html"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v with a canceled context, want context.Canceled", err)
+	}
+}
+
+func TestNewClientKeepsScrapeTimeoutBelowSearchTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		cfg  Config
+		want time.Duration
+	}{
+		{Config{Timeout: 10 * time.Second, ScrapeTimeout: 3 * time.Second}, 3 * time.Second},
+		{Config{Timeout: 10 * time.Second}, 5 * time.Second},
+		{Config{Timeout: 10 * time.Second, ScrapeTimeout: 20 * time.Second}, 5 * time.Second},
+	} {
+		if got := NewClient(tt.cfg, nil, nil).cfg.ScrapeTimeout; got != tt.want {
+			t.Errorf("NewClient(%+v) scrape timeout = %v, want %v", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestScrapeContentSkipsNonTextPages(t *testing.T) {
+	for contentType, wantErr := range map[string]bool{
+		"application/pdf":          true,
+		"image/png":                true,
+		"text/html; charset=utf-8": false,
+		"text/plain":               false,
+		"":                         false,
+	} {
+		c := newStubClient(Config{}, func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/robots.txt" {
+				return stubResponse(http.StatusNotFound, "", ""), nil
+			}
+			return stubResponse(http.StatusOK, contentType, "<html><body>Lambda</body></html>"), nil
+		})
+
+		_, err := c.scrapeContent(context.Background(), "https://docs.aws.amazon.com/lambda/page")
+		if got := errors.Is(err, errUnsupportedContentType); got != wantErr {
+			t.Errorf("content type %q: err = %v, want unsupported %v", contentType, err, wantErr)
+		}
+	}
+}
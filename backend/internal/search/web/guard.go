@@ -0,0 +1,50 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws-agent/backend/pkg/netguard"
+)
+
+var (
+	errURLNotAllowed  = errors.New("url is not in the allowed search domains")
+	errBlockedAddress = netguard.ErrBlockedAddress
+)
+
+var defaultAllowedDomains = []string{"docs.aws.amazon.com", "repost.aws", "stackoverflow.com"}
+
+const maxScrapeRedirects = 5
+
+// isAllowedURL reports whether a result URL is http(s) on an allowed domain
+// or one of its subdomains.
+func (c *Client) isAllowedURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range c.cfg.AllowedDomains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// newScrapeClient returns the client used to fetch result pages, which only
+// connects to public addresses and follows redirects within the allowlist.
+func (c *Client) newScrapeClient() *http.Client {
+	return netguard.NewClient(netguard.Config{
+		Timeout:      c.cfg.Timeout,
+		DialTimeout:  c.cfg.ScrapeTimeout,
+		MaxRedirects: maxScrapeRedirects,
+		Allowed: func(u *url.URL) bool {
+			return c.isAllowedURL(u.String())
+		},
+	})
+}
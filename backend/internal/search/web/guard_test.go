@@ -0,0 +1,114 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws-agent/backend/pkg/netguard"
+)
+
+func TestIsAllowedURL(t *testing.T) {
+	c := NewClient(Config{}, nil, nil)
+
+	for rawURL, want := range map[string]bool{
+		"https://docs.aws.amazon.com/lambda/latest/dg/welcome.html": true,
+		"https://repost.aws/questions/123":                          true,
+		"http://stackoverflow.com/questions/1":                      true,
+		"https://DOCS.AWS.AMAZON.COM/s3/":                           true,
+		"https://evil.example.com/docs.aws.amazon.com":              false,
+		"https://docs.aws.amazon.com.evil.example.com/":             false,
+		"https://notrepost.aws/":                                    false,
+		"ftp://docs.aws.amazon.com/file":                            false,
+		"http://169.254.169.254/latest/meta-data/":                  false,
+		"not a url": false,
+	} {
+		if got := c.isAllowedURL(rawURL); got != want {
+			t.Errorf("isAllowedURL(%q) = %v, want %v", rawURL, got, want)
+		}
+	}
+
+	custom := NewClient(Config{AllowedDomains: []string{"example.org"}}, nil, nil)
+	if !custom.isAllowedURL("https://wiki.example.org/page") || custom.isAllowedURL("https://docs.aws.amazon.com/") {
+		t.Error("configured allowlist did not replace the default")
+	}
+}
+
+func TestSearchSkipsResultsOutsideAllowlist(t *testing.T) {
+	const serpResults = `{"organic_results": [
+		{"title": "Lambda timeouts", "link": "https://docs.aws.amazon.com/lambda/timeouts.html", "snippet": "Raise the timeout"},
+		{"title": "Metadata", "link": "http://169.254.169.254/latest/meta-data/", "snippet": "credentials"},
+		{"title": "Blog", "link": "https://blog.example.com/lambda", "snippet": "a blog"}
+	]}`
+
+	var mu sync.Mutex
+	var fetched []string
+	c := newStubClient(Config{SerpAPIKey: "key"}, func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "serpapi.com" {
+			return stubResponse(http.StatusOK, "application/json", serpResults), nil
+		}
+		mu.Lock()
+		fetched = append(fetched, req.URL.String())
+		mu.Unlock()
+		if req.URL.Path == "/robots.txt" {
+			return stubResponse(http.StatusNotFound, "", ""), nil
+		}
+		return stubResponse(http.StatusOK, "text/html", "<html><body>Raise the function timeout.</body></html>"), nil
+	})
+
+	results, err := c.Search(context.Background(), "lambda timeout", 5)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 1 || results[0].URL != "https://docs.aws.amazon.com/lambda/timeouts.html" {
+		t.Errorf("results = %+v, want only the allowed result", results)
+	}
+	for _, u := range fetched {
+		if !strings.HasPrefix(u, "https://docs.aws.amazon.com/") {
+			t.Errorf("fetched %s outside the allowlist", u)
+		}
+	}
+}
+
+func TestScrapeContentBlocksPrivateAddresses(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("<html><body>internal</body></html>"))
+	}))
+	defer server.Close()
+
+	// Even an allowlisted name must not reach a loopback address.
+	c := NewClient(Config{AllowedDomains: []string{"127.0.0.1"}}, nil, nil)
+	_, err := c.scrapeContent(context.Background(), server.URL+"/admin")
+	if !errors.Is(err, errBlockedAddress) {
+		t.Errorf("err = %v, want the private address blocked", err)
+	}
+	if hits != 0 {
+		t.Errorf("private server received %d requests", hits)
+	}
+}
+
+func TestScrapeContentRefusesRedirectsOffAllowlist(t *testing.T) {
+	c := newStubClient(Config{}, func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.URL.Path == "/robots.txt":
+			return stubResponse(http.StatusNotFound, "", ""), nil
+		case req.URL.Host == "docs.aws.amazon.com":
+			resp := stubResponse(http.StatusFound, "", "")
+			resp.Header.Set("Location", "http://169.254.169.254/latest/meta-data/")
+			return resp, nil
+		}
+		t.Errorf("followed redirect to %s", req.URL)
+		return stubResponse(http.StatusOK, "text/html", "<html><body>secret</body></html>"), nil
+	})
+
+	_, err := c.scrapeContent(context.Background(), "https://docs.aws.amazon.com/lambda/moved.html")
+	if !errors.Is(err, netguard.ErrRedirectNotAllowed) {
+		t.Errorf("err = %v, want the redirect refused", err)
+	}
+}
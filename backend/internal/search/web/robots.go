@@ -0,0 +1,207 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	scraperUserAgent = "aws-agent"
+	robotsCacheTTL   = time.Hour
+	maxRobotsBytes   = 512 * 1024
+)
+
+var errDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+type robotsEntry struct {
+	rules   []robotsRule
+	expires time.Time
+}
+
+// robotsCache keeps the parsed robots.txt rules for each scraped host.
+type robotsCache struct {
+	mu      sync.Mutex
+	entries map[string]robotsEntry
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{
+		entries: make(map[string]robotsEntry),
+	}
+}
+
+// robotsAllowed checks target against its host's robots.txt. A missing
+// robots.txt allows everything; one that cannot be fetched blocks the host
+// until the cached result expires.
+func (c *Client) robotsAllowed(ctx context.Context, target *url.URL) error {
+	origin := target.Scheme + "://" + target.Host
+
+	c.robots.mu.Lock()
+	entry, ok := c.robots.entries[origin]
+	c.robots.mu.Unlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		rules, err := c.fetchRobots(ctx, origin)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, errBlockedAddress) {
+				return err
+			}
+			rules = []robotsRule{{allow: false, pattern: regexp.MustCompile("^/")}}
+		}
+		entry = robotsEntry{rules: rules, expires: time.Now().Add(robotsCacheTTL)}
+
+		c.robots.mu.Lock()
+		c.robots.entries[origin] = entry
+		c.robots.mu.Unlock()
+	}
+
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+
+	if !robotsPathAllowed(entry.rules, path) {
+		return errDisallowedByRobots
+	}
+	return nil
+}
+
+func (c *Client) fetchRobots(ctx context.Context, origin string) ([]robotsRule, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", scraperUserAgent)
+
+	resp, err := c.scrapeClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch robots.txt: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("robots.txt returned status %d", resp.StatusCode)
+	case resp.StatusCode >= 400:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("robots.txt returned status %d", resp.StatusCode)
+	}
+
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsBytes), scraperUserAgent), nil
+}
+
+// parseRobots returns the rules of the group naming agent, or of the "*"
+// group if none does.
+func parseRobots(r io.Reader, agent string) []robotsRule {
+	var (
+		specific, wildcard   []robotsRule
+		matchesAgent, isStar bool
+		inAgentLines         bool
+		foundSpecific        bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgentLines {
+				matchesAgent, isStar = false, false
+			}
+			inAgentLines = true
+			name := strings.ToLower(value)
+			if name == "*" {
+				isStar = true
+			} else if name == agent {
+				matchesAgent = true
+				foundSpecific = true
+			}
+		case "allow", "disallow":
+			inAgentLines = false
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{
+				allow:   key == "allow",
+				length:  len(value),
+				pattern: robotsPattern(value),
+			}
+			if matchesAgent {
+				specific = append(specific, rule)
+			}
+			if isStar {
+				wildcard = append(wildcard, rule)
+			}
+		default:
+			inAgentLines = false
+		}
+	}
+
+	if foundSpecific {
+		return specific
+	}
+	return wildcard
+}
+
+// robotsPattern compiles a path rule, where "*" matches any run of
+// characters and a trailing "$" anchors the end.
+func robotsPattern(value string) *regexp.Regexp {
+	anchored := strings.HasSuffix(value, "$")
+	value = strings.TrimSuffix(value, "$")
+
+	parts := strings.Split(value, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsPathAllowed applies the longest matching rule, preferring allow on
+// a tie.
+func robotsPathAllowed(rules []robotsRule, path string) bool {
+	allowed := true
+	longest := -1
+	for _, rule := range rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > longest || (rule.length == longest && rule.allow) {
+			allowed = rule.allow
+			longest = rule.length
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testRobots = `# robots.txt
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+
+User-agent: otherbot
+Disallow: /
+`
+
+func TestRobotsPathAllowed(t *testing.T) {
+	rules := parseRobots(strings.NewReader(testRobots), scraperUserAgent)
+
+	for path, want := range map[string]bool{
+		"/lambda/guide.html":      true,
+		"/private/keys.html":      false,
+		"/private/public.html":    true,
+		"/files/guide.pdf":        false,
+		"/files/guide.pdf?x=1":    true,
+		"/":                       true,
+		"/privately-owned/a.html": true,
+	} {
+		if got := robotsPathAllowed(rules, path); got != want {
+			t.Errorf("robotsPathAllowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	// A group naming the scraper replaces the wildcard group.
+	specific := parseRobots(strings.NewReader(testRobots+"\nUser-agent: aws-agent\nDisallow: /lambda/\n"), scraperUserAgent)
+	if robotsPathAllowed(specific, "/lambda/guide.html") || !robotsPathAllowed(specific, "/private/keys.html") {
+		t.Errorf("rules = %+v, want only the aws-agent group applied", specific)
+	}
+}
+
+func TestScrapeContentHonoursRobots(t *testing.T) {
+	robotsFetches := 0
+	c := newStubClient(Config{}, func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/robots.txt" {
+			robotsFetches++
+			return stubResponse(http.StatusOK, "text/plain", testRobots), nil
+		}
+		return stubResponse(http.StatusOK, "text/html", "<html><body>Lambda guide</body></html>"), nil
+	})
+	ctx := context.Background()
+
+	if _, err := c.scrapeContent(ctx, "https://docs.aws.amazon.com/private/keys.html"); !errors.Is(err, errDisallowedByRobots) {
+		t.Errorf("disallowed page err = %v, want errDisallowedByRobots", err)
+	}
+	content, err := c.scrapeContent(ctx, "https://docs.aws.amazon.com/lambda/guide.html")
+	if err != nil || content != "Lambda guide" {
+		t.Errorf("allowed page = %q, %v", content, err)
+	}
+	if robotsFetches != 1 {
+		t.Errorf("robots.txt fetched %d times, want once per host", robotsFetches)
+	}
+}
+
+func TestScrapeContentBlocksHostWhenRobotsFails(t *testing.T) {
+	c := newStubClient(Config{}, func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/robots.txt" {
+			return stubResponse(http.StatusServiceUnavailable, "", ""), nil
+		}
+		return stubResponse(http.StatusOK, "text/html", "<html><body>Lambda guide</body></html>"), nil
+	})
+
+	if _, err := c.scrapeContent(context.Background(), "https://repost.aws/questions/1"); !errors.Is(err, errDisallowedByRobots) {
+		t.Errorf("err = %v, want the host blocked while robots.txt is unavailable", err)
+	}
+}
@@ -3,16 +3,16 @@ package models
 import "time"
 
 type Document struct {
-	ID           string
-	URL          string
-	Title        string
-	AWSService   string
-	DocType      string
-	Summary      string
-	RawContent   string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	LastScraped  *time.Time
+	ID          string
+	URL         string
+	Title       string
+	AWSService  string
+	DocType     string
+	Summary     string
+	RawContent  string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	LastScraped *time.Time
 }
 
 type DocumentChunk struct {
@@ -24,17 +24,31 @@ type DocumentChunk struct {
 	CreatedAt   time.Time
 }
 
+type ChunkMatch struct {
+	ChunkID    string
+	DocID      string
+	Text       string
+	DocURL     string
+	AWSService string
+	DocType    string
+	Summary    string
+}
+
 type QueryRecord struct {
-	ID                  string
-	UserID              string
-	QueryText           string
-	Response            string
-	Confidence          float64
-	KGResultsCount      int
-	VectorResultsCount  int
-	WebSearchUsed       bool
-	LatencyMS           int
-	CreatedAt           time.Time
+	ID                 string
+	UserID             string
+	QueryText          string
+	Response           string
+	Confidence         float64
+	KGResultsCount     int
+	VectorResultsCount int
+	AvgKGConfidence    float64
+	AvgVectorScore     float64
+	WebSearchUsed      bool
+	WebSearchAllowed   bool
+	LatencyMS          int
+	ConversationID     string
+	CreatedAt          time.Time
 }
 
 type QuerySource struct {
@@ -56,16 +70,70 @@ type Feedback struct {
 }
 
 type EvaluationResult struct {
-	ID                     int
-	QueryID                string
-	RelevanceScore         float64
-	AccuracyScore          float64
-	CompletenessScore      float64
-	CitationScore          float64
-	OverallClassification  string
-	Reasoning              string
-	CosineSimilarity       float64
-	CreatedAt              time.Time
+	ID                    int
+	QueryID               string
+	RelevanceScore        float64
+	AccuracyScore         float64
+	CompletenessScore     float64
+	CitationScore         float64
+	OverallClassification string
+	Reasoning             string
+	CosineSimilarity      float64
+	CreatedAt             time.Time
+}
+
+const (
+	EvaluationRunning   = "running"
+	EvaluationCompleted = "completed"
+	EvaluationFailed    = "failed"
+)
+
+// EvaluationRun is an evaluation dataset run started through the API. The
+// dataset and final report are stored as JSON.
+type EvaluationRun struct {
+	ID          string
+	Status      string
+	Dataset     string
+	Total       int
+	Completed   int
+	Failed      int
+	Report      string
+	Error       string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt *time.Time
+}
+
+type QueryDiagnostics struct {
+	Record      QueryRecord
+	Sources     []QuerySource
+	Evaluations []EvaluationResult
+	Feedback    []Feedback
+}
+
+type ActionPlanRecord struct {
+	ID               string
+	Issue            string
+	PlanJSON         string
+	RiskLevel        string
+	RequiresApproval bool
+	Status           string
+	RequestedBy      string
+	ApprovedBy       string
+	ApprovedAt       time.Time
+	CreatedAt        time.Time
+}
+
+type ActionApprovalRecord struct {
+	ID          string
+	PlanID      string
+	Status      string
+	Requester   string
+	Approver    string
+	ResultsJSON string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	ResolvedAt  time.Time
 }
 
 type KGEntity struct {
@@ -97,6 +165,40 @@ type SeedConcept struct {
 	CreatedAt   time.Time
 }
 
+// CalibrationSample is one feedback verdict joined with the retrieval
+// signals recorded for its query.
+type CalibrationSample struct {
+	KGResultsCount     int
+	VectorResultsCount int
+	AvgKGConfidence    float64
+	AvgVectorScore     float64
+	HasLink            bool
+	Helpful            bool
+}
+
+type ConfidenceCalibration struct {
+	ID        int
+	Bias      float64
+	Weights   []float64
+	Samples   int
+	LogLoss   float64
+	CreatedAt time.Time
+}
+
+// ReindexState is the progress of a vector reindex. Documents are processed
+// in ID order, so LastDocID is where an interrupted run resumes.
+type ReindexState struct {
+	EmbeddingModel string
+	VectorDim      int
+	LastDocID      string
+	TotalDocuments int
+	Documents      int
+	Chunks         int
+	StartedAt      time.Time
+	UpdatedAt      time.Time
+	CompletedAt    *time.Time
+}
+
 type SystemMetric struct {
 	ID          int
 	MetricName  string
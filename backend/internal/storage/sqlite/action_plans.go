@@ -0,0 +1,206 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+)
+
+func (c *Client) InsertActionPlan(plan *models.ActionPlanRecord) error {
+	query := `
+		INSERT INTO action_plans (id, issue, plan_json, risk_level, requires_approval, status, requested_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	requiresApproval := 0
+	if plan.RequiresApproval {
+		requiresApproval = 1
+	}
+
+	_, err := c.db.Exec(
+		query,
+		plan.ID,
+		plan.Issue,
+		plan.PlanJSON,
+		plan.RiskLevel,
+		requiresApproval,
+		plan.Status,
+		plan.RequestedBy,
+		plan.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert action plan: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) GetActionPlan(id string) (*models.ActionPlanRecord, bool, error) {
+	query := `
+		SELECT id, COALESCE(issue, ''), plan_json, COALESCE(risk_level, ''), requires_approval, status,
+			COALESCE(requested_by, ''), COALESCE(approved_by, ''), approved_at, created_at
+		FROM action_plans
+		WHERE id = ?
+	`
+
+	var plan models.ActionPlanRecord
+	var approvedAt sql.NullInt64
+	var createdAt int64
+
+	err := c.db.QueryRow(query, id).Scan(
+		&plan.ID,
+		&plan.Issue,
+		&plan.PlanJSON,
+		&plan.RiskLevel,
+		&plan.RequiresApproval,
+		&plan.Status,
+		&plan.RequestedBy,
+		&plan.ApprovedBy,
+		&approvedAt,
+		&createdAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get action plan: %w", err)
+	}
+
+	if approvedAt.Valid {
+		plan.ApprovedAt = time.Unix(approvedAt.Int64, 0)
+	}
+	plan.CreatedAt = time.Unix(createdAt, 0)
+
+	return &plan, true, nil
+}
+
+// TransitionActionPlan moves a plan from one status to another and reports
+// whether it was still in the expected status, so a plan is only ever
+// claimed for execution once.
+func (c *Client) TransitionActionPlan(id, from, to string) (bool, error) {
+	result, err := c.db.Exec(`UPDATE action_plans SET status = ? WHERE id = ? AND status = ?`, to, id, from)
+	if err != nil {
+		return false, fmt.Errorf("failed to update action plan status: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update action plan status: %w", err)
+	}
+
+	return affected == 1, nil
+}
+
+func (c *Client) RecordActionPlanApproval(id, approver string, approvedAt time.Time) error {
+	_, err := c.db.Exec(
+		`UPDATE action_plans SET approved_by = ?, approved_at = ? WHERE id = ?`,
+		approver,
+		approvedAt.Unix(),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record action plan approval: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) InsertActionApproval(approval *models.ActionApprovalRecord) error {
+	_, err := c.db.Exec(`
+		INSERT INTO action_approvals (id, plan_id, status, requester, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`,
+		approval.ID,
+		approval.PlanID,
+		approval.Status,
+		approval.Requester,
+		approval.CreatedAt.Unix(),
+		approval.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert action approval: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) GetActionApproval(id string) (*models.ActionApprovalRecord, bool, error) {
+	query := `
+		SELECT id, plan_id, status, requester, COALESCE(approver, ''), COALESCE(results_json, ''),
+			created_at, expires_at, resolved_at
+		FROM action_approvals
+		WHERE id = ?
+	`
+
+	var approval models.ActionApprovalRecord
+	var createdAt, expiresAt int64
+	var resolvedAt sql.NullInt64
+
+	err := c.db.QueryRow(query, id).Scan(
+		&approval.ID,
+		&approval.PlanID,
+		&approval.Status,
+		&approval.Requester,
+		&approval.Approver,
+		&approval.ResultsJSON,
+		&createdAt,
+		&expiresAt,
+		&resolvedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get action approval: %w", err)
+	}
+
+	approval.CreatedAt = time.Unix(createdAt, 0)
+	approval.ExpiresAt = time.Unix(expiresAt, 0)
+	if resolvedAt.Valid {
+		approval.ResolvedAt = time.Unix(resolvedAt.Int64, 0)
+	}
+
+	return &approval, true, nil
+}
+
+// ResolveActionApproval moves an approval from one status to another,
+// recording who resolved it and when, and reports whether it was still in
+// the expected status so each approval is decided once.
+func (c *Client) ResolveActionApproval(id, from, to, approver string, resolvedAt time.Time) (bool, error) {
+	result, err := c.db.Exec(
+		`UPDATE action_approvals SET status = ?, approver = ?, resolved_at = ? WHERE id = ? AND status = ?`,
+		to, approver, resolvedAt.Unix(), id, from,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve action approval: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve action approval: %w", err)
+	}
+
+	return affected == 1, nil
+}
+
+func (c *Client) CompleteActionApproval(id, status, resultsJSON string) error {
+	_, err := c.db.Exec(
+		`UPDATE action_approvals SET status = ?, results_json = ? WHERE id = ?`,
+		status, resultsJSON, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete action approval: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) DeleteActionApproval(id string) error {
+	if _, err := c.db.Exec(`DELETE FROM action_approvals WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete action approval: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+)
+
+// GetCalibrationSamples returns the most recent feedback verdicts with the
+// retrieval signals of their queries. Queries recorded before the averages
+// were stored fall back to their saved sources.
+func (c *Client) GetCalibrationSamples(limit int) ([]models.CalibrationSample, error) {
+	query := `
+		SELECT COALESCE(h.kg_results_count, 0), COALESCE(h.vector_results_count, 0),
+			COALESCE(h.avg_kg_confidence,
+				(SELECT AVG(s.confidence) FROM query_sources s WHERE s.query_id = h.id AND s.source_type = 'kg'), 0),
+			COALESCE(h.avg_vector_score,
+				(SELECT AVG(s.confidence) FROM query_sources s WHERE s.query_id = h.id AND s.source_type = 'vector'), 0),
+			instr(COALESCE(r.response, h.response, ''), 'http') > 0,
+			f.helpful
+		FROM feedback f
+		JOIN query_history h ON h.id = f.query_id
+		LEFT JOIN query_responses r ON r.query_id = h.id
+		ORDER BY f.created_at DESC
+		LIMIT ?
+	`
+
+	rows, err := c.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query calibration samples: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []models.CalibrationSample
+	for rows.Next() {
+		var s models.CalibrationSample
+		if err := rows.Scan(
+			&s.KGResultsCount,
+			&s.VectorResultsCount,
+			&s.AvgKGConfidence,
+			&s.AvgVectorScore,
+			&s.HasLink,
+			&s.Helpful,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan calibration sample: %w", err)
+		}
+		samples = append(samples, s)
+	}
+
+	return samples, rows.Err()
+}
+
+func (c *Client) InsertConfidenceCalibration(calibration *models.ConfidenceCalibration) error {
+	weights, err := json.Marshal(calibration.Weights)
+	if err != nil {
+		return fmt.Errorf("failed to marshal calibration weights: %w", err)
+	}
+
+	result, err := c.db.Exec(`
+		INSERT INTO confidence_calibrations (bias, weights, samples, log_loss, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, calibration.Bias, string(weights), calibration.Samples, calibration.LogLoss, calibration.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to insert confidence calibration: %w", err)
+	}
+
+	if id, err := result.LastInsertId(); err == nil {
+		calibration.ID = int(id)
+	}
+	return nil
+}
+
+func (c *Client) GetLatestConfidenceCalibration() (*models.ConfidenceCalibration, bool, error) {
+	var calibration models.ConfidenceCalibration
+	var weights string
+	var logLoss sql.NullFloat64
+	var createdAt int64
+
+	err := c.db.QueryRow(`
+		SELECT id, bias, weights, samples, log_loss, created_at
+		FROM confidence_calibrations
+		ORDER BY id DESC
+		LIMIT 1
+	`).Scan(&calibration.ID, &calibration.Bias, &weights, &calibration.Samples, &logLoss, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get confidence calibration: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(weights), &calibration.Weights); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal calibration weights: %w", err)
+	}
+	calibration.LogLoss = logLoss.Float64
+	calibration.CreatedAt = time.Unix(createdAt, 0)
+
+	return &calibration, true, nil
+}
@@ -1,9 +1,12 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -14,11 +17,15 @@ import (
 )
 
 type Client struct {
-	db *sql.DB
+	db           *sql.DB
+	path         string
+	keywordIndex bool
+
+	maintenanceMu sync.Mutex
 }
 
 func NewClient(dbPath string) (*Client, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", withBusyTimeout(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -35,13 +42,31 @@ func NewClient(dbPath string) (*Client, error) {
 
 	logger.Info("SQLite client initialized", zap.String("path", dbPath))
 
-	return &Client{db: db}, nil
+	return &Client{db: db, path: dbPath}, nil
+}
+
+// withBusyTimeout makes every pooled connection wait for the write lock
+// instead of failing concurrent upserts with SQLITE_BUSY.
+func withBusyTimeout(dbPath string) string {
+	if strings.Contains(dbPath, "_busy_timeout") {
+		return dbPath
+	}
+
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	return dbPath + separator + "_busy_timeout=5000"
 }
 
 func (c *Client) Close() error {
 	return c.db.Close()
 }
 
+func (c *Client) Ping(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
+
 func (c *Client) InitSchema() error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS documents (
@@ -80,6 +105,7 @@ func (c *Client) InitSchema() error {
 		kg_results_count INTEGER,
 		vector_results_count INTEGER,
 		web_search_used INTEGER DEFAULT 0,
+		web_search_allowed INTEGER DEFAULT 0,
 		latency_ms INTEGER,
 		created_at INTEGER NOT NULL
 	);
@@ -97,6 +123,12 @@ func (c *Client) InitSchema() error {
 	);
 	CREATE INDEX IF NOT EXISTS idx_sources_query ON query_sources(query_id);
 
+	CREATE TABLE IF NOT EXISTS query_responses (
+		query_id TEXT PRIMARY KEY,
+		response TEXT NOT NULL,
+		FOREIGN KEY (query_id) REFERENCES query_history(id) ON DELETE CASCADE
+	);
+
 	CREATE TABLE IF NOT EXISTS feedback (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		query_id TEXT NOT NULL,
@@ -124,6 +156,20 @@ func (c *Client) InitSchema() error {
 	);
 	CREATE INDEX IF NOT EXISTS idx_eval_query ON evaluation_results(query_id);
 
+	CREATE TABLE IF NOT EXISTS evaluation_runs (
+		id TEXT PRIMARY KEY,
+		status TEXT NOT NULL,
+		dataset TEXT NOT NULL,
+		total INTEGER NOT NULL DEFAULT 0,
+		completed INTEGER NOT NULL DEFAULT 0,
+		failed INTEGER NOT NULL DEFAULT 0,
+		report TEXT,
+		error TEXT,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL,
+		completed_at INTEGER
+	);
+
 	CREATE TABLE IF NOT EXISTS kg_entities (
 		id TEXT PRIMARY KEY,
 		name TEXT NOT NULL,
@@ -170,6 +216,70 @@ func (c *Client) InitSchema() error {
 	);
 	CREATE INDEX IF NOT EXISTS idx_metrics_name ON system_metrics(metric_name);
 	CREATE INDEX IF NOT EXISTS idx_metrics_timestamp ON system_metrics(timestamp);
+
+	CREATE TABLE IF NOT EXISTS user_token_usage (
+		user_id TEXT NOT NULL,
+		day TEXT NOT NULL,
+		tokens INTEGER NOT NULL DEFAULT 0,
+		updated_at INTEGER NOT NULL,
+		PRIMARY KEY (user_id, day)
+	);
+
+	CREATE TABLE IF NOT EXISTS action_plans (
+		id TEXT PRIMARY KEY,
+		issue TEXT,
+		plan_json TEXT NOT NULL,
+		risk_level TEXT,
+		requires_approval INTEGER NOT NULL DEFAULT 1,
+		status TEXT NOT NULL,
+		requested_by TEXT,
+		approved_by TEXT,
+		approved_at INTEGER,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_action_plans_created ON action_plans(created_at);
+
+	CREATE TABLE IF NOT EXISTS action_approvals (
+		id TEXT PRIMARY KEY,
+		plan_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		requester TEXT NOT NULL,
+		approver TEXT,
+		results_json TEXT,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		resolved_at INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS idx_action_approvals_plan ON action_approvals(plan_id);
+
+	CREATE TABLE IF NOT EXISTS confidence_calibrations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		bias REAL NOT NULL,
+		weights TEXT NOT NULL,
+		samples INTEGER NOT NULL,
+		log_loss REAL,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS reindex_state (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		embedding_model TEXT NOT NULL,
+		vector_dim INTEGER NOT NULL,
+		last_doc_id TEXT NOT NULL DEFAULT '',
+		total_documents INTEGER NOT NULL DEFAULT 0,
+		documents INTEGER NOT NULL DEFAULT 0,
+		chunks INTEGER NOT NULL DEFAULT 0,
+		started_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL,
+		completed_at INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS vector_collections (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		active TEXT NOT NULL,
+		staging TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
 	`
 
 	_, err := c.db.Exec(schema)
@@ -177,10 +287,59 @@ func (c *Client) InitSchema() error {
 		return fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
+	if err := c.addColumnIfMissing("query_history", "web_search_allowed", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := c.addColumnIfMissing("query_history", "avg_kg_confidence", "REAL"); err != nil {
+		return err
+	}
+	if err := c.addColumnIfMissing("query_history", "avg_vector_score", "REAL"); err != nil {
+		return err
+	}
+	if err := c.addColumnIfMissing("query_history", "conversation_id", "TEXT"); err != nil {
+		return err
+	}
+	if err := c.addColumnIfMissing("action_plans", "requested_by", "TEXT"); err != nil {
+		return err
+	}
+
+	c.initKeywordIndex()
+
 	logger.Info("SQLite schema initialized")
 	return nil
 }
 
+func (c *Client) addColumnIfMissing(table, column, definition string) error {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read table info: %w", err)
+	}
+
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+
+	logger.Info("SQLite column added", zap.String("table", table), zap.String("column", column))
+	return nil
+}
+
 func (c *Client) InsertDocument(doc *models.Document) error {
 	query := `
 		INSERT INTO documents (id, url, title, aws_service, doc_type, summary, raw_content, created_at, updated_at)
@@ -213,7 +372,7 @@ func (c *Client) InsertDocument(doc *models.Document) error {
 	return nil
 }
 
-func (c *Client) GetDocument(id string) (*models.Document, error) {
+func (c *Client) GetDocument(id string) (*models.Document, bool, error) {
 	query := `SELECT id, url, title, aws_service, doc_type, summary, raw_content, created_at, updated_at FROM documents WHERE id = ?`
 
 	var doc models.Document
@@ -230,19 +389,79 @@ func (c *Client) GetDocument(id string) (*models.Document, error) {
 		&createdAt,
 		&updatedAt,
 	)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	doc.CreatedAt = time.Unix(createdAt, 0)
+	doc.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &doc, true, nil
+}
+
+func (c *Client) GetDocumentByURL(url string) (*models.Document, bool, error) {
+	query := `SELECT id, url, title, aws_service, doc_type, summary, raw_content, created_at, updated_at FROM documents WHERE url = ?`
+
+	var doc models.Document
+	var createdAt, updatedAt int64
 
+	err := c.db.QueryRow(query, url).Scan(
+		&doc.ID,
+		&doc.URL,
+		&doc.Title,
+		&doc.AWSService,
+		&doc.DocType,
+		&doc.Summary,
+		&doc.RawContent,
+		&createdAt,
+		&updatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get document: %w", err)
+		return nil, false, fmt.Errorf("failed to get document by url: %w", err)
 	}
 
 	doc.CreatedAt = time.Unix(createdAt, 0)
 	doc.UpdatedAt = time.Unix(updatedAt, 0)
 
-	return &doc, nil
+	return &doc, true, nil
+}
+
+func (c *Client) DeleteDocument(id string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM document_chunks WHERE doc_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete document chunks: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM documents WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
 
 func (c *Client) InsertChunk(chunk *models.DocumentChunk) error {
-	query := `INSERT INTO document_chunks (id, doc_id, chunk_index, text, embedding_id, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	query := `
+		INSERT INTO document_chunks (id, doc_id, chunk_index, text, embedding_id, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			chunk_index = excluded.chunk_index,
+			text = excluded.text,
+			embedding_id = excluded.embedding_id
+	`
 
 	_, err := c.db.Exec(
 		query,
@@ -261,11 +480,40 @@ func (c *Client) InsertChunk(chunk *models.DocumentChunk) error {
 	return nil
 }
 
+func (c *Client) GetChunkTexts(docID string) (map[string]string, error) {
+	rows, err := c.db.Query(`SELECT id, text FROM document_chunks WHERE doc_id = ?`, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunks: %w", err)
+	}
+	defer rows.Close()
+
+	texts := make(map[string]string)
+	for rows.Next() {
+		var id, text string
+		if err := rows.Scan(&id, &text); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		texts[id] = text
+	}
+
+	return texts, nil
+}
+
+func (c *Client) DeleteChunk(id string) error {
+	_, err := c.db.Exec(`DELETE FROM document_chunks WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete chunk: %w", err)
+	}
+
+	return nil
+}
+
 func (c *Client) InsertQueryRecord(record *models.QueryRecord) error {
 	query := `
 		INSERT INTO query_history (id, user_id, query_text, response, confidence, kg_results_count,
-			vector_results_count, web_search_used, latency_ms, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			vector_results_count, avg_kg_confidence, avg_vector_score, web_search_used, web_search_allowed,
+			latency_ms, conversation_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	webSearchUsed := 0
@@ -273,6 +521,11 @@ func (c *Client) InsertQueryRecord(record *models.QueryRecord) error {
 		webSearchUsed = 1
 	}
 
+	webSearchAllowed := 0
+	if record.WebSearchAllowed {
+		webSearchAllowed = 1
+	}
+
 	_, err := c.db.Exec(
 		query,
 		record.ID,
@@ -282,8 +535,12 @@ func (c *Client) InsertQueryRecord(record *models.QueryRecord) error {
 		record.Confidence,
 		record.KGResultsCount,
 		record.VectorResultsCount,
+		record.AvgKGConfidence,
+		record.AvgVectorScore,
 		webSearchUsed,
+		webSearchAllowed,
 		record.LatencyMS,
+		record.ConversationID,
 		record.CreatedAt.Unix(),
 	)
 
@@ -321,7 +578,8 @@ func (c *Client) InsertQuerySource(source *models.QuerySource) error {
 
 func (c *Client) GetQueryHistory(userID string, limit int) ([]models.QueryRecord, error) {
 	query := `
-		SELECT id, query_text, response, confidence, created_at
+		SELECT id, query_text, response, confidence, web_search_used, web_search_allowed,
+			COALESCE(conversation_id, ''), created_at
 		FROM query_history
 		WHERE user_id = ?
 		ORDER BY created_at DESC
@@ -339,7 +597,7 @@ func (c *Client) GetQueryHistory(userID string, limit int) ([]models.QueryRecord
 		var r models.QueryRecord
 		var createdAt int64
 
-		err := rows.Scan(&r.ID, &r.QueryText, &r.Response, &r.Confidence, &createdAt)
+		err := rows.Scan(&r.ID, &r.QueryText, &r.Response, &r.Confidence, &r.WebSearchUsed, &r.WebSearchAllowed, &r.ConversationID, &createdAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
@@ -351,6 +609,73 @@ func (c *Client) GetQueryHistory(userID string, limit int) ([]models.QueryRecord
 	return records, nil
 }
 
+func (c *Client) InsertQueryResponse(queryID, response string) error {
+	query := `INSERT OR REPLACE INTO query_responses (query_id, response) VALUES (?, ?)`
+
+	_, err := c.db.Exec(query, queryID, response)
+	if err != nil {
+		return fmt.Errorf("failed to insert query response: %w", err)
+	}
+
+	return nil
+}
+
+// GetQueryResponse returns the full answer to a query asked by userID. A
+// query asked by anyone else is reported as not found.
+func (c *Client) GetQueryResponse(queryID, userID string) (string, bool, error) {
+	query := `
+		SELECT COALESCE(r.response, h.response, '')
+		FROM query_history h
+		LEFT JOIN query_responses r ON r.query_id = h.id
+		WHERE h.id = ? AND h.user_id = ?
+	`
+
+	var response string
+	err := c.db.QueryRow(query, queryID, userID).Scan(&response)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get query response: %w", err)
+	}
+
+	return response, true, nil
+}
+
+func (c *Client) GetQuerySources(queryID string) ([]models.QuerySource, error) {
+	query := `
+		SELECT id, query_id, source_type, source_url, chunk_id, confidence
+		FROM query_sources
+		WHERE query_id = ?
+		ORDER BY confidence DESC
+	`
+
+	rows, err := c.db.Query(query, queryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get query sources: %w", err)
+	}
+	defer rows.Close()
+
+	var sources []models.QuerySource
+	for rows.Next() {
+		var s models.QuerySource
+		var sourceURL, chunkID sql.NullString
+		var confidence sql.NullFloat64
+
+		err := rows.Scan(&s.ID, &s.QueryID, &s.SourceType, &sourceURL, &chunkID, &confidence)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		s.SourceURL = sourceURL.String
+		s.ChunkID = chunkID.String
+		s.Confidence = confidence.Float64
+		sources = append(sources, s)
+	}
+
+	return sources, nil
+}
+
 func (c *Client) StoreFeedback(feedback *models.Feedback) error {
 	query := `INSERT INTO feedback (query_id, helpful, issue_category, comment, created_at) VALUES (?, ?, ?, ?, ?)`
 
@@ -387,8 +712,8 @@ func (c *Client) InsertKGEntity(entity *models.KGEntity) error {
 		INSERT INTO kg_entities (id, name, type, canonical_name, aliases, first_seen, last_updated, occurrence_count)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
-			occurrence_count = occurrence_count + 1,
-			last_updated = excluded.last_updated
+			occurrence_count = kg_entities.occurrence_count + MAX(excluded.occurrence_count, 1),
+			last_updated = MAX(kg_entities.last_updated, excluded.last_updated)
 	`
 
 	_, err := c.db.Exec(
@@ -410,8 +735,46 @@ func (c *Client) InsertKGEntity(entity *models.KGEntity) error {
 	return nil
 }
 
+func (c *Client) AddKGEntityAlias(entityID, alias string) (bool, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var aliasesJSON sql.NullString
+	err = tx.QueryRow(`SELECT aliases FROM kg_entities WHERE id = ?`, entityID).Scan(&aliasesJSON)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get entity aliases: %w", err)
+	}
+
+	var aliases []string
+	if aliasesJSON.String != "" {
+		json.Unmarshal([]byte(aliasesJSON.String), &aliases)
+	}
+	for _, existing := range aliases {
+		if existing == alias {
+			return true, nil
+		}
+	}
+
+	updated, _ := json.Marshal(append(aliases, alias))
+	if _, err := tx.Exec(`UPDATE kg_entities SET aliases = ?, last_updated = ? WHERE id = ?`, string(updated), time.Now().Unix(), entityID); err != nil {
+		return false, fmt.Errorf("failed to update entity aliases: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
 func (c *Client) GetKGEntities(entityType string) ([]models.KGEntity, error) {
-	query := `SELECT id, name, type, canonical_name, aliases FROM kg_entities WHERE type = ?`
+	query := `SELECT id, name, type, canonical_name, aliases, occurrence_count FROM kg_entities WHERE type = ?`
 
 	rows, err := c.db.Query(query, entityType)
 	if err != nil {
@@ -424,7 +787,7 @@ func (c *Client) GetKGEntities(entityType string) ([]models.KGEntity, error) {
 		var e models.KGEntity
 		var aliasesJSON string
 
-		err := rows.Scan(&e.ID, &e.Name, &e.Type, &e.CanonicalName, &aliasesJSON)
+		err := rows.Scan(&e.ID, &e.Name, &e.Type, &e.CanonicalName, &aliasesJSON, &e.OccurrenceCount)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
@@ -534,3 +897,35 @@ func (c *Client) RecordMetric(name string, value float64, tags map[string]string
 
 	return nil
 }
+
+func (c *Client) AddUserTokenUsage(userID, day string, tokens int) error {
+	query := `
+		INSERT INTO user_token_usage (user_id, day, tokens, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, day) DO UPDATE SET
+			tokens = tokens + excluded.tokens,
+			updated_at = excluded.updated_at
+	`
+
+	_, err := c.db.Exec(query, userID, day, tokens, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to add user token usage: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) GetUserTokenUsage(userID, day string) (int, error) {
+	query := `SELECT tokens FROM user_token_usage WHERE user_id = ? AND day = ?`
+
+	var tokens int
+	err := c.db.QueryRow(query, userID, day).Scan(&tokens)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user token usage: %w", err)
+	}
+
+	return tokens, nil
+}
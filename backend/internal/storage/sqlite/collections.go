@@ -0,0 +1,37 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetVectorCollections returns the active and staging vector collections
+// saved by the last collection switch.
+func (c *Client) GetVectorCollections() (active, staging string, found bool, err error) {
+	err = c.db.QueryRow(`SELECT active, staging FROM vector_collections WHERE id = 1`).Scan(&active, &staging)
+	if err == sql.ErrNoRows {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to get vector collections: %w", err)
+	}
+
+	return active, staging, true, nil
+}
+
+func (c *Client) SaveVectorCollections(active, staging string) error {
+	_, err := c.db.Exec(`
+		INSERT INTO vector_collections (id, active, staging, updated_at)
+		VALUES (1, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			active = excluded.active,
+			staging = excluded.staging,
+			updated_at = excluded.updated_at
+	`, active, staging, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save vector collections: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+)
+
+func (c *Client) GetQueryDiagnostics(queryID string) (*models.QueryDiagnostics, bool, error) {
+	record, found, err := c.GetQueryRecord(queryID)
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	sources, err := c.GetQuerySources(queryID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	evaluations, err := c.GetEvaluationResults(queryID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	feedback, err := c.GetFeedback(queryID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &models.QueryDiagnostics{
+		Record:      *record,
+		Sources:     sources,
+		Evaluations: evaluations,
+		Feedback:    feedback,
+	}, true, nil
+}
+
+func (c *Client) GetQueryRecord(queryID string) (*models.QueryRecord, bool, error) {
+	query := `
+		SELECT h.id, COALESCE(h.user_id, ''), h.query_text, COALESCE(r.response, h.response, ''),
+			COALESCE(h.confidence, 0), COALESCE(h.kg_results_count, 0), COALESCE(h.vector_results_count, 0),
+			h.web_search_used, h.web_search_allowed, COALESCE(h.latency_ms, 0), h.created_at
+		FROM query_history h
+		LEFT JOIN query_responses r ON r.query_id = h.id
+		WHERE h.id = ?
+	`
+
+	var r models.QueryRecord
+	var createdAt int64
+
+	err := c.db.QueryRow(query, queryID).Scan(
+		&r.ID,
+		&r.UserID,
+		&r.QueryText,
+		&r.Response,
+		&r.Confidence,
+		&r.KGResultsCount,
+		&r.VectorResultsCount,
+		&r.WebSearchUsed,
+		&r.WebSearchAllowed,
+		&r.LatencyMS,
+		&createdAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get query record: %w", err)
+	}
+
+	r.CreatedAt = time.Unix(createdAt, 0)
+	return &r, true, nil
+}
+
+func (c *Client) GetEvaluationResults(queryID string) ([]models.EvaluationResult, error) {
+	query := `
+		SELECT id, query_id, COALESCE(relevance_score, 0), COALESCE(accuracy_score, 0),
+			COALESCE(completeness_score, 0), COALESCE(citation_score, 0),
+			COALESCE(overall_classification, ''), COALESCE(reasoning, ''),
+			COALESCE(cosine_similarity, 0), created_at
+		FROM evaluation_results
+		WHERE query_id = ?
+		ORDER BY created_at DESC
+	`
+
+	rows, err := c.db.Query(query, queryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get evaluation results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []models.EvaluationResult
+	for rows.Next() {
+		var e models.EvaluationResult
+		var createdAt int64
+
+		err := rows.Scan(
+			&e.ID,
+			&e.QueryID,
+			&e.RelevanceScore,
+			&e.AccuracyScore,
+			&e.CompletenessScore,
+			&e.CitationScore,
+			&e.OverallClassification,
+			&e.Reasoning,
+			&e.CosineSimilarity,
+			&createdAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		e.CreatedAt = time.Unix(createdAt, 0)
+		results = append(results, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate evaluation results: %w", err)
+	}
+
+	return results, nil
+}
+
+func (c *Client) GetFeedback(queryID string) ([]models.Feedback, error) {
+	query := `
+		SELECT id, query_id, helpful, COALESCE(issue_category, ''), COALESCE(comment, ''), created_at
+		FROM feedback
+		WHERE query_id = ?
+		ORDER BY created_at DESC
+	`
+
+	rows, err := c.db.Query(query, queryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feedback: %w", err)
+	}
+	defer rows.Close()
+
+	var feedback []models.Feedback
+	for rows.Next() {
+		var f models.Feedback
+		var createdAt int64
+
+		err := rows.Scan(&f.ID, &f.QueryID, &f.Helpful, &f.IssueCategory, &f.Comment, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		f.CreatedAt = time.Unix(createdAt, 0)
+		feedback = append(feedback, f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate feedback: %w", err)
+	}
+
+	return feedback, nil
+}
@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+)
+
+type DocumentFilter struct {
+	AWSService string
+	DocType    string
+	Title      string
+	Limit      int
+	Offset     int
+}
+
+type DocumentPage struct {
+	Documents []models.Document
+	Total     int64
+	Limit     int
+	Offset    int
+}
+
+const documentFilterClause = `
+	FROM documents
+	WHERE (? = '' OR aws_service = ?)
+	  AND (? = '' OR doc_type = ?)
+	  AND (? = '' OR instr(lower(title), lower(?)) > 0)
+`
+
+func (c *Client) ListDocuments(filter DocumentFilter) (*DocumentPage, error) {
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	if filter.Limit < 0 {
+		filter.Limit = 0
+	}
+
+	page := &DocumentPage{
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}
+
+	title := strings.TrimSpace(filter.Title)
+	args := []interface{}{
+		filter.AWSService, filter.AWSService,
+		filter.DocType, filter.DocType,
+		title, title,
+	}
+
+	err := c.db.QueryRow(`SELECT COUNT(*) `+documentFilterClause, args...).Scan(&page.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = -1
+	}
+
+	query := `SELECT id, url, title, COALESCE(aws_service, ''), COALESCE(doc_type, ''), COALESCE(summary, ''), created_at, updated_at ` +
+		documentFilterClause + `ORDER BY updated_at DESC, id LIMIT ? OFFSET ?`
+
+	rows, err := c.db.Query(query, append(args, limit, filter.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
+	page.Documents = make([]models.Document, 0)
+	for rows.Next() {
+		var doc models.Document
+		var createdAt, updatedAt int64
+		err := rows.Scan(&doc.ID, &doc.URL, &doc.Title, &doc.AWSService, &doc.DocType, &doc.Summary, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		doc.CreatedAt = time.Unix(createdAt, 0)
+		doc.UpdatedAt = time.Unix(updatedAt, 0)
+		page.Documents = append(page.Documents, doc)
+	}
+
+	return page, rows.Err()
+}
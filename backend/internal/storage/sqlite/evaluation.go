@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+)
+
+func (c *Client) InsertEvaluationRun(run *models.EvaluationRun) error {
+	_, err := c.db.Exec(`
+		INSERT INTO evaluation_runs (id, status, dataset, total, completed, failed, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, run.ID, run.Status, run.Dataset, run.Total, run.Completed, run.Failed, run.CreatedAt.Unix(), run.UpdatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to insert evaluation run: %w", err)
+	}
+	return nil
+}
+
+// UpdateEvaluationRun saves a run's status, progress and, once finished,
+// its report or error.
+func (c *Client) UpdateEvaluationRun(run *models.EvaluationRun) error {
+	var completedAt interface{}
+	if run.CompletedAt != nil {
+		completedAt = run.CompletedAt.Unix()
+	}
+
+	_, err := c.db.Exec(`
+		UPDATE evaluation_runs
+		SET status = ?, completed = ?, failed = ?, report = ?, error = ?, updated_at = ?, completed_at = ?
+		WHERE id = ?
+	`, run.Status, run.Completed, run.Failed, run.Report, run.Error, run.UpdatedAt.Unix(), completedAt, run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update evaluation run: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) GetEvaluationRun(id string) (*models.EvaluationRun, bool, error) {
+	var run models.EvaluationRun
+	var report, runErr sql.NullString
+	var createdAt, updatedAt int64
+	var completedAt sql.NullInt64
+
+	err := c.db.QueryRow(`
+		SELECT id, status, dataset, total, completed, failed, report, error, created_at, updated_at, completed_at
+		FROM evaluation_runs
+		WHERE id = ?
+	`, id).Scan(
+		&run.ID,
+		&run.Status,
+		&run.Dataset,
+		&run.Total,
+		&run.Completed,
+		&run.Failed,
+		&report,
+		&runErr,
+		&createdAt,
+		&updatedAt,
+		&completedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get evaluation run: %w", err)
+	}
+
+	run.Report = report.String
+	run.Error = runErr.String
+	run.CreatedAt = time.Unix(createdAt, 0)
+	run.UpdatedAt = time.Unix(updatedAt, 0)
+	if completedAt.Valid {
+		t := time.Unix(completedAt.Int64, 0)
+		run.CompletedAt = &t
+	}
+
+	return &run, true, nil
+}
+
+// FailInterruptedEvaluationRuns marks runs left running by a previous
+// process as failed, since nothing will finish them.
+func (c *Client) FailInterruptedEvaluationRuns(reason string) (int, error) {
+	now := time.Now().Unix()
+	result, err := c.db.Exec(`
+		UPDATE evaluation_runs
+		SET status = ?, error = ?, updated_at = ?, completed_at = ?
+		WHERE status = ?
+	`, models.EvaluationFailed, reason, now, now, models.EvaluationRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark interrupted evaluation runs: %w", err)
+	}
+
+	affected, _ := result.RowsAffected()
+	return int(affected), nil
+}
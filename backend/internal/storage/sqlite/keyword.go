@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+const keywordIndexSchema = `
+	CREATE VIRTUAL TABLE document_chunks_fts USING fts5(
+		text,
+		content='document_chunks',
+		content_rowid='rowid'
+	);
+	CREATE TRIGGER IF NOT EXISTS document_chunks_fts_insert AFTER INSERT ON document_chunks BEGIN
+		INSERT INTO document_chunks_fts(rowid, text) VALUES (new.rowid, new.text);
+	END;
+	CREATE TRIGGER IF NOT EXISTS document_chunks_fts_delete AFTER DELETE ON document_chunks BEGIN
+		INSERT INTO document_chunks_fts(document_chunks_fts, rowid, text) VALUES ('delete', old.rowid, old.text);
+	END;
+	CREATE TRIGGER IF NOT EXISTS document_chunks_fts_update AFTER UPDATE OF text ON document_chunks BEGIN
+		INSERT INTO document_chunks_fts(document_chunks_fts, rowid, text) VALUES ('delete', old.rowid, old.text);
+		INSERT INTO document_chunks_fts(rowid, text) VALUES (new.rowid, new.text);
+	END;
+	INSERT INTO document_chunks_fts(document_chunks_fts) VALUES ('rebuild');
+`
+
+// initKeywordIndex creates an FTS5 index over document_chunks.text. FTS5 is
+// only compiled into go-sqlite3 with the sqlite_fts5 build tag, so when the
+// module is missing keyword search falls back to substring matching.
+func (c *Client) initKeywordIndex() {
+	var existing int
+	err := c.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'document_chunks_fts'`).Scan(&existing)
+	if err != nil {
+		logger.Warn("Failed to check keyword index", zap.Error(err))
+		return
+	}
+	if existing > 0 {
+		c.keywordIndex = true
+		return
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		logger.Warn("Failed to begin keyword index transaction", zap.Error(err))
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(keywordIndexSchema); err != nil {
+		logger.Warn("FTS5 unavailable, keyword search will use substring matching", zap.Error(err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Warn("Failed to commit keyword index", zap.Error(err))
+		return
+	}
+
+	c.keywordIndex = true
+	logger.Info("Keyword index initialized")
+}
+
+// KeywordSearchChunks returns chunks matching any of terms, best first. A
+// non-empty awsService restricts matches to documents about that service.
+func (c *Client) KeywordSearchChunks(terms []string, awsService string, limit int) ([]models.ChunkMatch, error) {
+	if len(terms) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	if c.keywordIndex {
+		return c.ftsSearchChunks(terms, awsService, limit)
+	}
+	return c.substringSearchChunks(terms, awsService, limit)
+}
+
+func (c *Client) ftsSearchChunks(terms []string, awsService string, limit int) ([]models.ChunkMatch, error) {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+
+	query := `
+		SELECT ch.id, ch.doc_id, ch.text, d.url, COALESCE(d.aws_service, ''), COALESCE(d.doc_type, ''), COALESCE(d.summary, '')
+		FROM document_chunks_fts f
+		JOIN document_chunks ch ON ch.rowid = f.rowid
+		JOIN documents d ON d.id = ch.doc_id
+		WHERE document_chunks_fts MATCH ? AND (? = '' OR d.aws_service = ?)
+		ORDER BY bm25(document_chunks_fts)
+		LIMIT ?
+	`
+
+	return c.queryChunkMatches(query, strings.Join(quoted, " OR "), awsService, awsService, limit)
+}
+
+func (c *Client) substringSearchChunks(terms []string, awsService string, limit int) ([]models.ChunkMatch, error) {
+	conditions := make([]string, len(terms))
+	args := make([]interface{}, 0, 2*len(terms)+3)
+	for i, term := range terms {
+		conditions[i] = "(instr(ch.text, ?) > 0)"
+		args = append(args, term)
+	}
+	args = append(args, awsService, awsService)
+	for _, term := range terms {
+		args = append(args, term)
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`
+		SELECT ch.id, ch.doc_id, ch.text, d.url, COALESCE(d.aws_service, ''), COALESCE(d.doc_type, ''), COALESCE(d.summary, '')
+		FROM document_chunks ch
+		JOIN documents d ON d.id = ch.doc_id
+		WHERE (%s) AND (? = '' OR d.aws_service = ?)
+		ORDER BY %s DESC
+		LIMIT ?
+	`, strings.Join(conditions, " OR "), strings.Join(conditions, " + "))
+
+	return c.queryChunkMatches(query, args...)
+}
+
+func (c *Client) queryChunkMatches(query string, args ...interface{}) ([]models.ChunkMatch, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []models.ChunkMatch
+	for rows.Next() {
+		var m models.ChunkMatch
+		if err := rows.Scan(&m.ChunkID, &m.DocID, &m.Text, &m.DocURL, &m.AWSService, &m.DocType, &m.Summary); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		matches = append(matches, m)
+	}
+
+	return matches, rows.Err()
+}
@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+// ErrDatabaseBusy is returned when maintenance is refused because writers
+// are holding the WAL or another maintenance run is in progress.
+var ErrDatabaseBusy = errors.New("database is busy")
+
+type VacuumResult struct {
+	SizeBeforeBytes int64 `json:"size_before_bytes"`
+	SizeAfterBytes  int64 `json:"size_after_bytes"`
+	FreedBytes      int64 `json:"freed_bytes"`
+	FreePagesBefore int64 `json:"free_pages_before"`
+	DurationMS      int64 `json:"duration_ms"`
+}
+
+// Vacuum checkpoints the WAL, rebuilds the database file to drop free pages
+// and truncates the WAL again. A checkpoint that cannot complete means
+// writers are active, in which case nothing is rewritten.
+func (c *Client) Vacuum() (*VacuumResult, error) {
+	if !c.maintenanceMu.TryLock() {
+		return nil, ErrDatabaseBusy
+	}
+	defer c.maintenanceMu.Unlock()
+
+	start := time.Now()
+
+	before, err := c.storageSize()
+	if err != nil {
+		return nil, err
+	}
+
+	var freePages int64
+	if err := c.db.QueryRow("PRAGMA freelist_count").Scan(&freePages); err != nil {
+		return nil, fmt.Errorf("failed to read freelist count: %w", err)
+	}
+
+	if err := c.checkpoint(); err != nil {
+		return nil, err
+	}
+
+	if _, err := c.db.Exec("VACUUM"); err != nil {
+		if isBusyError(err) {
+			return nil, ErrDatabaseBusy
+		}
+		return nil, fmt.Errorf("failed to vacuum database: %w", err)
+	}
+
+	// VACUUM writes the rebuilt pages through the WAL, so truncate it again.
+	if err := c.checkpoint(); err != nil {
+		return nil, err
+	}
+
+	after, err := c.storageSize()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VacuumResult{
+		SizeBeforeBytes: before,
+		SizeAfterBytes:  after,
+		FreedBytes:      before - after,
+		FreePagesBefore: freePages,
+		DurationMS:      time.Since(start).Milliseconds(),
+	}
+
+	logger.Info("SQLite vacuum completed",
+		zap.Int64("size_before_bytes", result.SizeBeforeBytes),
+		zap.Int64("size_after_bytes", result.SizeAfterBytes),
+		zap.Int64("freed_bytes", result.FreedBytes),
+		zap.Int64("duration_ms", result.DurationMS),
+	)
+
+	return result, nil
+}
+
+func (c *Client) checkpoint() error {
+	var busy, logFrames, checkpointed int
+	err := c.db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed)
+	if err != nil {
+		if isBusyError(err) {
+			return ErrDatabaseBusy
+		}
+		return fmt.Errorf("failed to checkpoint WAL: %w", err)
+	}
+	if busy != 0 {
+		logger.Warn("WAL checkpoint blocked by active connections",
+			zap.Int("log_frames", logFrames),
+			zap.Int("checkpointed_frames", checkpointed),
+		)
+		return ErrDatabaseBusy
+	}
+	return nil
+}
+
+// storageSize is the main database file size plus any un-checkpointed WAL.
+func (c *Client) storageSize() (int64, error) {
+	var pageCount, pageSize int64
+	if err := c.db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, fmt.Errorf("failed to read page count: %w", err)
+	}
+	if err := c.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("failed to read page size: %w", err)
+	}
+
+	size := pageCount * pageSize
+	if path := databaseFilePath(c.path); path != "" {
+		if info, err := os.Stat(path + "-wal"); err == nil {
+			size += info.Size()
+		}
+	}
+	return size, nil
+}
+
+// databaseFilePath strips the DSN prefix and options from dbPath, returning
+// "" for in-memory databases.
+func databaseFilePath(dbPath string) string {
+	path := strings.TrimPrefix(dbPath, "file:")
+	if idx := strings.Index(path, "?"); idx >= 0 {
+		path = path[:idx]
+	}
+	if path == "" || path == ":memory:" {
+		return ""
+	}
+	return path
+}
+
+func isBusyError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "SQLITE_BUSY")
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/aws-agent/backend/internal/storage/models"
+)
+
+func (c *Client) GetReindexState() (*models.ReindexState, bool, error) {
+	var state models.ReindexState
+	var startedAt, updatedAt int64
+	var completedAt sql.NullInt64
+
+	err := c.db.QueryRow(`
+		SELECT embedding_model, vector_dim, last_doc_id, total_documents, documents, chunks,
+			started_at, updated_at, completed_at
+		FROM reindex_state
+		WHERE id = 1
+	`).Scan(
+		&state.EmbeddingModel,
+		&state.VectorDim,
+		&state.LastDocID,
+		&state.TotalDocuments,
+		&state.Documents,
+		&state.Chunks,
+		&startedAt,
+		&updatedAt,
+		&completedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get reindex state: %w", err)
+	}
+
+	state.StartedAt = time.Unix(startedAt, 0)
+	state.UpdatedAt = time.Unix(updatedAt, 0)
+	if completedAt.Valid {
+		t := time.Unix(completedAt.Int64, 0)
+		state.CompletedAt = &t
+	}
+
+	return &state, true, nil
+}
+
+func (c *Client) SaveReindexState(state *models.ReindexState) error {
+	var completedAt interface{}
+	if state.CompletedAt != nil {
+		completedAt = state.CompletedAt.Unix()
+	}
+
+	_, err := c.db.Exec(`
+		INSERT INTO reindex_state (id, embedding_model, vector_dim, last_doc_id, total_documents, documents, chunks,
+			started_at, updated_at, completed_at)
+		VALUES (1, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			embedding_model = excluded.embedding_model,
+			vector_dim = excluded.vector_dim,
+			last_doc_id = excluded.last_doc_id,
+			total_documents = excluded.total_documents,
+			documents = excluded.documents,
+			chunks = excluded.chunks,
+			started_at = excluded.started_at,
+			updated_at = excluded.updated_at,
+			completed_at = excluded.completed_at
+	`,
+		state.EmbeddingModel,
+		state.VectorDim,
+		state.LastDocID,
+		state.TotalDocuments,
+		state.Documents,
+		state.Chunks,
+		state.StartedAt.Unix(),
+		state.UpdatedAt.Unix(),
+		completedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save reindex state: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) CountDocuments() (int, error) {
+	var count int
+	if err := c.db.QueryRow(`SELECT COUNT(*) FROM documents`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count documents: %w", err)
+	}
+	return count, nil
+}
+
+// ListDocumentsAfter pages through documents in ID order without their raw
+// content.
+func (c *Client) ListDocumentsAfter(afterID string, limit int) ([]models.Document, error) {
+	rows, err := c.db.Query(`
+		SELECT id, url, title, COALESCE(aws_service, ''), COALESCE(doc_type, ''), COALESCE(summary, ''),
+			created_at, updated_at
+		FROM documents
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []models.Document
+	for rows.Next() {
+		var doc models.Document
+		var createdAt, updatedAt int64
+		if err := rows.Scan(
+			&doc.ID,
+			&doc.URL,
+			&doc.Title,
+			&doc.AWSService,
+			&doc.DocType,
+			&doc.Summary,
+			&createdAt,
+			&updatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		doc.CreatedAt = time.Unix(createdAt, 0)
+		doc.UpdatedAt = time.Unix(updatedAt, 0)
+		docs = append(docs, doc)
+	}
+
+	return docs, rows.Err()
+}
+
+func (c *Client) GetDocumentChunks(docID string) ([]models.DocumentChunk, error) {
+	rows, err := c.db.Query(`
+		SELECT id, doc_id, chunk_index, text, COALESCE(embedding_id, ''), created_at
+		FROM document_chunks
+		WHERE doc_id = ?
+		ORDER BY chunk_index
+	`, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []models.DocumentChunk
+	for rows.Next() {
+		var chunk models.DocumentChunk
+		var createdAt int64
+		if err := rows.Scan(&chunk.ID, &chunk.DocID, &chunk.ChunkIndex, &chunk.Text, &chunk.EmbeddingID, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		chunk.CreatedAt = time.Unix(createdAt, 0)
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, rows.Err()
+}
@@ -0,0 +1,110 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/cache/redis"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+var ErrQuotaExceeded = errors.New("daily query quota exceeded")
+
+type QuotaConfig struct {
+	// DailyLimit is the number of queries a user may make per UTC day.
+	// Zero disables the quota.
+	DailyLimit int
+	// Overrides replaces DailyLimit for individual users; zero exempts them.
+	Overrides map[string]int
+}
+
+type Quota struct {
+	Limit     int
+	Used      int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// QuotaTracker counts queries per user in daily Redis keys, so counts
+// survive restarts and are shared between instances.
+type QuotaTracker struct {
+	cache *redis.Client
+	cfg   QuotaConfig
+	now   func() time.Time
+}
+
+func NewQuotaTracker(cache *redis.Client, cfg QuotaConfig) *QuotaTracker {
+	if cfg.DailyLimit < 0 {
+		cfg.DailyLimit = 0
+	}
+
+	return &QuotaTracker{
+		cache: cache,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+func (t *QuotaTracker) limitFor(userID string) int {
+	if limit, ok := t.cfg.Overrides[userID]; ok {
+		return limit
+	}
+	return t.cfg.DailyLimit
+}
+
+// Consume counts one query for userID. It returns a nil quota when the user
+// is not subject to one, and ErrQuotaExceeded, without counting the query,
+// once the limit is reached. Redis errors let the query through.
+func (t *QuotaTracker) Consume(ctx context.Context, userID string) (*Quota, error) {
+	if t == nil || t.cache == nil || userID == "" {
+		return nil, nil
+	}
+
+	limit := t.limitFor(userID)
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	now := t.now().UTC()
+	day, resetAt := quotaWindow(now)
+
+	used, err := t.cache.IncrementUserQuota(ctx, userID, day, resetAt.Sub(now)+time.Hour)
+	if err != nil {
+		logger.Warn("Failed to count user query quota", zap.String("user_id", userID), zap.Error(err))
+		return nil, nil
+	}
+
+	quota := &Quota{
+		Limit:     limit,
+		Used:      int(used),
+		Remaining: max(limit-int(used), 0),
+		ResetAt:   resetAt,
+	}
+
+	if int(used) > limit {
+		if err := t.cache.DecrementUserQuota(ctx, userID, day); err != nil {
+			logger.Warn("Failed to release rejected quota slot", zap.String("user_id", userID), zap.Error(err))
+		}
+		quota.Used = limit
+
+		logger.Warn("User query quota exceeded",
+			zap.String("user_id", userID),
+			zap.Int("limit", limit),
+		)
+		return quota, fmt.Errorf("%w: %d queries per day", ErrQuotaExceeded, limit)
+	}
+
+	return quota, nil
+}
+
+// quotaWindow returns the key for the UTC day containing now and the time
+// that day's quota resets.
+func quotaWindow(now time.Time) (string, time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+}
@@ -0,0 +1,104 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws-agent/backend/internal/cache/redis/redistest"
+)
+
+func newTestQuotaTracker(t *testing.T, cfg QuotaConfig, now *time.Time) *QuotaTracker {
+	t.Helper()
+
+	cache, _ := redistest.NewClient(t)
+	tracker := NewQuotaTracker(cache, cfg)
+	tracker.now = func() time.Time { return *now }
+	return tracker
+}
+
+func TestQuotaRollsOverAtUTCMidnight(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 59, 30, 0, time.UTC)
+	tracker := newTestQuotaTracker(t, QuotaConfig{DailyLimit: 2}, &now)
+	ctx := context.Background()
+
+	for i := 1; i <= 2; i++ {
+		quota, err := tracker.Consume(ctx, "u1")
+		if err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+		if quota.Remaining != 2-i {
+			t.Errorf("query %d remaining = %d, want %d", i, quota.Remaining, 2-i)
+		}
+	}
+
+	quota, err := tracker.Consume(ctx, "u1")
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("third query err = %v, want ErrQuotaExceeded", err)
+	}
+	if want := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC); !quota.ResetAt.Equal(want) {
+		t.Errorf("reset at %v, want %v", quota.ResetAt, want)
+	}
+	if quota.Used != 2 || quota.Remaining != 0 {
+		t.Errorf("rejected quota = %+v, want the rejected query uncounted", quota)
+	}
+
+	now = time.Date(2024, 5, 2, 0, 0, 1, 0, time.UTC)
+	quota, err = tracker.Consume(ctx, "u1")
+	if err != nil {
+		t.Fatalf("query after midnight: %v", err)
+	}
+	if quota.Used != 1 || quota.Remaining != 1 {
+		t.Errorf("quota after midnight = %+v, want a fresh day", quota)
+	}
+}
+
+func TestQuotaWindowUsesUTC(t *testing.T) {
+	// 20:00 on 1 May in New York is already 2 May in UTC.
+	local := time.Date(2024, 5, 1, 20, 0, 0, 0, time.FixedZone("EDT", -4*60*60))
+
+	day, resetAt := quotaWindow(local)
+	if day != "2024-05-02" {
+		t.Errorf("day = %s, want 2024-05-02", day)
+	}
+	if want := time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC); !resetAt.Equal(want) {
+		t.Errorf("reset at %v, want %v", resetAt, want)
+	}
+}
+
+func TestQuotaPerUserOverrides(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newTestQuotaTracker(t, QuotaConfig{
+		DailyLimit: 1,
+		Overrides:  map[string]int{"power-user": 3, "service": 0},
+	}, &now)
+	ctx := context.Background()
+
+	allowed := func(userID string, queries int) int {
+		t.Helper()
+		n := 0
+		for i := 0; i < queries; i++ {
+			if _, err := tracker.Consume(ctx, userID); err == nil {
+				n++
+			} else if !errors.Is(err, ErrQuotaExceeded) {
+				t.Fatalf("consume for %s: %v", userID, err)
+			}
+		}
+		return n
+	}
+
+	if got := allowed("u1", 5); got != 1 {
+		t.Errorf("default user allowed %d queries, want 1", got)
+	}
+	if got := allowed("power-user", 5); got != 3 {
+		t.Errorf("overridden user allowed %d queries, want 3", got)
+	}
+	if got := allowed("service", 5); got != 5 {
+		t.Errorf("exempt user allowed %d queries, want 5", got)
+	}
+
+	if quota, err := tracker.Consume(ctx, "service"); quota != nil || err != nil {
+		t.Errorf("exempt user quota = %+v, %v; want none", quota, err)
+	}
+}
@@ -0,0 +1,66 @@
+package usage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/internal/storage/sqlite"
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+var ErrBudgetExceeded = errors.New("daily LLM token budget exceeded")
+
+type Tracker struct {
+	db               *sqlite.Client
+	dailyTokenBudget int
+}
+
+func NewTracker(db *sqlite.Client, dailyTokenBudget int) *Tracker {
+	return &Tracker{
+		db:               db,
+		dailyTokenBudget: dailyTokenBudget,
+	}
+}
+
+// Check fails once userID has used its daily budget. Callers resolve
+// anonymous requests to an identity first; an empty ID is budgeted like any
+// other, so it cannot be used to bypass the limit.
+func (t *Tracker) Check(userID string) error {
+	if t == nil || t.dailyTokenBudget <= 0 {
+		return nil
+	}
+
+	used, err := t.db.GetUserTokenUsage(userID, today())
+	if err != nil {
+		logger.Warn("Failed to read user token usage", zap.String("user_id", userID), zap.Error(err))
+		return nil
+	}
+
+	if used >= t.dailyTokenBudget {
+		logger.Warn("User token budget exceeded",
+			zap.String("user_id", userID),
+			zap.Int("used", used),
+			zap.Int("budget", t.dailyTokenBudget),
+		)
+		return fmt.Errorf("%w: used %d of %d tokens today", ErrBudgetExceeded, used, t.dailyTokenBudget)
+	}
+
+	return nil
+}
+
+func (t *Tracker) Record(userID string, tokens int) {
+	if t == nil || tokens <= 0 {
+		return
+	}
+
+	if err := t.db.AddUserTokenUsage(userID, today(), tokens); err != nil {
+		logger.Warn("Failed to record user token usage", zap.String("user_id", userID), zap.Error(err))
+	}
+}
+
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
@@ -3,12 +3,16 @@ package zilliz
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/milvus-io/milvus-sdk-go/v2/client"
 	"github.com/milvus-io/milvus-sdk-go/v2/entity"
 	"go.uber.org/zap"
 
+	"github.com/aws-agent/backend/internal/metrics"
 	"github.com/aws-agent/backend/pkg/circuitbreaker"
 	"github.com/aws-agent/backend/pkg/logger"
 	"github.com/aws-agent/backend/pkg/retry"
@@ -16,8 +20,14 @@ import (
 
 type Client struct {
 	client         client.Client
+	mu             sync.RWMutex
 	collectionName string
+	stagingName    string
+	writeStaging   bool
+	store          CollectionStore
 	vectorDim      int
+	indexType      string
+	metricType     entity.MetricType
 	cb             *circuitbreaker.CircuitBreaker
 	retryConfig    retry.Config
 }
@@ -40,10 +50,23 @@ type SearchResult struct {
 	AWSService string
 	DocType    string
 	Summary    string
-	Score      float32
+	// Score is the vector similarity. Chunks found only by keyword search
+	// have no similarity and are marked KeywordOnly instead.
+	Score       float32
+	KeywordOnly bool
 }
 
-func NewClient(endpoint, apiKey, collectionName string, vectorDim int) (*Client, error) {
+func NewClient(endpoint, apiKey, collectionName string, vectorDim int, indexType, metricType string, collections Collections) (*Client, error) {
+	normalizedIndex, err := normalizeIndexType(indexType)
+	if err != nil {
+		return nil, err
+	}
+
+	metric, err := parseMetricType(metricType)
+	if err != nil {
+		return nil, err
+	}
+
 	c, err := client.NewGrpcClient(
 		context.Background(),
 		endpoint,
@@ -58,6 +81,7 @@ func NewClient(endpoint, apiKey, collectionName string, vectorDim int) (*Client,
 		Timeout:          20 * time.Second,
 		FailureThreshold: 5,
 		SuccessThreshold: 2,
+		OnStateChange:    metrics.RecordCircuitBreakerState,
 		Logger:           logger.GetLogger(),
 	})
 
@@ -73,12 +97,18 @@ func NewClient(endpoint, apiKey, collectionName string, vectorDim int) (*Client,
 	logger.Info("Zilliz/Milvus client initialized",
 		zap.String("endpoint", endpoint),
 		zap.String("collection", collectionName),
+		zap.String("index_type", normalizedIndex),
+		zap.String("metric_type", string(metric)),
 	)
 
 	return &Client{
 		client:         c,
 		collectionName: collectionName,
+		stagingName:    collections.Staging,
+		writeStaging:   collections.IngestToStaging && collections.Staging != "",
 		vectorDim:      vectorDim,
+		indexType:      normalizedIndex,
+		metricType:     metric,
 		cb:             cb,
 		retryConfig:    retryConfig,
 	}, nil
@@ -88,19 +118,51 @@ func (z *Client) Close() error {
 	return z.client.Close()
 }
 
+// Ping checks the cluster is reachable and the active collection exists.
+func (z *Client) Ping(ctx context.Context) error {
+	active, _ := z.Collections()
+	has, err := z.client.HasCollection(ctx, active)
+	if err != nil {
+		return fmt.Errorf("failed to check collection: %w", err)
+	}
+	if !has {
+		return fmt.Errorf("collection %s does not exist", active)
+	}
+	return nil
+}
+
 func (z *Client) CreateCollection(ctx context.Context) error {
-	has, err := z.client.HasCollection(ctx, z.collectionName)
+	active, staging := z.Collections()
+
+	if err := z.createCollection(ctx, active); err != nil {
+		return err
+	}
+	if staging != "" {
+		return z.createCollection(ctx, staging)
+	}
+
+	return nil
+}
+
+func (z *Client) createCollection(ctx context.Context, name string) error {
+	has, err := z.client.HasCollection(ctx, name)
 	if err != nil {
 		return fmt.Errorf("failed to check collection: %w", err)
 	}
 
 	if has {
-		logger.Info("Collection already exists", zap.String("collection", z.collectionName))
+		if err := z.verifyDimension(ctx, name); err != nil {
+			return err
+		}
+		if err := z.verifyMetric(ctx, name); err != nil {
+			return err
+		}
+		logger.Info("Collection already exists", zap.String("collection", name))
 		return nil
 	}
 
 	schema := &entity.Schema{
-		CollectionName: z.collectionName,
+		CollectionName: name,
 		Description:    "AWS documentation embeddings",
 		Fields: []*entity.Field{
 			{
@@ -166,23 +228,38 @@ func (z *Client) CreateCollection(ctx context.Context) error {
 		return fmt.Errorf("failed to create collection: %w", err)
 	}
 
-	idx := entity.NewIndexIVFFlat(entity.L2, 1024)
-	err = z.client.CreateIndex(ctx, z.collectionName, "embedding", idx, false)
+	idx, err := buildIndex(z.indexType, z.metricType)
+	if err != nil {
+		return fmt.Errorf("failed to build index: %w", err)
+	}
+
+	err = z.client.CreateIndex(ctx, name, "embedding", idx, false)
 	if err != nil {
 		return fmt.Errorf("failed to create index: %w", err)
 	}
 
-	err = z.client.LoadCollection(ctx, z.collectionName, false)
+	err = z.client.LoadCollection(ctx, name, false)
 	if err != nil {
 		return fmt.Errorf("failed to load collection: %w", err)
 	}
 
-	logger.Info("Collection created and loaded", zap.String("collection", z.collectionName))
+	logger.Info("Collection created and loaded", zap.String("collection", name))
 
 	return nil
 }
 
 func (z *Client) Insert(ctx context.Context, chunks []DocumentChunk) error {
+	return z.insert(ctx, z.writeCollection(), chunks)
+}
+
+// InsertActive writes to the active collection even while ingestion is
+// directed at staging.
+func (z *Client) InsertActive(ctx context.Context, chunks []DocumentChunk) error {
+	active, _ := z.Collections()
+	return z.insert(ctx, active, chunks)
+}
+
+func (z *Client) insert(ctx context.Context, collection string, chunks []DocumentChunk) error {
 	if len(chunks) == 0 {
 		return nil
 	}
@@ -212,9 +289,9 @@ func (z *Client) Insert(ctx context.Context, chunks []DocumentChunk) error {
 				timestamps[i] = chunk.Timestamp.Unix()
 			}
 
-			_, err := z.client.Insert(
+			_, err := z.client.Upsert(
 				ctx,
-				z.collectionName,
+				collection,
 				"",
 				entity.NewColumnVarChar("chunk_id", chunkIDs),
 				entity.NewColumnFloatVector("embedding", z.vectorDim, embeddings),
@@ -227,15 +304,15 @@ func (z *Client) Insert(ctx context.Context, chunks []DocumentChunk) error {
 			)
 
 			if err != nil {
-				return fmt.Errorf("failed to insert chunks: %w", err)
+				return fmt.Errorf("failed to upsert chunks: %w", err)
 			}
 
-			err = z.client.Flush(ctx, z.collectionName, false)
+			err = z.client.Flush(ctx, collection, false)
 			if err != nil {
 				return fmt.Errorf("failed to flush: %w", err)
 			}
 
-			logger.Info("Chunks inserted into vector DB", zap.Int("count", len(chunks)))
+			logger.Info("Chunks upserted into vector DB", zap.Int("count", len(chunks)), zap.String("collection", collection))
 
 			return nil
 		})
@@ -246,32 +323,30 @@ func (z *Client) Search(ctx context.Context, queryEmbedding []float32, topK int,
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
+	expr, err := buildFilterExpr(filters)
+	if err != nil {
+		return nil, err
+	}
+
 	var results []SearchResult
+	collection, _ := z.Collections()
 
-	err := z.cb.Execute(ctx, func() error {
+	err = z.cb.Execute(ctx, func() error {
 		return retry.Do(ctx, z.retryConfig, func() error {
-			expr := ""
-			if service, ok := filters["aws_service"]; ok && service != "" {
-				expr = fmt.Sprintf(`aws_service == "%s"`, service)
-			}
-			if docType, ok := filters["doc_type"]; ok && docType != "" {
-				if expr != "" {
-					expr += " && "
-				}
-				expr += fmt.Sprintf(`doc_type == "%s"`, docType)
+			sp, err := buildSearchParam(z.indexType)
+			if err != nil {
+				return fmt.Errorf("failed to build search params: %w", err)
 			}
 
-			sp, _ := entity.NewIndexIVFFlatSearchParam(16)
-
 			searchResult, err := z.client.Search(
 				ctx,
-				z.collectionName,
+				collection,
 				[]string{},
 				expr,
 				[]string{"chunk_id", "text", "doc_url", "aws_service", "doc_type", "summary"},
 				[]entity.Vector{entity.FloatVector(queryEmbedding)},
 				"embedding",
-				entity.L2,
+				z.metricType,
 				topK,
 				sp,
 			)
@@ -281,29 +356,21 @@ func (z *Client) Search(ctx context.Context, queryEmbedding []float32, topK int,
 
 			results = make([]SearchResult, 0)
 			for _, sr := range searchResult {
-				for i := 0; i < sr.ResultCount; i++ {
-					chunkIDCol := sr.Fields.GetColumn("chunk_id")
-					textCol := sr.Fields.GetColumn("text")
-					docURLCol := sr.Fields.GetColumn("doc_url")
-					serviceCol := sr.Fields.GetColumn("aws_service")
-					docTypeCol := sr.Fields.GetColumn("doc_type")
-					summaryCol := sr.Fields.GetColumn("summary")
-
-					chunkID, _ := chunkIDCol.Get(i)
-					text, _ := textCol.Get(i)
-					docURL, _ := docURLCol.Get(i)
-					service, _ := serviceCol.Get(i)
-					docType, _ := docTypeCol.Get(i)
-					summary, _ := summaryCol.Get(i)
+				for i := 0; i < sr.ResultCount && i < len(sr.Scores); i++ {
+					chunkID := columnString(sr.Fields, "chunk_id", i)
+					if chunkID == "" {
+						logger.Warn("Skipping vector result without chunk_id", zap.Int("index", i))
+						continue
+					}
 
 					results = append(results, SearchResult{
-						ChunkID:    chunkID.(string),
-						Text:       text.(string),
-						DocURL:     docURL.(string),
-						AWSService: service.(string),
-						DocType:    docType.(string),
-						Summary:    summary.(string),
-						Score:      sr.Scores[i],
+						ChunkID:    chunkID,
+						Text:       columnString(sr.Fields, "text", i),
+						DocURL:     columnString(sr.Fields, "doc_url", i),
+						AWSService: columnString(sr.Fields, "aws_service", i),
+						DocType:    columnString(sr.Fields, "doc_type", i),
+						Summary:    columnString(sr.Fields, "summary", i),
+						Score:      similarityScore(z.metricType, sr.Scores[i]),
 					})
 				}
 			}
@@ -324,3 +391,85 @@ func (z *Client) Search(ctx context.Context, queryEmbedding []float32, topK int,
 
 	return results, nil
 }
+
+func columnString(fields client.ResultSet, name string, idx int) string {
+	col := fields.GetColumn(name)
+	if col == nil {
+		return ""
+	}
+
+	val, err := col.Get(idx)
+	if err != nil || val == nil {
+		return ""
+	}
+
+	s, _ := val.(string)
+	return s
+}
+
+func (z *Client) DeleteChunks(ctx context.Context, chunkIDs []string) error {
+	if len(chunkIDs) == 0 {
+		return nil
+	}
+
+	quoted := make([]string, len(chunkIDs))
+	for i, id := range chunkIDs {
+		quoted[i] = strconv.Quote(id)
+	}
+
+	return z.Delete(ctx, fmt.Sprintf("chunk_id in [%s]", strings.Join(quoted, ", ")))
+}
+
+// DeleteByDocument removes every chunk of a document, whose chunks are
+// named <docID>_chunk_<n>.
+func (z *Client) DeleteByDocument(ctx context.Context, docID string) error {
+	if docID == "" {
+		return fmt.Errorf("document ID is required")
+	}
+
+	return z.Delete(ctx, "chunk_id like "+strconv.Quote(docID+"_chunk_%"))
+}
+
+// Delete removes the vectors matching a boolean expression, e.g.
+// aws_service == "lambda", from the active collection and, when one is
+// configured, from staging too: a document deleted while a reindex fills
+// staging must not come back when staging is switched in. Callers build expr
+// themselves, so it must not contain unquoted user input; DeleteChunks and
+// DeleteByDocument quote their IDs.
+func (z *Client) Delete(ctx context.Context, expr string) error {
+	if expr == "" {
+		return fmt.Errorf("delete expression is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	active, staging := z.Collections()
+	collections := []string{active}
+	if staging != "" && staging != active {
+		collections = append(collections, staging)
+	}
+
+	return z.cb.Execute(ctx, func() error {
+		return retry.Do(ctx, z.retryConfig, func() error {
+			for _, collection := range collections {
+				err := z.client.Delete(ctx, collection, "", expr)
+				if err != nil {
+					return fmt.Errorf("failed to delete vectors from %s: %w", collection, err)
+				}
+
+				err = z.client.Flush(ctx, collection, false)
+				if err != nil {
+					return fmt.Errorf("failed to flush %s: %w", collection, err)
+				}
+			}
+
+			logger.Info("Vectors deleted from vector DB",
+				zap.String("expr", expr),
+				zap.Strings("collections", collections),
+			)
+
+			return nil
+		})
+	})
+}
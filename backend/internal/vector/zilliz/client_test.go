@@ -0,0 +1,235 @@
+package zilliz
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/client"
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+
+	"github.com/aws-agent/backend/pkg/circuitbreaker"
+	"github.com/aws-agent/backend/pkg/retry"
+)
+
+type deleteCall struct {
+	collection string
+	expr       string
+}
+
+// mockMilvus records the calls the client makes. Methods it does not
+// override panic through the nil embedded interface.
+type mockMilvus struct {
+	client.Client
+
+	mu      sync.Mutex
+	deletes []deleteCall
+	flushes []string
+
+	searchResults []client.SearchResult
+	indexMetric   entity.MetricType
+	searched      []string
+	rowCount      string
+}
+
+func (m *mockMilvus) Delete(ctx context.Context, collName, partitionName, expr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deletes = append(m.deletes, deleteCall{collection: collName, expr: expr})
+	return nil
+}
+
+func (m *mockMilvus) Flush(ctx context.Context, collName string, async bool, opts ...client.FlushOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushes = append(m.flushes, collName)
+	return nil
+}
+
+func (m *mockMilvus) Search(ctx context.Context, collName string, partitions []string, expr string,
+	outputFields []string, vectors []entity.Vector, vectorField string, metricType entity.MetricType,
+	topK int, sp entity.SearchParam, opts ...client.SearchQueryOptionFunc) ([]client.SearchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.searched = append(m.searched, collName)
+	return m.searchResults, nil
+}
+
+func (m *mockMilvus) GetCollectionStatistics(ctx context.Context, collName string) (map[string]string, error) {
+	return map[string]string{"row_count": m.rowCount}, nil
+}
+
+func (m *mockMilvus) HasCollection(ctx context.Context, collName string) (bool, error) {
+	return m.indexMetric != "", nil
+}
+
+func (m *mockMilvus) DescribeCollection(ctx context.Context, collName string) (*entity.Collection, error) {
+	return &entity.Collection{
+		Name: collName,
+		Schema: &entity.Schema{Fields: []*entity.Field{{
+			Name:       "embedding",
+			DataType:   entity.FieldTypeFloatVector,
+			TypeParams: map[string]string{entity.TypeParamDim: "8"},
+		}}},
+	}, nil
+}
+
+func (m *mockMilvus) DescribeIndex(ctx context.Context, collName string, fieldName string, opts ...client.IndexOption) ([]entity.Index, error) {
+	return []entity.Index{entity.NewGenericIndex("embedding", entity.IvfFlat, map[string]string{
+		"index_type":  "IVF_FLAT",
+		"metric_type": string(m.indexMetric),
+	})}, nil
+}
+
+func newTestClient(mock client.Client) *Client {
+	return &Client{
+		client:         mock,
+		collectionName: "docs",
+		stagingName:    "docs_staging",
+		vectorDim:      8,
+		indexType:      "IVF_FLAT",
+		metricType:     entity.L2,
+		cb:             circuitbreaker.NewCircuitBreaker("zilliz-test", circuitbreaker.Config{}),
+		retryConfig:    retry.Config{MaxAttempts: 1, InitialDelay: time.Millisecond},
+	}
+}
+
+func TestDelete(t *testing.T) {
+	mock := &mockMilvus{}
+	z := newTestClient(mock)
+
+	if err := z.Delete(context.Background(), `aws_service == "lambda"`); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	wantDeletes := []deleteCall{
+		{collection: "docs", expr: `aws_service == "lambda"`},
+		{collection: "docs_staging", expr: `aws_service == "lambda"`},
+	}
+	if !reflect.DeepEqual(mock.deletes, wantDeletes) {
+		t.Errorf("deletes = %+v, want %+v", mock.deletes, wantDeletes)
+	}
+	if !reflect.DeepEqual(mock.flushes, []string{"docs", "docs_staging"}) {
+		t.Errorf("flushes = %v, want both collections flushed", mock.flushes)
+	}
+}
+
+func TestDeleteWhileWritingStaging(t *testing.T) {
+	mock := &mockMilvus{}
+	z := newTestClient(mock)
+	z.writeStaging = true
+
+	if err := z.Delete(context.Background(), `chunk_id in ["a"]`); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	var collections []string
+	for _, call := range mock.deletes {
+		collections = append(collections, call.collection)
+	}
+	if !reflect.DeepEqual(collections, []string{"docs", "docs_staging"}) {
+		t.Errorf("deleted from %v, want the active and staging collections", collections)
+	}
+}
+
+func TestDeleteRequiresExpression(t *testing.T) {
+	mock := &mockMilvus{}
+	if err := newTestClient(mock).Delete(context.Background(), ""); err == nil {
+		t.Fatal("Delete with an empty expression succeeded")
+	}
+	if len(mock.deletes) != 0 {
+		t.Errorf("deletes = %+v, want none", mock.deletes)
+	}
+}
+
+func TestDeleteChunksQuotesIDs(t *testing.T) {
+	mock := &mockMilvus{}
+	if err := newTestClient(mock).DeleteChunks(context.Background(), []string{"a", `b"c`}); err != nil {
+		t.Fatalf("DeleteChunks: %v", err)
+	}
+
+	want := `chunk_id in ["a", "b\"c"]`
+	if len(mock.deletes) != 2 || mock.deletes[0].expr != want || mock.deletes[1].expr != want {
+		t.Errorf("deletes = %+v, want expression %s on both collections", mock.deletes, want)
+	}
+}
+
+func TestDeleteByDocument(t *testing.T) {
+	mock := &mockMilvus{}
+	if err := newTestClient(mock).DeleteByDocument(context.Background(), `doc"1`); err != nil {
+		t.Fatalf("DeleteByDocument: %v", err)
+	}
+
+	want := `chunk_id like "doc\"1_chunk_%"`
+	if len(mock.deletes) == 0 || mock.deletes[0].expr != want {
+		t.Errorf("deletes = %+v, want expression %s", mock.deletes, want)
+	}
+
+	if err := newTestClient(mock).DeleteByDocument(context.Background(), ""); err == nil {
+		t.Error("DeleteByDocument without a document ID succeeded")
+	}
+}
+
+func TestSearchToleratesMissingFields(t *testing.T) {
+	mock := &mockMilvus{
+		searchResults: []client.SearchResult{{
+			ResultCount: 3,
+			Scores:      []float32{0, 1, 2},
+			Fields: client.ResultSet{
+				entity.NewColumnVarChar("chunk_id", []string{"c1", "", "c3"}),
+				entity.NewColumnVarChar("text", []string{"one", "two", "three"}),
+				// summary was added after c3 was stored, so its value is null.
+				entity.NewColumnVarChar("summary", []string{"first"}),
+				// A column of the wrong type reads as empty rather than panicking.
+				entity.NewColumnInt64("doc_url", []int64{1, 2, 3}),
+			},
+		}},
+	}
+
+	results, err := newTestClient(mock).Search(context.Background(), make([]float32, 8), 3, nil)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("results = %+v, want the two rows with a chunk_id", results)
+	}
+	if results[0].ChunkID != "c1" || results[0].Text != "one" || results[0].Summary != "first" {
+		t.Errorf("first result = %+v, want c1 with its text and summary", results[0])
+	}
+	if results[1].ChunkID != "c3" || results[1].Text != "three" {
+		t.Errorf("second result = %+v, want c3 with its text", results[1])
+	}
+	for _, r := range results {
+		if r.DocURL != "" || r.AWSService != "" || r.DocType != "" {
+			t.Errorf("result %s = %+v, want missing and mistyped fields empty", r.ChunkID, r)
+		}
+	}
+	if results[1].Summary != "" {
+		t.Errorf("c3 summary = %q, want empty for the null value", results[1].Summary)
+	}
+}
+
+func TestCreateCollectionRefusesMetricMismatch(t *testing.T) {
+	z := newTestClient(&mockMilvus{indexMetric: entity.L2})
+	if err := z.CreateCollection(context.Background()); err != nil {
+		t.Fatalf("matching metric: %v", err)
+	}
+
+	z = newTestClient(&mockMilvus{indexMetric: entity.COSINE})
+	if err := z.CreateCollection(context.Background()); !errors.Is(err, ErrMetricMismatch) {
+		t.Errorf("error = %v, want ErrMetricMismatch", err)
+	}
+
+	// A collection indexed with L2 before COSINE became the default.
+	z = newTestClient(&mockMilvus{indexMetric: entity.L2})
+	z.metricType = entity.COSINE
+	err := z.CreateCollection(context.Background())
+	if !errors.Is(err, ErrMetricMismatch) || !strings.Contains(err.Error(), "zilliz.metricType to L2") {
+		t.Errorf("error = %v, want ErrMetricMismatch telling to set the metric to L2", err)
+	}
+}
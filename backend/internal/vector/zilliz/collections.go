@@ -0,0 +1,224 @@
+package zilliz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+	"go.uber.org/zap"
+
+	"github.com/aws-agent/backend/pkg/logger"
+)
+
+// ErrDimensionMismatch means an existing collection was built for a
+// different embedding dimension and must be reindexed.
+var ErrDimensionMismatch = errors.New("collection embedding dimension mismatch")
+
+// ErrMetricMismatch means an existing collection was indexed with a
+// different metric, so its scores would be read the wrong way round.
+var ErrMetricMismatch = errors.New("collection metric type mismatch")
+
+type Collections struct {
+	Staging         string
+	IngestToStaging bool
+}
+
+// CollectionStore persists which of the two collections is active, so a
+// switch survives restarts.
+type CollectionStore interface {
+	GetVectorCollections() (active, staging string, found bool, err error)
+	SaveVectorCollections(active, staging string) error
+}
+
+// WithCollectionStore persists collection switches to store. Call
+// RestoreCollections afterwards to apply a switch made before a restart.
+func (z *Client) WithCollectionStore(store CollectionStore) *Client {
+	z.store = store
+	return z
+}
+
+// RestoreCollections applies the persisted switch when it swapped the
+// configured active and staging collections. A persisted pair naming other
+// collections is ignored in favour of the configuration.
+func (z *Client) RestoreCollections() error {
+	if z.store == nil {
+		return nil
+	}
+
+	active, staging, found, err := z.store.GetVectorCollections()
+	if err != nil {
+		return fmt.Errorf("failed to load vector collections: %w", err)
+	}
+	if !found {
+		return nil
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	switch {
+	case active == z.collectionName && staging == z.stagingName:
+	case active == z.stagingName && staging == z.collectionName:
+		z.collectionName, z.stagingName = active, staging
+		z.writeStaging = false
+		logger.Info("Restored switched vector collection", zap.String("active", active), zap.String("staging", staging))
+	default:
+		logger.Warn("Persisted vector collections do not match the configuration, using the configured ones",
+			zap.String("persisted_active", active),
+			zap.String("configured_active", z.collectionName),
+		)
+	}
+
+	return nil
+}
+
+func (z *Client) Collections() (active, staging string) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	return z.collectionName, z.stagingName
+}
+
+func (z *Client) writeCollection() string {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	if z.writeStaging && z.stagingName != "" {
+		return z.stagingName
+	}
+	return z.collectionName
+}
+
+func (z *Client) SwitchToStaging(ctx context.Context) (string, error) {
+	_, staging := z.Collections()
+	if staging == "" {
+		return "", fmt.Errorf("no staging collection configured")
+	}
+
+	rows, err := z.collectionRowCount(ctx, staging)
+	if err != nil {
+		return "", err
+	}
+	if rows == 0 {
+		return "", fmt.Errorf("staging collection %s is empty", staging)
+	}
+
+	z.mu.Lock()
+	if z.stagingName != staging {
+		z.mu.Unlock()
+		return "", fmt.Errorf("staging collection changed during switch")
+	}
+	previous := z.collectionName
+	if z.store != nil {
+		if err := z.store.SaveVectorCollections(staging, previous); err != nil {
+			z.mu.Unlock()
+			return "", fmt.Errorf("failed to persist collection switch: %w", err)
+		}
+	}
+	z.collectionName, z.stagingName = staging, previous
+	z.writeStaging = false
+	z.mu.Unlock()
+
+	logger.Info("Vector collection switched",
+		zap.String("active", staging),
+		zap.String("previous", previous),
+		zap.Int64("rows", rows),
+	)
+
+	return previous, nil
+}
+
+// RecreateCollections drops the active and staging collections and creates
+// them empty with the configured dimension.
+func (z *Client) RecreateCollections(ctx context.Context) error {
+	active, staging := z.Collections()
+
+	for _, name := range []string{active, staging} {
+		if name == "" {
+			continue
+		}
+
+		has, err := z.client.HasCollection(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to check collection: %w", err)
+		}
+		if has {
+			if err := z.client.DropCollection(ctx, name); err != nil {
+				return fmt.Errorf("failed to drop collection %s: %w", name, err)
+			}
+			logger.Info("Vector collection dropped", zap.String("collection", name))
+		}
+
+		if err := z.createCollection(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (z *Client) collectionRowCount(ctx context.Context, name string) (int64, error) {
+	has, err := z.client.HasCollection(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check collection: %w", err)
+	}
+	if !has {
+		return 0, fmt.Errorf("collection %s does not exist", name)
+	}
+
+	stats, err := z.client.GetCollectionStatistics(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get collection statistics: %w", err)
+	}
+
+	rows, err := strconv.ParseInt(stats["row_count"], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse row count: %w", err)
+	}
+
+	return rows, nil
+}
+
+func (z *Client) verifyDimension(ctx context.Context, name string) error {
+	collection, err := z.client.DescribeCollection(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to describe collection: %w", err)
+	}
+
+	for _, field := range collection.Schema.Fields {
+		if field.Name != "embedding" {
+			continue
+		}
+
+		dim, err := strconv.Atoi(field.TypeParams[entity.TypeParamDim])
+		if err != nil {
+			return fmt.Errorf("failed to parse embedding dimension of %s: %w", name, err)
+		}
+		if dim != z.vectorDim {
+			return fmt.Errorf("%w: collection %s has dimension %d, configured %d", ErrDimensionMismatch, name, dim, z.vectorDim)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("collection %s has no embedding field", name)
+}
+
+func (z *Client) verifyMetric(ctx context.Context, name string) error {
+	indexes, err := z.client.DescribeIndex(ctx, name, "embedding")
+	if err != nil {
+		return fmt.Errorf("failed to describe index of %s: %w", name, err)
+	}
+
+	for _, idx := range indexes {
+		metric := idx.Params()["metric_type"]
+		if metric != "" && !strings.EqualFold(metric, string(z.metricType)) {
+			return fmt.Errorf("%w: collection %s is indexed with %s, configured %s; set zilliz.metricType to %s or reindex the collection",
+				ErrMetricMismatch, name, metric, z.metricType, strings.ToUpper(metric))
+		}
+	}
+
+	return nil
+}
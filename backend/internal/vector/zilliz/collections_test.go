@@ -0,0 +1,103 @@
+package zilliz
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+)
+
+// memoryStore is an in-memory CollectionStore.
+type memoryStore struct {
+	active, staging string
+	saved           bool
+	err             error
+}
+
+func (s *memoryStore) GetVectorCollections() (string, string, bool, error) {
+	return s.active, s.staging, s.saved, nil
+}
+
+func (s *memoryStore) SaveVectorCollections(active, staging string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.active, s.staging, s.saved = active, staging, true
+	return nil
+}
+
+func TestSwitchToStagingRedirectsSearches(t *testing.T) {
+	mock := &mockMilvus{indexMetric: entity.L2, rowCount: "42"}
+	store := &memoryStore{}
+	z := newTestClient(mock).WithCollectionStore(store)
+	ctx := context.Background()
+
+	if _, err := z.Search(ctx, make([]float32, 8), 5, nil); err != nil {
+		t.Fatalf("Search before switch: %v", err)
+	}
+
+	previous, err := z.SwitchToStaging(ctx)
+	if err != nil {
+		t.Fatalf("SwitchToStaging: %v", err)
+	}
+	if previous != "docs" {
+		t.Errorf("previous = %q, want docs", previous)
+	}
+
+	if _, err := z.Search(ctx, make([]float32, 8), 5, nil); err != nil {
+		t.Fatalf("Search after switch: %v", err)
+	}
+	if got := strings.Join(mock.searched, ","); got != "docs,docs_staging" {
+		t.Errorf("searched collections = %s, want the active one before and after the switch", got)
+	}
+	if store.active != "docs_staging" || store.staging != "docs" {
+		t.Errorf("persisted active %q, staging %q; want the switch saved", store.active, store.staging)
+	}
+
+	restarted := newTestClient(mock).WithCollectionStore(store)
+	if err := restarted.RestoreCollections(); err != nil {
+		t.Fatalf("RestoreCollections: %v", err)
+	}
+	if active, staging := restarted.Collections(); active != "docs_staging" || staging != "docs" {
+		t.Errorf("after restart active %q, staging %q; want the switch kept", active, staging)
+	}
+}
+
+func TestSwitchToStagingRefusals(t *testing.T) {
+	tests := []struct {
+		name     string
+		rowCount string
+		storeErr error
+		want     string
+	}{
+		{name: "empty staging", rowCount: "0", want: "is empty"},
+		{name: "persist failure", rowCount: "42", storeErr: errors.New("disk full"), want: "failed to persist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockMilvus{indexMetric: entity.L2, rowCount: tt.rowCount}
+			z := newTestClient(mock).WithCollectionStore(&memoryStore{err: tt.storeErr})
+
+			if _, err := z.SwitchToStaging(context.Background()); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+			if active, _ := z.Collections(); active != "docs" {
+				t.Errorf("active = %q after a refused switch, want docs", active)
+			}
+		})
+	}
+}
+
+func TestRestoreCollectionsIgnoresUnknownPair(t *testing.T) {
+	z := newTestClient(&mockMilvus{}).WithCollectionStore(&memoryStore{active: "old", staging: "older", saved: true})
+
+	if err := z.RestoreCollections(); err != nil {
+		t.Fatalf("RestoreCollections: %v", err)
+	}
+	if active, staging := z.Collections(); active != "docs" || staging != "docs_staging" {
+		t.Errorf("active %q, staging %q; want the configured collections", active, staging)
+	}
+}
@@ -0,0 +1,58 @@
+package zilliz
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// buildFilterExpr turns the Search filters map into a Milvus boolean
+// expression. "after" and "before" are unix seconds bounding the chunk
+// timestamp, both inclusive. String values are quoted so a filter value can
+// not break out of its comparison.
+func buildFilterExpr(filters map[string]string) (string, error) {
+	var clauses []string
+
+	if service := filters["aws_service"]; service != "" {
+		clauses = append(clauses, "aws_service == "+strconv.Quote(service))
+	}
+	if docType := filters["doc_type"]; docType != "" {
+		clauses = append(clauses, "doc_type == "+strconv.Quote(docType))
+	}
+
+	after, err := timestampFilter(filters, "after")
+	if err != nil {
+		return "", err
+	}
+	if after != nil {
+		clauses = append(clauses, fmt.Sprintf("timestamp >= %d", *after))
+	}
+
+	before, err := timestampFilter(filters, "before")
+	if err != nil {
+		return "", err
+	}
+	if before != nil {
+		clauses = append(clauses, fmt.Sprintf("timestamp <= %d", *before))
+	}
+
+	if after != nil && before != nil && *after > *before {
+		return "", fmt.Errorf("invalid timestamp range: after %d is later than before %d", *after, *before)
+	}
+
+	return strings.Join(clauses, " && "), nil
+}
+
+func timestampFilter(filters map[string]string, key string) (*int64, error) {
+	value := strings.TrimSpace(filters[key])
+	if value == "" {
+		return nil, nil
+	}
+
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s filter %q: must be a unix timestamp", key, value)
+	}
+
+	return &ts, nil
+}
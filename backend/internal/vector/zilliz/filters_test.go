@@ -0,0 +1,46 @@
+package zilliz
+
+import "testing"
+
+func TestBuildFilterExpr(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters map[string]string
+		want    string
+		wantErr bool
+	}{
+		{name: "none", filters: nil, want: ""},
+		{name: "service", filters: map[string]string{"aws_service": "Lambda"}, want: `aws_service == "Lambda"`},
+		{
+			name:    "service and type",
+			filters: map[string]string{"aws_service": "S3", "doc_type": "troubleshooting"},
+			want:    `aws_service == "S3" && doc_type == "troubleshooting"`,
+		},
+		{name: "after", filters: map[string]string{"after": "1700000000"}, want: "timestamp >= 1700000000"},
+		{
+			name:    "all",
+			filters: map[string]string{"aws_service": "EC2", "doc_type": "guide", "after": "100", "before": "200"},
+			want:    `aws_service == "EC2" && doc_type == "guide" && timestamp >= 100 && timestamp <= 200`,
+		},
+		{
+			name:    "quotes escaped",
+			filters: map[string]string{"aws_service": `Lambda" || aws_service != "`},
+			want:    `aws_service == "Lambda\" || aws_service != \""`,
+		},
+		{name: "backslash escaped", filters: map[string]string{"doc_type": `guide\`}, want: `doc_type == "guide\\"`},
+		{name: "bad timestamp", filters: map[string]string{"before": "yesterday"}, wantErr: true},
+		{name: "inverted range", filters: map[string]string{"after": "200", "before": "100"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildFilterExpr(tt.filters)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildFilterExpr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("buildFilterExpr() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package zilliz
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+)
+
+const (
+	IndexIVFFlat = "IVF_FLAT"
+	IndexIVFSQ8  = "IVF_SQ8"
+	IndexHNSW    = "HNSW"
+)
+
+func parseMetricType(name string) (entity.MetricType, error) {
+	switch strings.ToUpper(name) {
+	case "", "COSINE":
+		return entity.COSINE, nil
+	case "L2":
+		return entity.L2, nil
+	case "IP":
+		return entity.IP, nil
+	default:
+		return "", fmt.Errorf("unsupported metric type: %s", name)
+	}
+}
+
+// similarityScore converts a raw Milvus score into a similarity in [0,1]
+// where higher means more similar. COSINE and IP return similarities in
+// [-1,1] for normalized vectors; L2 returns a squared distance in [0,4].
+func similarityScore(metric entity.MetricType, raw float32) float32 {
+	var score float32
+	switch metric {
+	case entity.L2:
+		score = 1 - raw/4
+	default:
+		score = (raw + 1) / 2
+	}
+
+	if score < 0 {
+		return 0
+	}
+	if score > 1 {
+		return 1
+	}
+	return score
+}
+
+func normalizeIndexType(indexType string) (string, error) {
+	switch strings.ToUpper(indexType) {
+	case "", IndexIVFFlat:
+		return IndexIVFFlat, nil
+	case IndexIVFSQ8:
+		return IndexIVFSQ8, nil
+	case IndexHNSW:
+		return IndexHNSW, nil
+	default:
+		return "", fmt.Errorf("unsupported index type: %s", indexType)
+	}
+}
+
+func buildIndex(indexType string, metric entity.MetricType) (entity.Index, error) {
+	switch indexType {
+	case IndexIVFFlat:
+		return entity.NewIndexIvfFlat(metric, 1024)
+	case IndexIVFSQ8:
+		return entity.NewIndexIvfSQ8(metric, 1024)
+	case IndexHNSW:
+		return entity.NewIndexHNSW(metric, 16, 200)
+	default:
+		return nil, fmt.Errorf("unsupported index type: %s", indexType)
+	}
+}
+
+func buildSearchParam(indexType string) (entity.SearchParam, error) {
+	switch indexType {
+	case IndexIVFFlat:
+		return entity.NewIndexIvfFlatSearchParam(16)
+	case IndexIVFSQ8:
+		return entity.NewIndexIvfSQ8SearchParam(16)
+	case IndexHNSW:
+		return entity.NewIndexHNSWSearchParam(64)
+	default:
+		return nil, fmt.Errorf("unsupported index type: %s", indexType)
+	}
+}
@@ -0,0 +1,101 @@
+package zilliz
+
+import (
+	"testing"
+
+	"github.com/milvus-io/milvus-sdk-go/v2/entity"
+)
+
+func TestBuildIndexForEachType(t *testing.T) {
+	tests := []struct {
+		config   string
+		wantType entity.IndexType
+	}{
+		{config: "", wantType: entity.IvfFlat},
+		{config: "ivf_flat", wantType: entity.IvfFlat},
+		{config: "IVF_SQ8", wantType: entity.IvfSQ8},
+		{config: "HNSW", wantType: entity.HNSW},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.config, func(t *testing.T) {
+			indexType, err := normalizeIndexType(tt.config)
+			if err != nil {
+				t.Fatalf("normalizeIndexType(%q): %v", tt.config, err)
+			}
+
+			for _, metric := range []entity.MetricType{entity.L2, entity.IP, entity.COSINE} {
+				idx, err := buildIndex(indexType, metric)
+				if err != nil {
+					t.Fatalf("buildIndex(%s, %s): %v", indexType, metric, err)
+				}
+				if idx.IndexType() != tt.wantType {
+					t.Errorf("index type = %s, want %s", idx.IndexType(), tt.wantType)
+				}
+				if got := idx.Params()["metric_type"]; got != string(metric) {
+					t.Errorf("metric_type = %q, want %q", got, metric)
+				}
+			}
+
+			if _, err := buildSearchParam(indexType); err != nil {
+				t.Errorf("buildSearchParam(%s): %v", indexType, err)
+			}
+		})
+	}
+
+	if _, err := normalizeIndexType("DISKANN"); err == nil {
+		t.Error("normalizeIndexType accepted an unsupported index type")
+	}
+}
+
+func TestParseMetricTypeDefaultsToCosine(t *testing.T) {
+	metric, err := parseMetricType("")
+	if err != nil || metric != entity.COSINE {
+		t.Errorf("parseMetricType(\"\") = %v, %v; want COSINE", metric, err)
+	}
+	if metric, err := parseMetricType("l2"); err != nil || metric != entity.L2 {
+		t.Errorf("parseMetricType(\"l2\") = %v, %v; want L2", metric, err)
+	}
+	if _, err := parseMetricType("HAMMING"); err == nil {
+		t.Error("parseMetricType accepted an unsupported metric")
+	}
+}
+
+func TestSimilarityScoreKnownVectors(t *testing.T) {
+	// Unit vectors: a and b are identical, c is orthogonal to a and d is
+	// opposite. Milvus reports COSINE and IP as the dot product and L2 as the
+	// squared distance.
+	tests := []struct {
+		name   string
+		metric entity.MetricType
+		raw    float32
+		want   float32
+	}{
+		{name: "cosine identical", metric: entity.COSINE, raw: 1, want: 1},
+		{name: "cosine orthogonal", metric: entity.COSINE, raw: 0, want: 0.5},
+		{name: "cosine opposite", metric: entity.COSINE, raw: -1, want: 0},
+		{name: "ip identical", metric: entity.IP, raw: 1, want: 1},
+		{name: "l2 identical", metric: entity.L2, raw: 0, want: 1},
+		{name: "l2 orthogonal", metric: entity.L2, raw: 2, want: 0.5},
+		{name: "l2 opposite", metric: entity.L2, raw: 4, want: 0},
+		{name: "l2 clamped", metric: entity.L2, raw: 5, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := similarityScore(tt.metric, tt.raw); got != tt.want {
+				t.Errorf("similarityScore(%s, %v) = %v, want %v", tt.metric, tt.raw, got, tt.want)
+			}
+		})
+	}
+
+	// Closer vectors must score higher under every metric.
+	for _, metric := range []entity.MetricType{entity.COSINE, entity.IP} {
+		if similarityScore(metric, 0.9) <= similarityScore(metric, 0.1) {
+			t.Errorf("%s: a higher raw similarity scored lower", metric)
+		}
+	}
+	if similarityScore(entity.L2, 0.1) <= similarityScore(entity.L2, 0.9) {
+		t.Error("L2: a smaller distance scored lower")
+	}
+}
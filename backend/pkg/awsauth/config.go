@@ -0,0 +1,59 @@
+package awsauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// LoadConfig resolves the region and credentials through the AWS SDK default
+// chain: environment variables, the shared config and credentials files, SSO
+// and web identity, then the container or instance role. A non-empty region
+// overrides the chain's region.
+func LoadConfig(ctx context.Context, region string) (aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return aws.Config{}, fmt.Errorf("no AWS region configured")
+	}
+
+	return cfg, nil
+}
+
+// Sign signs req with SigV4 for service, using credentials and the region
+// from cfg.
+func Sign(ctx context.Context, cfg aws.Config, req *http.Request, payload []byte, service string) error {
+	if cfg.Credentials == nil {
+		return fmt.Errorf("no AWS credentials configured")
+	}
+
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, sha256Hex(payload), service, cfg.Region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,85 @@
+package awsauth
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// isolateAWSEnv points the SDK default chain at files under a temp dir and
+// clears ambient credentials, so tests only see what they configure.
+func isolateAWSEnv(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_PROFILE", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	return dir
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := isolateAWSEnv(t)
+	ctx := context.Background()
+
+	if _, err := LoadConfig(ctx, ""); err == nil || !strings.Contains(err.Error(), "region") {
+		t.Errorf("error = %v, want a missing region error", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "config"), []byte("[default]\nregion = ap-south-1\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	cfg, err := LoadConfig(ctx, "")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Region != "ap-south-1" {
+		t.Errorf("region = %q, want the shared config region", cfg.Region)
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil || creds.AccessKeyID != "AKIDENV" {
+		t.Errorf("credentials = %+v, err = %v; want the environment credentials", creds, err)
+	}
+
+	if cfg, err := LoadConfig(ctx, "us-west-2"); err != nil || cfg.Region != "us-west-2" {
+		t.Errorf("region = %q, err = %v; want the override", cfg.Region, err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	req, _ := http.NewRequest("POST", "https://ec2.us-east-1.amazonaws.com/", strings.NewReader("Action=DescribeVpcs"))
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDTEST", "secret", ""),
+	}
+
+	if err := Sign(context.Background(), cfg, req, []byte("Action=DescribeVpcs"), "ec2"); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if auth := req.Header.Get("Authorization"); !strings.Contains(auth, "Credential=AKIDTEST/") || !strings.Contains(auth, "/us-east-1/ec2/aws4_request") {
+		t.Errorf("authorization = %q", auth)
+	}
+	if req.Header.Get("X-Amz-Date") == "" {
+		t.Error("request has no X-Amz-Date header")
+	}
+
+	if err := Sign(context.Background(), aws.Config{Region: "us-east-1"}, req, nil, "ec2"); err == nil {
+		t.Error("signed a request without credentials")
+	}
+}
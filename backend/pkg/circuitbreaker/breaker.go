@@ -36,13 +36,13 @@ func (s State) String() string {
 }
 
 type Config struct {
-	MaxRequests       uint32
-	Interval          time.Duration
-	Timeout           time.Duration
-	FailureThreshold  uint32
-	SuccessThreshold  uint32
-	OnStateChange     func(name string, from State, to State)
-	Logger            *zap.Logger
+	MaxRequests      uint32
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold uint32
+	SuccessThreshold uint32
+	OnStateChange    func(name string, from State, to State)
+	Logger           *zap.Logger
 }
 
 type CircuitBreaker struct {
@@ -55,11 +55,11 @@ type CircuitBreaker struct {
 	onStateChange    func(name string, from State, to State)
 	logger           *zap.Logger
 
-	mu              sync.Mutex
-	state           State
-	generation      uint64
-	counts          counts
-	expiry          time.Time
+	mu         sync.Mutex
+	state      State
+	generation uint64
+	counts     counts
+	expiry     time.Time
 }
 
 type counts struct {
@@ -99,6 +99,11 @@ func NewCircuitBreaker(name string, cfg Config) *CircuitBreaker {
 	}
 
 	cb.toNewGeneration(time.Now())
+	register(cb)
+
+	if cb.onStateChange != nil {
+		cb.onStateChange(cb.name, cb.state, cb.state)
+	}
 
 	return cb
 }
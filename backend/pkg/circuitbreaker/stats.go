@@ -0,0 +1,72 @@
+package circuitbreaker
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Stats struct {
+	Name                 string
+	State                State
+	Generation           uint64
+	Requests             uint32
+	TotalSuccesses       uint32
+	TotalFailures        uint32
+	ConsecutiveSuccesses uint32
+	ConsecutiveFailures  uint32
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*CircuitBreaker)
+)
+
+func register(cb *CircuitBreaker) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[cb.name] = cb
+}
+
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+func (cb *CircuitBreaker) Stats() Stats {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	state, generation := cb.currentState(time.Now())
+
+	return Stats{
+		Name:                 cb.name,
+		State:                state,
+		Generation:           generation,
+		Requests:             cb.counts.Requests,
+		TotalSuccesses:       cb.counts.TotalSuccesses,
+		TotalFailures:        cb.counts.TotalFailures,
+		ConsecutiveSuccesses: cb.counts.ConsecutiveSuccesses,
+		ConsecutiveFailures:  cb.counts.ConsecutiveFailures,
+	}
+}
+
+func Snapshot() []Stats {
+	registryMu.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(registry))
+	for _, cb := range registry {
+		breakers = append(breakers, cb)
+	}
+	registryMu.Unlock()
+
+	stats := make([]Stats, 0, len(breakers))
+	for _, cb := range breakers {
+		stats = append(stats, cb.Stats())
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats
+}
@@ -2,30 +2,44 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Neo4j    Neo4jConfig
-	Zilliz   ZillizConfig
-	SQLite   SQLiteConfig
-	Redis    RedisConfig
-	LLM      LLMConfig
-	Search   SearchConfig
-	Logging  LoggingConfig
+	Server      ServerConfig
+	Neo4j       Neo4jConfig
+	Zilliz      ZillizConfig
+	SQLite      SQLiteConfig
+	Redis       RedisConfig
+	LLM         LLMConfig
+	Search      SearchConfig
+	Query       QueryConfig
+	Ingestion   IngestionConfig
+	KG          KGConfig
+	Actions     ActionsConfig
+	Evaluation  EvaluationConfig
+	Health      HealthConfig
+	Maintenance MaintenanceConfig
+	Users       UsersConfig
+	Quota       QuotaConfig
+	Logging     LoggingConfig
 }
 
 type ServerConfig struct {
-	Host           string
-	Port           int
-	ReadTimeout    int
-	WriteTimeout   int
-	BodyLimit      int
-	AllowedOrigins string
-	Environment    string
+	Host         string
+	Port         int
+	ReadTimeout  int
+	WriteTimeout int
+	BodyLimit    int
+	// AllowedOrigins are the browser origins allowed by CORS, such as
+	// "https://app.example.com". "*" allows any origin and cannot be
+	// combined with AllowCredentials.
+	AllowedOrigins   []string
+	AllowCredentials bool
+	Environment      string
 }
 
 type Neo4jConfig struct {
@@ -36,11 +50,14 @@ type Neo4jConfig struct {
 }
 
 type ZillizConfig struct {
-	Endpoint       string
-	APIKey         string
-	CollectionName string
-	VectorDim      int
-	IndexType      string
+	Endpoint          string
+	APIKey            string
+	CollectionName    string
+	StagingCollection string
+	IngestToStaging   bool
+	VectorDim         int
+	IndexType         string
+	MetricType        string
 }
 
 type SQLiteConfig struct {
@@ -48,28 +65,171 @@ type SQLiteConfig struct {
 }
 
 type RedisConfig struct {
-	Host     string
-	Port     int
-	Password string
-	DB       int
+	Host                 string
+	Port                 int
+	Password             string
+	DB                   int
+	QueryCacheTTLSec     int
+	EmbeddingCacheTTLSec int
+	WebSearchCacheTTLSec int
 }
 
 type LLMConfig struct {
-	Provider      string
-	Model         string
-	APIKey        string
-	Temperature   float32
-	MaxTokens     int
-	TimeoutSec    int
-	EmbeddingModel string
-	EmbeddingDim   int
+	Provider              string
+	Model                 string
+	APIKey                string
+	Temperature           float32
+	MaxTokens             int
+	TimeoutSec            int
+	EmbeddingModel        string
+	EmbeddingDim          int
+	EmbeddingProvider     string
+	EmbeddingAPIKey       string
+	Region                string
+	Pricing               map[string]ModelPrice
+	MaxConcurrentRequests int
+	EmbeddingConcurrency  int
+}
+
+type ModelPrice struct {
+	InputPer1K  float64
+	OutputPer1K float64
 }
 
 type SearchConfig struct {
-	Enabled        bool
-	SerpAPIKey     string
-	MaxResults     int
-	TimeoutSec     int
+	Enabled          bool
+	SerpAPIKey       string
+	MaxResults       int
+	TimeoutSec       int
+	ScrapeTimeoutSec int
+	MaxScrapeBytes   int64
+	MaxScrapeChars   int
+	MaxContextChars  int
+	AutoIngest       bool
+	AllowedDomains   []string
+}
+
+type QueryConfig struct {
+	UnknownServiceStrategy    string
+	DailyTokenBudget          int
+	HistoryResponseMaxChars   int
+	FusionK                   float64
+	MaxContextResults         int
+	VectorTopK                int
+	FollowUpsEnabled          bool
+	FollowUpMinConfidence     float64
+	MaxFollowUps              int
+	ContextChunkMaxTokens     int
+	MaxPromptTokens           int
+	ContextWindowTokens       int
+	PromptHeadroomTokens      int
+	EncodedQueryThreshold     float64
+	LLMEntityExtraction       bool
+	EntityExtractionTimeoutMS int
+	EntityCacheTTLSec         int
+	MaxLLMCallsPerRequest     int
+	CalibrationIntervalSec    int
+	CalibrationMinSamples     int
+	CalibrationMaxSamples     int
+	ConversationTTLSec        int
+	ConversationMaxTurns      int
+	ConversationMaxTokens     int
+	SemanticCacheEnabled      bool
+	SemanticCacheThreshold    float64
+	SemanticCacheMaxEntries   int
+	RerankEnabled             bool
+	RerankTimeoutMS           int
+	RerankMaxCandidates       int
+	DisclaimerEnabled         bool
+	DisclaimerPosition        string
+	DestructiveDisclaimer     string
+	HybridSearchEnabled       bool
+	KeywordSearchLimit        int
+	FusionWeights             map[string]FusionWeightConfig
+}
+
+type FusionWeightConfig struct {
+	KG     float64
+	Vector float64
+}
+
+type IngestionConfig struct {
+	Workers            int
+	QueueSize          int
+	AllowedDomains     []string
+	AllowedPaths       []string
+	MaxSitemapPages    int
+	MinContentChars    int
+	BatchConcurrency   int
+	MaxBatchSize       int
+	ClassifyDocTypes   bool
+	DocTypeCacheTTLSec int
+	DropBlankChunks    bool
+	ChunkSize          int
+	ChunkOverlap       int
+	MaxContentBytes    int
+}
+
+type KGConfig struct {
+	SeedConceptsPath     string
+	ReplaceSeedConcepts  bool
+	MaxRelationsPerDoc   int
+	StatsRefreshSec      int
+	AutoCreateEntities   bool
+	AutoCreateConfidence float64
+	MaxKnownEntities     int
+	MaxExtractionTokens  int
+	WriteBatchSize       int
+	EntityMergeEnabled   bool
+	EntityMergeThreshold float64
+}
+
+type ActionsConfig struct {
+	ApprovalWebhookURL  string
+	ApprovalSecret      string
+	ApprovalTimeoutSec  int
+	VerifyPrerequisites bool
+	DryRun              bool
+	Region              string
+}
+
+type EvaluationConfig struct {
+	CosineDowngradeThreshold float64
+	Concurrency              int
+	MaxDatasetItems          int
+}
+
+type HealthConfig struct {
+	SelfTestEnabled     bool
+	SelfTestToken       string
+	SelfTestIntervalSec int
+	ReadyTimeoutMS      int
+}
+
+type MaintenanceConfig struct {
+	Enabled             bool
+	Token               string
+	VacuumIntervalSec   int
+	MaxIngestionBacklog int
+}
+
+type UsersConfig struct {
+	AnonymousMode string
+	AnonymousID   string
+	// IdentityHeader names the header an authenticating proxy sets to the
+	// signed-in user. Approval requesters and approvers are taken only from
+	// it; empty means no caller is authenticated.
+	IdentityHeader string
+}
+
+type QuotaConfig struct {
+	DailyQueryLimit int
+	Overrides       []QuotaOverride
+}
+
+type QuotaOverride struct {
+	UserID          string
+	DailyQueryLimit int
 }
 
 type LoggingConfig struct {
@@ -102,15 +262,82 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
 	return &config, nil
 }
 
+func (c *Config) validate() error {
+	origins, err := normalizeOrigins(c.Server.AllowedOrigins)
+	if err != nil {
+		return err
+	}
+	c.Server.AllowedOrigins = origins
+	for _, origin := range origins {
+		if origin == "*" && c.Server.AllowCredentials {
+			return fmt.Errorf("server.allowedOrigins cannot contain \"*\" when server.allowCredentials is enabled")
+		}
+	}
+
+	if c.Ingestion.ChunkSize <= 0 {
+		return fmt.Errorf("ingestion.chunkSize must be positive, got %d", c.Ingestion.ChunkSize)
+	}
+	if c.Ingestion.ChunkOverlap < 0 || c.Ingestion.ChunkOverlap >= c.Ingestion.ChunkSize {
+		return fmt.Errorf("ingestion.chunkOverlap must be at least 0 and smaller than ingestion.chunkSize (%d), got %d",
+			c.Ingestion.ChunkSize, c.Ingestion.ChunkOverlap)
+	}
+
+	if c.Zilliz.VectorDim <= 0 {
+		return fmt.Errorf("zilliz.vectorDim must be positive, got %d", c.Zilliz.VectorDim)
+	}
+	if c.LLM.EmbeddingDim > 0 && c.LLM.EmbeddingDim != c.Zilliz.VectorDim {
+		return fmt.Errorf("llm.embeddingDim (%d) must match zilliz.vectorDim (%d)", c.LLM.EmbeddingDim, c.Zilliz.VectorDim)
+	}
+
+	switch c.Query.UnknownServiceStrategy {
+	case "unfiltered", "classify", "clarify":
+	default:
+		return fmt.Errorf("query.unknownServiceStrategy must be one of unfiltered, classify or clarify, got %q",
+			c.Query.UnknownServiceStrategy)
+	}
+
+	switch c.Users.AnonymousMode {
+	case "shared", "ip":
+	default:
+		return fmt.Errorf("users.anonymousMode must be one of shared or ip, got %q", c.Users.AnonymousMode)
+	}
+
+	if c.Actions.ApprovalWebhookURL != "" && unsetSecret(c.Actions.ApprovalSecret) {
+		return fmt.Errorf("actions.approvalSecret must be set when actions.approvalWebhookURL is configured")
+	}
+	if c.Actions.ApprovalWebhookURL != "" && c.Users.IdentityHeader == "" {
+		return fmt.Errorf("users.identityHeader must be set when actions.approvalWebhookURL is configured")
+	}
+
+	if c.Search.ScrapeTimeoutSec >= c.Search.TimeoutSec {
+		return fmt.Errorf("search.scrapeTimeoutSec (%d) must be shorter than search.timeoutSec (%d)",
+			c.Search.ScrapeTimeoutSec, c.Search.TimeoutSec)
+	}
+	return nil
+}
+
+// unsetSecret reports whether a secret is empty or still holds an unexpanded
+// ${VAR} placeholder from the config file.
+func unsetSecret(secret string) bool {
+	secret = strings.TrimSpace(secret)
+	return secret == "" || strings.HasPrefix(secret, "${")
+}
+
 func setDefaults() {
 	viper.SetDefault("server.host", "0.0.0.0")
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.readTimeout", 30)
 	viper.SetDefault("server.writeTimeout", 30)
 	viper.SetDefault("server.bodyLimit", 10485760)
+	viper.SetDefault("server.allowedOrigins", []string{"http://localhost:3000"})
+	viper.SetDefault("server.allowCredentials", true)
 
 	viper.SetDefault("neo4j.uri", "bolt://localhost:7687")
 	viper.SetDefault("neo4j.username", "neo4j")
@@ -119,14 +346,20 @@ func setDefaults() {
 
 	viper.SetDefault("zilliz.endpoint", "localhost:19530")
 	viper.SetDefault("zilliz.collectionName", "aws_docs")
+	viper.SetDefault("zilliz.stagingCollection", "")
+	viper.SetDefault("zilliz.ingestToStaging", false)
 	viper.SetDefault("zilliz.vectorDim", 1536)
 	viper.SetDefault("zilliz.indexType", "IVF_FLAT")
+	viper.SetDefault("zilliz.metricType", "COSINE")
 
 	viper.SetDefault("sqlite.path", "./data/awsrag.db")
 
 	viper.SetDefault("redis.host", "localhost")
 	viper.SetDefault("redis.port", 6379)
 	viper.SetDefault("redis.db", 0)
+	viper.SetDefault("redis.queryCacheTTLSec", 3600)
+	viper.SetDefault("redis.embeddingCacheTTLSec", 604800)
+	viper.SetDefault("redis.webSearchCacheTTLSec", 900)
 
 	viper.SetDefault("llm.provider", "openai")
 	viper.SetDefault("llm.model", "gpt-4")
@@ -135,12 +368,138 @@ func setDefaults() {
 	viper.SetDefault("llm.timeoutSec", 60)
 	viper.SetDefault("llm.embeddingModel", "text-embedding-3-large")
 	viper.SetDefault("llm.embeddingDim", 1536)
+	viper.SetDefault("llm.maxConcurrentRequests", 0)
+	viper.SetDefault("llm.embeddingConcurrency", 1)
 
-	viper.SetDefault("search.enabled", true)
+	viper.SetDefault("search.enabled", false)
 	viper.SetDefault("search.maxResults", 5)
 	viper.SetDefault("search.timeoutSec", 10)
+	viper.SetDefault("search.scrapeTimeoutSec", 5)
+	viper.SetDefault("search.maxScrapeBytes", 1048576)
+	viper.SetDefault("search.maxScrapeChars", 5000)
+	viper.SetDefault("search.maxContextChars", 8000)
+	viper.SetDefault("search.autoIngest", false)
+	viper.SetDefault("search.allowedDomains", []string{"docs.aws.amazon.com", "repost.aws", "stackoverflow.com"})
+
+	viper.SetDefault("query.unknownServiceStrategy", "unfiltered")
+	viper.SetDefault("query.dailyTokenBudget", 0)
+	viper.SetDefault("query.historyResponseMaxChars", 0)
+	viper.SetDefault("query.fusionK", 60)
+	viper.SetDefault("query.maxContextResults", 10)
+	viper.SetDefault("query.vectorTopK", 10)
+	viper.SetDefault("query.followUpsEnabled", false)
+	viper.SetDefault("query.followUpMinConfidence", 0.6)
+	viper.SetDefault("query.maxFollowUps", 3)
+	viper.SetDefault("query.contextChunkMaxTokens", 300)
+	viper.SetDefault("query.maxPromptTokens", 6000)
+	viper.SetDefault("query.contextWindowTokens", 0)
+	viper.SetDefault("query.promptHeadroomTokens", 200)
+	viper.SetDefault("query.encodedQueryThreshold", 0.5)
+	viper.SetDefault("query.llmEntityExtraction", false)
+	viper.SetDefault("query.entityExtractionTimeoutMS", 3000)
+	viper.SetDefault("query.entityCacheTTLSec", 86400)
+	viper.SetDefault("query.maxLLMCallsPerRequest", 6)
+	viper.SetDefault("query.calibrationIntervalSec", 0)
+	viper.SetDefault("query.calibrationMinSamples", 50)
+	viper.SetDefault("query.calibrationMaxSamples", 5000)
+	viper.SetDefault("query.conversationTTLSec", 1800)
+	viper.SetDefault("query.conversationMaxTurns", 6)
+	viper.SetDefault("query.conversationMaxTokens", 800)
+	viper.SetDefault("query.semanticCacheEnabled", false)
+	viper.SetDefault("query.semanticCacheThreshold", 0.95)
+	viper.SetDefault("query.semanticCacheMaxEntries", 200)
+	viper.SetDefault("query.rerankEnabled", false)
+	viper.SetDefault("query.rerankTimeoutMS", 5000)
+	viper.SetDefault("query.rerankMaxCandidates", 10)
+	viper.SetDefault("query.disclaimerEnabled", true)
+	viper.SetDefault("query.disclaimerPosition", "append")
+	viper.SetDefault("query.destructiveDisclaimer", "")
+	viper.SetDefault("query.hybridSearchEnabled", false)
+	viper.SetDefault("query.keywordSearchLimit", 10)
+	viper.SetDefault("query.fusionWeights", map[string]interface{}{
+		"conceptual":      map[string]interface{}{"kg": 1.5, "vector": 0.75},
+		"troubleshooting": map[string]interface{}{"kg": 0.75, "vector": 1.5},
+		"howto":           map[string]interface{}{"kg": 1.0, "vector": 1.25},
+		"general":         map[string]interface{}{"kg": 1.0, "vector": 1.0},
+	})
+
+	viper.SetDefault("ingestion.workers", 2)
+	viper.SetDefault("ingestion.queueSize", 1000)
+	viper.SetDefault("ingestion.allowedDomains", []string{"docs.aws.amazon.com"})
+	viper.SetDefault("ingestion.maxSitemapPages", 500)
+	viper.SetDefault("ingestion.minContentChars", 200)
+	viper.SetDefault("ingestion.batchConcurrency", 4)
+	viper.SetDefault("ingestion.maxBatchSize", 100)
+	viper.SetDefault("ingestion.classifyDocTypes", false)
+	viper.SetDefault("ingestion.docTypeCacheTTLSec", 604800)
+	viper.SetDefault("ingestion.dropBlankChunks", true)
+	viper.SetDefault("ingestion.chunkSize", 1000)
+	viper.SetDefault("ingestion.chunkOverlap", 100)
+	viper.SetDefault("ingestion.maxContentBytes", 10485760)
+
+	viper.SetDefault("kg.maxRelationsPerDoc", 50)
+	viper.SetDefault("kg.statsRefreshSec", 300)
+	viper.SetDefault("kg.autoCreateEntities", false)
+	viper.SetDefault("kg.autoCreateConfidence", 0.3)
+	viper.SetDefault("kg.maxKnownEntities", 500)
+	viper.SetDefault("kg.maxExtractionTokens", 1500)
+	viper.SetDefault("kg.writeBatchSize", 100)
+	viper.SetDefault("kg.entityMergeEnabled", false)
+	viper.SetDefault("kg.entityMergeThreshold", 0.95)
+
+	viper.SetDefault("actions.approvalTimeoutSec", 900)
+	viper.SetDefault("actions.verifyPrerequisites", true)
+	viper.SetDefault("actions.dryRun", true)
+	viper.SetDefault("actions.region", "")
+
+	viper.SetDefault("evaluation.cosineDowngradeThreshold", 0.5)
+	viper.SetDefault("evaluation.concurrency", 2)
+	viper.SetDefault("evaluation.maxDatasetItems", 500)
+
+	viper.SetDefault("health.selfTestEnabled", false)
+	viper.SetDefault("health.selfTestIntervalSec", 60)
+	viper.SetDefault("health.readyTimeoutMS", 2000)
+
+	viper.SetDefault("maintenance.enabled", false)
+	viper.SetDefault("maintenance.vacuumIntervalSec", 3600)
+	viper.SetDefault("maintenance.maxIngestionBacklog", 0)
+
+	viper.SetDefault("users.anonymousMode", "shared")
+	viper.SetDefault("users.anonymousID", "anonymous")
+	viper.SetDefault("users.identityHeader", "")
+
+	viper.SetDefault("quota.dailyQueryLimit", 0)
 
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
 	viper.SetDefault("logging.outputPath", "stdout")
 }
+
+// normalizeOrigins trims and checks each CORS origin. An origin is "*" or a
+// scheme and host with an optional port, without path, query or trailing
+// slash, which is how browsers send the Origin header.
+func normalizeOrigins(origins []string) ([]string, error) {
+	normalized := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			normalized = append(normalized, origin)
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || strings.HasSuffix(origin, "?") {
+			return nil, fmt.Errorf("server.allowedOrigins entry %q is not a valid origin such as https://app.example.com", origin)
+		}
+		normalized = append(normalized, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("server.allowedOrigins must contain at least one origin")
+	}
+	return normalized, nil
+}
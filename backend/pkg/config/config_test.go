@@ -0,0 +1,214 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// validConfig returns a config that passes validate, for tests to break one
+// setting at a time.
+func validConfig() *Config {
+	c := &Config{}
+	c.Server.AllowedOrigins = []string{"http://localhost:3000"}
+	c.Ingestion.ChunkSize = 1000
+	c.Ingestion.ChunkOverlap = 200
+	c.Zilliz.VectorDim = 1536
+	c.Search.TimeoutSec = 10
+	c.Search.ScrapeTimeoutSec = 5
+	c.Query.UnknownServiceStrategy = "unfiltered"
+	c.Users.AnonymousMode = "shared"
+	return c
+}
+
+func TestValidateUnknownServiceStrategy(t *testing.T) {
+	for _, strategy := range []string{"unfiltered", "classify", "clarify"} {
+		c := validConfig()
+		c.Query.UnknownServiceStrategy = strategy
+		if err := c.validate(); err != nil {
+			t.Errorf("strategy %q: unexpected error %v", strategy, err)
+		}
+	}
+
+	for _, strategy := range []string{"", "clarfy", "Classify"} {
+		c := validConfig()
+		c.Query.UnknownServiceStrategy = strategy
+		err := c.validate()
+		if err == nil || !strings.Contains(err.Error(), "unknownServiceStrategy") {
+			t.Errorf("strategy %q: error = %v, want an unknownServiceStrategy error", strategy, err)
+		}
+	}
+}
+
+func TestValidateApprovalSecret(t *testing.T) {
+	tests := []struct {
+		name     string
+		webhook  string
+		secret   string
+		identity string
+		wantErr  bool
+	}{
+		{name: "approvals off", webhook: "", secret: "", wantErr: false},
+		{name: "secret set", webhook: "https://hooks.example.com/approve", secret: "s3cret", identity: "X-Auth-User", wantErr: false},
+		{name: "empty secret", webhook: "https://hooks.example.com/approve", secret: "", identity: "X-Auth-User", wantErr: true},
+		{name: "placeholder", webhook: "https://hooks.example.com/approve", secret: "${APPROVAL_SECRET}", identity: "X-Auth-User", wantErr: true},
+		{name: "no identity header", webhook: "https://hooks.example.com/approve", secret: "s3cret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			c.Actions.ApprovalWebhookURL = tt.webhook
+			c.Actions.ApprovalSecret = tt.secret
+			c.Users.IdentityHeader = tt.identity
+
+			err := c.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAnonymousMode(t *testing.T) {
+	for _, mode := range []string{"shared", "ip"} {
+		c := validConfig()
+		c.Users.AnonymousMode = mode
+		if err := c.validate(); err != nil {
+			t.Errorf("mode %q: unexpected error %v", mode, err)
+		}
+	}
+
+	for _, mode := range []string{"", "IP", "per-ip"} {
+		c := validConfig()
+		c.Users.AnonymousMode = mode
+		err := c.validate()
+		if err == nil || !strings.Contains(err.Error(), "anonymousMode") {
+			t.Errorf("mode %q: error = %v, want an anonymousMode error", mode, err)
+		}
+	}
+}
+
+func TestValidateEmbeddingDim(t *testing.T) {
+	tests := []struct {
+		name         string
+		embeddingDim int
+		vectorDim    int
+		wantErr      bool
+	}{
+		{name: "matching", embeddingDim: 1536, vectorDim: 1536},
+		{name: "derived from the model", embeddingDim: 0, vectorDim: 1024},
+		{name: "mismatch", embeddingDim: 3072, vectorDim: 1536, wantErr: true},
+		{name: "no collection dimension", embeddingDim: 0, vectorDim: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			c.LLM.EmbeddingDim = tt.embeddingDim
+			c.Zilliz.VectorDim = tt.vectorDim
+
+			err := c.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateChunking(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		overlap int
+		wantErr bool
+	}{
+		{name: "defaults", size: 1000, overlap: 100},
+		{name: "no overlap", size: 500, overlap: 0},
+		{name: "zero size", size: 0, overlap: 0, wantErr: true},
+		{name: "negative overlap", size: 1000, overlap: -1, wantErr: true},
+		{name: "overlap equals size", size: 500, overlap: 500, wantErr: true},
+		{name: "overlap exceeds size", size: 500, overlap: 800, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			c.Ingestion.ChunkSize = tt.size
+			c.Ingestion.ChunkOverlap = tt.overlap
+
+			err := c.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "ingestion.chunk") {
+				t.Errorf("error = %v, want it to name the chunk setting", err)
+			}
+		})
+	}
+}
+
+func TestValidateAllowedOrigins(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		want        []string
+		wantErr     bool
+	}{
+		{name: "single", origins: []string{"http://localhost:3000"}, want: []string{"http://localhost:3000"}},
+		{
+			name:    "staging and prod",
+			origins: []string{" https://staging.example.com ", "HTTPS://App.Example.com", ""},
+			want:    []string{"https://staging.example.com", "https://app.example.com"},
+		},
+		{name: "wildcard", origins: []string{"*"}, want: []string{"*"}},
+		{name: "wildcard with credentials", origins: []string{"https://app.example.com", "*"}, credentials: true, wantErr: true},
+		{name: "none", origins: []string{" "}, wantErr: true},
+		{name: "no scheme", origins: []string{"app.example.com"}, wantErr: true},
+		{name: "trailing slash", origins: []string{"https://app.example.com/"}, wantErr: true},
+		{name: "path", origins: []string{"https://app.example.com/login"}, wantErr: true},
+		{name: "not http", origins: []string{"ftp://app.example.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			c.Server.AllowedOrigins = tt.origins
+			c.Server.AllowCredentials = tt.credentials
+
+			err := c.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), "server.allowedOrigins") {
+					t.Errorf("error = %v, want it to name the origins setting", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(c.Server.AllowedOrigins, tt.want) {
+				t.Errorf("origins = %q, want %q", c.Server.AllowedOrigins, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadAllowedOriginsFromEnv(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Setenv("AWS_AGENT_SERVER_ALLOWEDORIGINS", "https://staging.example.com, https://app.example.com")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := []string{"https://staging.example.com", "https://app.example.com"}
+	if !reflect.DeepEqual(cfg.Server.AllowedOrigins, want) {
+		t.Errorf("origins = %q, want %q", cfg.Server.AllowedOrigins, want)
+	}
+	if !cfg.Server.AllowCredentials {
+		t.Error("credentials disabled by default")
+	}
+}
@@ -0,0 +1,52 @@
+package ctxutil
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDetachKeepsValuesAndIgnoresParentCancellation(t *testing.T) {
+	parent, cancelParent := context.WithCancel(WithRequestID(context.Background(), "req-1"))
+	lifecycle, stopLifecycle := context.WithCancel(context.Background())
+	defer stopLifecycle()
+
+	ctx, cancel := Detach(parent, lifecycle)
+	defer cancel()
+
+	if got := RequestID(ctx); got != "req-1" {
+		t.Errorf("RequestID = %q, want req-1", got)
+	}
+
+	cancelParent()
+	select {
+	case <-ctx.Done():
+		t.Fatal("detached context cancelled with its parent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	stopLifecycle()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("detached context survived the lifecycle context")
+	}
+}
+
+func TestDetachCancelFunc(t *testing.T) {
+	ctx, cancel := Detach(context.Background(), context.Background())
+	cancel()
+
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatal("cancel did not stop the detached context")
+	}
+}
+
+func TestWithRequestIDEmpty(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "")
+	if got := RequestID(ctx); got != "" {
+		t.Errorf("RequestID = %q, want empty", got)
+	}
+}
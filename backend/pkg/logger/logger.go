@@ -1,14 +1,22 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"sync/atomic"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+
+	"github.com/aws-agent/backend/pkg/ctxutil"
 )
 
-var Log *zap.Logger
+var log atomic.Pointer[zap.Logger]
+
+func init() {
+	log.Store(zap.NewNop())
+}
 
 func Init(level, format, outputPath string) error {
 	var zapLevel zapcore.Level
@@ -50,38 +58,45 @@ func Init(level, format, outputPath string) error {
 	}
 
 	core := zapcore.NewCore(encoder, writeSyncer, zapLevel)
-	Log = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+	log.Store(zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)))
 
 	return nil
 }
 
 func Info(msg string, fields ...zap.Field) {
-	Log.Info(msg, fields...)
+	log.Load().Info(msg, fields...)
 }
 
 func Error(msg string, fields ...zap.Field) {
-	Log.Error(msg, fields...)
+	log.Load().Error(msg, fields...)
 }
 
 func Debug(msg string, fields ...zap.Field) {
-	Log.Debug(msg, fields...)
+	log.Load().Debug(msg, fields...)
 }
 
 func Warn(msg string, fields ...zap.Field) {
-	Log.Warn(msg, fields...)
+	log.Load().Warn(msg, fields...)
 }
 
 func Fatal(msg string, fields ...zap.Field) {
-	Log.Fatal(msg, fields...)
+	log.Load().Fatal(msg, fields...)
 }
 
 func Sync() {
-	Log.Sync()
+	log.Load().Sync()
 }
 
 func GetLogger() *zap.Logger {
-	if Log == nil {
-		return zap.NewNop()
+	return log.Load()
+}
+
+// FromContext returns the logger with the request ID carried by ctx, if
+// any, so lines logged while serving a request can be correlated.
+func FromContext(ctx context.Context) *zap.Logger {
+	l := log.Load()
+	if id := ctxutil.RequestID(ctx); id != "" {
+		return l.With(zap.String("request_id", id))
 	}
-	return Log
+	return l
 }
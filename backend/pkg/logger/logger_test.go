@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws-agent/backend/pkg/ctxutil"
+)
+
+func TestLoggingBeforeInit(t *testing.T) {
+	Info("before init")
+	FromContext(context.Background()).Debug("before init")
+	if GetLogger() == nil {
+		t.Fatal("GetLogger() = nil before Init")
+	}
+}
+
+// TestConcurrentInit is meant to run under -race: goroutines log while
+// others re-initialise the logger.
+func TestConcurrentInit(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "test.log")
+	ctx := ctxutil.WithRequestID(context.Background(), "req-1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := Init("debug", "json", output); err != nil {
+				t.Errorf("Init: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				Info("concurrent")
+				FromContext(ctx).Warn("concurrent")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestInitInvalidLevel(t *testing.T) {
+	if err := Init("loud", "json", "stdout"); err == nil {
+		t.Error("Init with an invalid level succeeded")
+	}
+}
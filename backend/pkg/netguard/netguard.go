@@ -0,0 +1,85 @@
+// Package netguard builds HTTP clients for fetching user-supplied URLs that
+// cannot be pointed at internal services.
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrBlockedAddress     = errors.New("address is not publicly routable")
+	ErrRedirectNotAllowed = errors.New("redirect target is not allowed")
+)
+
+type Config struct {
+	// Timeout bounds each request, redirects and body included.
+	Timeout time.Duration
+	// DialTimeout bounds each connection attempt.
+	DialTimeout  time.Duration
+	MaxRedirects int
+	// Allowed reports whether a redirect target may be followed. A nil
+	// Allowed follows redirects to any public address.
+	Allowed func(u *url.URL) bool
+}
+
+// NewClient returns a client whose dialer checks the resolved address of
+// every connection, redirects included, so a URL cannot reach internal
+// services by DNS or redirect tricks. Proxies are disabled because they
+// would hide the final address from the check.
+func NewClient(cfg Config) *http.Client {
+	if cfg.MaxRedirects <= 0 {
+		cfg.MaxRedirects = 5
+	}
+
+	dialer := &net.Dialer{
+		Timeout: cfg.DialTimeout,
+		Control: Control,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= cfg.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+			}
+			if cfg.Allowed != nil && !cfg.Allowed(req.URL) {
+				return fmt.Errorf("%w: %s", ErrRedirectNotAllowed, req.URL.Host)
+			}
+			return nil
+		},
+	}
+}
+
+// Control is a net.Dialer Control function that refuses connections to
+// addresses that are not publicly routable.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	return nil
+}
+
+func IsPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast()
+}
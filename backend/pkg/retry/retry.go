@@ -17,6 +17,7 @@ type Config struct {
 	Multiplier      float64
 	JitterFraction  float64
 	RetryableErrors []error
+	Classifier      Classifier
 	Logger          *zap.Logger
 }
 
@@ -67,7 +68,7 @@ func Do(ctx context.Context, cfg Config, operation func() error) error {
 
 		lastErr = err
 
-		if !isRetryable(err, cfg.RetryableErrors) {
+		if !isRetryable(err, cfg) {
 			if cfg.Logger != nil {
 				cfg.Logger.Debug("Error not retryable",
 					zap.Error(err),
@@ -112,12 +113,16 @@ func DoWithResult[T any](ctx context.Context, cfg Config, operation func() (T, e
 	return result, err
 }
 
-func isRetryable(err error, retryableErrors []error) bool {
-	if len(retryableErrors) == 0 {
+func isRetryable(err error, cfg Config) bool {
+	if len(cfg.RetryableErrors) == 0 && cfg.Classifier == nil {
 		return true
 	}
 
-	for _, retryableErr := range retryableErrors {
+	if cfg.Classifier != nil && cfg.Classifier(err) {
+		return true
+	}
+
+	for _, retryableErr := range cfg.RetryableErrors {
 		if errors.Is(err, retryableErr) {
 			return true
 		}
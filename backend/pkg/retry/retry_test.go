@@ -0,0 +1,71 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// attempts runs an operation failing with err under cfg and returns how many
+// times it ran.
+func attempts(t *testing.T, cfg Config, err error) int {
+	t.Helper()
+
+	calls := 0
+	got := Do(context.Background(), cfg, func() error {
+		calls++
+		return err
+	})
+	if !errors.Is(got, err) {
+		t.Fatalf("Do returned %v, want %v", got, err)
+	}
+	return calls
+}
+
+func TestDoClassifiesErrors(t *testing.T) {
+	cfg := Config{MaxAttempts: 3, InitialDelay: time.Millisecond, Classifier: IsTransient}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "bad request", err: &StatusError{StatusCode: 400, Message: "invalid input"}, want: 1},
+		{name: "content policy", err: fmt.Errorf("failed to create completion: %w", &StatusError{StatusCode: 403}), want: 1},
+		{name: "rate limited", err: &StatusError{StatusCode: 429}, want: 3},
+		{name: "server error", err: fmt.Errorf("failed to call: %w", &StatusError{StatusCode: 500}), want: 3},
+		{name: "network timeout", err: &net.DNSError{Err: "timeout", IsTimeout: true}, want: 3},
+		{name: "deadline", err: context.DeadlineExceeded, want: 3},
+		{name: "plain error", err: errors.New("boom"), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attempts(t, cfg, tt.err); got != tt.want {
+				t.Errorf("attempts = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoWithoutClassifierRetriesEverything(t *testing.T) {
+	cfg := Config{MaxAttempts: 2, InitialDelay: time.Millisecond}
+	if got := attempts(t, cfg, &StatusError{StatusCode: 400}); got != 2 {
+		t.Errorf("attempts = %d, want every error retried without a classifier", got)
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	errCustom := errors.New("custom")
+	classify := AnyOf(nil, IsTransient, func(err error) bool { return errors.Is(err, errCustom) })
+
+	if !classify(errCustom) || !classify(&StatusError{StatusCode: 503}) {
+		t.Error("AnyOf did not retry an error one of its classifiers accepts")
+	}
+	if classify(&StatusError{StatusCode: 404}) {
+		t.Error("AnyOf retried an error none of its classifiers accepts")
+	}
+}
@@ -0,0 +1,101 @@
+package shutdown
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Phase int
+
+const (
+	PhaseServer Phase = iota
+	PhaseWorkers
+	PhaseClients
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseServer:
+		return "server"
+	case PhaseWorkers:
+		return "workers"
+	case PhaseClients:
+		return "clients"
+	default:
+		return "unknown"
+	}
+}
+
+type step struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type Coordinator struct {
+	timeout time.Duration
+	logger  *zap.Logger
+	phases  map[Phase][]step
+}
+
+func NewCoordinator(timeout time.Duration, logger *zap.Logger) *Coordinator {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	return &Coordinator{
+		timeout: timeout,
+		logger:  logger,
+		phases:  make(map[Phase][]step),
+	}
+}
+
+// Wait blocks until wg's goroutines finish or ctx is done. Components that
+// start background work from request handlers use it to drain that work in
+// PhaseWorkers, before the clients it uses are closed.
+func Wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain background work: %w", ctx.Err())
+	}
+}
+
+func (c *Coordinator) Register(phase Phase, name string, fn func(ctx context.Context) error) {
+	c.phases[phase] = append(c.phases[phase], step{name: name, fn: fn})
+}
+
+func (c *Coordinator) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	for _, phase := range []Phase{PhaseServer, PhaseWorkers, PhaseClients} {
+		for _, s := range c.phases[phase] {
+			start := time.Now()
+			if err := s.fn(ctx); err != nil {
+				c.logger.Error("Shutdown step failed",
+					zap.String("phase", phase.String()),
+					zap.String("step", s.name),
+					zap.Error(err),
+				)
+				continue
+			}
+
+			c.logger.Info("Shutdown step completed",
+				zap.String("phase", phase.String()),
+				zap.String("step", s.name),
+				zap.Duration("duration", time.Since(start)),
+			)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeClient fails any use after Close, like a closed database handle.
+type fakeClient struct {
+	mu     sync.Mutex
+	closed bool
+	misuse int
+}
+
+func (c *fakeClient) Use() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		c.misuse++
+	}
+}
+
+func (c *fakeClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+func TestShutdownClosesClientsAfterDrain(t *testing.T) {
+	client := &fakeClient{}
+	lifecycle, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		steps []string
+	)
+	record := func(name string) {
+		mu.Lock()
+		steps = append(steps, name)
+		mu.Unlock()
+	}
+
+	// An in-flight request that takes a while and starts background work
+	// which keeps using the client until the lifecycle ends.
+	var requests, background sync.WaitGroup
+	requests.Add(1)
+	go func() {
+		defer requests.Done()
+		time.Sleep(20 * time.Millisecond)
+		client.Use()
+
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			for lifecycle.Err() == nil {
+				client.Use()
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond)
+			client.Use()
+		}()
+	}()
+
+	c := NewCoordinator(5*time.Second, zap.NewNop())
+	// Registered out of order to show phases, not registration, set the order.
+	c.Register(PhaseClients, "client", func(ctx context.Context) error {
+		record("client")
+		client.Close()
+		return nil
+	})
+	c.Register(PhaseWorkers, "background", func(ctx context.Context) error {
+		err := Wait(ctx, &background)
+		record("background")
+		return err
+	})
+	c.Register(PhaseServer, "http", func(ctx context.Context) error {
+		err := Wait(ctx, &requests)
+		record("http")
+		return err
+	})
+	c.Register(PhaseServer, "lifecycle", func(ctx context.Context) error {
+		cancel()
+		record("lifecycle")
+		return nil
+	})
+
+	c.Shutdown()
+
+	want := []string{"http", "lifecycle", "background", "client"}
+	if len(steps) != len(want) {
+		t.Fatalf("steps = %v, want %v", steps, want)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Fatalf("steps = %v, want %v", steps, want)
+		}
+	}
+	if client.misuse != 0 {
+		t.Errorf("client used %d times after it was closed", client.misuse)
+	}
+}
+
+func TestWaitStopsAtDeadline(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	defer wg.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := Wait(ctx, &wg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait error = %v, want the deadline", err)
+	}
+}
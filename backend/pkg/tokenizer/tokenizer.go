@@ -0,0 +1,133 @@
+// Package tokenizer approximates the cl100k BPE token count without the
+// merge tables: text is pre-split the way cl100k splits it (words with their
+// leading space, digit groups of up to three, punctuation runs, whitespace)
+// and each piece is charged by length. It is an estimate, so callers
+// budgeting against a hard limit should keep some headroom.
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// singleTokenWordChars is the longest ASCII word charged as one token;
+	// cl100k has whole-word merges for nearly all common English words.
+	singleTokenWordChars = 10
+	// charsPerToken is the average run of letters per token inside longer
+	// words and identifiers such as AccessDeniedException.
+	charsPerToken = 6
+)
+
+// Count returns the estimated number of tokens in text.
+func Count(text string) int {
+	total := 0
+	scan(text, func(_ int, cost int) bool {
+		total += cost
+		return true
+	})
+	return total
+}
+
+// Truncate returns the longest prefix of text that fits in maxTokens,
+// cut on a piece boundary. maxTokens <= 0 means no limit.
+func Truncate(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return text
+	}
+
+	total := 0
+	end := len(text)
+	scan(text, func(start int, cost int) bool {
+		if total+cost > maxTokens {
+			end = start
+			return false
+		}
+		total += cost
+		return true
+	})
+	return text[:end]
+}
+
+// scan walks the pre-tokenized pieces of text, reporting each piece's byte
+// offset and token cost until visit returns false.
+func scan(text string, visit func(start, cost int) bool) {
+	i := 0
+	for i < len(text) {
+		start := i
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		// A single space attaches to the following word or punctuation run.
+		if r == ' ' && i+size < len(text) {
+			next, _ := utf8.DecodeRuneInString(text[i+size:])
+			if unicode.IsLetter(next) || isPunct(next) {
+				i += size
+				r, size = next, utf8.RuneLen(next)
+			}
+		}
+
+		var cost int
+		switch {
+		case unicode.IsLetter(r):
+			var ascii, other int
+			for i < len(text) {
+				r, size = utf8.DecodeRuneInString(text[i:])
+				if !unicode.IsLetter(r) && !unicode.IsMark(r) {
+					break
+				}
+				if r < utf8.RuneSelf {
+					ascii++
+				} else {
+					other++
+				}
+				i += size
+			}
+			// Non-Latin scripts are mostly one token per character.
+			cost = other
+			if ascii > singleTokenWordChars {
+				cost += (ascii + charsPerToken - 1) / charsPerToken
+			} else if ascii > 0 {
+				cost++
+			}
+		case unicode.IsDigit(r):
+			digits := 0
+			for i < len(text) {
+				r, size = utf8.DecodeRuneInString(text[i:])
+				if !unicode.IsDigit(r) {
+					break
+				}
+				digits++
+				i += size
+			}
+			cost = (digits + 2) / 3
+		case unicode.IsSpace(r):
+			for i < len(text) {
+				r, size = utf8.DecodeRuneInString(text[i:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				i += size
+			}
+			cost = 1
+		default:
+			runes := 0
+			for i < len(text) {
+				r, size = utf8.DecodeRuneInString(text[i:])
+				if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+					break
+				}
+				runes++
+				i += size
+			}
+			cost = (runes + 1) / 2
+		}
+
+		if !visit(start, cost) {
+			return
+		}
+	}
+}
+
+func isPunct(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
@@ -0,0 +1,48 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"Lambda", 1},
+		{"Raise the timeout", 3},
+		{"AccessDeniedException", 4},
+		{"900 seconds", 2},
+		{"1234567", 3},
+		{"s3://bucket", 5},
+	}
+
+	for _, tt := range tests {
+		if got := Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateFitsBudget(t *testing.T) {
+	text := strings.Repeat("Lambda AccessDeniedException at 2024-05-01, retry in 900ms. ", 50)
+
+	for _, maxTokens := range []int{1, 7, 50, 333} {
+		got := Truncate(text, maxTokens)
+		if n := Count(got); n > maxTokens {
+			t.Errorf("Truncate(_, %d) kept %d tokens", maxTokens, n)
+		}
+		if !strings.HasPrefix(text, got) {
+			t.Errorf("Truncate(_, %d) = %q, want a prefix of the input", maxTokens, got)
+		}
+		if n := Count(text[:len(got)+1]); len(got) < len(text) && n <= maxTokens {
+			t.Errorf("Truncate(_, %d) stopped early at %d bytes", maxTokens, len(got))
+		}
+	}
+
+	if got := Truncate(text, 0); got != text {
+		t.Error("Truncate with no limit changed the text")
+	}
+}
@@ -0,0 +1,15 @@
+package utils
+
+import "unicode/utf8"
+
+// TruncateRunes returns text cut to at most maxChars characters, never
+// splitting a multi-byte character. A maxChars of zero or less disables
+// truncation.
+func TruncateRunes(text string, maxChars int) string {
+	if maxChars <= 0 || utf8.RuneCountInString(text) <= maxChars {
+		return text
+	}
+
+	runes := []rune(text)
+	return string(runes[:maxChars])
+}
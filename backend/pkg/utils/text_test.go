@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		text     string
+		maxChars int
+		want     string
+	}{
+		{text: "hello", maxChars: 10, want: "hello"},
+		{text: "hello", maxChars: 3, want: "hel"},
+		{text: "hello", maxChars: 0, want: "hello"},
+		{text: "héllo wörld", maxChars: 4, want: "héll"},
+		{text: "日本語のテキスト", maxChars: 3, want: "日本語"},
+		{text: "🙂🙂🙂", maxChars: 2, want: "🙂🙂"},
+	}
+
+	for _, tt := range tests {
+		got := TruncateRunes(tt.text, tt.maxChars)
+		if got != tt.want {
+			t.Errorf("TruncateRunes(%q, %d) = %q, want %q", tt.text, tt.maxChars, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("TruncateRunes(%q, %d) returned invalid UTF-8", tt.text, tt.maxChars)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package wsproto defines the messages exchanged over the /api/v1/ws
+// endpoint.
+//
+// Every message is a JSON object carrying a "version" and a "type". Clients
+// send "query" messages; the server answers each query with a "status"
+// message, any number of "chunk" messages holding response deltas, and
+// finally either a "complete" or an "error" message. The status message carries
+// the message_id assigned to the query; an error raised after chunks were sent
+// repeats that message_id and sets "aborted" so clients can discard the
+// partial answer. A client message without a version is treated as the
+// current version.
+//
+// One query runs per connection at a time. A "cancel" message aborts it; the
+// query then ends with a "canceled" error. The server sends WebSocket ping
+// frames and drops connections that stop answering them.
+package wsproto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const Version = 1
+
+type MessageType string
+
+const (
+	TypeQuery    MessageType = "query"
+	TypeCancel   MessageType = "cancel"
+	TypeStatus   MessageType = "status"
+	TypeChunk    MessageType = "chunk"
+	TypeComplete MessageType = "complete"
+	TypeError    MessageType = "error"
+)
+
+const (
+	CodeInvalidMessage     = "invalid_message"
+	CodeUnsupportedVersion = "unsupported_version"
+	CodeUnknownType        = "unknown_type"
+	CodeBudgetExceeded     = "budget_exceeded"
+	CodeQuotaExceeded      = "quota_exceeded"
+	CodeQueryFailed        = "query_failed"
+	CodeQueryInProgress    = "query_in_progress"
+	CodeCanceled           = "canceled"
+)
+
+var (
+	ErrInvalidMessage     = errors.New("invalid message")
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+	ErrUnknownType        = errors.New("unknown message type")
+)
+
+type Envelope struct {
+	Version int         `json:"version"`
+	Type    MessageType `json:"type"`
+}
+
+type QueryMessage struct {
+	Envelope
+	Content        string `json:"content"`
+	UserID         string `json:"user_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	// WebSearch asks for web search on this query; it only takes effect
+	// where the server permits web search.
+	WebSearch *bool `json:"web_search,omitempty"`
+}
+
+// CancelMessage aborts the in-flight query. MessageID is optional; when set
+// it must match the query's message_id.
+type CancelMessage struct {
+	Envelope
+	MessageID string `json:"message_id,omitempty"`
+}
+
+// ClientMessage is a decoded client message; exactly one field is set.
+type ClientMessage struct {
+	Query  *QueryMessage
+	Cancel *CancelMessage
+}
+
+type StatusMessage struct {
+	Envelope
+	MessageID string `json:"message_id,omitempty"`
+	Content   string `json:"content"`
+}
+
+type ChunkMessage struct {
+	Envelope
+	Content string `json:"content"`
+}
+
+type Source struct {
+	Type       string  `json:"type"`
+	URL        string  `json:"url"`
+	ChunkID    string  `json:"chunk_id,omitempty"`
+	Confidence float64 `json:"confidence"`
+}
+
+type Citation struct {
+	Marker      string  `json:"marker"`
+	SourceIndex int     `json:"source_index"`
+	URL         string  `json:"url,omitempty"`
+	ChunkID     string  `json:"chunk_id,omitempty"`
+	Confidence  float64 `json:"confidence"`
+	Dangling    bool    `json:"dangling"`
+}
+
+type CompleteMessage struct {
+	Envelope
+	MessageID  string     `json:"message_id"`
+	Sources    []Source   `json:"sources"`
+	Citations  []Citation `json:"citations"`
+	Confidence float64    `json:"confidence"`
+	LatencyMS  int        `json:"latency_ms"`
+	FollowUps  []string   `json:"follow_ups,omitempty"`
+	Risk       string     `json:"risk,omitempty"`
+}
+
+type ErrorMessage struct {
+	Envelope
+	Code      string `json:"code"`
+	Error     string `json:"error"`
+	MessageID string `json:"message_id,omitempty"`
+	Aborted   bool   `json:"aborted,omitempty"`
+}
+
+func NewStatus(messageID, content string) StatusMessage {
+	return StatusMessage{Envelope: envelope(TypeStatus), MessageID: messageID, Content: content}
+}
+
+func NewChunk(content string) ChunkMessage {
+	return ChunkMessage{Envelope: envelope(TypeChunk), Content: content}
+}
+
+func NewComplete() CompleteMessage {
+	return CompleteMessage{Envelope: envelope(TypeComplete), Sources: []Source{}, Citations: []Citation{}}
+}
+
+func NewError(code, message string) ErrorMessage {
+	return ErrorMessage{Envelope: envelope(TypeError), Code: code, Error: message}
+}
+
+func NewQueryError(messageID string, aborted bool, message string) ErrorMessage {
+	msg := NewError(CodeQueryFailed, message)
+	msg.MessageID = messageID
+	msg.Aborted = aborted
+	return msg
+}
+
+func NewCanceled(messageID string, aborted bool) ErrorMessage {
+	msg := NewError(CodeCanceled, "Query was canceled")
+	msg.MessageID = messageID
+	msg.Aborted = aborted
+	return msg
+}
+
+func envelope(t MessageType) Envelope {
+	return Envelope{Version: Version, Type: t}
+}
+
+// DecodeClientMessage validates a raw client message and returns the decoded
+// query or cancel request. Errors wrap one of the exported sentinel errors;
+// ErrorCode maps them to the code sent back to the client.
+func DecodeClientMessage(data []byte) (*ClientMessage, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	if env.Version == 0 {
+		env.Version = Version
+	}
+	if env.Version < 0 || env.Version > Version {
+		return nil, fmt.Errorf("%w: %d (server supports up to %d)", ErrUnsupportedVersion, env.Version, Version)
+	}
+
+	switch env.Type {
+	case TypeQuery:
+	case TypeCancel:
+		var msg CancelMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+		}
+		msg.Envelope = env
+		return &ClientMessage{Cancel: &msg}, nil
+	case "":
+		return nil, fmt.Errorf("%w: type is required", ErrInvalidMessage)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, env.Type)
+	}
+
+	var msg QueryMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	msg.Envelope = env
+
+	if strings.TrimSpace(msg.Content) == "" {
+		return nil, fmt.Errorf("%w: content is required", ErrInvalidMessage)
+	}
+
+	return &ClientMessage{Query: &msg}, nil
+}
+
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrUnsupportedVersion):
+		return CodeUnsupportedVersion
+	case errors.Is(err, ErrUnknownType):
+		return CodeUnknownType
+	default:
+		return CodeInvalidMessage
+	}
+}
@@ -0,0 +1,101 @@
+package wsproto
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDecodeQueryWebSearch(t *testing.T) {
+	tests := map[string]*bool{
+		`{"type":"query","content":"Lambda timeout"}`:                    nil,
+		`{"type":"query","content":"Lambda timeout","web_search":true}`:  boolPtr(true),
+		`{"type":"query","content":"Lambda timeout","web_search":false}`: boolPtr(false),
+	}
+
+	for data, want := range tests {
+		msg, err := DecodeClientMessage([]byte(data))
+		if err != nil {
+			t.Fatalf("decode %s: %v", data, err)
+		}
+		got := msg.Query.WebSearch
+		if (got == nil) != (want == nil) || (got != nil && *got != *want) {
+			t.Errorf("decode %s: web_search = %v, want %v", data, got, want)
+		}
+	}
+}
+
+func TestDecodeClientMessage(t *testing.T) {
+	msg, err := DecodeClientMessage([]byte(`{"version":1,"type":"query","content":"Lambda timeout","user_id":"u1","conversation_id":"c1"}`))
+	if err != nil {
+		t.Fatalf("decode query: %v", err)
+	}
+	if msg.Query == nil || msg.Cancel != nil || msg.Query.Content != "Lambda timeout" ||
+		msg.Query.UserID != "u1" || msg.Query.ConversationID != "c1" || msg.Query.Version != Version {
+		t.Errorf("query = %+v, want the decoded query", msg.Query)
+	}
+
+	msg, err = DecodeClientMessage([]byte(`{"type":"query","content":"Lambda timeout"}`))
+	if err != nil || msg.Query.Version != Version {
+		t.Errorf("unversioned query: %+v, err %v; want the current version assumed", msg, err)
+	}
+
+	msg, err = DecodeClientMessage([]byte(`{"type":"cancel","message_id":"m1"}`))
+	if err != nil || msg.Cancel == nil || msg.Query != nil || msg.Cancel.MessageID != "m1" {
+		t.Errorf("cancel: %+v, err %v; want a cancel for m1", msg, err)
+	}
+}
+
+func TestDecodeClientMessageRejectsInvalidMessages(t *testing.T) {
+	tests := []struct {
+		data     string
+		wantErr  error
+		wantCode string
+	}{
+		{data: `not json`, wantErr: ErrInvalidMessage, wantCode: CodeInvalidMessage},
+		{data: `{"content":"Lambda timeout"}`, wantErr: ErrInvalidMessage, wantCode: CodeInvalidMessage},
+		{data: `{"type":"query","content":"  "}`, wantErr: ErrInvalidMessage, wantCode: CodeInvalidMessage},
+		{data: `{"type":"query","content":42}`, wantErr: ErrInvalidMessage, wantCode: CodeInvalidMessage},
+		{data: `{"type":"subscribe","content":"Lambda"}`, wantErr: ErrUnknownType, wantCode: CodeUnknownType},
+		{data: `{"version":2,"type":"query","content":"Lambda"}`, wantErr: ErrUnsupportedVersion, wantCode: CodeUnsupportedVersion},
+		{data: `{"version":-1,"type":"query","content":"Lambda"}`, wantErr: ErrUnsupportedVersion, wantCode: CodeUnsupportedVersion},
+	}
+
+	for _, tt := range tests {
+		msg, err := DecodeClientMessage([]byte(tt.data))
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("decode %s: message %+v, error %v; want %v", tt.data, msg, err, tt.wantErr)
+			continue
+		}
+		if code := ErrorCode(err); code != tt.wantCode {
+			t.Errorf("decode %s: code = %q, want %q", tt.data, code, tt.wantCode)
+		}
+	}
+}
+
+func TestServerMessagesCarryVersionAndType(t *testing.T) {
+	messages := map[MessageType]interface{}{
+		TypeStatus:   NewStatus("m1", "Searching"),
+		TypeChunk:    NewChunk("Raise"),
+		TypeComplete: NewComplete(),
+		TypeError:    NewError(CodeQueryFailed, "boom"),
+	}
+
+	for want, msg := range messages {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatalf("marshal %s: %v", want, err)
+		}
+		var env Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			t.Fatalf("unmarshal %s: %v", want, err)
+		}
+		if env.Version != Version || env.Type != want {
+			t.Errorf("%s envelope = %+v, want version %d", want, env, Version)
+		}
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -11,6 +11,7 @@ interface Action {
 }
 
 interface ActionPlan {
+  plan_id: string;
   actions: Action[];
   explanation: string;
   risk_level: string;
@@ -37,7 +38,8 @@ export default function ActionsPanel({ issue, context }: { issue: string; contex
 
       const data = await response.json();
       setPlan({
-        actions: data.plan || [],
+        plan_id: data.plan_id,
+        actions: data.summary || [],
         explanation: data.explanation || '',
         risk_level: data.risk_level || 'MEDIUM',
         requires_approval: data.requires_approval || false,
@@ -60,7 +62,7 @@ export default function ActionsPanel({ issue, context }: { issue: string; contex
         headers: {
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify({ plan, approved }),
+        body: JSON.stringify({ plan_id: plan.plan_id, approved }),
       });
 
       const data = await response.json();
@@ -5,6 +5,7 @@ import MessageBubble from './MessageBubble';
 import SourceCard from './SourceCard';
 import FeedbackButton from './FeedbackButton';
 import ActionsPanel from '../actions/ActionsPanel';
+import { queryMessage, ServerMessage } from '@/lib/wsProtocol';
 
 interface Message {
   id: string;
@@ -28,6 +29,8 @@ export default function ChatInterface() {
   const [isLoading, setIsLoading] = useState(false);
   const [useWebSocket, setUseWebSocket] = useState(true);
   const wsRef = useRef<WebSocket | null>(null);
+  // One conversation per chat session, so follow-ups keep their context.
+  const conversationIdRef = useRef<string>(Date.now().toString(36) + Math.random().toString(36).slice(2));
 
   useEffect(() => {
     return () => {
@@ -54,14 +57,11 @@ export default function ChatInterface() {
     setMessages(prev => [...prev, assistantMessage]);
 
     ws.onopen = () => {
-      ws.send(JSON.stringify({
-        query,
-        user_id: 'default_user',
-      }));
+      ws.send(JSON.stringify(queryMessage(query, 'default_user', conversationIdRef.current)));
     };
 
     ws.onmessage = (event) => {
-      const data = JSON.parse(event.data);
+      const data: ServerMessage = JSON.parse(event.data);
 
       if (data.type === 'chunk') {
         currentContent += data.content;
@@ -70,16 +70,10 @@ export default function ChatInterface() {
             ? { ...msg, content: currentContent }
             : msg
         ));
-      } else if (data.type === 'sources') {
-        setMessages(prev => prev.map(msg =>
-          msg.id === assistantMessageId
-            ? { ...msg, sources: data.sources }
-            : msg
-        ));
       } else if (data.type === 'complete') {
         setMessages(prev => prev.map(msg =>
           msg.id === assistantMessageId
-            ? { ...msg, confidence: data.confidence, isStreaming: false }
+            ? { ...msg, sources: data.sources, confidence: data.confidence, isStreaming: false }
             : msg
         ));
         setIsLoading(false);
@@ -87,7 +81,7 @@ export default function ChatInterface() {
       } else if (data.type === 'error') {
         setMessages(prev => prev.map(msg =>
           msg.id === assistantMessageId
-            ? { ...msg, content: `Error: ${data.message}`, isStreaming: false }
+            ? { ...msg, content: `Error: ${data.error}`, isStreaming: false }
             : msg
         ));
         setIsLoading(false);
@@ -120,6 +114,7 @@ export default function ChatInterface() {
         body: JSON.stringify({
           query,
           user_id: 'default_user',
+          conversation_id: conversationIdRef.current,
         }),
       });
 
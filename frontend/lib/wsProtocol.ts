@@ -0,0 +1,56 @@
+// Mirrors backend/pkg/wsproto. Bump PROTOCOL_VERSION together with wsproto.Version.
+export const PROTOCOL_VERSION = 1;
+
+export interface WsSource {
+  type: string;
+  url: string;
+  chunk_id?: string;
+  confidence: number;
+}
+
+export interface WsCitation {
+  marker: string;
+  source_index: number;
+  url?: string;
+  chunk_id?: string;
+  confidence: number;
+  dangling: boolean;
+}
+
+export interface QueryMessage {
+  version: number;
+  type: 'query';
+  content: string;
+  user_id?: string;
+  conversation_id?: string;
+}
+
+export interface CancelMessage {
+  version: number;
+  type: 'cancel';
+  message_id?: string;
+}
+
+export type ServerMessage =
+  | { version: number; type: 'status'; message_id?: string; content: string }
+  | { version: number; type: 'chunk'; content: string }
+  | {
+      version: number;
+      type: 'complete';
+      message_id: string;
+      sources: WsSource[];
+      citations: WsCitation[];
+      confidence: number;
+      latency_ms: number;
+      follow_ups?: string[];
+      risk?: string;
+    }
+  | { version: number; type: 'error'; code: string; error: string; message_id?: string; aborted?: boolean };
+
+export function queryMessage(content: string, userId?: string, conversationId?: string): QueryMessage {
+  return { version: PROTOCOL_VERSION, type: 'query', content, user_id: userId, conversation_id: conversationId };
+}
+
+export function cancelMessage(messageId?: string): CancelMessage {
+  return { version: PROTOCOL_VERSION, type: 'cancel', message_id: messageId };
+}